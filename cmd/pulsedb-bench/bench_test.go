@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"pulsedb/internal/server"
+	"pulsedb/internal/store"
+)
+
+func TestPercentile(t *testing.T) {
+	r := &result{}
+	for i := 100; i >= 1; i-- {
+		r.latencies = append(r.latencies, time.Duration(i)*time.Millisecond)
+	}
+	r.finish(time.Second)
+
+	for p, want := range map[float64]time.Duration{50: 50 * time.Millisecond, 99: 99 * time.Millisecond, 99.9: 100 * time.Millisecond, 0: time.Millisecond} {
+		if got := r.percentile(p); got != want {
+			t.Errorf("p%g = %v, want %v", p, got, want)
+		}
+	}
+	if (&result{}).percentile(50) != 0 {
+		t.Errorf("Expected no latency without requests")
+	}
+}
+
+func TestKeyChooser(t *testing.T) {
+	if _, err := newKeyChooser("zipfian", 100, 1, rand.New(rand.NewSource(1))); err == nil {
+		t.Errorf("Expected a skew of 1 to be rejected")
+	}
+	if _, err := newKeyChooser("gaussian", 100, 1.1, rand.New(rand.NewSource(1))); err == nil {
+		t.Errorf("Expected an unknown distribution to be rejected")
+	}
+
+	for _, distribution := range []string{"uniform", "zipfian"} {
+		chooser, err := newKeyChooser(distribution, 1000, 1.5, rand.New(rand.NewSource(1)))
+		if err != nil {
+			t.Fatalf("Failed to create a %s chooser: %v", distribution, err)
+		}
+		hot := 0
+		for i := 0; i < 10000; i++ {
+			key := chooser()
+			if key < 0 || key >= 1000 {
+				t.Fatalf("Key %d out of the keyspace", key)
+			}
+			if key < 10 {
+				hot++
+			}
+		}
+		// The ten first keys draw about 1% of uniform requests, most zipfian ones
+		if distribution == "uniform" && hot > 300 || distribution == "zipfian" && hot < 5000 {
+			t.Errorf("The %s distribution sent %d of 10000 requests to 10 keys", distribution, hot)
+		}
+	}
+}
+
+func TestClaim(t *testing.T) {
+	b := &bench{}
+	b.remaining.Store(10)
+	claimed := []int{b.claim(4), b.claim(4), b.claim(4), b.claim(4)}
+	if claimed[0] != 4 || claimed[1] != 4 || claimed[2] != 2 || claimed[3] != 0 {
+		t.Errorf("Unexpected claims %v", claimed)
+	}
+}
+
+func TestRunTest(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+	srv := server.NewServer(db, nil)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.Serve(ctx, listener)
+
+	opts, err := parseFlags([]string{
+		"--addr", listener.Addr().String(), "--clients", "4", "--requests", "1001",
+		"--pipeline", "8", "--keyspace", "50", "--distribution", "zipfian", "--tests", "set,get",
+	})
+	if err != nil {
+		t.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	for _, w := range opts.tests {
+		result, err := runTest(opts, w)
+		if err != nil {
+			t.Fatalf("%s failed: %v", w.name, err)
+		}
+		if result.requests != 1001 || len(result.latencies) != 1001 || result.errors != 0 {
+			t.Errorf("%s: %d requests, %d latencies, %d errors", w.name, result.requests, len(result.latencies), result.errors)
+		}
+		var out strings.Builder
+		result.csv(&out)
+		if fields := strings.Split(strings.TrimSpace(out.String()), ","); len(fields) != len(strings.Split(csvHeader, ",")) {
+			t.Errorf("CSV line %q does not match the header", out.String())
+		}
+	}
+	if db.Stats()["total_keys"] == 0 {
+		t.Errorf("Expected the SET test to write keys")
+	}
+
+	opts.duration = 50 * time.Millisecond
+	result, err := runTest(opts, opts.tests[1])
+	if err != nil || result.requests == 0 {
+		t.Errorf("Expected a timed run to send requests, got %d, %v", result.requests, err)
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	for _, args := range [][]string{
+		{"--clients", "0"},
+		{"--pipeline", "0"},
+		{"--tests", "set,scan"},
+		{"--distribution", "zipfian", "--zipf-skew", "0.5"},
+	} {
+		if _, err := parseFlags(args); err == nil {
+			t.Errorf("Expected %q to be rejected", args)
+		}
+	}
+}
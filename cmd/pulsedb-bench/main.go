@@ -0,0 +1,318 @@
+// Command pulsedb-bench measures PulseDB throughput and latency, in the
+// manner of redis-benchmark. Each test sends one kind of request from
+// concurrent connections and reports requests per second and latency
+// percentiles, so runs before and after a change can be compared.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pulsedb/internal/proto"
+)
+
+// options are the command line settings
+type options struct {
+	addr     string // RESP address
+	httpAddr string // HTTP API address, for the xadd test
+	pass     string
+
+	clients      int
+	requests     int
+	duration     time.Duration
+	pipeline     int
+	tests        []workload
+	keyspace     int
+	keyPrefix    string
+	distribution string
+	skew         float64
+	dataSize     int
+	seed         int64
+	csv          bool
+}
+
+func parseFlags(args []string) (*options, error) {
+	opts := &options{}
+	fs := flag.NewFlagSet("pulsedb-bench", flag.ContinueOnError)
+	fs.StringVar(&opts.addr, "addr", "127.0.0.1:6380", "RESP address of the server")
+	fs.StringVar(&opts.httpAddr, "http-addr", "127.0.0.1:8080", "HTTP API address of the server, used by the xadd test")
+	fs.StringVar(&opts.pass, "pass", os.Getenv("PULSEDB_CLI_AUTH"), "API key to authenticate with (default $PULSEDB_CLI_AUTH)")
+	fs.IntVar(&opts.clients, "clients", 50, "number of concurrent connections")
+	fs.IntVar(&opts.requests, "requests", 100000, "requests per test")
+	fs.DurationVar(&opts.duration, "duration", 0, "run each test for this long instead of a number of requests")
+	fs.IntVar(&opts.pipeline, "pipeline", 1, "requests sent at once on a RESP connection before reading the replies")
+	tests := fs.String("tests", "set,get,getat", "comma-separated tests to run: set, get, getat, xadd")
+	fs.IntVar(&opts.keyspace, "keyspace", 100000, "number of distinct keys (streams for xadd)")
+	fs.StringVar(&opts.keyPrefix, "key-prefix", "bench:", "prefix of the benchmark keys")
+	fs.StringVar(&opts.distribution, "distribution", "uniform", "key distribution: uniform or zipfian")
+	fs.Float64Var(&opts.skew, "zipf-skew", 1.1, "skew of the zipfian distribution, greater than 1")
+	fs.IntVar(&opts.dataSize, "data-size", 32, "size in bytes of written values")
+	fs.Int64Var(&opts.seed, "seed", 0, "seed of the key choices (0 for a random seed)")
+	fs.BoolVar(&opts.csv, "csv", false, "print results as CSV")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case opts.clients < 1:
+		return nil, errors.New("--clients must be at least 1")
+	case opts.pipeline < 1:
+		return nil, errors.New("--pipeline must be at least 1")
+	case opts.keyspace < 1:
+		return nil, errors.New("--keyspace must be at least 1")
+	case opts.dataSize < 0:
+		return nil, errors.New("--data-size must not be negative")
+	case opts.duration < 0:
+		return nil, errors.New("--duration must not be negative")
+	case opts.duration == 0 && opts.requests < 1:
+		return nil, errors.New("--requests must be at least 1")
+	}
+	if _, err := newKeyChooser(opts.distribution, opts.keyspace, opts.skew, rand.New(rand.NewSource(1))); err != nil {
+		return nil, err
+	}
+	for _, name := range strings.Split(*tests, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		w, found := findWorkload(name)
+		if !found {
+			return nil, fmt.Errorf("unknown test %q", name)
+		}
+		opts.tests = append(opts.tests, w)
+	}
+	if len(opts.tests) == 0 {
+		return nil, errors.New("--tests selects no test")
+	}
+	if opts.seed == 0 {
+		opts.seed = time.Now().UnixNano()
+	}
+	return opts, nil
+}
+
+func main() {
+	opts, err := parseFlags(os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if opts.csv {
+		fmt.Println(csvHeader)
+	}
+	for _, w := range opts.tests {
+		result, err := runTest(opts, w)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", w.name, err)
+			os.Exit(1)
+		}
+		if opts.csv {
+			result.csv(os.Stdout)
+		} else {
+			result.report(os.Stdout, opts)
+		}
+	}
+}
+
+// bench is the state shared by the connections of a test
+type bench struct {
+	opts      *options
+	workload  workload
+	value     string
+	remaining atomic.Int64 // Requests left to send, unused with --duration
+	deadline  time.Time    // End of a --duration test
+}
+
+// claim reserves up to n requests, returning 0 once the test is over
+func (b *bench) claim(n int) int {
+	if !b.deadline.IsZero() {
+		if time.Now().After(b.deadline) {
+			return 0
+		}
+		return n
+	}
+	left := b.remaining.Add(int64(-n))
+	if left >= 0 {
+		return n
+	}
+	return max(n+int(left), 0)
+}
+
+// runTest runs one workload from all connections and gathers their results
+func runTest(opts *options, w workload) (*result, error) {
+	b := &bench{opts: opts, workload: w, value: strings.Repeat("x", opts.dataSize)}
+	b.remaining.Store(int64(opts.requests))
+
+	worker := b.respWorker
+	if w.path != nil {
+		worker = b.httpWorker
+	}
+
+	// Connections are opened before the clock starts
+	ready := make(chan struct{})
+	results := make([]*result, opts.clients)
+	errs := make([]error, opts.clients)
+	var connected, wg sync.WaitGroup
+	for i := 0; i < opts.clients; i++ {
+		connected.Add(1)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			chooser, _ := newKeyChooser(opts.distribution, opts.keyspace, opts.skew, rand.New(rand.NewSource(opts.seed+int64(i))))
+			results[i], errs[i] = worker(chooser, &connected, ready)
+		}(i)
+	}
+	connected.Wait()
+	start := time.Now()
+	if opts.duration > 0 {
+		b.deadline = start.Add(opts.duration)
+	}
+	close(ready)
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	total := &result{name: strings.ToUpper(w.name), pipeline: opts.pipeline}
+	if w.path != nil {
+		total.pipeline = 1
+	}
+	for i := range results {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		total.merge(results[i])
+	}
+	total.finish(elapsed)
+	return total, nil
+}
+
+func (b *bench) key(chooser keyChooser) string {
+	return b.opts.keyPrefix + strconv.Itoa(chooser())
+}
+
+// respWorker sends batches of pipelined commands on one connection. Every
+// request of a batch is recorded with the latency of the whole batch.
+func (b *bench) respWorker(chooser keyChooser, connected *sync.WaitGroup, ready <-chan struct{}) (*result, error) {
+	conn, err := net.DialTimeout("tcp", b.opts.addr, 5*time.Second)
+	if err == nil && b.opts.pass != "" {
+		err = authenticate(conn, b.opts.pass)
+	}
+	connected.Done()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	<-ready
+
+	reader := proto.NewRESPReader(conn)
+	r := &result{}
+	var buf []byte
+	for {
+		n := b.claim(b.opts.pipeline)
+		if n == 0 {
+			return r, nil
+		}
+
+		buf = buf[:0]
+		for i := 0; i < n; i++ {
+			buf, _ = proto.AppendValue(buf, command(b.workload.command(b.key(chooser), b.value)))
+		}
+		start := time.Now()
+		if _, err := conn.Write(buf); err != nil {
+			return nil, err
+		}
+		for i := 0; i < n; i++ {
+			reply, err := reader.Read()
+			if err != nil {
+				return nil, err
+			}
+			if reply.Type == proto.Error {
+				r.errors++
+			}
+		}
+		latency := time.Since(start)
+		for i := 0; i < n; i++ {
+			r.latencies = append(r.latencies, latency)
+		}
+		r.requests += n
+	}
+}
+
+func command(args []string) proto.RESPValue {
+	value := proto.RESPValue{Type: proto.Array, Array: make([]proto.RESPValue, len(args))}
+	for i, arg := range args {
+		value.Array[i] = proto.RESPValue{Type: proto.BulkString, String: arg}
+	}
+	return value
+}
+
+func authenticate(conn net.Conn, pass string) error {
+	encoded, _ := proto.Encode(command([]string{"AUTH", pass}))
+	if _, err := conn.Write(encoded); err != nil {
+		return err
+	}
+	reply, err := proto.NewRESPReader(conn).Read()
+	if err != nil {
+		return err
+	}
+	if reply.Type == proto.Error {
+		return errors.New(reply.String)
+	}
+	return nil
+}
+
+// httpWorker sends requests one at a time over a keep-alive connection;
+// HTTP/1.1 has no pipelining to speak of, so --pipeline does not apply
+func (b *bench) httpWorker(chooser keyChooser, connected *sync.WaitGroup, ready <-chan struct{}) (*result, error) {
+	client := &http.Client{
+		Transport: &http.Transport{MaxIdleConnsPerHost: 1, DisableCompression: true},
+		Timeout:   10 * time.Second,
+	}
+	defer client.CloseIdleConnections()
+	body, _ := json.Marshal(map[string]map[string]string{"fields": {"value": b.value}})
+
+	connected.Done()
+	<-ready
+
+	r := &result{}
+	for b.claim(1) == 1 {
+		url := "http://" + b.opts.httpAddr + b.workload.path(b.key(chooser))
+		request, err := http.NewRequest("POST", url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Content-Type", "application/json")
+		if b.opts.pass != "" {
+			request.Header.Set("Authorization", "Bearer "+b.opts.pass)
+		}
+
+		start := time.Now()
+		response, err := client.Do(request)
+		if err != nil {
+			return nil, err
+		}
+		io.Copy(io.Discard, response.Body)
+		response.Body.Close()
+		r.latencies = append(r.latencies, time.Since(start))
+		if response.StatusCode >= 300 {
+			r.errors++
+		}
+		r.requests++
+	}
+	return r, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"time"
+)
+
+// percentiles are the latency percentiles reported for every test
+var percentiles = []float64{50, 90, 95, 99, 99.9}
+
+// result is the outcome of one test
+type result struct {
+	name      string
+	pipeline  int // Requests in flight per connection
+	requests  int
+	errors    int
+	elapsed   time.Duration
+	latencies []time.Duration // Sorted once the test is done
+}
+
+// merge adds the requests recorded by one connection
+func (r *result) merge(other *result) {
+	r.requests += other.requests
+	r.errors += other.errors
+	r.latencies = append(r.latencies, other.latencies...)
+}
+
+func (r *result) throughput() float64 {
+	if r.elapsed <= 0 {
+		return 0
+	}
+	return float64(r.requests) / r.elapsed.Seconds()
+}
+
+// percentile returns the latency below which p percent of the requests
+// completed, by the nearest-rank method
+func (r *result) percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(r.latencies))))
+	return r.latencies[min(max(rank, 1), len(r.latencies))-1]
+}
+
+func (r *result) finish(elapsed time.Duration) {
+	r.elapsed = elapsed
+	slices.Sort(r.latencies)
+}
+
+func milliseconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", float64(d)/float64(time.Millisecond))
+}
+
+// report writes a readable summary of the test
+func (r *result) report(w io.Writer, opts *options) {
+	fmt.Fprintf(w, "====== %s ======\n", r.name)
+	fmt.Fprintf(w, "  %d requests completed in %.2f seconds\n", r.requests, r.elapsed.Seconds())
+	fmt.Fprintf(w, "  %d parallel clients, pipeline %d, %d byte values, %s keys over %d\n",
+		opts.clients, r.pipeline, opts.dataSize, opts.distribution, opts.keyspace)
+	if r.errors > 0 {
+		fmt.Fprintf(w, "  %d errors\n", r.errors)
+	}
+	fmt.Fprintf(w, "  throughput: %.2f requests per second\n", r.throughput())
+	fmt.Fprintf(w, "  latency (msec):")
+	if len(r.latencies) > 0 {
+		fmt.Fprintf(w, " min %s", milliseconds(r.latencies[0]))
+	}
+	for _, p := range percentiles {
+		fmt.Fprintf(w, " p%g %s", p, milliseconds(r.percentile(p)))
+	}
+	if len(r.latencies) > 0 {
+		fmt.Fprintf(w, " max %s", milliseconds(r.latencies[len(r.latencies)-1]))
+	}
+	fmt.Fprintf(w, "\n\n")
+}
+
+// csvHeader is the first line of --csv output
+const csvHeader = "test,requests,errors,rps,p50_ms,p90_ms,p95_ms,p99_ms,p99.9_ms,max_ms"
+
+// csv writes the test as one line of --csv output
+func (r *result) csv(w io.Writer) {
+	fmt.Fprintf(w, "%s,%d,%d,%.2f", r.name, r.requests, r.errors, r.throughput())
+	for _, p := range percentiles {
+		fmt.Fprintf(w, ",%s", milliseconds(r.percentile(p)))
+	}
+	var slowest time.Duration
+	if len(r.latencies) > 0 {
+		slowest = r.latencies[len(r.latencies)-1]
+	}
+	fmt.Fprintf(w, ",%s\n", milliseconds(slowest))
+}
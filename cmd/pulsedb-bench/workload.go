@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// workload is a kind of request the benchmark sends
+type workload struct {
+	name string
+	// command builds the RESP command for a key
+	command func(key, value string) []string
+	// path builds the HTTP API path a value is posted to for a key, for
+	// workloads the RESP protocol has no command for
+	path func(key string) string
+}
+
+// workloads are the tests --tests selects from
+var workloads = []workload{
+	{name: "set", command: func(key, value string) []string {
+		return []string{"SET", key, value}
+	}},
+	{name: "get", command: func(key, value string) []string {
+		return []string{"GET", key}
+	}},
+	// GETAT reads the version current a second ago, so it walks the history
+	// of keys the SET test rewrote
+	{name: "getat", command: func(key, value string) []string {
+		return []string{"GETAT", key, strconv.FormatInt(time.Now().Add(-time.Second).UnixMilli(), 10)}
+	}},
+	{name: "xadd", path: func(key string) string {
+		return "/v1/streams/" + key + "/entries"
+	}},
+}
+
+func findWorkload(name string) (workload, bool) {
+	for _, w := range workloads {
+		if w.name == name {
+			return w, true
+		}
+	}
+	return workload{}, false
+}
+
+// keyChooser picks the key index of each request within the keyspace
+type keyChooser func() int
+
+// newKeyChooser returns a chooser drawing from distribution with r:
+// "uniform" spreads requests evenly, "zipfian" concentrates them on a few
+// hot keys, more so as skew grows
+func newKeyChooser(distribution string, keyspace int, skew float64, r *rand.Rand) (keyChooser, error) {
+	switch distribution {
+	case "uniform":
+		return func() int { return r.Intn(keyspace) }, nil
+	case "zipfian":
+		if skew <= 1 {
+			return nil, fmt.Errorf("zipfian skew must be greater than 1, got %g", skew)
+		}
+		if keyspace < 2 {
+			return func() int { return 0 }, nil
+		}
+		zipf := rand.NewZipf(r, skew, 1, uint64(keyspace-1))
+		return func() int { return int(zipf.Uint64()) }, nil
+	default:
+		return nil, fmt.Errorf("unknown key distribution %q, want uniform or zipfian", distribution)
+	}
+}
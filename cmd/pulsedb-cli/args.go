@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+var errUnbalancedQuotes = errors.New("invalid argument(s): unbalanced quotes")
+
+// splitArgs splits a command line into arguments the way redis-cli does:
+// arguments are separated by whitespace, double quotes allow the escapes
+// \n \r \t \b \a \\ \" and \xHH, and single quotes only allow \'
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	i := 0
+	for {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i == len(line) {
+			return args, nil
+		}
+
+		var arg strings.Builder
+		inDouble, inSingle := false, false
+	scan:
+		for ; i < len(line); i++ {
+			c := line[i]
+			switch {
+			case inDouble:
+				switch {
+				case c == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHex(line[i+2]) && isHex(line[i+3]):
+					arg.WriteByte(unhex(line[i+2])<<4 | unhex(line[i+3]))
+					i += 3
+				case c == '\\' && i+1 < len(line):
+					i++
+					switch line[i] {
+					case 'n':
+						arg.WriteByte('\n')
+					case 'r':
+						arg.WriteByte('\r')
+					case 't':
+						arg.WriteByte('\t')
+					case 'b':
+						arg.WriteByte('\b')
+					case 'a':
+						arg.WriteByte('\a')
+					default:
+						arg.WriteByte(line[i])
+					}
+				case c == '"':
+					// The closing quote must end the argument
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, errUnbalancedQuotes
+					}
+					inDouble = false
+				default:
+					arg.WriteByte(c)
+				}
+			case inSingle:
+				switch {
+				case c == '\\' && i+1 < len(line) && line[i+1] == '\'':
+					arg.WriteByte('\'')
+					i++
+				case c == '\'':
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, errUnbalancedQuotes
+					}
+					inSingle = false
+				default:
+					arg.WriteByte(c)
+				}
+			case isSpace(c):
+				break scan
+			case c == '"':
+				inDouble = true
+			case c == '\'':
+				inSingle = true
+			default:
+				arg.WriteByte(c)
+			}
+		}
+		if inDouble || inSingle {
+			return nil, errUnbalancedQuotes
+		}
+		args = append(args, arg.String())
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c <= '9':
+		return c - '0'
+	case c <= 'F':
+		return c - 'A' + 10
+	default:
+		return c - 'a' + 10
+	}
+}
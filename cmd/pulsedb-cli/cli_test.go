@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/server"
+	"pulsedb/internal/store"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"", nil},
+		{"  GET   user:1 ", []string{"GET", "user:1"}},
+		{`SET k "hello world"`, []string{"SET", "k", "hello world"}},
+		{`SET k "a\"b\n\x41"`, []string{"SET", "k", "a\"b\nA"}},
+		{`SET k 'it\'s'`, []string{"SET", "k", "it's"}},
+		{`SET k ""`, []string{"SET", "k", ""}},
+	}
+	for _, test := range tests {
+		got, err := splitArgs(test.line)
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitArgs(%q) = %q, %v, want %q", test.line, got, err, test.want)
+		}
+	}
+
+	for _, line := range []string{`GET "user`, `GET 'user`, `GET "a"b`} {
+		if _, err := splitArgs(line); err == nil {
+			t.Errorf("Expected splitArgs(%q) to fail", line)
+		}
+	}
+}
+
+func bulk(s string) proto.RESPValue {
+	return proto.RESPValue{Type: proto.BulkString, String: s}
+}
+
+func integer(n int64) proto.RESPValue {
+	return proto.RESPValue{Type: proto.Integer, Int: n}
+}
+
+func TestFormatReply(t *testing.T) {
+	tests := []struct {
+		reply proto.RESPValue
+		want  string
+	}{
+		{proto.RESPValue{Type: proto.SimpleString, String: "OK"}, "OK"},
+		{proto.RESPValue{Type: proto.Error, String: "ERR nope"}, "(error) ERR nope"},
+		{integer(42), "(integer) 42"},
+		{bulk("a \"b\"\n"), `"a \"b\"\n"`},
+		{proto.RESPValue{Type: proto.BulkString, Null: true}, "(nil)"},
+		{proto.RESPValue{Type: proto.Array}, "(empty array)"},
+		{
+			proto.RESPValue{Type: proto.Array, Array: []proto.RESPValue{
+				bulk("a"),
+				{Type: proto.Array, Array: []proto.RESPValue{bulk("b"), integer(1)}},
+			}},
+			"1) \"a\"\n2) 1) \"b\"\n   2) (integer) 1",
+		},
+		{
+			proto.RESPValue{Type: proto.Map, Array: []proto.RESPValue{bulk("server"), bulk("pulsedb")}},
+			`1# "server" => "pulsedb"`,
+		},
+	}
+	for _, test := range tests {
+		if got := formatReply("GET", test.reply); got != test.want {
+			t.Errorf("formatReply(%+v) = %q, want %q", test.reply, got, test.want)
+		}
+	}
+}
+
+func TestFormatHistory(t *testing.T) {
+	location = time.UTC
+	defer func() { location = time.Local }()
+
+	history := proto.RESPValue{Type: proto.Array, Array: []proto.RESPValue{
+		{Type: proto.Array, Array: []proto.RESPValue{
+			integer(1700000000500), bulk("bob"), integer(2),
+		}, Attributes: []proto.RESPValue{
+			bulk("ttl"), integer(-1), bulk("hlc"), integer(7),
+		}},
+		{Type: proto.Array, Array: []proto.RESPValue{
+			integer(1700000000000), {Type: proto.BulkString, Null: true}, integer(1), integer(1500),
+		}},
+	}}
+	want := "1) 1700000000500 (2023-11-14 22:13:20.500) \"bob\" [seq 2, hlc 7]\n" +
+		"2) 1700000000000 (2023-11-14 22:13:20.000) (deleted) [seq 1, ttl 1500ms]"
+	if got := formatReply("hist", history); got != want {
+		t.Errorf("Unexpected history:\n%s\nwant:\n%s", got, want)
+	}
+
+	page := proto.RESPValue{Type: proto.Array, Array: []proto.RESPValue{bulk("0"), history}}
+	if got := formatReply("HISTSCAN", page); !strings.HasPrefix(got, "1) \"0\"\n2) 1) 1700000000500") ||
+		!strings.Contains(got, "\n   2) 1700000000000") {
+		t.Errorf("Unexpected HISTSCAN page:\n%s", got)
+	}
+
+	if got := formatReply("HIST", proto.RESPValue{Type: proto.Array}); got != "(empty history)" {
+		t.Errorf("Expected an empty history, got %q", got)
+	}
+}
+
+func TestFormatRaw(t *testing.T) {
+	reply := proto.RESPValue{Type: proto.Array, Array: []proto.RESPValue{bulk("a"), integer(2), {Type: proto.Null}}}
+	if got := formatRaw(reply); got != "a\n2\n" {
+		t.Errorf("formatRaw = %q", got)
+	}
+}
+
+// edit feeds keys to a fresh line editor with the given history
+func edit(keys string, history ...string) (string, error) {
+	e := &editor{in: bufio.NewReader(strings.NewReader(keys)), out: new(strings.Builder), history: history}
+	return e.edit("> ")
+}
+
+func TestEditor(t *testing.T) {
+	tests := []struct {
+		keys    string
+		history []string
+		want    string
+	}{
+		{"GET k\r", nil, "GET k"},
+		{"GET kk\x7f\r", nil, "GET k"},
+		{"ET k\x01G\r", nil, "GET k"},            // Ctrl-A
+		{"GET k\x1b[D\x1b[DX\r", nil, "GETX k"},  // Left arrow
+		{"SET a b\x17\x17GET\r", nil, "SET GET"}, // Ctrl-W
+		{"GET k\x01\x0b\r", nil, ""},             // Ctrl-K
+		{"\x1b[A\r", []string{"GET a", "GET b"}, "GET b"},
+		{"\x1b[A\x1b[A\r", []string{"GET a", "GET b"}, "GET a"},
+		{"draft\x10\x0e\r", []string{"GET a"}, "draft"}, // Ctrl-P then Ctrl-N restores the draft
+		{"ab\x01\x1b[3~\r", nil, "b"},                   // Delete
+		{"ab\x1b[H\x1b[FX\r", nil, "abX"},               // Home, End
+		{"héllo\x7f\r", nil, "héll"},
+	}
+	for _, test := range tests {
+		got, err := edit(test.keys, test.history...)
+		if err != nil || got != test.want {
+			t.Errorf("Keys %q gave %q, %v, want %q", test.keys, got, err, test.want)
+		}
+	}
+
+	if _, err := edit("GET\x03"); err != errInterrupted {
+		t.Errorf("Expected Ctrl-C to interrupt, got %v", err)
+	}
+	if _, err := edit("\x04"); err == nil {
+		t.Errorf("Expected Ctrl-D on an empty line to end the input")
+	}
+}
+
+func TestHistoryFile(t *testing.T) {
+	path := t.TempDir() + "/history"
+	e := &editor{}
+	if err := e.loadHistory(path); err != nil {
+		t.Fatalf("A missing history should load: %v", err)
+	}
+	for i := 0; i < maxHistory+5; i++ {
+		e.addHistory("GET " + strconv.Itoa(i))
+	}
+	e.addHistory("GET " + strconv.Itoa(maxHistory+4))
+	e.addHistory("  ")
+	if err := e.saveHistory(path); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	loaded := &editor{}
+	if err := loaded.loadHistory(path); err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if len(loaded.history) != maxHistory || loaded.history[0] != "GET 5" {
+		t.Errorf("Expected the last %d entries, got %d starting at %q", maxHistory, len(loaded.history), loaded.history[0])
+	}
+}
+
+func TestSensitive(t *testing.T) {
+	for _, args := range [][]string{{"auth", "secret"}, {"HELLO", "3", "auth", "default", "secret"}} {
+		if !sensitive(args) {
+			t.Errorf("Expected %q to be kept out of the history", args)
+		}
+	}
+	if sensitive([]string{"HELLO", "3"}) {
+		t.Errorf("Expected HELLO without credentials to be recorded")
+	}
+}
+
+func TestEval(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+	srv := server.NewServer(db, nil)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.Serve(ctx, listener)
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	opts, _, err := parseFlags([]string{"--host", host, "--port", port})
+	if err != nil {
+		t.Fatalf("Failed to parse flags: %v", err)
+	}
+	client, err := connect(opts)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+
+	var out strings.Builder
+	ok, err := eval(client, "SET user:1 \"alice smith\"\nGET user:1\n\nLPUSH", true, &out)
+	if err != nil || ok {
+		t.Errorf("Expected the unknown command to fail the script, got %v, %v", ok, err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || lines[0] != "OK" || lines[1] != `"alice smith"` || !strings.HasPrefix(lines[2], "(error) ") {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+
+	out.Reset()
+	if ok, err := run(client, []string{"GET", "user:1"}, false, &out); !ok || err != nil || out.String() != "alice smith\n" {
+		t.Errorf("Unexpected raw output %q, %v, %v", out.String(), ok, err)
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	for _, args := range [][]string{
+		{"--resp", "4"},
+		{"--cacert", "ca.pem"},
+		{"--tls", "--cert", "client.pem"},
+		{"--eval", "PING", "GET", "k"},
+	} {
+		if _, _, err := parseFlags(args); err == nil {
+			t.Errorf("Expected %q to be rejected", args)
+		}
+	}
+
+	opts, args, err := parseFlags([]string{"--tls", "--insecure", "GET", "k"})
+	if err != nil || !opts.tls || !reflect.DeepEqual(args, []string{"GET", "k"}) {
+		t.Errorf("Unexpected parse %+v %q %v", opts, args, err)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxHistory bounds the number of lines kept in the history
+const maxHistory = 1000
+
+// errInterrupted is returned by readLine when the line is abandoned with Ctrl-C
+var errInterrupted = errors.New("interrupted")
+
+// editor reads command lines. On a terminal it offers emacs-style line
+// editing and history navigation; otherwise it reads plain lines.
+type editor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	fd      int // Terminal of in, -1 if in is not a terminal
+	history []string
+}
+
+func newEditor(in *os.File, out io.Writer) *editor {
+	fd := int(in.Fd())
+	if !isTerminal(fd) {
+		fd = -1
+	}
+	return &editor{in: bufio.NewReader(in), out: out, fd: fd}
+}
+
+// readLine reads a line, showing prompt when editing on a terminal
+func (e *editor) readLine(prompt string) (string, error) {
+	if e.fd >= 0 {
+		if restore, err := makeRaw(e.fd); err == nil {
+			defer restore()
+			return e.edit(prompt)
+		}
+	}
+
+	line, err := e.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func ctrl(c rune) rune {
+	return c & 0x1f
+}
+
+// edit reads a line key by key from a terminal in raw mode
+func (e *editor) edit(prompt string) (string, error) {
+	var line []rune
+	pos := 0
+	index := len(e.history) // Entry shown, len(history) for the line being typed
+	draft := ""             // The line being typed while browsing the history
+
+	browse := func(to int) {
+		if to < 0 || to > len(e.history) {
+			return
+		}
+		if index == len(e.history) {
+			draft = string(line)
+		}
+		index = to
+		if index == len(e.history) {
+			line = []rune(draft)
+		} else {
+			line = []rune(e.history[index])
+		}
+		pos = len(line)
+	}
+
+	e.refresh(prompt, line, pos)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(line), nil
+		case ctrl('C'):
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupted
+		case ctrl('D'):
+			if len(line) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(line) {
+				line = append(line[:pos], line[pos+1:]...)
+			}
+		case 127, ctrl('H'):
+			if pos > 0 {
+				line = append(line[:pos-1], line[pos:]...)
+				pos--
+			}
+		case ctrl('A'):
+			pos = 0
+		case ctrl('E'):
+			pos = len(line)
+		case ctrl('B'):
+			pos = max(pos-1, 0)
+		case ctrl('F'):
+			pos = min(pos+1, len(line))
+		case ctrl('K'):
+			line = line[:pos]
+		case ctrl('U'):
+			line = line[pos:]
+			pos = 0
+		case ctrl('W'):
+			start := pos
+			for start > 0 && line[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && line[start-1] != ' ' {
+				start--
+			}
+			line = append(line[:start], line[pos:]...)
+			pos = start
+		case ctrl('L'):
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+		case ctrl('P'):
+			browse(index - 1)
+		case ctrl('N'):
+			browse(index + 1)
+		case 0x1b:
+			switch e.escape() {
+			case 'A':
+				browse(index - 1)
+			case 'B':
+				browse(index + 1)
+			case 'C':
+				pos = min(pos+1, len(line))
+			case 'D':
+				pos = max(pos-1, 0)
+			case 'H':
+				pos = 0
+			case 'F':
+				pos = len(line)
+			case '~': // Delete
+				if pos < len(line) {
+					line = append(line[:pos], line[pos+1:]...)
+				}
+			}
+		default:
+			if !unicode.IsPrint(r) {
+				continue
+			}
+			line = append(line[:pos], append([]rune{r}, line[pos:]...)...)
+			pos++
+		}
+		e.refresh(prompt, line, pos)
+	}
+}
+
+// escape reads the rest of an escape sequence and returns the key it
+// stands for: the final byte of the arrow, Home and End keys, '~' for
+// Delete, or 0 for anything else
+func (e *editor) escape() byte {
+	prefix, err := e.in.ReadByte()
+	if err != nil || prefix != '[' && prefix != 'O' {
+		return 0
+	}
+	key, err := e.in.ReadByte()
+	if err != nil {
+		return 0
+	}
+	if key < '0' || key > '9' {
+		return key
+	}
+
+	// Numbered keys end with '~': 1 and 7 are Home, 3 Delete, 4 and 8 End
+	number := key
+	for key != '~' {
+		if key, err = e.in.ReadByte(); err != nil {
+			return 0
+		}
+	}
+	switch number {
+	case '1', '7':
+		return 'H'
+	case '4', '8':
+		return 'F'
+	case '3':
+		return '~'
+	}
+	return 0
+}
+
+// refresh redraws the line and moves the cursor to pos
+func (e *editor) refresh(prompt string, line []rune, pos int) {
+	column := utf8.RuneCountInString(prompt) + pos
+	fmt.Fprintf(e.out, "\r%s%s\x1b[0K\r", prompt, string(line))
+	if column > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dC", column)
+	}
+}
+
+// addHistory records line, skipping blanks and repeats of the last entry
+func (e *editor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if n := len(e.history); n > 0 && e.history[n-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+}
+
+// loadHistory reads the history saved at path; a missing file is no error
+func (e *editor) loadHistory(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		e.addHistory(line)
+	}
+	return nil
+}
+
+// saveHistory writes the history to path, readable by the user only since
+// commands may carry secrets
+func (e *editor) saveHistory(path string) error {
+	var b strings.Builder
+	for _, line := range e.history {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return os.WriteFile(path, []byte(b.String()), 0600)
+}
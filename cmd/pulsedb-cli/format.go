@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"pulsedb/internal/proto"
+)
+
+// timeLayout renders version timestamps in history replies
+const timeLayout = "2006-01-02 15:04:05.000"
+
+// location is the time zone of rendered timestamps
+var location = time.Local
+
+// formatReply renders the reply to command for a terminal, as redis-cli
+// does: types are spelled out, strings quoted and aggregates numbered.
+// Histories are listed one version per line with their time.
+func formatReply(command string, reply proto.RESPValue) string {
+	var b strings.Builder
+	switch strings.ToUpper(command) {
+	case "HIST", "HISTRANGE":
+		if isHistory(reply) {
+			writeHistory(&b, reply, "")
+			return b.String()
+		}
+	case "HISTSCAN":
+		// The next cursor, then a page of versions
+		if reply.Type == proto.Array && len(reply.Array) == 2 && isHistory(reply.Array[1]) {
+			b.WriteString("1) ")
+			writeValue(&b, reply.Array[0], "   ")
+			b.WriteString("\n2) ")
+			writeHistory(&b, reply.Array[1], "   ")
+			return b.String()
+		}
+	}
+	writeValue(&b, reply, "")
+	return b.String()
+}
+
+func writeValue(b *strings.Builder, v proto.RESPValue, indent string) {
+	switch v.Type {
+	case proto.SimpleString:
+		b.WriteString(v.String)
+	case proto.Error:
+		b.WriteString("(error) " + v.String)
+	case proto.Integer:
+		b.WriteString("(integer) " + strconv.FormatInt(v.Int, 10))
+	case proto.Double:
+		b.WriteString("(double) " + strconv.FormatFloat(v.Float, 'g', -1, 64))
+	case proto.Boolean:
+		b.WriteString("(" + strconv.FormatBool(v.Bool) + ")")
+	case proto.BigNumber:
+		b.WriteString("(big number) " + v.String)
+	case proto.Null:
+		b.WriteString("(nil)")
+	case proto.BulkString:
+		if v.Null {
+			b.WriteString("(nil)")
+		} else {
+			b.WriteString(quote(v.String))
+		}
+	case proto.Map:
+		if len(v.Array) == 0 {
+			b.WriteString("(empty hash)")
+			return
+		}
+		pairs := len(v.Array) / 2
+		width := len(strconv.Itoa(pairs)) + 1
+		for i := 0; i < pairs; i++ {
+			if i > 0 {
+				b.WriteString("\n" + indent)
+			}
+			fmt.Fprintf(b, "%*s ", width, strconv.Itoa(i+1)+"#")
+			nested := indent + strings.Repeat(" ", width+1)
+			writeValue(b, v.Array[i*2], nested)
+			b.WriteString(" => ")
+			writeValue(b, v.Array[i*2+1], nested)
+		}
+	default: // Array, Set and Push
+		if v.Null {
+			b.WriteString("(nil)")
+			return
+		}
+		if len(v.Array) == 0 {
+			if v.Type == proto.Set {
+				b.WriteString("(empty set)")
+			} else {
+				b.WriteString("(empty array)")
+			}
+			return
+		}
+		mark := ")"
+		if v.Type == proto.Set {
+			mark = "~"
+		}
+		width := len(strconv.Itoa(len(v.Array))) + 1
+		for i, element := range v.Array {
+			if i > 0 {
+				b.WriteString("\n" + indent)
+			}
+			fmt.Fprintf(b, "%*s ", width, strconv.Itoa(i+1)+mark)
+			writeValue(b, element, indent+strings.Repeat(" ", width+1))
+		}
+	}
+}
+
+// isHistory reports whether v lists versions as [timestamp, value, seq]
+// entries, as HIST, HISTRANGE and HISTSCAN reply
+func isHistory(v proto.RESPValue) bool {
+	if v.Type != proto.Array {
+		return false
+	}
+	for _, entry := range v.Array {
+		if entry.Type != proto.Array || len(entry.Array) < 3 ||
+			entry.Array[0].Type != proto.Integer || entry.Array[2].Type != proto.Integer {
+			return false
+		}
+	}
+	return true
+}
+
+// writeHistory lists one version per line: its timestamp, local time and
+// value, followed by its sequence number, the TTL WITHTTL adds and the HLC
+// the server attaches on RESP3
+func writeHistory(b *strings.Builder, v proto.RESPValue, indent string) {
+	if len(v.Array) == 0 {
+		b.WriteString("(empty history)")
+		return
+	}
+
+	width := len(strconv.Itoa(len(v.Array))) + 1
+	for i, entry := range v.Array {
+		if i > 0 {
+			b.WriteString("\n" + indent)
+		}
+		timestamp, value := entry.Array[0].Int, entry.Array[1]
+		fmt.Fprintf(b, "%*s %d (%s) ", width, strconv.Itoa(i+1)+")", timestamp,
+			time.UnixMilli(timestamp).In(location).Format(timeLayout))
+		if value.Null {
+			b.WriteString("(deleted)")
+		} else {
+			b.WriteString(quote(value.String))
+		}
+
+		details := []string{"seq " + strconv.FormatInt(entry.Array[2].Int, 10)}
+		ttl, hasTTL := attribute(entry, "ttl")
+		if len(entry.Array) > 3 {
+			ttl, hasTTL = entry.Array[3], true
+		}
+		if hasTTL && ttl.Int >= 0 {
+			details = append(details, "ttl "+strconv.FormatInt(ttl.Int, 10)+"ms")
+		}
+		if hlc, ok := attribute(entry, "hlc"); ok {
+			details = append(details, "hlc "+strconv.FormatInt(hlc.Int, 10))
+		}
+		b.WriteString(" [" + strings.Join(details, ", ") + "]")
+	}
+}
+
+// attribute returns the attribute of v named name
+func attribute(v proto.RESPValue, name string) (proto.RESPValue, bool) {
+	for i := 0; i+1 < len(v.Attributes); i += 2 {
+		if v.Attributes[i].String == name {
+			return v.Attributes[i+1], true
+		}
+	}
+	return proto.RESPValue{}, false
+}
+
+// formatRaw renders a reply without decoration, one string per line, as
+// redis-cli does when its output is not a terminal
+func formatRaw(reply proto.RESPValue) string {
+	var b strings.Builder
+	writeRaw(&b, reply)
+	return b.String()
+}
+
+func writeRaw(b *strings.Builder, v proto.RESPValue) {
+	switch v.Type {
+	case proto.SimpleString, proto.Error, proto.BulkString, proto.BigNumber:
+		b.WriteString(v.String)
+	case proto.Integer:
+		b.WriteString(strconv.FormatInt(v.Int, 10))
+	case proto.Double:
+		b.WriteString(strconv.FormatFloat(v.Float, 'g', -1, 64))
+	case proto.Boolean:
+		if v.Bool {
+			b.WriteString("1")
+		} else {
+			b.WriteString("0")
+		}
+	case proto.Null:
+	default:
+		for i, element := range v.Array {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			writeRaw(b, element)
+		}
+	}
+}
+
+// quote renders s in double quotes, escaping what would not print
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\a':
+			b.WriteString(`\a`)
+		case '\b':
+			b.WriteString(`\b`)
+		default:
+			if c < 0x20 || c >= 0x7f {
+				fmt.Fprintf(&b, `\x%02x`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,348 @@
+// Command pulsedb-cli is an interactive shell for PulseDB, in the manner of
+// redis-cli. Without a command it reads commands from a terminal with line
+// editing and history, or one per line from standard input; with one, or
+// with --eval, it runs them and exits.
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"pulsedb/internal/proto"
+)
+
+// options are the command line settings
+type options struct {
+	host    string
+	port    int
+	user    string
+	pass    string
+	resp    int
+	timeout time.Duration
+	raw     bool
+	eval    string
+
+	tls      bool
+	caCert   string
+	cert     string
+	key      string
+	sni      string
+	insecure bool
+}
+
+func parseFlags(args []string) (*options, []string, error) {
+	opts := &options{}
+	fs := flag.NewFlagSet("pulsedb-cli", flag.ContinueOnError)
+	fs.StringVar(&opts.host, "host", "127.0.0.1", "server hostname")
+	fs.IntVar(&opts.port, "port", 6380, "server port")
+	fs.StringVar(&opts.user, "user", "default", "username sent with --pass")
+	fs.StringVar(&opts.pass, "pass", os.Getenv("PULSEDB_CLI_AUTH"), "API key to authenticate with (default $PULSEDB_CLI_AUTH)")
+	fs.IntVar(&opts.resp, "resp", proto.RESP3, "protocol version to negotiate with HELLO (2 or 3)")
+	fs.DurationVar(&opts.timeout, "timeout", 5*time.Second, "connection timeout")
+	fs.BoolVar(&opts.raw, "raw", false, "print replies undecorated even on a terminal")
+	fs.StringVar(&opts.eval, "eval", "", "commands to run, one per line, instead of starting the shell")
+	fs.BoolVar(&opts.tls, "tls", false, "connect over TLS")
+	fs.StringVar(&opts.caCert, "cacert", "", "PEM file of the CA to verify the server with (default the system roots)")
+	fs.StringVar(&opts.cert, "cert", "", "PEM client certificate for mutual TLS")
+	fs.StringVar(&opts.key, "key", "", "PEM private key of --cert")
+	fs.StringVar(&opts.sni, "sni", "", "server name to verify and send in TLS (default --host)")
+	fs.BoolVar(&opts.insecure, "insecure", false, "skip verification of the server certificate")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: pulsedb-cli [options] [command [arg ...]]\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if opts.resp != proto.RESP2 && opts.resp != proto.RESP3 {
+		return nil, nil, fmt.Errorf("--resp must be 2 or 3, got %d", opts.resp)
+	}
+	if (opts.cert == "") != (opts.key == "") {
+		return nil, nil, errors.New("--cert and --key must be given together")
+	}
+	if (opts.caCert != "" || opts.cert != "" || opts.sni != "" || opts.insecure) && !opts.tls {
+		return nil, nil, errors.New("TLS options require --tls")
+	}
+	if opts.eval != "" && fs.NArg() > 0 {
+		return nil, nil, errors.New("--eval cannot be combined with a command")
+	}
+	return opts, fs.Args(), nil
+}
+
+func main() {
+	opts, args, err := parseFlags(os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	client, err := connect(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not connect to PulseDB at %s: %v\n", opts.addr(), err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	// Replies are decorated for people and left raw for pipes, like redis-cli
+	pretty := !opts.raw && isTerminal(int(os.Stdout.Fd()))
+
+	var ok bool
+	switch {
+	case len(args) > 0:
+		ok, err = run(client, args, pretty, os.Stdout)
+	case opts.eval != "":
+		ok, err = eval(client, opts.eval, pretty, os.Stdout)
+	default:
+		shell(opts, client, pretty)
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+func (o *options) addr() string {
+	return net.JoinHostPort(o.host, strconv.Itoa(o.port))
+}
+
+// connect dials the server and negotiates the protocol, authenticating
+// if a key is set
+func connect(opts *options) (*proto.Client, error) {
+	conn, err := net.DialTimeout("tcp", opts.addr(), opts.timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.tls {
+		config, err := tlsConfig(opts)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		secure := tls.Client(conn, config)
+		secure.SetDeadline(time.Now().Add(opts.timeout))
+		if err := secure.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		secure.SetDeadline(time.Time{})
+		conn = secure
+	}
+
+	client := proto.NewClient(conn)
+	hello := []string{strconv.Itoa(opts.resp)}
+	if opts.pass != "" {
+		hello = append(hello, "AUTH", opts.user, opts.pass)
+	}
+	reply, err := client.Do("HELLO", hello...)
+	if err == nil && reply.Type == proto.Error {
+		err = errors.New(reply.String)
+	}
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+func tlsConfig(opts *options) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         opts.host,
+		InsecureSkipVerify: opts.insecure,
+	}
+	if opts.sni != "" {
+		config.ServerName = opts.sni
+	}
+	if opts.caCert != "" {
+		pem, err := os.ReadFile(opts.caCert)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", opts.caCert)
+		}
+	}
+	if opts.cert != "" {
+		cert, err := tls.LoadX509KeyPair(opts.cert, opts.key)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// run sends one command and prints its reply. It reports whether the reply
+// was not an error; the error reports a failed connection.
+func run(client *proto.Client, args []string, pretty bool, out io.Writer) (bool, error) {
+	reply, err := client.Do(args[0], args[1:]...)
+	if err != nil {
+		return false, err
+	}
+	printReply(out, args[0], reply, pretty)
+
+	// A subscribed connection only receives messages from then on
+	if strings.EqualFold(args[0], "SUBSCRIBE") && reply.Type != proto.Error {
+		if pretty {
+			fmt.Fprintln(out, "Reading messages... (press Ctrl-C to quit)")
+		}
+		for {
+			message, err := client.Receive()
+			if err != nil {
+				return false, err
+			}
+			printReply(out, args[0], message, pretty)
+		}
+	}
+	return reply.Type != proto.Error, nil
+}
+
+// eval runs script, one command per line, stopping at the first
+// connection failure. It reports whether every command succeeded.
+func eval(client *proto.Client, script string, pretty bool, out io.Writer) (bool, error) {
+	ok := true
+	for _, line := range strings.Split(script, "\n") {
+		args, err := splitArgs(line)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			ok = false
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		succeeded, err := run(client, args, pretty, out)
+		if err != nil {
+			return false, err
+		}
+		ok = ok && succeeded
+	}
+	return ok, nil
+}
+
+func printReply(out io.Writer, command string, reply proto.RESPValue, pretty bool) {
+	if pretty {
+		fmt.Fprintln(out, formatReply(command, reply))
+	} else {
+		fmt.Fprintln(out, formatRaw(reply))
+	}
+}
+
+// shell reads commands until EOF or quit, reconnecting after the
+// connection is lost
+func shell(opts *options, client *proto.Client, pretty bool) {
+	editor := newEditor(os.Stdin, os.Stdout)
+	// Commands piped in are not worth remembering
+	var history string
+	if editor.fd >= 0 {
+		history = historyPath()
+	}
+	if history != "" {
+		if err := editor.loadHistory(history); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not load the history: %v\n", err)
+		}
+	}
+	defer func() {
+		if client != nil {
+			client.Close()
+		}
+	}()
+
+	for {
+		prompt := opts.addr() + "> "
+		if client == nil {
+			prompt = "not connected> "
+		}
+		line, err := editor.readLine(prompt)
+		if err == errInterrupted {
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		args, err := splitArgs(line)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		// Saved right away: SUBSCRIBE only ends when the shell is killed
+		if history != "" && !sensitive(args) {
+			editor.addHistory(line)
+			if err := editor.saveHistory(history); err != nil {
+				fmt.Fprintf(os.Stderr, "Could not save the history: %v\n", err)
+				history = ""
+			}
+		}
+
+		switch strings.ToLower(args[0]) {
+		case "quit", "exit":
+			return
+		case "clear":
+			fmt.Print("\x1b[H\x1b[2J")
+			continue
+		}
+
+		if client == nil {
+			if client, err = connect(opts); err != nil {
+				fmt.Printf("Could not connect to PulseDB at %s: %v\n", opts.addr(), err)
+				continue
+			}
+		}
+		if _, err := run(client, args, pretty, os.Stdout); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			client.Close()
+			client = nil
+		}
+	}
+}
+
+// sensitive reports whether a command carries credentials, which are kept
+// out of the history
+func sensitive(args []string) bool {
+	switch strings.ToUpper(args[0]) {
+	case "AUTH":
+		return true
+	case "HELLO":
+		for _, arg := range args[1:] {
+			if strings.EqualFold(arg, "AUTH") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// historyPath is $PULSEDB_CLI_HISTFILE, or ~/.pulsedb_cli_history; empty
+// disables the history file
+func historyPath() string {
+	if path, set := os.LookupEnv("PULSEDB_CLI_HISTFILE"); set {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".pulsedb_cli_history")
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// isTerminal reports whether fd is a terminal. Line editing is only
+// implemented on Linux; elsewhere input is read a line at a time.
+func isTerminal(fd int) bool {
+	return false
+}
+
+// makeRaw is unsupported outside Linux
+func makeRaw(fd int) (func(), error) {
+	return nil, errors.New("raw terminal mode is only supported on Linux")
+}
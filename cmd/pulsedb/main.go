@@ -3,79 +3,373 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
-	"net"
+	"io"
+	"log/slog"
 	"os"
 	"os/signal"
+	"runtime"
 	"sync"
 	"syscall"
 	"time"
 
+	"pulsedb/internal/apikeys"
+	"pulsedb/internal/archive"
+	"pulsedb/internal/config"
+	"pulsedb/internal/grpc"
 	"pulsedb/internal/http"
+	"pulsedb/internal/info"
+	"pulsedb/internal/latency"
+	"pulsedb/internal/logging"
 	"pulsedb/internal/metrics"
+	"pulsedb/internal/proto"
+	"pulsedb/internal/proxy"
+	"pulsedb/internal/pubsub"
 	"pulsedb/internal/server"
+	"pulsedb/internal/slowlog"
 	"pulsedb/internal/store"
+	"pulsedb/internal/streams"
+	"pulsedb/internal/throttle"
+	"pulsedb/internal/wasm"
+	"pulsedb/internal/watchdog"
 )
 
-const (
-	DefaultTCPPort  = "6380"
-	DefaultHTTPPort = "8080"
-)
+// component is a long-running part of the process (typically a listener)
+// that can be toggled on or off through configuration
+type component struct {
+	name    string
+	addr    string
+	enabled bool
+	start   func(ctx context.Context) error
+}
 
 func main() {
-	log.Println("Starting PulseDB...")
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fatal("Invalid configuration", err)
+	}
+
+	logger, logFile, err := logging.New(cfg.Log)
+	if err != nil {
+		fatal("Failed to open the log", err)
+	}
+	defer logFile.Close()
+	slog.SetDefault(logger)
+
+	// Access logs go through the process logger, so they share its level,
+	// format and file
+	var accessLog *slog.Logger
+	if cfg.AccessLog {
+		accessLog = logger.With("log", "access")
+	}
+
+	if cfg.Proxy {
+		runProxy(cfg)
+		return
+	}
+
+	slog.Info("Starting PulseDB", "version", server.Version)
 
 	// Initialize store with MVCC support
 	db := store.NewStore()
+	if err := db.ReplaceDefaultTTLs(cfg.DefaultTTLs); err != nil {
+		fatal("Invalid default TTLs", err)
+	}
+	db.SetSlidingPatterns(cfg.SlidingTTLs)
+	db.SetRetention(cfg.Retention)
+	db.SetExpiryPolicy(cfg.Expiry)
+	db.SetReadOnly(cfg.ReadOnly)
+
+	// Expired keys are archived into streams shared by every listener
+	streamManager := streams.NewStreamManager()
+	var archiveFiles []io.Closer
+	for _, spec := range cfg.Archives {
+		sink, err := archive.Open(spec, streamManager)
+		if err != nil {
+			fatal("Failed to open archive", fmt.Errorf("%s: %w", spec.Pattern, err))
+		}
+		db.SetArchive(spec.Pattern, sink)
+		if file, ok := sink.(io.Closer); ok {
+			archiveFiles = append(archiveFiles, file)
+		}
+	}
 
 	// Initialize metrics
 	metricsRegistry := metrics.NewMetrics()
 
+	// WASM functions are loaded once and their jobs scheduled for every
+	// listener
+	var wasmRuntime *wasm.WASMRuntime
+	var scheduler *wasm.Scheduler
+	if cfg.WASMDir != "" {
+		wasmRuntime = wasm.NewWASMRuntimeWithLimits(context.Background(), wasm.Limits{
+			Timeout:        cfg.WASMTimeout,
+			MaxMemoryPages: uint32(min(cfg.WASMMaxMemory>>16, 65536)),
+		})
+		wasmRuntime.SetMetrics(metricsRegistry)
+		wasmRuntime.SetStore(db)
+		names, err := wasmRuntime.LoadDir(context.Background(), cfg.WASMDir)
+		if err != nil {
+			fatal("Failed to load WASM functions", err)
+		}
+		slog.Info("Loaded WASM functions", "dir", cfg.WASMDir, "functions", names)
+		scheduler = wasm.NewScheduler(wasmRuntime)
+	}
+
+	// Slow commands and latency spikes from every listener go to one log
+	slowLog := slowlog.New(cfg.SlowLogThreshold, cfg.SlowLogMaxLen)
+	latencyMonitor := latency.New(cfg.LatencyThreshold)
+
+	// INFO reports process-wide counters, whichever listener is asked
+	stats := info.New(server.Version)
+	stats.SetCapabilities(capabilities(cfg))
+
+	// Bandwidth quotas and client command rates are shared too, so neither
+	// a namespace nor a client can exceed its limits by spreading requests
+	// over listeners
+	limiter := throttle.New()
+	limiter.SetQuotas(cfg.Quotas)
+	rateLimiter := throttle.NewRateLimiter()
+	rateLimiter.SetRates(cfg.RateLimits)
+
+	// Subscribers on any listener receive every publish and config event
+	broker := pubsub.NewBroker()
+
+	// Connection readers are pooled across listeners
+	readers := proto.NewReaderPool()
+
+	// API keys authenticate and meter requests on every listener
+	var keys *apikeys.Registry
+	if cfg.APIKeys {
+		keys = apikeys.NewRegistry()
+	}
+
 	// Create TCP server
 	tcpServer := server.NewServer(db, metricsRegistry)
+	tcpServer.AllowCommands(cfg.TCPCommands)
+	tcpServer.SetLimits(cfg.Limits)
+	tcpServer.SetMaxClients(cfg.MaxClients)
+	tcpServer.SetIdleTimeout(cfg.IdleTimeout)
+	tcpServer.SetDrainTimeout(cfg.ShutdownTimeout)
+	tcpServer.SetShutdownNotice(cfg.ShutdownNotice)
+	tcpServer.SetClientMemoryLimit(cfg.ClientMemoryLimit)
+	tcpServer.SetOutputLimits(cfg.OutputLimits)
+	tcpServer.SetMaxResponseSize(cfg.MaxResponseSize)
+	tcpServer.SetReaderPool(readers)
+	tcpServer.SetSlowLog(slowLog)
+	tcpServer.SetLatencyMonitor(latencyMonitor)
+	tcpServer.SetStats(stats)
+	tcpServer.SetThrottle(limiter)
+	tcpServer.SetRateLimiter(rateLimiter)
+	tcpServer.SetRESP2Compat(cfg.RESP2Compat)
+	tcpServer.SetStreams(streamManager)
+	tcpServer.SetPubSub(broker)
+	tcpServer.SetAPIKeys(keys)
+	tcpServer.SetAccessLog(accessLog)
+	tcpServer.SetExportDir(cfg.ExportDir)
+	tcpServer.SetScheduler(scheduler)
+	tcpServer.SetScripting(wasmRuntime)
+	tcpServer.SetSocketOptions(server.SocketOptions{
+		NoDelay:       cfg.TCPNoDelay,
+		SendBuffer:    cfg.TCPSendBuffer,
+		ReceiveBuffer: cfg.TCPReceiveBuffer,
+		QuickAck:      cfg.TCPQuickAck,
+	})
+
+	// Create unix socket server; it has its own dispatcher so it can expose
+	// a different set of commands than the public TCP listener
+	unixServer := server.NewServer(db, metricsRegistry)
+	unixServer.AllowCommands(cfg.UnixCommands)
+	unixServer.SetLimits(cfg.Limits)
+	unixServer.SetMaxClients(cfg.MaxClients)
+	unixServer.SetIdleTimeout(cfg.IdleTimeout)
+	unixServer.SetDrainTimeout(cfg.ShutdownTimeout)
+	unixServer.SetShutdownNotice(cfg.ShutdownNotice)
+	unixServer.SetClientMemoryLimit(cfg.ClientMemoryLimit)
+	unixServer.SetOutputLimits(cfg.OutputLimits)
+	unixServer.SetMaxResponseSize(cfg.MaxResponseSize)
+	unixServer.SetReaderPool(readers)
+	unixServer.SetSlowLog(slowLog)
+	unixServer.SetLatencyMonitor(latencyMonitor)
+	unixServer.SetStats(stats)
+	unixServer.SetThrottle(limiter)
+	unixServer.SetRateLimiter(rateLimiter)
+	unixServer.SetRESP2Compat(cfg.RESP2Compat)
+	unixServer.SetStreams(streamManager)
+	unixServer.SetPubSub(broker)
+	unixServer.SetAPIKeys(keys)
+	unixServer.SetAccessLog(accessLog)
+	unixServer.SetExportDir(cfg.ExportDir)
+	unixServer.SetScheduler(scheduler)
+	unixServer.SetScripting(wasmRuntime)
 
 	// Create HTTP server
 	httpServer := http.NewHTTPServer(db, metricsRegistry)
+	httpServer.AllowCommands(cfg.HTTPCommands)
+	httpServer.SetSlowLog(slowLog)
+	httpServer.SetStats(stats)
+	httpServer.SetStreams(streamManager)
+	httpServer.SetAPIKeys(keys, cfg.AdminToken)
+	httpServer.SetAccessLog(accessLog)
+	httpServer.SetDrainTimeout(cfg.ShutdownTimeout)
+
+	// Create gRPC server
+	grpcServer := grpc.NewServer(db)
+	grpcServer.AllowCommands(cfg.GRPCCommands)
+	grpcServer.SetStreams(streamManager)
+	grpcServer.SetAPIKeys(keys)
+	grpcServer.SetAccessLog(accessLog)
+	grpcServer.SetDrainTimeout(cfg.ShutdownTimeout)
+
+	// Register listeners; new protocol surfaces are added here
+	components := []component{
+		{
+			name:    "TCP",
+			addr:    cfg.TCPAddr,
+			enabled: cfg.EnableTCP,
+			start: func(ctx context.Context) error {
+				return tcpServer.Start(ctx, cfg.TCPAddr)
+			},
+		},
+		{
+			name:    "Unix socket",
+			addr:    cfg.UnixSocket,
+			enabled: cfg.UnixSocket != "",
+			start: func(ctx context.Context) error {
+				return unixServer.StartUnix(ctx, cfg.UnixSocket)
+			},
+		},
+		{
+			name:    "HTTP",
+			addr:    cfg.HTTPAddr,
+			enabled: cfg.EnableHTTP,
+			start: func(ctx context.Context) error {
+				return httpServer.Start(ctx, cfg.HTTPAddr)
+			},
+		},
+		{
+			name:    "gRPC",
+			addr:    cfg.GRPCAddr,
+			enabled: cfg.GRPCAddr != "",
+			start: func(ctx context.Context) error {
+				return grpcServer.Start(ctx, cfg.GRPCAddr)
+			},
+		},
+	}
+
+	// The watchdog times no-ops through the shard executors, the path every
+	// write takes, next to the runtime's GC pauses and scheduling latency
+	var stalls *watchdog.Watchdog
+	if cfg.WatchdogInterval > 0 {
+		stalls = watchdog.New(cfg.WatchdogInterval, cfg.StallThreshold, db.ProbeExecutors)
+		stalls.OnSample(func(s watchdog.Sample) {
+			metricsRegistry.ObserveEventLoop(s.Lag.Seconds(), s.Probe.Seconds(), s.GCPause.Seconds(), s.SchedLatency.Seconds())
+			if s.Stalled(cfg.StallThreshold) {
+				metricsRegistry.IncrementStalls(s.Cause())
+			}
+		})
+	}
+
+	// Kubernetes probes /readyz before routing to the server
+	addReadinessChecks(httpServer, cfg, stalls)
+
+	run(components, func(ctx context.Context) {
+		db.StartBackgroundProcesses(ctx)
+		if stalls != nil {
+			go stalls.Run(ctx)
+		}
+		metricsRegistry.StartCollector(ctx, 5*time.Second, db.KeyCount, func(m *metrics.Metrics) {
+			for _, w := range db.WorkingSet().Windows {
+				m.SetWorkingSet(w.Label(), w.Keys, w.Bytes)
+			}
+		}, func(m *metrics.Metrics) {
+			m.SetVersionsTotal(db.VersionCount())
+			m.SetShardKeys(db.ShardKeyCounts())
+			m.SetTTLWheelEntries(db.ScheduledExpirations())
+		})
+	}, cfg.ShutdownTimeout)
+
+	// The listeners have drained, so nothing writes any more: stop the
+	// background processes and jobs, and flush the archive files
+	db.Close()
+	if scheduler != nil {
+		scheduler.Close()
+		if err := wasmRuntime.Close(context.Background()); err != nil {
+			slog.Error("Failed to close WASM runtime", "error", err)
+		}
+	}
+	for _, file := range archiveFiles {
+		if err := file.Close(); err != nil {
+			slog.Error("Failed to close archive", "error", err)
+		}
+	}
+	slog.Info("PulseDB shutdown complete")
+}
 
+// runProxy runs the process as a RESP proxy in front of backend PulseDB processes
+func runProxy(cfg *config.Config) {
+	slog.Info("Starting PulseDB proxy", "backends", cfg.Backends)
+
+	p := proxy.NewProxy(cfg.Backends)
+	p.SetLimits(cfg.Limits)
+
+	run([]component{
+		{
+			name:    "Proxy",
+			addr:    cfg.TCPAddr,
+			enabled: true,
+			start: func(ctx context.Context) error {
+				return p.Start(ctx, cfg.TCPAddr)
+			},
+		},
+	}, nil, cfg.ShutdownTimeout)
+	slog.Info("PulseDB shutdown complete")
+}
+
+// run starts the enabled components and the optional background function,
+// then blocks until SIGINT/SIGTERM and stops them, giving listeners up to
+// timeout to drain their connections
+func run(components []component, background func(ctx context.Context), timeout time.Duration) {
 	// Setup graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	var wg sync.WaitGroup
 
-	// Start TCP server
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if err := startTCPServer(ctx, tcpServer); err != nil {
-			log.Printf("TCP server error: %v", err)
+	// Start enabled components
+	for _, c := range components {
+		if !c.enabled {
+			slog.Info("Server disabled", "server", c.name)
+			continue
 		}
-	}()
 
-	// Start HTTP server
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if err := httpServer.Start(ctx, ":"+DefaultHTTPPort); err != nil {
-			log.Printf("HTTP server error: %v", err)
-		}
-	}()
+		c := c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.start(ctx); err != nil {
+				slog.Error("Server error", "server", c.name, "error", err)
+			}
+		}()
+		slog.Info("Server listening", "server", c.name, "addr", c.addr)
+	}
 
 	// Start background processes
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		db.StartBackgroundProcesses(ctx)
-	}()
+	if background != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			background(ctx)
+		}()
+	}
 
 	// Wait for interrupt signal
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	log.Printf("PulseDB is running on TCP port %s and HTTP port %s", DefaultTCPPort, DefaultHTTPPort)
+	slog.Info("PulseDB is running")
 	<-sigChan
 
-	log.Println("Shutting down PulseDB...")
+	slog.Info("Shutting down PulseDB")
 	cancel()
 
 	// Wait for all goroutines to finish with timeout
@@ -85,40 +379,80 @@ func main() {
 		close(done)
 	}()
 
+	// Listeners close the connections left at the timeout themselves, so
+	// only a stuck command delays them past it
 	select {
 	case <-done:
-		log.Println("PulseDB shutdown complete")
-	case <-time.After(30 * time.Second):
-		log.Println("Shutdown timeout exceeded")
+	case <-time.After(timeout + 5*time.Second):
+		slog.Warn("Shutdown timeout exceeded")
 	}
 }
 
-func startTCPServer(ctx context.Context, srv *server.Server) error {
-	listener, err := net.Listen("tcp", ":"+DefaultTCPPort)
-	if err != nil {
-		return fmt.Errorf("failed to listen on port %s: %w", DefaultTCPPort, err)
-	}
-	defer listener.Close()
+// fatal logs err and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
 
-	// Accept connections in a separate goroutine
-	go func() {
-		for {
-			conn, err := listener.Accept()
-			if err != nil {
-				select {
-				case <-ctx.Done():
-					return
-				default:
-					log.Printf("Failed to accept connection: %v", err)
-					continue
-				}
+// addReadinessChecks registers the dependencies /readyz checks. PulseDB is
+// memory only and has no replicas, so there is no data to recover and no
+// replication lag: those checks always pass, and are reported so probes
+// show what was checked.
+func addReadinessChecks(h *http.HTTPServer, cfg *config.Config, stalls *watchdog.Watchdog) {
+	h.AddReadinessCheck("persistence", func() error { return nil })
+	h.AddReadinessCheck("replication", func() error { return nil })
+	if cfg.ReadyMaxMemory > 0 {
+		h.AddReadinessCheck("memory", func() error {
+			var mem runtime.MemStats
+			runtime.ReadMemStats(&mem)
+			if int64(mem.HeapAlloc) > cfg.ReadyMaxMemory {
+				return fmt.Errorf("heap of %d bytes exceeds %d", mem.HeapAlloc, cfg.ReadyMaxMemory)
 			}
+			return nil
+		})
+	}
+	if stalls != nil {
+		h.AddReadinessCheck("watchdog", func() error {
+			if last := stalls.Last(); last.Stalled(cfg.StallThreshold) {
+				return fmt.Errorf("stalled for %v (%s)", max(last.Lag, last.Probe), last.Cause())
+			}
+			return nil
+		})
+	}
+}
 
-			go srv.HandleConnection(conn)
-		}
-	}()
-
-	// Wait for context cancellation
-	<-ctx.Done()
-	return nil
+// capabilities describes the subsystems this configuration runs for
+// CAPABILITIES and GET /capabilities
+func capabilities(cfg *config.Config) []info.Capability {
+	return []info.Capability{
+		{
+			Name:    "resp",
+			Enabled: cfg.EnableTCP || cfg.UnixSocket != "",
+			Version: "3",
+			Limits: map[string]int64{
+				"max_bulk_length":     int64(cfg.Limits.MaxBulkLength),
+				"max_array_length":    int64(cfg.Limits.MaxArrayLength),
+				"max_depth":           int64(cfg.Limits.MaxDepth),
+				"max_request_size":    cfg.Limits.MaxRequestSize,
+				"max_inline_length":   int64(cfg.Limits.MaxInlineLength),
+				"max_clients":         int64(cfg.MaxClients),
+				"client_memory_limit": cfg.ClientMemoryLimit,
+				"max_response_size":   cfg.MaxResponseSize,
+			},
+		},
+		{Name: "http", Enabled: cfg.EnableHTTP},
+		{Name: "grpc", Enabled: cfg.GRPCAddr != ""},
+		{Name: "apikeys", Enabled: cfg.APIKeys},
+		{
+			Name:    "mvcc",
+			Enabled: true,
+			Limits:  map[string]int64{"max_string_length": store.MaxStringLength},
+		},
+		{Name: "streams", Enabled: true},
+		{Name: "archive", Enabled: len(cfg.Archives) > 0},
+		{Name: "persistence", Enabled: false},
+		{Name: "replication", Enabled: false},
+		{Name: "wasm", Enabled: cfg.WASMDir != ""},
+		{Name: "cluster", Enabled: false},
+	}
 }
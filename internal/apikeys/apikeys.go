@@ -0,0 +1,262 @@
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// tokenPrefix starts every token, so leaked tokens are easy to scan for
+const tokenPrefix = "pdb_"
+
+var (
+	// ErrNotFound is returned for an unknown key ID
+	ErrNotFound = errors.New("API key not found")
+
+	// ErrRevoked is returned when rotating a revoked key
+	ErrRevoked = errors.New("API key has been revoked")
+
+	// ErrInvalidToken is returned when a token does not authenticate
+	ErrInvalidToken = errors.New("invalid API key")
+)
+
+// Key is an API key as reported by the admin endpoints. The secret part of
+// its token is only ever returned when the key is created or rotated.
+type Key struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"` // Only keys of this namespace are reachable, if set
+	Created   int64  `json:"created"`
+	Rotated   int64  `json:"rotated,omitempty"`
+	Revoked   int64  `json:"revoked,omitempty"`
+}
+
+// Usage is the metered usage of a key since it was created
+type Usage struct {
+	Ops      int64 `json:"ops"`
+	BytesIn  int64 `json:"bytes_in"`
+	BytesOut int64 `json:"bytes_out"`
+
+	// StorageBytes is the size of the live keys in the key's namespace, 0
+	// for keys without a namespace
+	StorageBytes int64 `json:"storage_bytes"`
+}
+
+// Report is the usage of one key
+type Report struct {
+	Key   Key   `json:"key"`
+	Usage Usage `json:"usage"`
+}
+
+// entry is a key with the hash of its secret and its counters
+type entry struct {
+	key  Key
+	hash [sha256.Size]byte
+
+	ops      atomic.Int64
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+}
+
+// Registry holds the API keys of a server. Tokens are "pdb_<id>_<secret>";
+// only a SHA-256 hash of the secret is kept. Keys live in memory like the
+// rest of the data and are lost on restart.
+type Registry struct {
+	mu   sync.RWMutex
+	keys map[string]*entry
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{keys: make(map[string]*entry)}
+}
+
+// Create adds a key and returns it with its token. A key with a namespace
+// may only reach keys of that namespace.
+func (r *Registry) Create(name, namespace string) (Key, string, error) {
+	if name == "" {
+		return Key{}, "", errors.New("API key name must not be empty")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := randomHex(8)
+	for r.keys[id] != nil {
+		id = randomHex(8)
+	}
+	e := &entry{key: Key{
+		ID:        id,
+		Name:      name,
+		Namespace: namespace,
+		Created:   time.Now().UnixMilli(),
+	}}
+	token := e.newSecret()
+	r.keys[id] = e
+	return e.key, token, nil
+}
+
+// Rotate replaces the secret of a key, invalidating its old token, and
+// returns the key with its new token. Usage carries over.
+func (r *Registry) Rotate(id string) (Key, string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, exists := r.keys[id]
+	if !exists {
+		return Key{}, "", ErrNotFound
+	}
+	if e.key.Revoked != 0 {
+		return Key{}, "", ErrRevoked
+	}
+	token := e.newSecret()
+	e.key.Rotated = time.Now().UnixMilli()
+	return e.key, token, nil
+}
+
+// Revoke makes a key stop authenticating. It is kept for its usage report.
+func (r *Registry) Revoke(id string) (Key, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, exists := r.keys[id]
+	if !exists {
+		return Key{}, ErrNotFound
+	}
+	if e.key.Revoked == 0 {
+		e.key.Revoked = time.Now().UnixMilli()
+	}
+	return e.key, nil
+}
+
+// Get returns a key by ID
+func (r *Registry) Get(id string) (Key, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	e, exists := r.keys[id]
+	if !exists {
+		return Key{}, false
+	}
+	return e.key, true
+}
+
+// List returns every key, oldest first
+func (r *Registry) List() []Key {
+	r.mu.RLock()
+	keys := make([]Key, 0, len(r.keys))
+	for _, e := range r.keys {
+		keys = append(keys, e.key)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Created != keys[j].Created {
+			return keys[i].Created < keys[j].Created
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys
+}
+
+// Authenticate returns the live key a token belongs to
+func (r *Registry) Authenticate(token string) (Key, error) {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(token, tokenPrefix), "_")
+	if !ok || !strings.HasPrefix(token, tokenPrefix) {
+		return Key{}, ErrInvalidToken
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	e, exists := r.keys[id]
+	if !exists || e.key.Revoked != 0 {
+		return Key{}, ErrInvalidToken
+	}
+	hash := sha256.Sum256([]byte(secret))
+	if subtle.ConstantTimeCompare(hash[:], e.hash[:]) != 1 {
+		return Key{}, ErrInvalidToken
+	}
+	return e.key, nil
+}
+
+// Record meters one request made with a key and the bytes it read and wrote
+func (r *Registry) Record(id string, bytesIn, bytesOut int64) {
+	r.mu.RLock()
+	e, exists := r.keys[id]
+	r.mu.RUnlock()
+
+	if !exists {
+		return
+	}
+	e.ops.Add(1)
+	e.bytesIn.Add(bytesIn)
+	e.bytesOut.Add(bytesOut)
+}
+
+// Usage returns the usage of every key, oldest first. storage returns the
+// bytes held by a namespace; it is called once per namespace.
+func (r *Registry) Usage(storage func(namespace string) int64) []Report {
+	r.mu.RLock()
+	reports := make([]Report, 0, len(r.keys))
+	for _, e := range r.keys {
+		reports = append(reports, Report{
+			Key: e.key,
+			Usage: Usage{
+				Ops:      e.ops.Load(),
+				BytesIn:  e.bytesIn.Load(),
+				BytesOut: e.bytesOut.Load(),
+			},
+		})
+	}
+	r.mu.RUnlock()
+
+	sizes := make(map[string]int64)
+	for i := range reports {
+		ns := reports[i].Key.Namespace
+		if ns == "" || storage == nil {
+			continue
+		}
+		size, known := sizes[ns]
+		if !known {
+			size = storage(ns)
+			sizes[ns] = size
+		}
+		reports[i].Usage.StorageBytes = size
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].Key.Created != reports[j].Key.Created {
+			return reports[i].Key.Created < reports[j].Key.Created
+		}
+		return reports[i].Key.ID < reports[j].Key.ID
+	})
+	return reports
+}
+
+// Permits reports whether a key may reach keys of namespace
+func (k Key) Permits(namespace string) bool {
+	return k.Namespace == "" || k.Namespace == namespace
+}
+
+// newSecret gives the entry a new secret and returns its token. The caller
+// must hold the registry write lock.
+func (e *entry) newSecret() string {
+	secret := randomHex(16)
+	e.hash = sha256.Sum256([]byte(secret))
+	return tokenPrefix + e.key.ID + "_" + secret
+}
+
+// randomHex returns n random bytes hex encoded
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
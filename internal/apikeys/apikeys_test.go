@@ -0,0 +1,93 @@
+package apikeys
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistryLifecycle(t *testing.T) {
+	r := NewRegistry()
+
+	if _, _, err := r.Create("", ""); err == nil {
+		t.Error("Expected a key without a name to be rejected")
+	}
+
+	key, token, err := r.Create("billing", "billing")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if !strings.HasPrefix(token, tokenPrefix+key.ID+"_") {
+		t.Errorf("Unexpected token format %q", token)
+	}
+	if got, err := r.Authenticate(token); err != nil || got.ID != key.ID {
+		t.Errorf("Expected the token to authenticate as %s, got %+v, %v", key.ID, got, err)
+	}
+	for _, bad := range []string{"", "pdb_", token + "x", "pdb_" + key.ID, strings.TrimPrefix(token, tokenPrefix)} {
+		if _, err := r.Authenticate(bad); err != ErrInvalidToken {
+			t.Errorf("Expected %q not to authenticate, got %v", bad, err)
+		}
+	}
+
+	_, rotated, err := r.Rotate(key.ID)
+	if err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if _, err := r.Authenticate(token); err != ErrInvalidToken {
+		t.Error("Expected the old token to stop working after rotation")
+	}
+	if _, err := r.Authenticate(rotated); err != nil {
+		t.Errorf("Expected the rotated token to work, got %v", err)
+	}
+
+	if _, err := r.Revoke(key.ID); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if _, err := r.Authenticate(rotated); err != ErrInvalidToken {
+		t.Error("Expected a revoked key not to authenticate")
+	}
+	if _, _, err := r.Rotate(key.ID); err != ErrRevoked {
+		t.Errorf("Expected ErrRevoked, got %v", err)
+	}
+	if _, err := r.Revoke("missing"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if keys := r.List(); len(keys) != 1 || keys[0].Revoked == 0 {
+		t.Errorf("Expected the revoked key to stay listed, got %+v", keys)
+	}
+}
+
+func TestRegistryUsage(t *testing.T) {
+	r := NewRegistry()
+	tenant, _, _ := r.Create("tenant", "tenant")
+	admin, _, _ := r.Create("admin", "")
+
+	r.Record(tenant.ID, 10, 100)
+	r.Record(tenant.ID, 5, 50)
+	r.Record(admin.ID, 1, 1)
+	r.Record("missing", 1, 1)
+
+	calls := 0
+	reports := r.Usage(func(namespace string) int64 {
+		calls++
+		return 4096
+	})
+	if len(reports) != 2 || calls != 1 {
+		t.Fatalf("Expected 2 reports and one storage lookup, got %+v after %d lookups", reports, calls)
+	}
+	for _, report := range reports {
+		switch report.Key.ID {
+		case tenant.ID:
+			if report.Usage != (Usage{Ops: 2, BytesIn: 15, BytesOut: 150, StorageBytes: 4096}) {
+				t.Errorf("Unexpected tenant usage %+v", report.Usage)
+			}
+		case admin.ID:
+			if report.Usage != (Usage{Ops: 1, BytesIn: 1, BytesOut: 1}) {
+				t.Errorf("Unexpected admin usage %+v", report.Usage)
+			}
+		}
+	}
+
+	if !admin.Permits("anything") || !tenant.Permits("tenant") || tenant.Permits("other") {
+		t.Error("Unexpected namespace permissions")
+	}
+}
@@ -0,0 +1,200 @@
+package archive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"pulsedb/internal/store"
+	"pulsedb/internal/streams"
+)
+
+// Sink kinds accepted in archive specs
+const (
+	KindStream = "stream"
+	KindFile   = "file"
+)
+
+// Spec is a parsed pattern=kind:target archive rule
+type Spec struct {
+	Pattern string
+	Kind    string
+	Target  string // Stream name or file path
+}
+
+// ParseSpecs parses a comma-separated list of archive rules, e.g.
+// "session:*=stream:expired-sessions,tmp:*=file:/var/lib/pulsedb/tmp.jsonl"
+func ParseSpecs(value string) ([]Spec, error) {
+	var specs []Spec
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		pattern, sink, ok := strings.Cut(item, "=")
+		kind, target, hasTarget := strings.Cut(sink, ":")
+		if !ok || !hasTarget || pattern == "" || target == "" {
+			return nil, fmt.Errorf("invalid archive rule '%s', expected pattern=stream:name or pattern=file:path", item)
+		}
+		if kind != KindStream && kind != KindFile {
+			return nil, fmt.Errorf("unsupported archive sink '%s'", kind)
+		}
+		specs = append(specs, Spec{Pattern: pattern, Kind: kind, Target: target})
+	}
+	return specs, nil
+}
+
+// Open creates the sink described by spec. Stream sinks append to sm.
+func Open(spec Spec, sm *streams.StreamManager) (store.ArchiveSink, error) {
+	switch spec.Kind {
+	case KindStream:
+		return NewStreamSink(sm, spec.Target), nil
+	case KindFile:
+		return OpenFileSink(spec.Target)
+	default:
+		return nil, fmt.Errorf("unsupported archive sink '%s'", spec.Kind)
+	}
+}
+
+// StreamSink appends archived keys to a stream, one entry per key
+type StreamSink struct {
+	streams *streams.StreamManager
+	stream  string
+}
+
+// NewStreamSink creates a sink appending to the stream named stream
+func NewStreamSink(sm *streams.StreamManager, stream string) *StreamSink {
+	return &StreamSink{streams: sm, stream: stream}
+}
+
+// Archive appends entry to the stream
+func (s *StreamSink) Archive(entry store.ArchivedKey) error {
+	record := newRecord(entry)
+
+	// Strings are stored as is, other types as JSON
+	value := entry.Value.Data
+	if entry.Value.Type != store.TypeString {
+		encoded, err := json.Marshal(record.Value)
+		if err != nil {
+			return err
+		}
+		value = string(encoded)
+	}
+
+	_, err := s.streams.AddEntry(s.stream, map[string]string{
+		"key":         record.Key,
+		"type":        record.Type,
+		"value":       value,
+		"timestamp":   strconv.FormatInt(record.Timestamp, 10),
+		"expires_at":  strconv.FormatInt(record.ExpiresAt, 10),
+		"reason":      record.Reason,
+		"archived_at": strconv.FormatInt(record.ArchivedAt, 10),
+	}, "")
+	if errors.Is(err, streams.ErrDropped) {
+		// Filtered out by the stream's pipeline, as intended
+		return nil
+	}
+	return err
+}
+
+func (s *StreamSink) String() string {
+	return KindStream + ":" + s.stream
+}
+
+// FileSink appends archived keys to a file as JSON lines
+type FileSink struct {
+	path string
+
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// OpenFileSink opens path for appending, creating it if needed
+func OpenFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{path: path, file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+// Archive writes entry as one JSON line
+func (f *FileSink) Archive(entry store.ArchivedKey) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.encoder.Encode(newRecord(entry))
+}
+
+// Close closes the underlying file
+func (f *FileSink) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+func (f *FileSink) String() string {
+	return KindFile + ":" + f.path
+}
+
+// record is the external form of an archived key. Value is the string for
+// strings, the sorted members for sets, member/score pairs for sorted sets,
+// and the document itself for JSON values.
+type record struct {
+	Key        string      `json:"key"`
+	Type       string      `json:"type"`
+	Value      interface{} `json:"value"`
+	Timestamp  int64       `json:"timestamp"`  // When the final version was written
+	ExpiresAt  int64       `json:"expires_at"` // When its TTL elapsed, 0 if it had none
+	Reason     string      `json:"reason"`
+	ArchivedAt int64       `json:"archived_at"`
+}
+
+type zsetMember struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+func newRecord(entry store.ArchivedKey) record {
+	r := record{
+		Key:        entry.Key,
+		Type:       entry.Value.Type.String(),
+		Timestamp:  entry.Value.Timestamp,
+		ExpiresAt:  entry.Value.TTL,
+		Reason:     entry.Reason,
+		ArchivedAt: entry.ArchivedAt,
+	}
+
+	switch entry.Value.Type {
+	case store.TypeSet:
+		members := make([]string, 0, len(entry.Value.Set))
+		for member := range entry.Value.Set {
+			members = append(members, member)
+		}
+		sort.Strings(members)
+		r.Value = members
+	case store.TypeZSet:
+		members := []zsetMember{}
+		if entry.Value.ZSet != nil {
+			for _, m := range entry.Value.ZSet.Members() {
+				members = append(members, zsetMember{Member: m.Member, Score: m.Score})
+			}
+		}
+		r.Value = members
+	case store.TypeJSON:
+		r.Value = json.RawMessage(entry.Value.Data)
+	case store.TypeSketch:
+		if entry.Value.Sketch != nil {
+			r.Value = entry.Value.Sketch.Summary()
+		}
+	default:
+		r.Value = entry.Value.Data
+	}
+	return r
+}
@@ -0,0 +1,87 @@
+package archive
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pulsedb/internal/store"
+	"pulsedb/internal/streams"
+)
+
+func TestParseSpecs(t *testing.T) {
+	specs, err := ParseSpecs("session:*=stream:expired, tmp:*=file:/tmp/a.jsonl")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(specs) != 2 || specs[0] != (Spec{"session:*", KindStream, "expired"}) || specs[1] != (Spec{"tmp:*", KindFile, "/tmp/a.jsonl"}) {
+		t.Errorf("Unexpected specs %+v", specs)
+	}
+
+	for _, value := range []string{"session:*", "session:*=stream", "session:*=kafka:topic"} {
+		if _, err := ParseSpecs(value); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestStreamSink(t *testing.T) {
+	sm := streams.NewStreamManager()
+	sink := NewStreamSink(sm, "expired")
+
+	for _, key := range []string{"a", "b"} {
+		err := sink.Archive(store.ArchivedKey{
+			Key:    key,
+			Value:  store.Value{Data: "v-" + key, Timestamp: 1, TTL: 1000},
+			Reason: store.ArchiveExpired,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	entries, err := sm.LastEntries("expired", 10)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %+v (%v)", entries, err)
+	}
+	if entries[0].ID == entries[1].ID {
+		t.Errorf("Expected unique entry IDs, got %s twice", entries[0].ID)
+	}
+	if f := entries[1].Fields; f["key"] != "b" || f["value"] != "v-b" || f["reason"] != "expired" || f["expires_at"] != "1000" {
+		t.Errorf("Unexpected entry fields %+v", entries[1].Fields)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive.jsonl")
+	sink, err := OpenFileSink(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	err = sink.Archive(store.ArchivedKey{
+		Key:   "tags",
+		Value: store.Value{Type: store.TypeSet, Set: map[string]struct{}{"b": {}, "a": {}}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sink.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var r struct {
+		Key   string   `json:"key"`
+		Type  string   `json:"type"`
+		Value []string `json:"value"`
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if r.Key != "tags" || r.Type != "set" || len(r.Value) != 2 || r.Value[0] != "a" {
+		t.Errorf("Unexpected record %+v", r)
+	}
+}
@@ -0,0 +1,365 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"pulsedb/internal/archive"
+	"pulsedb/internal/latency"
+	"pulsedb/internal/logging"
+	"pulsedb/internal/proto"
+	"pulsedb/internal/slowlog"
+	"pulsedb/internal/store"
+	"pulsedb/internal/throttle"
+	"pulsedb/internal/watchdog"
+)
+
+const (
+	DefaultTCPAddr     = ":6380"
+	DefaultHTTPAddr    = ":8080"
+	DefaultMaxClients  = 10000
+	DefaultIdleTimeout = 30 * time.Second
+
+	DefaultShutdownTimeout = 30 * time.Second
+)
+
+// Config holds the runtime configuration of a PulseDB process
+type Config struct {
+	TCPAddr    string
+	HTTPAddr   string
+	EnableTCP  bool
+	EnableHTTP bool
+
+	// UnixSocket is the path of an optional unix domain socket listener
+	UnixSocket string
+
+	// GRPCAddr is the address of an optional gRPC listener
+	GRPCAddr string
+
+	// Per-listener command whitelists; empty means every command is exposed
+	TCPCommands  []string
+	HTTPCommands []string
+	UnixCommands []string
+	GRPCCommands []string
+
+	// Proxy mode serves RESP on TCPAddr and shards keys across Backends
+	// instead of storing data locally
+	Proxy    bool
+	Backends []string
+
+	// Protocol limits enforced on RESP requests
+	Limits proto.Limits
+
+	// MaxClients caps concurrent connections per RESP listener (0 means
+	// unlimited); IdleTimeout closes idle connections (0 disables it)
+	MaxClients  int
+	IdleTimeout time.Duration
+
+	// ShutdownTimeout bounds how long shutdown waits for connections to
+	// finish their commands; ShutdownNotice sends them a -SHUTDOWN error
+	// before they are closed
+	ShutdownTimeout time.Duration
+	ShutdownNotice  bool
+
+	// ClientMemoryLimit caps the bytes one RESP connection may use for a
+	// request or a reply (0 means unlimited)
+	ClientMemoryLimit int64
+
+	// OutputLimits bound the replies and messages queued for RESP clients
+	// reading them too slowly, per client class
+	OutputLimits proto.OutputLimits
+
+	// MaxResponseSize truncates list replies (HIST, KEYS, SMEMBERS...) and
+	// shortens SCAN pages past this many bytes (0 means unlimited)
+	MaxResponseSize int64
+
+	// Socket tuning for accepted TCP connections; zero buffer sizes keep
+	// the operating system defaults and QuickAck is Linux only
+	TCPNoDelay       bool
+	TCPSendBuffer    int
+	TCPReceiveBuffer int
+	TCPQuickAck      bool
+
+	// Commands slower than SlowLogThreshold are kept in a log of
+	// SlowLogMaxLen entries; a negative threshold disables the log
+	SlowLogThreshold time.Duration
+	SlowLogMaxLen    int
+
+	// Commands running for at least LatencyThreshold are recorded as
+	// latency spikes for LATENCY; zero or negative disables the monitor
+	LatencyThreshold time.Duration
+
+	// DefaultTTLs are applied to keys SET without an explicit TTL
+	DefaultTTLs []store.DefaultTTL
+
+	// SlidingTTLs are the patterns of keys whose TTL every read extends
+	SlidingTTLs []string
+
+	// RESP2Compat encodes replies as RESP2 even for connections that
+	// negotiated RESP3 with HELLO
+	RESP2Compat bool
+
+	// Retention is the history retention policy of keys without their own
+	Retention store.RetentionPolicy
+
+	// Expiry sizes the background expiry sweep to the load
+	Expiry store.ExpiryPolicy
+
+	// Archives receive the final value of expired or evicted keys
+	Archives []archive.Spec
+
+	// ReadOnly starts the server refusing write commands; CONFIG SET
+	// read-only changes it at runtime
+	ReadOnly bool
+
+	// ExportDir is the directory EXPORT writes to and IMPORT reads from
+	// (empty disables both)
+	ExportDir string
+
+	// WASMDir holds the WASM functions loaded at startup, one per .wasm
+	// file (empty disables WASM functions and scheduled jobs)
+	WASMDir string
+
+	// WASMTimeout and WASMMaxMemory sandbox every WASM function call: its
+	// wall-clock time and the bytes of linear memory of a function (0 for
+	// no limit)
+	WASMTimeout   time.Duration
+	WASMMaxMemory int64
+
+	// Quotas limit the request and reply bandwidth of key namespaces
+	Quotas []throttle.Quota
+
+	// RateLimits limit the commands per second of each client, identified
+	// by API key or IP address, in each command class
+	RateLimits throttle.Rates
+
+	// APIKeys requires an API key on every RESP connection and HTTP request;
+	// keys are managed over HTTP with AdminToken
+	APIKeys    bool
+	AdminToken string
+
+	// The stall watchdog samples event loop responsiveness every
+	// WatchdogInterval (0 disables it) and logs samples delayed by
+	// StallThreshold or more
+	WatchdogInterval time.Duration
+	StallThreshold   time.Duration
+
+	// ReadyMaxMemory is the Go heap in bytes above which /readyz reports
+	// the server not ready (0 for no limit)
+	ReadyMaxMemory int64
+
+	// Log configures the process log; AccessLog also logs every command and
+	// HTTP request with its client, latency and result
+	Log       logging.Options
+	AccessLog bool
+}
+
+// Default returns the default configuration
+func Default() *Config {
+	return &Config{
+		TCPAddr:      DefaultTCPAddr,
+		HTTPAddr:     DefaultHTTPAddr,
+		EnableTCP:    true,
+		EnableHTTP:   true,
+		Limits:       proto.DefaultLimits,
+		OutputLimits: proto.DefaultOutputLimits,
+		MaxClients:   DefaultMaxClients,
+		IdleTimeout:  DefaultIdleTimeout,
+		TCPNoDelay:   true,
+
+		ShutdownTimeout:  DefaultShutdownTimeout,
+		SlowLogThreshold: slowlog.DefaultThreshold,
+		SlowLogMaxLen:    slowlog.DefaultMaxLen,
+		LatencyThreshold: latency.DefaultThreshold,
+		Retention:        store.DefaultRetention,
+		Expiry:           store.DefaultExpiryPolicy,
+		WatchdogInterval: watchdog.DefaultInterval,
+		StallThreshold:   watchdog.DefaultThreshold,
+		Log:              logging.DefaultOptions,
+	}
+}
+
+// Load builds a configuration from command-line arguments (without the program name)
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("pulsedb", flag.ContinueOnError)
+	fs.StringVar(&cfg.TCPAddr, "tcp-addr", cfg.TCPAddr, "address for the RESP (TCP) listener")
+	fs.StringVar(&cfg.HTTPAddr, "http-addr", cfg.HTTPAddr, "address for the HTTP API listener")
+	noTCP := fs.Bool("no-tcp", false, "disable the RESP (TCP) listener")
+	noHTTP := fs.Bool("no-http", false, "disable the HTTP API listener")
+	fs.BoolVar(&cfg.Proxy, "proxy", false, "run as a RESP proxy sharding keys across --backends")
+	backends := fs.String("backends", "", "comma-separated backend addresses for proxy mode")
+	fs.StringVar(&cfg.UnixSocket, "unix-socket", "", "path of a unix domain socket listener (disabled if empty)")
+	fs.StringVar(&cfg.GRPCAddr, "grpc-addr", "", "address of a gRPC listener (disabled if empty)")
+	tcpCommands := fs.String("tcp-commands", "", "comma-separated commands exposed on the TCP listener (default all)")
+	httpCommands := fs.String("http-commands", "", "comma-separated commands exposed on the HTTP listener (default all)")
+	unixCommands := fs.String("unix-commands", "", "comma-separated commands exposed on the unix socket (default all)")
+	grpcCommands := fs.String("grpc-commands", "", "comma-separated commands exposed on the gRPC listener (default all)")
+	fs.IntVar(&cfg.Limits.MaxBulkLength, "proto-max-bulk-len", cfg.Limits.MaxBulkLength, "maximum size in bytes of a RESP bulk string")
+	fs.Int64Var(&cfg.Limits.MaxRequestSize, "proto-max-request-size", cfg.Limits.MaxRequestSize, "maximum size in bytes of a single RESP request")
+	fs.IntVar(&cfg.Limits.MaxDepth, "proto-max-depth", cfg.Limits.MaxDepth, "maximum nesting depth of RESP aggregates")
+	fs.IntVar(&cfg.MaxClients, "max-clients", cfg.MaxClients, "maximum concurrent connections per RESP listener (0 for unlimited)")
+	fs.Int64Var(&cfg.ClientMemoryLimit, "client-memory-limit", 0, "maximum bytes a RESP connection may use for a request or a reply (0 for unlimited)")
+	outputLimits := fs.String("client-output-buffer-limit", cfg.OutputLimits.String(), "comma-separated class=hard:soft:time limits on the output queued for slow RESP clients, for classes normal and pubsub (0 for no limit)")
+	fs.Int64Var(&cfg.MaxResponseSize, "max-response-size", 0, "truncate list replies and shorten SCAN pages past this many bytes (0 for unlimited)")
+	fs.DurationVar(&cfg.IdleTimeout, "idle-timeout", cfg.IdleTimeout, "close RESP connections idle for this long (0 to disable)")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout, "how long shutdown waits for connections to finish their commands")
+	fs.BoolVar(&cfg.ShutdownNotice, "shutdown-notice", false, "send connections a -SHUTDOWN error before closing them on shutdown")
+	fs.BoolVar(&cfg.TCPNoDelay, "tcp-nodelay", cfg.TCPNoDelay, "disable Nagle's algorithm on accepted connections")
+	fs.IntVar(&cfg.TCPSendBuffer, "tcp-sndbuf", 0, "socket send buffer size in bytes (0 for the OS default)")
+	fs.IntVar(&cfg.TCPReceiveBuffer, "tcp-rcvbuf", 0, "socket receive buffer size in bytes (0 for the OS default)")
+	fs.BoolVar(&cfg.TCPQuickAck, "tcp-quickack", false, "enable TCP_QUICKACK on accepted connections (Linux only)")
+	fs.DurationVar(&cfg.SlowLogThreshold, "slowlog-threshold", cfg.SlowLogThreshold, "log commands slower than this (negative to disable)")
+	fs.IntVar(&cfg.SlowLogMaxLen, "slowlog-max-len", cfg.SlowLogMaxLen, "number of slow commands to keep")
+	fs.DurationVar(&cfg.LatencyThreshold, "latency-threshold", cfg.LatencyThreshold, "record commands running for at least this as latency spikes (0 to disable)")
+	fs.BoolVar(&cfg.RESP2Compat, "resp2-compat", false, "reply with the RESP2 encoding even after HELLO 3")
+	retention := fs.String("retention", cfg.Retention.String(), "history retention: count:<n>, age:<duration> or all")
+	fs.IntVar(&cfg.Expiry.MaxBatch, "expiry-max-batch", cfg.Expiry.MaxBatch, "most expired keys removed per second when the server is not loaded")
+	fs.IntVar(&cfg.Expiry.MinBatch, "expiry-min-batch", cfg.Expiry.MinBatch, "fewest expired keys removed per second under load")
+	fs.DurationVar(&cfg.Expiry.LatencyThreshold, "expiry-latency-threshold", cfg.Expiry.LatencyThreshold, "average command latency above which expiry backs off (0 to ignore)")
+	fs.Float64Var(&cfg.Expiry.CPUThreshold, "expiry-cpu-threshold", cfg.Expiry.CPUThreshold, "process CPU, as a fraction of GOMAXPROCS, above which expiry backs off (0 to ignore, Linux only)")
+	archives := fs.String("archive", "", "comma-separated pattern=stream:name or pattern=file:path rules archiving expired keys")
+	fs.BoolVar(&cfg.ReadOnly, "read-only", false, "refuse write commands on every listener")
+	fs.StringVar(&cfg.ExportDir, "export-dir", "", "directory EXPORT writes to and IMPORT reads from (disabled if empty)")
+	fs.DurationVar(&cfg.WASMTimeout, "wasm-timeout", 5*time.Second, "interrupt WASM function calls running longer than this (0 for no limit)")
+	fs.Int64Var(&cfg.WASMMaxMemory, "wasm-max-memory", 128<<20, "maximum bytes of linear memory of a WASM function, rounded down to 64 KiB pages (0 for the 4 GiB of WASM)")
+	fs.StringVar(&cfg.WASMDir, "wasm-dir", "", "directory of WASM functions loaded at startup, one per .wasm file named after it (disabled if empty)")
+	quotas := fs.String("throttle", "", "comma-separated namespace=in:out bandwidth quotas in bytes per second, e.g. export=1M:512K")
+	rateLimits := fs.String("rate-limit", "", "comma-separated class=rate command rates per client per second, for classes read, write and admin, e.g. write=200,admin=10")
+	defaultTTLs := fs.String("default-ttl", "", "comma-separated pattern=duration default TTLs, e.g. session:*=30m")
+	fs.BoolVar(&cfg.APIKeys, "api-keys", false, "require an API key on every RESP connection and HTTP request")
+	fs.StringVar(&cfg.AdminToken, "admin-token", "", "token authorizing the HTTP API key administration endpoints")
+	fs.DurationVar(&cfg.WatchdogInterval, "watchdog-interval", cfg.WatchdogInterval, "how often the stall watchdog samples event loop responsiveness (0 to disable)")
+	fs.DurationVar(&cfg.StallThreshold, "stall-threshold", cfg.StallThreshold, "log watchdog samples delayed by this much as stalls")
+	fs.Int64Var(&cfg.ReadyMaxMemory, "ready-max-memory", 0, "report the server not ready on /readyz while its heap exceeds this many bytes (0 for no limit)")
+	logLevel := fs.String("log-level", cfg.Log.Level.String(), "lowest level logged: debug, info, warn or error")
+	logFormat := fs.String("log-format", cfg.Log.Format, "log format: text or json")
+	fs.StringVar(&cfg.Log.File, "log-file", "", "write logs to this file instead of stderr")
+	fs.Int64Var(&cfg.Log.MaxSize, "log-max-size", cfg.Log.MaxSize, "rotate the log file once it reaches this many bytes (0 to never rotate)")
+	fs.IntVar(&cfg.Log.MaxBackups, "log-max-backups", cfg.Log.MaxBackups, "number of rotated log files to keep")
+	fs.BoolVar(&cfg.AccessLog, "access-log", false, "log every command and HTTP request with its client, latency and result")
+	slidingTTLs := fs.String("sliding-ttl", "", "comma-separated patterns of keys whose TTL every read extends, e.g. session:*")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg.EnableTCP = !*noTCP
+	cfg.EnableHTTP = !*noHTTP
+
+	cfg.Backends = splitList(*backends)
+	cfg.TCPCommands = splitList(*tcpCommands)
+	cfg.HTTPCommands = splitList(*httpCommands)
+	cfg.UnixCommands = splitList(*unixCommands)
+	cfg.GRPCCommands = splitList(*grpcCommands)
+
+	cfg.SlidingTTLs = store.ParseSlidingPatterns(*slidingTTLs)
+
+	var err error
+	if cfg.Log.Level, err = logging.ParseLevel(*logLevel); err != nil {
+		return nil, err
+	}
+	if cfg.Log.Format, err = logging.ParseFormat(*logFormat); err != nil {
+		return nil, err
+	}
+	if cfg.DefaultTTLs, err = store.ParseDefaultTTLs(*defaultTTLs); err != nil {
+		return nil, err
+	}
+	if cfg.Retention, err = store.ParseRetention(*retention); err != nil {
+		return nil, err
+	}
+	if cfg.Archives, err = archive.ParseSpecs(*archives); err != nil {
+		return nil, err
+	}
+	if cfg.Quotas, err = throttle.ParseQuotas(*quotas); err != nil {
+		return nil, err
+	}
+	if cfg.RateLimits, err = throttle.ParseRates(*rateLimits); err != nil {
+		return nil, err
+	}
+	if cfg.OutputLimits, err = proto.ParseOutputLimits(*outputLimits); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Validate checks the configuration for inconsistencies
+func (c *Config) Validate() error {
+	if c.Limits.MaxBulkLength <= 0 || c.Limits.MaxRequestSize <= 0 || c.Limits.MaxDepth <= 0 {
+		return fmt.Errorf("protocol limits must be positive")
+	}
+	if c.MaxClients < 0 || c.IdleTimeout < 0 {
+		return fmt.Errorf("max clients and idle timeout must not be negative")
+	}
+	if c.ShutdownTimeout <= 0 {
+		return fmt.Errorf("shutdown timeout must be positive")
+	}
+	if c.ClientMemoryLimit < 0 {
+		return fmt.Errorf("client memory limit must not be negative")
+	}
+	if c.MaxResponseSize < 0 {
+		return fmt.Errorf("max response size must not be negative")
+	}
+	if c.WASMTimeout < 0 {
+		return fmt.Errorf("WASM timeout must not be negative")
+	}
+	if c.WASMMaxMemory < 0 || (c.WASMMaxMemory > 0 && c.WASMMaxMemory < 64<<10) {
+		return fmt.Errorf("WASM max memory must be 0 or at least one 64 KiB page")
+	}
+	if c.TCPSendBuffer < 0 || c.TCPReceiveBuffer < 0 {
+		return fmt.Errorf("socket buffer sizes must not be negative")
+	}
+	if c.SlowLogMaxLen < 1 {
+		return fmt.Errorf("slow log length must be positive")
+	}
+	if c.Expiry.MinBatch < 1 || c.Expiry.MaxBatch < c.Expiry.MinBatch {
+		return fmt.Errorf("expiry batch sizes must be positive with min <= max")
+	}
+	if c.Expiry.LatencyThreshold < 0 || c.Expiry.CPUThreshold < 0 {
+		return fmt.Errorf("expiry thresholds must not be negative")
+	}
+	if c.WatchdogInterval < 0 || c.StallThreshold <= 0 {
+		return fmt.Errorf("watchdog interval must not be negative and stall threshold must be positive")
+	}
+	if c.ReadyMaxMemory < 0 {
+		return fmt.Errorf("ready max memory must not be negative")
+	}
+	if c.Log.MaxSize < 0 || c.Log.MaxBackups < 0 {
+		return fmt.Errorf("log max size and backups must not be negative")
+	}
+	if c.APIKeys && c.AdminToken == "" {
+		return fmt.Errorf("--api-keys requires --admin-token to manage the keys")
+	}
+	if c.Proxy {
+		if len(c.Backends) == 0 {
+			return fmt.Errorf("proxy mode requires at least one backend")
+		}
+		return nil
+	}
+	if len(c.Backends) > 0 {
+		return fmt.Errorf("backends can only be used in proxy mode")
+	}
+	if !c.EnableTCP && !c.EnableHTTP && c.UnixSocket == "" && c.GRPCAddr == "" {
+		return fmt.Errorf("at least one listener must be enabled")
+	}
+	return nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
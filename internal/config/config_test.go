@@ -0,0 +1,172 @@
+package config
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !cfg.EnableTCP || !cfg.EnableHTTP {
+		t.Error("Expected both listeners to be enabled by default")
+	}
+	if cfg.TCPAddr != DefaultTCPAddr || cfg.HTTPAddr != DefaultHTTPAddr {
+		t.Errorf("Unexpected default addresses: %s, %s", cfg.TCPAddr, cfg.HTTPAddr)
+	}
+}
+
+func TestLoadDisableListeners(t *testing.T) {
+	cfg, err := Load([]string{"--no-http", "--tcp-addr", ":7000"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !cfg.EnableTCP || cfg.EnableHTTP {
+		t.Errorf("Expected TCP-only configuration, got %+v", cfg)
+	}
+	if cfg.TCPAddr != ":7000" {
+		t.Errorf("Expected TCP address :7000, got %s", cfg.TCPAddr)
+	}
+
+	if _, err := Load([]string{"--no-http", "--no-tcp"}); err == nil {
+		t.Error("Expected error when every listener is disabled")
+	}
+}
+
+func TestLoadCommandWhitelists(t *testing.T) {
+	cfg, err := Load([]string{"--http-commands", "GET, SCAN", "--unix-socket", "/tmp/pulsedb.sock"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(cfg.HTTPCommands) != 2 || cfg.HTTPCommands[0] != "GET" || cfg.HTTPCommands[1] != "SCAN" {
+		t.Errorf("Unexpected HTTP commands: %v", cfg.HTTPCommands)
+	}
+	if len(cfg.TCPCommands) != 0 {
+		t.Errorf("Expected no TCP whitelist, got %v", cfg.TCPCommands)
+	}
+	if cfg.UnixSocket != "/tmp/pulsedb.sock" {
+		t.Errorf("Unexpected unix socket path: %s", cfg.UnixSocket)
+	}
+}
+
+func TestLoadGRPC(t *testing.T) {
+	cfg, err := Load([]string{"--no-tcp", "--no-http", "--grpc-addr", ":50051", "--grpc-commands", "GET,SET"})
+	if err != nil {
+		t.Fatalf("Expected a gRPC-only configuration to be valid, got %v", err)
+	}
+	if cfg.GRPCAddr != ":50051" || len(cfg.GRPCCommands) != 2 {
+		t.Errorf("Unexpected gRPC settings %s, %v", cfg.GRPCAddr, cfg.GRPCCommands)
+	}
+}
+
+func TestLoadProtocolLimits(t *testing.T) {
+	cfg, err := Load([]string{"-proto-max-bulk-len", "1024", "-proto-max-depth", "4"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Limits.MaxBulkLength != 1024 || cfg.Limits.MaxDepth != 4 {
+		t.Errorf("Unexpected limits %+v", cfg.Limits)
+	}
+
+	if _, err := Load([]string{"-proto-max-request-size", "0"}); err == nil {
+		t.Error("Expected non-positive limit to be rejected")
+	}
+}
+
+func TestLoadDefaultTTLs(t *testing.T) {
+	cfg, err := Load([]string{"-default-ttl", "session:*=30m, cache:*=5s"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(cfg.DefaultTTLs) != 2 || cfg.DefaultTTLs[0].Pattern != "session:*" || cfg.DefaultTTLs[0].TTL != 30*time.Minute {
+		t.Errorf("Unexpected default TTLs %+v", cfg.DefaultTTLs)
+	}
+
+	if _, err := Load([]string{"-default-ttl", "session:*"}); err == nil {
+		t.Error("Expected default TTL without a duration to be rejected")
+	}
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	cfg, err := Load([]string{"-api-keys", "-admin-token", "secret"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !cfg.APIKeys || cfg.AdminToken != "secret" {
+		t.Errorf("Unexpected API key settings %+v", cfg)
+	}
+
+	if _, err := Load([]string{"-api-keys"}); err == nil {
+		t.Error("Expected API keys without an admin token to be rejected")
+	}
+}
+
+func TestLoadLogging(t *testing.T) {
+	cfg, err := Load([]string{"-log-level", "debug", "-log-format", "JSON", "-log-file", "/tmp/pulsedb.log", "-access-log"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Log.Level != slog.LevelDebug || cfg.Log.Format != "json" || cfg.Log.File != "/tmp/pulsedb.log" || !cfg.AccessLog {
+		t.Errorf("Unexpected log settings %+v, access log %v", cfg.Log, cfg.AccessLog)
+	}
+
+	if _, err := Load([]string{"-log-level", "loud"}); err == nil {
+		t.Error("Expected an unknown log level to be rejected")
+	}
+	if _, err := Load([]string{"-log-format", "xml"}); err == nil {
+		t.Error("Expected an unknown log format to be rejected")
+	}
+	if _, err := Load([]string{"-log-max-backups", "-1"}); err == nil {
+		t.Error("Expected a negative backup count to be rejected")
+	}
+}
+
+func TestLoadShutdown(t *testing.T) {
+	cfg, err := Load([]string{"-shutdown-timeout", "10s", "-shutdown-notice"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.ShutdownTimeout != 10*time.Second || !cfg.ShutdownNotice {
+		t.Errorf("Unexpected shutdown settings %v, %v", cfg.ShutdownTimeout, cfg.ShutdownNotice)
+	}
+
+	if _, err := Load([]string{"-shutdown-timeout", "0"}); err == nil {
+		t.Error("Expected a zero shutdown timeout to be rejected")
+	}
+}
+
+func TestLoadWatchdog(t *testing.T) {
+	cfg, err := Load([]string{"-watchdog-interval", "50ms", "-stall-threshold", "100ms"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.WatchdogInterval != 50*time.Millisecond || cfg.StallThreshold != 100*time.Millisecond {
+		t.Errorf("Unexpected watchdog settings %v, %v", cfg.WatchdogInterval, cfg.StallThreshold)
+	}
+
+	if _, err := Load([]string{"-watchdog-interval", "0"}); err != nil {
+		t.Errorf("Expected a zero interval to disable the watchdog, got %v", err)
+	}
+	if _, err := Load([]string{"-stall-threshold", "0"}); err == nil {
+		t.Error("Expected a zero stall threshold to be rejected")
+	}
+}
+
+func TestLoadReadyMaxMemory(t *testing.T) {
+	cfg, err := Load([]string{"-ready-max-memory", "1048576"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.ReadyMaxMemory != 1<<20 {
+		t.Errorf("Expected a limit of 1 MiB, got %d", cfg.ReadyMaxMemory)
+	}
+	if _, err := Load([]string{"-ready-max-memory", "-1"}); err == nil {
+		t.Error("Expected a negative limit to be rejected")
+	}
+}
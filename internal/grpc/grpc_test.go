@@ -0,0 +1,240 @@
+package grpc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"pulsedb/internal/apikeys"
+	"pulsedb/internal/store"
+	"pulsedb/internal/streams"
+)
+
+// serve runs s on a local h2c listener and returns its base URL and a
+// client speaking h2c
+func serve(t *testing.T, s *Server) (string, *http.Client) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	server := &http.Server{Handler: s, Protocols: protocols}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+	return "http://" + listener.Addr().String(), client
+}
+
+// call makes a unary call, returning the reply payload and the status
+func call(t *testing.T, client *http.Client, url, path, token string, req proto.Message) ([]byte, Code, string) {
+	t.Helper()
+
+	payload, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+	frame := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(payload)))
+	frame = append(frame, payload...)
+
+	request, _ := http.NewRequest("POST", url+path, bytes.NewReader(frame))
+	request.Header.Set("Content-Type", "application/grpc")
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("Failed to read reply: %v", err)
+	}
+	code, _ := strconv.Atoi(response.Trailer.Get("Grpc-Status"))
+	if len(body) < 5 {
+		return nil, Code(code), response.Trailer.Get("Grpc-Message")
+	}
+	return body[5:], Code(code), response.Trailer.Get("Grpc-Message")
+}
+
+func request(name string, fields map[string]protoreflect.Value) *dynamicpb.Message {
+	msg := newMessage(name)
+	for name, value := range fields {
+		setField(msg, name, value)
+	}
+	return msg
+}
+
+func reply(t *testing.T, name string, payload []byte) *dynamicpb.Message {
+	t.Helper()
+	msg := newMessage(name)
+	if err := proto.Unmarshal(payload, msg); err != nil {
+		t.Fatalf("Failed to parse %s: %v", name, err)
+	}
+	return msg
+}
+
+func str(s string) protoreflect.Value { return protoreflect.ValueOfString(s) }
+
+func TestUnaryCalls(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+	s := NewServer(db)
+	s.SetStreams(streams.NewStreamManager())
+	url, client := serve(t, s)
+
+	path := "/" + ServiceName + "/"
+	if _, code, msg := call(t, client, url, path+"Set", "", request("SetRequest", map[string]protoreflect.Value{
+		"key": str("user:1"), "value": str("alice"),
+	})); code != OK {
+		t.Fatalf("Set failed with %d: %s", code, msg)
+	}
+	call(t, client, url, path+"Set", "", request("SetRequest", map[string]protoreflect.Value{
+		"key": str("user:1"), "value": str("bob"),
+	}))
+
+	payload, code, _ := call(t, client, url, path+"Get", "", request("GetRequest", map[string]protoreflect.Value{"key": str("user:1")}))
+	get := reply(t, "GetResponse", payload)
+	if code != OK || getString(get, "value") != "bob" || !get.Get(field(get, "found")).Bool() {
+		t.Errorf("Unexpected Get reply %d %v", code, get)
+	}
+
+	payload, _, _ = call(t, client, url, path+"History", "", request("HistoryRequest", map[string]protoreflect.Value{"key": str("user:1")}))
+	history := reply(t, "HistoryResponse", payload)
+	versions := history.Get(field(history, "versions")).List()
+	if versions.Len() != 2 || versions.Get(1).Message().Get(field(versions.Get(1).Message(), "value")).String() != "alice" {
+		t.Errorf("Expected two versions newest first, got %v", history)
+	}
+	first := versions.Get(1).Message()
+	at := first.Get(field(first, "timestamp_ms")).Int()
+	payload, _, _ = call(t, client, url, path+"GetAt", "", request("GetAtRequest", map[string]protoreflect.Value{
+		"key": str("user:1"), "timestamp_ms": protoreflect.ValueOfInt64(at),
+	}))
+	if getAt := reply(t, "GetResponse", payload); getString(getAt, "value") == "" {
+		t.Errorf("Expected GetAt to find a version, got %v", getAt)
+	}
+
+	payload, _, _ = call(t, client, url, path+"Delete", "", request("DeleteRequest", map[string]protoreflect.Value{"key": str("user:1")}))
+	if deleted := reply(t, "DeleteResponse", payload); !deleted.Get(field(deleted, "deleted")).Bool() {
+		t.Errorf("Expected the key to be deleted")
+	}
+
+	add := request("StreamAddRequest", map[string]protoreflect.Value{"stream": str("events")})
+	add.Mutable(field(add, "fields")).Map().Set(str("type").MapKey(), str("login"))
+	payload, code, msg := call(t, client, url, path+"StreamAdd", "", add)
+	if code != OK {
+		t.Fatalf("StreamAdd failed with %d: %s", code, msg)
+	}
+	id := getString(reply(t, "StreamAddResponse", payload), "id")
+
+	payload, _, _ = call(t, client, url, path+"StreamRead", "", request("StreamReadRequest", map[string]protoreflect.Value{"stream": str("events")}))
+	read := reply(t, "StreamReadResponse", payload)
+	entries := read.Get(field(read, "entries")).List()
+	if entries.Len() != 1 {
+		t.Fatalf("Expected one entry, got %v", read)
+	}
+	entry := entries.Get(0).Message()
+	if entry.Get(field(entry, "id")).String() != id ||
+		entry.Get(field(entry, "fields")).Map().Get(str("type").MapKey()).String() != "login" {
+		t.Errorf("Unexpected entry %v", entry)
+	}
+
+	if _, code, _ := call(t, client, url, path+"Get", "", newMessage("GetRequest")); code != InvalidArgument {
+		t.Errorf("Expected a missing key to be rejected, got %d", code)
+	}
+	if _, code, _ := call(t, client, url, path+"StreamRead", "", request("StreamReadRequest", map[string]protoreflect.Value{"stream": str("missing")})); code != NotFound {
+		t.Errorf("Expected NotFound for a missing stream, got %d", code)
+	}
+	if _, code, _ := call(t, client, url, path+"Nope", "", newMessage("GetRequest")); code != Unimplemented {
+		t.Errorf("Expected Unimplemented for an unknown method, got %d", code)
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+	registry := apikeys.NewRegistry()
+	_, token, _ := registry.Create("billing", "billing")
+
+	s := NewServer(db)
+	s.SetAPIKeys(registry)
+	s.AllowCommands([]string{"get", "set"})
+	url, client := serve(t, s)
+	path := "/" + ServiceName + "/"
+
+	if _, code, _ := call(t, client, url, path+"Get", "", request("GetRequest", map[string]protoreflect.Value{"key": str("billing:1")})); code != Unauthenticated {
+		t.Errorf("Expected Unauthenticated without a key, got %d", code)
+	}
+	if _, code, msg := call(t, client, url, path+"Get", token, request("GetRequest", map[string]protoreflect.Value{"key": str("billing:1")})); code != OK {
+		t.Errorf("Expected a key of the namespace to be allowed, got %d: %s", code, msg)
+	}
+	if _, code, _ := call(t, client, url, path+"Get", token, request("GetRequest", map[string]protoreflect.Value{"key": str("other:1")})); code != PermissionDenied {
+		t.Errorf("Expected a key outside the namespace to be denied, got %d", code)
+	}
+	if _, code, _ := call(t, client, url, path+"Delete", token, request("DeleteRequest", map[string]protoreflect.Value{"key": str("billing:1")})); code != PermissionDenied {
+		t.Errorf("Expected a command outside the whitelist to be denied, got %d", code)
+	}
+}
+
+func TestReflection(t *testing.T) {
+	s := NewServer(store.NewStore())
+	url, client := serve(t, s)
+
+	var listServices []byte
+	listServices = protowire.AppendTag(listServices, reflectListServices, protowire.BytesType)
+	listServices = protowire.AppendString(listServices, "")
+	var bySymbol []byte
+	bySymbol = protowire.AppendTag(bySymbol, reflectFileContainingSymbol, protowire.BytesType)
+	bySymbol = protowire.AppendString(bySymbol, ServiceName+".Get")
+
+	var frames []byte
+	for _, payload := range [][]byte{listServices, bySymbol} {
+		frame := make([]byte, 5)
+		binary.BigEndian.PutUint32(frame[1:], uint32(len(payload)))
+		frames = append(append(frames, frame...), payload...)
+	}
+
+	req, _ := http.NewRequest("POST", url+reflectionV1, bytes.NewReader(frames))
+	req.Header.Set("Content-Type", "application/grpc")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var replies [][]byte
+	for {
+		payload, err := readMessage(resp.Body)
+		if err != nil {
+			break
+		}
+		replies = append(replies, payload)
+	}
+	if len(replies) != 2 {
+		t.Fatalf("Expected 2 replies, got %d", len(replies))
+	}
+	if !bytes.Contains(replies[0], []byte(ServiceName)) {
+		t.Errorf("Expected the service to be listed, got %q", replies[0])
+	}
+	if !bytes.Contains(replies[1], schemaBytes) {
+		t.Errorf("Expected the schema for %s.Get", ServiceName)
+	}
+	if resp.Trailer.Get("Grpc-Status") != "0" {
+		t.Errorf("Expected the stream to end with OK, got %q", resp.Trailer.Get("Grpc-Status"))
+	}
+}
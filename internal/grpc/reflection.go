@@ -0,0 +1,191 @@
+package grpc
+
+import (
+	"io"
+	"net/http"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Server reflection lets tools such as grpcurl discover the service
+// without pulsedb.proto. Both versions of the protocol carry the same
+// messages, which are small enough to encode by hand.
+const (
+	reflectionV1      = "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo"
+	reflectionV1Alpha = "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo"
+)
+
+// Field numbers of ServerReflectionRequest
+const (
+	reflectFileByFilename       = 3
+	reflectFileContainingSymbol = 4
+	reflectFileContainingExt    = 5
+	reflectAllExtensionNumbers  = 6
+	reflectListServices         = 7
+)
+
+// Field numbers of ServerReflectionResponse
+const (
+	reflectValidHost          = 1
+	reflectOriginalRequest    = 2
+	reflectFileDescriptorResp = 4
+	reflectAllExtensionsResp  = 5
+	reflectListServicesResp   = 6
+	reflectErrorResp          = 7
+)
+
+// schemaFiles resolves the symbols of the schema for reflection
+var schemaFiles = func() *protoregistry.Files {
+	files := new(protoregistry.Files)
+	if err := files.RegisterFile(schema); err != nil {
+		panic("grpc: invalid schema: " + err.Error())
+	}
+	return files
+}()
+
+// serveReflection answers the requests of a reflection stream until the
+// client ends it or the server shuts down
+func (s *Server) serveReflection(w http.ResponseWriter, r *http.Request, body io.Reader) error {
+	// Reads block, so they run aside to let shutdown end the stream
+	requests := make(chan []byte)
+	failed := make(chan error, 1)
+	go func() {
+		for {
+			payload, err := readMessage(body)
+			if err != nil {
+				failed <- err
+				return
+			}
+			select {
+			case requests <- payload:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}()
+
+	// Send the headers right away: clients wait for them before the first request
+	if err := http.NewResponseController(w).Flush(); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case payload := <-requests:
+			if err := writeFrame(w, reflect(payload)); err != nil {
+				return err
+			}
+		case err := <-failed:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case <-r.Context().Done():
+			return statusf(Canceled, "stream canceled")
+		case <-s.done:
+			return statusf(Unavailable, "server shutting down")
+		}
+	}
+}
+
+// reflect builds the ServerReflectionResponse to a ServerReflectionRequest
+func reflect(request []byte) []byte {
+	original := request
+	var host string
+	var response []byte
+	for len(request) > 0 {
+		num, typ, n := protowire.ConsumeTag(request)
+		if n < 0 {
+			response = reflectError(InvalidArgument, "malformed request")
+			break
+		}
+		request = request[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, request)
+			if n < 0 {
+				response = reflectError(InvalidArgument, "malformed request")
+				break
+			}
+			request = request[n:]
+			continue
+		}
+		value, n := protowire.ConsumeBytes(request)
+		if n < 0 {
+			response = reflectError(InvalidArgument, "malformed request")
+			break
+		}
+		request = request[n:]
+
+		switch num {
+		case 1:
+			host = string(value)
+		case reflectFileByFilename:
+			if string(value) == FileName {
+				response = reflectFile()
+			} else {
+				response = reflectError(NotFound, "file not found: "+string(value))
+			}
+		case reflectFileContainingSymbol:
+			if _, err := schemaFiles.FindDescriptorByName(protoreflect.FullName(value)); err == nil {
+				response = reflectFile()
+			} else {
+				response = reflectError(NotFound, "symbol not found: "+string(value))
+			}
+		case reflectFileContainingExt:
+			response = reflectError(NotFound, "the schema declares no extensions")
+		case reflectAllExtensionNumbers:
+			if _, err := schemaFiles.FindDescriptorByName(protoreflect.FullName(value)); err == nil {
+				var numbers []byte
+				numbers = protowire.AppendTag(numbers, 1, protowire.BytesType)
+				numbers = protowire.AppendString(numbers, string(value))
+				response = appendMessage(nil, reflectAllExtensionsResp, numbers)
+			} else {
+				response = reflectError(NotFound, "type not found: "+string(value))
+			}
+		case reflectListServices:
+			var services []byte
+			for _, name := range []string{ServiceName, "grpc.reflection.v1.ServerReflection"} {
+				var service []byte
+				service = protowire.AppendTag(service, 1, protowire.BytesType)
+				service = protowire.AppendString(service, name)
+				services = appendMessage(services, 1, service)
+			}
+			response = appendMessage(nil, reflectListServicesResp, services)
+		}
+	}
+	if response == nil {
+		response = reflectError(Unimplemented, "unsupported reflection request")
+	}
+
+	var out []byte
+	out = protowire.AppendTag(out, reflectValidHost, protowire.BytesType)
+	out = protowire.AppendString(out, host)
+	out = appendMessage(out, reflectOriginalRequest, original)
+	return append(out, response...)
+}
+
+// reflectFile is a FileDescriptorResponse holding the schema
+func reflectFile() []byte {
+	var files []byte
+	files = protowire.AppendTag(files, 1, protowire.BytesType)
+	files = protowire.AppendBytes(files, schemaBytes)
+	return appendMessage(nil, reflectFileDescriptorResp, files)
+}
+
+// reflectError is an ErrorResponse with a gRPC status code
+func reflectError(code Code, message string) []byte {
+	var e []byte
+	e = protowire.AppendTag(e, 1, protowire.VarintType)
+	e = protowire.AppendVarint(e, uint64(code))
+	e = protowire.AppendTag(e, 2, protowire.BytesType)
+	e = protowire.AppendString(e, message)
+	return appendMessage(nil, reflectErrorResp, e)
+}
+
+// appendMessage appends an embedded message field
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
@@ -0,0 +1,184 @@
+package grpc
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// The service is described in code rather than generated from a .proto
+// file, so the server needs no protoc step. pulsedb.proto is the same
+// schema for clients generating stubs; the two must be kept in sync.
+
+const (
+	// FileName is the proto file the schema is served as by reflection
+	FileName = "pulsedb/v1/pulsedb.proto"
+
+	// ServiceName is the full name of the PulseDB service
+	ServiceName = "pulsedb.v1.PulseDB"
+)
+
+// schema is the descriptor of pulsedb.proto, and schemaBytes the same
+// serialized as a FileDescriptorProto for reflection
+var schema, schemaBytes = buildSchema()
+
+func buildSchema() (protoreflect.FileDescriptor, []byte) {
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String(FileName),
+		Package: proto.String("pulsedb.v1"),
+		Syntax:  proto.String("proto3"),
+		Options: &descriptorpb.FileOptions{GoPackage: proto.String("pulsedb/internal/grpc")},
+		MessageType: []*descriptorpb.DescriptorProto{
+			message("GetRequest",
+				scalar("key", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+			),
+			message("GetAtRequest",
+				scalar("key", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				scalar("timestamp_ms", 2, descriptorpb.FieldDescriptorProto_TYPE_INT64),
+			),
+			message("GetResponse",
+				scalar("value", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				scalar("found", 2, descriptorpb.FieldDescriptorProto_TYPE_BOOL),
+			),
+			message("SetRequest",
+				scalar("key", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				scalar("value", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				scalar("ttl_ms", 3, descriptorpb.FieldDescriptorProto_TYPE_INT64),
+			),
+			message("SetResponse"),
+			message("DeleteRequest",
+				scalar("key", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+			),
+			message("DeleteResponse",
+				scalar("deleted", 1, descriptorpb.FieldDescriptorProto_TYPE_BOOL),
+			),
+			message("HistoryRequest",
+				scalar("key", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				scalar("start_ms", 2, descriptorpb.FieldDescriptorProto_TYPE_INT64),
+				scalar("end_ms", 3, descriptorpb.FieldDescriptorProto_TYPE_INT64),
+				scalar("cursor", 4, descriptorpb.FieldDescriptorProto_TYPE_UINT64),
+				scalar("limit", 5, descriptorpb.FieldDescriptorProto_TYPE_INT32),
+			),
+			message("Version",
+				scalar("timestamp_ms", 1, descriptorpb.FieldDescriptorProto_TYPE_INT64),
+				scalar("value", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				scalar("ttl_ms", 3, descriptorpb.FieldDescriptorProto_TYPE_INT64),
+				scalar("hlc", 4, descriptorpb.FieldDescriptorProto_TYPE_UINT64),
+				scalar("deleted", 5, descriptorpb.FieldDescriptorProto_TYPE_BOOL),
+			),
+			message("HistoryResponse",
+				repeated("versions", 1, ".pulsedb.v1.Version"),
+				scalar("cursor", 2, descriptorpb.FieldDescriptorProto_TYPE_UINT64),
+			),
+			withMap(message("StreamAddRequest",
+				scalar("stream", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				scalar("uuid", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+			), "StreamAddRequest", "fields", 2),
+			message("StreamAddResponse",
+				scalar("id", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+			),
+			message("StreamReadRequest",
+				scalar("stream", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				scalar("after", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				scalar("count", 3, descriptorpb.FieldDescriptorProto_TYPE_INT32),
+			),
+			withMap(message("StreamEntry",
+				scalar("id", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				scalar("timestamp_ms", 2, descriptorpb.FieldDescriptorProto_TYPE_INT64),
+				scalar("uuid", 4, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+			), "StreamEntry", "fields", 3),
+			message("StreamReadResponse",
+				repeated("entries", 1, ".pulsedb.v1.StreamEntry"),
+			),
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("PulseDB"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				rpc("Get", "GetRequest", "GetResponse"),
+				rpc("Set", "SetRequest", "SetResponse"),
+				rpc("Delete", "DeleteRequest", "DeleteResponse"),
+				rpc("GetAt", "GetAtRequest", "GetResponse"),
+				rpc("History", "HistoryRequest", "HistoryResponse"),
+				rpc("StreamAdd", "StreamAddRequest", "StreamAddResponse"),
+				rpc("StreamRead", "StreamReadRequest", "StreamReadResponse"),
+			},
+		}},
+	}
+
+	descriptor, err := protodesc.NewFile(file, protoregistry.GlobalFiles)
+	if err != nil {
+		panic("grpc: invalid schema: " + err.Error())
+	}
+	serialized, err := proto.Marshal(file)
+	if err != nil {
+		panic("grpc: invalid schema: " + err.Error())
+	}
+	return descriptor, serialized
+}
+
+func message(name string, fields ...*descriptorpb.FieldDescriptorProto) *descriptorpb.DescriptorProto {
+	return &descriptorpb.DescriptorProto{Name: proto.String(name), Field: fields}
+}
+
+func scalar(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+	return &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		JsonName: proto.String(jsonName(name)),
+		Number:   proto.Int32(number),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Type:     typ.Enum(),
+	}
+}
+
+func repeated(name string, number int32, typeName string) *descriptorpb.FieldDescriptorProto {
+	field := scalar(name, number, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE)
+	field.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	field.TypeName = proto.String(typeName)
+	return field
+}
+
+// withMap adds a map<string, string> field to msg, declared as protoc does:
+// a repeated field of a nested <Name>Entry message
+func withMap(msg *descriptorpb.DescriptorProto, parent, name string, number int32) *descriptorpb.DescriptorProto {
+	entry := jsonName("_"+name) + "Entry"
+	msg.NestedType = append(msg.NestedType, &descriptorpb.DescriptorProto{
+		Name: proto.String(entry),
+		Field: []*descriptorpb.FieldDescriptorProto{
+			scalar("key", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+			scalar("value", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+		},
+		Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+	})
+	msg.Field = append(msg.Field, repeated(name, number, ".pulsedb.v1."+parent+"."+entry))
+	return msg
+}
+
+func rpc(name, input, output string) *descriptorpb.MethodDescriptorProto {
+	return &descriptorpb.MethodDescriptorProto{
+		Name:       proto.String(name),
+		InputType:  proto.String(".pulsedb.v1." + input),
+		OutputType: proto.String(".pulsedb.v1." + output),
+	}
+}
+
+// jsonName converts a snake_case field name to lowerCamelCase, as protoc does
+func jsonName(name string) string {
+	var out []byte
+	upper := false
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '_':
+			upper = true
+		case upper && 'a' <= c && c <= 'z':
+			out = append(out, c-'a'+'A')
+			upper = false
+		default:
+			out = append(out, c)
+			upper = false
+		}
+	}
+	return string(out)
+}
@@ -0,0 +1,337 @@
+// Package grpc serves the PulseDB gRPC API: the gRPC protocol over
+// cleartext HTTP/2 (h2c), with unary calls and server reflection. It is
+// built on net/http and dynamic protobuf messages instead of the gRPC
+// library, which PulseDB does not depend on.
+package grpc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"pulsedb/internal/apikeys"
+	"pulsedb/internal/store"
+	"pulsedb/internal/streams"
+	"pulsedb/internal/throttle"
+)
+
+// MaxMessageSize bounds the size of a request message, like the 4 MiB
+// default of the gRPC libraries
+const MaxMessageSize = 4 << 20
+
+// Code is a gRPC status code
+type Code int
+
+const (
+	OK                 Code = 0
+	Canceled           Code = 1
+	Unknown            Code = 2
+	InvalidArgument    Code = 3
+	NotFound           Code = 5
+	PermissionDenied   Code = 7
+	ResourceExhausted  Code = 8
+	FailedPrecondition Code = 9
+	Unimplemented      Code = 12
+	Internal           Code = 13
+	Unavailable        Code = 14
+	Unauthenticated    Code = 16
+)
+
+// Status is an error carrying the status a call ends with
+type Status struct {
+	Code    Code
+	Message string
+}
+
+func (s *Status) Error() string {
+	return fmt.Sprintf("grpc status %d: %s", s.Code, s.Message)
+}
+
+func statusf(code Code, format string, args ...interface{}) *Status {
+	return &Status{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Server serves the PulseDB service
+type Server struct {
+	store   *store.Store
+	streams *streams.StreamManager // Nil disables the stream methods
+	server  *http.Server
+	allowed map[string]bool // Commands exposed, nil means all
+
+	apiKeys   *apikeys.Registry // Keys calls must carry, nil if not required
+	accessLog *slog.Logger      // Logs every call, nil if disabled
+
+	drainTimeout time.Duration // How long shutdown waits for calls in flight
+	done         chan struct{} // Closed on shutdown, ending reflection streams
+}
+
+// NewServer creates a gRPC server for store
+func NewServer(store *store.Store) *Server {
+	return &Server{
+		store:        store,
+		drainTimeout: 5 * time.Second,
+		done:         make(chan struct{}),
+	}
+}
+
+// SetStreams sets the streams served by StreamAdd and StreamRead
+func (s *Server) SetStreams(streams *streams.StreamManager) {
+	s.streams = streams
+}
+
+// AllowCommands restricts the service to the methods backed by the given
+// command names, as listed in methods. An empty list exposes everything.
+func (s *Server) AllowCommands(names []string) {
+	if len(names) == 0 {
+		s.allowed = nil
+		return
+	}
+
+	s.allowed = make(map[string]bool, len(names))
+	for _, name := range names {
+		s.allowed[strings.ToUpper(name)] = true
+	}
+}
+
+// SetAPIKeys requires every call to carry a key of registry as
+// "authorization: Bearer <token>" metadata; nil disables the check
+func (s *Server) SetAPIKeys(registry *apikeys.Registry) {
+	s.apiKeys = registry
+}
+
+// SetAccessLog logs every call to logger with its client, latency and
+// status; nil disables the access log
+func (s *Server) SetAccessLog(logger *slog.Logger) {
+	s.accessLog = logger
+}
+
+// SetDrainTimeout sets how long shutdown waits for calls in flight before
+// closing their connections
+func (s *Server) SetDrainTimeout(timeout time.Duration) {
+	s.drainTimeout = timeout
+}
+
+// Start serves gRPC on addr until ctx is cancelled
+func (s *Server) Start(ctx context.Context, addr string) error {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true) // Only to tell HTTP/1 clients they need HTTP/2
+	protocols.SetUnencryptedHTTP2(true)
+
+	s.server = &http.Server{
+		Addr:      addr,
+		Handler:   s,
+		Protocols: protocols,
+	}
+	s.server.RegisterOnShutdown(func() { close(s.done) })
+
+	go func() {
+		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("gRPC server error", "error", err)
+		}
+	}()
+
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.drainTimeout)
+	defer cancel()
+	return s.server.Shutdown(shutdownCtx)
+}
+
+// ServeHTTP handles one call
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 {
+		http.Error(w, "gRPC requires HTTP/2", http.StatusHTTPVersionNotSupported)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if contentType := r.Header.Get("Content-Type"); contentType != "application/grpc" && !strings.HasPrefix(contentType, "application/grpc+proto") {
+		http.Error(w, "Unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	start := time.Now()
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Accept-Encoding", "identity")
+
+	body := &countingReader{reader: r.Body}
+	counter := &countingWriter{ResponseWriter: w}
+	key, err := s.authenticate(r)
+	if err == nil {
+		err = s.serve(counter, r, body, key)
+	}
+
+	status := &Status{Code: OK}
+	if err != nil && !errors.As(err, &status) {
+		status = &Status{Code: Internal, Message: err.Error()}
+	}
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(int(status.Code)))
+	if status.Message != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", encodeMessage(status.Message))
+	}
+
+	if key != nil {
+		s.apiKeys.Record(key.ID, int64(len(r.URL.Path))+body.n, counter.n)
+	}
+	if s.accessLog != nil {
+		s.accessLog.Info("call",
+			"client", r.RemoteAddr,
+			"method", r.URL.Path,
+			"status", int(status.Code),
+			"latency", time.Since(start),
+		)
+	}
+}
+
+// authenticate returns the API key of r, nil if keys are not required
+func (s *Server) authenticate(r *http.Request) (*apikeys.Key, error) {
+	if s.apiKeys == nil {
+		return nil, nil
+	}
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	key, err := s.apiKeys.Authenticate(token)
+	if err != nil {
+		return nil, statusf(Unauthenticated, "a valid API key is required")
+	}
+	return &key, nil
+}
+
+// serve dispatches a call to its method
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, body io.Reader, key *apikeys.Key) error {
+	if r.URL.Path == reflectionV1 || r.URL.Path == reflectionV1Alpha {
+		if key != nil && key.Namespace != "" {
+			return statusf(PermissionDenied, "this API key can only access keys in namespace '%s'", key.Namespace)
+		}
+		return s.serveReflection(w, r, body)
+	}
+
+	m, exists := methods[r.URL.Path]
+	if !exists {
+		return statusf(Unimplemented, "unknown method %s", r.URL.Path)
+	}
+	if s.allowed != nil && !s.allowed[m.command] {
+		return statusf(PermissionDenied, "command %s is not allowed on this listener", m.command)
+	}
+
+	payload, err := readMessage(body)
+	if err == io.EOF {
+		return statusf(Internal, "request message missing")
+	}
+	if err != nil {
+		return err
+	}
+	req := m.newRequest()
+	if err := proto.Unmarshal(payload, req); err != nil {
+		return statusf(Internal, "cannot parse request: %v", err)
+	}
+	if key != nil && key.Namespace != "" {
+		if m.key == "" || !key.Permits(throttle.Namespace(getString(req, m.key))) {
+			return statusf(PermissionDenied, "this API key can only access keys in namespace '%s'", key.Namespace)
+		}
+	}
+
+	// Calls run wholly before or after a script, like RESP commands
+	release := s.store.Shared()
+	resp, err := m.handle(s, req)
+	release()
+	if err != nil {
+		return err
+	}
+	return writeMessage(w, resp)
+}
+
+// readMessage reads one length-prefixed message of a call
+func readMessage(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, statusf(Internal, "truncated message")
+		}
+		return nil, err
+	}
+	if prefix[0] != 0 {
+		return nil, statusf(Unimplemented, "compressed messages are not supported")
+	}
+	length := binary.BigEndian.Uint32(prefix[1:])
+	if length > MaxMessageSize {
+		return nil, statusf(ResourceExhausted, "message of %d bytes exceeds the limit of %d", length, MaxMessageSize)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, statusf(Internal, "truncated message")
+	}
+	return payload, nil
+}
+
+// writeMessage writes msg length-prefixed and flushes it to the client
+func writeMessage(w http.ResponseWriter, msg proto.Message) error {
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return writeFrame(w, payload)
+}
+
+func writeFrame(w http.ResponseWriter, payload []byte) error {
+	frame := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(payload)))
+	frame = append(frame, payload...)
+	if _, err := w.Write(frame); err != nil {
+		return err
+	}
+	return http.NewResponseController(w).Flush()
+}
+
+// encodeMessage percent-encodes a status message for the grpc-message
+// trailer, which must be printable ASCII
+func encodeMessage(message string) string {
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+		if c < 0x20 || c > 0x7E || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// countingReader counts the bytes read from a call
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingWriter counts the bytes of a reply
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
@@ -0,0 +1,249 @@
+package grpc
+
+import (
+	"math"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"pulsedb/internal/store"
+	"pulsedb/internal/streams"
+)
+
+// method is an RPC of the PulseDB service
+type method struct {
+	command string // Gates the method in AllowCommands, as on the HTTP API
+	key     string // Request field checked against namespaced API keys, "" to refuse them
+	input   protoreflect.MessageDescriptor
+	handle  func(s *Server, req *dynamicpb.Message) (proto.Message, error)
+}
+
+func (m *method) newRequest() *dynamicpb.Message {
+	return dynamicpb.NewMessage(m.input)
+}
+
+// methods are the RPCs by HTTP/2 path
+var methods = map[string]*method{
+	"/" + ServiceName + "/Get":        {command: "GET", key: "key", input: messageType("GetRequest"), handle: (*Server).get},
+	"/" + ServiceName + "/Set":        {command: "SET", key: "key", input: messageType("SetRequest"), handle: (*Server).set},
+	"/" + ServiceName + "/Delete":     {command: "DEL", key: "key", input: messageType("DeleteRequest"), handle: (*Server).delete},
+	"/" + ServiceName + "/GetAt":      {command: "GETAT", key: "key", input: messageType("GetAtRequest"), handle: (*Server).getAt},
+	"/" + ServiceName + "/History":    {command: "HISTSCAN", key: "key", input: messageType("HistoryRequest"), handle: (*Server).history},
+	"/" + ServiceName + "/StreamAdd":  {command: "XADD", input: messageType("StreamAddRequest"), handle: (*Server).streamAdd},
+	"/" + ServiceName + "/StreamRead": {command: "XRANGE", input: messageType("StreamReadRequest"), handle: (*Server).streamRead},
+}
+
+func (s *Server) get(req *dynamicpb.Message) (proto.Message, error) {
+	key, err := requireKey(req)
+	if err != nil {
+		return nil, err
+	}
+	value, found, err := s.store.Get(key)
+	if err != nil {
+		return nil, statusf(FailedPrecondition, "%v", err)
+	}
+	return valueResponse(value, found), nil
+}
+
+func (s *Server) getAt(req *dynamicpb.Message) (proto.Message, error) {
+	key, err := requireKey(req)
+	if err != nil {
+		return nil, err
+	}
+	value, found, err := s.store.GetAt(key, getInt(req, "timestamp_ms"))
+	if err != nil {
+		return nil, statusf(FailedPrecondition, "%v", err)
+	}
+	return valueResponse(value, found), nil
+}
+
+func valueResponse(value string, found bool) proto.Message {
+	resp := newMessage("GetResponse")
+	setField(resp, "value", protoreflect.ValueOfString(value))
+	setField(resp, "found", protoreflect.ValueOfBool(found))
+	return resp
+}
+
+func (s *Server) set(req *dynamicpb.Message) (proto.Message, error) {
+	key, err := requireKey(req)
+	if err != nil {
+		return nil, err
+	}
+	ttl := getInt(req, "ttl_ms")
+	if ttl < 0 {
+		return nil, statusf(InvalidArgument, "ttl_ms must not be negative")
+	}
+	if s.store.ReadOnly() {
+		return nil, statusf(FailedPrecondition, "the server is in read-only mode")
+	}
+	if err := s.store.Set(key, getString(req, "value"), ttl); err != nil {
+		return nil, statusf(InvalidArgument, "%v", err)
+	}
+	return newMessage("SetResponse"), nil
+}
+
+func (s *Server) delete(req *dynamicpb.Message) (proto.Message, error) {
+	key, err := requireKey(req)
+	if err != nil {
+		return nil, err
+	}
+	if s.store.ReadOnly() {
+		return nil, statusf(FailedPrecondition, "the server is in read-only mode")
+	}
+	resp := newMessage("DeleteResponse")
+	setField(resp, "deleted", protoreflect.ValueOfBool(s.store.Delete(key)))
+	return resp, nil
+}
+
+// history pages through the versions of a key newest first, like HISTSCAN:
+// unset start_ms and end_ms leave the range open, and the returned cursor,
+// 0 once done, resumes after the last version
+func (s *Server) history(req *dynamicpb.Message) (proto.Message, error) {
+	key, err := requireKey(req)
+	if err != nil {
+		return nil, err
+	}
+	start, end := getInt(req, "start_ms"), getInt(req, "end_ms")
+	if start == 0 {
+		start = math.MinInt64
+	}
+	if end == 0 {
+		end = math.MaxInt64
+	}
+	limit := int(getInt(req, "limit"))
+	if limit < 0 {
+		return nil, statusf(InvalidArgument, "limit must not be negative")
+	}
+	if limit == 0 {
+		limit = 100
+	}
+
+	versions, next := s.store.HistoryScan(key, start, end, store.HLC(getUint(req, "cursor")), limit)
+
+	now := time.Now().UnixMilli()
+	resp := newMessage("HistoryResponse")
+	list := resp.Mutable(field(resp, "versions")).List()
+	for _, version := range versions {
+		ttl := int64(-1)
+		if version.TTL > 0 {
+			ttl = max(version.TTL-now, 0)
+		}
+		element := list.NewElement()
+		msg := element.Message()
+		msg.Set(field(msg, "timestamp_ms"), protoreflect.ValueOfInt64(version.Timestamp))
+		msg.Set(field(msg, "value"), protoreflect.ValueOfString(version.Data))
+		msg.Set(field(msg, "ttl_ms"), protoreflect.ValueOfInt64(ttl))
+		msg.Set(field(msg, "hlc"), protoreflect.ValueOfUint64(uint64(version.HLC)))
+		msg.Set(field(msg, "deleted"), protoreflect.ValueOfBool(version.Deleted))
+		list.Append(element)
+	}
+	setField(resp, "cursor", protoreflect.ValueOfUint64(uint64(next)))
+	return resp, nil
+}
+
+func (s *Server) streamAdd(req *dynamicpb.Message) (proto.Message, error) {
+	if s.streams == nil {
+		return nil, statusf(Unimplemented, "streams are not enabled")
+	}
+	name := getString(req, "stream")
+	if name == "" {
+		return nil, statusf(InvalidArgument, "stream is required")
+	}
+	fields := make(map[string]string)
+	req.Get(field(req, "fields")).Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+		fields[k.String()] = v.String()
+		return true
+	})
+	if len(fields) == 0 {
+		return nil, statusf(InvalidArgument, "an entry needs at least one field")
+	}
+
+	id, err := s.streams.AddEntry(name, fields, getString(req, "uuid"))
+	if err != nil {
+		return nil, statusf(InvalidArgument, "%v", err)
+	}
+	resp := newMessage("StreamAddResponse")
+	setField(resp, "id", protoreflect.ValueOfString(id))
+	return resp, nil
+}
+
+// streamRead returns up to count entries after an ID, oldest first; an
+// unset after starts at the first entry
+func (s *Server) streamRead(req *dynamicpb.Message) (proto.Message, error) {
+	if s.streams == nil {
+		return nil, statusf(Unimplemented, "streams are not enabled")
+	}
+	after := getString(req, "after")
+	if after != "" && !streams.ValidID(after) {
+		return nil, statusf(InvalidArgument, "invalid entry ID %q", after)
+	}
+	count := int(getInt(req, "count"))
+	if count < 0 {
+		return nil, statusf(InvalidArgument, "count must not be negative")
+	}
+	if count == 0 {
+		count = 100
+	}
+
+	name := getString(req, "stream")
+	entries, err := s.streams.EntriesAfter(name, after, count)
+	if err != nil {
+		return nil, statusf(NotFound, "stream %s does not exist", name)
+	}
+
+	resp := newMessage("StreamReadResponse")
+	list := resp.Mutable(field(resp, "entries")).List()
+	for _, entry := range entries {
+		element := list.NewElement()
+		msg := element.Message()
+		msg.Set(field(msg, "id"), protoreflect.ValueOfString(entry.ID))
+		msg.Set(field(msg, "timestamp_ms"), protoreflect.ValueOfInt64(entry.Timestamp))
+		msg.Set(field(msg, "uuid"), protoreflect.ValueOfString(entry.UUID))
+		fields := msg.Mutable(field(msg, "fields")).Map()
+		for k, v := range entry.Fields {
+			fields.Set(protoreflect.ValueOfString(k).MapKey(), protoreflect.ValueOfString(v))
+		}
+		list.Append(element)
+	}
+	return resp, nil
+}
+
+// requireKey returns the key field of req, which must be set
+func requireKey(req *dynamicpb.Message) (string, error) {
+	key := getString(req, "key")
+	if key == "" {
+		return "", statusf(InvalidArgument, "key is required")
+	}
+	return key, nil
+}
+
+// messageType returns the descriptor of a message of the schema
+func messageType(name string) protoreflect.MessageDescriptor {
+	return schema.Messages().ByName(protoreflect.Name(name))
+}
+
+func newMessage(name string) *dynamicpb.Message {
+	return dynamicpb.NewMessage(messageType(name))
+}
+
+func field(msg protoreflect.Message, name string) protoreflect.FieldDescriptor {
+	return msg.Descriptor().Fields().ByName(protoreflect.Name(name))
+}
+
+func setField(msg *dynamicpb.Message, name string, value protoreflect.Value) {
+	msg.Set(field(msg, name), value)
+}
+
+func getString(msg *dynamicpb.Message, name string) string {
+	return msg.Get(field(msg, name)).String()
+}
+
+func getInt(msg *dynamicpb.Message, name string) int64 {
+	return msg.Get(field(msg, name)).Int()
+}
+
+func getUint(msg *dynamicpb.Message, name string) uint64 {
+	return msg.Get(field(msg, name)).Uint()
+}
@@ -0,0 +1,247 @@
+package http
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"pulsedb/internal/apikeys"
+	"pulsedb/internal/throttle"
+)
+
+// With API keys enabled, every request but the /healthz and /readyz probes
+// and /metrics carries "Authorization: Bearer <token>" and is metered
+// against its key. Keys are managed under /admin/, authorized by the admin
+// token instead.
+
+type CreateKeyRequest struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+type KeyTokenResponse struct {
+	Key   apikeys.Key `json:"key"`
+	Token string      `json:"token"` // Only returned on creation and rotation
+}
+
+// SetAPIKeys requires every request to carry a key from registry and serves
+// the key administration endpoints to requests carrying adminToken. Several
+// listeners can share a registry.
+func (h *HTTPServer) SetAPIKeys(registry *apikeys.Registry, adminToken string) {
+	h.apiKeys = registry
+	h.adminToken = adminToken
+}
+
+// apiKeyContext is the context key of the API key a request authenticated
+// with, for endpoints checking it against keys named in the body
+type apiKeyContext struct{}
+
+// requestKey returns the API key r authenticated with, false without API
+// keys
+func requestKey(r *http.Request) (apikeys.Key, bool) {
+	key, ok := r.Context().Value(apiKeyContext{}).(apikeys.Key)
+	return key, ok
+}
+
+// bearerToken returns the token of the Authorization header, "" if none
+func bearerToken(r *http.Request) string {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// authenticate wraps the API so requests need an API key, which is charged
+// for the request and response bytes
+func (h *HTTPServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.apiKeys == nil || r.URL.Path == "/healthz" || r.URL.Path == "/readyz" || r.URL.Path == "/metrics" || strings.HasPrefix(r.URL.Path, "/admin/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, err := h.apiKeys.Authenticate(bearerToken(r))
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, r, http.StatusUnauthorized, "A valid API key is required")
+			return
+		}
+		if key.Namespace != "" && !h.permitsNamespace(key, r) {
+			writeError(w, r, http.StatusForbidden, "This API key can only access keys in namespace '"+key.Namespace+"'")
+			return
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), apiKeyContext{}, key))
+		body := &countingReader{ReadCloser: r.Body}
+		r.Body = body
+		counter := &countingWriter{ResponseWriter: w}
+		next.ServeHTTP(counter, r)
+		h.apiKeys.Record(key.ID, int64(len(r.URL.RequestURI()))+body.n, counter.n)
+	})
+}
+
+// permitsNamespace reports whether a key restricted to a namespace may
+// make request r: only the key endpoints on keys of its namespace, batches,
+// whose keys are checked one by one, and subscriptions and changefeeds of
+// patterns that cannot match keys outside it
+func (h *HTTPServer) permitsNamespace(key apikeys.Key, r *http.Request) bool {
+	path := r.URL.Path
+	if path == "/v1/batch" {
+		return true
+	}
+	if path == "/ws/subscribe" {
+		return permitsPattern(key, r.URL.Query().Get("pattern"))
+	}
+	if path == "/v1/changes" {
+		return permitsPattern(key, r.URL.Query().Get("match"))
+	}
+	if path == "/capabilities" {
+		return true
+	}
+	if name, found := strings.CutPrefix(path, "/kv/"); found {
+		return key.Permits(throttle.Namespace(strings.TrimSuffix(name, "/history")))
+	}
+	if name, found := strings.CutPrefix(path, "/v1/keys/"); found {
+		return key.Permits(throttle.Namespace(strings.TrimSuffix(name, "/ttl")))
+	}
+	return false
+}
+
+// permitsPattern reports whether pattern only matches keys in the
+// namespace of key
+func permitsPattern(key apikeys.Key, pattern string) bool {
+	namespace, _, found := strings.Cut(pattern, ":")
+	return found && !strings.ContainsAny(namespace, "*?[\\") && key.Permits(namespace)
+}
+
+// adminAuthorized reports whether r carries the admin token, writing an
+// error response if not
+func (h *HTTPServer) adminAuthorized(w http.ResponseWriter, r *http.Request) bool {
+	if h.apiKeys == nil || h.adminToken == "" {
+		http.Error(w, "API keys are not enabled", http.StatusNotFound)
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(bearerToken(r)), []byte(h.adminToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "The admin token is required", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// handleAPIKeys creates a key on POST and lists the keys on GET
+func (h *HTTPServer) handleAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if !h.adminAuthorized(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.apiKeys.List())
+	case "POST":
+		var req CreateKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		key, token, err := h.apiKeys.Create(req.Name, req.Namespace)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/admin/keys/"+key.ID)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(KeyTokenResponse{Key: key, Token: token})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAPIKey serves a single key:
+//
+//	GET    /admin/keys/{id}         the key
+//	POST   /admin/keys/{id}/rotate  replace its token
+//	DELETE /admin/keys/{id}         revoke it
+func (h *HTTPServer) handleAPIKey(w http.ResponseWriter, r *http.Request) {
+	if !h.adminAuthorized(w, r) {
+		return
+	}
+
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/admin/keys/"), "/")
+	key, exists := h.apiKeys.Get(id)
+	if !exists {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == "GET":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(key)
+	case action == "" && r.Method == "DELETE":
+		key, _ = h.apiKeys.Revoke(id)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(key)
+	case action == "rotate" && r.Method == "POST":
+		key, token, err := h.apiKeys.Rotate(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(KeyTokenResponse{Key: key, Token: token})
+	case action == "" || action == "rotate":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleAPIKeyUsage reports the metered usage of every key
+func (h *HTTPServer) handleAPIKeyUsage(w http.ResponseWriter, r *http.Request) {
+	if !h.adminAuthorized(w, r) {
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.apiKeys.Usage(h.store.NamespaceBytes))
+}
+
+// countingReader counts the bytes read from a request body
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingWriter counts the bytes of a response body
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the connection, see upgradeWebSocket
+func (c *countingWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
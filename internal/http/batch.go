@@ -0,0 +1,146 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"pulsedb/internal/throttle"
+)
+
+// MaxBatchOperations is the most operations a batch may hold
+const MaxBatchOperations = 1000
+
+type BatchOperation struct {
+	Op    string `json:"op"` // set, get, del, expire or getat
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"` // Of set
+	TTL   int64  `json:"ttl,omitempty"`   // Milliseconds, of set (0 for no expiration) and expire
+	At    int64  `json:"at,omitempty"`    // Unix milliseconds, of getat
+}
+
+// BatchResult is the outcome of one operation. Found reports whether get
+// and getat found a value, set wrote it, del deleted the key and expire set
+// its TTL.
+type BatchResult struct {
+	Found bool         `json:"found"`
+	Value *string      `json:"value,omitempty"` // Of get and getat
+	Error *ErrorDetail `json:"error,omitempty"`
+}
+
+// batchCommands are the commands behind the operations of a batch, which
+// gate them like the endpoints of single keys
+var batchCommands = map[string]string{
+	"set":    "SET",
+	"get":    "GET",
+	"del":    "DEL",
+	"expire": "EXPIRE",
+	"getat":  "GETAT",
+}
+
+// handleV1Batch runs a JSON array of operations in order and returns the
+// array of their results, saving HTTP clients a round trip per key:
+//
+//	POST /v1/batch
+//	[{"op": "set", "key": "a", "value": "1", "ttl": 60000},
+//	 {"op": "get", "key": "a"},
+//	 {"op": "getat", "key": "a", "at": 1693353600000}]
+//
+// Operations are not atomic: each runs on its own, like a pipeline, and a
+// failed operation gets an error result without stopping the others.
+func (h *HTTPServer) handleV1Batch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var ops []BatchOperation
+	if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid JSON, want an array of operations")
+		return
+	}
+	if len(ops) > MaxBatchOperations {
+		writeError(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("A batch holds at most %d operations", MaxBatchOperations))
+		return
+	}
+
+	// Scripts run before or after a batch, never between its operations
+	release := h.store.Shared()
+	key, authenticated := requestKey(r)
+	results := make([]BatchResult, len(ops))
+	for i, op := range ops {
+		if authenticated && !key.Permits(throttle.Namespace(op.Key)) {
+			results[i] = batchError(http.StatusForbidden, "This API key can only access keys in namespace '"+key.Namespace+"'")
+			continue
+		}
+		results[i] = h.runBatchOperation(op)
+	}
+	release()
+	writeJSON(w, http.StatusOK, results)
+}
+
+// runBatchOperation runs one operation of a batch
+func (h *HTTPServer) runBatchOperation(op BatchOperation) BatchResult {
+	cmd, known := batchCommands[strings.ToLower(op.Op)]
+	if !known {
+		return batchError(http.StatusBadRequest, fmt.Sprintf("Unknown operation '%s', want set, get, del, expire or getat", op.Op))
+	}
+	if reason := h.refusal(cmd); reason != "" {
+		return batchError(http.StatusForbidden, reason)
+	}
+	if op.Key == "" {
+		return batchError(http.StatusBadRequest, "Key is required")
+	}
+
+	switch cmd {
+	case "SET":
+		if op.TTL < 0 {
+			return batchError(http.StatusBadRequest, "TTL must not be negative")
+		}
+		if err := h.store.Set(op.Key, op.Value, op.TTL); err != nil {
+			return batchError(http.StatusUnprocessableEntity, err.Error())
+		}
+		return BatchResult{Found: true}
+	case "GET":
+		value, found, err := h.store.Get(op.Key)
+		if err != nil {
+			return batchError(http.StatusConflict, err.Error())
+		}
+		return foundValue(value, found)
+	case "GETAT":
+		if op.At <= 0 {
+			return batchError(http.StatusBadRequest, "At must be a positive Unix millisecond timestamp")
+		}
+		value, found, err := h.store.GetAt(op.Key, op.At)
+		if err != nil {
+			return batchError(http.StatusConflict, err.Error())
+		}
+		return foundValue(value, found)
+	case "DEL":
+		return BatchResult{Found: h.store.Delete(op.Key)}
+	default: // EXPIRE
+		if op.TTL <= 0 {
+			return batchError(http.StatusBadRequest, "TTL must be positive")
+		}
+		return BatchResult{Found: h.store.Expire(op.Key, op.TTL)}
+	}
+}
+
+// foundValue is the result of a read
+func foundValue(value string, found bool) BatchResult {
+	if !found {
+		return BatchResult{}
+	}
+	return BatchResult{Found: true, Value: &value}
+}
+
+// batchError is the result of a failed operation, in the error format of
+// the /v1 API
+func batchError(status int, message string) BatchResult {
+	return BatchResult{Error: &ErrorDetail{
+		Status:  status,
+		Code:    strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_"),
+		Message: message,
+	}}
+}
@@ -0,0 +1,119 @@
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"pulsedb/internal/store"
+)
+
+// changesBatch is how many changes a changefeed reads at a time
+const changesBatch = 1000
+
+// Change is a line of /v1/changes
+type Change struct {
+	ID        string  `json:"id"`   // Resumes the feed after this change, see since
+	Type      string  `json:"type"` // SET, DELETE or EXPIRE
+	Key       string  `json:"key"`
+	Value     *string `json:"value"`      // Written string or JSON document, null unless SET
+	ValueType *string `json:"value_type"` // string, json, set, zset or sketch, null unless SET
+	Timestamp int64   `json:"timestamp"`  // Unix milliseconds
+}
+
+// handleV1Changes streams the changefeed of the keys matching a pattern as
+// JSON Lines over a chunked response, one Change per line: first the
+// writes, deletes and expirations the history retains after since, then
+// the live ones as they are made, until the client disconnects:
+//
+//	GET /v1/changes?since=1693353600000&match=user:*
+//
+// since is a Unix millisecond timestamp, whose own changes are included,
+// or the id of the last change read, to resume a feed; it defaults to $,
+// the changes made from now on. An idle feed sends an empty line every 15
+// seconds, so proxies do not close the connection.
+func (h *HTTPServer) handleV1Changes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !h.permit(w, r, "CHANGES") {
+		return
+	}
+
+	query := r.URL.Query()
+	pattern := query.Get("match")
+	after := h.store.Snapshot()
+	if since := query.Get("since"); since != "" && since != "$" {
+		var err error
+		if after, err = store.ParseChangeID(since); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid since, want a Unix millisecond timestamp or a change id")
+			return
+		}
+	}
+
+	// Subscribe before reading, so no change slips in between; events only
+	// wake the feed, which reads the changes from the history
+	sub := h.store.Subscribe(pattern, 1)
+	defer sub.Close()
+
+	controller := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Stop nginx from buffering the changes
+	w.WriteHeader(http.StatusOK)
+	if controller.Flush() != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	encoder := json.NewEncoder(w)
+	for {
+		changes, err := h.store.Changes(r.Context(), pattern, after, changesBatch)
+		if err != nil {
+			return
+		}
+		for _, event := range changes {
+			change := Change{
+				ID:        event.ID().String(),
+				Type:      string(event.Type),
+				Key:       event.Key,
+				Timestamp: event.Timestamp,
+			}
+			if valueType := valueType(event); valueType != "" {
+				change.ValueType = &valueType
+			}
+			if event.HasValue() {
+				change.Value = &event.Value
+			}
+			if encoder.Encode(change) != nil {
+				return
+			}
+			after = event.ID()
+		}
+		if len(changes) > 0 {
+			if controller.Flush() != nil {
+				return
+			}
+			if len(changes) >= changesBatch {
+				continue
+			}
+		}
+
+		select {
+		case <-sub.Events():
+		case <-keepAlive.C:
+			io.WriteString(w, "\n")
+			if controller.Flush() != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-h.done:
+			return
+		}
+	}
+}
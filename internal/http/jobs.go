@@ -0,0 +1,143 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"pulsedb/internal/jobs"
+)
+
+// Long-running admin operations run as background jobs: POST /jobs returns a
+// job ID at once and /jobs/{id} reports its progress, so no request is held
+// open while the whole keyspace is walked.
+
+// jobCommands maps each job type to the command gating it on listeners
+// with a restricted command list
+var jobCommands = map[string]string{
+	"compact": "RETENTION",
+	"expire":  "EXPIRE",
+	"export":  "NSEXPORT",
+}
+
+type JobRequest struct {
+	Type      string `json:"type"`                // compact, expire or export
+	Pattern   string `json:"pattern,omitempty"`   // Keys to expire
+	TTL       int64  `json:"ttl,omitempty"`       // TTL in seconds for expire
+	Namespace string `json:"namespace,omitempty"` // Namespace to export
+}
+
+type JobResultResponse struct {
+	ID     string      `json:"id"`
+	Result interface{} `json:"result"`
+}
+
+// handleJobs starts a job on POST and lists the jobs on GET
+func (h *HTTPServer) handleJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		snapshots := []jobs.Snapshot{}
+		for _, job := range h.jobs.List() {
+			if h.allowed == nil || h.allowed[jobCommands[job.Kind()]] {
+				snapshots = append(snapshots, job.Snapshot())
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(snapshots)
+	case "POST":
+		h.handleStartJob(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *HTTPServer) handleStartJob(w http.ResponseWriter, r *http.Request) {
+	var req JobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	cmd, exists := jobCommands[req.Type]
+	if !exists {
+		http.Error(w, "Unknown job type", http.StatusBadRequest)
+		return
+	}
+	if !h.permit(w, r, cmd) {
+		return
+	}
+
+	var fn jobs.Func
+	switch req.Type {
+	case "compact":
+		fn = func(ctx context.Context, job *jobs.Job) (interface{}, error) {
+			removed, err := h.store.Compact(ctx, job.Progress)
+			return map[string]int{"removed": removed}, err
+		}
+	case "expire":
+		if req.Pattern == "" || req.TTL <= 0 {
+			http.Error(w, "expire needs a pattern and a positive ttl", http.StatusBadRequest)
+			return
+		}
+		fn = func(ctx context.Context, job *jobs.Job) (interface{}, error) {
+			updated, err := h.store.ExpireMatching(ctx, req.Pattern, req.TTL*1000, job.Progress)
+			return map[string]int{"updated": updated}, err
+		}
+	case "export":
+		if req.Namespace == "" {
+			http.Error(w, "export needs a namespace", http.StatusBadRequest)
+			return
+		}
+		fn = func(ctx context.Context, job *jobs.Job) (interface{}, error) {
+			return h.store.ExportNamespace(ctx, req.Namespace, job.Progress)
+		}
+	}
+
+	job := h.jobs.Start(req.Type, fn)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/jobs/"+job.ID())
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job.Snapshot())
+}
+
+// handleJob serves a single job:
+//
+//	GET  /jobs/{id}         status and progress
+//	GET  /jobs/{id}/result  result of a succeeded job
+//	POST /jobs/{id}/cancel  cancel a running job
+func (h *HTTPServer) handleJob(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+
+	job, exists := h.jobs.Get(id)
+	if !exists {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if !h.permit(w, r, jobCommands[job.Kind()]) {
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == "GET":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(job.Snapshot())
+	case action == "result" && r.Method == "GET":
+		result, ok := job.Result()
+		if !ok {
+			http.Error(w, "Job has not succeeded", http.StatusConflict)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(JobResultResponse{ID: job.ID(), Result: result})
+	case action == "cancel" && r.Method == "POST", action == "" && r.Method == "DELETE":
+		job.Cancel()
+		<-job.Done()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(job.Snapshot())
+	case action == "" || action == "result" || action == "cancel":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
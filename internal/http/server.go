@@ -4,25 +4,169 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"pulsedb/internal/apikeys"
+	"pulsedb/internal/info"
+	"pulsedb/internal/jobs"
+	"pulsedb/internal/metrics"
+	"pulsedb/internal/slowlog"
 	"pulsedb/internal/store"
+	"pulsedb/internal/streams"
 )
 
 // HTTPServer represents the HTTP API server
 type HTTPServer struct {
-	store  *store.Store
-	server *http.Server
+	store   *store.Store
+	server  *http.Server
+	allowed map[string]bool // Commands exposed over HTTP, nil means all
+	slowlog *slowlog.Log
+	stats   *info.Stats
+	jobs    *jobs.Manager
+	streams *streams.StreamManager // Served under /v1/streams, nil if disabled
+
+	apiKeys    *apikeys.Registry // Keys requests must carry, nil if not required
+	adminToken string            // Authorizes the /admin/ endpoints
+	accessLog  *slog.Logger      // Logs every request, nil if disabled
+
+	readiness []readinessCheck // Dependencies /readyz checks
+
+	drainTimeout time.Duration // How long shutdown waits for requests in flight
+	done         chan struct{} // Closed on shutdown, which does not wait for WebSockets
+}
+
+// readinessCheck is a dependency /readyz checks, see AddReadinessCheck
+type readinessCheck struct {
+	name  string
+	check func() error
 }
 
 // NewHTTPServer creates a new HTTP server
-func NewHTTPServer(store *store.Store, metrics interface{}) *HTTPServer {
+func NewHTTPServer(store *store.Store, metrics *metrics.Metrics) *HTTPServer {
 	return &HTTPServer{
-		store: store,
+		store:        store,
+		jobs:         jobs.NewManager(jobs.DefaultRetain),
+		drainTimeout: 5 * time.Second,
+		done:         make(chan struct{}),
 	}
 }
 
+// AllowCommands restricts the HTTP API to endpoints backed by the given
+// command names (GET, SET, DEL, SCAN). An empty list exposes everything.
+func (h *HTTPServer) AllowCommands(names []string) {
+	if len(names) == 0 {
+		h.allowed = nil
+		return
+	}
+
+	h.allowed = make(map[string]bool, len(names))
+	for _, name := range names {
+		h.allowed[strings.ToUpper(name)] = true
+	}
+}
+
+// SetSlowLog sets the slow command log served on /slowlog
+func (h *HTTPServer) SetSlowLog(log *slowlog.Log) {
+	h.slowlog = log
+}
+
+// SetAccessLog logs every request to logger with its client, latency and
+// status; nil disables the access log
+func (h *HTTPServer) SetAccessLog(logger *slog.Logger) {
+	h.accessLog = logger
+}
+
+// SetDrainTimeout sets how long shutdown waits for requests in flight
+// before closing their connections
+func (h *HTTPServer) SetDrainTimeout(timeout time.Duration) {
+	h.drainTimeout = timeout
+}
+
+// AddReadinessCheck adds a dependency to /readyz, which reports the server
+// ready while check returns nil. Call it before Start.
+func (h *HTTPServer) AddReadinessCheck(name string, check func() error) {
+	h.readiness = append(h.readiness, readinessCheck{name: name, check: check})
+}
+
+// SetStats sets the server statistics served on /info
+func (h *HTTPServer) SetStats(stats *info.Stats) {
+	h.stats = stats
+}
+
+// writeCommands are the commands behind endpoints that change keys,
+// refused while the store is in read-only mode
+var writeCommands = map[string]bool{
+	"SET":     true,
+	"DEL":     true,
+	"EXPIRE":  true,
+	"PERSIST": true,
+	"IMPORT":  true,
+	"XADD":    true,
+}
+
+// permit reports whether cmd is exposed and may run, writing a 403 response
+// if not
+func (h *HTTPServer) permit(w http.ResponseWriter, r *http.Request, cmd string) bool {
+	if reason := h.refusal(cmd); reason != "" {
+		writeError(w, r, http.StatusForbidden, reason)
+		return false
+	}
+	return true
+}
+
+// refusal returns why cmd may not run, "" if it may
+func (h *HTTPServer) refusal(cmd string) string {
+	if h.allowed != nil && !h.allowed[cmd] {
+		return fmt.Sprintf("Command %s is not allowed on this listener", cmd)
+	}
+	if writeCommands[cmd] && h.store.ReadOnly() {
+		return fmt.Sprintf("Command %s is a write and the server is in read-only mode", cmd)
+	}
+	return ""
+}
+
+// logRequests wraps the API so every request is written to the access log
+func (h *HTTPServer) logRequests(next http.Handler) http.Handler {
+	if h.accessLog == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		h.accessLog.Info("request",
+			"client", r.RemoteAddr,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"latency", time.Since(start),
+		)
+	})
+}
+
+// statusRecorder remembers the status code of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the connection, see upgradeWebSocket
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
 // Start starts the HTTP server
 func (h *HTTPServer) Start(ctx context.Context, addr string) error {
 	mux := http.NewServeMux()
@@ -30,18 +174,53 @@ func (h *HTTPServer) Start(ctx context.Context, addr string) error {
 	// Key-value operations
 	mux.HandleFunc("/kv/", h.handleKeyValue)
 
-	// Health check
-	mux.HandleFunc("/health", h.handleHealth)
+	// Keyspace iteration
+	mux.HandleFunc("/keys", h.handleKeys)
+
+	// Liveness and readiness probes
+	mux.HandleFunc("/healthz", h.handleHealthz)
+	mux.HandleFunc("/readyz", h.handleReadyz)
+
+	// Slow command log
+	mux.HandleFunc("/slowlog", h.handleSlowLog)
+
+	// Server statistics, the INFO sections as JSON
+	mux.HandleFunc("/info", h.handleInfo)
+
+	// Subsystems, versions and limits, like CAPABILITIES
+	mux.HandleFunc("/capabilities", h.handleCapabilities)
+
+	// Write amplification report
+	mux.HandleFunc("/stats/amplification", h.handleAmplification)
+
+	// Long-running admin operations
+	mux.HandleFunc("/jobs", h.handleJobs)
+	mux.HandleFunc("/jobs/", h.handleJob)
+
+	// API key administration and usage reports
+	mux.HandleFunc("/admin/keys", h.handleAPIKeys)
+	mux.HandleFunc("/admin/keys/", h.handleAPIKey)
+	mux.HandleFunc("/admin/usage", h.handleAPIKeyUsage)
+
+	// Versioned API with JSON errors
+	h.registerV1(mux)
+
+	// Live key events over WebSocket
+	mux.HandleFunc("/ws/subscribe", h.handleSubscribe)
+
+	// Prometheus metrics
+	mux.Handle("/metrics", promhttp.Handler())
 
 	h.server = &http.Server{
 		Addr:    addr,
-		Handler: mux,
+		Handler: h.logRequests(h.authenticate(mux)),
 	}
+	h.server.RegisterOnShutdown(func() { close(h.done) })
 
 	// Start server in a goroutine
 	go func() {
 		if err := h.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			fmt.Printf("HTTP server error: %v\n", err)
+			slog.Error("HTTP server error", "error", err)
 		}
 	}()
 
@@ -49,7 +228,7 @@ func (h *HTTPServer) Start(ctx context.Context, addr string) error {
 	<-ctx.Done()
 
 	// Graceful shutdown
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), h.drainTimeout)
 	defer cancel()
 
 	return h.server.Shutdown(shutdownCtx)
@@ -65,6 +244,37 @@ type GetResponse struct {
 	Key   string `json:"key"`
 	Value string `json:"value"`
 	Found bool   `json:"found"`
+	At    int64  `json:"at,omitempty"` // Unix milliseconds of a temporal read
+}
+
+type Version struct {
+	Timestamp int64  `json:"timestamp"`
+	Value     string `json:"value"`
+	TTL       int64  `json:"ttl"`               // Remaining milliseconds, -1 if the version has no expiration
+	HLC       uint64 `json:"hlc"`               // Hybrid logical clock timestamp ordering versions
+	Deleted   bool   `json:"deleted,omitempty"` // The version records a delete
+}
+
+type HistoryResponse struct {
+	Key      string    `json:"key"`
+	Cursor   uint64    `json:"cursor"` // HLC cursor of the next page, 0 when done
+	Versions []Version `json:"versions"`
+}
+
+type ScanResponse struct {
+	Cursor uint64   `json:"cursor"`
+	Keys   []string `json:"keys"`
+}
+
+type SlowLogResponse struct {
+	Len     int             `json:"len"`
+	Entries []slowlog.Entry `json:"entries"`
+}
+
+type AmplificationResponse struct {
+	Window     int64                          `json:"window"` // Seconds
+	Namespaces []store.NamespaceAmplification `json:"namespaces"`
+	Keys       []store.KeyAmplification       `json:"keys"`
 }
 
 // Handler functions
@@ -73,20 +283,41 @@ func (h *HTTPServer) handleKeyValue(w http.ResponseWriter, r *http.Request) {
 	// Parse the path to extract key and operation
 	path := r.URL.Path[4:] // Remove "/kv/" prefix
 
+	if key, ok := strings.CutSuffix(path, "/history"); ok && r.Method == "GET" {
+		if h.permit(w, r, "HISTRANGE") {
+			h.handleHistory(w, r, key)
+		}
+		return
+	}
+
 	switch r.Method {
 	case "GET":
-		h.handleGet(w, r, path)
+		if r.URL.Query().Has("at") {
+			if h.permit(w, r, "GETAT") {
+				h.handleGetAt(w, r, path)
+			}
+		} else if h.permit(w, r, "GET") {
+			h.handleGet(w, r, path)
+		}
 	case "POST", "PUT":
-		h.handleSet(w, r, path)
+		if h.permit(w, r, "SET") {
+			h.handleSet(w, r, path)
+		}
 	case "DELETE":
-		h.handleDelete(w, r, path)
+		if h.permit(w, r, "DEL") {
+			h.handleDelete(w, r, path)
+		}
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
 func (h *HTTPServer) handleGet(w http.ResponseWriter, r *http.Request, key string) {
-	value, found := h.store.Get(key)
+	value, found, err := h.store.Get(key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 
 	response := GetResponse{
 		Key:   key,
@@ -102,6 +333,34 @@ func (h *HTTPServer) handleGet(w http.ResponseWriter, r *http.Request, key strin
 	json.NewEncoder(w).Encode(response)
 }
 
+// handleGetAt returns the value key had at the Unix millisecond timestamp
+// given by the at query parameter
+func (h *HTTPServer) handleGetAt(w http.ResponseWriter, r *http.Request, key string) {
+	at, err := strconv.ParseInt(r.URL.Query().Get("at"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid at", http.StatusBadRequest)
+		return
+	}
+
+	value, found, err := h.store.GetAt(key, at)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+	}
+
+	json.NewEncoder(w).Encode(GetResponse{
+		Key:   key,
+		Value: value,
+		Found: found,
+		At:    at,
+	})
+}
+
 func (h *HTTPServer) handleSet(w http.ResponseWriter, r *http.Request, key string) {
 	var req SetRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -110,14 +369,84 @@ func (h *HTTPServer) handleSet(w http.ResponseWriter, r *http.Request, key strin
 	}
 
 	ttlMs := req.TTL * 1000 // Convert seconds to milliseconds
-	h.store.Set(key, req.Value, ttlMs)
+	release := h.store.Shared()
+	err := h.store.Set(key, req.Value, ttlMs)
+	release()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "OK"})
 }
 
+// handleHistory returns the versions of key written between the start and
+// end query parameters (Unix milliseconds, both optional), newest first.
+// Versions are paged like /keys: pass the returned cursor to get the next
+// page of at most limit versions.
+func (h *HTTPServer) handleHistory(w http.ResponseWriter, r *http.Request, key string) {
+	query := r.URL.Query()
+
+	start, end := int64(math.MinInt64), int64(math.MaxInt64)
+	var err error
+	if v := query.Get("start"); v != "" {
+		if start, err = strconv.ParseInt(v, 10, 64); err != nil {
+			http.Error(w, "Invalid start", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("end"); v != "" {
+		if end, err = strconv.ParseInt(v, 10, 64); err != nil {
+			http.Error(w, "Invalid end", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var cursor uint64
+	if v := query.Get("cursor"); v != "" {
+		if cursor, err = strconv.ParseUint(v, 10, 64); err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	limit := 100
+	if v := query.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Cursors are version HLCs like HISTSCAN, so pages stay consistent
+	// while the key is written to or trimmed
+	history, next := h.store.HistoryScan(key, start, end, store.HLC(cursor), limit)
+
+	now := time.Now().UnixMilli()
+	versions := make([]Version, len(history))
+	for i, version := range history {
+		ttl := int64(-1)
+		if version.TTL > 0 {
+			ttl = max(version.TTL-now, 0)
+		}
+		versions[i] = Version{
+			Timestamp: version.Timestamp,
+			Value:     version.Data,
+			TTL:       ttl,
+			HLC:       uint64(version.HLC),
+			Deleted:   version.Deleted,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(HistoryResponse{Key: key, Cursor: uint64(next), Versions: versions})
+}
+
 func (h *HTTPServer) handleDelete(w http.ResponseWriter, r *http.Request, key string) {
+	release := h.store.Shared()
 	deleted := h.store.Delete(key)
+	release()
 
 	w.Header().Set("Content-Type", "application/json")
 	if !deleted {
@@ -129,12 +458,191 @@ func (h *HTTPServer) handleDelete(w http.ResponseWriter, r *http.Request, key st
 	})
 }
 
-func (h *HTTPServer) handleHealth(w http.ResponseWriter, r *http.Request) {
-	stats := h.store.Stats()
+func (h *HTTPServer) handleKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.permit(w, r, "SCAN") {
+		return
+	}
+
+	query := r.URL.Query()
+
+	var cursor uint64
+	if c := query.Get("cursor"); c != "" {
+		var err error
+		cursor, err = strconv.ParseUint(c, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	count := 100
+	if c := query.Get("count"); c != "" {
+		var err error
+		count, err = strconv.Atoi(c)
+		if err != nil || count < 1 {
+			http.Error(w, "Invalid count", http.StatusBadRequest)
+			return
+		}
+	}
+
+	keys, next := h.store.Scan(cursor, query.Get("match"), count)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ScanResponse{
+		Cursor: next,
+		Keys:   keys,
+	})
+}
+
+func (h *HTTPServer) handleSlowLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.permit(w, r, "SLOWLOG") {
+		return
+	}
+	if h.slowlog == nil {
+		http.Error(w, "Slow log is not enabled", http.StatusNotFound)
+		return
+	}
+
+	count := 10
+	if c := r.URL.Query().Get("count"); c != "" {
+		var err error
+		count, err = strconv.Atoi(c)
+		if err != nil || count < -1 {
+			http.Error(w, "Invalid count", http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SlowLogResponse{
+		Len:     h.slowlog.Len(),
+		Entries: h.slowlog.Get(count),
+	})
+}
+
+func (h *HTTPServer) handleAmplification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.permit(w, r, "STATS") {
+		return
+	}
 
+	window, count := time.Hour, 10
+	if v := r.URL.Query().Get("window"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds < 1 {
+			http.Error(w, "Invalid window", http.StatusBadRequest)
+			return
+		}
+		window = time.Duration(seconds) * time.Second
+	}
+	if c := r.URL.Query().Get("count"); c != "" {
+		var err error
+		count, err = strconv.Atoi(c)
+		if err != nil || count < 0 {
+			http.Error(w, "Invalid count", http.StatusBadRequest)
+			return
+		}
+	}
+
+	report := h.store.Amplification(window, count)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AmplificationResponse{
+		Window:     int64(report.Window.Seconds()),
+		Namespaces: report.Namespaces,
+		Keys:       report.Keys,
+	})
+}
+
+func (h *HTTPServer) handleInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.permit(w, r, "INFO") {
+		return
+	}
+	if h.stats == nil {
+		http.Error(w, "Server statistics are not enabled", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.stats.Collect(h.store))
+}
+
+func (h *HTTPServer) handleCapabilities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.permit(w, r, "CAPABILITIES") {
+		return
+	}
+	if h.stats == nil {
+		http.Error(w, "Server statistics are not enabled", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.stats.Capabilities())
+}
+
+// handleHealthz is the liveness probe: the process is serving requests. It
+// takes no lock, so a busy store does not get the process restarted.
+func (h *HTTPServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// handleReadyz is the readiness probe: 200 while every dependency check
+// passes, 503 with the failed checks otherwise and once shutdown begins, so
+// load balancers stop routing to the server before it closes
+func (h *HTTPServer) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ready := true
+	checks := make(map[string]string, len(h.readiness)+1)
+	select {
+	case <-h.done:
+		ready = false
+		checks["shutdown"] = "shutting down"
+	default:
+	}
+	for _, c := range h.readiness {
+		checks[c.name] = "ok"
+		if err := c.check(); err != nil {
+			ready = false
+			checks[c.name] = err.Error()
+		}
+	}
+
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not ready", http.StatusServiceUnavailable
+	}
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status": "healthy",
-		"stats":  stats,
+		"status": status,
+		"checks": checks,
 	})
 }
@@ -0,0 +1,83 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"pulsedb/internal/store"
+)
+
+// KeyEvent is a message pushed by /ws/subscribe
+type KeyEvent struct {
+	Type      string `json:"type"` // SET, DELETE or EXPIRE
+	Key       string `json:"key"`
+	Value     string `json:"value,omitempty"`      // Written string or JSON document
+	ValueType string `json:"value_type,omitempty"` // Of the value a SET wrote
+	Timestamp int64  `json:"timestamp"`            // Unix milliseconds
+	HLC       uint64 `json:"hlc,omitempty"`        // Of the version written, absent for expirations and in-place updates
+}
+
+// handleSubscribe upgrades to a WebSocket pushing a KeyEvent for every
+// write, delete and expiration of the keys matching pattern:
+//
+//	GET /ws/subscribe?pattern=user:*
+//
+// A subscriber that falls behind by more than store.DefaultSubscriptionBuffer
+// events is disconnected with status 1013, rather than silently missing
+// events; it should reconnect and resynchronize.
+func (h *HTTPServer) handleSubscribe(w http.ResponseWriter, r *http.Request) {
+	if !h.permit(w, r, "PSUBSCRIBE") {
+		return
+	}
+	pattern := r.URL.Query().Get("pattern")
+	if pattern == "" {
+		pattern = "*"
+	}
+
+	conn, ok := upgradeWebSocket(w, r)
+	if !ok {
+		return
+	}
+	sub := h.store.Subscribe(pattern, store.DefaultSubscriptionBuffer)
+	defer sub.Close()
+
+	closed := make(chan int, 1)
+	go func() { closed <- conn.ReadLoop() }()
+
+	for {
+		select {
+		case code := <-closed:
+			conn.Close(code, "")
+			return
+		case <-h.done:
+			conn.Close(wsCloseGoingAway, "server shutting down")
+			return
+		case event := <-sub.Events():
+			if sub.Dropped() > 0 {
+				conn.Close(wsCloseTryAgain, "subscriber fell behind, events were dropped")
+				return
+			}
+			payload, err := json.Marshal(KeyEvent{
+				Type:      string(event.Type),
+				Key:       event.Key,
+				Value:     event.Value,
+				ValueType: valueType(event),
+				Timestamp: event.Timestamp,
+				HLC:       uint64(event.HLC),
+			})
+			if err != nil || conn.WriteText(payload) != nil {
+				conn.Close(wsCloseGoingAway, "")
+				return
+			}
+		}
+	}
+}
+
+// valueType is the type of the value a SET event wrote, empty for other
+// events
+func valueType(event store.Event) string {
+	if event.Type != store.EventSet {
+		return ""
+	}
+	return event.ValueType.String()
+}
@@ -0,0 +1,544 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"pulsedb/internal/store"
+	"pulsedb/internal/streams"
+)
+
+// The /v1 API is the versioned HTTP surface. Unlike the older endpoints,
+// every /v1 response is JSON, errors included:
+//
+//	{"error": {"status": 404, "code": "not_found", "message": "..."}}
+//
+// TTLs are in milliseconds throughout.
+
+type ErrorDetail struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"` // The status text in snake case, e.g. not_found
+	Message string `json:"message"`
+}
+
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+type KeyRequest struct {
+	Value string `json:"value"`
+	TTL   int64  `json:"ttl,omitempty"` // Milliseconds, 0 for no expiration
+}
+
+type KeyResponse struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	TTL   int64  `json:"ttl"` // Remaining milliseconds, -1 if the key has no expiration
+}
+
+type TTLRequest struct {
+	TTL int64 `json:"ttl"` // Milliseconds
+}
+
+type TTLResponse struct {
+	Key string `json:"key"`
+	TTL int64  `json:"ttl"` // Remaining milliseconds, -1 if the key has no expiration
+}
+
+type StreamEntryRequest struct {
+	Fields map[string]string `json:"fields"`
+	UUID   string            `json:"uuid,omitempty"` // Adding the same UUID again returns the first entry
+}
+
+type StreamEntryResponse struct {
+	Stream string `json:"stream"`
+	ID     string `json:"id"`
+}
+
+type StreamEntriesResponse struct {
+	Stream  string                `json:"stream"`
+	Cursor  string                `json:"cursor"` // ID of the last entry, pass as after for the next page
+	Entries []streams.StreamEntry `json:"entries"`
+}
+
+type ImportResponse struct {
+	Keys    int `json:"keys"`
+	Skipped int `json:"skipped"` // Existing keys kept, or keys whose dump has expired
+}
+
+type StatsResponse struct {
+	Store  map[string]interface{} `json:"store"`
+	Server interface{}            `json:"server,omitempty"` // The INFO sections, if statistics are enabled
+}
+
+// SetStreams sets the streams served under /v1/streams, so several
+// listeners can share them
+func (h *HTTPServer) SetStreams(streams *streams.StreamManager) {
+	h.streams = streams
+}
+
+// registerV1 adds the /v1 endpoints to mux
+func (h *HTTPServer) registerV1(mux *http.ServeMux) {
+	mux.HandleFunc("/v1/keys", h.handleV1Keys)
+	mux.HandleFunc("/v1/keys/", h.handleV1Key)
+	mux.HandleFunc("/v1/streams/", h.handleV1Stream)
+	mux.HandleFunc("/v1/stats", h.handleV1Stats)
+	mux.HandleFunc("/v1/export", h.handleV1Export)
+	mux.HandleFunc("/v1/import", h.handleV1Import)
+	mux.HandleFunc("/v1/batch", h.handleV1Batch)
+	mux.HandleFunc("/v1/changes", h.handleV1Changes)
+	mux.HandleFunc("/v1/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, http.StatusNotFound, "No such endpoint")
+	})
+}
+
+// writeJSON writes v as a JSON response with status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error response: the JSON envelope for /v1 requests,
+// plain text for the older endpoints
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if !strings.HasPrefix(r.URL.Path, "/v1/") {
+		http.Error(w, message, status)
+		return
+	}
+	writeJSON(w, status, ErrorResponse{Error: ErrorDetail{
+		Status:  status,
+		Code:    strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_"),
+		Message: message,
+	}})
+}
+
+// handleV1Keys scans the keyspace:
+//
+//	GET /v1/keys?cursor=0&match=user:*&count=100
+func (h *HTTPServer) handleV1Keys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !h.permit(w, r, "SCAN") {
+		return
+	}
+
+	query := r.URL.Query()
+	var cursor uint64
+	if v := query.Get("cursor"); v != "" {
+		var err error
+		if cursor, err = strconv.ParseUint(v, 10, 64); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+	}
+	count := 100
+	if v := query.Get("count"); v != "" {
+		var err error
+		if count, err = strconv.Atoi(v); err != nil || count < 1 {
+			writeError(w, r, http.StatusBadRequest, "Invalid count")
+			return
+		}
+	}
+
+	keys, next := h.store.Scan(cursor, query.Get("match"), count)
+	writeJSON(w, http.StatusOK, ScanResponse{Cursor: next, Keys: keys})
+}
+
+// handleV1Key serves a key and its TTL:
+//
+//	GET    /v1/keys/{key}      the value and TTL
+//	PUT    /v1/keys/{key}      set the value, {"value": "...", "ttl": ms}
+//	DELETE /v1/keys/{key}      delete the key
+//	GET    /v1/keys/{key}/ttl  the TTL
+//	PUT    /v1/keys/{key}/ttl  expire the key, {"ttl": ms}
+//	DELETE /v1/keys/{key}/ttl  remove the expiration
+func (h *HTTPServer) handleV1Key(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/v1/keys/")
+	if name, ok := strings.CutSuffix(key, "/ttl"); ok && name != "" {
+		h.handleV1TTL(w, r, name)
+		return
+	}
+	if key == "" {
+		writeError(w, r, http.StatusNotFound, "No such endpoint")
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		if !h.permit(w, r, "GET") {
+			return
+		}
+		value, found, err := h.store.Get(key)
+		if err != nil {
+			writeError(w, r, http.StatusConflict, err.Error())
+			return
+		}
+		if !found {
+			writeError(w, r, http.StatusNotFound, "Key not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, KeyResponse{Key: key, Value: value, TTL: h.store.TTL(key)})
+	case "PUT":
+		if !h.permit(w, r, "SET") {
+			return
+		}
+		var req KeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if req.TTL < 0 {
+			writeError(w, r, http.StatusBadRequest, "TTL must not be negative")
+			return
+		}
+		release := h.store.Shared()
+		err := h.store.Set(key, req.Value, req.TTL)
+		release()
+		if err != nil {
+			writeError(w, r, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, KeyResponse{Key: key, Value: req.Value, TTL: h.store.TTL(key)})
+	case "DELETE":
+		if !h.permit(w, r, "DEL") {
+			return
+		}
+		release := h.store.Shared()
+		deleted := h.store.Delete(key)
+		release()
+		if !deleted {
+			writeError(w, r, http.StatusNotFound, "Key not found")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleV1TTL serves the TTL of a key
+func (h *HTTPServer) handleV1TTL(w http.ResponseWriter, r *http.Request, key string) {
+	switch r.Method {
+	case "GET":
+		if !h.permit(w, r, "TTL") {
+			return
+		}
+	case "PUT":
+		if !h.permit(w, r, "EXPIRE") {
+			return
+		}
+		var req TTLRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if req.TTL <= 0 {
+			writeError(w, r, http.StatusBadRequest, "TTL must be positive")
+			return
+		}
+		release := h.store.Shared()
+		expired := h.store.Expire(key, req.TTL)
+		release()
+		if !expired {
+			writeError(w, r, http.StatusNotFound, "Key not found")
+			return
+		}
+	case "DELETE":
+		if !h.permit(w, r, "PERSIST") {
+			return
+		}
+		release := h.store.Shared()
+		h.store.Persist(key)
+		release()
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	ttl := h.store.TTL(key)
+	if ttl == -2 || h.store.Exists(key) == 0 {
+		writeError(w, r, http.StatusNotFound, "Key not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, TTLResponse{Key: key, TTL: ttl})
+}
+
+// handleV1Stream serves the entries of a stream:
+//
+//	POST /v1/streams/{name}/entries                   add an entry
+//	GET  /v1/streams/{name}/entries?after=&count=100  entries after an ID, oldest first
+//	GET  /v1/streams/{name}/tail?after=               new entries as Server-Sent Events
+func (h *HTTPServer) handleV1Stream(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/v1/streams/")
+	name, tail := strings.CutSuffix(path, "/tail")
+	if !tail {
+		var ok bool
+		if name, ok = strings.CutSuffix(path, "/entries"); !ok {
+			name = ""
+		}
+	}
+	if name == "" {
+		writeError(w, r, http.StatusNotFound, "No such endpoint")
+		return
+	}
+	if h.streams == nil {
+		writeError(w, r, http.StatusNotFound, "Streams are not enabled")
+		return
+	}
+	if tail {
+		h.handleV1StreamTail(w, r, name)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		if !h.permit(w, r, "XADD") {
+			return
+		}
+		var req StreamEntryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if len(req.Fields) == 0 {
+			writeError(w, r, http.StatusBadRequest, "An entry needs at least one field")
+			return
+		}
+		release := h.store.Shared()
+		id, err := h.streams.AddEntry(name, req.Fields, req.UUID)
+		release()
+		if errors.Is(err, streams.ErrDropped) {
+			// Filtered out by the stream's pipeline
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if err != nil {
+			writeError(w, r, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		w.Header().Set("Location", r.URL.Path+"?after="+id)
+		writeJSON(w, http.StatusCreated, StreamEntryResponse{Stream: name, ID: id})
+	case "GET":
+		if !h.permit(w, r, "XRANGE") {
+			return
+		}
+		query := r.URL.Query()
+		count := 100
+		if v := query.Get("count"); v != "" {
+			var err error
+			if count, err = strconv.Atoi(v); err != nil || count < 1 {
+				writeError(w, r, http.StatusBadRequest, "Invalid count")
+				return
+			}
+		}
+		after := query.Get("after")
+		entries, err := h.streams.EntriesAfter(name, after, count)
+		if err != nil {
+			writeError(w, r, http.StatusNotFound, "Stream not found")
+			return
+		}
+		if entries == nil {
+			entries = []streams.StreamEntry{}
+		}
+		cursor := after
+		if len(entries) > 0 {
+			cursor = entries[len(entries)-1].ID
+		}
+		writeJSON(w, http.StatusOK, StreamEntriesResponse{Stream: name, Cursor: cursor, Entries: entries})
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// sseBatch is how many entries a tail reads from the stream at a time
+const sseBatch = 100
+
+// sseKeepAlive is how often an idle tail sends a comment line, so proxies
+// do not close the connection
+const sseKeepAlive = 15 * time.Second
+
+// handleV1StreamTail pushes the entries appended to a stream as they come,
+// as Server-Sent Events. Each entry is an "entry" event with the entry ID as
+// its id, so a reconnecting EventSource resumes after the last entry it
+// received through Last-Event-ID. Without Last-Event-ID or after, the tail
+// starts with the next entry appended. The stream need not exist yet.
+func (h *HTTPServer) handleV1StreamTail(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != "GET" {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !h.permit(w, r, "XREAD") {
+		return
+	}
+
+	after := r.Header.Get("Last-Event-ID")
+	if after == "" {
+		after = r.URL.Query().Get("after")
+	}
+	if after != "" && !streams.ValidID(after) {
+		writeError(w, r, http.StatusBadRequest, "Invalid entry ID")
+		return
+	}
+	if after == "" {
+		if last, err := h.streams.LastEntries(name, 1); err == nil && len(last) > 0 {
+			after = last[0].ID
+		}
+	}
+
+	controller := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Stop nginx from buffering the events
+	w.WriteHeader(http.StatusOK)
+	if controller.Flush() != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		appended := h.streams.Appended(name)
+		entries, _ := h.streams.EntriesAfter(name, after, sseBatch)
+		for _, entry := range entries {
+			data, _ := json.Marshal(entry)
+			fmt.Fprintf(w, "id: %s\nevent: entry\ndata: %s\n\n", entry.ID, data)
+			after = entry.ID
+		}
+		if len(entries) > 0 {
+			if controller.Flush() != nil {
+				return
+			}
+			if len(entries) == sseBatch {
+				continue
+			}
+		}
+
+		select {
+		case <-appended:
+		case <-keepAlive.C:
+			io.WriteString(w, ": keep-alive\n\n")
+			if controller.Flush() != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// handleV1Stats reports the store statistics and, if enabled, the INFO
+// sections
+func (h *HTTPServer) handleV1Stats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !h.permit(w, r, "INFO") {
+		return
+	}
+
+	response := StatsResponse{Store: h.store.Stats()}
+	if h.stats != nil {
+		response.Server = h.stats.Collect(h.store)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleV1Export streams the keyspace as JSON Lines or CSV:
+//
+//	GET /v1/export?format=jsonl&match=user:*&history=true
+//
+// An error after the response has started cuts the body short.
+func (h *HTTPServer) handleV1Export(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !h.permit(w, r, "EXPORT") {
+		return
+	}
+
+	query := r.URL.Query()
+	opts := store.ExportOptions{Format: store.FormatJSONL, Pattern: query.Get("match")}
+	if v := query.Get("format"); v != "" {
+		var err error
+		if opts.Format, err = store.ParseExportFormat(v); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid format, want jsonl or csv")
+			return
+		}
+	}
+	if v := query.Get("history"); v != "" {
+		var err error
+		if opts.History, err = strconv.ParseBool(v); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid history flag")
+			return
+		}
+	}
+
+	if opts.Format == store.FormatCSV {
+		w.Header().Set("Content-Type", "text/csv")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"pulsedb-export.%s\"", opts.Format))
+	h.store.Export(r.Context(), w, opts, func(done, total int) {})
+}
+
+// handleV1Import recreates the keys of an export posted as the body:
+//
+//	POST /v1/import?format=jsonl&replace=true
+//
+// The format defaults to CSV for a text/csv body and JSON Lines otherwise.
+func (h *HTTPServer) handleV1Import(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !h.permit(w, r, "IMPORT") {
+		return
+	}
+
+	query := r.URL.Query()
+	format := store.FormatJSONL
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		format = store.FormatCSV
+	}
+	if v := query.Get("format"); v != "" {
+		var err error
+		if format, err = store.ParseExportFormat(v); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid format, want jsonl or csv")
+			return
+		}
+	}
+	replace := false
+	if v := query.Get("replace"); v != "" {
+		var err error
+		if replace, err = strconv.ParseBool(v); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid replace flag")
+			return
+		}
+	}
+
+	// Like IMPORT, the whole import runs between scripts
+	release := h.store.Shared()
+	result, err := h.store.Import(r.Context(), r.Body, format, replace, func(done, total int) {})
+	release()
+	if err != nil {
+		message := fmt.Sprintf("Import stopped after %d keys: %s", result.Imported+result.Skipped, strings.TrimPrefix(err.Error(), "ERR "))
+		writeError(w, r, http.StatusBadRequest, message)
+		return
+	}
+	writeJSON(w, http.StatusOK, ImportResponse{Keys: result.Imported, Skipped: result.Skipped})
+}
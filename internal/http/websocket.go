@@ -0,0 +1,252 @@
+package http
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A minimal server side of the WebSocket protocol (RFC 6455): enough to
+// push text messages and answer pings. Messages from clients are read and
+// discarded.
+
+// websocketGUID is appended to the client key to compute the accept key
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Opcodes
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// Close status codes
+const (
+	wsCloseNormal    = 1000
+	wsCloseGoingAway = 1001
+	wsCloseProtocol  = 1002
+	wsCloseTooBig    = 1009
+	wsCloseTryAgain  = 1013
+)
+
+// wsMaxMessage bounds the frames accepted from clients, which have nothing
+// to send but control frames
+const wsMaxMessage = 4096
+
+// wsWriteTimeout bounds every write, so a client that stopped reading
+// cannot hold its handler forever
+const wsWriteTimeout = 10 * time.Second
+
+var errWebSocketClosed = errors.New("websocket closed")
+
+// websocketConn is an upgraded connection. Writes are serialized, so the
+// reader can answer pings while the handler pushes messages.
+type websocketConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// upgradeWebSocket completes the opening handshake of r, writing an error
+// response and returning false if it is not a valid WebSocket request
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*websocketConn, bool) {
+	if r.Method != "GET" {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return nil, false
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") || key == "" {
+		writeError(w, r, http.StatusBadRequest, "WebSocket upgrade required")
+		return nil, false
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		writeError(w, r, http.StatusUpgradeRequired, "Unsupported WebSocket version")
+		return nil, false
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "WebSocket upgrade not supported")
+		return nil, false
+	}
+	// The status line is written by hand after the hijack, so record the
+	// switch for the access log here
+	for inner := w; inner != nil; {
+		if recorder, ok := inner.(*statusRecorder); ok {
+			recorder.status = http.StatusSwitchingProtocols
+			break
+		}
+		wrapper, ok := inner.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		inner = wrapper.Unwrap()
+	}
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	_, err = io.WriteString(conn, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: "+base64.StdEncoding.EncodeToString(sum[:])+"\r\n\r\n")
+	if err != nil {
+		conn.Close()
+		return nil, false
+	}
+	return &websocketConn{conn: conn, reader: rw.Reader}, true
+}
+
+// headerContains reports whether the comma-separated header name lists token
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WriteText sends payload as a single text message
+func (c *websocketConn) WriteText(payload []byte) error {
+	return c.writeFrame(wsText, payload)
+}
+
+// Close sends a close frame with code and reason, then closes the
+// connection. Closing twice is a no-op.
+func (c *websocketConn) Close(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	c.writeFrame(wsClose, payload)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.conn.Close()
+}
+
+// writeFrame sends one unmasked, final frame
+func (c *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | opcode
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return errWebSocketClosed
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if _, err := c.conn.Write(header); err != nil {
+		return err
+	}
+	_, err := c.conn.Write(payload)
+	return err
+}
+
+// ReadLoop reads frames until the client closes the connection or breaks
+// the protocol, answering pings and discarding messages. It returns the
+// close code to reply with.
+func (c *websocketConn) ReadLoop() int {
+	for {
+		opcode, payload, err := c.readFrame()
+		if err != nil {
+			var code wsError
+			if errors.As(err, &code) {
+				return int(code)
+			}
+			return wsCloseNormal
+		}
+
+		switch opcode {
+		case wsClose:
+			return wsCloseNormal
+		case wsPing:
+			if c.writeFrame(wsPong, payload) != nil {
+				return wsCloseNormal
+			}
+		case wsPong, wsText, wsBinary, wsContinuation:
+		default:
+			return wsCloseProtocol
+		}
+	}
+}
+
+// wsError is a protocol violation, carrying the close code it calls for
+type wsError int
+
+func (e wsError) Error() string {
+	return "websocket protocol error"
+}
+
+// readFrame reads one frame from the client, unmasking its payload
+func (c *websocketConn) readFrame() (byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := header[0] & 0x0F
+	if header[1]&0x80 == 0 {
+		return 0, nil, wsError(wsCloseProtocol) // Client frames must be masked
+	}
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > wsMaxMessage {
+		return 0, nil, wsError(wsCloseTooBig)
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
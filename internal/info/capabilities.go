@@ -0,0 +1,43 @@
+package info
+
+import "sort"
+
+// Capability describes one subsystem of the server, so deployment tooling
+// and client libraries can adapt to what a server runs. Version is only set
+// for subsystems versioned apart from the server.
+type Capability struct {
+	Name    string           `json:"name"`
+	Enabled bool             `json:"enabled"`
+	Version string           `json:"version,omitempty"`
+	Limits  map[string]int64 `json:"limits,omitempty"`
+}
+
+// Capabilities is the reply of CAPABILITIES and GET /capabilities
+type Capabilities struct {
+	Version    string       `json:"version"`
+	Subsystems []Capability `json:"subsystems"`
+}
+
+// SetCapabilities sets the subsystems reported by Capabilities, replacing
+// any set before
+func (s *Stats) SetCapabilities(capabilities []Capability) {
+	if s == nil {
+		return
+	}
+	sorted := append([]Capability(nil), capabilities...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	s.capabilitiesMu.Lock()
+	defer s.capabilitiesMu.Unlock()
+	s.capabilities = sorted
+}
+
+// Capabilities returns the server version and its subsystems sorted by name
+func (s *Stats) Capabilities() Capabilities {
+	s.capabilitiesMu.RLock()
+	defer s.capabilitiesMu.RUnlock()
+	return Capabilities{
+		Version:    s.version,
+		Subsystems: append([]Capability{}, s.capabilities...),
+	}
+}
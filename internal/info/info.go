@@ -0,0 +1,467 @@
+package info
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pulsedb/internal/store"
+)
+
+// Sections lists the INFO sections in output order
+var Sections = []string{
+	"server", "clients", "memory", "persistence", "stats",
+	"replication", "commandstats", "keyspace", "workingset",
+}
+
+// defaultSections are reported when INFO is called without arguments;
+// commandstats is left out like in Redis since it grows with every command
+var defaultSections = []string{
+	"server", "clients", "memory", "persistence", "stats",
+	"replication", "keyspace", "workingset",
+}
+
+// Stats accumulates the process-wide counters reported by INFO. A single
+// Stats is shared by every listener; a nil Stats ignores updates.
+type Stats struct {
+	version string
+	started time.Time
+
+	connected  atomic.Int64
+	received   atomic.Int64
+	rejected   atomic.Int64
+	processed  atomic.Int64
+	commandsMu sync.Mutex
+	commands   map[string]*CommandStat
+
+	capabilitiesMu sync.RWMutex
+	capabilities   []Capability
+}
+
+// CommandStat holds the call statistics of one command
+type CommandStat struct {
+	Calls       int64 `json:"calls"`
+	Usec        int64 `json:"usec"`
+	FailedCalls int64 `json:"failed_calls"`
+}
+
+// New creates the statistics of a server running version
+func New(version string) *Stats {
+	return &Stats{
+		version:  version,
+		started:  time.Now(),
+		commands: make(map[string]*CommandStat),
+	}
+}
+
+// ConnectionOpened records an accepted connection
+func (s *Stats) ConnectionOpened() {
+	if s == nil {
+		return
+	}
+	s.connected.Add(1)
+	s.received.Add(1)
+}
+
+// ConnectionClosed records a connection going away
+func (s *Stats) ConnectionClosed() {
+	if s == nil {
+		return
+	}
+	s.connected.Add(-1)
+}
+
+// ConnectionRejected records a connection refused because of a limit
+func (s *Stats) ConnectionRejected() {
+	if s == nil {
+		return
+	}
+	s.rejected.Add(1)
+}
+
+// RecordCommand records one execution of cmd
+func (s *Stats) RecordCommand(cmd string, duration time.Duration, failed bool) {
+	if s == nil {
+		return
+	}
+	s.processed.Add(1)
+
+	s.commandsMu.Lock()
+	defer s.commandsMu.Unlock()
+
+	stat, exists := s.commands[cmd]
+	if !exists {
+		stat = &CommandStat{}
+		s.commands[cmd] = stat
+	}
+	stat.Calls++
+	stat.Usec += duration.Microseconds()
+	if failed {
+		stat.FailedCalls++
+	}
+}
+
+// ServerInfo is the server section
+type ServerInfo struct {
+	Version       string `json:"version"`
+	GoVersion     string `json:"go_version"`
+	OS            string `json:"os"`
+	Arch          string `json:"arch"`
+	ProcessID     int    `json:"process_id"`
+	UptimeSeconds int64  `json:"uptime_in_seconds"`
+	UptimeDays    int64  `json:"uptime_in_days"`
+}
+
+// ClientsInfo is the clients section
+type ClientsInfo struct {
+	Connected int64 `json:"connected_clients"`
+}
+
+// MemoryInfo is the memory section, read from runtime.MemStats
+type MemoryInfo struct {
+	Used        uint64 `json:"used_memory"`
+	UsedHuman   string `json:"used_memory_human"`
+	System      uint64 `json:"used_memory_sys"`
+	HeapObjects uint64 `json:"heap_objects"`
+	TotalAlloc  uint64 `json:"total_alloc"`
+	GCRuns      uint32 `json:"gc_runs"`
+	GCPauseMs   int64  `json:"gc_pause_total_ms"`
+}
+
+// PersistenceInfo is the persistence section. PulseDB is memory only, so
+// nothing is ever loaded or saved.
+type PersistenceInfo struct {
+	Loading bool `json:"loading"`
+	Enabled bool `json:"persistence_enabled"`
+}
+
+// StatsInfo is the stats section
+type StatsInfo struct {
+	ConnectionsReceived int64 `json:"total_connections_received"`
+	ConnectionsRejected int64 `json:"rejected_connections"`
+	CommandsProcessed   int64 `json:"total_commands_processed"`
+	ExpiredKeys         int64 `json:"expired_keys"`
+	ExpiredKeysLazy     int64 `json:"expired_keys_lazy"`
+	ExpiryBatch         int   `json:"expiry_batch_size"`
+	ExpiryBacklog       int   `json:"expiry_backlog"`
+	ExpiryDeferred      int64 `json:"expiry_deferred_ticks"`
+}
+
+// ReplicationInfo is the replication section
+type ReplicationInfo struct {
+	Role            string `json:"role"`
+	ConnectedSlaves int    `json:"connected_slaves"`
+}
+
+// KeyspaceInfo is the keyspace section
+type KeyspaceInfo struct {
+	Keys               int   `json:"keys"`
+	DefaultTTLPatterns int   `json:"default_ttl_patterns"`
+	DefaultTTLApplied  int64 `json:"default_ttl_applied"`
+	ShardKeys          []int `json:"shard_keys"`
+
+	// Logical databases holding keys; Keys and ShardKeys count database 0
+	Databases []DatabaseInfo `json:"databases"`
+}
+
+// DatabaseInfo is the size of one logical database
+type DatabaseInfo struct {
+	Index   int `json:"index"`
+	Keys    int `json:"keys"`
+	Expires int `json:"expires"`
+}
+
+// WorkingSetInfo is the workingset section, from the store's periodic
+// estimate
+type WorkingSetInfo struct {
+	EstimatedAt int64                 `json:"estimated_at"`
+	Keys        int                   `json:"keys"`
+	Bytes       int64                 `json:"bytes"`
+	Windows     map[string]WindowInfo `json:"windows"`
+	ColdKeys    int                   `json:"cold_keys"`
+	ColdBytes   int64                 `json:"cold_bytes"`
+
+	labels []string // Window labels from shortest to longest
+}
+
+// WindowInfo is the working set over one window
+type WindowInfo struct {
+	Keys  int   `json:"keys"`
+	Bytes int64 `json:"bytes"`
+}
+
+// Report is a snapshot of every INFO section
+type Report struct {
+	Server       ServerInfo             `json:"server"`
+	Clients      ClientsInfo            `json:"clients"`
+	Memory       MemoryInfo             `json:"memory"`
+	Persistence  PersistenceInfo        `json:"persistence"`
+	Stats        StatsInfo              `json:"stats"`
+	Replication  ReplicationInfo        `json:"replication"`
+	CommandStats map[string]CommandStat `json:"commandstats"`
+	Keyspace     KeyspaceInfo           `json:"keyspace"`
+	WorkingSet   WorkingSetInfo         `json:"workingset"`
+}
+
+// Collect takes a snapshot of the statistics and of db
+func (s *Stats) Collect(db *store.Store) *Report {
+	now := time.Now()
+	uptime := int64(now.Sub(s.started).Seconds())
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	report := &Report{
+		Server: ServerInfo{
+			Version:       s.version,
+			GoVersion:     runtime.Version(),
+			OS:            runtime.GOOS,
+			Arch:          runtime.GOARCH,
+			ProcessID:     os.Getpid(),
+			UptimeSeconds: uptime,
+			UptimeDays:    uptime / 86400,
+		},
+		Clients: ClientsInfo{Connected: s.connected.Load()},
+		Memory: MemoryInfo{
+			Used:        mem.HeapAlloc,
+			UsedHuman:   humanBytes(mem.HeapAlloc),
+			System:      mem.Sys,
+			HeapObjects: mem.HeapObjects,
+			TotalAlloc:  mem.TotalAlloc,
+			GCRuns:      mem.NumGC,
+			GCPauseMs:   int64(mem.PauseTotalNs / uint64(time.Millisecond)),
+		},
+		Stats: StatsInfo{
+			ConnectionsReceived: s.received.Load(),
+			ConnectionsRejected: s.rejected.Load(),
+			CommandsProcessed:   s.processed.Load(),
+		},
+		Replication:  ReplicationInfo{Role: "master"},
+		CommandStats: make(map[string]CommandStat),
+	}
+
+	s.commandsMu.Lock()
+	for cmd, stat := range s.commands {
+		report.CommandStats[cmd] = *stat
+	}
+	s.commandsMu.Unlock()
+
+	expiry := db.ExpiryStats()
+	report.Stats.ExpiredKeys = expiry.Expired
+	report.Stats.ExpiredKeysLazy = expiry.Lazy
+	report.Stats.ExpiryBatch = expiry.Batch
+	report.Stats.ExpiryBacklog = expiry.Backlog
+	report.Stats.ExpiryDeferred = expiry.Deferred
+
+	shardKeys := db.ShardKeyCounts()
+	keys := 0
+	for _, n := range shardKeys {
+		keys += n
+	}
+	report.Keyspace = KeyspaceInfo{
+		Keys:               keys,
+		DefaultTTLPatterns: len(db.DefaultTTLs()),
+		DefaultTTLApplied:  db.DefaultTTLsApplied(),
+		ShardKeys:          shardKeys,
+		Databases:          []DatabaseInfo{},
+	}
+	for _, stats := range db.DatabaseStats() {
+		report.Keyspace.Databases = append(report.Keyspace.Databases, DatabaseInfo(stats))
+	}
+
+	estimate := db.WorkingSet()
+	coldKeys, coldBytes := estimate.Cold()
+	report.WorkingSet = WorkingSetInfo{
+		EstimatedAt: estimate.At,
+		Keys:        estimate.Keys,
+		Bytes:       estimate.Bytes,
+		Windows:     make(map[string]WindowInfo, len(estimate.Windows)),
+		ColdKeys:    coldKeys,
+		ColdBytes:   coldBytes,
+	}
+	for _, w := range estimate.Windows {
+		report.WorkingSet.Windows[w.Label()] = WindowInfo{Keys: w.Keys, Bytes: w.Bytes}
+		report.WorkingSet.labels = append(report.WorkingSet.labels, w.Label())
+	}
+
+	return report
+}
+
+// SelectSections resolves INFO arguments to section names. No argument or
+// "default" selects the default sections, "all" and "everything" select
+// every section; unknown names are ignored like in Redis.
+func SelectSections(args []string) []string {
+	if len(args) == 0 {
+		return defaultSections
+	}
+
+	wanted := make(map[string]bool)
+	for _, arg := range args {
+		switch arg = strings.ToLower(arg); arg {
+		case "all", "everything":
+			return Sections
+		case "default":
+			for _, section := range defaultSections {
+				wanted[section] = true
+			}
+		default:
+			wanted[arg] = true
+		}
+	}
+
+	var selected []string
+	for _, section := range Sections {
+		if wanted[section] {
+			selected = append(selected, section)
+		}
+	}
+	return selected
+}
+
+// Field is one name:value line of an INFO section. Value keeps its type
+// (an integer or a string) so structured replies can use native types.
+type Field struct {
+	Name  string
+	Value interface{}
+}
+
+// Fields returns the fields of section in output order
+func (r *Report) Fields(section string) []Field {
+	switch section {
+	case "server":
+		return []Field{
+			{"version", r.Server.Version},
+			{"go_version", r.Server.GoVersion},
+			{"os", r.Server.OS},
+			{"arch", r.Server.Arch},
+			{"process_id", r.Server.ProcessID},
+			{"uptime_in_seconds", r.Server.UptimeSeconds},
+			{"uptime_in_days", r.Server.UptimeDays},
+		}
+	case "clients":
+		return []Field{{"connected_clients", r.Clients.Connected}}
+	case "memory":
+		return []Field{
+			{"used_memory", r.Memory.Used},
+			{"used_memory_human", r.Memory.UsedHuman},
+			{"used_memory_sys", r.Memory.System},
+			{"heap_objects", r.Memory.HeapObjects},
+			{"total_alloc", r.Memory.TotalAlloc},
+			{"gc_runs", r.Memory.GCRuns},
+			{"gc_pause_total_ms", r.Memory.GCPauseMs},
+		}
+	case "persistence":
+		return []Field{
+			{"loading", boolInt(r.Persistence.Loading)},
+			{"persistence_enabled", boolInt(r.Persistence.Enabled)},
+		}
+	case "stats":
+		return []Field{
+			{"total_connections_received", r.Stats.ConnectionsReceived},
+			{"rejected_connections", r.Stats.ConnectionsRejected},
+			{"total_commands_processed", r.Stats.CommandsProcessed},
+			{"expired_keys", r.Stats.ExpiredKeys},
+			{"expired_keys_lazy", r.Stats.ExpiredKeysLazy},
+			{"expiry_batch_size", r.Stats.ExpiryBatch},
+			{"expiry_backlog", r.Stats.ExpiryBacklog},
+			{"expiry_deferred_ticks", r.Stats.ExpiryDeferred},
+		}
+	case "replication":
+		return []Field{
+			{"role", r.Replication.Role},
+			{"connected_slaves", r.Replication.ConnectedSlaves},
+		}
+	case "commandstats":
+		cmds := make([]string, 0, len(r.CommandStats))
+		for cmd := range r.CommandStats {
+			cmds = append(cmds, cmd)
+		}
+		sort.Strings(cmds)
+
+		fields := make([]Field, len(cmds))
+		for i, cmd := range cmds {
+			stat := r.CommandStats[cmd]
+			fields[i] = Field{"cmdstat_" + strings.ToLower(cmd), fmt.Sprintf("calls=%d,usec=%d,usec_per_call=%.2f,failed_calls=%d",
+				stat.Calls, stat.Usec, float64(stat.Usec)/float64(stat.Calls), stat.FailedCalls)}
+		}
+		return fields
+	case "keyspace":
+		fields := []Field{
+			{"keys", r.Keyspace.Keys},
+			{"default_ttl_patterns", r.Keyspace.DefaultTTLPatterns},
+			{"default_ttl_applied", r.Keyspace.DefaultTTLApplied},
+		}
+		for shard, keys := range r.Keyspace.ShardKeys {
+			fields = append(fields, Field{fmt.Sprintf("shard%d", shard), fmt.Sprintf("keys=%d", keys)})
+		}
+		for _, db := range r.Keyspace.Databases {
+			fields = append(fields, Field{fmt.Sprintf("db%d", db.Index), fmt.Sprintf("keys=%d,expires=%d", db.Keys, db.Expires)})
+		}
+		return fields
+	case "workingset":
+		ws := r.WorkingSet
+		fields := []Field{
+			{"estimated_at", ws.EstimatedAt},
+			{"keys", ws.Keys},
+			{"bytes", ws.Bytes},
+		}
+		for _, label := range ws.labels {
+			w := ws.Windows[label]
+			fields = append(fields,
+				Field{"keys_" + label, w.Keys},
+				Field{"bytes_" + label, w.Bytes},
+				Field{"bytes_" + label + "_human", humanBytes(uint64(w.Bytes))},
+			)
+		}
+		return append(fields,
+			Field{"cold_keys", ws.ColdKeys},
+			Field{"cold_bytes", ws.ColdBytes},
+		)
+	}
+	return nil
+}
+
+// Format renders the given sections in the Redis INFO text format
+func (r *Report) Format(sections []string) string {
+	var b strings.Builder
+
+	for i, section := range sections {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString("# " + strings.ToUpper(section[:1]) + section[1:] + "\r\n")
+		for _, f := range r.Fields(section) {
+			fmt.Fprintf(&b, "%s:%v\r\n", f.Name, f.Value)
+		}
+	}
+
+	return b.String()
+}
+
+func boolInt(v bool) int {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// humanBytes formats n bytes like Redis' used_memory_human, e.g. "1.50M"
+func humanBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	value, suffix := float64(n)/unit, "K"
+	for _, next := range []string{"M", "G", "T"} {
+		if value < unit {
+			break
+		}
+		value, suffix = value/unit, next
+	}
+	return fmt.Sprintf("%.2f%s", value, suffix)
+}
@@ -0,0 +1,93 @@
+package info
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"pulsedb/internal/store"
+)
+
+func TestSelectSections(t *testing.T) {
+	if sections := SelectSections(nil); len(sections) != len(defaultSections) {
+		t.Errorf("Expected default sections, got %v", sections)
+	}
+	if sections := SelectSections([]string{"everything"}); len(sections) != len(Sections) {
+		t.Errorf("Expected every section, got %v", sections)
+	}
+
+	// Output order is fixed and unknown sections are ignored
+	sections := SelectSections([]string{"Keyspace", "bogus", "server"})
+	if len(sections) != 2 || sections[0] != "server" || sections[1] != "keyspace" {
+		t.Errorf("Unexpected sections %v", sections)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+	db.Set("a", "1", 0)
+	db.Set("b", "2", 0)
+
+	stats := New("1.2.3")
+	stats.ConnectionOpened()
+	stats.ConnectionOpened()
+	stats.ConnectionClosed()
+	stats.RecordCommand("GET", 3*time.Microsecond, false)
+	stats.RecordCommand("GET", 5*time.Microsecond, true)
+
+	report := stats.Collect(db)
+	if report.Server.Version != "1.2.3" || report.Clients.Connected != 1 || report.Stats.ConnectionsReceived != 2 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if report.Keyspace.Keys != 2 || len(report.Keyspace.ShardKeys) != store.ShardCount {
+		t.Errorf("Unexpected keyspace %+v", report.Keyspace)
+	}
+	if stat := report.CommandStats["GET"]; stat.Calls != 2 || stat.Usec != 8 || stat.FailedCalls != 1 {
+		t.Errorf("Unexpected command stats %+v", stat)
+	}
+	if ws := report.WorkingSet; ws.Keys != 2 || ws.Windows["1m"].Keys != 2 || ws.ColdKeys != 0 {
+		t.Errorf("Unexpected working set %+v", ws)
+	}
+	if text := report.Format([]string{"workingset"}); !strings.Contains(text, "keys_1m:2\r\n") {
+		t.Errorf("Expected keys_1m in %q", text)
+	}
+
+	text := report.Format([]string{"clients", "commandstats"})
+	for _, line := range []string{
+		"# Clients\r\nconnected_clients:1\r\n",
+		"# Commandstats\r\ncmdstat_get:calls=2,usec=8,usec_per_call=4.00,failed_calls=1\r\n",
+	} {
+		if !strings.Contains(text, line) {
+			t.Errorf("Expected %q in %q", line, text)
+		}
+	}
+	if strings.Contains(text, "# Server") {
+		t.Error("Expected unselected sections to be left out")
+	}
+}
+
+func TestStatsNil(t *testing.T) {
+	var stats *Stats
+	stats.ConnectionOpened()
+	stats.RecordCommand("GET", time.Millisecond, false)
+}
+
+func TestCapabilities(t *testing.T) {
+	stats := New("1.2.3")
+	if caps := stats.Capabilities(); caps.Version != "1.2.3" || len(caps.Subsystems) != 0 {
+		t.Errorf("Expected no subsystems by default, got %+v", caps)
+	}
+
+	stats.SetCapabilities([]Capability{
+		{Name: "wasm", Enabled: false},
+		{Name: "resp", Enabled: true, Version: "3", Limits: map[string]int64{"max_clients": 10}},
+	})
+	caps := stats.Capabilities()
+	if len(caps.Subsystems) != 2 || caps.Subsystems[0].Name != "resp" || caps.Subsystems[1].Name != "wasm" {
+		t.Fatalf("Expected subsystems sorted by name, got %+v", caps.Subsystems)
+	}
+	if caps.Subsystems[0].Limits["max_clients"] != 10 {
+		t.Errorf("Expected the resp limits, got %+v", caps.Subsystems[0])
+	}
+}
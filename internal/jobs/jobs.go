@@ -0,0 +1,217 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultRetain is the number of finished jobs a manager keeps
+const DefaultRetain = 100
+
+// Status is the state of a job
+type Status string
+
+const (
+	Running   Status = "running"
+	Succeeded Status = "succeeded"
+	Failed    Status = "failed"
+	Canceled  Status = "canceled"
+)
+
+// Func is the work of a job. It should return once ctx is done and report
+// its progress through job.
+type Func func(ctx context.Context, job *Job) (result interface{}, err error)
+
+// Job is a long-running operation started by a Manager
+type Job struct {
+	id      string
+	kind    string
+	created time.Time
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	mu       sync.Mutex
+	status   Status
+	progress int
+	total    int
+	finished time.Time
+	err      string
+	result   interface{}
+}
+
+// Snapshot is the state of a job at one point in time
+type Snapshot struct {
+	ID       string `json:"id"`
+	Kind     string `json:"kind"`
+	Status   Status `json:"status"`
+	Done     int    `json:"done"`  // Units of work completed
+	Total    int    `json:"total"` // Units of work expected, 0 if unknown
+	Created  int64  `json:"created"`
+	Finished int64  `json:"finished,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ID returns the identifier of the job
+func (j *Job) ID() string {
+	return j.id
+}
+
+// Kind returns the kind of work the job does
+func (j *Job) Kind() string {
+	return j.kind
+}
+
+// Progress records that done of total units of work are complete
+func (j *Job) Progress(done, total int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.progress, j.total = done, total
+}
+
+// Cancel asks the job to stop. It has no effect once the job has finished.
+func (j *Job) Cancel() {
+	j.cancel()
+}
+
+// Done returns a channel closed once the job has finished
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Result returns the result of a job that succeeded
+func (j *Job) Result() (interface{}, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.result, j.status == Succeeded
+}
+
+// Snapshot returns the current state of the job
+func (j *Job) Snapshot() Snapshot {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	snapshot := Snapshot{
+		ID:      j.id,
+		Kind:    j.kind,
+		Status:  j.status,
+		Done:    j.progress,
+		Total:   j.total,
+		Created: j.created.UnixMilli(),
+		Error:   j.err,
+	}
+	if !j.finished.IsZero() {
+		snapshot.Finished = j.finished.UnixMilli()
+	}
+	return snapshot
+}
+
+// finish records the outcome of the job's work
+func (j *Job) finish(ctx context.Context, result interface{}, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.finished = time.Now()
+	switch {
+	case err != nil && errors.Is(err, ctx.Err()):
+		j.status = Canceled
+	case err != nil:
+		j.status, j.err = Failed, err.Error()
+	default:
+		j.status, j.result = Succeeded, result
+	}
+}
+
+// Manager runs jobs in the background and keeps the most recent finished
+// ones for their status and results. It is safe for concurrent use.
+type Manager struct {
+	retain int
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewManager creates a manager keeping up to retain finished jobs
+func NewManager(retain int) *Manager {
+	return &Manager{retain: max(retain, 1), jobs: make(map[string]*Job)}
+}
+
+// Start runs fn in the background as a job of kind and returns it at once
+func (m *Manager) Start(kind string, fn Func) *Job {
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &Job{
+		id:      newID(),
+		kind:    kind,
+		created: time.Now(),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		status:  Running,
+	}
+
+	m.mu.Lock()
+	m.jobs[job.id] = job
+	m.mu.Unlock()
+
+	go func() {
+		defer close(job.done)
+		defer cancel()
+		result, err := fn(ctx, job)
+		job.finish(ctx, result, err)
+		m.prune()
+	}()
+
+	return job
+}
+
+// Get returns the job with the given ID
+func (m *Manager) Get(id string) (*Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, exists := m.jobs[id]
+	return job, exists
+}
+
+// List returns every job, oldest first
+func (m *Manager) List() []*Job {
+	m.mu.Lock()
+	jobs := make([]*Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		jobs = append(jobs, job)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].created.Equal(jobs[j].created) {
+			return jobs[i].created.Before(jobs[j].created)
+		}
+		return jobs[i].id < jobs[j].id
+	})
+	return jobs
+}
+
+// prune forgets the oldest finished jobs beyond the retained number
+func (m *Manager) prune() {
+	var finished []*Job
+	for _, job := range m.List() {
+		if job.Snapshot().Status != Running {
+			finished = append(finished, job)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := 0; i < len(finished)-m.retain; i++ {
+		delete(m.jobs, finished[i].id)
+	}
+}
+
+// newID returns a random job identifier
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,77 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestManager(t *testing.T) {
+	m := NewManager(10)
+
+	ok := m.Start("sum", func(ctx context.Context, job *Job) (interface{}, error) {
+		job.Progress(2, 2)
+		return 42, nil
+	})
+	<-ok.Done()
+	if s := ok.Snapshot(); s.Status != Succeeded || s.Done != 2 || s.Total != 2 || s.Finished == 0 {
+		t.Errorf("Unexpected snapshot %+v", s)
+	}
+	if result, succeeded := ok.Result(); !succeeded || result != 42 {
+		t.Errorf("Expected result 42, got %v (%v)", result, succeeded)
+	}
+
+	failed := m.Start("fail", func(ctx context.Context, job *Job) (interface{}, error) {
+		return nil, errors.New("boom")
+	})
+	<-failed.Done()
+	if s := failed.Snapshot(); s.Status != Failed || s.Error != "boom" {
+		t.Errorf("Unexpected snapshot %+v", s)
+	}
+	if _, succeeded := failed.Result(); succeeded {
+		t.Error("Expected no result for a failed job")
+	}
+
+	started := make(chan struct{})
+	canceled := m.Start("wait", func(ctx context.Context, job *Job) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	<-started
+	if s := canceled.Snapshot(); s.Status != Running {
+		t.Errorf("Expected a running job, got %s", s.Status)
+	}
+	canceled.Cancel()
+	<-canceled.Done()
+	if s := canceled.Snapshot(); s.Status != Canceled {
+		t.Errorf("Expected a canceled job, got %s", s.Status)
+	}
+
+	if job, exists := m.Get(ok.ID()); !exists || job != ok {
+		t.Error("Expected to find the job by ID")
+	}
+	if _, exists := m.Get("missing"); exists {
+		t.Error("Expected no job for an unknown ID")
+	}
+	if jobs := m.List(); len(jobs) != 3 || jobs[0] != ok {
+		t.Errorf("Expected 3 jobs oldest first, got %d", len(jobs))
+	}
+}
+
+func TestManagerRetain(t *testing.T) {
+	m := NewManager(2)
+	for i := 0; i < 5; i++ {
+		job := m.Start("noop", func(ctx context.Context, job *Job) (interface{}, error) {
+			return nil, nil
+		})
+		<-job.Done()
+	}
+	// The last job is pruned after Done closes
+	for len(m.List()) > 2 {
+		m.prune()
+	}
+	if n := len(m.List()); n != 2 {
+		t.Errorf("Expected 2 retained jobs, got %d", n)
+	}
+}
@@ -0,0 +1,256 @@
+// Package jsonpath implements the subset of JSONPath used by the JSON
+// commands: a root ($) followed by object keys (.name or ['name']) and array
+// indexes ([0], negative from the end). Documents are the values produced by
+// Decode and are never modified in place: updates copy the objects and
+// arrays along the path and share everything else, so earlier versions of a
+// document stay intact.
+package jsonpath
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Segment is one step of a path: an object key or an array index
+type Segment struct {
+	Key     string
+	Index   int
+	IsIndex bool
+}
+
+// Path is a parsed path; the empty path is the document root
+type Path []Segment
+
+// Parse parses a path such as $.user.tags[0] or $['first name']. The legacy
+// forms "." and ".name" are accepted as the root and $.name.
+func Parse(expr string) (Path, error) {
+	rest, rooted := strings.CutPrefix(expr, "$")
+	if !rooted {
+		if !strings.HasPrefix(expr, ".") {
+			return nil, fmt.Errorf("path must start with '$'")
+		}
+		if expr == "." {
+			return Path{}, nil
+		}
+	}
+
+	path := Path{}
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, fmt.Errorf("empty key in path '%s'", expr)
+			}
+			path = append(path, Segment{Key: key})
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated '[' in path '%s'", expr)
+			}
+			inner := rest[1:end]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				path = append(path, Segment{Key: inner[1 : len(inner)-1]})
+			} else {
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid index '%s' in path '%s'", inner, expr)
+				}
+				path = append(path, Segment{Index: index, IsIndex: true})
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("unexpected '%c' in path '%s'", rest[0], expr)
+		}
+	}
+	return path, nil
+}
+
+// String renders the path in the $.key[index] form
+func (p Path) String() string {
+	var b strings.Builder
+	b.WriteByte('$')
+	for _, seg := range p {
+		switch {
+		case seg.IsIndex:
+			fmt.Fprintf(&b, "[%d]", seg.Index)
+		case strings.ContainsAny(seg.Key, ".[]'\""):
+			fmt.Fprintf(&b, "[%q]", seg.Key)
+		default:
+			b.WriteByte('.')
+			b.WriteString(seg.Key)
+		}
+	}
+	return b.String()
+}
+
+// Decode parses a JSON document, keeping numbers as json.Number so integers
+// keep their exact digits
+func Decode(data string) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the JSON value")
+	}
+	return doc, nil
+}
+
+// Encode renders a document as compact JSON without HTML escaping
+func Encode(doc interface{}) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(doc)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// Get returns the value at the path
+func (p Path) Get(doc interface{}) (interface{}, bool) {
+	for _, seg := range p {
+		var ok bool
+		if doc, ok = child(doc, seg); !ok {
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// Set returns a copy of doc with the value at the path replaced by value.
+// The parent of the path must exist; a missing last key is added to its
+// object, but arrays are not extended.
+func (p Path) Set(doc, value interface{}) (interface{}, error) {
+	if len(p) == 0 {
+		return value, nil
+	}
+
+	seg, rest := p[0], p[1:]
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		if seg.IsIndex {
+			break
+		}
+		current, exists := node[seg.Key]
+		if !exists && len(rest) > 0 {
+			return nil, fmt.Errorf("path does not exist")
+		}
+		updated, err := rest.Set(current, value)
+		if err != nil {
+			return nil, err
+		}
+		copied := make(map[string]interface{}, len(node)+1)
+		for k, v := range node {
+			copied[k] = v
+		}
+		copied[seg.Key] = updated
+		return copied, nil
+	case []interface{}:
+		if !seg.IsIndex {
+			break
+		}
+		i, ok := resolve(seg.Index, len(node))
+		if !ok {
+			return nil, fmt.Errorf("index %d out of range", seg.Index)
+		}
+		updated, err := rest.Set(node[i], value)
+		if err != nil {
+			return nil, err
+		}
+		copied := make([]interface{}, len(node))
+		copy(copied, node)
+		copied[i] = updated
+		return copied, nil
+	}
+	return nil, fmt.Errorf("path does not exist")
+}
+
+// Delete returns a copy of doc without the value at the path, and whether
+// there was one. The root cannot be deleted.
+func (p Path) Delete(doc interface{}) (interface{}, bool) {
+	if len(p) == 0 {
+		return doc, false
+	}
+
+	seg, rest := p[0], p[1:]
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		current, exists := node[seg.Key]
+		if seg.IsIndex || !exists {
+			return doc, false
+		}
+		copied := make(map[string]interface{}, len(node))
+		for k, v := range node {
+			copied[k] = v
+		}
+		if len(rest) == 0 {
+			delete(copied, seg.Key)
+			return copied, true
+		}
+		updated, deleted := rest.Delete(current)
+		if !deleted {
+			return doc, false
+		}
+		copied[seg.Key] = updated
+		return copied, true
+	case []interface{}:
+		i, ok := resolve(seg.Index, len(node))
+		if !seg.IsIndex || !ok {
+			return doc, false
+		}
+		if len(rest) == 0 {
+			copied := make([]interface{}, 0, len(node)-1)
+			copied = append(copied, node[:i]...)
+			return append(copied, node[i+1:]...), true
+		}
+		updated, deleted := rest.Delete(node[i])
+		if !deleted {
+			return doc, false
+		}
+		copied := make([]interface{}, len(node))
+		copy(copied, node)
+		copied[i] = updated
+		return copied, true
+	}
+	return doc, false
+}
+
+// child returns the value seg selects in node
+func child(node interface{}, seg Segment) (interface{}, bool) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if seg.IsIndex {
+			return nil, false
+		}
+		v, ok := n[seg.Key]
+		return v, ok
+	case []interface{}:
+		i, ok := resolve(seg.Index, len(n))
+		if !seg.IsIndex || !ok {
+			return nil, false
+		}
+		return n[i], true
+	}
+	return nil, false
+}
+
+// resolve turns a possibly negative index into a position in an array of
+// length n
+func resolve(index, n int) (int, bool) {
+	if index < 0 {
+		index += n
+	}
+	return index, index >= 0 && index < n
+}
@@ -0,0 +1,90 @@
+package jsonpath
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := map[string]Path{
+		"$":                 {},
+		".":                 {},
+		"$.a.b":             {{Key: "a"}, {Key: "b"}},
+		".a":                {{Key: "a"}},
+		"$.tags[0]":         {{Key: "tags"}, {Index: 0, IsIndex: true}},
+		"$.tags[-1]":        {{Key: "tags"}, {Index: -1, IsIndex: true}},
+		"$['first name'].x": {{Key: "first name"}, {Key: "x"}},
+		`$["a.b"]`:          {{Key: "a.b"}},
+	}
+	for expr, expected := range tests {
+		path, err := Parse(expr)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(path, expected) {
+			t.Errorf("%s: expected %+v, got %+v", expr, expected, path)
+		}
+	}
+
+	for _, expr := range []string{"a", "$a", "$.", "$.a..b", "$[x]", "$[0"} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("%s: expected an error", expr)
+		}
+	}
+
+	if path, _ := Parse(`$.a["b.c"][2]`); path.String() != `$.a["b.c"][2]` {
+		t.Errorf("Unexpected path string %s", path)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	doc, err := Decode(`{"user":{"name":"ada","tags":["a","b"]},"n":12345678901234567890}`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	path, _ := Parse("$.user.tags[-1]")
+	updated, err := path.Set(doc, "c")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := Encode(updated); got != `{"n":12345678901234567890,"user":{"name":"ada","tags":["a","c"]}}` {
+		t.Errorf("Unexpected document %s", got)
+	}
+
+	// The original document is left untouched
+	if got := Encode(doc); got != `{"n":12345678901234567890,"user":{"name":"ada","tags":["a","b"]}}` {
+		t.Errorf("Original document was modified: %s", got)
+	}
+
+	added, _ := Parse("$.user.age")
+	if updated, err = added.Set(updated, 36.0); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if v, ok := added.Get(updated); !ok || v != 36.0 {
+		t.Errorf("Expected the added field, got %v", v)
+	}
+
+	missing, _ := Parse("$.user.address.city")
+	if _, err := missing.Set(updated, "x"); err == nil {
+		t.Error("Expected a missing parent to be rejected")
+	}
+	outOfRange, _ := Parse("$.user.tags[5]")
+	if _, err := outOfRange.Set(updated, "x"); err == nil {
+		t.Error("Expected an index out of range to be rejected")
+	}
+
+	tag, _ := Parse("$.user.tags[0]")
+	updated, deleted := tag.Delete(updated)
+	if !deleted || Encode(updated) != `{"n":12345678901234567890,"user":{"age":36,"name":"ada","tags":["c"]}}` {
+		t.Errorf("Unexpected document after delete %s", Encode(updated))
+	}
+	if _, deleted := missing.Delete(updated); deleted {
+		t.Error("Expected deleting a missing path to report false")
+	}
+
+	if _, err := Decode(`{"a":1} {"b":2}`); err == nil {
+		t.Error("Expected trailing data to be rejected")
+	}
+}
@@ -0,0 +1,151 @@
+package latency
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultThreshold = 100 * time.Millisecond
+
+	// HistoryLen is the number of samples kept per event, like Redis
+	HistoryLen = 160
+)
+
+// Sample is the worst latency of an event within one second
+type Sample struct {
+	Time    int64 `json:"time"`       // Unix seconds
+	Latency int64 `json:"latency_ms"` // Milliseconds
+}
+
+// Event is the latest and worst spike of one event
+type Event struct {
+	Name   string `json:"name"`
+	Latest Sample `json:"latest"`
+	Max    int64  `json:"max_ms"` // Worst latency since the event was created or reset
+}
+
+// history is a ring buffer of the samples of one event
+type history struct {
+	samples [HistoryLen]Sample
+	next    int // Position of the next write
+	count   int
+	max     int64
+}
+
+// latest returns the most recent sample
+func (h *history) latest() Sample {
+	return h.samples[(h.next-1+HistoryLen)%HistoryLen]
+}
+
+// Monitor records latency spikes: every command running for at least the
+// threshold adds a sample to the history of its event, named after the
+// command in lowercase. Spikes of one event within the same second are
+// merged into one sample holding the worst latency, and only the
+// HistoryLen most recent samples are kept, so the oldest ones rotate out.
+// It is safe for concurrent use.
+type Monitor struct {
+	threshold time.Duration // Zero or negative disables the monitor; immutable
+
+	mu     sync.Mutex
+	events map[string]*history
+}
+
+// New creates a monitor recording spikes of at least threshold. A zero or
+// negative threshold disables it.
+func New(threshold time.Duration) *Monitor {
+	return &Monitor{threshold: threshold, events: make(map[string]*history)}
+}
+
+// Threshold returns the latency from which spikes are recorded
+func (m *Monitor) Threshold() time.Duration {
+	return m.threshold
+}
+
+// Record adds a sample to the history of event if duration reaches the
+// threshold. Faster commands return without locking or allocating.
+func (m *Monitor) Record(event string, duration time.Duration) {
+	if m == nil || m.threshold <= 0 || duration < m.threshold {
+		return
+	}
+	m.record(strings.ToLower(event), Sample{Time: time.Now().Unix(), Latency: duration.Milliseconds()})
+}
+
+func (m *Monitor) record(event string, sample Sample) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h, exists := m.events[event]
+	if !exists {
+		h = &history{}
+		m.events[event] = h
+	}
+	h.max = max(h.max, sample.Latency)
+	if h.count > 0 {
+		if last := &h.samples[(h.next-1+HistoryLen)%HistoryLen]; last.Time == sample.Time {
+			last.Latency = max(last.Latency, sample.Latency)
+			return
+		}
+	}
+	h.samples[h.next] = sample
+	h.next = (h.next + 1) % HistoryLen
+	if h.count < HistoryLen {
+		h.count++
+	}
+}
+
+// Latest returns the latest and worst spike of every event, by name
+func (m *Monitor) Latest() []Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := make([]Event, 0, len(m.events))
+	for name, h := range m.events {
+		events = append(events, Event{Name: name, Latest: h.latest(), Max: h.max})
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Name < events[j].Name
+	})
+	return events
+}
+
+// History returns the samples of event, oldest first
+func (m *Monitor) History(event string) []Sample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h, exists := m.events[strings.ToLower(event)]
+	if !exists {
+		return nil
+	}
+	samples := make([]Sample, h.count)
+	for i := range samples {
+		samples[i] = h.samples[(h.next-h.count+i+HistoryLen)%HistoryLen]
+	}
+	return samples
+}
+
+// Reset drops the history of the given events, or of every event if none
+// is given, and returns how many it dropped
+func (m *Monitor) Reset(events ...string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(events) == 0 {
+		dropped := len(m.events)
+		m.events = make(map[string]*history)
+		return dropped
+	}
+	dropped := 0
+	for _, event := range events {
+		event = strings.ToLower(event)
+		if _, exists := m.events[event]; exists {
+			delete(m.events, event)
+			dropped++
+		}
+	}
+	return dropped
+}
@@ -0,0 +1,60 @@
+package latency
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMonitor(t *testing.T) {
+	m := New(10 * time.Millisecond)
+
+	m.Record("GET", time.Millisecond)
+	if len(m.Latest()) != 0 {
+		t.Fatal("Expected latencies under the threshold to be ignored")
+	}
+
+	m.Record("GET", 20*time.Millisecond)
+	m.Record("get", 50*time.Millisecond)
+	m.Record("SET", 15*time.Millisecond)
+	events := m.Latest()
+	if len(events) != 2 || events[0].Name != "get" || events[1].Name != "set" {
+		t.Fatalf("Unexpected events %+v", events)
+	}
+	if events[0].Max != 50 {
+		t.Errorf("Expected a max of 50ms, got %+v", events[0])
+	}
+
+	// Spikes within one second are merged, keeping the worst
+	if history := m.History("GET"); len(history) != 1 || history[0].Latency != 50 {
+		t.Errorf("Expected one merged sample, got %+v", history)
+	}
+
+	if dropped := m.Reset("set", "missing"); dropped != 1 {
+		t.Errorf("Expected 1 event reset, got %d", dropped)
+	}
+	if dropped := m.Reset(); dropped != 1 || len(m.Latest()) != 0 {
+		t.Errorf("Expected every event to be reset, got %d", dropped)
+	}
+
+	var disabled *Monitor
+	disabled.Record("GET", time.Hour)
+	New(0).Record("GET", time.Hour)
+}
+
+func TestMonitorRotation(t *testing.T) {
+	m := New(time.Millisecond)
+	for i := int64(0); i < HistoryLen+10; i++ {
+		m.record("get", Sample{Time: 1000 + i, Latency: i})
+	}
+
+	history := m.History("get")
+	if len(history) != HistoryLen {
+		t.Fatalf("Expected %d samples, got %d", HistoryLen, len(history))
+	}
+	if history[0].Time != 1010 || history[HistoryLen-1].Time != 1000+HistoryLen+9 {
+		t.Errorf("Expected the oldest samples to rotate out, got %+v ... %+v", history[0], history[HistoryLen-1])
+	}
+	if latest := m.Latest()[0]; latest.Latest.Latency != HistoryLen+9 || latest.Max != HistoryLen+9 {
+		t.Errorf("Unexpected latest event %+v", latest)
+	}
+}
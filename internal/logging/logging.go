@@ -0,0 +1,194 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultMaxSize is the size in bytes a log file may reach before it is
+	// rotated
+	DefaultMaxSize = 100 << 20
+
+	// DefaultMaxBackups is the number of rotated log files kept
+	DefaultMaxBackups = 5
+)
+
+// Options configures the process logger
+type Options struct {
+	Level  slog.Level
+	Format string // "text" or "json"
+
+	// File is the path logs are written to, stderr if empty. It is rotated
+	// once it reaches MaxSize bytes (0 disables rotation), keeping
+	// MaxBackups older files as File.1, File.2 and so on.
+	File       string
+	MaxSize    int64
+	MaxBackups int
+}
+
+// DefaultOptions logs info and above as text to stderr
+var DefaultOptions = Options{
+	Level:      slog.LevelInfo,
+	Format:     "text",
+	MaxSize:    DefaultMaxSize,
+	MaxBackups: DefaultMaxBackups,
+}
+
+// ParseLevel parses debug, info, warn or error
+func ParseLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return 0, fmt.Errorf("invalid log level '%s', expected debug, info, warn or error", value)
+	}
+	return level, nil
+}
+
+// ParseFormat checks a log format is text or json
+func ParseFormat(value string) (string, error) {
+	switch format := strings.ToLower(value); format {
+	case "text", "json":
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid log format '%s', expected text or json", value)
+	}
+}
+
+// New builds a logger from opts. The returned closer releases the log file,
+// if any.
+func New(opts Options) (*slog.Logger, io.Closer, error) {
+	var out io.WriteCloser = nopCloser{os.Stderr}
+	if opts.File != "" {
+		file, err := OpenRotating(opts.File, opts.MaxSize, opts.MaxBackups)
+		if err != nil {
+			return nil, nil, err
+		}
+		out = file
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: opts.Level}
+	var handler slog.Handler
+	if opts.Format == "json" {
+		handler = slog.NewJSONHandler(out, handlerOpts)
+	} else {
+		handler = slog.NewTextHandler(out, handlerOpts)
+	}
+	return slog.New(handler), out, nil
+}
+
+// RotatingFile is a log file that is renamed to File.1 once it reaches its
+// maximum size, shifting older backups up and dropping the oldest
+type RotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// OpenRotating opens path for appending, rotating it past maxSize bytes
+// (0 never rotates) and keeping maxBackups rotated files
+func OpenRotating(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	if maxSize < 0 || maxBackups < 0 {
+		return nil, fmt.Errorf("log max size and backups must not be negative")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	r := &RotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Write appends p to the file, rotating first if p would take it past its
+// maximum size. A record is never split across files.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Close closes the file
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// open opens the current file for appending. The caller must hold the lock
+// or own r.
+func (r *RotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file = file
+	r.size = stat.Size()
+	return nil
+}
+
+// rotate shifts the backups up by one and starts a new file. The caller
+// must hold the lock.
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	r.file = nil
+
+	if r.maxBackups == 0 {
+		os.Remove(r.path)
+	} else {
+		os.Remove(r.backup(r.maxBackups))
+		for i := r.maxBackups - 1; i >= 1; i-- {
+			os.Rename(r.backup(i), r.backup(i+1))
+		}
+		if err := os.Rename(r.path, r.backup(1)); err != nil {
+			return err
+		}
+	}
+	return r.open()
+}
+
+// backup returns the path of the n-th most recent rotated file
+func (r *RotatingFile) backup(n int) string {
+	return fmt.Sprintf("%s.%d", r.path, n)
+}
+
+// nopCloser keeps stderr open when the logger is closed
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
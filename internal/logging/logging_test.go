@@ -0,0 +1,99 @@
+package logging
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	if level, err := ParseLevel("WARN"); err != nil || level != slog.LevelWarn {
+		t.Errorf("Expected warn, got %v, %v", level, err)
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("Expected an unknown level to fail")
+	}
+	if format, err := ParseFormat("JSON"); err != nil || format != "json" {
+		t.Errorf("Expected json, got %q, %v", format, err)
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("Expected an unknown format to fail")
+	}
+}
+
+func TestNew(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "pulsedb.log")
+	logger, closer, err := New(Options{Level: slog.LevelWarn, Format: "json", File: path})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	logger.Info("dropped")
+	logger.Warn("kept", "key", "value")
+	closer.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected only the warning to be logged, got %q", data)
+	}
+	var record map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("Expected a JSON record, got %q", lines[0])
+	}
+	if record["msg"] != "kept" || record["key"] != "value" || record["level"] != "WARN" {
+		t.Errorf("Unexpected record %v", record)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pulsedb.log")
+	file, err := OpenRotating(path, 10, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer file.Close()
+
+	for _, record := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := file.Write([]byte(record)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// Every record overflows the 10 byte limit, so each gets its own file
+	// and the oldest falls off past two backups
+	expected := map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	}
+	for name, content := range expected {
+		data, err := os.ReadFile(name)
+		if err != nil || string(data) != content {
+			t.Errorf("Expected %s to hold %q, got %q, %v", name, content, data, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expected at most 2 backups, got %v", err)
+	}
+
+	// Reopening appends to the current file and keeps counting its size
+	file.Close()
+	file, err = OpenRotating(path, 10, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	file.Write([]byte("fifth\n"))
+	if data, _ := os.ReadFile(path + ".1"); string(data) != "fourth\n" {
+		t.Errorf("Expected the reopened file to rotate, got %q", data)
+	}
+
+	if _, err := OpenRotating(path, -1, 0); err == nil {
+		t.Error("Expected a negative size to be rejected")
+	}
+}
@@ -1,17 +1,46 @@
 package metrics
 
 import (
+	"context"
+	"runtime"
+	"strconv"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
-// Metrics holds all the Prometheus metrics
+// Metrics holds all the Prometheus metrics. A nil *Metrics is valid and
+// records nothing, so components can be built without instrumentation.
 type Metrics struct {
 	CommandsTotal     *prometheus.CounterVec
 	CommandDuration   *prometheus.HistogramVec
 	ConnectionsActive prometheus.Gauge
 	KeysTotal         prometheus.Gauge
 	MemoryUsage       prometheus.Gauge
+	MemorySystem      prometheus.Gauge
+	VersionsTotal     prometheus.Gauge
+	ShardKeys         *prometheus.GaugeVec
+	TTLWheelEntries   prometheus.Gauge
+	NamespaceBytes    *prometheus.CounterVec
+	ThrottledTotal    *prometheus.CounterVec
+	RateLimitedTotal  *prometheus.CounterVec
+	ReaderPoolGets    *prometheus.CounterVec
+	ReadBufferSize    prometheus.Gauge
+	RepliesTooLarge   prometheus.Counter
+	RepliesTruncated  prometheus.Counter
+	OutputEvictions   *prometheus.CounterVec
+	WASMInvocations   *prometheus.CounterVec
+	WASMDuration      *prometheus.HistogramVec
+	WASMMemory        *prometheus.GaugeVec
+	WASMFailures      *prometheus.CounterVec
+	WorkingSetKeys    *prometheus.GaugeVec
+	WorkingSetBytes   *prometheus.GaugeVec
+	EventLoopLag      prometheus.Histogram
+	DispatchProbe     prometheus.Histogram
+	GCPauseMax        prometheus.Gauge
+	SchedLatencyMax   prometheus.Gauge
+	Stalls            *prometheus.CounterVec
 }
 
 // NewMetrics creates a new metrics instance
@@ -50,30 +79,387 @@ func NewMetrics() *Metrics {
 				Help: "Memory usage in bytes",
 			},
 		),
+		MemorySystem: promauto.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "pulsedb_memory_sys_bytes",
+				Help: "Memory obtained from the OS by the Go runtime in bytes",
+			},
+		),
+		VersionsTotal: promauto.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "pulsedb_versions_total",
+				Help: "Total number of versions held by every key",
+			},
+		),
+		ShardKeys: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "pulsedb_shard_keys",
+				Help: "Number of keys held by each shard",
+			},
+			[]string{"shard"},
+		),
+		TTLWheelEntries: promauto.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "pulsedb_ttl_wheel_entries",
+				Help: "Number of keys scheduled to expire in the TTL wheel",
+			},
+		),
+		NamespaceBytes: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "pulsedb_namespace_bytes_total",
+				Help: "Bytes transferred by namespaces with a bandwidth quota",
+			},
+			[]string{"namespace", "direction"},
+		),
+		ThrottledTotal: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "pulsedb_throttled_total",
+				Help: "Number of commands refused by a namespace bandwidth quota",
+			},
+			[]string{"namespace", "direction"},
+		),
+		RateLimitedTotal: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "pulsedb_rate_limited_total",
+				Help: "Number of commands refused by a client command rate limit",
+			},
+			[]string{"class"},
+		),
+		ReaderPoolGets: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "pulsedb_reader_pool_gets_total",
+				Help: "Connection readers taken from the pool, by whether they were reused (hit) or allocated (miss)",
+			},
+			[]string{"result"},
+		),
+		ReadBufferSize: promauto.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "pulsedb_read_buffer_size_bytes",
+				Help: "Read buffer size given to new connections, sized by observed requests",
+			},
+		),
+		RepliesTooLarge: promauto.NewCounter(
+			prometheus.CounterOpts{
+				Name: "pulsedb_replies_too_large_total",
+				Help: "Number of replies refused for exceeding the client memory limit",
+			},
+		),
+		RepliesTruncated: promauto.NewCounter(
+			prometheus.CounterOpts{
+				Name: "pulsedb_replies_truncated_total",
+				Help: "Number of replies truncated for exceeding the max response size",
+			},
+		),
+		OutputEvictions: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "pulsedb_client_output_evictions_total",
+				Help: "Number of clients disconnected for exceeding their output buffer limit, by client class",
+			},
+			[]string{"class"},
+		),
+		WASMInvocations: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "pulsedb_wasm_invocations_total",
+				Help: "Total number of WASM function calls, by whether they returned an error",
+			},
+			[]string{"function", "method", "status"},
+		),
+		WASMDuration: promauto.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "pulsedb_wasm_duration_seconds",
+				Help:    "Execution time of WASM function calls in seconds",
+				Buckets: prometheus.ExponentialBuckets(0.0001, 4, 8),
+			},
+			[]string{"function", "method"},
+		),
+		WASMMemory: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "pulsedb_wasm_memory_bytes",
+				Help: "Linear memory of each loaded WASM function after its last call",
+			},
+			[]string{"function"},
+		),
+		WASMFailures: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "pulsedb_wasm_failures_total",
+				Help: "Number of failed WASM function calls, by function and reason",
+			},
+			[]string{"function", "reason"},
+		),
+		WorkingSetKeys: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "pulsedb_working_set_keys",
+				Help: "Keys read or written within the window, from the periodic working set estimate",
+			},
+			[]string{"window"},
+		),
+		WorkingSetBytes: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "pulsedb_working_set_bytes",
+				Help: "Approximate bytes held by the keys read or written within the window",
+			},
+			[]string{"window"},
+		),
+		EventLoopLag: promauto.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "pulsedb_event_loop_lag_seconds",
+				Help:    "How late the stall watchdog's timer fired",
+				Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+			},
+		),
+		DispatchProbe: promauto.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "pulsedb_dispatch_probe_seconds",
+				Help:    "Slowest round trip of a no-op through the shard executors",
+				Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+			},
+		),
+		GCPauseMax: promauto.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "pulsedb_gc_pause_max_seconds",
+				Help: "Longest GC stop-the-world pause in the last watchdog interval",
+			},
+		),
+		SchedLatencyMax: promauto.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "pulsedb_sched_latency_max_seconds",
+				Help: "Longest wait of a runnable goroutine for a CPU in the last watchdog interval",
+			},
+		),
+		Stalls: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "pulsedb_stalls_total",
+				Help: "Number of event loop stalls, by likely cause",
+			},
+			[]string{"cause"},
+		),
 	}
 }
 
 // IncrementCommand increments the command counter
 func (m *Metrics) IncrementCommand(command, status string) {
+	if m == nil {
+		return
+	}
 	m.CommandsTotal.WithLabelValues(command, status).Inc()
 }
 
 // ObserveCommandDuration observes command duration
 func (m *Metrics) ObserveCommandDuration(command string, duration float64) {
+	if m == nil {
+		return
+	}
 	m.CommandDuration.WithLabelValues(command).Observe(duration)
 }
 
 // SetActiveConnections sets the number of active connections
 func (m *Metrics) SetActiveConnections(count float64) {
+	if m == nil {
+		return
+	}
 	m.ConnectionsActive.Set(count)
 }
 
 // SetKeysTotal sets the total number of keys
 func (m *Metrics) SetKeysTotal(count float64) {
+	if m == nil {
+		return
+	}
 	m.KeysTotal.Set(count)
 }
 
 // SetMemoryUsage sets the memory usage
 func (m *Metrics) SetMemoryUsage(bytes float64) {
+	if m == nil {
+		return
+	}
 	m.MemoryUsage.Set(bytes)
 }
+
+// SetVersionsTotal sets the total number of versions
+func (m *Metrics) SetVersionsTotal(count int) {
+	if m == nil {
+		return
+	}
+	m.VersionsTotal.Set(float64(count))
+}
+
+// SetShardKeys sets the number of keys held by each shard, indexed by shard
+func (m *Metrics) SetShardKeys(counts []int) {
+	if m == nil {
+		return
+	}
+	for shard, count := range counts {
+		m.ShardKeys.WithLabelValues(strconv.Itoa(shard)).Set(float64(count))
+	}
+}
+
+// SetTTLWheelEntries sets the number of keys scheduled to expire
+func (m *Metrics) SetTTLWheelEntries(count int) {
+	if m == nil {
+		return
+	}
+	m.TTLWheelEntries.Set(float64(count))
+}
+
+// AddNamespaceBytes counts bytes transferred by a throttled namespace
+func (m *Metrics) AddNamespaceBytes(namespace, direction string, bytes int64) {
+	if m == nil {
+		return
+	}
+	m.NamespaceBytes.WithLabelValues(namespace, direction).Add(float64(bytes))
+}
+
+// IncrementThrottled counts a command refused by a bandwidth quota
+func (m *Metrics) IncrementThrottled(namespace, direction string) {
+	if m == nil {
+		return
+	}
+	m.ThrottledTotal.WithLabelValues(namespace, direction).Inc()
+}
+
+// IncrementRateLimited counts a command refused by a client rate limit
+func (m *Metrics) IncrementRateLimited(class string) {
+	if m == nil {
+		return
+	}
+	m.RateLimitedTotal.WithLabelValues(class).Inc()
+}
+
+// ObserveReaderPool records a reader taken from the pool and the buffer
+// size new connections get
+func (m *Metrics) ObserveReaderPool(reused bool, bufferSize int) {
+	if m == nil {
+		return
+	}
+	result := "miss"
+	if reused {
+		result = "hit"
+	}
+	m.ReaderPoolGets.WithLabelValues(result).Inc()
+	m.ReadBufferSize.Set(float64(bufferSize))
+}
+
+// IncrementRepliesTooLarge counts a reply refused by the client memory limit
+func (m *Metrics) IncrementRepliesTooLarge() {
+	if m == nil {
+		return
+	}
+	m.RepliesTooLarge.Inc()
+}
+
+// IncrementOutputEvictions counts a client disconnected over its output
+// buffer limit
+func (m *Metrics) IncrementOutputEvictions(class string) {
+	if m == nil {
+		return
+	}
+	m.OutputEvictions.WithLabelValues(class).Inc()
+}
+
+// IncrementRepliesTruncated counts a reply cut short by the max response size
+func (m *Metrics) IncrementRepliesTruncated() {
+	if m == nil {
+		return
+	}
+	m.RepliesTruncated.Inc()
+}
+
+// ObserveWASMCall records a call of a method of a WASM function, its
+// duration, and the function's linear memory afterwards
+func (m *Metrics) ObserveWASMCall(function, method, status string, duration float64, memoryBytes uint32) {
+	if m == nil {
+		return
+	}
+	m.WASMInvocations.WithLabelValues(function, method, status).Inc()
+	m.WASMDuration.WithLabelValues(function, method).Observe(duration)
+	m.WASMMemory.WithLabelValues(function).Set(float64(memoryBytes))
+}
+
+// IncrementWASMFailures counts a failed call of a WASM function, with why
+// it failed: timeout, canceled or trap
+func (m *Metrics) IncrementWASMFailures(function, reason string) {
+	if m == nil {
+		return
+	}
+	m.WASMFailures.WithLabelValues(function, reason).Inc()
+}
+
+// SetWorkingSet sets the keys and bytes accessed within a window
+func (m *Metrics) SetWorkingSet(window string, keys int, bytes int64) {
+	if m == nil {
+		return
+	}
+	m.WorkingSetKeys.WithLabelValues(window).Set(float64(keys))
+	m.WorkingSetBytes.WithLabelValues(window).Set(float64(bytes))
+}
+
+// ConnectionOpened increments the number of active connections
+func (m *Metrics) ConnectionOpened() {
+	if m == nil {
+		return
+	}
+	m.ConnectionsActive.Inc()
+}
+
+// ConnectionClosed decrements the number of active connections
+func (m *Metrics) ConnectionClosed() {
+	if m == nil {
+		return
+	}
+	m.ConnectionsActive.Dec()
+}
+
+// ObserveEventLoop records a stall watchdog sample: the lag of its timer,
+// the no-op probe round trip, and the longest GC pause and scheduling
+// latency since the previous sample, all in seconds
+func (m *Metrics) ObserveEventLoop(lag, probe, gcPause, schedLatency float64) {
+	if m == nil {
+		return
+	}
+	m.EventLoopLag.Observe(lag)
+	m.DispatchProbe.Observe(probe)
+	m.GCPauseMax.Set(gcPause)
+	m.SchedLatencyMax.Set(schedLatency)
+}
+
+// IncrementStalls counts a stall attributed to cause
+func (m *Metrics) IncrementStalls(cause string) {
+	if m == nil {
+		return
+	}
+	m.Stalls.WithLabelValues(cause).Inc()
+}
+
+// StartCollector refreshes the key and memory gauges every interval until
+// ctx is cancelled. keys returns the current number of keys; each extra
+// collector is called on every refresh to set further gauges.
+func (m *Metrics) StartCollector(ctx context.Context, interval time.Duration, keys func() int, extra ...func(*Metrics)) {
+	if m == nil {
+		return
+	}
+
+	collect := func() {
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		m.SetKeysTotal(float64(keys()))
+		m.SetMemoryUsage(float64(mem.HeapAlloc))
+		m.MemorySystem.Set(float64(mem.Sys))
+		for _, collect := range extra {
+			collect(m)
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	collect()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			collect()
+		}
+	}
+}
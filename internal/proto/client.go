@@ -0,0 +1,65 @@
+package proto
+
+import (
+	"bufio"
+	"net"
+	"time"
+)
+
+// Client is a connection to a RESP server that issues one command at a time
+type Client struct {
+	conn     net.Conn
+	reader   *RESPReader
+	buffered *bufio.Writer
+	writer   *RESPWriter
+}
+
+// Dial connects to the RESP server at addr
+func Dial(addr string, timeout time.Duration) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+// NewClient issues commands over an established connection, such as a TLS
+// connection
+func NewClient(conn net.Conn) *Client {
+	buffered := bufio.NewWriter(conn)
+	return &Client{
+		conn:     conn,
+		reader:   NewRESPReader(conn),
+		buffered: buffered,
+		writer:   NewRESPWriter(buffered),
+	}
+}
+
+// Do sends a command and returns its reply. Error replies are returned as
+// values; the error reports I/O and protocol failures.
+func (c *Client) Do(cmd string, args ...string) (RESPValue, error) {
+	request := make([]RESPValue, 0, len(args)+1)
+	request = append(request, RESPValue{Type: BulkString, String: cmd})
+	for _, arg := range args {
+		request = append(request, RESPValue{Type: BulkString, String: arg})
+	}
+
+	if err := c.writer.WriteValue(RESPValue{Type: Array, Array: request}); err != nil {
+		return RESPValue{}, err
+	}
+	if err := c.buffered.Flush(); err != nil {
+		return RESPValue{}, err
+	}
+	return c.reader.Read()
+}
+
+// Receive reads a further reply, such as the messages pushed to a
+// subscribed connection
+func (c *Client) Receive() (RESPValue, error) {
+	return c.reader.Read()
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,265 @@
+package proto
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrOutputLimit is returned by an OutputBuffer whose client fell behind its
+// output limit. The connection should be closed.
+var ErrOutputLimit = errors.New("client output buffer limit reached")
+
+// OutputLimit bounds the replies queued for a client that reads them too
+// slowly, like Redis client-output-buffer-limit: the client is disconnected
+// once more than Hard bytes are queued, or more than Soft bytes for SoftTime
+// (right away if SoftTime is 0). A zero Hard or Soft disables that limit.
+type OutputLimit struct {
+	Hard     int64
+	Soft     int64
+	SoftTime time.Duration
+}
+
+// OutputLimits are the output limits of each client class
+type OutputLimits struct {
+	Normal OutputLimit // Clients running commands
+	PubSub OutputLimit // Clients subscribed to channels
+}
+
+// DefaultOutputLimits are those of Redis: normal clients are unlimited,
+// since they only receive replies to their own commands, while subscribers
+// are pushed messages whether or not they keep up
+var DefaultOutputLimits = OutputLimits{
+	PubSub: OutputLimit{Hard: 32 << 20, Soft: 8 << 20, SoftTime: time.Minute},
+}
+
+// ParseOutputLimits parses a comma-separated list of class=hard:soft:time
+// limits, e.g. "normal=0:0:0,pubsub=32M:8M:60s", over DefaultOutputLimits.
+// Sizes accept K, M and G suffixes and times are durations or seconds.
+func ParseOutputLimits(spec string) (OutputLimits, error) {
+	limits := DefaultOutputLimits
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		class, value, ok := strings.Cut(item, "=")
+		parts := strings.Split(value, ":")
+		if !ok || len(parts) != 3 {
+			return OutputLimits{}, fmt.Errorf("invalid output limit '%s', expected class=hard:soft:time", item)
+		}
+
+		var limit OutputLimit
+		var err error
+		if limit.Hard, err = parseBytes(parts[0]); err != nil {
+			return OutputLimits{}, fmt.Errorf("invalid hard limit for class '%s': %v", class, err)
+		}
+		if limit.Soft, err = parseBytes(parts[1]); err != nil {
+			return OutputLimits{}, fmt.Errorf("invalid soft limit for class '%s': %v", class, err)
+		}
+		if limit.SoftTime, err = parseSeconds(parts[2]); err != nil {
+			return OutputLimits{}, fmt.Errorf("invalid soft time for class '%s': %v", class, err)
+		}
+
+		switch strings.ToLower(class) {
+		case "normal":
+			limits.Normal = limit
+		case "pubsub":
+			limits.PubSub = limit
+		default:
+			return OutputLimits{}, fmt.Errorf("unknown client class '%s', want normal or pubsub", class)
+		}
+	}
+	return limits, nil
+}
+
+// String renders limits in the form accepted by ParseOutputLimits
+func (l OutputLimits) String() string {
+	format := func(limit OutputLimit) string {
+		return fmt.Sprintf("%d:%d:%s", limit.Hard, limit.Soft, limit.SoftTime)
+	}
+	return "normal=" + format(l.Normal) + ",pubsub=" + format(l.PubSub)
+}
+
+// parseBytes parses a byte count with an optional K, M or G suffix
+func parseBytes(value string) (int64, error) {
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(value, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(value, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(value, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		value = value[:len(value)-1]
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("'%s' is not a byte count", value)
+	}
+	return n * multiplier, nil
+}
+
+// parseSeconds parses a duration, or a number of seconds as in Redis
+func parseSeconds(value string) (time.Duration, error) {
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil && n >= 0 {
+		return time.Duration(n) * time.Second, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("'%s' is not a duration", value)
+	}
+	return d, nil
+}
+
+// outputRetain is the largest batch buffer kept for the next writes, so a
+// large reply does not pin its memory for the life of the connection
+const outputRetain = 64 << 10
+
+// OutputBuffer queues the output of a connection for a goroutine writing it
+// out, so a client reading slowly never blocks the goroutine serving its
+// commands. The bytes queued are bounded by an OutputLimit: past it, writes
+// fail with ErrOutputLimit and the rest of the queue is dropped.
+type OutputBuffer struct {
+	w io.Writer
+
+	mu      sync.Mutex
+	ready   *sync.Cond  // Signals the writer of queued bytes, an error or Close
+	queue   []byte      // Waiting for the writer
+	writing int64       // Bytes the writer is writing
+	limit   OutputLimit // Of the class of the client
+	over    time.Time   // When the queue went over the soft limit, zero if under
+	err     error       // Of the first failed write, or ErrOutputLimit
+	closed  bool
+	done    chan struct{} // Closed once the writer returns
+}
+
+// NewOutputBuffer starts writing queued output to w. Close stops it.
+func NewOutputBuffer(w io.Writer, limit OutputLimit) *OutputBuffer {
+	b := &OutputBuffer{w: w, limit: limit, done: make(chan struct{})}
+	b.ready = sync.NewCond(&b.mu)
+	go b.run()
+	return b
+}
+
+// SetLimit changes the limit, when the client changes class
+func (b *OutputBuffer) SetLimit(limit OutputLimit) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.limit = limit
+}
+
+// Write queues p. It fails once a write to the connection failed, the
+// limit was reached, or the buffer was closed.
+func (b *OutputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	b.queue = append(b.queue, p...)
+	if b.exceeded(time.Now()) {
+		b.err = ErrOutputLimit
+		b.queue = nil
+		b.ready.Signal()
+		return 0, b.err
+	}
+	b.ready.Signal()
+	return len(p), nil
+}
+
+// exceeded reports whether the bytes queued are over the limit, tracking
+// how long they have been over the soft limit. The caller must hold mu.
+func (b *OutputBuffer) exceeded(now time.Time) bool {
+	size := int64(len(b.queue)) + b.writing
+	if b.limit.Hard > 0 && size > b.limit.Hard {
+		return true
+	}
+	if b.limit.Soft <= 0 || size <= b.limit.Soft {
+		b.over = time.Time{}
+		return false
+	}
+	if b.over.IsZero() {
+		b.over = now
+	}
+	return now.Sub(b.over) >= b.limit.SoftTime
+}
+
+// Len returns the bytes queued and not written yet
+func (b *OutputBuffer) Len() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return int64(len(b.queue)) + b.writing
+}
+
+// Err returns the error that stopped the buffer, nil if none did
+func (b *OutputBuffer) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+// Close stops accepting writes and waits for the queued output to be
+// written, unless the buffer has already failed. A deadline on the
+// connection bounds the wait. It returns the error that stopped the
+// buffer, nil if none did.
+func (b *OutputBuffer) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	b.ready.Signal()
+	failed := b.err != nil
+	b.mu.Unlock()
+
+	if !failed {
+		<-b.done
+	}
+	return b.Err()
+}
+
+// run writes the queue out until the buffer is closed and drained or fails.
+// Batches swap with the queue, so writes never copy twice.
+func (b *OutputBuffer) run() {
+	defer close(b.done)
+
+	var batch []byte
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for {
+		for len(b.queue) == 0 && !b.closed && b.err == nil {
+			b.ready.Wait()
+		}
+		if b.err != nil || len(b.queue) == 0 {
+			return
+		}
+
+		batch, b.queue = b.queue, batch[:0]
+		b.writing = int64(len(batch))
+		b.mu.Unlock()
+		_, err := b.w.Write(batch)
+		b.mu.Lock()
+		b.writing = 0
+		if cap(batch) > outputRetain {
+			batch = nil
+		}
+
+		if err != nil && b.err == nil {
+			b.err = err
+			b.queue = nil
+		}
+		if b.limit.Soft > 0 && int64(len(b.queue)) <= b.limit.Soft {
+			b.over = time.Time{}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package proto
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedWriter blocks writes until released, like a client not reading
+type gatedWriter struct {
+	release chan struct{}
+	mu      sync.Mutex
+	written bytes.Buffer
+}
+
+func (w *gatedWriter) Write(p []byte) (int, error) {
+	<-w.release
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.written.Write(p)
+}
+
+func TestParseOutputLimits(t *testing.T) {
+	limits, err := ParseOutputLimits("normal=1M:512K:10, pubsub=0:0:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := OutputLimits{Normal: OutputLimit{Hard: 1 << 20, Soft: 512 << 10, SoftTime: 10 * time.Second}}
+	if limits != want {
+		t.Errorf("Expected %+v, got %+v", want, limits)
+	}
+
+	// Classes left out keep their defaults, and String round-trips
+	limits, err = ParseOutputLimits("normal=0:0:30s")
+	if err != nil || limits.PubSub != DefaultOutputLimits.PubSub {
+		t.Errorf("Expected the default pubsub limit, got %+v, %v", limits, err)
+	}
+	if again, err := ParseOutputLimits(limits.String()); err != nil || again != limits {
+		t.Errorf("Expected %q to round-trip, got %+v, %v", limits.String(), again, err)
+	}
+
+	for _, spec := range []string{"normal=1M", "replica=0:0:0", "pubsub=x:0:0", "normal=0:0:-1s"} {
+		if _, err := ParseOutputLimits(spec); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestOutputBufferHardLimit(t *testing.T) {
+	w := &gatedWriter{release: make(chan struct{})}
+	b := NewOutputBuffer(w, OutputLimit{Hard: 100})
+
+	// Writes queue without waiting for the client
+	for i := 0; i < 10; i++ {
+		if _, err := b.Write(make([]byte, 10)); err != nil {
+			t.Fatalf("Unexpected error at write %d: %v", i, err)
+		}
+	}
+	if _, err := b.Write([]byte("x")); !errors.Is(err, ErrOutputLimit) {
+		t.Fatalf("Expected the hard limit to be reached, got %v", err)
+	}
+	if _, err := b.Write([]byte("x")); !errors.Is(err, ErrOutputLimit) {
+		t.Errorf("Expected the buffer to stay failed, got %v", err)
+	}
+
+	close(w.release)
+	if err := b.Close(); !errors.Is(err, ErrOutputLimit) {
+		t.Errorf("Expected Close to report the limit, got %v", err)
+	}
+}
+
+func TestOutputBufferSoftLimit(t *testing.T) {
+	w := &gatedWriter{release: make(chan struct{})}
+	b := NewOutputBuffer(w, OutputLimit{Soft: 10, SoftTime: 50 * time.Millisecond})
+
+	if _, err := b.Write(make([]byte, 20)); err != nil {
+		t.Fatalf("Expected a write over the soft limit to be let through, got %v", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, err := b.Write([]byte("x")); !errors.Is(err, ErrOutputLimit) {
+		t.Fatalf("Expected the soft limit to be reached, got %v", err)
+	}
+	close(w.release)
+	b.Close()
+}
+
+func TestOutputBufferClose(t *testing.T) {
+	w := &gatedWriter{release: make(chan struct{})}
+	b := NewOutputBuffer(w, OutputLimit{})
+
+	b.Write([]byte("hello "))
+	b.Write([]byte("world"))
+	if n := b.Len(); n != 11 {
+		t.Errorf("Expected 11 bytes queued, got %d", n)
+	}
+
+	// Close waits for the queue to be written
+	close(w.release)
+	if err := b.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := w.written.String(); got != "hello world" {
+		t.Errorf("Expected the queued output written, got %q", got)
+	}
+	if _, err := b.Write([]byte("late")); err == nil {
+		t.Error("Expected writes after Close to fail")
+	}
+}
@@ -0,0 +1,75 @@
+package proto
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// readerSizes are the read buffer sizes readers are pooled by. A connection
+// gets the smallest size holding the requests typically seen on recent
+// connections, so most requests are read without growing any buffer.
+var readerSizes = [...]int{4 << 10, 16 << 10, 64 << 10}
+
+// ReaderPool recycles readers across connections, so that tens of thousands
+// of short-lived connections do not each allocate their buffers. It is safe
+// for concurrent use.
+type ReaderPool struct {
+	pools   [len(readerSizes)]sync.Pool
+	typical atomic.Int64 // Moving average of the largest request per connection
+}
+
+// NewReaderPool creates an empty pool
+func NewReaderPool() *ReaderPool {
+	return &ReaderPool{}
+}
+
+// Get returns a reader reading from rd with DefaultLimits, and whether it
+// was reused rather than allocated
+func (p *ReaderPool) Get(rd io.Reader) (*RESPReader, bool) {
+	class := sizeClass(p.typical.Load())
+	if reader, ok := p.pools[class].Get().(*RESPReader); ok {
+		reader.Reset(rd)
+		return reader, true
+	}
+	return newRESPReaderSize(rd, readerSizes[class]), false
+}
+
+// Put returns reader to the pool once its connection is closed, recording
+// the largest request it read to size the readers handed out next
+func (p *ReaderPool) Put(reader *RESPReader) {
+	if largest := reader.Largest(); largest > 0 {
+		for {
+			typical := p.typical.Load()
+			if p.typical.CompareAndSwap(typical, typical+(largest-typical)/8) {
+				break
+			}
+		}
+	}
+
+	// Readers whose buffer was not one of the pooled sizes are dropped
+	size := reader.reader.Size()
+	for class, classSize := range readerSizes {
+		if size == classSize {
+			reader.Reset(nil)
+			p.pools[class].Put(reader)
+			return
+		}
+	}
+}
+
+// BufferSize returns the read buffer size given to new connections
+func (p *ReaderPool) BufferSize() int {
+	return readerSizes[sizeClass(p.typical.Load())]
+}
+
+// sizeClass returns the index of the smallest reader size holding n bytes,
+// or of the largest size
+func sizeClass(n int64) int {
+	for class, size := range readerSizes {
+		if n <= int64(size) {
+			return class
+		}
+	}
+	return len(readerSizes) - 1
+}
@@ -0,0 +1,44 @@
+package proto
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReaderPool(t *testing.T) {
+	pool := NewReaderPool()
+	if size := pool.BufferSize(); size != readerSizes[0] {
+		t.Fatalf("Expected new connections to start with %d byte buffers, got %d", readerSizes[0], size)
+	}
+
+	reader, reused := pool.Get(strings.NewReader("*1\r\n$4\r\nPING\r\n"))
+	if reused {
+		t.Error("Expected the first reader to be allocated")
+	}
+	if _, err := reader.Read(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	pool.Put(reader)
+
+	// Connections sending larger requests grow the buffers handed out next
+	large := "*1\r\n$20000\r\n" + strings.Repeat("a", 20000) + "\r\n"
+	for i := 0; i < 20; i++ {
+		reader, _ := pool.Get(strings.NewReader(large))
+		value, err := reader.Read()
+		if err != nil || len(value.Array) != 1 || len(value.Array[0].String) != 20000 {
+			t.Fatalf("Unexpected value %d: %v", i, err)
+		}
+		pool.Put(reader)
+	}
+	if size := pool.BufferSize(); size != readerSizes[2] {
+		t.Errorf("Expected buffers to grow to %d bytes, got %d", readerSizes[2], size)
+	}
+
+	// Whether sync.Pool hands back a reader or not, which the race detector
+	// makes random, the next one is reset and sized for the larger requests
+	reader, _ = pool.Get(strings.NewReader(large))
+	if reader.Largest() != 0 || reader.reader.Size() != readerSizes[2] {
+		t.Errorf("Expected a reset reader with a %d byte buffer, got largest %d and buffer %d",
+			readerSizes[2], reader.Largest(), reader.reader.Size())
+	}
+}
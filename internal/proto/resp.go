@@ -2,8 +2,10 @@ package proto
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -17,35 +19,166 @@ const (
 	Integer      RESPType = ':'
 	BulkString   RESPType = '$'
 	Array        RESPType = '*'
+
+	// RESP3 types
+	Null      RESPType = '_'
+	Double    RESPType = ','
+	Boolean   RESPType = '#'
+	BigNumber RESPType = '('
+	Map       RESPType = '%'
+	Set       RESPType = '~'
+	Push      RESPType = '>'
+	Attribute RESPType = '|'
+)
+
+// Protocol versions negotiated with HELLO
+const (
+	RESP2 = 2
+	RESP3 = 3
 )
 
-// RESPValue represents a RESP protocol value
+// RESPValue represents a RESP protocol value.
+// Map entries are stored flattened in Array as key, value, key, value...;
+// BigNumber digits are stored in String. Attributes holds the flattened
+// RESP3 attribute map sent ahead of the value; RESP2 has no attributes, so
+// they are dropped when encoding for RESP2.
 type RESPValue struct {
-	Type   RESPType
-	String string
-	Int    int64
-	Array  []RESPValue
-	Null   bool
+	Type       RESPType
+	String     string
+	Int        int64
+	Float      float64
+	Bool       bool
+	Array      []RESPValue
+	Null       bool
+	Attributes []RESPValue
+}
+
+// Limits bounds what a RESPReader accepts from its peer, so malformed or
+// hostile input produces a protocol error instead of unbounded allocations
+type Limits struct {
+	MaxBulkLength   int   // Maximum length of a single bulk string
+	MaxArrayLength  int   // Maximum number of elements in an aggregate
+	MaxDepth        int   // Maximum nesting depth of aggregates
+	MaxRequestSize  int64 // Maximum encoded size of a single top-level value
+	MaxInlineLength int   // Maximum length of a protocol line or inline command
+}
+
+// DefaultLimits are the limits used by readers created with NewRESPReader
+var DefaultLimits = Limits{
+	MaxBulkLength:   512 * 1024 * 1024,
+	MaxArrayLength:  1024 * 1024,
+	MaxDepth:        32,
+	MaxRequestSize:  1024 * 1024 * 1024,
+	MaxInlineLength: 64 * 1024,
+}
+
+// bulkChunkSize is how much of a large bulk string is allocated at a time, so
+// a declared length costs memory only once the data actually arrives
+const bulkChunkSize = 64 * 1024
+
+// aggregateChunkSize is the most elements allocated for an array or
+// aggregate up front; it grows as elements are read, so a declared length
+// costs memory only once the elements actually arrive
+const aggregateChunkSize = 1024
+
+// ProtocolError reports input that violates the protocol or the reader limits.
+// The connection cannot be resynchronised after one and should be closed.
+type ProtocolError struct {
+	Msg string
+}
+
+func (e *ProtocolError) Error() string {
+	return "Protocol error: " + e.Msg
+}
+
+// errBlankLine is returned internally for empty inline commands, which are skipped
+var errBlankLine = errors.New("blank line")
+
+func protocolError(format string, args ...interface{}) error {
+	return &ProtocolError{Msg: fmt.Sprintf(format, args...)}
 }
 
 // RESPReader reads RESP protocol messages
 type RESPReader struct {
-	reader *bufio.Reader
+	reader  *bufio.Reader
+	limits  Limits
+	size    int64  // Bytes consumed by the value being read
+	largest int64  // Size of the largest value read since the last reset
+	scratch []byte // Reused to read bulk strings up to bulkChunkSize
 }
 
-// NewRESPReader creates a new RESP reader
+// NewRESPReader creates a new RESP reader enforcing DefaultLimits
 func NewRESPReader(r io.Reader) *RESPReader {
-	return &RESPReader{
-		reader: bufio.NewReader(r),
+	return newRESPReaderSize(r, 0)
+}
+
+// newRESPReaderSize creates a reader with a buffer of size bytes, or the
+// bufio default if size is 0
+func newRESPReaderSize(r io.Reader, size int) *RESPReader {
+	reader := bufio.NewReader(r)
+	if size > 0 {
+		reader = bufio.NewReaderSize(r, size)
 	}
+	return &RESPReader{reader: reader, limits: DefaultLimits}
 }
 
-// Read reads a RESP value from the reader
+// Reset discards buffered data and limits, and makes the reader read from r
+func (r *RESPReader) Reset(rd io.Reader) {
+	r.reader.Reset(rd)
+	r.limits = DefaultLimits
+	r.size = 0
+	r.largest = 0
+}
+
+// Memory returns the bytes held by the reader's buffers
+func (r *RESPReader) Memory() int {
+	return r.reader.Size() + cap(r.scratch)
+}
+
+// Largest returns the encoded size of the largest value read since the
+// reader was created or reset
+func (r *RESPReader) Largest() int64 {
+	return r.largest
+}
+
+// SetLimits replaces the limits enforced by the reader
+func (r *RESPReader) SetLimits(limits Limits) {
+	r.limits = limits
+}
+
+// Buffered returns the number of bytes already read from the underlying
+// reader but not yet parsed, i.e. pipelined requests waiting to be processed
+func (r *RESPReader) Buffered() int {
+	return r.reader.Buffered()
+}
+
+// Read reads a RESP value from the reader. Input exceeding the reader limits
+// is reported as a *ProtocolError.
 func (r *RESPReader) Read() (RESPValue, error) {
+	for {
+		r.size = 0
+		value, err := r.read(0)
+		if err == errBlankLine {
+			continue
+		}
+		r.largest = max(r.largest, r.size)
+		return value, err
+	}
+}
+
+// read reads a value nested depth aggregates deep
+func (r *RESPReader) read(depth int) (RESPValue, error) {
+	if depth > r.limits.MaxDepth {
+		return RESPValue{}, protocolError("nesting depth exceeds %d", r.limits.MaxDepth)
+	}
+
 	typeByte, err := r.reader.ReadByte()
 	if err != nil {
 		return RESPValue{}, err
 	}
+	if err := r.consume(1); err != nil {
+		return RESPValue{}, err
+	}
 
 	switch RESPType(typeByte) {
 	case SimpleString:
@@ -57,12 +190,130 @@ func (r *RESPReader) Read() (RESPValue, error) {
 	case BulkString:
 		return r.readBulkString()
 	case Array:
-		return r.readArray()
+		return r.readArray(depth)
+	case Null:
+		if _, err := r.readLine(); err != nil {
+			return RESPValue{}, err
+		}
+		return RESPValue{Type: Null, Null: true}, nil
+	case Double:
+		return r.readDouble()
+	case Boolean:
+		return r.readBoolean()
+	case BigNumber:
+		line, err := r.readLine()
+		if err != nil {
+			return RESPValue{}, err
+		}
+		return RESPValue{Type: BigNumber, String: line}, nil
+	case Map:
+		return r.readAggregate(Map, 2, depth)
+	case Set:
+		return r.readAggregate(Set, 1, depth)
+	case Push:
+		return r.readAggregate(Push, 1, depth)
+	case Attribute:
+		// The attribute map annotates the value that follows it
+		attributes, err := r.readAggregate(Attribute, 2, depth)
+		if err != nil {
+			return RESPValue{}, err
+		}
+		value, err := r.read(depth)
+		if err != nil {
+			return RESPValue{}, err
+		}
+		value.Attributes = attributes.Array
+		return value, nil
 	default:
-		return RESPValue{}, fmt.Errorf("unknown RESP type: %c", typeByte)
+		if depth > 0 {
+			return RESPValue{}, protocolError("unexpected byte '%c'", typeByte)
+		}
+		// Not a RESP type marker: treat the line as an inline command
+		// ("GET foo\r\n") as sent by telnet/netcat users
+		return r.readInline(typeByte)
 	}
 }
 
+// consume accounts n bytes towards the request size limit
+func (r *RESPReader) consume(n int) error {
+	r.size += int64(n)
+	if r.size > r.limits.MaxRequestSize {
+		return protocolError("request exceeds %d bytes", r.limits.MaxRequestSize)
+	}
+	return nil
+}
+
+// readInline parses an inline command whose first byte has already been read.
+// Arguments are separated by whitespace and may be quoted with single or
+// double quotes. Blank lines are skipped.
+func (r *RESPReader) readInline(first byte) (RESPValue, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return RESPValue{}, err
+	}
+	line = string(first) + line
+
+	args, err := splitInline(line)
+	if err != nil {
+		return RESPValue{}, err
+	}
+	if len(args) == 0 {
+		return RESPValue{}, errBlankLine
+	}
+	if len(args) > r.limits.MaxArrayLength {
+		return RESPValue{}, protocolError("too many arguments")
+	}
+
+	array := make([]RESPValue, len(args))
+	for i, arg := range args {
+		array[i] = RESPValue{Type: BulkString, String: arg}
+	}
+	return RESPValue{Type: Array, Array: array}, nil
+}
+
+// splitInline splits an inline command line into arguments
+func splitInline(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote byte
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' && i+1 < len(line) {
+				i++
+				current.WriteByte(line[i])
+			} else if c == quote {
+				quote = 0
+			} else {
+				current.WriteByte(c)
+			}
+		case c == '"' || c == '\'':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\r':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteByte(c)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, protocolError("unbalanced quotes in inline command")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
 func (r *RESPReader) readSimpleString() (RESPValue, error) {
 	line, err := r.readLine()
 	if err != nil {
@@ -101,27 +352,61 @@ func (r *RESPReader) readBulkString() (RESPValue, error) {
 
 	length, err := strconv.Atoi(line)
 	if err != nil {
-		return RESPValue{}, fmt.Errorf("invalid bulk string length: %s", line)
+		return RESPValue{}, protocolError("invalid bulk string length: %s", line)
 	}
 
 	if length == -1 {
 		return RESPValue{Type: BulkString, Null: true}, nil
 	}
 
-	if length < 0 {
-		return RESPValue{}, fmt.Errorf("invalid bulk string length: %d", length)
+	if length < 0 || length > r.limits.MaxBulkLength {
+		return RESPValue{}, protocolError("invalid bulk string length: %d", length)
 	}
-
-	data := make([]byte, length+2) // +2 for \r\n
-	_, err = io.ReadFull(r.reader, data)
-	if err != nil {
+	if err := r.consume(length + 2); err != nil {
 		return RESPValue{}, err
 	}
 
+	// Small strings are read in one go, into the reused scratch buffer if
+	// they fit the read buffer size so idle connections hold no more than
+	// twice their buffer; larger ones grow with the data received so an
+	// unfulfilled length cannot reserve memory
+	var data []byte
+	if length <= bulkChunkSize {
+		switch {
+		case length+2 <= cap(r.scratch):
+			data = r.scratch[:length+2] // +2 for \r\n
+		case length+2 <= r.reader.Size():
+			r.scratch = make([]byte, length+2)
+			data = r.scratch
+		default:
+			data = make([]byte, length+2)
+		}
+		if _, err := io.ReadFull(r.reader, data); err != nil {
+			return RESPValue{}, err
+		}
+	} else {
+		data = make([]byte, 0, bulkChunkSize)
+		for remaining := length + 2; remaining > 0; {
+			n := remaining
+			if n > bulkChunkSize {
+				n = bulkChunkSize
+			}
+			data = append(data, make([]byte, n)...)
+			if _, err := io.ReadFull(r.reader, data[len(data)-n:]); err != nil {
+				return RESPValue{}, err
+			}
+			remaining -= n
+		}
+	}
+
+	if data[length] != '\r' || data[length+1] != '\n' {
+		return RESPValue{}, protocolError("bulk string is not terminated by CRLF")
+	}
+
 	return RESPValue{Type: BulkString, String: string(data[:length])}, nil
 }
 
-func (r *RESPReader) readArray() (RESPValue, error) {
+func (r *RESPReader) readArray(depth int) (RESPValue, error) {
 	line, err := r.readLine()
 	if err != nil {
 		return RESPValue{}, err
@@ -129,34 +414,106 @@ func (r *RESPReader) readArray() (RESPValue, error) {
 
 	length, err := strconv.Atoi(line)
 	if err != nil {
-		return RESPValue{}, fmt.Errorf("invalid array length: %s", line)
+		return RESPValue{}, protocolError("invalid array length: %s", line)
 	}
 
 	if length == -1 {
 		return RESPValue{Type: Array, Null: true}, nil
 	}
 
-	if length < 0 {
-		return RESPValue{}, fmt.Errorf("invalid array length: %d", length)
+	if length < 0 || length > r.limits.MaxArrayLength {
+		return RESPValue{}, protocolError("invalid array length: %d", length)
 	}
 
-	array := make([]RESPValue, length)
+	array := make([]RESPValue, 0, min(length, aggregateChunkSize))
 	for i := 0; i < length; i++ {
-		value, err := r.Read()
+		value, err := r.read(depth + 1)
 		if err != nil {
 			return RESPValue{}, err
 		}
-		array[i] = value
+		array = append(array, value)
 	}
 
 	return RESPValue{Type: Array, Array: array}, nil
 }
 
-func (r *RESPReader) readLine() (string, error) {
-	line, err := r.reader.ReadString('\n')
+func (r *RESPReader) readDouble() (RESPValue, error) {
+	line, err := r.readLine()
 	if err != nil {
+		return RESPValue{}, err
+	}
+
+	val, err := strconv.ParseFloat(line, 64)
+	if err != nil {
+		return RESPValue{}, fmt.Errorf("invalid double: %s", line)
+	}
+
+	return RESPValue{Type: Double, Float: val}, nil
+}
+
+func (r *RESPReader) readBoolean() (RESPValue, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return RESPValue{}, err
+	}
+
+	switch line {
+	case "t":
+		return RESPValue{Type: Boolean, Bool: true}, nil
+	case "f":
+		return RESPValue{Type: Boolean, Bool: false}, nil
+	default:
+		return RESPValue{}, fmt.Errorf("invalid boolean: %s", line)
+	}
+}
+
+// readAggregate reads a RESP3 aggregate whose header counts entries of
+// width elements each (2 for maps)
+func (r *RESPReader) readAggregate(t RESPType, width, depth int) (RESPValue, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return RESPValue{}, err
+	}
+
+	length, err := strconv.Atoi(line)
+	if err != nil || length < 0 || length > r.limits.MaxArrayLength/width {
+		return RESPValue{}, protocolError("invalid aggregate length: %s", line)
+	}
+
+	array := make([]RESPValue, 0, min(length*width, aggregateChunkSize))
+	for i := 0; i < length*width; i++ {
+		value, err := r.read(depth + 1)
+		if err != nil {
+			return RESPValue{}, err
+		}
+		array = append(array, value)
+	}
+
+	return RESPValue{Type: t, Array: array}, nil
+}
+
+// readLine reads a line terminated by \n, rejecting lines longer than
+// MaxInlineLength before they are fully buffered
+func (r *RESPReader) readLine() (string, error) {
+	var buf []byte
+	for {
+		chunk, err := r.reader.ReadSlice('\n')
+		if len(buf)+len(chunk) > r.limits.MaxInlineLength+2 {
+			return "", protocolError("line exceeds %d bytes", r.limits.MaxInlineLength)
+		}
+		buf = append(buf, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		break
+	}
+	if err := r.consume(len(buf)); err != nil {
 		return "", err
 	}
+	line := string(buf)
 
 	// Remove \r\n
 	if len(line) >= 2 && line[len(line)-2:] == "\r\n" {
@@ -168,89 +525,243 @@ func (r *RESPReader) readLine() (string, error) {
 	return line, nil
 }
 
-// RESPWriter writes RESP protocol messages
-type RESPWriter struct {
-	writer io.Writer
+var (
+	crlf            = []byte("\r\n")
+	nullBulkString  = []byte("$-1\r\n")
+	nullArray       = []byte("*-1\r\n")
+	null            = []byte("_\r\n")
+	errUnknownValue = fmt.Errorf("unknown RESP type")
+)
+
+// AppendValue appends the RESP2 encoding of value to buf and returns the
+// extended buffer. It performs no formatting or reflection, so callers can
+// reuse buf across values to encode without allocating.
+func AppendValue(buf []byte, value RESPValue) ([]byte, error) {
+	return appendValue(buf, value, RESP2)
 }
 
-// NewRESPWriter creates a new RESP writer
-func NewRESPWriter(w io.Writer) *RESPWriter {
-	return &RESPWriter{writer: w}
+// AppendValueProtocol is like AppendValue but encodes for the given protocol
+// version. RESP3 types are written natively for RESP3 and downgraded for
+// RESP2 the way Redis does: maps, sets and pushes become arrays, doubles and
+// big numbers become bulk strings, booleans become integers and nulls become
+// null bulk strings.
+func AppendValueProtocol(buf []byte, value RESPValue, protocol int) ([]byte, error) {
+	return appendValue(buf, value, protocol)
 }
 
-// WriteValue writes a RESP value
-func (w *RESPWriter) WriteValue(value RESPValue) error {
+func appendValue(buf []byte, value RESPValue, protocol int) ([]byte, error) {
+	resp3 := protocol >= RESP3
+
+	if resp3 && len(value.Attributes) > 0 {
+		var err error
+		if buf, err = appendAggregate(buf, '|', len(value.Attributes)/2, value.Attributes, protocol); err != nil {
+			return buf, err
+		}
+	}
+
 	switch value.Type {
 	case SimpleString:
-		return w.WriteSimpleString(value.String)
+		return appendLine(buf, '+', value.String), nil
 	case Error:
-		return w.WriteError(value.String)
+		return appendLine(buf, '-', value.String), nil
 	case Integer:
-		return w.WriteInteger(value.Int)
+		buf = append(buf, ':')
+		buf = strconv.AppendInt(buf, value.Int, 10)
+		return append(buf, crlf...), nil
 	case BulkString:
 		if value.Null {
-			return w.WriteNullBulkString()
+			return appendNull(buf, resp3, nullBulkString), nil
 		}
-		return w.WriteBulkString(value.String)
-	case Array:
+		return appendBulkString(buf, value.String), nil
+	case Array, Set, Push:
 		if value.Null {
-			return w.WriteNullArray()
+			return appendNull(buf, resp3, nullArray), nil
+		}
+		prefix := byte(value.Type)
+		if !resp3 {
+			prefix = '*'
 		}
-		return w.WriteArray(value.Array)
+		return appendAggregate(buf, prefix, len(value.Array), value.Array, protocol)
+	case Map:
+		if value.Null {
+			return appendNull(buf, resp3, nullArray), nil
+		}
+		if !resp3 {
+			return appendAggregate(buf, '*', len(value.Array), value.Array, protocol)
+		}
+		return appendAggregate(buf, '%', len(value.Array)/2, value.Array, protocol)
+	case Null:
+		return appendNull(buf, resp3, nullBulkString), nil
+	case Double:
+		if !resp3 {
+			return appendBulkString(buf, formatDouble(value.Float)), nil
+		}
+		return appendLine(buf, ',', formatDouble(value.Float)), nil
+	case Boolean:
+		if !resp3 {
+			if value.Bool {
+				return append(buf, ":1\r\n"...), nil
+			}
+			return append(buf, ":0\r\n"...), nil
+		}
+		if value.Bool {
+			return append(buf, "#t\r\n"...), nil
+		}
+		return append(buf, "#f\r\n"...), nil
+	case BigNumber:
+		if !resp3 {
+			return appendBulkString(buf, value.String), nil
+		}
+		return appendLine(buf, '(', value.String), nil
 	default:
-		return fmt.Errorf("unknown RESP type: %c", value.Type)
+		return buf, fmt.Errorf("%w: %c", errUnknownValue, value.Type)
+	}
+}
+
+func appendAggregate(buf []byte, prefix byte, n int, items []RESPValue, protocol int) ([]byte, error) {
+	buf = appendLength(buf, prefix, n)
+	for _, item := range items {
+		var err error
+		if buf, err = appendValue(buf, item, protocol); err != nil {
+			return buf, err
+		}
+	}
+	return buf, nil
+}
+
+// appendNull encodes a null as the RESP3 null type, or as the given RESP2 form
+func appendNull(buf []byte, resp3 bool, resp2 []byte) []byte {
+	if resp3 {
+		return append(buf, null...)
+	}
+	return append(buf, resp2...)
+}
+
+// formatDouble formats a double the way RESP3 expects, including inf/-inf/nan
+func formatDouble(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// Encode returns the RESP encoding of value
+func Encode(value RESPValue) ([]byte, error) {
+	return AppendValue(nil, value)
+}
+
+func appendLine(buf []byte, prefix byte, s string) []byte {
+	buf = append(buf, prefix)
+	buf = append(buf, s...)
+	return append(buf, crlf...)
+}
+
+func appendLength(buf []byte, prefix byte, n int) []byte {
+	buf = append(buf, prefix)
+	buf = strconv.AppendInt(buf, int64(n), 10)
+	return append(buf, crlf...)
+}
+
+func appendBulkString(buf []byte, s string) []byte {
+	buf = appendLength(buf, '$', len(s))
+	buf = append(buf, s...)
+	return append(buf, crlf...)
+}
+
+// ErrReplyTooLarge is returned by WriteValue for values whose encoding
+// exceeds the writer's maximum size; nothing is written
+var ErrReplyTooLarge = errors.New("reply too large")
+
+// RESPWriter writes RESP protocol messages
+type RESPWriter struct {
+	writer   io.Writer
+	buf      []byte // Scratch buffer reused across writes
+	protocol int
+	maxSize  int // Largest encoded value WriteValue writes, 0 means unlimited
+}
+
+// NewRESPWriter creates a new RESP writer speaking RESP2
+func NewRESPWriter(w io.Writer) *RESPWriter {
+	return &RESPWriter{writer: w, protocol: RESP2}
+}
+
+// SetProtocol sets the protocol version used to encode values (RESP2 or RESP3)
+func (w *RESPWriter) SetProtocol(protocol int) {
+	w.protocol = protocol
+}
+
+// Protocol returns the protocol version used to encode values
+func (w *RESPWriter) Protocol() int {
+	return w.protocol
+}
+
+// SetMaxSize makes WriteValue refuse values encoding to more than n bytes
+// (0 means unlimited)
+func (w *RESPWriter) SetMaxSize(n int) {
+	w.maxSize = n
+}
+
+// WriteValue writes a RESP value, downgrading RESP3 types on RESP2 writers.
+// It returns ErrReplyTooLarge without writing if the encoded value exceeds
+// the maximum size.
+func (w *RESPWriter) WriteValue(value RESPValue) error {
+	buf, err := appendValue(w.buf[:0], value, w.protocol)
+	if err != nil {
+		return err
 	}
+	if w.maxSize > 0 && len(buf) > w.maxSize {
+		return ErrReplyTooLarge
+	}
+	return w.flush(buf)
+}
+
+// flush writes buf and keeps it for reuse unless it grew unusually large
+func (w *RESPWriter) flush(buf []byte) error {
+	_, err := w.writer.Write(buf)
+	if cap(buf) <= 64*1024 {
+		w.buf = buf
+	}
+	return err
 }
 
 // WriteSimpleString writes a simple string
 func (w *RESPWriter) WriteSimpleString(s string) error {
-	_, err := fmt.Fprintf(w.writer, "+%s\r\n", s)
-	return err
+	return w.flush(appendLine(w.buf[:0], '+', s))
 }
 
 // WriteError writes an error
 func (w *RESPWriter) WriteError(s string) error {
-	_, err := fmt.Fprintf(w.writer, "-%s\r\n", s)
-	return err
+	return w.flush(appendLine(w.buf[:0], '-', s))
 }
 
 // WriteInteger writes an integer
 func (w *RESPWriter) WriteInteger(i int64) error {
-	_, err := fmt.Fprintf(w.writer, ":%d\r\n", i)
-	return err
+	return w.WriteValue(RESPValue{Type: Integer, Int: i})
 }
 
 // WriteBulkString writes a bulk string
 func (w *RESPWriter) WriteBulkString(s string) error {
-	_, err := fmt.Fprintf(w.writer, "$%d\r\n%s\r\n", len(s), s)
-	return err
+	return w.flush(appendBulkString(w.buf[:0], s))
 }
 
 // WriteNullBulkString writes a null bulk string
 func (w *RESPWriter) WriteNullBulkString() error {
-	_, err := fmt.Fprintf(w.writer, "$-1\r\n")
-	return err
+	return w.WriteValue(RESPValue{Type: BulkString, Null: true})
 }
 
 // WriteArray writes an array
 func (w *RESPWriter) WriteArray(arr []RESPValue) error {
-	if _, err := fmt.Fprintf(w.writer, "*%d\r\n", len(arr)); err != nil {
-		return err
-	}
-
-	for _, value := range arr {
-		if err := w.WriteValue(value); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return w.WriteValue(RESPValue{Type: Array, Array: arr})
 }
 
 // WriteNullArray writes a null array
 func (w *RESPWriter) WriteNullArray() error {
-	_, err := fmt.Fprintf(w.writer, "*-1\r\n")
-	return err
+	return w.WriteValue(RESPValue{Type: Array, Null: true})
 }
 
 // ToStringArray converts a RESP array to a string slice
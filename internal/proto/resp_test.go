@@ -2,6 +2,9 @@ package proto
 
 import (
 	"bytes"
+	"errors"
+	"io"
+	"runtime"
 	"strings"
 	"testing"
 )
@@ -57,6 +60,98 @@ func TestRESPReader(t *testing.T) {
 	}
 }
 
+func TestRESPReaderInline(t *testing.T) {
+	input := "PING\r\n\r\nSET key \"hello world\" EX 10\nGET 'a b'\r\n"
+	reader := NewRESPReader(strings.NewReader(input))
+
+	expected := [][]string{
+		{"PING"},
+		{"SET", "key", "hello world", "EX", "10"},
+		{"GET", "a b"},
+	}
+
+	for _, want := range expected {
+		value, err := reader.Read()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		args, err := value.ToStringArray()
+		if err != nil {
+			t.Fatalf("Expected an array, got %+v", value)
+		}
+		if strings.Join(args, "|") != strings.Join(want, "|") {
+			t.Errorf("Expected %q, got %q", want, args)
+		}
+	}
+
+	reader = NewRESPReader(strings.NewReader("SET key \"unterminated\r\n"))
+	if _, err := reader.Read(); err == nil {
+		t.Error("Expected error for unbalanced quotes")
+	}
+}
+
+func TestRESPReaderLimits(t *testing.T) {
+	limits := Limits{
+		MaxBulkLength:   16,
+		MaxArrayLength:  4,
+		MaxDepth:        2,
+		MaxRequestSize:  64,
+		MaxInlineLength: 32,
+	}
+
+	tests := map[string]string{
+		"bulk length":   "$1000000000000\r\n",
+		"bulk too long": "$17\r\n",
+		"array length":  "*5\r\n",
+		"nesting":       "*1\r\n*1\r\n*1\r\n*1\r\n:1\r\n",
+		"request size":  "*4\r\n$16\r\naaaaaaaaaaaaaaaa\r\n$16\r\naaaaaaaaaaaaaaaa\r\n$16\r\naaaaaaaaaaaaaaaa\r\n",
+		"inline line":   strings.Repeat("a", 100) + "\r\n",
+		"missing CRLF":  "$3\r\nfooXX",
+		"bad element":   "*1\r\nGET\r\n",
+	}
+
+	for name, input := range tests {
+		reader := NewRESPReader(strings.NewReader(input))
+		reader.SetLimits(limits)
+
+		_, err := reader.Read()
+		var protoErr *ProtocolError
+		if !errors.As(err, &protoErr) {
+			t.Errorf("%s: expected protocol error, got %v", name, err)
+		}
+	}
+
+	// Input within the limits is still accepted
+	reader := NewRESPReader(strings.NewReader("*2\r\n$3\r\nGET\r\n$3\r\nfoo\r\n"))
+	reader.SetLimits(limits)
+	if _, err := reader.Read(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestRESPReaderDeclaredLengths(t *testing.T) {
+	// Aggregates declaring the most elements, nested as deep as allowed,
+	// with none of the elements sent
+	for name, header := range map[string]string{
+		"array": "*1048576\r\n",
+		"map":   "%524288\r\n",
+	} {
+		input := strings.Repeat(header, DefaultLimits.MaxDepth)
+
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		_, err := NewRESPReader(strings.NewReader(input)).Read()
+		runtime.ReadMemStats(&after)
+
+		if err == nil {
+			t.Errorf("%s: expected the truncated input to fail", name)
+		}
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 16<<20 {
+			t.Errorf("%s: expected the declared lengths not to be allocated, allocated %d bytes", name, allocated)
+		}
+	}
+}
+
 func TestRESPWriter(t *testing.T) {
 	tests := []struct {
 		value    RESPValue
@@ -97,6 +192,125 @@ func TestRESPWriter(t *testing.T) {
 			t.Errorf("Expected %q, got %q", test.expected, buf.String())
 		}
 	}
+
+	// Values encoding to more than the maximum size are not written
+	var buf bytes.Buffer
+	writer := NewRESPWriter(&buf)
+	writer.SetMaxSize(8)
+	if err := writer.WriteValue(RESPValue{Type: BulkString, String: "foobar"}); err != ErrReplyTooLarge {
+		t.Errorf("Expected ErrReplyTooLarge, got %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected nothing to be written, got %q", buf.String())
+	}
+}
+
+func TestEncode(t *testing.T) {
+	value := RESPValue{
+		Type: Array,
+		Array: []RESPValue{
+			{Type: Integer, Int: -42},
+			{Type: BulkString, String: "hello"},
+			{Type: BulkString, Null: true},
+			{Type: Array, Null: true},
+			{Type: Array, Array: []RESPValue{{Type: SimpleString, String: "OK"}}},
+		},
+	}
+	expected := "*5\r\n:-42\r\n$5\r\nhello\r\n$-1\r\n*-1\r\n*1\r\n+OK\r\n"
+
+	encoded, err := Encode(value)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(encoded) != expected {
+		t.Errorf("Expected %q, got %q", expected, encoded)
+	}
+
+	// Appending reuses and extends the given buffer
+	buf, _ := AppendValue([]byte("prefix"), RESPValue{Type: Integer, Int: 1})
+	if string(buf) != "prefix:1\r\n" {
+		t.Errorf("Unexpected appended buffer %q", buf)
+	}
+
+	if _, err := Encode(RESPValue{Type: RESPType('?')}); err == nil {
+		t.Error("Expected error for unknown type")
+	}
+}
+
+func TestRESP3(t *testing.T) {
+	value := RESPValue{
+		Type: Map,
+		Array: []RESPValue{
+			{Type: BulkString, String: "score"},
+			{Type: Double, Float: 1.5},
+			{Type: BulkString, String: "ok"},
+			{Type: Boolean, Bool: true},
+			{Type: BulkString, String: "big"},
+			{Type: BigNumber, String: "12345678901234567890"},
+			{Type: BulkString, String: "tags"},
+			{Type: Set, Array: []RESPValue{{Type: BulkString, String: "a"}}},
+			{Type: BulkString, String: "missing"},
+			{Type: Null, Null: true},
+			{Type: BulkString, String: "v"},
+			{
+				Type:       BulkString,
+				String:     "x",
+				Attributes: []RESPValue{{Type: BulkString, String: "ttl"}, {Type: Integer, Int: 5}},
+			},
+		},
+	}
+
+	resp3 := "%6\r\n$5\r\nscore\r\n,1.5\r\n$2\r\nok\r\n#t\r\n" +
+		"$3\r\nbig\r\n(12345678901234567890\r\n$4\r\ntags\r\n~1\r\n$1\r\na\r\n" +
+		"$7\r\nmissing\r\n_\r\n$1\r\nv\r\n|1\r\n$3\r\nttl\r\n:5\r\n$1\r\nx\r\n"
+	// Attributes are dropped for RESP2
+	resp2 := "*12\r\n$5\r\nscore\r\n$3\r\n1.5\r\n$2\r\nok\r\n:1\r\n" +
+		"$3\r\nbig\r\n$20\r\n12345678901234567890\r\n$4\r\ntags\r\n*1\r\n$1\r\na\r\n" +
+		"$7\r\nmissing\r\n$-1\r\n$1\r\nv\r\n$1\r\nx\r\n"
+
+	var buf bytes.Buffer
+	writer := NewRESPWriter(&buf)
+	writer.SetProtocol(RESP3)
+	if err := writer.WriteValue(value); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if buf.String() != resp3 {
+		t.Errorf("Expected %q, got %q", resp3, buf.String())
+	}
+
+	// Reading the RESP3 encoding back yields the original value
+	decoded, err := NewRESPReader(strings.NewReader(resp3)).Read()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !compareRESPValues(decoded, value) {
+		t.Errorf("Expected %+v, got %+v", value, decoded)
+	}
+
+	// RESP2 writers downgrade RESP3 types
+	buf.Reset()
+	writer.SetProtocol(RESP2)
+	if err := writer.WriteValue(value); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if buf.String() != resp2 {
+		t.Errorf("Expected %q, got %q", resp2, buf.String())
+	}
+}
+
+func BenchmarkRESPWriterArray(b *testing.B) {
+	value := RESPValue{Type: Array, Array: make([]RESPValue, 20)}
+	for i := range value.Array {
+		value.Array[i] = RESPValue{Type: BulkString, String: "some-value-payload"}
+	}
+
+	writer := NewRESPWriter(io.Discard)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		writer.WriteValue(value)
+	}
 }
 
 func TestToCommand(t *testing.T) {
@@ -170,16 +384,25 @@ func TestToCommand(t *testing.T) {
 }
 
 func compareRESPValues(a, b RESPValue) bool {
-	if a.Type != b.Type || a.Null != b.Null {
+	if a.Type != b.Type || a.Null != b.Null || len(a.Attributes) != len(b.Attributes) {
 		return false
 	}
+	for i := range a.Attributes {
+		if !compareRESPValues(a.Attributes[i], b.Attributes[i]) {
+			return false
+		}
+	}
 
 	switch a.Type {
-	case SimpleString, Error, BulkString:
+	case SimpleString, Error, BulkString, BigNumber:
 		return a.String == b.String
 	case Integer:
 		return a.Int == b.Int
-	case Array:
+	case Double:
+		return a.Float == b.Float
+	case Boolean:
+		return a.Bool == b.Bool
+	case Array, Map, Set, Push:
 		if len(a.Array) != len(b.Array) {
 			return false
 		}
@@ -0,0 +1,114 @@
+package proxy
+
+// keySpec describes where the keys of a command appear in its arguments,
+// using the same first/last/step convention as Redis COMMAND output.
+// Indexes are relative to the arguments after the command name; a negative
+// last index counts from the end.
+type keySpec struct {
+	first int
+	last  int
+	step  int
+}
+
+// mergeMode describes how a command spanning several backends is answered
+type mergeMode int
+
+const (
+	// mergeNone requires every key to live on the same backend
+	mergeNone mergeMode = iota
+	// mergeSum sums the integer replies of each backend (DEL, EXISTS)
+	mergeSum
+	// mergeSetAlgebra fetches each set and combines them in the proxy
+	mergeSetAlgebra
+)
+
+type commandSpec struct {
+	keys  keySpec
+	merge mergeMode
+	// keyless lists the subcommands taking no key, by upper-case name. One
+	// mapped to true is answered alike by every backend and is forwarded to
+	// the first; one mapped to false reports on the keys of a single backend
+	// and is rejected, as the proxy cannot merge it.
+	keyless map[string]bool
+}
+
+// commandTable is the key-extraction table used to route commands.
+// Commands missing from the table are rejected by the proxy.
+var commandTable = map[string]commandSpec{
+	"GET":             {keys: keySpec{0, 0, 1}},
+	"GETSET":          {keys: keySpec{0, 0, 1}},
+	"GETDEL":          {keys: keySpec{0, 0, 1}},
+	"GETEX":           {keys: keySpec{0, 0, 1}},
+	"GETMETA":         {keys: keySpec{0, 0, 1}},
+	"SET":             {keys: keySpec{0, 0, 1}},
+	"EXPIRE":          {keys: keySpec{0, 0, 1}},
+	"TTL":             {keys: keySpec{0, 0, 1}},
+	"PERSIST":         {keys: keySpec{0, 0, 1}},
+	"DUMP":            {keys: keySpec{0, 0, 1}},
+	"RESTORE":         {keys: keySpec{0, 0, 1}},
+	"COPY":            {keys: keySpec{0, 1, 1}},
+	"TYPE":            {keys: keySpec{0, 0, 1}},
+	"GETAT":           {keys: keySpec{0, 0, 1}},
+	"GETVERSION":      {keys: keySpec{0, 0, 1}},
+	"HIST":            {keys: keySpec{0, 0, 1}},
+	"HISTRANGE":       {keys: keySpec{0, 0, 1}},
+	"HISTSCAN":        {keys: keySpec{0, 0, 1}},
+	"HISTDIFF":        {keys: keySpec{0, 0, 1}},
+	"STATS":           {keys: keySpec{1, 1, 1}, keyless: map[string]bool{"AMPLIFICATION": false}},
+	"OBJECT":          {keys: keySpec{1, 1, 1}, keyless: map[string]bool{"HELP": true}},
+	"MEMORY":          {keys: keySpec{1, 1, 1}, keyless: map[string]bool{"HELP": true}},
+	"APPEND":          {keys: keySpec{0, 0, 1}},
+	"SETRANGE":        {keys: keySpec{0, 0, 1}},
+	"TRANSFER":        {keys: keySpec{0, 1, 1}},
+	"CAS":             {keys: keySpec{0, 0, 1}},
+	"LOCK":            {keys: keySpec{0, 0, 1}},
+	"UNLOCK":          {keys: keySpec{0, 0, 1}},
+	"GETRANGE":        {keys: keySpec{0, 0, 1}},
+	"STRLEN":          {keys: keySpec{0, 0, 1}},
+	"DEL":             {keys: keySpec{0, -1, 1}, merge: mergeSum},
+	"PURGE":           {keys: keySpec{0, -1, 1}, merge: mergeSum},
+	"EXISTS":          {keys: keySpec{0, -1, 1}, merge: mergeSum},
+	"RENAME":          {keys: keySpec{0, 1, 1}},
+	"RENAMENX":        {keys: keySpec{0, 1, 1}},
+	"JSON.SET":        {keys: keySpec{0, 0, 1}},
+	"JSON.GET":        {keys: keySpec{0, 0, 1}},
+	"JSON.DEL":        {keys: keySpec{0, 0, 1}},
+	"JSON.NUMINCRBY":  {keys: keySpec{0, 0, 1}},
+	"SKETCH.CREATE":   {keys: keySpec{0, 0, 1}},
+	"SKETCH.ADD":      {keys: keySpec{0, 0, 1}},
+	"SKETCH.MERGE":    {keys: keySpec{0, -1, 1}},
+	"SKETCH.QUANTILE": {keys: keySpec{0, 0, 1}},
+	"SKETCH.INFO":     {keys: keySpec{0, 0, 1}},
+	"SADD":            {keys: keySpec{0, 0, 1}},
+	"SREM":            {keys: keySpec{0, 0, 1}},
+	"SMEMBERS":        {keys: keySpec{0, 0, 1}},
+	"SISMEMBER":       {keys: keySpec{0, 0, 1}},
+	"SCARD":           {keys: keySpec{0, 0, 1}},
+	"SINTER":          {keys: keySpec{0, -1, 1}, merge: mergeSetAlgebra},
+	"SUNION":          {keys: keySpec{0, -1, 1}, merge: mergeSetAlgebra},
+	"SDIFF":           {keys: keySpec{0, -1, 1}, merge: mergeSetAlgebra},
+	"ZADD":            {keys: keySpec{0, 0, 1}},
+	"ZREM":            {keys: keySpec{0, 0, 1}},
+	"ZSCORE":          {keys: keySpec{0, 0, 1}},
+	"ZRANK":           {keys: keySpec{0, 0, 1}},
+	"ZCARD":           {keys: keySpec{0, 0, 1}},
+	"ZRANGE":          {keys: keySpec{0, 0, 1}},
+	"ZRANGEBYSCORE":   {keys: keySpec{0, 0, 1}},
+}
+
+// extractKeys returns the keys referenced by args according to spec
+func extractKeys(spec keySpec, args []string) []string {
+	last := spec.last
+	if last < 0 {
+		last += len(args)
+	}
+	if last >= len(args) {
+		last = len(args) - 1
+	}
+
+	var keys []string
+	for i := spec.first; i <= last; i += spec.step {
+		keys = append(keys, args[i])
+	}
+	return keys
+}
@@ -0,0 +1,365 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"pulsedb/internal/proto"
+)
+
+// Proxy is a RESP front-end that shards the keyspace across several
+// backend PulseDB processes and merges multi-key results
+type Proxy struct {
+	backends []string
+	limits   proto.Limits
+}
+
+// NewProxy creates a proxy routing to the given backend addresses
+func NewProxy(backends []string) *Proxy {
+	return &Proxy{backends: backends, limits: proto.DefaultLimits}
+}
+
+// SetLimits sets the protocol limits enforced on client requests
+func (p *Proxy) SetLimits(limits proto.Limits) {
+	p.limits = limits
+}
+
+// Start listens on addr and proxies RESP connections until ctx is cancelled
+func (p *Proxy) Start(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	defer listener.Close()
+
+	// Accept connections in a separate goroutine
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				select {
+				case <-ctx.Done():
+					return
+				default:
+					slog.Error("Failed to accept connection", "error", err)
+					continue
+				}
+			}
+
+			go p.HandleConnection(conn)
+		}
+	}()
+
+	// Wait for context cancellation
+	<-ctx.Done()
+	return nil
+}
+
+// backendFor returns the index of the backend owning key
+func (p *Proxy) backendFor(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(p.backends)))
+}
+
+// HandleConnection proxies a single client connection. Each client gets its
+// own lazily dialed connection to every backend, so replies never interleave.
+func (p *Proxy) HandleConnection(conn net.Conn) {
+	defer conn.Close()
+
+	sess := &session{proxy: p, backends: make([]*proto.Client, len(p.backends))}
+	defer sess.close()
+
+	reader := proto.NewRESPReader(conn)
+	reader.SetLimits(p.limits)
+	buffered := bufio.NewWriter(conn)
+	writer := proto.NewRESPWriter(buffered)
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+
+		value, err := reader.Read()
+		if err != nil {
+			var protoErr *proto.ProtocolError
+			if errors.As(err, &protoErr) {
+				writer.WriteError("ERR " + protoErr.Error())
+				buffered.Flush()
+			}
+			return
+		}
+
+		response := sess.dispatch(value)
+
+		if err := writer.WriteValue(response); err != nil {
+			return
+		}
+		if reader.Buffered() == 0 {
+			if err := buffered.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// session holds the per-client state of the proxy
+type session struct {
+	proxy    *Proxy
+	backends []*proto.Client
+}
+
+func (s *session) close() {
+	for _, b := range s.backends {
+		if b != nil {
+			b.Close()
+		}
+	}
+}
+
+// backend returns the connection to backend i, dialing it on first use
+func (s *session) backend(i int) (*proto.Client, error) {
+	if s.backends[i] != nil {
+		return s.backends[i], nil
+	}
+
+	client, err := proto.Dial(s.proxy.backends[i], 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	s.backends[i] = client
+	return client, nil
+}
+
+// forward sends a command to backend i, dropping the connection on I/O errors
+func (s *session) forward(i int, cmd string, args []string) proto.RESPValue {
+	b, err := s.backend(i)
+	if err == nil {
+		var reply proto.RESPValue
+		if reply, err = b.Do(cmd, args...); err == nil {
+			return reply
+		}
+		b.Close()
+		s.backends[i] = nil
+	}
+
+	return proto.RESPValue{
+		Type:   proto.Error,
+		String: fmt.Sprintf("ERR backend %s unavailable: %v", s.proxy.backends[i], err),
+	}
+}
+
+func (s *session) dispatch(value proto.RESPValue) proto.RESPValue {
+	cmd, args, err := value.ToCommand()
+	if err != nil {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("ERR %s", err.Error()),
+		}
+	}
+
+	switch cmd {
+	case "PING":
+		if len(args) == 1 {
+			return proto.RESPValue{Type: proto.BulkString, String: args[0]}
+		}
+		return proto.RESPValue{Type: proto.SimpleString, String: "PONG"}
+	case "KEYS":
+		return s.keys(args)
+	case "SCAN":
+		return s.scan(args)
+	}
+
+	spec, exists := commandTable[cmd]
+	if !exists {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("ERR command '%s' is not supported in proxy mode", cmd),
+		}
+	}
+
+	if len(args) > 0 {
+		subcommand := strings.ToUpper(args[0])
+		if anyBackend, keyless := spec.keyless[subcommand]; keyless {
+			if !anyBackend {
+				return proto.RESPValue{
+					Type:   proto.Error,
+					String: fmt.Sprintf("ERR command '%s %s' is not supported in proxy mode", cmd, subcommand),
+				}
+			}
+			return s.forward(0, cmd, args)
+		}
+	}
+
+	keys := extractKeys(spec.keys, args)
+	if len(keys) == 0 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd)),
+		}
+	}
+
+	// Group keys by backend
+	byBackend := make(map[int][]string)
+	for _, key := range keys {
+		i := s.proxy.backendFor(key)
+		byBackend[i] = append(byBackend[i], key)
+	}
+
+	if len(byBackend) == 1 {
+		for i := range byBackend {
+			return s.forward(i, cmd, args)
+		}
+	}
+
+	switch spec.merge {
+	case mergeSum:
+		return s.sum(cmd, byBackend)
+	case mergeSetAlgebra:
+		return s.setAlgebra(cmd, keys)
+	default:
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "CROSSBACKEND Keys in request don't hash to the same backend",
+		}
+	}
+}
+
+// sum sends the keys of each backend separately and adds the integer replies
+func (s *session) sum(cmd string, byBackend map[int][]string) proto.RESPValue {
+	var total int64
+	for i, keys := range byBackend {
+		reply := s.forward(i, cmd, keys)
+		if reply.Type == proto.Error {
+			return reply
+		}
+		total += reply.Int
+	}
+	return proto.RESPValue{Type: proto.Integer, Int: total}
+}
+
+// setAlgebra fetches every set from its backend and combines them locally
+func (s *session) setAlgebra(cmd string, keys []string) proto.RESPValue {
+	sets := make([]map[string]struct{}, len(keys))
+	for i, key := range keys {
+		reply := s.forward(s.proxy.backendFor(key), "SMEMBERS", []string{key})
+		if reply.Type == proto.Error {
+			return reply
+		}
+		sets[i] = make(map[string]struct{}, len(reply.Array))
+		for _, member := range reply.Array {
+			sets[i][member.String] = struct{}{}
+		}
+	}
+
+	result := make(map[string]struct{})
+	switch cmd {
+	case "SUNION":
+		for _, set := range sets {
+			for member := range set {
+				result[member] = struct{}{}
+			}
+		}
+	case "SINTER":
+		for member := range sets[0] {
+			inAll := true
+			for _, other := range sets[1:] {
+				if _, ok := other[member]; !ok {
+					inAll = false
+					break
+				}
+			}
+			if inAll {
+				result[member] = struct{}{}
+			}
+		}
+	case "SDIFF":
+		for member := range sets[0] {
+			result[member] = struct{}{}
+		}
+		for _, other := range sets[1:] {
+			for member := range other {
+				delete(result, member)
+			}
+		}
+	}
+
+	members := make([]string, 0, len(result))
+	for member := range result {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+
+	array := make([]proto.RESPValue, len(members))
+	for i, member := range members {
+		array[i] = proto.RESPValue{Type: proto.BulkString, String: member}
+	}
+	return proto.RESPValue{Type: proto.Array, Array: array}
+}
+
+// keys broadcasts KEYS to every backend and concatenates the results
+func (s *session) keys(args []string) proto.RESPValue {
+	result := []proto.RESPValue{}
+	for i := range s.proxy.backends {
+		reply := s.forward(i, "KEYS", args)
+		if reply.Type == proto.Error {
+			return reply
+		}
+		result = append(result, reply.Array...)
+	}
+	return proto.RESPValue{Type: proto.Array, Array: result}
+}
+
+// scan walks the backends one after another. The proxy cursor encodes the
+// backend index and that backend's own cursor:
+// cursor = backendCursor*len(backends) + backendIndex.
+func (s *session) scan(args []string) proto.RESPValue {
+	if len(args) < 1 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'scan' command",
+		}
+	}
+
+	cursor, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: "ERR invalid cursor"}
+	}
+
+	n := uint64(len(s.proxy.backends))
+	i, backendCursor := cursor%n, cursor/n
+
+	backendArgs := append([]string{strconv.FormatUint(backendCursor, 10)}, args[1:]...)
+	reply := s.forward(int(i), "SCAN", backendArgs)
+	if reply.Type == proto.Error || len(reply.Array) != 2 {
+		return reply
+	}
+
+	next, err := strconv.ParseUint(reply.Array[0].String, 10, 64)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: "ERR invalid cursor from backend"}
+	}
+
+	// Move on to the next backend once this one is exhausted
+	var proxyCursor uint64
+	if next != 0 {
+		proxyCursor = next*n + i
+	} else if i+1 < n {
+		proxyCursor = i + 1
+	}
+
+	return proto.RESPValue{
+		Type: proto.Array,
+		Array: []proto.RESPValue{
+			{Type: proto.BulkString, String: strconv.FormatUint(proxyCursor, 10)},
+			reply.Array[1],
+		},
+	}
+}
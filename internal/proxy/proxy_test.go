@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/server"
+	"pulsedb/internal/store"
+)
+
+// startBackend runs an in-process PulseDB server and returns its address
+func startBackend(t *testing.T) string {
+	t.Helper()
+
+	db := store.NewStore()
+	srv := server.NewServer(db, nil)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() {
+		listener.Close()
+		db.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go srv.HandleConnection(conn)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func command(args ...string) proto.RESPValue {
+	array := make([]proto.RESPValue, len(args))
+	for i, arg := range args {
+		array[i] = proto.RESPValue{Type: proto.BulkString, String: arg}
+	}
+	return proto.RESPValue{Type: proto.Array, Array: array}
+}
+
+func TestProxyRoutingAndMerging(t *testing.T) {
+	p := NewProxy([]string{startBackend(t), startBackend(t)})
+	sess := &session{proxy: p, backends: make([]*proto.Client, 2)}
+	defer sess.close()
+
+	// Spread keys over both backends
+	perBackend := make(map[int]int)
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key:%d", i)
+		perBackend[p.backendFor(key)]++
+		if reply := sess.dispatch(command("SET", key, "v")); reply.String != "OK" {
+			t.Fatalf("Unexpected SET reply: %+v", reply)
+		}
+	}
+	if len(perBackend) != 2 {
+		t.Fatalf("Expected keys on both backends, got %v", perBackend)
+	}
+
+	if reply := sess.dispatch(command("GET", "key:7")); reply.String != "v" {
+		t.Errorf("Unexpected GET reply: %+v", reply)
+	}
+
+	if reply := sess.dispatch(command("EXISTS", "key:1", "key:2", "key:3", "missing")); reply.Int != 3 {
+		t.Errorf("Expected merged EXISTS count 3, got %+v", reply)
+	}
+
+	reply := sess.dispatch(command("KEYS", "key:*"))
+	if len(reply.Array) != 20 {
+		t.Errorf("Expected 20 keys from KEYS, got %d", len(reply.Array))
+	}
+
+	// SCAN must visit every backend
+	seen := make(map[string]bool)
+	cursor := "0"
+	for {
+		reply := sess.dispatch(command("SCAN", cursor, "COUNT", "5"))
+		if reply.Type == proto.Error {
+			t.Fatalf("SCAN failed: %s", reply.String)
+		}
+		for _, key := range reply.Array[1].Array {
+			seen[key.String] = true
+		}
+		cursor = reply.Array[0].String
+		if cursor == "0" {
+			break
+		}
+	}
+	if len(seen) != 20 {
+		t.Errorf("Expected SCAN to return 20 keys, got %d", len(seen))
+	}
+
+	if reply := sess.dispatch(command("DEL", "key:1", "key:2", "key:3")); reply.Int != 3 {
+		t.Errorf("Expected merged DEL count 3, got %+v", reply)
+	}
+}
+
+func TestProxySetAlgebraAcrossBackends(t *testing.T) {
+	p := NewProxy([]string{startBackend(t), startBackend(t)})
+	sess := &session{proxy: p, backends: make([]*proto.Client, 2)}
+	defer sess.close()
+
+	// Find two keys owned by different backends
+	a, b := "set:a", ""
+	for i := 0; b == ""; i++ {
+		if candidate := fmt.Sprintf("set:%d", i); p.backendFor(candidate) != p.backendFor(a) {
+			b = candidate
+		}
+	}
+
+	sess.dispatch(command("SADD", a, "x", "y"))
+	sess.dispatch(command("SADD", b, "y", "z"))
+
+	reply := sess.dispatch(command("SINTER", a, b))
+	if len(reply.Array) != 1 || reply.Array[0].String != "y" {
+		t.Errorf("Unexpected SINTER reply: %+v", reply)
+	}
+
+	reply = sess.dispatch(command("RENAME", a, b))
+	if reply.Type != proto.Error {
+		t.Errorf("Expected cross-backend RENAME to fail, got %+v", reply)
+	}
+}
+
+func TestProxyKeylessSubcommands(t *testing.T) {
+	p := NewProxy([]string{startBackend(t), startBackend(t)})
+	sess := &session{proxy: p, backends: make([]*proto.Client, 2)}
+	defer sess.close()
+
+	sess.dispatch(command("SET", "key", "v"))
+	if reply := sess.dispatch(command("STATS", "KEY", "key")); reply.Type == proto.Error {
+		t.Errorf("Expected STATS KEY to be routed by its key, got %+v", reply)
+	}
+	if reply := sess.dispatch(command("OBJECT", "VERSIONS", "key")); reply.Int != 1 {
+		t.Errorf("Expected OBJECT VERSIONS 1, got %+v", reply)
+	}
+
+	// A report covering one backend's keys is refused, whatever its arguments
+	for _, args := range [][]string{
+		{"STATS", "AMPLIFICATION"},
+		{"STATS", "amplification", "WINDOW", "60"},
+		{"STATS", "AMPLIFICATION", "COUNT", "5"},
+	} {
+		reply := sess.dispatch(command(args...))
+		if reply.Type != proto.Error || reply.String != "ERR command 'STATS AMPLIFICATION' is not supported in proxy mode" {
+			t.Errorf("Expected %v to be refused, got %+v", args, reply)
+		}
+	}
+
+	// Help is the same on every backend
+	for _, cmd := range []string{"OBJECT", "MEMORY"} {
+		reply := sess.dispatch(command(cmd, "help"))
+		if reply.Type != proto.Array || len(reply.Array) == 0 {
+			t.Errorf("Expected %s HELP to be answered, got %+v", cmd, reply)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package pubsub
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultBuffer is the number of messages queued per subscriber
+	DefaultBuffer = 1024
+
+	// ReservedPrefix starts the channels the server publishes to itself
+	ReservedPrefix = "__pulsedb__:"
+
+	// ConfigChannel receives an event for every runtime configuration change
+	ConfigChannel = ReservedPrefix + "config"
+)
+
+// IsReserved reports whether clients are barred from publishing to channel
+func IsReserved(channel string) bool {
+	return strings.HasPrefix(channel, ReservedPrefix)
+}
+
+// Message is a payload published to a channel
+type Message struct {
+	Channel string
+	Payload string
+}
+
+// Subscriber receives the messages of the channels it subscribed to. A
+// subscriber that falls more than its buffer behind is dropped: its
+// overflow function runs once and it receives nothing more.
+type Subscriber struct {
+	messages chan Message
+	overflow func()
+
+	mu       sync.Mutex
+	channels map[string]struct{}
+	dropped  bool
+}
+
+// NewSubscriber creates a subscriber queueing up to buffer messages
+func NewSubscriber(buffer int, overflow func()) *Subscriber {
+	return &Subscriber{
+		messages: make(chan Message, buffer),
+		overflow: overflow,
+		channels: make(map[string]struct{}),
+	}
+}
+
+// Messages returns the queue of messages delivered to the subscriber
+func (s *Subscriber) Messages() <-chan Message {
+	return s.messages
+}
+
+// Channels returns the channels the subscriber is subscribed to, sorted
+func (s *Subscriber) Channels() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	channels := make([]string, 0, len(s.channels))
+	for channel := range s.channels {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// Count returns the number of channels the subscriber is subscribed to
+func (s *Subscriber) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.channels)
+}
+
+// deliver queues msg without blocking the publisher
+func (s *Subscriber) deliver(msg Message) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dropped {
+		return false
+	}
+	select {
+	case s.messages <- msg:
+		return true
+	default:
+		s.dropped = true
+		if s.overflow != nil {
+			s.overflow()
+		}
+		return false
+	}
+}
+
+// Broker routes published messages to the subscribers of each channel and
+// is safe for concurrent use. A single broker is shared by every listener.
+type Broker struct {
+	mu       sync.RWMutex
+	channels map[string]map[*Subscriber]struct{}
+}
+
+// NewBroker creates a broker without subscriptions
+func NewBroker() *Broker {
+	return &Broker{channels: make(map[string]map[*Subscriber]struct{})}
+}
+
+// Subscribe subscribes sub to channel and returns the number of channels
+// sub is subscribed to
+func (b *Broker) Subscribe(sub *Subscriber, channel string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subscribers, exists := b.channels[channel]
+	if !exists {
+		subscribers = make(map[*Subscriber]struct{})
+		b.channels[channel] = subscribers
+	}
+	subscribers[sub] = struct{}{}
+
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	sub.channels[channel] = struct{}{}
+	return len(sub.channels)
+}
+
+// Unsubscribe removes sub from channel and returns the number of channels
+// sub is still subscribed to
+func (b *Broker) Unsubscribe(sub *Subscriber, channel string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if subscribers, exists := b.channels[channel]; exists {
+		delete(subscribers, sub)
+		if len(subscribers) == 0 {
+			delete(b.channels, channel)
+		}
+	}
+
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	delete(sub.channels, channel)
+	return len(sub.channels)
+}
+
+// UnsubscribeAll removes sub from every channel, once its connection is gone
+func (b *Broker) UnsubscribeAll(sub *Subscriber) {
+	for _, channel := range sub.Channels() {
+		b.Unsubscribe(sub, channel)
+	}
+}
+
+// Publish sends payload to the subscribers of channel and returns how many
+// received it
+func (b *Broker) Publish(channel, payload string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	msg := Message{Channel: channel, Payload: payload}
+	received := 0
+	for sub := range b.channels[channel] {
+		if sub.deliver(msg) {
+			received++
+		}
+	}
+	return received
+}
+
+// Subscribers returns the number of subscribers of channel
+func (b *Broker) Subscribers(channel string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.channels[channel])
+}
@@ -0,0 +1,61 @@
+package pubsub
+
+import "testing"
+
+func TestBroker(t *testing.T) {
+	b := NewBroker()
+	a := NewSubscriber(10, nil)
+	c := NewSubscriber(10, nil)
+
+	if n := b.Subscribe(a, "news"); n != 1 {
+		t.Errorf("Expected 1 subscription, got %d", n)
+	}
+	if n := b.Subscribe(a, "sport"); n != 2 {
+		t.Errorf("Expected 2 subscriptions, got %d", n)
+	}
+	b.Subscribe(c, "news")
+
+	if n := b.Publish("news", "hello"); n != 2 {
+		t.Errorf("Expected 2 receivers, got %d", n)
+	}
+	if msg := <-a.Messages(); msg.Channel != "news" || msg.Payload != "hello" {
+		t.Errorf("Unexpected message %+v", msg)
+	}
+	if n := b.Publish("weather", "rain"); n != 0 {
+		t.Errorf("Expected no receivers, got %d", n)
+	}
+
+	if n := b.Unsubscribe(a, "news"); n != 1 {
+		t.Errorf("Expected 1 subscription left, got %d", n)
+	}
+	if n := b.Publish("news", "again"); n != 1 {
+		t.Errorf("Expected 1 receiver, got %d", n)
+	}
+	b.UnsubscribeAll(a)
+	if a.Count() != 0 || b.Subscribers("sport") != 0 {
+		t.Errorf("Expected every subscription removed, got %v", a.Channels())
+	}
+}
+
+func TestSlowSubscriberDropped(t *testing.T) {
+	b := NewBroker()
+	overflows := 0
+	sub := NewSubscriber(2, func() { overflows++ })
+	b.Subscribe(sub, "ch")
+
+	for i := 0; i < 5; i++ {
+		b.Publish("ch", "m")
+	}
+	if overflows != 1 {
+		t.Errorf("Expected one overflow, got %d", overflows)
+	}
+	if len(sub.Messages()) != 2 {
+		t.Errorf("Expected the buffered messages to be kept, got %d", len(sub.Messages()))
+	}
+}
+
+func TestIsReserved(t *testing.T) {
+	if !IsReserved(ConfigChannel) || IsReserved("news") {
+		t.Error("Expected only server channels to be reserved")
+	}
+}
@@ -0,0 +1,340 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Schema is a compiled JSON Schema document. Only the commonly used subset of
+// the specification is supported: type, enum, const, properties, required,
+// additionalProperties, items, minimum, maximum, minLength, maxLength,
+// pattern, minItems and maxItems.
+type Schema struct {
+	Types                []string
+	Enum                 []interface{}
+	Const                interface{}
+	HasConst             bool
+	Properties           map[string]*Schema
+	Required             []string
+	AdditionalProperties *bool
+	Items                *Schema
+	Minimum              *float64
+	Maximum              *float64
+	MinLength            *int
+	MaxLength            *int
+	Pattern              *regexp.Regexp
+	MinItems             *int
+	MaxItems             *int
+
+	source string
+}
+
+// Compile parses a JSON Schema document
+func Compile(doc string) (*Schema, error) {
+	var raw interface{}
+	if err := json.Unmarshal([]byte(doc), &raw); err != nil {
+		return nil, fmt.Errorf("invalid schema JSON: %w", err)
+	}
+
+	s, err := compile(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	s.source = doc
+	return s, nil
+}
+
+// String returns the source document of the schema
+func (s *Schema) String() string {
+	return s.source
+}
+
+func compile(raw interface{}) (*Schema, error) {
+	obj, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("schema must be a JSON object")
+	}
+
+	s := &Schema{}
+
+	switch t := obj["type"].(type) {
+	case nil:
+	case string:
+		s.Types = []string{t}
+	case []interface{}:
+		for _, item := range t {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("type entries must be strings")
+			}
+			s.Types = append(s.Types, name)
+		}
+	default:
+		return nil, fmt.Errorf("type must be a string or array of strings")
+	}
+
+	if enum, ok := obj["enum"]; ok {
+		values, ok := enum.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("enum must be an array")
+		}
+		s.Enum = values
+	}
+
+	if c, ok := obj["const"]; ok {
+		s.Const = c
+		s.HasConst = true
+	}
+
+	if props, ok := obj["properties"]; ok {
+		propsObj, ok := props.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("properties must be an object")
+		}
+		s.Properties = make(map[string]*Schema, len(propsObj))
+		for name, sub := range propsObj {
+			compiled, err := compile(sub)
+			if err != nil {
+				return nil, fmt.Errorf("properties.%s: %w", name, err)
+			}
+			s.Properties[name] = compiled
+		}
+	}
+
+	if req, ok := obj["required"]; ok {
+		names, ok := req.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("required must be an array")
+		}
+		for _, name := range names {
+			str, ok := name.(string)
+			if !ok {
+				return nil, fmt.Errorf("required entries must be strings")
+			}
+			s.Required = append(s.Required, str)
+		}
+	}
+
+	if ap, ok := obj["additionalProperties"]; ok {
+		allowed, ok := ap.(bool)
+		if !ok {
+			return nil, fmt.Errorf("additionalProperties must be a boolean")
+		}
+		s.AdditionalProperties = &allowed
+	}
+
+	if items, ok := obj["items"]; ok {
+		compiled, err := compile(items)
+		if err != nil {
+			return nil, fmt.Errorf("items: %w", err)
+		}
+		s.Items = compiled
+	}
+
+	var err error
+	if s.Minimum, err = numberField(obj, "minimum"); err != nil {
+		return nil, err
+	}
+	if s.Maximum, err = numberField(obj, "maximum"); err != nil {
+		return nil, err
+	}
+	if s.MinLength, err = intField(obj, "minLength"); err != nil {
+		return nil, err
+	}
+	if s.MaxLength, err = intField(obj, "maxLength"); err != nil {
+		return nil, err
+	}
+	if s.MinItems, err = intField(obj, "minItems"); err != nil {
+		return nil, err
+	}
+	if s.MaxItems, err = intField(obj, "maxItems"); err != nil {
+		return nil, err
+	}
+
+	if p, ok := obj["pattern"]; ok {
+		str, ok := p.(string)
+		if !ok {
+			return nil, fmt.Errorf("pattern must be a string")
+		}
+		if s.Pattern, err = regexp.Compile(str); err != nil {
+			return nil, fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+
+	return s, nil
+}
+
+func numberField(obj map[string]interface{}, name string) (*float64, error) {
+	raw, ok := obj[name]
+	if !ok {
+		return nil, nil
+	}
+	value, ok := raw.(float64)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a number", name)
+	}
+	return &value, nil
+}
+
+func intField(obj map[string]interface{}, name string) (*int, error) {
+	value, err := numberField(obj, name)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	if *value < 0 || *value != math.Trunc(*value) {
+		return nil, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	n := int(*value)
+	return &n, nil
+}
+
+// Validate checks that value is a JSON document conforming to the schema.
+// The key is accepted so Schema satisfies the store's validator interface.
+func (s *Schema) Validate(key, value string) error {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(value), &doc); err != nil {
+		return fmt.Errorf("value is not valid JSON")
+	}
+	return s.validate("$", doc)
+}
+
+func (s *Schema) validate(path string, v interface{}) error {
+	if len(s.Types) > 0 {
+		matched := false
+		for _, t := range s.Types {
+			if hasType(v, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: expected %s, got %s", path, strings.Join(s.Types, " or "), typeName(v))
+		}
+	}
+
+	if s.HasConst && !equal(v, s.Const) {
+		return fmt.Errorf("%s: value must be %s", path, encode(s.Const))
+	}
+
+	if s.Enum != nil {
+		matched := false
+		for _, candidate := range s.Enum {
+			if equal(v, candidate) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: value must be one of %s", path, encode(s.Enum))
+		}
+	}
+
+	switch val := v.(type) {
+	case float64:
+		if s.Minimum != nil && val < *s.Minimum {
+			return fmt.Errorf("%s: must be >= %v", path, *s.Minimum)
+		}
+		if s.Maximum != nil && val > *s.Maximum {
+			return fmt.Errorf("%s: must be <= %v", path, *s.Maximum)
+		}
+	case string:
+		length := len([]rune(val))
+		if s.MinLength != nil && length < *s.MinLength {
+			return fmt.Errorf("%s: length must be >= %d", path, *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			return fmt.Errorf("%s: length must be <= %d", path, *s.MaxLength)
+		}
+		if s.Pattern != nil && !s.Pattern.MatchString(val) {
+			return fmt.Errorf("%s: must match pattern %s", path, s.Pattern)
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(val) < *s.MinItems {
+			return fmt.Errorf("%s: must have at least %d items", path, *s.MinItems)
+		}
+		if s.MaxItems != nil && len(val) > *s.MaxItems {
+			return fmt.Errorf("%s: must have at most %d items", path, *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range val {
+				if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := val[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+
+		// Iterate in sorted order so the reported error is deterministic
+		names := make([]string, 0, len(val))
+		for name := range val {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			sub, known := s.Properties[name]
+			if !known {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return fmt.Errorf("%s: unexpected property %q", path, name)
+				}
+				continue
+			}
+			if err := sub.validate(path+"."+name, val[name]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func hasType(v interface{}, t string) bool {
+	switch t {
+	case "integer":
+		n, ok := v.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	default:
+		return typeName(v) == t
+	}
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return "unknown"
+	}
+}
+
+func equal(a, b interface{}) bool {
+	return encode(a) == encode(b)
+}
+
+func encode(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,61 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	s, err := Compile(`{
+		"type": "object",
+		"required": ["name", "port"],
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": "string", "minLength": 1, "pattern": "^[a-z]+$"},
+			"port": {"type": "integer", "minimum": 1, "maximum": 65535},
+			"mode": {"enum": ["on", "off"]},
+			"tags": {"type": "array", "maxItems": 2, "items": {"type": "string"}}
+		}
+	}`)
+	if err != nil {
+		t.Fatalf("Unexpected compile error: %v", err)
+	}
+
+	tests := []struct {
+		value string
+		err   string
+	}{
+		{`{"name": "web", "port": 80}`, ""},
+		{`{"name": "web", "port": 80, "mode": "on", "tags": ["a"]}`, ""},
+		{`not json`, "not valid JSON"},
+		{`[]`, "expected object"},
+		{`{"name": "web"}`, `missing required property "port"`},
+		{`{"name": "web", "port": 80.5}`, "$.port: expected integer"},
+		{`{"name": "web", "port": 70000}`, "$.port: must be <="},
+		{`{"name": "Web", "port": 80}`, "$.name: must match pattern"},
+		{`{"name": "web", "port": 80, "mode": "auto"}`, "$.mode: value must be one of"},
+		{`{"name": "web", "port": 80, "tags": ["a", 1]}`, "$.tags[1]: expected string"},
+		{`{"name": "web", "port": 80, "extra": true}`, `unexpected property "extra"`},
+	}
+
+	for _, test := range tests {
+		err := s.Validate("key", test.value)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("Expected %s to be valid, got %v", test.value, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Expected error containing %q for %s, got %v", test.err, test.value, err)
+		}
+	}
+}
+
+func TestSchemaCompileErrors(t *testing.T) {
+	for _, doc := range []string{`not json`, `[]`, `{"type": 5}`, `{"minLength": -1}`, `{"pattern": "("}`} {
+		if _, err := Compile(doc); err == nil {
+			t.Errorf("Expected compile error for %s", doc)
+		}
+	}
+}
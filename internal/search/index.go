@@ -0,0 +1,177 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Index is an inverted index from terms to the keys of the documents
+// containing them. Documents are plain text, or JSON documents of which only
+// the configured paths are indexed.
+type Index struct {
+	paths []string
+
+	mu       sync.RWMutex
+	postings map[string]map[string]struct{} // term -> keys
+	terms    map[string][]string            // key -> indexed terms
+}
+
+// NewIndex creates an index. With no paths the whole value is indexed as
+// text; otherwise values are parsed as JSON and only the given dot-separated
+// paths (optionally prefixed with "$.") are indexed.
+func NewIndex(paths []string) *Index {
+	normalized := make([]string, len(paths))
+	for i, path := range paths {
+		normalized[i] = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	}
+
+	return &Index{
+		paths:    normalized,
+		postings: make(map[string]map[string]struct{}),
+		terms:    make(map[string][]string),
+	}
+}
+
+// Add indexes value under key, replacing any previous document for key
+func (ix *Index) Add(key, value string) {
+	terms := ix.extract(value)
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(key)
+	if len(terms) == 0 {
+		return
+	}
+
+	ix.terms[key] = terms
+	for _, term := range terms {
+		keys, exists := ix.postings[term]
+		if !exists {
+			keys = make(map[string]struct{})
+			ix.postings[term] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+// Remove drops the document indexed under key
+func (ix *Index) Remove(key string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.remove(key)
+}
+
+func (ix *Index) remove(key string) {
+	for _, term := range ix.terms[key] {
+		keys := ix.postings[term]
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(ix.postings, term)
+		}
+	}
+	delete(ix.terms, key)
+}
+
+// Len returns the number of indexed documents
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.terms)
+}
+
+// Search returns the sorted keys of the documents matching query.
+//
+// Terms separated by spaces must all match, '|' separates alternatives,
+// a leading '-' negates a term or group, parentheses group, and a trailing
+// '*' matches every term with the given prefix.
+func (ix *Index) Search(query string) ([]string, error) {
+	node, err := parseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	ix.mu.RLock()
+	matches := node.eval(ix)
+	ix.mu.RUnlock()
+
+	keys := make([]string, 0, len(matches))
+	for key := range matches {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// extract returns the distinct terms of a document
+func (ix *Index) extract(value string) []string {
+	var texts []string
+	if len(ix.paths) == 0 {
+		texts = []string{value}
+	} else {
+		var doc interface{}
+		if err := json.Unmarshal([]byte(value), &doc); err != nil {
+			return nil
+		}
+		for _, path := range ix.paths {
+			texts = appendText(texts, lookup(doc, path))
+		}
+	}
+
+	seen := make(map[string]struct{})
+	var terms []string
+	for _, text := range texts {
+		for _, term := range Tokenize(text) {
+			if _, dup := seen[term]; !dup {
+				seen[term] = struct{}{}
+				terms = append(terms, term)
+			}
+		}
+	}
+	return terms
+}
+
+// lookup follows a dot-separated path through a JSON document
+func lookup(doc interface{}, path string) interface{} {
+	if path == "" {
+		return doc
+	}
+	for _, field := range strings.Split(path, ".") {
+		obj, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		doc = obj[field]
+	}
+	return doc
+}
+
+// appendText appends the indexable text found in a JSON value
+func appendText(texts []string, v interface{}) []string {
+	switch val := v.(type) {
+	case string:
+		return append(texts, val)
+	case float64, bool:
+		return append(texts, fmt.Sprint(val))
+	case []interface{}:
+		for _, item := range val {
+			texts = appendText(texts, item)
+		}
+	case map[string]interface{}:
+		for _, item := range val {
+			texts = appendText(texts, item)
+		}
+	}
+	return texts
+}
+
+// Tokenize splits text into lowercase terms of letters and digits
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,68 @@
+package search
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIndexSearch(t *testing.T) {
+	ix := NewIndex(nil)
+	ix.Add("doc:1", "The quick brown fox")
+	ix.Add("doc:2", "A quick red panda")
+	ix.Add("doc:3", "Lazy brown dog")
+
+	tests := map[string]string{
+		"quick":             "doc:1,doc:2",
+		"quick brown":       "doc:1",
+		"fox | dog":         "doc:1,doc:3",
+		"brown -fox":        "doc:3",
+		"-brown":            "doc:2",
+		"qu*":               "doc:1,doc:2",
+		"(red | lazy) -dog": "doc:2",
+		"missing":           "",
+	}
+
+	for query, expected := range tests {
+		keys, err := ix.Search(query)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", query, err)
+			continue
+		}
+		if got := strings.Join(keys, ","); got != expected {
+			t.Errorf("%q: expected %q, got %q", query, expected, got)
+		}
+	}
+
+	// Re-adding a document replaces its terms
+	ix.Add("doc:1", "slow turtle")
+	if keys, _ := ix.Search("fox"); len(keys) != 0 {
+		t.Errorf("Expected replaced document to drop old terms, got %v", keys)
+	}
+
+	ix.Remove("doc:2")
+	if keys, _ := ix.Search("quick"); len(keys) != 0 {
+		t.Errorf("Expected removed document to be gone, got %v", keys)
+	}
+
+	for _, query := range []string{"", "(fox", "fox |", ")"} {
+		if _, err := ix.Search(query); err == nil {
+			t.Errorf("%q: expected parse error", query)
+		}
+	}
+}
+
+func TestIndexJSONPaths(t *testing.T) {
+	ix := NewIndex([]string{"$.title", "tags"})
+	ix.Add("p:1", `{"title": "Red shoes", "tags": ["sale", "summer"], "body": "hidden"}`)
+	ix.Add("p:2", "not json")
+
+	if keys, _ := ix.Search("shoes summer"); len(keys) != 1 || keys[0] != "p:1" {
+		t.Errorf("Expected p:1 to match indexed paths, got %v", keys)
+	}
+	if keys, _ := ix.Search("hidden"); len(keys) != 0 {
+		t.Errorf("Expected unindexed path to be ignored, got %v", keys)
+	}
+	if ix.Len() != 1 {
+		t.Errorf("Expected non-JSON value to be skipped, got %d documents", ix.Len())
+	}
+}
@@ -0,0 +1,219 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+)
+
+// node is a parsed query expression
+type node interface {
+	eval(ix *Index) map[string]struct{}
+}
+
+type termNode struct {
+	term   string
+	prefix bool
+}
+
+type andNode struct{ children []node }
+type orNode struct{ children []node }
+type notNode struct{ child node }
+
+// eval returns the keys containing the term. The caller holds ix.mu.
+func (n termNode) eval(ix *Index) map[string]struct{} {
+	result := make(map[string]struct{})
+	if !n.prefix {
+		for key := range ix.postings[n.term] {
+			result[key] = struct{}{}
+		}
+		return result
+	}
+
+	for term, keys := range ix.postings {
+		if strings.HasPrefix(term, n.term) {
+			for key := range keys {
+				result[key] = struct{}{}
+			}
+		}
+	}
+	return result
+}
+
+func (n andNode) eval(ix *Index) map[string]struct{} {
+	result := n.children[0].eval(ix)
+	for _, child := range n.children[1:] {
+		other := child.eval(ix)
+		for key := range result {
+			if _, ok := other[key]; !ok {
+				delete(result, key)
+			}
+		}
+	}
+	return result
+}
+
+func (n orNode) eval(ix *Index) map[string]struct{} {
+	result := make(map[string]struct{})
+	for _, child := range n.children {
+		for key := range child.eval(ix) {
+			result[key] = struct{}{}
+		}
+	}
+	return result
+}
+
+func (n notNode) eval(ix *Index) map[string]struct{} {
+	excluded := n.child.eval(ix)
+	result := make(map[string]struct{})
+	for key := range ix.terms {
+		if _, ok := excluded[key]; !ok {
+			result[key] = struct{}{}
+		}
+	}
+	return result
+}
+
+// parser is a recursive descent parser over query tokens:
+//
+//	expr  := and ('|' and)*
+//	and   := unary unary*
+//	unary := '-' unary | '(' expr ')' | term
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func parseQuery(query string) (node, error) {
+	p := &parser{tokens: lexQuery(query)}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("empty query")
+	}
+
+	n, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s' in query", p.tokens[p.pos])
+	}
+	return n, nil
+}
+
+// lexQuery splits a query into operators and words
+func lexQuery(query string) []string {
+	var tokens []string
+	var word strings.Builder
+
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+
+	for _, r := range query {
+		switch {
+		case r == '(' || r == ')' || r == '|':
+			flush()
+			tokens = append(tokens, string(r))
+		case r == '-' && word.Len() == 0:
+			tokens = append(tokens, "-")
+		case r == ' ' || r == '\t':
+			flush()
+		default:
+			word.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) expr() (node, error) {
+	first, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	children := []node{first}
+	for p.peek() == "|" {
+		p.pos++
+		next, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, next)
+	}
+
+	if len(children) == 1 {
+		return first, nil
+	}
+	return orNode{children: children}, nil
+}
+
+func (p *parser) and() (node, error) {
+	var children []node
+	for {
+		switch p.peek() {
+		case "", "|", ")":
+			if len(children) == 0 {
+				return nil, fmt.Errorf("missing term in query")
+			}
+			if len(children) == 1 {
+				return children[0], nil
+			}
+			return andNode{children: children}, nil
+		}
+
+		child, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+}
+
+func (p *parser) unary() (node, error) {
+	switch token := p.peek(); token {
+	case "-":
+		p.pos++
+		child, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{child: child}, nil
+	case "(":
+		p.pos++
+		n, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing ')' in query")
+		}
+		p.pos++
+		return n, nil
+	default:
+		p.pos++
+		prefix := strings.HasSuffix(token, "*")
+		terms := Tokenize(strings.TrimSuffix(token, "*"))
+		if len(terms) == 0 {
+			return nil, fmt.Errorf("invalid term '%s' in query", token)
+		}
+		// Words that tokenize into several terms must all match
+		nodes := make([]node, len(terms))
+		for i, term := range terms {
+			nodes[i] = termNode{term: term, prefix: prefix && i == len(terms)-1}
+		}
+		if len(nodes) == 1 {
+			return nodes[0], nil
+		}
+		return andNode{children: nodes}, nil
+	}
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"fmt"
+
+	"pulsedb/internal/apikeys"
+	"pulsedb/internal/proto"
+	"pulsedb/internal/throttle"
+)
+
+// authExempt lists the commands a connection may run before AUTH when API
+// keys are required
+var authExempt = map[string]bool{
+	"AUTH":  true,
+	"HELLO": true,
+}
+
+// namespacedUnkeyed lists the unkeyed commands a key restricted to a
+// namespace may still run, as they reach no other tenant's data
+var namespacedUnkeyed = map[string]bool{
+	"AUTH":         true,
+	"HELLO":        true,
+	"PING":         true,
+	"SNAPSHOT":     true,
+	"SELECT":       true,
+	"CAPABILITIES": true,
+}
+
+// multiKeyLast gives the last key argument of the keyed commands taking
+// several keys, negative counting from the end; the others take one key at
+// keyIndex
+var multiKeyLast = map[string]int{
+	"DEL":          -1,
+	"PURGE":        -1,
+	"EXISTS":       -1,
+	"TRANSFER":     1,
+	"RENAME":       1,
+	"RENAMENX":     1,
+	"COPY":         1,
+	"SKETCH.MERGE": -1,
+	"SINTER":       -1,
+	"SUNION":       -1,
+	"SDIFF":        -1,
+}
+
+// SetAPIKeys requires every connection to AUTH with a key from registry and
+// meters its usage against the key. Several listeners can share a registry.
+func (s *Server) SetAPIKeys(registry *apikeys.Registry) {
+	s.dispatcher.apiKeys = registry
+}
+
+// authorize checks that client has authenticated with a live key that may
+// run cmd, returning the error to reply with if not
+func (d *CommandDispatcher) authorize(client *Client, cmd string, args []string) (proto.RESPValue, bool) {
+	if authExempt[cmd] {
+		return proto.RESPValue{}, true
+	}
+	if client.apiKey == "" {
+		return proto.RESPValue{Type: proto.Error, String: "NOAUTH Authentication required."}, false
+	}
+
+	key, exists := d.apiKeys.Get(client.apiKey)
+	if !exists || key.Revoked != 0 {
+		client.apiKey = ""
+		return proto.RESPValue{Type: proto.Error, String: "NOAUTH API key has been revoked."}, false
+	}
+	if key.Namespace == "" {
+		return proto.RESPValue{}, true
+	}
+
+	keys, keyed := commandKeys(cmd, args)
+	if !keyed && !namespacedUnkeyed[cmd] {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("NOPERM command '%s' is not allowed for API keys restricted to a namespace", cmd),
+		}, false
+	}
+	for _, k := range keys {
+		if !key.Permits(throttle.Namespace(k)) {
+			return proto.RESPValue{
+				Type:   proto.Error,
+				String: fmt.Sprintf("NOPERM this API key can only access keys in namespace '%s'", key.Namespace),
+			}, false
+		}
+	}
+	return proto.RESPValue{}, true
+}
+
+// commandKeys returns the key arguments of cmd, and false if cmd takes no key
+func commandKeys(cmd string, args []string) ([]string, bool) {
+	i, keyed := keyIndex[cmd]
+	if !keyed {
+		return nil, false
+	}
+	if i >= len(args) {
+		return nil, true
+	}
+
+	last, multi := multiKeyLast[cmd]
+	if !multi {
+		return args[i : i+1], true
+	}
+	if last < 0 {
+		last += len(args)
+	}
+	return args[i:min(last+1, len(args))], true
+}
+
+// meter records a command and the encoded size of its request and reply
+// against the API key of client
+func (d *CommandDispatcher) meter(client *Client, cmd string, args []string, response proto.RESPValue) {
+	in := int64(len(cmd))
+	for _, arg := range args {
+		in += int64(len(arg))
+	}
+	var out int64
+	if encoded, err := proto.AppendValueProtocol(nil, response, d.replyProtocol(client)); err == nil {
+		out = int64(len(encoded))
+	}
+	d.apiKeys.Record(client.apiKey, in, out)
+}
+
+// handleAuth authenticates the connection with an API key:
+//
+//	AUTH [username] token
+//
+// The username is accepted for client compatibility and ignored.
+func (d *CommandDispatcher) handleAuth(c *Client, args []string) proto.RESPValue {
+	if len(args) != 1 && len(args) != 2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'auth' command",
+		}
+	}
+	if d.apiKeys == nil {
+		return proto.RESPValue{Type: proto.Error, String: "ERR AUTH called without any API keys configured"}
+	}
+	if err := d.authenticate(c, args[len(args)-1]); err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
+}
+
+// authenticate binds the connection to the key token belongs to
+func (d *CommandDispatcher) authenticate(c *Client, token string) error {
+	key, err := d.apiKeys.Authenticate(token)
+	if err != nil {
+		return fmt.Errorf("WRONGPASS invalid API key")
+	}
+	c.apiKey = key.ID
+	return nil
+}
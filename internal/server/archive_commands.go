@@ -0,0 +1,106 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"pulsedb/internal/archive"
+	"pulsedb/internal/proto"
+	"pulsedb/internal/store"
+)
+
+// handleArchive manages the archiving of expired and evicted keys:
+//
+//	ARCHIVE SET pattern STREAM name
+//	ARCHIVE DEL pattern
+//	ARCHIVE LIST
+//	ARCHIVE READ stream [count]
+//
+// File sinks can only be configured at startup with --archive, so clients
+// cannot make the server write to arbitrary paths.
+func (d *CommandDispatcher) handleArchive(db *store.Store, args []string) proto.RESPValue {
+	if len(args) == 0 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'archive' command",
+		}
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "SET":
+		if len(args) != 4 {
+			break
+		}
+		if strings.ToUpper(args[2]) != "STREAM" {
+			return proto.RESPValue{
+				Type:   proto.Error,
+				String: fmt.Sprintf("ERR unsupported archive sink '%s'", args[2]),
+			}
+		}
+		db.SetArchive(args[1], archive.NewStreamSink(d.streams, args[3]))
+		return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
+
+	case "DEL":
+		if len(args) != 2 {
+			break
+		}
+		if db.RemoveArchive(args[1]) {
+			return proto.RESPValue{Type: proto.Integer, Int: 1}
+		}
+		return proto.RESPValue{Type: proto.Integer, Int: 0}
+
+	case "LIST":
+		rules := db.Archives()
+		result := make([]proto.RESPValue, len(rules))
+		for i, rule := range rules {
+			result[i] = proto.RESPValue{
+				Type: proto.Map,
+				Array: []proto.RESPValue{
+					{Type: proto.BulkString, String: "pattern"},
+					{Type: proto.BulkString, String: rule.Pattern},
+					{Type: proto.BulkString, String: "sink"},
+					{Type: proto.BulkString, String: rule.Sink.String()},
+					{Type: proto.BulkString, String: "archived"},
+					{Type: proto.Integer, Int: rule.Archived},
+					{Type: proto.BulkString, String: "failed"},
+					{Type: proto.Integer, Int: rule.Failed},
+				},
+			}
+		}
+		return proto.RESPValue{Type: proto.Array, Array: result}
+
+	case "READ":
+		if len(args) < 2 || len(args) > 3 {
+			break
+		}
+		count := 10
+		if len(args) == 3 {
+			var err error
+			if count, err = strconv.Atoi(args[2]); err != nil || count < 1 {
+				return proto.RESPValue{
+					Type:   proto.Error,
+					String: "ERR value is not an integer or out of range",
+				}
+			}
+		}
+
+		entries, err := d.streams.LastEntries(args[1], count)
+		if err != nil {
+			return proto.RESPValue{Type: proto.Array, Array: []proto.RESPValue{}}
+		}
+
+		return entriesValue(entries, false)
+
+	default:
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("ERR unknown subcommand '%s'", args[0]),
+		}
+	}
+
+	return proto.RESPValue{
+		Type:   proto.Error,
+		String: fmt.Sprintf("ERR wrong number of arguments for 'archive %s' command", strings.ToLower(args[0])),
+	}
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/store"
+)
+
+// bucketGranularities maps granularity names to bucket widths
+var bucketGranularities = map[string]time.Duration{
+	"MINUTE": time.Minute,
+	"HOUR":   time.Hour,
+	"DAY":    24 * time.Hour,
+}
+
+// handleBucket manages time-bucketed key namespaces:
+//
+//	BUCKET CREATE prefix MINUTE|HOUR|DAY retention-seconds
+//	BUCKET DROP prefix
+//	BUCKET LIST
+//	BUCKET SET prefix key value
+//	BUCKET KEY prefix key [timestamp]
+//	BUCKET RANGE prefix key from to
+func (d *CommandDispatcher) handleBucket(db *store.Store, args []string) proto.RESPValue {
+	if len(args) == 0 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'bucket' command",
+		}
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "CREATE":
+		if len(args) != 4 {
+			return bucketArgsError("create")
+		}
+		granularity, ok := bucketGranularities[strings.ToUpper(args[2])]
+		if !ok {
+			return proto.RESPValue{
+				Type:   proto.Error,
+				String: fmt.Sprintf("ERR unsupported bucket granularity '%s'", args[2]),
+			}
+		}
+		retention, err := strconv.ParseInt(args[3], 10, 64)
+		if err != nil || retention < 0 {
+			return proto.RESPValue{
+				Type:   proto.Error,
+				String: "ERR value is not a valid retention",
+			}
+		}
+
+		if err := db.CreateBucketNamespace(args[1], granularity, time.Duration(retention)*time.Second); err != nil {
+			return proto.RESPValue{Type: proto.Error, String: err.Error()}
+		}
+		return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
+
+	case "DROP":
+		if len(args) != 2 {
+			return bucketArgsError("drop")
+		}
+		if db.DropBucketNamespace(args[1]) {
+			return proto.RESPValue{Type: proto.Integer, Int: 1}
+		}
+		return proto.RESPValue{Type: proto.Integer, Int: 0}
+
+	case "LIST":
+		namespaces := db.BucketNamespaces()
+		result := make([]proto.RESPValue, len(namespaces))
+		for i, ns := range namespaces {
+			result[i] = proto.RESPValue{
+				Type: proto.Map,
+				Array: []proto.RESPValue{
+					{Type: proto.BulkString, String: "prefix"},
+					{Type: proto.BulkString, String: ns.Prefix},
+					{Type: proto.BulkString, String: "granularity"},
+					{Type: proto.BulkString, String: granularityName(ns.Granularity)},
+					{Type: proto.BulkString, String: "retention"},
+					{Type: proto.Integer, Int: int64(ns.Retention / time.Second)},
+				},
+			}
+		}
+		return proto.RESPValue{Type: proto.Array, Array: result}
+
+	case "SET":
+		if len(args) != 4 {
+			return bucketArgsError("set")
+		}
+		key, err := db.BucketSet(args[1], args[2], args[3])
+		if err != nil {
+			return proto.RESPValue{Type: proto.Error, String: err.Error()}
+		}
+		return proto.RESPValue{Type: proto.BulkString, String: key}
+
+	case "KEY":
+		if len(args) != 3 && len(args) != 4 {
+			return bucketArgsError("key")
+		}
+		ts := time.Now().UnixMilli()
+		if len(args) == 4 {
+			var err error
+			if ts, err = strconv.ParseInt(args[3], 10, 64); err != nil {
+				return proto.RESPValue{
+					Type:   proto.Error,
+					String: "ERR value is not a valid timestamp",
+				}
+			}
+		}
+		key, err := db.BucketKey(args[1], args[2], ts)
+		if err != nil {
+			return proto.RESPValue{Type: proto.Error, String: err.Error()}
+		}
+		return proto.RESPValue{Type: proto.BulkString, String: key}
+
+	case "RANGE":
+		if len(args) != 5 {
+			return bucketArgsError("range")
+		}
+		from, err1 := strconv.ParseInt(args[3], 10, 64)
+		to, err2 := strconv.ParseInt(args[4], 10, 64)
+		if err1 != nil || err2 != nil {
+			return proto.RESPValue{
+				Type:   proto.Error,
+				String: "ERR value is not a valid timestamp",
+			}
+		}
+
+		entries, err := db.BucketRange(args[1], args[2], from, to)
+		if err != nil {
+			return proto.RESPValue{Type: proto.Error, String: err.Error()}
+		}
+
+		// Bucket label -> value map
+		result := make([]proto.RESPValue, 0, len(entries)*2)
+		for _, entry := range entries {
+			result = append(result,
+				proto.RESPValue{Type: proto.BulkString, String: entry.Bucket},
+				proto.RESPValue{Type: proto.BulkString, String: entry.Value},
+			)
+		}
+		return proto.RESPValue{Type: proto.Map, Array: result}
+
+	default:
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("ERR unknown subcommand '%s'", args[0]),
+		}
+	}
+}
+
+func bucketArgsError(subcommand string) proto.RESPValue {
+	return proto.RESPValue{
+		Type:   proto.Error,
+		String: fmt.Sprintf("ERR wrong number of arguments for 'bucket %s' command", subcommand),
+	}
+}
+
+// granularityName returns the command name of a bucket width
+func granularityName(granularity time.Duration) string {
+	for name, width := range bucketGranularities {
+		if width == granularity {
+			return strings.ToLower(name)
+		}
+	}
+	return granularity.String()
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/store"
+)
+
+// Changefeed. CHANGES replays the writes, deletes and expirations the
+// version history retains, then tails the live ones like XREAD BLOCK, so a
+// downstream system can build a materialized view and keep it current.
+
+// handleChanges reads the changes of the keys matching a pattern after an
+// ID:
+//
+//	CHANGES id [MATCH pattern] [COUNT n] [BLOCK milliseconds]
+//
+// The id is a Unix millisecond timestamp, whose own changes are included,
+// the ID of the last change read, or $ for the changes made from now on.
+// The reply is the ID to resume from followed by the changes, oldest
+// first, each as [id, type, key, value, value-type]: the type is SET,
+// DELETE or EXPIRE, the value type that of the value a SET wrote, string,
+// json, set, zset or sketch, and the value the string or JSON document
+// written. Both are null unless SET, and the value for other value types. With
+// BLOCK and no changes yet, it waits up to the given milliseconds, 0 meaning
+// forever, for one to be made. Only what retention keeps is replayed.
+func (d *CommandDispatcher) handleChanges(c *Client, args []string) proto.RESPValue {
+	if len(args) == 0 || len(args)%2 == 0 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'changes' command",
+		}
+	}
+
+	db := d.database(c)
+	after := db.Snapshot()
+	if args[0] != "$" {
+		var err error
+		if after, err = store.ParseChangeID(args[0]); err != nil {
+			return proto.RESPValue{Type: proto.Error, String: err.Error()}
+		}
+	}
+
+	pattern, count := "", 0
+	var block time.Duration
+	blocking := false
+	for i := 1; i < len(args); i += 2 {
+		option := strings.ToUpper(args[i])
+		if option == "MATCH" {
+			pattern = args[i+1]
+			continue
+		}
+		n, err := strconv.Atoi(args[i+1])
+		switch {
+		case option != "COUNT" && option != "BLOCK":
+			return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+		case err != nil || n < 0:
+			return proto.RESPValue{Type: proto.Error, String: "ERR value is not an integer or out of range"}
+		case option == "BLOCK":
+			block, blocking = time.Duration(n)*time.Millisecond, true
+		default:
+			count = n
+		}
+	}
+
+	// Subscribe before reading, so no change slips in between
+	var events <-chan store.Event
+	if blocking {
+		sub := db.Subscribe(pattern, 1)
+		defer sub.Close()
+		events = sub.Events()
+	}
+	var timeout <-chan time.Time
+	if blocking && block > 0 {
+		timer := time.NewTimer(block)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		changes, err := db.Changes(context.Background(), pattern, after, count)
+		if err != nil {
+			return proto.RESPValue{Type: proto.Error, String: "ERR " + err.Error()}
+		}
+		if len(changes) > 0 || !blocking {
+			return changesReply(after, changes)
+		}
+
+		waited := time.Now()
+		select {
+		case <-events:
+		case <-timeout:
+			c.blocked += time.Since(waited)
+			return changesReply(after, nil)
+		case <-c.unblocked:
+			c.blocked += time.Since(waited)
+			return changesReply(after, nil)
+		}
+		c.blocked += time.Since(waited)
+	}
+}
+
+// changesReply is the reply of CHANGES: the ID of the last change, or
+// after if there is none, and the changes
+func changesReply(after store.HLC, changes []store.Event) proto.RESPValue {
+	if len(changes) > 0 {
+		after = changes[len(changes)-1].ID()
+	}
+
+	result := make([]proto.RESPValue, len(changes))
+	for i, change := range changes {
+		result[i] = proto.RESPValue{
+			Type: proto.Array,
+			Array: []proto.RESPValue{
+				{Type: proto.BulkString, String: change.ID().String()},
+				{Type: proto.BulkString, String: string(change.Type)},
+				{Type: proto.BulkString, String: change.Key},
+				{Type: proto.BulkString, String: change.Value, Null: !change.HasValue()},
+				{Type: proto.BulkString, String: change.ValueType.String(), Null: change.Type != store.EventSet},
+			},
+		}
+	}
+
+	return proto.RESPValue{
+		Type: proto.Array,
+		Array: []proto.RESPValue{
+			{Type: proto.BulkString, String: after.String()},
+			{Type: proto.Array, Array: result},
+		},
+	}
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/pubsub"
+	"pulsedb/internal/store"
+)
+
+// nextClientID hands out connection IDs, starting at 1
+var nextClientID int64
+
+// Client holds the per-connection state negotiated by a client
+type Client struct {
+	ID       int64
+	Addr     string
+	Created  time.Time
+	Protocol int // RESP protocol version, set by HELLO
+
+	conn     net.Conn
+	output   *proto.OutputBuffer // Replies waiting to be written, nil without a connection
+	killed   atomic.Bool
+	quickAck atomic.Bool // Re-arm TCP_QUICKACK after every read
+
+	// Pub/sub state, only touched by the connection's own goroutine
+	subscriber   *pubsub.Subscriber // Created by the first SUBSCRIBE
+	extraReplies []proto.RESPValue  // Written after the command's own reply
+	writeMu      sync.Mutex         // Serialises replies and pushed messages
+
+	// Read timestamp of SNAPSHOT BEGIN, 0 outside snapshot mode; only
+	// touched by the connection's own goroutine
+	snapshot store.HLC
+
+	// ID of the API key the connection authenticated with, "" before AUTH;
+	// only touched by the connection's own goroutine
+	apiKey string
+
+	// Logical database selected with SELECT; only touched by the
+	// connection's own goroutine
+	db int
+
+	// Set while the connection runs a script, whose commands run under the
+	// isolation lock it holds; only touched by the connection's own goroutine
+	inScript bool
+
+	// Blocking commands wait until unblocked is closed, by a kill or a
+	// drain. blocked is the time the running command spent waiting, left
+	// out of its latency; only touched by the connection's own goroutine.
+	unblocked   chan struct{}
+	unblockOnce sync.Once
+	blocked     time.Duration
+
+	mu          sync.Mutex
+	name        string
+	lastCommand string
+	lastActive  time.Time
+}
+
+// NewClient creates the state for a new connection speaking RESP2
+func NewClient() *Client {
+	now := time.Now()
+	return &Client{
+		ID:         atomic.AddInt64(&nextClientID, 1),
+		Created:    now,
+		Protocol:   proto.RESP2,
+		lastActive: now,
+		unblocked:  make(chan struct{}),
+	}
+}
+
+// newConnClient creates the state for a client connected over conn
+func newConnClient(conn net.Conn) *Client {
+	c := NewClient()
+	c.conn = conn
+	c.Addr = conn.RemoteAddr().String()
+	return c
+}
+
+// Name returns the name set with CLIENT SETNAME or HELLO SETNAME
+func (c *Client) Name() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.name
+}
+
+// SetName sets the connection name
+func (c *Client) SetName(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.name = name
+}
+
+// touch records cmd as the last command run by the client
+func (c *Client) touch(cmd string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastCommand = strings.ToLower(cmd)
+	c.lastActive = time.Now()
+}
+
+// subscribed reports whether the client has any subscription
+func (c *Client) subscribed() bool {
+	return c.subscriber != nil && c.subscriber.Count() > 0
+}
+
+// kill closes the client's connection. A client killing itself is closed
+// once its reply has been written; a nil self closes it right away.
+func (c *Client) kill(self *Client) {
+	c.killed.Store(true)
+	c.unblock()
+	if c != self && c.conn != nil {
+		c.conn.Close()
+	}
+}
+
+// unblock wakes the client from a blocking command, and makes the blocking
+// commands it runs next return right away
+func (c *Client) unblock() {
+	c.unblockOnce.Do(func() { close(c.unblocked) })
+}
+
+// info formats the client as a CLIENT LIST line
+func (c *Client) info(now time.Time) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var omem int64
+	if c.output != nil {
+		omem = c.output.Len()
+	}
+	return fmt.Sprintf("id=%d addr=%s name=%s age=%d idle=%d resp=%d omem=%d cmd=%s",
+		c.ID, c.Addr, c.name,
+		int64(now.Sub(c.Created)/time.Second),
+		int64(now.Sub(c.lastActive)/time.Second),
+		c.Protocol, omem, c.lastCommand)
+}
+
+// clientRegistry tracks the connections of a server
+type clientRegistry struct {
+	mu      sync.RWMutex
+	clients map[int64]*Client
+}
+
+func newClientRegistry() *clientRegistry {
+	return &clientRegistry{clients: make(map[int64]*Client)}
+}
+
+// add registers c unless max clients are already connected (0 means no limit)
+func (r *clientRegistry) add(c *Client, max int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if max > 0 && len(r.clients) >= max {
+		return false
+	}
+	r.clients[c.ID] = c
+	return true
+}
+
+func (r *clientRegistry) remove(c *Client) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.clients, c.ID)
+}
+
+// list returns the connected clients ordered by ID
+func (r *clientRegistry) list() []*Client {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	clients := make([]*Client, 0, len(r.clients))
+	for _, c := range r.clients {
+		clients = append(clients, c)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].ID < clients[j].ID
+	})
+	return clients
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"pulsedb/internal/proto"
+)
+
+// handleClient implements connection management for operators:
+//
+//	CLIENT LIST
+//	CLIENT ID
+//	CLIENT GETNAME
+//	CLIENT SETNAME name
+//	CLIENT KILL addr
+//	CLIENT KILL [ID id] [ADDR addr]
+//	CLIENT NODELAY ON|OFF
+//	CLIENT QUICKACK ON|OFF
+func (d *CommandDispatcher) handleClient(c *Client, args []string) proto.RESPValue {
+	if len(args) == 0 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'client' command",
+		}
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "LIST":
+		now := time.Now()
+		var b strings.Builder
+		for _, client := range d.clients.list() {
+			b.WriteString(client.info(now))
+			b.WriteByte('\n')
+		}
+		return proto.RESPValue{Type: proto.BulkString, String: b.String()}
+
+	case "ID":
+		return proto.RESPValue{Type: proto.Integer, Int: c.ID}
+
+	case "GETNAME":
+		name := c.Name()
+		if name == "" {
+			return proto.RESPValue{Type: proto.BulkString, Null: true}
+		}
+		return proto.RESPValue{Type: proto.BulkString, String: name}
+
+	case "SETNAME":
+		if len(args) != 2 {
+			return proto.RESPValue{
+				Type:   proto.Error,
+				String: "ERR wrong number of arguments for 'client setname' command",
+			}
+		}
+		if strings.ContainsAny(args[1], " \n") {
+			return proto.RESPValue{
+				Type:   proto.Error,
+				String: "ERR Client names cannot contain spaces, newlines or special characters.",
+			}
+		}
+		c.SetName(args[1])
+		return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
+
+	case "KILL":
+		return d.clientKill(c, args[1:])
+
+	case "NODELAY", "QUICKACK":
+		return clientSocketOption(c, strings.ToUpper(args[0]), args[1:])
+
+	default:
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("ERR unknown subcommand '%s'", args[0]),
+		}
+	}
+}
+
+// clientKill closes the connections matching the given filters
+func (d *CommandDispatcher) clientKill(c *Client, args []string) proto.RESPValue {
+	if len(args) == 0 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'client kill' command",
+		}
+	}
+
+	// Old form: CLIENT KILL addr, replying OK or an error
+	if len(args) == 1 {
+		for _, client := range d.clients.list() {
+			if client.Addr == args[0] {
+				client.kill(c)
+				return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
+			}
+		}
+		return proto.RESPValue{Type: proto.Error, String: "ERR No such client"}
+	}
+
+	if len(args)%2 != 0 {
+		return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+	}
+
+	var id int64
+	var addr string
+	for i := 0; i < len(args); i += 2 {
+		switch strings.ToUpper(args[i]) {
+		case "ID":
+			var err error
+			if id, err = strconv.ParseInt(args[i+1], 10, 64); err != nil || id <= 0 {
+				return proto.RESPValue{Type: proto.Error, String: "ERR client-id should be greater than 0"}
+			}
+		case "ADDR":
+			addr = args[i+1]
+		default:
+			return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+		}
+	}
+
+	killed := int64(0)
+	for _, client := range d.clients.list() {
+		if (id != 0 && client.ID != id) || (addr != "" && client.Addr != addr) {
+			continue
+		}
+		client.kill(c)
+		killed++
+	}
+	return proto.RESPValue{Type: proto.Integer, Int: killed}
+}
+
+// clientSocketOption toggles TCP_NODELAY or TCP_QUICKACK on the caller's connection
+func clientSocketOption(c *Client, option string, args []string) proto.RESPValue {
+	if len(args) != 1 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("ERR wrong number of arguments for 'client %s' command", strings.ToLower(option)),
+		}
+	}
+
+	var enabled bool
+	switch strings.ToUpper(args[0]) {
+	case "ON":
+		enabled = true
+	case "OFF":
+		enabled = false
+	default:
+		return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+	}
+
+	tcp, ok := c.conn.(*net.TCPConn)
+	if !ok {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR connection is not a TCP connection",
+		}
+	}
+
+	var err error
+	if option == "NODELAY" {
+		err = tcp.SetNoDelay(enabled)
+	} else {
+		if !quickAckSupported {
+			return proto.RESPValue{
+				Type:   proto.Error,
+				String: "ERR TCP_QUICKACK is only supported on Linux",
+			}
+		}
+		err = setQuickAck(tcp, enabled)
+		c.quickAck.Store(enabled)
+	}
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: fmt.Sprintf("ERR %s", err.Error())}
+	}
+
+	return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/store"
+	"pulsedb/internal/throttle"
+)
+
+// configParameter is a runtime setting exposed through CONFIG GET/SET
+type configParameter struct {
+	get func() string
+	set func(value string) error
+}
+
+// configParameters returns the settings that can be read and changed at
+// runtime, by lowercase name
+func (d *CommandDispatcher) configParameters() map[string]configParameter {
+	return map[string]configParameter{
+		"default-ttl": {
+			get: func() string {
+				return store.FormatDefaultTTLs(d.store.DefaultTTLs())
+			},
+			set: func(value string) error {
+				defaults, err := store.ParseDefaultTTLs(value)
+				if err != nil {
+					return err
+				}
+				return d.store.ReplaceDefaultTTLs(defaults)
+			},
+		},
+		"read-only": {
+			get: func() string {
+				return yesNo(d.store.ReadOnly())
+			},
+			set: func(value string) error {
+				enabled, err := parseYesNo(value)
+				if err != nil {
+					return err
+				}
+				d.store.SetReadOnly(enabled)
+				return nil
+			},
+		},
+		"resp2-compat": {
+			get: func() string {
+				return yesNo(d.resp2Compat.Load())
+			},
+			set: func(value string) error {
+				enabled, err := parseYesNo(value)
+				if err != nil {
+					return err
+				}
+				d.resp2Compat.Store(enabled)
+				return nil
+			},
+		},
+		"retention": {
+			get: func() string {
+				return d.store.Retention().String()
+			},
+			set: func(value string) error {
+				policy, err := store.ParseRetention(value)
+				if err != nil {
+					return err
+				}
+				d.store.SetRetention(policy)
+				return nil
+			},
+		},
+		"sliding-ttl": {
+			get: func() string {
+				return strings.Join(d.store.SlidingPatterns(), ",")
+			},
+			set: func(value string) error {
+				d.store.SetSlidingPatterns(store.ParseSlidingPatterns(value))
+				return nil
+			},
+		},
+		"throttle": {
+			get: func() string {
+				return throttle.FormatQuotas(d.throttle.Quotas())
+			},
+			set: func(value string) error {
+				quotas, err := throttle.ParseQuotas(value)
+				if err != nil {
+					return err
+				}
+				d.throttle.SetQuotas(quotas)
+				return nil
+			},
+		},
+		"rate-limit": {
+			get: func() string {
+				return throttle.FormatRates(d.rateLimit.Rates())
+			},
+			set: func(value string) error {
+				rates, err := throttle.ParseRates(value)
+				if err != nil {
+					return err
+				}
+				d.rateLimit.SetRates(rates)
+				return nil
+			},
+		},
+	}
+}
+
+// handleConfig reads and changes runtime settings:
+//
+//	CONFIG GET pattern [pattern ...]
+//	CONFIG SET parameter value
+//
+// Every change is published on pubsub.ConfigChannel.
+func (d *CommandDispatcher) handleConfig(db *store.Store, args []string) proto.RESPValue {
+	if len(args) == 0 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'config' command",
+		}
+	}
+
+	params := d.configParameters()
+
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		if len(args) < 2 {
+			return proto.RESPValue{
+				Type:   proto.Error,
+				String: "ERR wrong number of arguments for 'config get' command",
+			}
+		}
+
+		var names []string
+		for name := range params {
+			for _, pattern := range args[1:] {
+				if store.MatchPattern(strings.ToLower(pattern), name) {
+					names = append(names, name)
+					break
+				}
+			}
+		}
+		sort.Strings(names)
+
+		result := make([]proto.RESPValue, 0, len(names)*2)
+		for _, name := range names {
+			result = append(result,
+				proto.RESPValue{Type: proto.BulkString, String: name},
+				proto.RESPValue{Type: proto.BulkString, String: params[name].get()},
+			)
+		}
+		return proto.RESPValue{Type: proto.Map, Array: result}
+
+	case "SET":
+		if len(args) != 3 {
+			return proto.RESPValue{
+				Type:   proto.Error,
+				String: "ERR wrong number of arguments for 'config set' command",
+			}
+		}
+
+		param, exists := params[strings.ToLower(args[1])]
+		if !exists {
+			return proto.RESPValue{
+				Type:   proto.Error,
+				String: fmt.Sprintf("ERR unknown configuration parameter '%s'", args[1]),
+			}
+		}
+		if err := param.set(args[2]); err != nil {
+			return proto.RESPValue{
+				Type:   proto.Error,
+				String: fmt.Sprintf("ERR invalid value for '%s': %s", args[1], err.Error()),
+			}
+		}
+		d.publishConfigEvent(configEvent{
+			Event:     "config-set",
+			Parameter: strings.ToLower(args[1]),
+			Value:     param.get(),
+		})
+		return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
+
+	default:
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("ERR unknown subcommand '%s'", args[0]),
+		}
+	}
+}
+
+// yesNo formats a boolean setting like Redis does
+func yesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+	return "no"
+}
+
+// parseYesNo parses a boolean setting
+func parseYesNo(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes":
+		return true, nil
+	case "no":
+		return false, nil
+	default:
+		return false, fmt.Errorf("argument must be 'yes' or 'no'")
+	}
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/store"
+)
+
+// Logical databases. Every connection starts on database 0 and SELECT
+// switches it to another; keyed commands run against the selected
+// database. The configuration (default TTLs, retention, archive rules...)
+// is shared by all databases.
+
+// database returns the logical database c has selected
+func (d *CommandDispatcher) database(c *Client) *store.Store {
+	if c.db == 0 {
+		return d.store
+	}
+	db, err := d.store.DB(c.db)
+	if err != nil {
+		return d.store
+	}
+	return db
+}
+
+// handleSelect switches the connection to another logical database:
+//
+//	SELECT index
+func (d *CommandDispatcher) handleSelect(c *Client, args []string) proto.RESPValue {
+	if len(args) != 1 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'select' command",
+		}
+	}
+
+	index, err := strconv.Atoi(args[0])
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: "ERR value is not an integer or out of range"}
+	}
+	if _, err := d.store.DB(index); err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	c.db = index
+	return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
+}
+
+// handleFlushDB erases every key of the selected database with its history
+func (d *CommandDispatcher) handleFlushDB(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 0 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'flushdb' command",
+		}
+	}
+
+	db.Flush()
+	return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
+}
+
+// handleFlushAll erases every key of every database with its history
+func (d *CommandDispatcher) handleFlushAll(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 0 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'flushall' command",
+		}
+	}
+
+	db.FlushAll()
+	return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
+}
+
+// handleCopy copies a key with its history and TTL:
+//
+//	COPY source destination [DB index] [REPLACE]
+//
+// DB copies into another logical database. It replies 1 if the key was
+// copied, 0 if the source does not exist or the destination exists and
+// REPLACE was not given.
+func (d *CommandDispatcher) handleCopy(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'copy' command",
+		}
+	}
+
+	target, replace := db, false
+	for i := 2; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); {
+		case option == "REPLACE":
+			replace = true
+		case option == "DB" && i+1 < len(args):
+			index, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return proto.RESPValue{Type: proto.Error, String: "ERR value is not an integer or out of range"}
+			}
+			if target, err = db.DB(index); err != nil {
+				return proto.RESPValue{Type: proto.Error, String: err.Error()}
+			}
+			i++
+		default:
+			return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+		}
+	}
+	if target == db && args[0] == args[1] {
+		return proto.RESPValue{Type: proto.Error, String: "ERR source and destination objects are the same"}
+	}
+
+	copied, err := db.Copy(args[0], target, args[1], replace)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	if copied {
+		return proto.RESPValue{Type: proto.Integer, Int: 1}
+	}
+	return proto.RESPValue{Type: proto.Integer, Int: 0}
+}
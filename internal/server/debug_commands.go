@@ -0,0 +1,315 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/store"
+)
+
+// ttlBuckets group pending expirations by how soon they are due
+var ttlBuckets = []struct {
+	label  string
+	within time.Duration
+}{
+	{"1s", time.Second},
+	{"1m", time.Minute},
+	{"1h", time.Hour},
+	{"1d", 24 * time.Hour},
+}
+
+// debugHelp is the reply of DEBUG HELP
+var debugHelp = []string{
+	"DEBUG <subcommand> [<arg> ...]. Subcommands are:",
+	"TTL [<pattern>] [CURSOR <cursor>] [COUNT <count>]",
+	"    List the keys scheduled to expire, soonest first.",
+	"OBJECT <key>",
+	"    Show how the key is stored and accessed.",
+	"SHARD <key>",
+	"    Show the shard holding the key, its size and lock waits.",
+	"SLEEP <seconds>",
+	"    Stop the connection for the given seconds, fractions allowed.",
+	"SET-ACTIVE-EXPIRE <on|off>",
+	"    Turn the background expiry sweep on or off.",
+	"QUICKLOAD <count> [<prefix> [<size>]]",
+	"    Create <count> keys <prefix>:0... holding value:0... padded to <size> bytes.",
+	"HELP",
+	"    Print this help.",
+}
+
+// handleDebug serves introspection and testing commands for operators:
+//
+//	DEBUG TTL [pattern] [CURSOR cursor] [COUNT count]
+//	DEBUG OBJECT key
+//	DEBUG SHARD key
+//	DEBUG SLEEP seconds
+//	DEBUG SET-ACTIVE-EXPIRE on|off
+//	DEBUG QUICKLOAD count [prefix [size]]
+//	DEBUG HELP
+func (d *CommandDispatcher) handleDebug(db *store.Store, args []string) proto.RESPValue {
+	if len(args) == 0 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'debug' command",
+		}
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "TTL":
+		return d.debugTTL(db, args[1:])
+	case "HELP":
+		if len(args) == 1 {
+			return helpReply(debugHelp)
+		}
+	case "OBJECT":
+		if len(args) == 2 {
+			return debugObject(db, args[1])
+		}
+	case "SHARD":
+		if len(args) == 2 {
+			return debugShard(db, args[1])
+		}
+	case "SLEEP":
+		if len(args) == 2 {
+			return debugSleep(args[1])
+		}
+	case "SET-ACTIVE-EXPIRE":
+		if len(args) == 2 {
+			return debugSetActiveExpire(db, args[1])
+		}
+	case "QUICKLOAD":
+		if len(args) >= 2 && len(args) <= 4 {
+			return debugQuickload(db, args[1:])
+		}
+	default:
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("ERR unknown subcommand '%s'. Try DEBUG HELP.", args[0]),
+		}
+	}
+
+	return proto.RESPValue{
+		Type:   proto.Error,
+		String: fmt.Sprintf("ERR wrong number of arguments for 'debug %s' command", strings.ToLower(args[0])),
+	}
+}
+
+// debugObject describes a key on one line, like Redis DEBUG OBJECT, without
+// counting as an access
+func debugObject(db *store.Store, key string) proto.RESPValue {
+	stats, exists := db.KeyStats(key)
+	if !exists {
+		return proto.RESPValue{Type: proto.Error, String: "ERR no such key"}
+	}
+	idle := max(time.Now().UnixMilli()-stats.LastAccess, 0) / 1000
+	return proto.RESPValue{
+		Type: proto.SimpleString,
+		String: fmt.Sprintf("type:%s encoding:%s versions:%d bytes:%d lru_seconds_idle:%d freq:%d ttl:%d shard:%d",
+			stats.Type, stats.Encoding, stats.Versions, stats.Bytes, idle, stats.Freq, stats.TTL, db.ShardInfo(key).Index),
+	}
+}
+
+// debugShard describes the shard a key maps to, whether or not it exists:
+// its keys and versions, the mutations queued for its owner goroutine, and
+// how long taking its locks and running a no-op on the owner took
+func debugShard(db *store.Store, key string) proto.RESPValue {
+	info := db.ShardInfo(key)
+	return proto.RESPValue{
+		Type: proto.Map,
+		Array: []proto.RESPValue{
+			{Type: proto.BulkString, String: "shard"},
+			{Type: proto.Integer, Int: int64(info.Index)},
+			{Type: proto.BulkString, String: "keys"},
+			{Type: proto.Integer, Int: int64(info.Keys)},
+			{Type: proto.BulkString, String: "versions"},
+			{Type: proto.Integer, Int: int64(info.Versions)},
+			{Type: proto.BulkString, String: "queued"},
+			{Type: proto.Integer, Int: int64(info.Queued)},
+			{Type: proto.BulkString, String: "read_lock_wait_us"},
+			{Type: proto.Integer, Int: info.ReadWait.Microseconds()},
+			{Type: proto.BulkString, String: "write_lock_wait_us"},
+			{Type: proto.Integer, Int: info.WriteWait.Microseconds()},
+			{Type: proto.BulkString, String: "round_trip_us"},
+			{Type: proto.Integer, Int: info.RoundTrip.Microseconds()},
+		},
+	}
+}
+
+// debugSleep blocks the connection for the given seconds, at most the
+// longest time.Duration
+func debugSleep(arg string) proto.RESPValue {
+	seconds, err := strconv.ParseFloat(arg, 64)
+	// NaN fails every comparison, so it is refused along with the negatives
+	if err != nil || !(seconds >= 0) || seconds > math.MaxInt64/float64(time.Second) {
+		return proto.RESPValue{Type: proto.Error, String: "ERR value is not a valid float"}
+	}
+	time.Sleep(time.Duration(seconds * float64(time.Second)))
+	return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
+}
+
+// debugSetActiveExpire turns the background expiry sweep on or off. It
+// accepts 1 and 0 as well, as Redis does.
+func debugSetActiveExpire(db *store.Store, arg string) proto.RESPValue {
+	switch strings.ToLower(arg) {
+	case "on", "1":
+		db.SetActiveExpire(true)
+	case "off", "0":
+		db.SetActiveExpire(false)
+	default:
+		return proto.RESPValue{Type: proto.Error, String: "ERR argument must be 'on' or 'off'"}
+	}
+	return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
+}
+
+// debugQuickload creates count synthetic keys prefix:0 to prefix:count-1
+// holding value:0 to value:count-1, padded with x or truncated to size
+// bytes when given. Existing keys are left alone. It returns the number of
+// keys created.
+func debugQuickload(db *store.Store, args []string) proto.RESPValue {
+	count, err := strconv.Atoi(args[0])
+	if err != nil || count < 0 {
+		return proto.RESPValue{Type: proto.Error, String: "ERR value is not an integer or out of range"}
+	}
+	prefix, size := "key", -1
+	if len(args) > 1 {
+		prefix = args[1]
+	}
+	if len(args) > 2 {
+		if size, err = strconv.Atoi(args[2]); err != nil || size < 0 {
+			return proto.RESPValue{Type: proto.Error, String: "ERR value is not an integer or out of range"}
+		}
+	}
+	if db.ReadOnly() {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "READONLY 'DEBUG QUICKLOAD' writes and the server is in read-only mode",
+		}
+	}
+
+	created := int64(0)
+	for i := range count {
+		value := "value:" + strconv.Itoa(i)
+		if size >= 0 {
+			if len(value) < size {
+				value += strings.Repeat("x", size-len(value))
+			}
+			value = value[:size]
+		}
+		result, err := db.SetWithOptions(prefix+":"+strconv.Itoa(i), value, store.SetOptions{Cond: store.SetIfMissing})
+		if err != nil {
+			return proto.RESPValue{Type: proto.Error, String: err.Error()}
+		}
+		if result.Written {
+			created++
+		}
+	}
+	return proto.RESPValue{Type: proto.Integer, Int: created}
+}
+
+// debugTTL lists the keys scheduled to expire, soonest first, with their
+// remaining milliseconds. The reply also counts every matching entry by how
+// soon it is due, and the stale entries left by keys written again without
+// a TTL. Pages are walked with the returned cursor, 0 when done.
+func (d *CommandDispatcher) debugTTL(db *store.Store, args []string) proto.RESPValue {
+	pattern := ""
+	if len(args)%2 == 1 {
+		pattern, args = args[0], args[1:]
+	}
+
+	cursor, count := 0, 10
+	for i := 0; i < len(args); i += 2 {
+		n, err := strconv.Atoi(args[i+1])
+		switch strings.ToUpper(args[i]) {
+		case "CURSOR":
+			if err != nil || n < 0 {
+				return proto.RESPValue{Type: proto.Error, String: "ERR invalid cursor"}
+			}
+			cursor = n
+		case "COUNT":
+			if err != nil || n < 1 {
+				return proto.RESPValue{
+					Type:   proto.Error,
+					String: "ERR value is not an integer or out of range",
+				}
+			}
+			count = n
+		default:
+			return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+		}
+	}
+
+	entries := db.Expirations(pattern)
+	now := time.Now().UnixMilli()
+
+	// Bucket counts cover every matching entry, not just the page
+	counts := make([]int64, len(ttlBuckets)+2) // expired, buckets..., later
+	stale := int64(0)
+	for _, entry := range entries {
+		if entry.Stale {
+			stale++
+		}
+		remaining := entry.ExpiresAt - now
+		bucket := len(counts) - 1
+		if remaining <= 0 {
+			bucket = 0
+		} else {
+			for i, b := range ttlBuckets {
+				if remaining <= b.within.Milliseconds() {
+					bucket = i + 1
+					break
+				}
+			}
+		}
+		counts[bucket]++
+	}
+
+	buckets := make([]proto.RESPValue, 0, len(counts)*2)
+	for i, n := range counts {
+		label := "later"
+		switch {
+		case i == 0:
+			label = "expired"
+		case i <= len(ttlBuckets):
+			label = "<=" + ttlBuckets[i-1].label
+		}
+		buckets = append(buckets,
+			proto.RESPValue{Type: proto.BulkString, String: label},
+			proto.RESPValue{Type: proto.Integer, Int: n},
+		)
+	}
+
+	next := 0
+	page := entries[min(cursor, len(entries)):]
+	if len(page) > count {
+		page = page[:count]
+		next = cursor + count
+	}
+
+	keys := make([]proto.RESPValue, 0, len(page)*2)
+	for _, entry := range page {
+		keys = append(keys,
+			proto.RESPValue{Type: proto.BulkString, String: entry.Key},
+			proto.RESPValue{Type: proto.Integer, Int: max(entry.ExpiresAt-now, 0)},
+		)
+	}
+
+	return proto.RESPValue{
+		Type: proto.Map,
+		Array: []proto.RESPValue{
+			{Type: proto.BulkString, String: "cursor"},
+			{Type: proto.Integer, Int: int64(next)},
+			{Type: proto.BulkString, String: "total"},
+			{Type: proto.Integer, Int: int64(len(entries))},
+			{Type: proto.BulkString, String: "stale"},
+			{Type: proto.Integer, Int: stale},
+			{Type: proto.BulkString, String: "buckets"},
+			{Type: proto.Map, Array: buckets},
+			{Type: proto.BulkString, String: "keys"},
+			{Type: proto.Map, Array: keys},
+		},
+	}
+}
@@ -1,28 +1,76 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"math"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	"pulsedb/internal/apikeys"
+	"pulsedb/internal/info"
+	"pulsedb/internal/latency"
+	"pulsedb/internal/metrics"
 	"pulsedb/internal/proto"
+	"pulsedb/internal/pubsub"
+	"pulsedb/internal/slowlog"
 	"pulsedb/internal/store"
+	"pulsedb/internal/streams"
+	"pulsedb/internal/throttle"
+	"pulsedb/internal/wasm"
 )
 
-// CommandHandler represents a command handler function
-type CommandHandler func(args []string) proto.RESPValue
+// CommandHandler represents a command handler function, run against the
+// logical database the calling connection has selected
+type CommandHandler func(db *store.Store, args []string) proto.RESPValue
+
+// ClientHandler represents a handler for a command that reads or changes
+// the state of the calling connection
+type ClientHandler func(c *Client, args []string) proto.RESPValue
 
 // CommandDispatcher handles command dispatching and execution
 type CommandDispatcher struct {
-	store    *store.Store
-	commands map[string]CommandHandler
+	store          *store.Store
+	commands       map[string]CommandHandler
+	clientCommands map[string]ClientHandler
+	allowed        map[string]bool // Commands exposed by this dispatcher, nil means all
+	clients        *clientRegistry // Connections served with this dispatcher
+	metrics        *metrics.Metrics
+	slowlog        *slowlog.Log
+	latency        *latency.Monitor
+	stats          *info.Stats // Counters reported by INFO
+	throttle       *throttle.Limiter
+	rateLimit      *throttle.RateLimiter  // Command rates per client
+	resp2Compat    atomic.Bool            // Encode replies as RESP2 even after HELLO 3
+	streams        *streams.StreamManager // Streams receiving archived keys and imported namespaces
+	pubsub         *pubsub.Broker
+	apiKeys        *apikeys.Registry // Keys connections must AUTH with, nil if not required
+	accessLog      *slog.Logger      // Logs every command, nil if disabled
+	scheduler      *wasm.Scheduler   // Runs scheduled WASM jobs, nil if WASM is disabled
+	scripts        *wasm.WASMRuntime // Runs EVAL scripts, nil if WASM is disabled
+
+	maxResponseSize int64  // Bytes an aggregate reply may encode to, 0 means unlimited
+	exportDir       string // Directory of EXPORT and IMPORT files, empty if disabled
 }
 
 // NewCommandDispatcher creates a new command dispatcher
-func NewCommandDispatcher(store *store.Store, metrics interface{}) *CommandDispatcher {
+func NewCommandDispatcher(store *store.Store, metrics *metrics.Metrics) *CommandDispatcher {
 	dispatcher := &CommandDispatcher{
-		store:    store,
-		commands: make(map[string]CommandHandler),
+		metrics:        metrics,
+		store:          store,
+		commands:       make(map[string]CommandHandler),
+		clientCommands: make(map[string]ClientHandler),
+		clients:        newClientRegistry(),
+		slowlog:        slowlog.New(slowlog.DefaultThreshold, slowlog.DefaultMaxLen),
+		latency:        latency.New(latency.DefaultThreshold),
+		stats:          info.New(Version),
+		throttle:       throttle.New(),
+		rateLimit:      throttle.NewRateLimiter(),
+		streams:        streams.NewStreamManager(),
+		pubsub:         pubsub.NewBroker(),
 	}
 
 	// Register core commands
@@ -34,17 +82,154 @@ func NewCommandDispatcher(store *store.Store, metrics interface{}) *CommandDispa
 // registerCommands registers all available commands
 func (d *CommandDispatcher) registerCommands() {
 	d.commands["PING"] = d.handlePing
+	d.commands["SLOWLOG"] = d.handleSlowLog
+	d.commands["LATENCY"] = d.handleLatency
+	d.commands["CONFIG"] = d.handleConfig
+	d.commands["DEBUG"] = d.handleDebug
+	d.clientCommands["HELLO"] = d.handleHello
+	d.clientCommands["CLIENT"] = d.handleClient
+	d.clientCommands["INFO"] = d.handleInfo
+	d.clientCommands["AUTH"] = d.handleAuth
+	d.commands["CAPABILITIES"] = d.handleCapabilities
 	d.commands["SET"] = d.handleSet
-	d.commands["GET"] = d.handleGet
+	d.clientCommands["GET"] = d.handleGet
+	d.clientCommands["SNAPSHOT"] = d.handleSnapshot
+	d.commands["GETSET"] = d.handleGetSet
+	d.commands["GETDEL"] = d.handleGetDel
+	d.commands["GETEX"] = d.handleGetEx
+	d.commands["GETMETA"] = d.handleGetMeta
+	d.commands["APPEND"] = d.handleAppend
+	d.commands["SETRANGE"] = d.handleSetRange
+	d.commands["TRANSFER"] = d.handleTransfer
+	d.commands["CAS"] = d.handleCAS
+	d.commands["LOCK"] = d.handleLock
+	d.commands["UNLOCK"] = d.handleUnlock
+	d.commands["GETRANGE"] = d.handleGetRange
+	d.commands["STRLEN"] = d.handleStrLen
 	d.commands["DEL"] = d.handleDel
+	d.commands["PURGE"] = d.handlePurge
 	d.commands["EXPIRE"] = d.handleExpire
 	d.commands["TTL"] = d.handleTTL
 	d.commands["GETAT"] = d.handleGetAt
+	d.commands["GETVERSION"] = d.handleGetVersion
 	d.commands["HIST"] = d.handleHist
+	d.commands["HISTRANGE"] = d.handleHistRange
+	d.commands["HISTSCAN"] = d.handleHistScan
+	d.commands["HISTDIFF"] = d.handleHistDiff
+	d.commands["VALIDATOR"] = d.handleValidator
+	d.commands["RETENTION"] = d.handleRetention
+	d.commands["ARCHIVE"] = d.handleArchive
+	d.commands["JOB"] = d.handleJob
+	d.clientCommands["EVAL"] = d.handleEval
+	d.clientCommands["EVALSHA"] = d.handleEvalSHA
+	d.commands["SCRIPT"] = d.handleScript
+
+	// Streams
+	d.commands["XADD"] = d.handleXAdd
+	d.commands["XTRIM"] = d.handleXTrim
+	d.commands["XRANGE"] = d.handleXRange
+	d.commands["XREVRANGE"] = d.handleXRevRange
+	d.commands["XGROUP"] = d.handleXGroup
+	d.clientCommands["XREAD"] = d.handleXRead
+	d.clientCommands["XREADGROUP"] = d.handleXReadGroup
+	d.commands["XACK"] = d.handleXAck
+	d.commands["XPENDING"] = d.handleXPending
+	d.commands["XCLAIM"] = d.handleXClaim
+	d.commands["XAUTOCLAIM"] = d.handleXAutoClaim
+
+	// Keyspace commands
+	d.commands["KEYS"] = d.handleKeys
+	d.commands["SCAN"] = d.handleScan
+	d.commands["STATS"] = d.handleStats
+	d.clientCommands["CHANGES"] = d.handleChanges
+	d.commands["EXISTS"] = d.handleExists
+	d.commands["TYPE"] = d.handleType
+	d.commands["RENAME"] = d.handleRename
+	d.commands["RENAMENX"] = d.handleRenameNX
+	d.commands["PERSIST"] = d.handlePersist
+	d.commands["OBJECT"] = d.handleObject
+	d.commands["MEMORY"] = d.handleMemory
+	d.commands["DUMP"] = d.handleDump
+	d.commands["RESTORE"] = d.handleRestore
+	d.commands["COPY"] = d.handleCopy
+
+	// Logical databases
+	d.clientCommands["SELECT"] = d.handleSelect
+	d.commands["FLUSHDB"] = d.handleFlushDB
+	d.commands["FLUSHALL"] = d.handleFlushAll
+
+	// Pub/sub
+	d.clientCommands["SUBSCRIBE"] = d.handleSubscribe
+	d.clientCommands["UNSUBSCRIBE"] = d.handleUnsubscribe
+	d.commands["PUBLISH"] = d.handlePublish
+
+	// Time-bucketed namespaces
+	d.commands["BUCKET"] = d.handleBucket
+
+	// Namespace migration
+	d.commands["NSEXPORT"] = d.handleNSExport
+	d.commands["NSIMPORT"] = d.handleNSImport
+	d.commands["MIGRATE"] = d.handleMigrate
+
+	// Keyspace export
+	d.commands["EXPORT"] = d.handleExport
+	d.commands["IMPORT"] = d.handleImport
+
+	// Full-text search
+	d.commands["FT.CREATE"] = d.handleFTCreate
+	d.commands["FT.SEARCH"] = d.handleFTSearch
+	d.commands["FT.DROPINDEX"] = d.handleFTDropIndex
+	d.commands["FT._LIST"] = d.handleFTList
+
+	// JSON documents
+	d.commands["JSON.SET"] = d.handleJSONSet
+	d.commands["JSON.GET"] = d.handleJSONGet
+	d.commands["JSON.DEL"] = d.handleJSONDel
+	d.commands["JSON.NUMINCRBY"] = d.handleJSONNumIncrBy
+
+	// Quantile sketches
+	d.commands["SKETCH.CREATE"] = d.handleSketchCreate
+	d.commands["SKETCH.ADD"] = d.handleSketchAdd
+	d.commands["SKETCH.MERGE"] = d.handleSketchMerge
+	d.commands["SKETCH.QUANTILE"] = d.handleSketchQuantile
+	d.commands["SKETCH.INFO"] = d.handleSketchInfo
+
+	// Set commands
+	d.commands["SADD"] = d.handleSAdd
+	d.commands["SREM"] = d.handleSRem
+	d.commands["SMEMBERS"] = d.handleSMembers
+	d.commands["SISMEMBER"] = d.handleSIsMember
+	d.commands["SCARD"] = d.handleSCard
+	d.commands["SINTER"] = d.handleSInter
+	d.commands["SUNION"] = d.handleSUnion
+	d.commands["SDIFF"] = d.handleSDiff
+
+	// Sorted set commands
+	d.commands["ZADD"] = d.handleZAdd
+	d.commands["ZREM"] = d.handleZRem
+	d.commands["ZSCORE"] = d.handleZScore
+	d.commands["ZRANK"] = d.handleZRank
+	d.commands["ZCARD"] = d.handleZCard
+	d.commands["ZRANGE"] = d.handleZRange
+	d.commands["ZRANGEBYSCORE"] = d.handleZRangeByScore
+}
+
+// AllowCommands restricts the dispatcher to the given command names.
+// An empty list exposes every registered command.
+func (d *CommandDispatcher) AllowCommands(names []string) {
+	if len(names) == 0 {
+		d.allowed = nil
+		return
+	}
+
+	d.allowed = make(map[string]bool, len(names))
+	for _, name := range names {
+		d.allowed[strings.ToUpper(name)] = true
+	}
 }
 
-// Dispatch processes a RESP command and returns a response
-func (d *CommandDispatcher) Dispatch(value proto.RESPValue) proto.RESPValue {
+// Dispatch processes a RESP command sent by client and returns a response
+func (d *CommandDispatcher) Dispatch(client *Client, value proto.RESPValue) proto.RESPValue {
 	cmd, args, err := value.ToCommand()
 	if err != nil {
 		return proto.RESPValue{
@@ -54,19 +239,134 @@ func (d *CommandDispatcher) Dispatch(value proto.RESPValue) proto.RESPValue {
 	}
 
 	handler, exists := d.commands[cmd]
-	if !exists {
+	clientHandler, isClientCommand := d.clientCommands[cmd]
+	if !exists && !isClientCommand {
+		// Unknown names share one label to bound metric cardinality
+		d.metrics.IncrementCommand("unknown", "error")
 		return proto.RESPValue{
 			Type:   proto.Error,
 			String: fmt.Sprintf("ERR unknown command '%s'", cmd),
 		}
 	}
 
-	return handler(args)
+	if d.allowed != nil && !d.allowed[cmd] {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("NOPERM command '%s' is not allowed on this listener", cmd),
+		}
+	}
+
+	if d.apiKeys != nil {
+		if response, ok := d.authorize(client, cmd, args); !ok {
+			return response
+		}
+	}
+
+	if !subscribedCommands[cmd] && client.subscribed() && d.replyProtocol(client) == proto.RESP2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("ERR Can't execute '%s': only SUBSCRIBE / UNSUBSCRIBE / PING are allowed in this context", strings.ToLower(cmd)),
+		}
+	}
+
+	client.touch(cmd)
+
+	if response, rejected := d.rejectWrite(cmd); rejected {
+		d.metrics.IncrementCommand(cmd, "readonly")
+		return response
+	}
+
+	if response, limited := d.rateLimited(client, cmd); limited {
+		d.metrics.IncrementCommand(cmd, "ratelimited")
+		return response
+	}
+
+	ns := d.throttledNamespace(cmd, args)
+	if ns != "" {
+		if response, ok := d.admit(ns, cmd, args); !ok {
+			d.metrics.IncrementCommand(cmd, "throttled")
+			return response
+		}
+	}
+
+	unlock := d.lockScripts(client, cmd)
+	start := time.Now()
+	var response proto.RESPValue
+	if isClientCommand {
+		response = clientHandler(client, args)
+	} else {
+		response = handler(d.database(client), args)
+	}
+	unlock()
+	if d.maxResponseSize > 0 && truncatableCommands[cmd] {
+		response = d.limitResponse(client, response)
+	}
+
+	status := "ok"
+	if response.Type == proto.Error {
+		status = "error"
+	}
+	// Time blocked waiting for data is not latency
+	elapsed := time.Since(start) - client.blocked
+	client.blocked = 0
+	d.metrics.IncrementCommand(cmd, status)
+	d.metrics.ObserveCommandDuration(cmd, elapsed.Seconds())
+	d.slowlog.Record(cmd, args, elapsed, client.Addr, client.Name())
+	d.latency.Record(cmd, elapsed)
+	d.stats.RecordCommand(cmd, elapsed, response.Type == proto.Error)
+	d.store.ObserveLatency(elapsed)
+	if d.accessLog != nil {
+		d.logAccess(client, cmd, elapsed, response)
+	}
+
+	if ns != "" {
+		d.chargeReply(ns, client, response)
+	}
+	if d.apiKeys != nil && client.apiKey != "" {
+		d.meter(client, cmd, args, response)
+	}
+
+	return response
+}
+
+// logAccess writes the access log record of a command
+func (d *CommandDispatcher) logAccess(client *Client, cmd string, elapsed time.Duration, response proto.RESPValue) {
+	attrs := []slog.Attr{
+		slog.String("client", client.Addr),
+		slog.String("command", cmd),
+		slog.Duration("latency", elapsed),
+	}
+	if name := client.Name(); name != "" {
+		attrs = append(attrs, slog.String("name", name))
+	}
+	if response.Type == proto.Error {
+		attrs = append(attrs, slog.String("result", "error"), slog.String("error", response.String))
+	} else {
+		attrs = append(attrs, slog.String("result", "ok"))
+	}
+	d.accessLog.LogAttrs(context.Background(), slog.LevelInfo, "command", attrs...)
+}
+
+// replyProtocol returns the protocol replies to client are encoded with
+func (d *CommandDispatcher) replyProtocol(client *Client) int {
+	if d.resp2Compat.Load() {
+		return proto.RESP2
+	}
+	return client.Protocol
+}
+
+// bulkStringArray builds a RESP array of bulk strings
+func bulkStringArray(items []string) proto.RESPValue {
+	result := make([]proto.RESPValue, len(items))
+	for i, item := range items {
+		result[i] = proto.RESPValue{Type: proto.BulkString, String: item}
+	}
+	return proto.RESPValue{Type: proto.Array, Array: result}
 }
 
 // Command handlers
 
-func (d *CommandDispatcher) handlePing(args []string) proto.RESPValue {
+func (d *CommandDispatcher) handlePing(db *store.Store, args []string) proto.RESPValue {
 	if len(args) == 0 {
 		return proto.RESPValue{Type: proto.SimpleString, String: "PONG"}
 	}
@@ -79,7 +379,7 @@ func (d *CommandDispatcher) handlePing(args []string) proto.RESPValue {
 	}
 }
 
-func (d *CommandDispatcher) handleSet(args []string) proto.RESPValue {
+func (d *CommandDispatcher) handleSet(db *store.Store, args []string) proto.RESPValue {
 	if len(args) < 2 {
 		return proto.RESPValue{
 			Type:   proto.Error,
@@ -89,39 +389,45 @@ func (d *CommandDispatcher) handleSet(args []string) proto.RESPValue {
 
 	key := args[0]
 	value := args[1]
-	var ttlMs int64
-
-	// Parse optional TTL arguments (PX milliseconds, EX seconds)
-	for i := 2; i < len(args); i += 2 {
-		if i+1 >= len(args) {
-			return proto.RESPValue{
-				Type:   proto.Error,
-				String: "ERR syntax error",
-			}
-		}
+	var opts store.SetOptions
+	hasTTL := false
 
+	// Parse options: EX seconds, PX milliseconds, NX, XX, GET and KEEPTTL
+	for i := 2; i < len(args); i++ {
 		option := strings.ToUpper(args[i])
-		ttlStr := args[i+1]
 
 		switch option {
-		case "PX":
-			ttl, err := strconv.ParseInt(ttlStr, 10, 64)
-			if err != nil || ttl <= 0 {
-				return proto.RESPValue{
-					Type:   proto.Error,
-					String: "ERR invalid expire time in 'set' command",
-				}
+		case "PX", "EX":
+			if i+1 >= len(args) || hasTTL || opts.KeepTTL {
+				return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
 			}
-			ttlMs = ttl
-		case "EX":
-			ttl, err := strconv.ParseInt(ttlStr, 10, 64)
+			i++
+			ttl, err := strconv.ParseInt(args[i], 10, 64)
 			if err != nil || ttl <= 0 {
 				return proto.RESPValue{
 					Type:   proto.Error,
 					String: "ERR invalid expire time in 'set' command",
 				}
 			}
-			ttlMs = ttl * 1000 // Convert seconds to milliseconds
+			if option == "EX" {
+				ttl *= 1000 // Convert seconds to milliseconds
+			}
+			opts.TTL, hasTTL = ttl, true
+		case "NX", "XX":
+			if opts.Cond != store.SetAlways {
+				return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+			}
+			opts.Cond = store.SetIfMissing
+			if option == "XX" {
+				opts.Cond = store.SetIfExists
+			}
+		case "GET":
+			opts.Get = true
+		case "KEEPTTL":
+			if hasTTL {
+				return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+			}
+			opts.KeepTTL = true
 		default:
 			return proto.RESPValue{
 				Type:   proto.Error,
@@ -130,12 +436,32 @@ func (d *CommandDispatcher) handleSet(args []string) proto.RESPValue {
 		}
 	}
 
-	d.store.Set(key, value, ttlMs)
+	result, err := db.SetWithOptions(key, value, opts)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+
+	// GET replies with the previous value whether or not the write happened
+	if opts.Get {
+		if !result.Existed {
+			return proto.RESPValue{Type: proto.BulkString, Null: true}
+		}
+		return proto.RESPValue{Type: proto.BulkString, String: result.Old}
+	}
+	if !result.Written {
+		return proto.RESPValue{Type: proto.BulkString, Null: true}
+	}
 	return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
 }
 
-func (d *CommandDispatcher) handleGet(args []string) proto.RESPValue {
-	if len(args) != 1 {
+// handleGet returns the value of a key:
+//
+//	GET key [AT token]
+//
+// With AT, or while the connection is in snapshot mode, the value is read
+// at a SNAPSHOT BEGIN token instead of now.
+func (d *CommandDispatcher) handleGet(c *Client, args []string) proto.RESPValue {
+	if len(args) != 1 && len(args) != 3 {
 		return proto.RESPValue{
 			Type:   proto.Error,
 			String: "ERR wrong number of arguments for 'get' command",
@@ -143,7 +469,30 @@ func (d *CommandDispatcher) handleGet(args []string) proto.RESPValue {
 	}
 
 	key := args[0]
-	value, exists := d.store.Get(key)
+	snapshot := c.snapshot
+	if len(args) == 3 {
+		if strings.ToUpper(args[1]) != "AT" {
+			return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+		}
+		token, err := parseSnapshotToken(args[2])
+		if err != nil {
+			return proto.RESPValue{Type: proto.Error, String: err.Error()}
+		}
+		snapshot = token
+	}
+
+	db := d.database(c)
+	var value string
+	var exists bool
+	var err error
+	if snapshot != 0 {
+		value, exists, err = db.GetSnapshot(key, snapshot)
+	} else {
+		value, exists, err = db.Get(key)
+	}
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
 	if !exists {
 		return proto.RESPValue{Type: proto.BulkString, Null: true}
 	}
@@ -151,7 +500,134 @@ func (d *CommandDispatcher) handleGet(args []string) proto.RESPValue {
 	return proto.RESPValue{Type: proto.BulkString, String: value}
 }
 
-func (d *CommandDispatcher) handleDel(args []string) proto.RESPValue {
+// handleGetSet sets a new value like SET and replies with the previous one
+func (d *CommandDispatcher) handleGetSet(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'getset' command",
+		}
+	}
+
+	result, err := db.SetWithOptions(args[0], args[1], store.SetOptions{Get: true})
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	if !result.Existed {
+		return proto.RESPValue{Type: proto.BulkString, Null: true}
+	}
+	return proto.RESPValue{Type: proto.BulkString, String: result.Old}
+}
+
+func (d *CommandDispatcher) handleGetDel(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 1 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'getdel' command",
+		}
+	}
+
+	value, found, err := db.GetDel(args[0])
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	if !found {
+		return proto.RESPValue{Type: proto.BulkString, Null: true}
+	}
+	return proto.RESPValue{Type: proto.BulkString, String: value}
+}
+
+// handleGetEx gets a value and changes its TTL:
+//
+//	GETEX key [EX seconds | PX milliseconds | EXAT unix-seconds | PXAT unix-milliseconds | PERSIST]
+func (d *CommandDispatcher) handleGetEx(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 1 || len(args) > 3 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'getex' command",
+		}
+	}
+
+	var expiresAt int64
+	persist := false
+	if len(args) > 1 {
+		option := strings.ToUpper(args[1])
+		if option == "PERSIST" {
+			if len(args) != 2 {
+				return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+			}
+			persist = true
+		} else {
+			if len(args) != 3 {
+				return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+			}
+			n, err := strconv.ParseInt(args[2], 10, 64)
+			if err != nil || n <= 0 {
+				return proto.RESPValue{
+					Type:   proto.Error,
+					String: "ERR invalid expire time in 'getex' command",
+				}
+			}
+			now := time.Now().UnixMilli()
+			switch option {
+			case "EX":
+				expiresAt = now + n*1000
+			case "PX":
+				expiresAt = now + n
+			case "EXAT":
+				expiresAt = n * 1000
+			case "PXAT":
+				expiresAt = n
+			default:
+				return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+			}
+		}
+	}
+
+	value, found, err := db.GetEx(args[0], expiresAt, persist)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	if !found {
+		return proto.RESPValue{Type: proto.BulkString, Null: true}
+	}
+	return proto.RESPValue{Type: proto.BulkString, String: value}
+}
+
+func (d *CommandDispatcher) handleGetMeta(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 1 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'getmeta' command",
+		}
+	}
+
+	meta, exists, err := db.GetMeta(args[0])
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	if !exists {
+		return proto.RESPValue{Type: proto.Array, Null: true}
+	}
+
+	return proto.RESPValue{
+		Type: proto.Map,
+		Array: []proto.RESPValue{
+			{Type: proto.BulkString, String: "value"},
+			{Type: proto.BulkString, String: meta.Value},
+			{Type: proto.BulkString, String: "timestamp"},
+			{Type: proto.Integer, Int: meta.Timestamp},
+			{Type: proto.BulkString, String: "hlc"},
+			{Type: proto.Integer, Int: int64(meta.HLC)},
+			{Type: proto.BulkString, String: "ttl"},
+			{Type: proto.Integer, Int: meta.TTL},
+			{Type: proto.BulkString, String: "versions"},
+			{Type: proto.Integer, Int: int64(meta.Versions)},
+		},
+	}
+}
+
+func (d *CommandDispatcher) handleDel(db *store.Store, args []string) proto.RESPValue {
 	if len(args) == 0 {
 		return proto.RESPValue{
 			Type:   proto.Error,
@@ -161,7 +637,7 @@ func (d *CommandDispatcher) handleDel(args []string) proto.RESPValue {
 
 	deleted := int64(0)
 	for _, key := range args {
-		if d.store.Delete(key) {
+		if db.Delete(key) {
 			deleted++
 		}
 	}
@@ -169,8 +645,36 @@ func (d *CommandDispatcher) handleDel(args []string) proto.RESPValue {
 	return proto.RESPValue{Type: proto.Integer, Int: deleted}
 }
 
-func (d *CommandDispatcher) handleExpire(args []string) proto.RESPValue {
-	if len(args) != 2 {
+// handlePurge erases keys with their whole history, which DEL keeps as a
+// recorded delete, and returns how many keys had a history to erase:
+//
+//	PURGE key [key ...]
+func (d *CommandDispatcher) handlePurge(db *store.Store, args []string) proto.RESPValue {
+	if len(args) == 0 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'purge' command",
+		}
+	}
+
+	purged := int64(0)
+	for _, key := range args {
+		if db.Purge(key) {
+			purged++
+		}
+	}
+
+	return proto.RESPValue{Type: proto.Integer, Int: purged}
+}
+
+// handleExpire sets the TTL of a key in seconds:
+//
+//	EXPIRE key seconds [SLIDING]
+//
+// SLIDING puts the key in sliding TTL mode, where every read extends the
+// expiration by the TTL again.
+func (d *CommandDispatcher) handleExpire(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 2 && len(args) != 3 {
 		return proto.RESPValue{
 			Type:   proto.Error,
 			String: "ERR wrong number of arguments for 'expire' command",
@@ -186,14 +690,25 @@ func (d *CommandDispatcher) handleExpire(args []string) proto.RESPValue {
 		}
 	}
 
-	if d.store.Expire(key, ttl*1000) { // Convert seconds to milliseconds
+	expire := db.Expire
+	if len(args) == 3 {
+		if strings.ToUpper(args[2]) != "SLIDING" {
+			return proto.RESPValue{
+				Type:   proto.Error,
+				String: "ERR syntax error",
+			}
+		}
+		expire = db.ExpireSliding
+	}
+
+	if expire(key, ttl*1000) { // Convert seconds to milliseconds
 		return proto.RESPValue{Type: proto.Integer, Int: 1}
 	}
 
 	return proto.RESPValue{Type: proto.Integer, Int: 0}
 }
 
-func (d *CommandDispatcher) handleTTL(args []string) proto.RESPValue {
+func (d *CommandDispatcher) handleTTL(db *store.Store, args []string) proto.RESPValue {
 	if len(args) != 1 {
 		return proto.RESPValue{
 			Type:   proto.Error,
@@ -202,13 +717,13 @@ func (d *CommandDispatcher) handleTTL(args []string) proto.RESPValue {
 	}
 
 	key := args[0]
-	ttlMs := d.store.TTL(key)
+	ttlMs := db.TTL(key)
 	ttlSeconds := ttlMs / 1000 // Convert milliseconds to seconds
 
 	return proto.RESPValue{Type: proto.Integer, Int: ttlSeconds}
 }
 
-func (d *CommandDispatcher) handleGetAt(args []string) proto.RESPValue {
+func (d *CommandDispatcher) handleGetAt(db *store.Store, args []string) proto.RESPValue {
 	if len(args) != 2 {
 		return proto.RESPValue{
 			Type:   proto.Error,
@@ -225,7 +740,39 @@ func (d *CommandDispatcher) handleGetAt(args []string) proto.RESPValue {
 		}
 	}
 
-	value, exists := d.store.GetAt(key, timestamp)
+	value, exists, err := db.GetAt(key, timestamp)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	if !exists {
+		return proto.RESPValue{Type: proto.BulkString, Null: true}
+	}
+
+	return proto.RESPValue{Type: proto.BulkString, String: value}
+}
+
+// handleGetVersion returns the value of one version of a key, by the
+// sequence number HIST lists it with: GETVERSION key seq
+func (d *CommandDispatcher) handleGetVersion(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'getversion' command",
+		}
+	}
+
+	seq, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || seq < 1 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR value is not a valid sequence number",
+		}
+	}
+
+	value, exists, err := db.GetVersion(args[0], seq)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
 	if !exists {
 		return proto.RESPValue{Type: proto.BulkString, Null: true}
 	}
@@ -233,8 +780,16 @@ func (d *CommandDispatcher) handleGetAt(args []string) proto.RESPValue {
 	return proto.RESPValue{Type: proto.BulkString, String: value}
 }
 
-func (d *CommandDispatcher) handleHist(args []string) proto.RESPValue {
-	if len(args) < 1 || len(args) > 2 {
+// handleHist lists the versions of a key, newest first:
+//
+//	HIST key [limit]
+//	HIST key [LIMIT n] [WITHTTL]
+//
+// The reply is an array holding one [timestamp, value, seq] entry per
+// version, seq numbering the versions of the key from 1 in write order;
+// WITHTTL adds the remaining TTL in milliseconds, -1 for none.
+func (d *CommandDispatcher) handleHist(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 1 {
 		return proto.RESPValue{
 			Type:   proto.Error,
 			String: "ERR wrong number of arguments for 'hist' command",
@@ -243,10 +798,62 @@ func (d *CommandDispatcher) handleHist(args []string) proto.RESPValue {
 
 	key := args[0]
 	limit := 0
+	withTTL := false
+
+	for i := 1; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "LIMIT":
+			if i+1 == len(args) {
+				return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+			}
+			i++
+		case "WITHTTL":
+			withTTL = true
+			continue
+		default:
+			// The limit of the first form
+			if i != 1 || len(args) != 2 {
+				return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+			}
+		}
 
-	if len(args) == 2 {
 		var err error
-		limit, err = strconv.Atoi(args[1])
+		limit, err = strconv.Atoi(args[i])
+		if err != nil || limit < 0 {
+			return proto.RESPValue{
+				Type:   proto.Error,
+				String: "ERR value is not a valid limit",
+			}
+		}
+	}
+
+	versions := db.History(key, limit)
+	if err := store.CheckReadable(versions); err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	return historyReply(versions, withTTL)
+}
+
+func (d *CommandDispatcher) handleHistRange(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 3 || len(args) > 4 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'histrange' command",
+		}
+	}
+
+	start, err := parseRangeBound(args[1])
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: "ERR invalid start timestamp"}
+	}
+	end, err := parseRangeBound(args[2])
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: "ERR invalid end timestamp"}
+	}
+
+	limit := 0
+	if len(args) == 4 {
+		limit, err = strconv.Atoi(args[3])
 		if err != nil || limit < 0 {
 			return proto.RESPValue{
 				Type:   proto.Error,
@@ -255,18 +862,182 @@ func (d *CommandDispatcher) handleHist(args []string) proto.RESPValue {
 		}
 	}
 
-	history := d.store.History(key, limit)
+	versions := db.HistoryRange(args[0], start, end, limit)
+	if err := store.CheckReadable(versions); err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	return historyReply(versions, false)
+}
+
+// handleHistScan pages through the history of a key, newest first:
+//
+//	HISTSCAN key cursor [COUNT n]
+//
+// Like SCAN it replies with the next cursor, 0 once done, and the versions
+// of the page in the HIST format. Cursors are version HLCs, so pages stay
+// consistent while the key is written to or trimmed.
+func (d *CommandDispatcher) handleHistScan(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 2 && len(args) != 4 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'histscan' command",
+		}
+	}
+
+	cursor, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: "ERR invalid cursor"}
+	}
+
+	count := 10
+	if len(args) == 4 {
+		if strings.ToUpper(args[2]) != "COUNT" {
+			return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+		}
+		count, err = strconv.Atoi(args[3])
+		if err != nil || count < 1 {
+			return proto.RESPValue{
+				Type:   proto.Error,
+				String: "ERR value is not an integer or out of range",
+			}
+		}
+	}
+
+	versions, next := db.HistoryScan(args[0], math.MinInt64, math.MaxInt64, store.HLC(cursor), count)
+	if err := store.CheckReadable(versions); err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+
+	// Past the response size limit the page ends early, resuming after the
+	// last version it holds
+	page := historyReply(versions, false)
+	for len(versions) > 1 && !d.fits(page) {
+		versions = versions[:len(versions)/2]
+		next = versions[len(versions)-1].HLC
+		page = historyReply(versions, false)
+	}
+
+	return proto.RESPValue{
+		Type: proto.Array,
+		Array: []proto.RESPValue{
+			{Type: proto.BulkString, String: strconv.FormatUint(uint64(next), 10)},
+			page,
+		},
+	}
+}
+
+func (d *CommandDispatcher) handleHistDiff(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 3 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'histdiff' command",
+		}
+	}
+
+	t1, err := parseRangeBound(args[1])
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: "ERR value is not an integer or out of range"}
+	}
+	t2, err := parseRangeBound(args[2])
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: "ERR value is not an integer or out of range"}
+	}
+
+	diff, err := db.Diff(args[0], t1, t2)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+
+	// Changes are only computed when both values are JSON documents
+	changes := proto.RESPValue{Type: proto.Array, Null: true}
+	if diff.JSON {
+		changes = proto.RESPValue{Type: proto.Array, Array: make([]proto.RESPValue, len(diff.Changes))}
+		for i, change := range diff.Changes {
+			changes.Array[i] = proto.RESPValue{
+				Type: proto.Map,
+				Array: []proto.RESPValue{
+					{Type: proto.BulkString, String: "path"},
+					{Type: proto.BulkString, String: change.Path},
+					{Type: proto.BulkString, String: "op"},
+					{Type: proto.BulkString, String: change.Op},
+					{Type: proto.BulkString, String: "old"},
+					optionalBulkString(change.Old, change.Op != store.ChangeAdded),
+					{Type: proto.BulkString, String: "new"},
+					optionalBulkString(change.New, change.Op != store.ChangeRemoved),
+				},
+			}
+		}
+	}
+
+	return proto.RESPValue{
+		Type: proto.Map,
+		Array: []proto.RESPValue{
+			{Type: proto.BulkString, String: "before"},
+			optionalBulkString(diff.Before, diff.BeforeFound),
+			{Type: proto.BulkString, String: "after"},
+			optionalBulkString(diff.After, diff.AfterFound),
+			{Type: proto.BulkString, String: "changes"},
+			changes,
+		},
+	}
+}
+
+// optionalBulkString returns s as a bulk string, or a null bulk string if
+// it is not present
+func optionalBulkString(s string, present bool) proto.RESPValue {
+	if !present {
+		return proto.RESPValue{Type: proto.BulkString, Null: true}
+	}
+	return proto.RESPValue{Type: proto.BulkString, String: s}
+}
 
-	// Build response array
-	result := make([]proto.RESPValue, len(history)*2)
+// parseRangeBound parses a Unix millisecond timestamp, where "-" and "+"
+// stand for the oldest and newest possible versions
+func parseRangeBound(arg string) (int64, error) {
+	switch arg {
+	case "-":
+		return math.MinInt64, nil
+	case "+":
+		return math.MaxInt64, nil
+	}
+	return strconv.ParseInt(arg, 10, 64)
+}
+
+// historyReply replies with an array of versions, each an array of its
+// timestamp, value and sequence number, plus its remaining TTL (ms, -1 for
+// none) with withTTL. Versions written in the same millisecond share a
+// timestamp, so RESP3 clients also get the HLC that orders them, and the
+// remaining TTL, as attributes of each entry; the HLC lets a truncated
+// reply be resumed with HISTSCAN.
+func historyReply(history []store.Value, withTTL bool) proto.RESPValue {
+	now := time.Now().UnixMilli()
+
+	result := make([]proto.RESPValue, len(history))
 	for i, version := range history {
-		result[i*2] = proto.RESPValue{
-			Type: proto.Integer,
-			Int:  version.Timestamp,
+		ttl := int64(-1)
+		if version.TTL > 0 {
+			ttl = max(version.TTL-now, 0)
 		}
-		result[i*2+1] = proto.RESPValue{
-			Type:   proto.BulkString,
-			String: version.Data,
+
+		entry := []proto.RESPValue{
+			{Type: proto.Integer, Int: version.Timestamp},
+			// A recorded delete has no value
+			{Type: proto.BulkString, String: version.Data, Null: version.Deleted},
+			{Type: proto.Integer, Int: version.Seq},
+		}
+		if withTTL {
+			entry = append(entry, proto.RESPValue{Type: proto.Integer, Int: ttl})
+		}
+
+		result[i] = proto.RESPValue{
+			Type:  proto.Array,
+			Array: entry,
+			Attributes: []proto.RESPValue{
+				{Type: proto.BulkString, String: "ttl"},
+				{Type: proto.Integer, Int: ttl},
+				{Type: proto.BulkString, String: "hlc"},
+				{Type: proto.Integer, Int: int64(version.HLC)},
+			},
 		}
 	}
 
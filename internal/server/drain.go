@@ -0,0 +1,62 @@
+package server
+
+import (
+	"log/slog"
+	"time"
+
+	"pulsedb/internal/proto"
+)
+
+// DefaultDrainTimeout is how long a stopping server waits for its
+// connections to finish their commands before closing them
+const DefaultDrainTimeout = 30 * time.Second
+
+// SetDrainTimeout sets how long the server waits on shutdown for
+// connections to finish the commands they already sent; connections still
+// open after it are closed
+func (s *Server) SetDrainTimeout(timeout time.Duration) {
+	s.drainTimeout = timeout
+}
+
+// SetShutdownNotice makes the server send each connection a "-SHUTDOWN"
+// error before closing it on shutdown, so clients can tell a drain from a
+// network failure and reconnect elsewhere
+func (s *Server) SetShutdownNotice(enabled bool) {
+	s.shutdownNotice = enabled
+}
+
+// drain stops the connections of a server that no longer accepts new ones.
+// Each connection finishes the commands it has already received, then
+// closes; blocked reads and blocking commands are interrupted right away. Connections still open
+// after the drain timeout are closed, without waiting any longer for
+// commands still running.
+func (s *Server) drain() {
+	s.draining.Store(true)
+
+	clients := s.dispatcher.clients.list()
+	for _, c := range clients {
+		if c.conn != nil {
+			c.conn.SetReadDeadline(time.Now())
+		}
+		c.unblock()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.conns.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(s.drainTimeout):
+		remaining := s.dispatcher.clients.list()
+		slog.Warn("Drain timeout exceeded, closing connections", "connections", len(remaining))
+		for _, c := range remaining {
+			c.kill(nil)
+		}
+	}
+}
+
+// shutdownReply is sent to connections closed by a drain
+var shutdownReply = proto.RESPValue{Type: proto.Error, String: "SHUTDOWN server is shutting down"}
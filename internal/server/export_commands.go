@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/store"
+)
+
+// Keyspace export to files. EXPORT and IMPORT only read and write files in
+// the directory set with --export-dir, so clients cannot reach arbitrary
+// paths; without one both are disabled. The format defaults to CSV for
+// names ending in .csv and JSON Lines otherwise.
+
+// SetExportDir sets the directory EXPORT writes to and IMPORT reads from.
+// An empty dir disables both.
+func (s *Server) SetExportDir(dir string) {
+	s.dispatcher.exportDir = dir
+}
+
+// handleExport writes the keyspace to a file of the export directory:
+//
+//	EXPORT file [FORMAT jsonl|csv] [MATCH pattern] [HISTORY]
+//
+// HISTORY writes every retained version rather than only the current one.
+// The file is replaced once the export is complete.
+func (d *CommandDispatcher) handleExport(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 1 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'export' command",
+		}
+	}
+
+	path, err := d.exportPath(args[0])
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	opts := store.ExportOptions{Format: exportFormat(args[0])}
+	for i := 1; i < len(args); i++ {
+		option := strings.ToUpper(args[i])
+		if option == "HISTORY" {
+			opts.History = true
+			continue
+		}
+		if i+1 >= len(args) {
+			return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+		}
+		switch option {
+		case "FORMAT":
+			if opts.Format, err = store.ParseExportFormat(args[i+1]); err != nil {
+				return proto.RESPValue{Type: proto.Error, String: err.Error()}
+			}
+		case "MATCH":
+			opts.Pattern = args[i+1]
+		default:
+			return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+		}
+		i++
+	}
+
+	// Written to a temporary file first, so a failed export leaves any
+	// earlier one in place
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: "ERR " + err.Error()}
+	}
+	defer os.Remove(file.Name())
+
+	exported, err := db.Export(context.Background(), file, opts, func(done, total int) {})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: "ERR export failed: " + err.Error()}
+	}
+	return proto.RESPValue{Type: proto.Integer, Int: int64(exported)}
+}
+
+// handleImport recreates the keys of a file of the export directory:
+//
+//	IMPORT file [FORMAT jsonl|csv] [REPLACE]
+//
+// Keys that already exist are kept unless REPLACE is given. An import that
+// fails part way keeps the keys read before the error.
+func (d *CommandDispatcher) handleImport(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 1 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'import' command",
+		}
+	}
+
+	path, err := d.exportPath(args[0])
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	format, replace := exportFormat(args[0]), false
+	for i := 1; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); {
+		case option == "REPLACE":
+			replace = true
+		case option == "FORMAT" && i+1 < len(args):
+			if format, err = store.ParseExportFormat(args[i+1]); err != nil {
+				return proto.RESPValue{Type: proto.Error, String: err.Error()}
+			}
+			i++
+		default:
+			return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: fmt.Sprintf("ERR cannot open '%s'", args[0])}
+	}
+	defer file.Close()
+
+	result, err := db.Import(context.Background(), file, format, replace, func(done, total int) {})
+	if err != nil {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("ERR import stopped after %d keys: %s", result.Imported+result.Skipped, strings.TrimPrefix(err.Error(), "ERR ")),
+		}
+	}
+	return proto.RESPValue{
+		Type: proto.Map,
+		Array: []proto.RESPValue{
+			{Type: proto.BulkString, String: "keys"},
+			{Type: proto.Integer, Int: int64(result.Imported)},
+			{Type: proto.BulkString, String: "skipped"},
+			{Type: proto.Integer, Int: int64(result.Skipped)},
+		},
+	}
+}
+
+// exportPath returns the path of a file in the export directory, rejecting
+// names with a directory part
+func (d *CommandDispatcher) exportPath(name string) (string, error) {
+	if d.exportDir == "" {
+		return "", fmt.Errorf("ERR EXPORT and IMPORT are disabled, start the server with --export-dir")
+	}
+	if name == "" || name == "." || name == ".." || filepath.Base(name) != name {
+		return "", fmt.Errorf("ERR invalid file name '%s', it must not contain a directory", name)
+	}
+	return filepath.Join(d.exportDir, name), nil
+}
+
+// exportFormat is the default format of a file: CSV for .csv names
+func exportFormat(name string) store.ExportFormat {
+	if strings.EqualFold(filepath.Ext(name), ".csv") {
+		return store.FormatCSV
+	}
+	return store.FormatJSONL
+}
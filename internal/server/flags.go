@@ -0,0 +1,175 @@
+package server
+
+import (
+	"fmt"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/throttle"
+)
+
+// commandFlag tags a registered command with what it may do
+type commandFlag uint8
+
+const (
+	flagReadOnly commandFlag = 1 << iota // Only reads keys or connection and server state
+	flagWrite                            // Changes keys, or publishes messages
+	flagAdmin                            // Manages the server
+)
+
+// commandFlags gives the flags of every registered command. Dispatch uses
+// them to refuse write commands in read-only mode and to pick the rate
+// limit class of a command.
+var commandFlags = map[string]commandFlag{
+	// Connection and server
+	"PING":         flagReadOnly,
+	"HELLO":        flagReadOnly,
+	"AUTH":         flagReadOnly,
+	"SELECT":       flagReadOnly,
+	"INFO":         flagReadOnly,
+	"CAPABILITIES": flagReadOnly,
+	"SNAPSHOT":     flagReadOnly,
+	"CLIENT":       flagAdmin,
+	"CONFIG":       flagAdmin,
+	"DEBUG":        flagAdmin,
+	"SLOWLOG":      flagAdmin,
+	"LATENCY":      flagAdmin,
+
+	// Strings
+	"GET":      flagReadOnly,
+	"GETRANGE": flagReadOnly,
+	"STRLEN":   flagReadOnly,
+	"GETMETA":  flagReadOnly,
+	"SET":      flagWrite,
+	"GETSET":   flagWrite,
+	"GETDEL":   flagWrite,
+	"GETEX":    flagWrite,
+	"APPEND":   flagWrite,
+	"SETRANGE": flagWrite,
+	"TRANSFER": flagWrite,
+	"CAS":      flagWrite,
+	"LOCK":     flagWrite,
+	"UNLOCK":   flagWrite,
+
+	// Keys and history
+	"DEL":        flagWrite,
+	"PURGE":      flagWrite,
+	"EXPIRE":     flagWrite,
+	"PERSIST":    flagWrite,
+	"RENAME":     flagWrite,
+	"RENAMENX":   flagWrite,
+	"RESTORE":    flagWrite,
+	"COPY":       flagWrite,
+	"TTL":        flagReadOnly,
+	"GETAT":      flagReadOnly,
+	"GETVERSION": flagReadOnly,
+	"HIST":       flagReadOnly,
+	"HISTRANGE":  flagReadOnly,
+	"HISTSCAN":   flagReadOnly,
+	"HISTDIFF":   flagReadOnly,
+	"KEYS":       flagReadOnly,
+	"SCAN":       flagReadOnly,
+	"CHANGES":    flagReadOnly,
+	"STATS":      flagReadOnly,
+	"EXISTS":     flagReadOnly,
+	"TYPE":       flagReadOnly,
+	"OBJECT":     flagReadOnly,
+	"MEMORY":     flagReadOnly,
+	"DUMP":       flagReadOnly,
+	"VALIDATOR":  flagAdmin,
+	"RETENTION":  flagAdmin,
+	"ARCHIVE":    flagAdmin,
+	"JOB":        flagAdmin,
+	"EVAL":       flagWrite,
+	"EVALSHA":    flagWrite,
+	"SCRIPT":     flagAdmin,
+
+	// Streams
+	"XADD":       flagWrite,
+	"XTRIM":      flagWrite,
+	"XRANGE":     flagReadOnly,
+	"XREVRANGE":  flagReadOnly,
+	"XREAD":      flagReadOnly,
+	"XGROUP":     flagWrite,
+	"XREADGROUP": flagWrite,
+	"XACK":       flagWrite,
+	"XCLAIM":     flagWrite,
+	"XAUTOCLAIM": flagWrite,
+	"XPENDING":   flagReadOnly,
+
+	// Keyspace management
+	"FLUSHDB":  flagAdmin | flagWrite,
+	"FLUSHALL": flagAdmin | flagWrite,
+	"NSEXPORT": flagAdmin,
+	"NSIMPORT": flagAdmin | flagWrite,
+	"MIGRATE":  flagAdmin | flagWrite,
+	"EXPORT":   flagAdmin,
+	"IMPORT":   flagAdmin | flagWrite,
+	"BUCKET":   flagWrite,
+
+	// Pub/sub
+	"SUBSCRIBE":   flagReadOnly,
+	"UNSUBSCRIBE": flagReadOnly,
+	"PUBLISH":     flagWrite,
+
+	// Full-text search
+	"FT.CREATE":    flagAdmin,
+	"FT.DROPINDEX": flagAdmin,
+	"FT.SEARCH":    flagReadOnly,
+	"FT._LIST":     flagReadOnly,
+
+	// JSON documents
+	"JSON.SET":       flagWrite,
+	"JSON.DEL":       flagWrite,
+	"JSON.NUMINCRBY": flagWrite,
+	"JSON.GET":       flagReadOnly,
+
+	// Quantile sketches
+	"SKETCH.CREATE":   flagWrite,
+	"SKETCH.ADD":      flagWrite,
+	"SKETCH.MERGE":    flagWrite,
+	"SKETCH.QUANTILE": flagReadOnly,
+	"SKETCH.INFO":     flagReadOnly,
+
+	// Sets and sorted sets
+	"SADD":          flagWrite,
+	"SREM":          flagWrite,
+	"SMEMBERS":      flagReadOnly,
+	"SISMEMBER":     flagReadOnly,
+	"SCARD":         flagReadOnly,
+	"SINTER":        flagReadOnly,
+	"SUNION":        flagReadOnly,
+	"SDIFF":         flagReadOnly,
+	"ZADD":          flagWrite,
+	"ZREM":          flagWrite,
+	"ZSCORE":        flagReadOnly,
+	"ZRANK":         flagReadOnly,
+	"ZCARD":         flagReadOnly,
+	"ZRANGE":        flagReadOnly,
+	"ZRANGEBYSCORE": flagReadOnly,
+}
+
+// commandClass returns the rate limit class of cmd: admin commands first,
+// then write commands, and reads for the rest
+func commandClass(cmd string) throttle.Class {
+	flags := commandFlags[cmd]
+	switch {
+	case flags&flagAdmin != 0:
+		return throttle.Admin
+	case flags&flagWrite != 0:
+		return throttle.Write
+	default:
+		return throttle.Read
+	}
+}
+
+// rejectWrite returns a READONLY error if cmd writes while the server is
+// in read-only mode
+func (d *CommandDispatcher) rejectWrite(cmd string) (proto.RESPValue, bool) {
+	if commandFlags[cmd]&flagWrite == 0 || !d.store.ReadOnly() {
+		return proto.RESPValue{}, false
+	}
+	return proto.RESPValue{
+		Type:   proto.Error,
+		String: fmt.Sprintf("READONLY '%s' is a write command and the server is in read-only mode", cmd),
+	}, true
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	"pulsedb/internal/proto"
+)
+
+// Version is the server version reported by HELLO
+const Version = "1.0.0"
+
+// handleHello implements HELLO [protover [AUTH username password] [SETNAME name]].
+// It switches the connection to the requested protocol and replies with a
+// map describing the server, encoded in the newly negotiated protocol.
+func (d *CommandDispatcher) handleHello(c *Client, args []string) proto.RESPValue {
+	protocol := c.Protocol
+
+	if len(args) > 0 {
+		version, err := strconv.Atoi(args[0])
+		if err != nil {
+			return proto.RESPValue{
+				Type:   proto.Error,
+				String: "ERR Protocol version is not an integer or out of range",
+			}
+		}
+		if version != proto.RESP2 && version != proto.RESP3 {
+			return proto.RESPValue{
+				Type:   proto.Error,
+				String: "NOPROTO unsupported protocol version",
+			}
+		}
+		protocol = version
+	}
+
+	name := c.Name()
+	for i := 1; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "AUTH":
+			// The password is an API key; without API keys credentials are
+			// accepted and ignored
+			if i+2 >= len(args) {
+				return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+			}
+			if d.apiKeys != nil {
+				if err := d.authenticate(c, args[i+2]); err != nil {
+					return proto.RESPValue{Type: proto.Error, String: err.Error()}
+				}
+			}
+			i += 2
+		case "SETNAME":
+			if i+1 >= len(args) {
+				return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+			}
+			name = args[i+1]
+			i++
+		default:
+			return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+		}
+	}
+
+	c.mu.Lock()
+	c.Protocol = protocol
+	c.name = name
+	c.mu.Unlock()
+
+	return proto.RESPValue{
+		Type: proto.Map,
+		Array: []proto.RESPValue{
+			{Type: proto.BulkString, String: "server"},
+			{Type: proto.BulkString, String: "pulsedb"},
+			{Type: proto.BulkString, String: "version"},
+			{Type: proto.BulkString, String: Version},
+			{Type: proto.BulkString, String: "proto"},
+			{Type: proto.Integer, Int: int64(protocol)},
+			{Type: proto.BulkString, String: "id"},
+			{Type: proto.Integer, Int: c.ID},
+			{Type: proto.BulkString, String: "mode"},
+			{Type: proto.BulkString, String: "standalone"},
+			{Type: proto.BulkString, String: "role"},
+			{Type: proto.BulkString, String: "master"},
+			{Type: proto.BulkString, String: "modules"},
+			{Type: proto.Array, Array: []proto.RESPValue{}},
+		},
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+
+	"pulsedb/internal/info"
+	"pulsedb/internal/proto"
+	"pulsedb/internal/store"
+)
+
+// handleInfo reports server statistics:
+//
+//	INFO [section ...]
+//
+// RESP2 connections get the Redis INFO text format. RESP3 connections get a
+// map of section name to a map of field to value, with integer fields as
+// integers.
+func (d *CommandDispatcher) handleInfo(c *Client, args []string) proto.RESPValue {
+	report := d.stats.Collect(d.store)
+	sections := info.SelectSections(args)
+
+	if d.replyProtocol(c) < proto.RESP3 {
+		return proto.RESPValue{Type: proto.BulkString, String: report.Format(sections)}
+	}
+
+	result := make([]proto.RESPValue, 0, len(sections)*2)
+	for _, section := range sections {
+		fields := report.Fields(section)
+		entries := make([]proto.RESPValue, 0, len(fields)*2)
+		for _, f := range fields {
+			entries = append(entries, proto.RESPValue{Type: proto.BulkString, String: f.Name}, infoValue(f.Value))
+		}
+		result = append(result,
+			proto.RESPValue{Type: proto.BulkString, String: section},
+			proto.RESPValue{Type: proto.Map, Array: entries},
+		)
+	}
+	return proto.RESPValue{Type: proto.Map, Array: result}
+}
+
+// handleCapabilities lists the subsystems of the server, whether they are
+// enabled, and their versions and limits:
+//
+//	CAPABILITIES
+//
+// The reply is a map of "version" and "subsystems", itself a map of
+// subsystem name to a map of "enabled", "version" and "limits".
+func (d *CommandDispatcher) handleCapabilities(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 0 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'capabilities' command",
+		}
+	}
+
+	capabilities := d.stats.Capabilities()
+	subsystems := make([]proto.RESPValue, 0, len(capabilities.Subsystems)*2)
+	for _, c := range capabilities.Subsystems {
+		names := make([]string, 0, len(c.Limits))
+		for name := range c.Limits {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		limits := make([]proto.RESPValue, 0, len(names)*2)
+		for _, name := range names {
+			limits = append(limits,
+				proto.RESPValue{Type: proto.BulkString, String: name},
+				proto.RESPValue{Type: proto.Integer, Int: c.Limits[name]},
+			)
+		}
+		subsystems = append(subsystems,
+			proto.RESPValue{Type: proto.BulkString, String: c.Name},
+			proto.RESPValue{Type: proto.Map, Array: []proto.RESPValue{
+				{Type: proto.BulkString, String: "enabled"},
+				{Type: proto.Boolean, Bool: c.Enabled},
+				{Type: proto.BulkString, String: "version"},
+				{Type: proto.BulkString, String: c.Version},
+				{Type: proto.BulkString, String: "limits"},
+				{Type: proto.Map, Array: limits},
+			}},
+		)
+	}
+
+	return proto.RESPValue{
+		Type: proto.Map,
+		Array: []proto.RESPValue{
+			{Type: proto.BulkString, String: "version"},
+			{Type: proto.BulkString, String: capabilities.Version},
+			{Type: proto.BulkString, String: "subsystems"},
+			{Type: proto.Map, Array: subsystems},
+		},
+	}
+}
+
+// infoValue converts an INFO field value to its native RESP type
+func infoValue(value interface{}) proto.RESPValue {
+	switch v := value.(type) {
+	case int:
+		return proto.RESPValue{Type: proto.Integer, Int: int64(v)}
+	case int64:
+		return proto.RESPValue{Type: proto.Integer, Int: v}
+	case uint32:
+		return proto.RESPValue{Type: proto.Integer, Int: int64(v)}
+	case uint64:
+		return proto.RESPValue{Type: proto.Integer, Int: int64(v)}
+	default:
+		return proto.RESPValue{Type: proto.BulkString, String: fmt.Sprint(v)}
+	}
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/store"
+	"pulsedb/internal/wasm"
+)
+
+// SetScheduler sets the scheduler running the jobs of JOB, enabling the
+// command. Several listeners can share a scheduler.
+func (s *Server) SetScheduler(scheduler *wasm.Scheduler) {
+	s.dispatcher.scheduler = scheduler
+}
+
+// handleJob manages jobs calling the run method of a WASM function on a
+// schedule:
+//
+//	JOB CREATE name schedule function
+//	JOB DELETE name
+//	JOB LIST
+//
+// The schedule is a five-field cron expression, e.g. "*/5 * * * *", or
+// "@every <duration>".
+func (d *CommandDispatcher) handleJob(db *store.Store, args []string) proto.RESPValue {
+	if len(args) == 0 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'job' command",
+		}
+	}
+	if d.scheduler == nil {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR WASM functions are disabled, start the server with --wasm-dir",
+		}
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "CREATE":
+		if len(args) != 4 {
+			break
+		}
+		if err := d.scheduler.Create(args[1], args[2], args[3]); err != nil {
+			return proto.RESPValue{Type: proto.Error, String: "ERR " + err.Error()}
+		}
+		return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
+
+	case "DELETE":
+		if len(args) != 2 {
+			break
+		}
+		if d.scheduler.Delete(args[1]) {
+			return proto.RESPValue{Type: proto.Integer, Int: 1}
+		}
+		return proto.RESPValue{Type: proto.Integer, Int: 0}
+
+	case "LIST":
+		if len(args) != 1 {
+			break
+		}
+		jobs := d.scheduler.List()
+		result := make([]proto.RESPValue, len(jobs))
+		for i, job := range jobs {
+			result[i] = proto.RESPValue{
+				Type: proto.Map,
+				Array: []proto.RESPValue{
+					{Type: proto.BulkString, String: "name"},
+					{Type: proto.BulkString, String: job.Name},
+					{Type: proto.BulkString, String: "schedule"},
+					{Type: proto.BulkString, String: job.Spec},
+					{Type: proto.BulkString, String: "function"},
+					{Type: proto.BulkString, String: job.Function},
+					{Type: proto.BulkString, String: "status"},
+					{Type: proto.BulkString, String: jobStatus(job)},
+					{Type: proto.BulkString, String: "runs"},
+					{Type: proto.Integer, Int: job.Runs},
+					{Type: proto.BulkString, String: "failures"},
+					{Type: proto.Integer, Int: job.Failures},
+					{Type: proto.BulkString, String: "next_run"},
+					{Type: proto.Integer, Int: unixMilli(job.Next)},
+					{Type: proto.BulkString, String: "last_run"},
+					{Type: proto.Integer, Int: unixMilli(job.LastRun)},
+					{Type: proto.BulkString, String: "last_duration_us"},
+					{Type: proto.Integer, Int: job.LastDuration.Microseconds()},
+					{Type: proto.BulkString, String: "last_result"},
+					{Type: proto.BulkString, String: jobResult(job.LastResult)},
+					{Type: proto.BulkString, String: "last_error"},
+					{Type: proto.BulkString, String: job.LastError},
+				},
+			}
+		}
+		return proto.RESPValue{Type: proto.Array, Array: result}
+
+	default:
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("ERR unknown subcommand '%s'", args[0]),
+		}
+	}
+
+	return proto.RESPValue{
+		Type:   proto.Error,
+		String: fmt.Sprintf("ERR wrong number of arguments for 'job %s' command", strings.ToLower(args[0])),
+	}
+}
+
+// jobStatus summarizes a job: "scheduled" before its first run, then "ok"
+// or "failed" after the outcome of its last run, and "done" once its
+// schedule has no next run
+func jobStatus(job wasm.JobInfo) string {
+	switch {
+	case job.Next.IsZero():
+		return "done"
+	case job.LastRun.IsZero():
+		return "scheduled"
+	case job.LastError != "":
+		return "failed"
+	default:
+		return "ok"
+	}
+}
+
+// jobResult formats the values returned by a job's run, space-separated
+func jobResult(results []uint64) string {
+	values := make([]string, len(results))
+	for i, v := range results {
+		values[i] = strconv.FormatUint(v, 10)
+	}
+	return strings.Join(values, " ")
+}
+
+// unixMilli returns t in Unix milliseconds, 0 for the zero time
+func unixMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"strings"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/store"
+)
+
+// JSON document commands. Paths use the JSONPath subset of the jsonpath
+// package and default to the root ($) where optional.
+
+func (d *CommandDispatcher) handleJSONSet(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 3 || len(args) > 4 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'json.set' command",
+		}
+	}
+
+	cond := store.JSONAlways
+	if len(args) == 4 {
+		switch strings.ToUpper(args[3]) {
+		case "NX":
+			cond = store.JSONIfMissing
+		case "XX":
+			cond = store.JSONIfExisting
+		default:
+			return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+		}
+	}
+
+	written, err := db.JSONSet(args[0], args[1], args[2], cond)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	if !written {
+		return proto.RESPValue{Type: proto.BulkString, Null: true}
+	}
+	return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
+}
+
+func (d *CommandDispatcher) handleJSONGet(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 1 || len(args) > 2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'json.get' command",
+		}
+	}
+
+	value, exists, err := db.JSONGet(args[0], jsonPathArg(args, 1))
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	if !exists {
+		return proto.RESPValue{Type: proto.BulkString, Null: true}
+	}
+	return proto.RESPValue{Type: proto.BulkString, String: value}
+}
+
+func (d *CommandDispatcher) handleJSONDel(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 1 || len(args) > 2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'json.del' command",
+		}
+	}
+
+	deleted, err := db.JSONDel(args[0], jsonPathArg(args, 1))
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	return proto.RESPValue{Type: proto.Integer, Int: int64(deleted)}
+}
+
+func (d *CommandDispatcher) handleJSONNumIncrBy(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 3 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'json.numincrby' command",
+		}
+	}
+
+	result, err := db.JSONNumIncrBy(args[0], args[1], args[2])
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	return proto.RESPValue{Type: proto.BulkString, String: result}
+}
+
+// jsonPathArg returns the optional path argument at i, or the root
+func jsonPathArg(args []string, i int) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return "$"
+}
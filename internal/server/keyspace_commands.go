@@ -0,0 +1,462 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/store"
+)
+
+// Keyspace command handlers
+
+func (d *CommandDispatcher) handleKeys(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 1 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'keys' command",
+		}
+	}
+
+	return bulkStringArray(db.Keys(args[0]))
+}
+
+func (d *CommandDispatcher) handleScan(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 1 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'scan' command",
+		}
+	}
+
+	cursor, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR invalid cursor",
+		}
+	}
+
+	pattern := ""
+	count := 10
+
+	// Parse optional MATCH pattern and COUNT n
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+		}
+
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+			count, err = strconv.Atoi(args[i+1])
+			if err != nil || count < 1 {
+				return proto.RESPValue{
+					Type:   proto.Error,
+					String: "ERR value is not an integer or out of range",
+				}
+			}
+		default:
+			return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+		}
+	}
+
+	// Past the response size limit the page shrinks, so the cursor still
+	// covers the keys left out
+	keys, next := db.Scan(cursor, pattern, count)
+	for count > 1 && !d.fits(bulkStringArray(keys)) {
+		count /= 2
+		keys, next = db.Scan(cursor, pattern, count)
+	}
+
+	return proto.RESPValue{
+		Type: proto.Array,
+		Array: []proto.RESPValue{
+			{Type: proto.BulkString, String: strconv.FormatUint(next, 10)},
+			bulkStringArray(keys),
+		},
+	}
+}
+
+// handleStats serves key analytics:
+//
+//	STATS KEY key
+//	STATS AMPLIFICATION [WINDOW seconds] [COUNT count]
+func (d *CommandDispatcher) handleStats(db *store.Store, args []string) proto.RESPValue {
+	if len(args) > 0 && strings.ToUpper(args[0]) == "AMPLIFICATION" {
+		return d.statsAmplification(db, args[1:])
+	}
+	if len(args) != 2 || strings.ToUpper(args[0]) != "KEY" {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR syntax error, expected STATS KEY <key>",
+		}
+	}
+
+	stats, exists := db.KeyStats(args[1])
+	if !exists {
+		return proto.RESPValue{Type: proto.Array, Null: true}
+	}
+
+	// Field/value map, flattened into pairs for RESP2 clients
+	return proto.RESPValue{
+		Type: proto.Map,
+		Array: []proto.RESPValue{
+			{Type: proto.BulkString, String: "type"},
+			{Type: proto.BulkString, String: stats.Type.String()},
+			{Type: proto.BulkString, String: "reads"},
+			{Type: proto.Integer, Int: stats.Reads},
+			{Type: proto.BulkString, String: "writes"},
+			{Type: proto.Integer, Int: stats.Writes},
+			{Type: proto.BulkString, String: "last_access"},
+			{Type: proto.Integer, Int: stats.LastAccess},
+			{Type: proto.BulkString, String: "freq"},
+			{Type: proto.Integer, Int: int64(stats.Freq)},
+			{Type: proto.BulkString, String: "versions"},
+			{Type: proto.Integer, Int: int64(stats.Versions)},
+			{Type: proto.BulkString, String: "bytes"},
+			{Type: proto.Integer, Int: stats.Bytes},
+			{Type: proto.BulkString, String: "ttl"},
+			{Type: proto.Integer, Int: stats.TTL},
+			{Type: proto.BulkString, String: "sliding"},
+			{Type: proto.Integer, Int: stats.Sliding},
+		},
+	}
+}
+
+// objectHelp is the reply of OBJECT HELP
+var objectHelp = []string{
+	"OBJECT <subcommand> [<arg> ...]. Subcommands are:",
+	"ENCODING <key>",
+	"    Return how the latest version of the key is stored.",
+	"FREQ <key>",
+	"    Return the logarithmic access frequency of the key, 0-255.",
+	"IDLETIME <key>",
+	"    Return the seconds since the key was last read or written.",
+	"VERSIONS <key>",
+	"    Return the number of versions the key holds.",
+	"HELP",
+	"    Print this help.",
+}
+
+// handleObject reports how a key is stored and accessed, without counting
+// as an access itself:
+//
+//	OBJECT ENCODING key  - how the latest version is stored: int, embstr or
+//	                       raw for strings, hashtable, skiplist, json or
+//	                       ddsketch for the other types
+//	OBJECT FREQ key      - logarithmic access frequency, 0-255
+//	OBJECT IDLETIME key  - seconds since the last read or write
+//	OBJECT VERSIONS key  - number of versions held
+//	OBJECT HELP
+func (d *CommandDispatcher) handleObject(db *store.Store, args []string) proto.RESPValue {
+	if len(args) == 1 && strings.EqualFold(args[0], "HELP") {
+		return helpReply(objectHelp)
+	}
+	if len(args) != 2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'object' command",
+		}
+	}
+
+	subcommand := strings.ToUpper(args[0])
+	switch subcommand {
+	case "ENCODING", "FREQ", "IDLETIME", "VERSIONS":
+	default:
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("ERR unknown subcommand '%s'. Try OBJECT HELP.", args[0]),
+		}
+	}
+
+	stats, exists := db.KeyStats(args[1])
+	if !exists {
+		return proto.RESPValue{Type: proto.BulkString, Null: true}
+	}
+	switch subcommand {
+	case "ENCODING":
+		return proto.RESPValue{Type: proto.BulkString, String: stats.Encoding}
+	case "FREQ":
+		return proto.RESPValue{Type: proto.Integer, Int: int64(stats.Freq)}
+	case "VERSIONS":
+		return proto.RESPValue{Type: proto.Integer, Int: int64(stats.Versions)}
+	}
+	idle := max(time.Now().UnixMilli()-stats.LastAccess, 0)
+	return proto.RESPValue{Type: proto.Integer, Int: idle / 1000}
+}
+
+// memoryHelp is the reply of MEMORY HELP
+var memoryHelp = []string{
+	"MEMORY <subcommand> [<arg> ...]. Subcommands are:",
+	"USAGE <key> [SAMPLES <count>]",
+	"    Return the approximate bytes used by the key and all its versions.",
+	"HELP",
+	"    Print this help.",
+}
+
+// handleMemory reports memory use, without counting as an access:
+//
+//	MEMORY USAGE key [SAMPLES count]  - approximate bytes of the key, its
+//	                                    versions and their values
+//	MEMORY HELP
+//
+// Every version is counted, so SAMPLES is accepted for compatibility with
+// Redis clients and ignored.
+func (d *CommandDispatcher) handleMemory(db *store.Store, args []string) proto.RESPValue {
+	if len(args) == 0 {
+		return proto.RESPValue{Type: proto.Error, String: "ERR wrong number of arguments for 'memory' command"}
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "HELP":
+		if len(args) == 1 {
+			return helpReply(memoryHelp)
+		}
+	case "USAGE":
+		if len(args) == 4 && strings.EqualFold(args[2], "SAMPLES") {
+			if n, err := strconv.Atoi(args[3]); err != nil || n < 0 {
+				return proto.RESPValue{Type: proto.Error, String: "ERR value is not an integer or out of range"}
+			}
+		} else if len(args) != 2 {
+			return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+		}
+		stats, exists := db.KeyStats(args[1])
+		if !exists {
+			return proto.RESPValue{Type: proto.BulkString, Null: true}
+		}
+		return proto.RESPValue{Type: proto.Integer, Int: stats.Bytes}
+	default:
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("ERR unknown subcommand '%s'. Try MEMORY HELP.", args[0]),
+		}
+	}
+	return proto.RESPValue{
+		Type:   proto.Error,
+		String: fmt.Sprintf("ERR wrong number of arguments for 'memory %s' command", strings.ToLower(args[0])),
+	}
+}
+
+// helpReply returns the lines of a HELP subcommand as status replies
+func helpReply(lines []string) proto.RESPValue {
+	reply := make([]proto.RESPValue, len(lines))
+	for i, line := range lines {
+		reply[i] = proto.RESPValue{Type: proto.SimpleString, String: line}
+	}
+	return proto.RESPValue{Type: proto.Array, Array: reply}
+}
+
+// statsAmplification compares the versions each namespace wrote over the
+// window with the keys and versions it holds, and lists the keys whose
+// retention policy dropped the most versions
+func (d *CommandDispatcher) statsAmplification(db *store.Store, args []string) proto.RESPValue {
+	window, count := time.Hour, 10
+	if len(args)%2 != 0 {
+		return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+	}
+	for i := 0; i < len(args); i += 2 {
+		n, err := strconv.Atoi(args[i+1])
+		switch strings.ToUpper(args[i]) {
+		case "WINDOW":
+			if err != nil || n < 1 {
+				return proto.RESPValue{Type: proto.Error, String: "ERR invalid window"}
+			}
+			window = time.Duration(n) * time.Second
+		case "COUNT":
+			if err != nil || n < 0 {
+				return proto.RESPValue{
+					Type:   proto.Error,
+					String: "ERR value is not an integer or out of range",
+				}
+			}
+			count = n
+		default:
+			return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+		}
+	}
+
+	report := db.Amplification(window, count)
+
+	namespaces := make([]proto.RESPValue, len(report.Namespaces))
+	for i, ns := range report.Namespaces {
+		namespaces[i] = proto.RESPValue{
+			Type: proto.Map,
+			Array: []proto.RESPValue{
+				{Type: proto.BulkString, String: "namespace"},
+				{Type: proto.BulkString, String: ns.Namespace},
+				{Type: proto.BulkString, String: "created"},
+				{Type: proto.Integer, Int: ns.Created},
+				{Type: proto.BulkString, String: "pruned"},
+				{Type: proto.Integer, Int: ns.Pruned},
+				{Type: proto.BulkString, String: "keys"},
+				{Type: proto.Integer, Int: int64(ns.Keys)},
+				{Type: proto.BulkString, String: "retained"},
+				{Type: proto.Integer, Int: int64(ns.Retained)},
+				{Type: proto.BulkString, String: "amplification"},
+				{Type: proto.Double, Float: ns.Amplification()},
+			},
+		}
+	}
+
+	keys := make([]proto.RESPValue, len(report.Keys))
+	for i, key := range report.Keys {
+		keys[i] = proto.RESPValue{
+			Type: proto.Map,
+			Array: []proto.RESPValue{
+				{Type: proto.BulkString, String: "key"},
+				{Type: proto.BulkString, String: key.Key},
+				{Type: proto.BulkString, String: "created"},
+				{Type: proto.Integer, Int: key.Created},
+				{Type: proto.BulkString, String: "pruned"},
+				{Type: proto.Integer, Int: key.Pruned},
+				{Type: proto.BulkString, String: "retained"},
+				{Type: proto.Integer, Int: int64(key.Retained)},
+				{Type: proto.BulkString, String: "retention"},
+				{Type: proto.BulkString, String: key.Retention},
+			},
+		}
+	}
+
+	return proto.RESPValue{
+		Type: proto.Map,
+		Array: []proto.RESPValue{
+			{Type: proto.BulkString, String: "window"},
+			{Type: proto.Integer, Int: int64(report.Window.Seconds())},
+			{Type: proto.BulkString, String: "namespaces"},
+			{Type: proto.Array, Array: namespaces},
+			{Type: proto.BulkString, String: "keys"},
+			{Type: proto.Array, Array: keys},
+		},
+	}
+}
+
+func (d *CommandDispatcher) handleExists(db *store.Store, args []string) proto.RESPValue {
+	if len(args) == 0 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'exists' command",
+		}
+	}
+
+	return proto.RESPValue{Type: proto.Integer, Int: int64(db.Exists(args...))}
+}
+
+func (d *CommandDispatcher) handleType(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 1 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'type' command",
+		}
+	}
+
+	valueType, exists := db.Type(args[0])
+	if !exists {
+		return proto.RESPValue{Type: proto.SimpleString, String: "none"}
+	}
+
+	return proto.RESPValue{Type: proto.SimpleString, String: valueType.String()}
+}
+
+func (d *CommandDispatcher) handleRename(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'rename' command",
+		}
+	}
+
+	if err := db.Rename(args[0], args[1]); err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+
+	return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
+}
+
+func (d *CommandDispatcher) handleRenameNX(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'renamenx' command",
+		}
+	}
+
+	renamed, err := db.RenameNX(args[0], args[1])
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+
+	if renamed {
+		return proto.RESPValue{Type: proto.Integer, Int: 1}
+	}
+	return proto.RESPValue{Type: proto.Integer, Int: 0}
+}
+
+func (d *CommandDispatcher) handlePersist(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 1 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'persist' command",
+		}
+	}
+
+	if db.Persist(args[0]) {
+		return proto.RESPValue{Type: proto.Integer, Int: 1}
+	}
+	return proto.RESPValue{Type: proto.Integer, Int: 0}
+}
+
+// handleDump serializes a key with all its versions and TTL, for RESTORE on
+// this or another instance
+func (d *CommandDispatcher) handleDump(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 1 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'dump' command",
+		}
+	}
+
+	dump, exists := db.ExportKey(args[0])
+	if !exists {
+		return proto.RESPValue{Type: proto.BulkString, Null: true}
+	}
+	return proto.RESPValue{Type: proto.BulkString, String: string(store.EncodeDump(dump))}
+}
+
+// handleRestore recreates a key from a DUMP payload:
+//
+//	RESTORE key payload [REPLACE]
+//
+// The history is restored as it was dumped. A payload whose versions have
+// all expired since creates nothing.
+func (d *CommandDispatcher) handleRestore(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 2 || len(args) > 3 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'restore' command",
+		}
+	}
+	replace := false
+	if len(args) == 3 {
+		if strings.ToUpper(args[2]) != "REPLACE" {
+			return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+		}
+		replace = true
+	}
+
+	dump, err := store.DecodeDump(args[0], []byte(args[1]))
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	imported, err := db.ImportKey(dump, replace)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	if !imported && !replace && db.Exists(args[0]) > 0 {
+		return proto.RESPValue{Type: proto.Error, String: "BUSYKEY Target key name already exists."}
+	}
+	return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
+}
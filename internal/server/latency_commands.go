@@ -0,0 +1,80 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"pulsedb/internal/latency"
+	"pulsedb/internal/proto"
+	"pulsedb/internal/store"
+)
+
+// SetLatencyMonitor sets the monitor recording command latency spikes, so
+// several listeners can share one
+func (s *Server) SetLatencyMonitor(monitor *latency.Monitor) {
+	s.dispatcher.latency = monitor
+}
+
+// handleLatency inspects the latency spikes of commands, named after the
+// command in lowercase:
+//
+//	LATENCY LATEST
+//	LATENCY HISTORY event
+//	LATENCY RESET [event ...]
+func (d *CommandDispatcher) handleLatency(db *store.Store, args []string) proto.RESPValue {
+	if len(args) == 0 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'latency' command",
+		}
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "LATEST":
+		// Same layout as Redis: event, unix time and latency in
+		// milliseconds of the latest spike, and the worst latency
+		events := d.latency.Latest()
+		result := make([]proto.RESPValue, len(events))
+		for i, event := range events {
+			result[i] = proto.RESPValue{
+				Type: proto.Array,
+				Array: []proto.RESPValue{
+					{Type: proto.BulkString, String: event.Name},
+					{Type: proto.Integer, Int: event.Latest.Time},
+					{Type: proto.Integer, Int: event.Latest.Latency},
+					{Type: proto.Integer, Int: event.Max},
+				},
+			}
+		}
+		return proto.RESPValue{Type: proto.Array, Array: result}
+
+	case "HISTORY":
+		if len(args) != 2 {
+			return proto.RESPValue{
+				Type:   proto.Error,
+				String: "ERR wrong number of arguments for 'latency history' command",
+			}
+		}
+		samples := d.latency.History(args[1])
+		result := make([]proto.RESPValue, len(samples))
+		for i, sample := range samples {
+			result[i] = proto.RESPValue{
+				Type: proto.Array,
+				Array: []proto.RESPValue{
+					{Type: proto.Integer, Int: sample.Time},
+					{Type: proto.Integer, Int: sample.Latency},
+				},
+			}
+		}
+		return proto.RESPValue{Type: proto.Array, Array: result}
+
+	case "RESET":
+		return proto.RESPValue{Type: proto.Integer, Int: int64(d.latency.Reset(args[1:]...))}
+
+	default:
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("ERR unknown subcommand '%s'", args[0]),
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package server
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/store"
+	"pulsedb/internal/streams"
+)
+
+// Migration from Redis. MIGRATE FROM walks the keyspace of a running Redis
+// with SCAN and copies every key with its TTL. Redis types map to PulseDB
+// types where one exists: strings, sets and sorted sets as themselves,
+// hashes as JSON objects, lists as JSON arrays and streams as streams.
+// Keys of other types are counted and left behind.
+
+// handleMigrate copies the keys of a Redis server:
+//
+//	MIGRATE FROM redis://[user:password@]host:port[/db] [MATCH pattern] [COUNT count] [CURSOR cursor] [REPLACE]
+//
+// rediss:// connects over TLS. Keys that already exist are kept unless
+// REPLACE is given. If the migration stops part way, the error names the
+// SCAN cursor to resume from.
+func (d *CommandDispatcher) handleMigrate(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'migrate' command",
+		}
+	}
+	if strings.ToUpper(args[0]) != "FROM" {
+		return proto.RESPValue{Type: proto.Error, String: "ERR syntax error, expected MIGRATE FROM redis://host:port"}
+	}
+
+	source := args[1]
+	cursor, pattern, count, replace := "0", "*", 100, false
+	for i := 2; i < len(args); i++ {
+		option := strings.ToUpper(args[i])
+		if option == "REPLACE" {
+			replace = true
+			continue
+		}
+		if i+1 >= len(args) {
+			return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+		}
+		switch option {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 1 {
+				return proto.RESPValue{Type: proto.Error, String: "ERR value is not an integer or out of range"}
+			}
+			count = n
+		case "CURSOR":
+			if _, err := strconv.ParseUint(args[i+1], 10, 64); err != nil {
+				return proto.RESPValue{Type: proto.Error, String: "ERR invalid cursor"}
+			}
+			cursor = args[i+1]
+		default:
+			return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+		}
+		i++
+	}
+
+	client, err := dialRedis(source)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: fmt.Sprintf("ERR cannot connect to %s: %v", redactURL(source), err)}
+	}
+	defer client.Close()
+
+	var imported, skipped, unsupported, entries int64
+	for {
+		reply, err := redisDo(client, "SCAN", cursor, "MATCH", pattern, "COUNT", strconv.Itoa(count))
+		if err == nil && (len(reply.Array) != 2 || reply.Array[1].Type != proto.Array) {
+			err = fmt.Errorf("unexpected SCAN reply")
+		}
+		if err != nil {
+			return migrateStopped(cursor, err)
+		}
+
+		for _, key := range reply.Array[1].Array {
+			dump, streamEntries, supported, err := fetchRedisKey(client, key.String)
+			if err != nil {
+				return migrateStopped(cursor, err)
+			}
+			switch {
+			case !supported:
+				unsupported++
+			case streamEntries != nil:
+				entries += int64(d.streams.ImportEntries(key.String, streamEntries))
+			case dump != nil:
+				ok, err := db.ImportKey(*dump, replace)
+				if err != nil {
+					return migrateStopped(cursor, err)
+				}
+				if ok {
+					imported++
+				} else {
+					skipped++
+				}
+			}
+		}
+
+		if cursor = reply.Array[0].String; cursor == "0" {
+			break
+		}
+	}
+
+	return proto.RESPValue{
+		Type: proto.Map,
+		Array: []proto.RESPValue{
+			{Type: proto.BulkString, String: "keys"},
+			{Type: proto.Integer, Int: imported},
+			{Type: proto.BulkString, String: "skipped"},
+			{Type: proto.Integer, Int: skipped},
+			{Type: proto.BulkString, String: "unsupported"},
+			{Type: proto.Integer, Int: unsupported},
+			{Type: proto.BulkString, String: "stream_entries"},
+			{Type: proto.Integer, Int: entries},
+		},
+	}
+}
+
+func migrateStopped(cursor string, err error) proto.RESPValue {
+	return proto.RESPValue{
+		Type:   proto.Error,
+		String: fmt.Sprintf("ERR migration stopped at cursor %s: %v", cursor, strings.TrimPrefix(err.Error(), "ERR ")),
+	}
+}
+
+// dialRedis connects to the Redis server of a redis:// or rediss:// URL,
+// authenticating and selecting the database it names
+func dialRedis(rawURL string) (*proto.Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL")
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("the URL must start with redis:// or rediss://")
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "rediss" {
+		secure := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		secure.SetDeadline(time.Now().Add(5 * time.Second))
+		if err := secure.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		secure.SetDeadline(time.Time{})
+		conn = secure
+	}
+	client := proto.NewClient(conn)
+
+	if password, set := u.User.Password(); set {
+		auth := []string{password}
+		if user := u.User.Username(); user != "" {
+			auth = []string{user, password}
+		}
+		if _, err := redisDo(client, "AUTH", auth...); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" && db != "0" {
+		if _, err := redisDo(client, "SELECT", db); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// redactURL hides the password of a Redis URL in error messages
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "the source"
+	}
+	return u.Redacted()
+}
+
+// redisDo sends a command, turning error replies into errors
+func redisDo(client *proto.Client, cmd string, args ...string) (proto.RESPValue, error) {
+	reply, err := client.Do(cmd, args...)
+	if err != nil {
+		return reply, err
+	}
+	if reply.Type == proto.Error {
+		return reply, fmt.Errorf("%s", reply.String)
+	}
+	return reply, nil
+}
+
+// streamPage is how many stream entries are read from Redis at a time
+const streamPage = 1000
+
+// fetchRedisKey reads a key from Redis as a dump, or as the entries of a
+// stream. supported is false for types PulseDB has no equivalent of; both
+// results are nil if the key vanished while it was read.
+func fetchRedisKey(client *proto.Client, key string) (dump *store.KeyDump, entries []streams.StreamEntry, supported bool, err error) {
+	reply, err := redisDo(client, "TYPE", key)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	switch kind := reply.String; kind {
+	case "stream":
+		entries, err := fetchRedisStream(client, key)
+		return nil, entries, true, err
+	case "string", "set", "zset", "hash", "list":
+		dump, err := fetchRedisValue(client, key, kind)
+		return dump, nil, true, err
+	case "none":
+		return nil, nil, true, nil
+	default:
+		return nil, nil, false, nil
+	}
+}
+
+// fetchRedisValue reads a key of a type the store has an equivalent of,
+// returning nil if it vanished while it was read
+func fetchRedisValue(client *proto.Client, key, kind string) (*store.KeyDump, error) {
+	ttl, err := redisDo(client, "PTTL", key)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixMilli()
+	version := store.VersionDump{Timestamp: now}
+	switch {
+	case ttl.Int == -2:
+		return nil, nil
+	case ttl.Int > 0:
+		version.TTL = now + ttl.Int
+	}
+
+	var reply proto.RESPValue
+	switch kind {
+	case "string":
+		reply, err = redisDo(client, "GET", key)
+		version.Type, version.Data = store.TypeString.String(), reply.String
+	case "set":
+		reply, err = redisDo(client, "SMEMBERS", key)
+		version.Type = store.TypeSet.String()
+		for _, member := range reply.Array {
+			version.Members = append(version.Members, member.String)
+		}
+	case "zset":
+		reply, err = redisDo(client, "ZRANGE", key, "0", "-1", "WITHSCORES")
+		version.Type = store.TypeZSet.String()
+		for i := 0; err == nil && i+1 < len(reply.Array); i += 2 {
+			var score float64
+			score, err = strconv.ParseFloat(reply.Array[i+1].String, 64)
+			version.ZMembers = append(version.ZMembers, store.ZMember{Member: reply.Array[i].String, Score: score})
+		}
+	case "hash":
+		reply, err = redisDo(client, "HGETALL", key)
+		fields := make(map[string]string, len(reply.Array)/2)
+		for i := 0; i+1 < len(reply.Array); i += 2 {
+			fields[reply.Array[i].String] = reply.Array[i+1].String
+		}
+		version.Type, version.Data = store.TypeJSON.String(), encodeJSON(fields)
+	case "list":
+		reply, err = redisDo(client, "LRANGE", key, "0", "-1")
+		items := make([]string, len(reply.Array))
+		for i, item := range reply.Array {
+			items[i] = item.String
+		}
+		version.Type, version.Data = store.TypeJSON.String(), encodeJSON(items)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Expired or emptied between TYPE and the read
+	if reply.Null || reply.Type == proto.Array && len(reply.Array) == 0 {
+		return nil, nil
+	}
+	return &store.KeyDump{Key: key, Versions: []store.VersionDump{version}}, nil
+}
+
+// fetchRedisStream reads every entry of a Redis stream. Entry IDs are
+// <ms>-<seq> on both sides and are kept.
+func fetchRedisStream(client *proto.Client, key string) ([]streams.StreamEntry, error) {
+	entries := []streams.StreamEntry{}
+	start := "-"
+	for {
+		reply, err := redisDo(client, "XRANGE", key, start, "+", "COUNT", strconv.Itoa(streamPage))
+		if err != nil {
+			return nil, err
+		}
+		// Pages after the first repeat the last entry already read, which
+		// ImportEntries skips
+		for _, item := range reply.Array {
+			if len(item.Array) != 2 {
+				return nil, fmt.Errorf("unexpected XRANGE reply")
+			}
+			id, pairs := item.Array[0].String, item.Array[1].Array
+			entry := streams.StreamEntry{ID: id, Fields: make(map[string]string, len(pairs)/2)}
+			entry.Timestamp, _ = strconv.ParseInt(strings.SplitN(id, "-", 2)[0], 10, 64)
+			for i := 0; i+1 < len(pairs); i += 2 {
+				entry.Fields[pairs[i].String] = pairs[i+1].String
+			}
+			entries = append(entries, entry)
+		}
+		if len(reply.Array) < streamPage {
+			return entries, nil
+		}
+		start = reply.Array[len(reply.Array)-1].Array[0].String
+	}
+}
+
+func encodeJSON(v interface{}) string {
+	encoded, _ := json.Marshal(v)
+	return string(encoded)
+}
@@ -0,0 +1,260 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/store"
+	"pulsedb/internal/streams"
+	"pulsedb/internal/throttle"
+)
+
+// Namespace migration. NSEXPORT pages through the keys (with their full
+// histories and TTLs) and then the streams of a namespace; NSIMPORT pulls
+// every page from another PulseDB over RESP and applies it. Cursors are
+// opaque strings: "0" starts and ends an export, a number is a position in
+// the keyspace scan and "s:<id>:<stream>" a position in the streams.
+
+// namespaceChunk is one page of a namespace export, encoded as JSON
+type namespaceChunk struct {
+	Keys    []store.KeyDump `json:"keys"`
+	Streams []streamChunk   `json:"streams"`
+}
+
+type streamChunk struct {
+	Name    string                `json:"name"`
+	Entries []streams.StreamEntry `json:"entries"`
+}
+
+// handleNSExport returns the next page of a namespace and its cursor:
+//
+//	NSEXPORT namespace [CURSOR cursor] [COUNT count]
+func (d *CommandDispatcher) handleNSExport(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 1 || len(args)%2 != 1 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'nsexport' command",
+		}
+	}
+
+	namespace := args[0]
+	cursor, count, err := parseNamespaceOptions(args[1:])
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+
+	chunk := namespaceChunk{Keys: []store.KeyDump{}, Streams: []streamChunk{}}
+	next := "0"
+	if !strings.HasPrefix(cursor, "s:") {
+		position, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return proto.RESPValue{Type: proto.Error, String: "ERR invalid cursor"}
+		}
+		chunk.Keys, position = d.exportKeys(db, namespace, position, count)
+		if position != 0 {
+			next = strconv.FormatUint(position, 10)
+		} else if names := d.namespaceStreams(namespace, ""); len(names) > 0 {
+			next = "s::" + names[0]
+		}
+	} else {
+		parts := strings.SplitN(cursor, ":", 3)
+		if len(parts) != 3 {
+			return proto.RESPValue{Type: proto.Error, String: "ERR invalid cursor"}
+		}
+		chunk.Streams, next = d.exportStreams(namespace, parts[2], parts[1], count)
+	}
+
+	encoded, err := json.Marshal(chunk)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: "ERR " + err.Error()}
+	}
+	return proto.RESPValue{
+		Type: proto.Array,
+		Array: []proto.RESPValue{
+			{Type: proto.BulkString, String: next},
+			{Type: proto.BulkString, String: string(encoded)},
+		},
+	}
+}
+
+// exportKeys scans from position until it has count keys of the namespace
+// or the scan ends, returning the dumps and the next position (0 at the end)
+func (d *CommandDispatcher) exportKeys(db *store.Store, namespace string, position uint64, count int) ([]store.KeyDump, uint64) {
+	dumps := []store.KeyDump{}
+	for {
+		var keys []string
+		keys, position = db.Scan(position, "", count)
+		for _, key := range keys {
+			if throttle.Namespace(key) != namespace {
+				continue
+			}
+			if dump, ok := db.ExportKey(key); ok {
+				dumps = append(dumps, dump)
+			}
+		}
+		if position == 0 || len(dumps) >= count {
+			return dumps, position
+		}
+	}
+}
+
+// exportStreams returns up to count entries of the namespace streams from
+// the entry after afterID in stream name onwards, and the next cursor
+func (d *CommandDispatcher) exportStreams(namespace, name, afterID string, count int) ([]streamChunk, string) {
+	chunks := []streamChunk{}
+	for _, stream := range d.namespaceStreams(namespace, name) {
+		if stream != name {
+			afterID = ""
+		}
+		entries, err := d.streams.EntriesAfter(stream, afterID, count)
+		if err != nil {
+			continue
+		}
+		if len(entries) > 0 {
+			chunks = append(chunks, streamChunk{Name: stream, Entries: entries})
+			count -= len(entries)
+		}
+		if count <= 0 {
+			return chunks, "s:" + entries[len(entries)-1].ID + ":" + stream
+		}
+	}
+	return chunks, "0"
+}
+
+// namespaceStreams returns the names of the streams in namespace from name
+// onwards, sorted
+func (d *CommandDispatcher) namespaceStreams(namespace, from string) []string {
+	var names []string
+	for _, name := range d.streams.ListStreams() {
+		if throttle.Namespace(name) == namespace && name >= from {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// handleNSImport copies a namespace from another PulseDB:
+//
+//	NSIMPORT host:port namespace [CURSOR cursor] [COUNT count] [REPLACE]
+//
+// Keys that already exist are kept unless REPLACE is given. If the import
+// stops part way, the error names the cursor to resume from.
+func (d *CommandDispatcher) handleNSImport(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'nsimport' command",
+		}
+	}
+
+	addr, namespace := args[0], args[1]
+	options := args[2:]
+	replace := false
+	if n := len(options); n > 0 && strings.ToUpper(options[n-1]) == "REPLACE" {
+		replace, options = true, options[:n-1]
+	}
+	cursor, count, err := parseNamespaceOptions(options)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+
+	source, err := proto.Dial(addr, 5*time.Second)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: fmt.Sprintf("ERR cannot connect to %s: %v", addr, err)}
+	}
+	defer source.Close()
+
+	var imported, skipped, entries int64
+	for {
+		chunk, next, err := fetchNamespaceChunk(source, namespace, cursor, count)
+		if err != nil {
+			return proto.RESPValue{
+				Type:   proto.Error,
+				String: fmt.Sprintf("ERR import stopped at cursor %s: %v", cursor, err),
+			}
+		}
+
+		for _, dump := range chunk.Keys {
+			ok, err := db.ImportKey(dump, replace)
+			if err != nil {
+				return proto.RESPValue{
+					Type:   proto.Error,
+					String: fmt.Sprintf("ERR import stopped at cursor %s: %v", cursor, err),
+				}
+			}
+			if ok {
+				imported++
+			} else {
+				skipped++
+			}
+		}
+		for _, stream := range chunk.Streams {
+			entries += int64(d.streams.ImportEntries(stream.Name, stream.Entries))
+		}
+
+		if cursor = next; cursor == "0" {
+			break
+		}
+	}
+
+	return proto.RESPValue{
+		Type: proto.Map,
+		Array: []proto.RESPValue{
+			{Type: proto.BulkString, String: "keys"},
+			{Type: proto.Integer, Int: imported},
+			{Type: proto.BulkString, String: "skipped"},
+			{Type: proto.Integer, Int: skipped},
+			{Type: proto.BulkString, String: "stream_entries"},
+			{Type: proto.Integer, Int: entries},
+		},
+	}
+}
+
+// fetchNamespaceChunk requests one page of a namespace export from source
+func fetchNamespaceChunk(source *proto.Client, namespace, cursor string, count int) (namespaceChunk, string, error) {
+	var chunk namespaceChunk
+	reply, err := source.Do("NSEXPORT", namespace, "CURSOR", cursor, "COUNT", strconv.Itoa(count))
+	if err != nil {
+		return chunk, "", err
+	}
+	if reply.Type == proto.Error {
+		return chunk, "", fmt.Errorf("%s", reply.String)
+	}
+	if len(reply.Array) != 2 {
+		return chunk, "", fmt.Errorf("unexpected NSEXPORT reply")
+	}
+	if err := json.Unmarshal([]byte(reply.Array[1].String), &chunk); err != nil {
+		return chunk, "", err
+	}
+	return chunk, reply.Array[0].String, nil
+}
+
+// parseNamespaceOptions parses the CURSOR and COUNT options of NSEXPORT and
+// NSIMPORT
+func parseNamespaceOptions(args []string) (cursor string, count int, err error) {
+	cursor, count = "0", 100
+	if len(args)%2 != 0 {
+		return "", 0, fmt.Errorf("ERR syntax error")
+	}
+	for i := 0; i < len(args); i += 2 {
+		switch strings.ToUpper(args[i]) {
+		case "CURSOR":
+			cursor = args[i+1]
+		case "COUNT":
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 1 {
+				return "", 0, fmt.Errorf("ERR value is not an integer or out of range")
+			}
+			count = n
+		default:
+			return "", 0, fmt.Errorf("ERR syntax error")
+		}
+	}
+	return cursor, count, nil
+}
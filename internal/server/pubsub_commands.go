@@ -0,0 +1,149 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/pubsub"
+	"pulsedb/internal/store"
+)
+
+// Pub/sub commands. Messages are pushed to subscribed connections by a
+// writer goroutine started in HandleConnection; in RESP2 a subscribed
+// connection may only run subscribedCommands, like in Redis.
+
+// subscribedCommands are the commands a RESP2 connection may run while it
+// has subscriptions, since any other reply could be mistaken for a message
+var subscribedCommands = map[string]bool{
+	"SUBSCRIBE":   true,
+	"UNSUBSCRIBE": true,
+	"PING":        true,
+}
+
+// handleSubscribe subscribes the connection to channels:
+//
+//	SUBSCRIBE channel [channel ...]
+//
+// Every channel is confirmed with its own reply.
+func (d *CommandDispatcher) handleSubscribe(c *Client, args []string) proto.RESPValue {
+	if len(args) == 0 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'subscribe' command",
+		}
+	}
+
+	if c.subscriber == nil {
+		c.subscriber = pubsub.NewSubscriber(pubsub.DefaultBuffer, func() { c.kill(nil) })
+	}
+	replies := make([]proto.RESPValue, len(args))
+	for i, channel := range args {
+		count := d.pubsub.Subscribe(c.subscriber, channel)
+		replies[i] = subscriptionReply("subscribe", channel, count)
+	}
+	c.extraReplies = replies[1:]
+	return replies[0]
+}
+
+// handleUnsubscribe unsubscribes the connection from channels, or from every
+// channel without arguments:
+//
+//	UNSUBSCRIBE [channel ...]
+func (d *CommandDispatcher) handleUnsubscribe(c *Client, args []string) proto.RESPValue {
+	channels := args
+	if len(channels) == 0 && c.subscriber != nil {
+		channels = c.subscriber.Channels()
+	}
+	if len(channels) == 0 {
+		return proto.RESPValue{
+			Type: proto.Push,
+			Array: []proto.RESPValue{
+				{Type: proto.BulkString, String: "unsubscribe"},
+				{Type: proto.BulkString, Null: true},
+				{Type: proto.Integer, Int: 0},
+			},
+		}
+	}
+
+	replies := make([]proto.RESPValue, len(channels))
+	for i, channel := range channels {
+		count := 0
+		if c.subscriber != nil {
+			count = d.pubsub.Unsubscribe(c.subscriber, channel)
+		}
+		replies[i] = subscriptionReply("unsubscribe", channel, count)
+	}
+	c.extraReplies = replies[1:]
+	return replies[0]
+}
+
+// handlePublish publishes a message and returns how many subscribers
+// received it:
+//
+//	PUBLISH channel message
+func (d *CommandDispatcher) handlePublish(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'publish' command",
+		}
+	}
+	if pubsub.IsReserved(args[0]) {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("ERR channel '%s' is reserved for server events", args[0]),
+		}
+	}
+
+	received := d.pubsub.Publish(args[0], args[1])
+	return proto.RESPValue{Type: proto.Integer, Int: int64(received)}
+}
+
+func subscriptionReply(kind, channel string, count int) proto.RESPValue {
+	return proto.RESPValue{
+		Type: proto.Push,
+		Array: []proto.RESPValue{
+			{Type: proto.BulkString, String: kind},
+			{Type: proto.BulkString, String: channel},
+			{Type: proto.Integer, Int: int64(count)},
+		},
+	}
+}
+
+// messageReply is the push delivering msg to a subscriber
+func messageReply(msg pubsub.Message) proto.RESPValue {
+	return proto.RESPValue{
+		Type: proto.Push,
+		Array: []proto.RESPValue{
+			{Type: proto.BulkString, String: "message"},
+			{Type: proto.BulkString, String: msg.Channel},
+			{Type: proto.BulkString, String: msg.Payload},
+		},
+	}
+}
+
+// configEvent is published on pubsub.ConfigChannel when a runtime setting
+// changes
+type configEvent struct {
+	Event     string `json:"event"`
+	Parameter string `json:"parameter,omitempty"`
+	Key       string `json:"key,omitempty"`
+	Value     string `json:"value,omitempty"`
+	Time      int64  `json:"time"` // Unix milliseconds
+}
+
+// publishConfigEvent tells the subscribers of pubsub.ConfigChannel about a
+// configuration change
+func (d *CommandDispatcher) publishConfigEvent(event configEvent) {
+	if d.pubsub.Subscribers(pubsub.ConfigChannel) == 0 {
+		return
+	}
+	event.Time = time.Now().UnixMilli()
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	d.pubsub.Publish(pubsub.ConfigChannel, string(payload))
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"fmt"
+	"net"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/throttle"
+)
+
+// SetRateLimiter sets the limiter enforcing client command rates, so
+// several listeners can share one
+func (s *Server) SetRateLimiter(limiter *throttle.RateLimiter) {
+	s.dispatcher.rateLimit = limiter
+}
+
+// rateLimited returns a RATELIMIT error if client is over the command rate
+// of the class of cmd
+func (d *CommandDispatcher) rateLimited(client *Client, cmd string) (proto.RESPValue, bool) {
+	class := commandClass(cmd)
+	identity := rateLimitIdentity(client)
+	if d.rateLimit.Allow(identity, class) {
+		return proto.RESPValue{}, false
+	}
+
+	d.metrics.IncrementRateLimited(class.String())
+	return proto.RESPValue{
+		Type:   proto.Error,
+		String: fmt.Sprintf("RATELIMIT client '%s' is over its %s command rate, retry later", identity, class),
+	}, true
+}
+
+// rateLimitIdentity identifies client for rate limiting: by the API key it
+// authenticated with, otherwise by its IP address, so the connections of
+// one user or host share their limits
+func rateLimitIdentity(client *Client) string {
+	if client.apiKey != "" {
+		return "key:" + client.apiKey
+	}
+	if host, _, err := net.SplitHostPort(client.Addr); err == nil {
+		return host
+	}
+	return client.Addr
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+
+	"pulsedb/internal/proto"
+)
+
+// truncatableCommands reply with a list of like elements, which can be cut
+// short past the response size limit. SCAN and HISTSCAN shorten their pages
+// instead, so their cursor still covers whatever was left out.
+var truncatableCommands = map[string]bool{
+	"HIST":      true,
+	"HISTRANGE": true,
+	"KEYS":      true,
+	"SMEMBERS":  true,
+	"SINTER":    true,
+	"SUNION":    true,
+	"SDIFF":     true,
+}
+
+// SetMaxResponseSize caps the encoded size of the list replies of the
+// listener at n bytes (0 means unlimited). Longer replies are truncated to
+// the elements that fit and flagged with a "truncated" attribute, plus a
+// "cursor" attribute where the rest can be paged through with HISTSCAN.
+// RESP2 has no attributes, so RESP2 connections get an error instead of a
+// silently partial reply. SCAN and HISTSCAN return shorter pages instead.
+func (s *Server) SetMaxResponseSize(n int64) {
+	s.dispatcher.maxResponseSize = n
+}
+
+// fits reports whether value encodes within the response size limit
+func (d *CommandDispatcher) fits(value proto.RESPValue) bool {
+	if d.maxResponseSize <= 0 {
+		return true
+	}
+	encoded, err := proto.AppendValueProtocol(nil, value, proto.RESP3)
+	return err == nil && int64(len(encoded)) <= d.maxResponseSize
+}
+
+// limitResponse truncates an aggregate reply to the response size limit.
+// Elements are encoded one at a time, so an oversized reply is never
+// buffered whole.
+func (d *CommandDispatcher) limitResponse(client *Client, response proto.RESPValue) proto.RESPValue {
+	step := 1
+	switch response.Type {
+	case proto.Map:
+		step = 2
+	case proto.Array, proto.Set:
+	default:
+		return response
+	}
+
+	protocol := d.replyProtocol(client)
+	size := int64(16) // Aggregate header
+	var encoded []byte
+	for i := 0; i+step <= len(response.Array); i += step {
+		for _, element := range response.Array[i : i+step] {
+			var err error
+			if encoded, err = proto.AppendValueProtocol(encoded[:0], element, protocol); err != nil {
+				return response
+			}
+			size += int64(len(encoded))
+		}
+		if size > d.maxResponseSize {
+			return d.truncate(response, i, protocol)
+		}
+	}
+	return response
+}
+
+// truncate keeps the first n elements of response and flags it as partial
+func (d *CommandDispatcher) truncate(response proto.RESPValue, n, protocol int) proto.RESPValue {
+	d.metrics.IncrementRepliesTruncated()
+	if protocol == proto.RESP2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("ERR reply exceeds the max response size of %d bytes, narrow the request or page through it with SCAN or HISTSCAN", d.maxResponseSize),
+		}
+	}
+
+	kept := response.Array[:n]
+	response.Array = kept
+	response.Attributes = append(response.Attributes[:len(response.Attributes):len(response.Attributes)],
+		proto.RESPValue{Type: proto.BulkString, String: "truncated"},
+		proto.RESPValue{Type: proto.Boolean, Bool: true},
+	)
+	// History replies resume with HISTSCAN after the last version kept
+	if n > 0 {
+		if hlc, ok := attribute(kept[n-1], "hlc"); ok {
+			response.Attributes = append(response.Attributes,
+				proto.RESPValue{Type: proto.BulkString, String: "cursor"},
+				proto.RESPValue{Type: proto.BulkString, String: strconv.FormatInt(hlc.Int, 10)},
+			)
+		}
+	}
+	return response
+}
+
+// attribute returns the attribute of value named name
+func attribute(value proto.RESPValue, name string) (proto.RESPValue, bool) {
+	for i := 0; i+1 < len(value.Attributes); i += 2 {
+		if value.Attributes[i].String == name {
+			return value.Attributes[i+1], true
+		}
+	}
+	return proto.RESPValue{}, false
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/store"
+)
+
+// handleRetention manages how much history is kept:
+//
+//	RETENTION GET [key]
+//	RETENTION DEFAULT COUNT n | AGE duration | ALL
+//	RETENTION SET key COUNT n | AGE duration | ALL
+//	RETENTION RESET key
+//
+// Changes are published on pubsub.ConfigChannel.
+func (d *CommandDispatcher) handleRetention(db *store.Store, args []string) proto.RESPValue {
+	if len(args) == 0 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'retention' command",
+		}
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		switch len(args) {
+		case 1:
+			return proto.RESPValue{Type: proto.BulkString, String: db.Retention().String()}
+		case 2:
+			policy, _, exists := db.KeyRetention(args[1])
+			if !exists {
+				return proto.RESPValue{Type: proto.BulkString, Null: true}
+			}
+			return proto.RESPValue{Type: proto.BulkString, String: policy.String()}
+		}
+
+	case "DEFAULT":
+		policy, err := parseRetentionArgs(args[1:])
+		if err != nil {
+			return proto.RESPValue{Type: proto.Error, String: err.Error()}
+		}
+		db.SetRetention(policy)
+		d.publishConfigEvent(configEvent{Event: "retention-default", Value: policy.String()})
+		return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
+
+	case "SET":
+		if len(args) < 3 {
+			break
+		}
+		policy, err := parseRetentionArgs(args[2:])
+		if err != nil {
+			return proto.RESPValue{Type: proto.Error, String: err.Error()}
+		}
+		if !db.SetKeyRetention(args[1], policy) {
+			return proto.RESPValue{Type: proto.Error, String: "ERR no such key"}
+		}
+		d.publishConfigEvent(configEvent{Event: "retention-set", Key: args[1], Value: policy.String()})
+		return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
+
+	case "RESET":
+		if len(args) != 2 {
+			break
+		}
+		if db.ResetKeyRetention(args[1]) {
+			d.publishConfigEvent(configEvent{Event: "retention-reset", Key: args[1]})
+			return proto.RESPValue{Type: proto.Integer, Int: 1}
+		}
+		return proto.RESPValue{Type: proto.Integer, Int: 0}
+
+	default:
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("ERR unknown subcommand '%s'", args[0]),
+		}
+	}
+
+	return proto.RESPValue{
+		Type:   proto.Error,
+		String: fmt.Sprintf("ERR wrong number of arguments for 'retention %s' command", strings.ToLower(args[0])),
+	}
+}
+
+// parseRetentionArgs parses COUNT n, AGE duration or ALL
+func parseRetentionArgs(args []string) (store.RetentionPolicy, error) {
+	if len(args) == 0 || len(args) > 2 {
+		return store.RetentionPolicy{}, fmt.Errorf("ERR syntax error, expected COUNT n, AGE duration or ALL")
+	}
+
+	spec := args[0]
+	if len(args) == 2 {
+		spec += ":" + args[1]
+	}
+	policy, err := store.ParseRetention(spec)
+	if err != nil {
+		return store.RetentionPolicy{}, fmt.Errorf("ERR %v", err)
+	}
+	return policy, nil
+}
@@ -0,0 +1,292 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/store"
+	"pulsedb/internal/wasm"
+)
+
+// scriptLockExempt commands do not take the isolation lock of the store,
+// which makes scripts atomic, see store.Shared: the scripting
+// commands take it themselves, and blocking reads would hold it while they
+// wait, so their reads are not isolated from scripts
+var scriptLockExempt = map[string]bool{
+	"CHANGES":    true,
+	"EVAL":       true,
+	"EVALSHA":    true,
+	"XREAD":      true,
+	"XREADGROUP": true,
+}
+
+// scriptForbidden commands may not be called from scripts: they run
+// scripts, block, or change the state of the connection
+var scriptForbidden = map[string]bool{
+	"EVAL":        true,
+	"EVALSHA":     true,
+	"SCRIPT":      true,
+	"XREAD":       true,
+	"XREADGROUP":  true,
+	"CHANGES":     true,
+	"SUBSCRIBE":   true,
+	"UNSUBSCRIBE": true,
+	"HELLO":       true,
+	"AUTH":        true,
+	"SELECT":      true,
+	"SNAPSHOT":    true,
+	"CLIENT":      true,
+}
+
+// SetScripting sets the runtime running the scripts of EVAL and EVALSHA,
+// enabling them and SCRIPT. Several listeners can share a runtime.
+func (s *Server) SetScripting(runtime *wasm.WASMRuntime) {
+	s.dispatcher.scripts = runtime
+	if runtime != nil {
+		s.dispatcher.store.EnableIsolation()
+	}
+}
+
+// lockScripts takes the isolation lock shared for a command, unless
+// scripting is disabled, the command is exempt, or it runs within a
+// script, which holds the lock already. It returns the function releasing
+// the lock.
+func (d *CommandDispatcher) lockScripts(client *Client, cmd string) func() {
+	if d.scripts == nil || client.inScript || scriptLockExempt[cmd] {
+		return func() {}
+	}
+	return d.store.Shared()
+}
+
+// scriptsDisabled is the reply of the scripting commands without a runtime
+var scriptsDisabled = proto.RESPValue{
+	Type:   proto.Error,
+	String: "ERR scripting is disabled, start the server with --wasm-dir",
+}
+
+// handleEval runs a script: EVAL script numkeys [key ...] [arg ...]. The
+// script is a WASM module, cached under its SHA1 digest for EVALSHA.
+func (d *CommandDispatcher) handleEval(c *Client, args []string) proto.RESPValue {
+	if len(args) < 2 {
+		return proto.RESPValue{Type: proto.Error, String: "ERR wrong number of arguments for 'eval' command"}
+	}
+	if d.scripts == nil {
+		return scriptsDisabled
+	}
+
+	sha, err := d.scripts.LoadScript(context.Background(), []byte(args[0]))
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: "ERR Error compiling script: " + err.Error()}
+	}
+	return d.runScript(c, sha, args[1:])
+}
+
+// handleEvalSHA runs a cached script: EVALSHA sha1 numkeys [key ...] [arg ...]
+func (d *CommandDispatcher) handleEvalSHA(c *Client, args []string) proto.RESPValue {
+	if len(args) < 2 {
+		return proto.RESPValue{Type: proto.Error, String: "ERR wrong number of arguments for 'evalsha' command"}
+	}
+	if d.scripts == nil {
+		return scriptsDisabled
+	}
+	return d.runScript(c, args[0], args[1:])
+}
+
+// runScript binds the keys and arguments of a script and runs it under the
+// isolation lock held exclusively
+func (d *CommandDispatcher) runScript(c *Client, sha string, args []string) proto.RESPValue {
+	numKeys, err := strconv.Atoi(args[0])
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: "ERR value is not an integer or out of range"}
+	}
+	if numKeys < 0 {
+		return proto.RESPValue{Type: proto.Error, String: "ERR Number of keys can't be negative"}
+	}
+	if numKeys > len(args)-1 {
+		return proto.RESPValue{Type: proto.Error, String: "ERR Number of keys can't be greater than number of args"}
+	}
+	keys, argv := args[1:1+numKeys], args[1+numKeys:]
+
+	release := d.store.Exclusive()
+	c.inScript = true
+	defer func() {
+		c.inScript = false
+		release()
+	}()
+
+	output, err := d.scripts.RunScript(context.Background(), sha, keys, argv, func(command []string) []byte {
+		return d.callFromScript(c, command)
+	})
+	if errors.Is(err, wasm.ErrNoScript) {
+		return proto.RESPValue{Type: proto.Error, String: "NOSCRIPT No matching script. Please use EVAL."}
+	}
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: fmt.Sprintf("ERR Error running script %s: %s", sha, err)}
+	}
+	if output == nil {
+		return proto.RESPValue{Type: proto.BulkString, Null: true}
+	}
+
+	var reply any
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	decoder.UseNumber()
+	if err := decoder.Decode(&reply); err != nil {
+		return proto.RESPValue{Type: proto.Error, String: fmt.Sprintf("ERR script %s returned an invalid reply", sha)}
+	}
+	return scriptReply(reply)
+}
+
+// callFromScript dispatches a command of a script as the client running
+// it, and returns its reply as JSON
+func (d *CommandDispatcher) callFromScript(c *Client, command []string) []byte {
+	var reply proto.RESPValue
+	if scriptForbidden[strings.ToUpper(command[0])] {
+		reply = proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("ERR '%s' is not allowed from scripts", command[0]),
+		}
+	} else {
+		reply = d.Dispatch(c, bulkStringArray(command))
+	}
+
+	encoded, err := json.Marshal(scriptValue(reply))
+	if err != nil {
+		encoded, _ = json.Marshal(map[string]string{"err": "ERR " + err.Error()})
+	}
+	return encoded
+}
+
+// scriptValue converts a command reply for a script: errors become
+// {"err": message} and simple strings {"ok": status}, integers and doubles
+// numbers, bulk strings strings, aggregates arrays, with maps flattened as
+// in RESP2, and nulls null
+func scriptValue(v proto.RESPValue) any {
+	if v.Null {
+		return nil
+	}
+	switch v.Type {
+	case proto.Error:
+		return map[string]string{"err": v.String}
+	case proto.SimpleString:
+		return map[string]string{"ok": v.String}
+	case proto.Integer:
+		return v.Int
+	case proto.Double:
+		if math.IsInf(v.Float, 0) || math.IsNaN(v.Float) {
+			return strconv.FormatFloat(v.Float, 'g', -1, 64)
+		}
+		return v.Float
+	case proto.Boolean:
+		return v.Bool
+	case proto.Array, proto.Map, proto.Set, proto.Push:
+		items := make([]any, len(v.Array))
+		for i, item := range v.Array {
+			items[i] = scriptValue(item)
+		}
+		return items
+	default:
+		return v.String
+	}
+}
+
+// scriptReply converts the reply of a script, as in Redis: strings become
+// bulk strings, numbers integers, truncated, true 1 and false or null a
+// null reply, arrays arrays, and {"err": message} and {"ok": status} an
+// error and a status reply
+func scriptReply(v any) proto.RESPValue {
+	switch v := v.(type) {
+	case string:
+		return proto.RESPValue{Type: proto.BulkString, String: v}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return proto.RESPValue{Type: proto.Integer, Int: n}
+		}
+		f, _ := v.Float64()
+		return proto.RESPValue{Type: proto.Integer, Int: int64(f)}
+	case bool:
+		if v {
+			return proto.RESPValue{Type: proto.Integer, Int: 1}
+		}
+		return proto.RESPValue{Type: proto.BulkString, Null: true}
+	case []any:
+		items := make([]proto.RESPValue, len(v))
+		for i, item := range v {
+			items[i] = scriptReply(item)
+		}
+		return proto.RESPValue{Type: proto.Array, Array: items}
+	case map[string]any:
+		if msg, ok := v["err"].(string); ok {
+			return proto.RESPValue{Type: proto.Error, String: msg}
+		}
+		if status, ok := v["ok"].(string); ok {
+			return proto.RESPValue{Type: proto.SimpleString, String: status}
+		}
+		return proto.RESPValue{Type: proto.Error, String: "ERR script returned an object without err or ok"}
+	default:
+		return proto.RESPValue{Type: proto.BulkString, Null: true}
+	}
+}
+
+// handleScript manages the script cache:
+//
+//	SCRIPT LOAD script
+//	SCRIPT EXISTS sha1 [sha1 ...]
+//	SCRIPT FLUSH
+func (d *CommandDispatcher) handleScript(db *store.Store, args []string) proto.RESPValue {
+	if len(args) == 0 {
+		return proto.RESPValue{Type: proto.Error, String: "ERR wrong number of arguments for 'script' command"}
+	}
+	if d.scripts == nil {
+		return scriptsDisabled
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "LOAD":
+		if len(args) != 2 {
+			break
+		}
+		sha, err := d.scripts.LoadScript(context.Background(), []byte(args[1]))
+		if err != nil {
+			return proto.RESPValue{Type: proto.Error, String: "ERR Error compiling script: " + err.Error()}
+		}
+		return proto.RESPValue{Type: proto.BulkString, String: sha}
+
+	case "EXISTS":
+		if len(args) < 2 {
+			break
+		}
+		result := make([]proto.RESPValue, len(args)-1)
+		for i, sha := range args[1:] {
+			result[i] = proto.RESPValue{Type: proto.Integer}
+			if d.scripts.ScriptExists(sha) {
+				result[i].Int = 1
+			}
+		}
+		return proto.RESPValue{Type: proto.Array, Array: result}
+
+	case "FLUSH":
+		if len(args) != 1 {
+			break
+		}
+		d.scripts.FlushScripts(context.Background())
+		return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
+
+	default:
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("ERR unknown subcommand '%s'", args[0]),
+		}
+	}
+
+	return proto.RESPValue{
+		Type:   proto.Error,
+		String: fmt.Sprintf("ERR wrong number of arguments for 'script %s' command", strings.ToLower(args[0])),
+	}
+}
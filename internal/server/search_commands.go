@@ -0,0 +1,136 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/store"
+)
+
+// handleFTCreate creates a full-text index:
+//
+//	FT.CREATE index ON pattern [PATH path [path ...]]
+func (d *CommandDispatcher) handleFTCreate(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 3 || strings.ToUpper(args[1]) != "ON" {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR syntax error, expected FT.CREATE index ON pattern [PATH path ...]",
+		}
+	}
+
+	var paths []string
+	if len(args) > 3 {
+		if strings.ToUpper(args[3]) != "PATH" || len(args) == 4 {
+			return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+		}
+		paths = args[4:]
+	}
+
+	if err := db.CreateIndex(args[0], args[2], paths); err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
+}
+
+// handleFTSearch searches a full-text index. The reply is the number of
+// matches followed by the matching keys, each with its value unless
+// NOCONTENT is given:
+//
+//	FT.SEARCH index query [NOCONTENT] [LIMIT offset count]
+func (d *CommandDispatcher) handleFTSearch(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'ft.search' command",
+		}
+	}
+
+	noContent := false
+	offset, count := 0, 10
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NOCONTENT":
+			noContent = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+			}
+			var err1, err2 error
+			offset, err1 = strconv.Atoi(args[i+1])
+			count, err2 = strconv.Atoi(args[i+2])
+			if err1 != nil || err2 != nil || offset < 0 || count < 0 {
+				return proto.RESPValue{Type: proto.Error, String: "ERR value is not a valid limit"}
+			}
+			i += 2
+		default:
+			return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+		}
+	}
+
+	keys, err := db.Search(args[0], args[1])
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+
+	result := []proto.RESPValue{{Type: proto.Integer, Int: int64(len(keys))}}
+	if offset > len(keys) {
+		offset = len(keys)
+	}
+	page := keys[offset:]
+	if count < len(page) {
+		page = page[:count]
+	}
+
+	for _, key := range page {
+		result = append(result, proto.RESPValue{Type: proto.BulkString, String: key})
+		if noContent {
+			continue
+		}
+		value, exists, _ := db.Get(key)
+		if !exists {
+			result = append(result, proto.RESPValue{Type: proto.BulkString, Null: true})
+			continue
+		}
+		result = append(result, proto.RESPValue{Type: proto.BulkString, String: value})
+	}
+
+	return proto.RESPValue{Type: proto.Array, Array: result}
+}
+
+func (d *CommandDispatcher) handleFTDropIndex(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 1 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'ft.dropindex' command",
+		}
+	}
+
+	if !db.DropIndex(args[0]) {
+		return proto.RESPValue{Type: proto.Error, String: "ERR no such index"}
+	}
+	return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
+}
+
+// handleFTList lists the full-text indexes with their pattern, paths and
+// number of indexed keys
+func (d *CommandDispatcher) handleFTList(db *store.Store, args []string) proto.RESPValue {
+	indexes := db.Indexes()
+	result := make([]proto.RESPValue, len(indexes))
+	for i, ix := range indexes {
+		result[i] = proto.RESPValue{
+			Type: proto.Map,
+			Array: []proto.RESPValue{
+				{Type: proto.BulkString, String: "name"},
+				{Type: proto.BulkString, String: ix.Name},
+				{Type: proto.BulkString, String: "pattern"},
+				{Type: proto.BulkString, String: ix.Pattern},
+				{Type: proto.BulkString, String: "paths"},
+				bulkStringArray(ix.Paths),
+				{Type: proto.BulkString, String: "docs"},
+				{Type: proto.Integer, Int: int64(ix.Docs())},
+			},
+		}
+	}
+	return proto.RESPValue{Type: proto.Array, Array: result}
+}
@@ -1,40 +1,306 @@
 package server
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"pulsedb/internal/info"
+	"pulsedb/internal/metrics"
 	"pulsedb/internal/proto"
+	"pulsedb/internal/pubsub"
+	"pulsedb/internal/slowlog"
 	"pulsedb/internal/store"
+	"pulsedb/internal/streams"
+	"pulsedb/internal/throttle"
 )
 
+// DefaultIdleTimeout is how long a connection may stay idle before it is closed
+const DefaultIdleTimeout = 30 * time.Second
+
 // Server represents the TCP server
 type Server struct {
-	store      *store.Store
-	dispatcher *CommandDispatcher
+	store       *store.Store
+	metrics     *metrics.Metrics
+	dispatcher  *CommandDispatcher
+	limits      proto.Limits
+	readers     *proto.ReaderPool
+	memoryLimit int64         // Bytes per request or reply, 0 means unlimited
+	maxClients  int           // 0 means unlimited
+	idleTimeout time.Duration // 0 means connections never time out
+	sockopts    SocketOptions
+
+	outputLimits proto.OutputLimits // Replies queued for slow clients
+
+	// Connections served by Serve, drained on shutdown
+	conns          sync.WaitGroup
+	draining       atomic.Bool
+	drainTimeout   time.Duration
+	shutdownNotice bool // Send -SHUTDOWN to connections closed by a drain
 }
 
 // NewServer creates a new server instance
-func NewServer(store *store.Store, metrics interface{}) *Server {
+func NewServer(store *store.Store, metrics *metrics.Metrics) *Server {
 	return &Server{
-		store:      store,
-		dispatcher: NewCommandDispatcher(store, metrics),
+		store:        store,
+		metrics:      metrics,
+		dispatcher:   NewCommandDispatcher(store, metrics),
+		limits:       proto.DefaultLimits,
+		readers:      proto.NewReaderPool(),
+		idleTimeout:  DefaultIdleTimeout,
+		sockopts:     DefaultSocketOptions,
+		outputLimits: proto.DefaultOutputLimits,
+		drainTimeout: DefaultDrainTimeout,
+	}
+}
+
+// SetSlowLog sets the log recording slow commands, so several listeners
+// can share one log
+func (s *Server) SetSlowLog(log *slowlog.Log) {
+	s.dispatcher.slowlog = log
+}
+
+// SetAccessLog logs every command the listener runs to logger, with its
+// client, latency and result; nil disables the access log
+func (s *Server) SetAccessLog(logger *slog.Logger) {
+	s.dispatcher.accessLog = logger
+}
+
+// SetStats sets the counters reported by INFO, so several listeners can
+// share them
+func (s *Server) SetStats(stats *info.Stats) {
+	s.dispatcher.stats = stats
+}
+
+// SetThrottle sets the limiter enforcing namespace bandwidth quotas, so
+// several listeners can share the same quotas
+func (s *Server) SetThrottle(limiter *throttle.Limiter) {
+	s.dispatcher.throttle = limiter
+}
+
+// SetRESP2Compat makes the listener reply to RESP3 connections with the
+// RESP2 encoding, for clients that negotiate RESP3 but parse replies the
+// RESP2 way
+func (s *Server) SetRESP2Compat(enabled bool) {
+	s.dispatcher.resp2Compat.Store(enabled)
+}
+
+// SetStreams sets the streams ARCHIVE writes to and reads from, so several
+// listeners see the same archives
+func (s *Server) SetStreams(sm *streams.StreamManager) {
+	s.dispatcher.streams = sm
+}
+
+// SetPubSub sets the broker routing PUBLISH and configuration events, so
+// subscribers on every listener see them
+func (s *Server) SetPubSub(broker *pubsub.Broker) {
+	s.dispatcher.pubsub = broker
+}
+
+// SetSocketOptions sets the options applied to accepted TCP connections
+func (s *Server) SetSocketOptions(opts SocketOptions) {
+	s.sockopts = opts
+}
+
+// SetMaxClients limits the number of concurrent connections (0 means unlimited)
+func (s *Server) SetMaxClients(max int) {
+	s.maxClients = max
+}
+
+// SetIdleTimeout closes connections idle for longer than timeout
+// (0 disables the timeout)
+func (s *Server) SetIdleTimeout(timeout time.Duration) {
+	s.idleTimeout = timeout
+}
+
+// SetLimits sets the protocol limits enforced on client requests
+func (s *Server) SetLimits(limits proto.Limits) {
+	s.limits = limits
+}
+
+// SetReaderPool sets the pool connection readers are taken from, so
+// several listeners can share buffers
+func (s *Server) SetReaderPool(pool *proto.ReaderPool) {
+	s.readers = pool
+}
+
+// SetClientMemoryLimit caps the memory one connection may use for a request
+// or a reply (0 means unlimited). Larger requests close the connection with
+// a protocol error; larger replies are replaced with an error.
+func (s *Server) SetClientMemoryLimit(bytes int64) {
+	s.memoryLimit = bytes
+}
+
+// SetOutputLimits bounds the replies and messages queued for clients that
+// read them too slowly; clients over their limit are disconnected
+func (s *Server) SetOutputLimits(limits proto.OutputLimits) {
+	s.outputLimits = limits
+}
+
+// AllowCommands restricts the commands served by this server.
+// An empty list exposes every command.
+func (s *Server) AllowCommands(names []string) {
+	s.dispatcher.AllowCommands(names)
+}
+
+// Start listens on addr and serves RESP connections until ctx is cancelled
+func (s *Server) Start(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
 	}
+	return s.Serve(ctx, listener)
 }
 
-// HandleConnection handles a client connection
+// StartUnix listens on a unix domain socket at path and serves RESP
+// connections until ctx is cancelled
+func (s *Server) StartUnix(ctx context.Context, path string) error {
+	// Remove a stale socket left behind by a previous run
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	return s.Serve(ctx, listener)
+}
+
+// Serve accepts connections on listener until ctx is cancelled, then stops
+// accepting and drains the open connections before returning
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	// Accept connections in a separate goroutine
+	accepting := make(chan struct{})
+	go func() {
+		defer close(accepting)
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				select {
+				case <-ctx.Done():
+					return
+				default:
+					slog.Error("Failed to accept connection", "error", err)
+					continue
+				}
+			}
+
+			s.conns.Add(1)
+			go func() {
+				defer s.conns.Done()
+				s.HandleConnection(conn)
+			}()
+		}
+	}()
+
+	// Wait for context cancellation
+	<-ctx.Done()
+	listener.Close()
+	<-accepting
+
+	s.drain()
+	return nil
+}
+
+// HandleConnection handles a client connection. Responses are buffered and
+// only flushed once every pipelined request already received has been
+// processed, so a batch of commands costs a single write. Flushed output is
+// queued for a writer goroutine, bounded by the output limit of the class
+// of the client, so a client reading slowly cannot stall its commands.
 func (s *Server) HandleConnection(conn net.Conn) {
 	defer conn.Close()
 
-	reader := proto.NewRESPReader(conn)
-	writer := proto.NewRESPWriter(conn)
+	client := newConnClient(conn)
+	out := proto.NewOutputBuffer(conn, s.outputLimits.Normal)
+	client.output = out
+	class := "normal"
+	defer func() { s.closeOutput(client, out, class) }()
+
+	if !s.dispatcher.clients.add(client, s.maxClients) {
+		s.dispatcher.stats.ConnectionRejected()
+		conn.Write([]byte("-ERR max number of clients reached\r\n"))
+		return
+	}
+	defer s.dispatcher.clients.remove(client)
+
+	s.metrics.ConnectionOpened()
+	defer s.metrics.ConnectionClosed()
+	s.dispatcher.stats.ConnectionOpened()
+	defer s.dispatcher.stats.ConnectionClosed()
+
+	if accessLog := s.dispatcher.accessLog; accessLog != nil {
+		opened := time.Now()
+		accessLog.Info("connection opened", "client", client.Addr)
+		defer func() {
+			accessLog.Info("connection closed", "client", client.Addr, "duration", time.Since(opened))
+		}()
+	}
+
+	if err := s.sockopts.apply(conn); err != nil {
+		slog.Warn("Failed to set socket options", "client", client.Addr, "error", err)
+	}
+	client.quickAck.Store(s.sockopts.QuickAck)
+
+	reader, reused := s.readers.Get(conn)
+	defer s.readers.Put(reader)
+	s.metrics.ObserveReaderPool(reused, s.readers.BufferSize())
+
+	limits := s.limits
+	if s.memoryLimit > 0 {
+		limits.MaxRequestSize = min(limits.MaxRequestSize, s.memoryLimit)
+	}
+	reader.SetLimits(limits)
+	buffered := bufio.NewWriter(out)
+	writer := proto.NewRESPWriter(buffered)
+	writer.SetMaxSize(int(s.memoryLimit))
+
+	// Messages are pushed by their own goroutine once the client subscribes
+	done := make(chan struct{})
+	defer close(done)
+	defer func() {
+		if client.subscriber != nil {
+			s.dispatcher.pubsub.UnsubscribeAll(client.subscriber)
+		}
+	}()
 
 	for {
-		// Set read timeout
-		conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+		// Close idle connections; subscribers wait for messages, not requests
+		if s.idleTimeout > 0 && !client.subscribed() {
+			conn.SetReadDeadline(time.Now().Add(s.idleTimeout))
+		} else {
+			conn.SetReadDeadline(time.Time{})
+		}
+
+		// A draining server finishes the commands already received, then
+		// closes. The check follows the deadline update so it cannot undo
+		// the drain interrupting a blocked read.
+		if s.draining.Load() && reader.Buffered() == 0 {
+			s.closeForShutdown(client, writer, buffered)
+			return
+		}
 
 		value, err := reader.Read()
 		if err != nil {
+			if s.draining.Load() {
+				s.closeForShutdown(client, writer, buffered)
+				return
+			}
+			// Report protocol errors before dropping the connection, since
+			// the stream cannot be resynchronised
+			var protoErr *proto.ProtocolError
+			if errors.As(err, &protoErr) {
+				writer.WriteError("ERR " + protoErr.Error())
+				buffered.Flush()
+				return
+			}
 			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
 				// Timeout, close connection
 				return
@@ -43,12 +309,110 @@ func (s *Server) HandleConnection(conn net.Conn) {
 			return
 		}
 
+		// Quick-ack mode is left by the kernel, so re-arm it after each read
+		if client.quickAck.Load() {
+			if tcp, ok := conn.(*net.TCPConn); ok {
+				setQuickAck(tcp, true)
+			}
+		}
+
 		// Process command
-		response := s.dispatcher.Dispatch(value)
+		subscriber := client.subscriber
+		response := s.dispatcher.Dispatch(client, value)
+
+		client.writeMu.Lock()
+		err = s.writeReply(client, writer, response)
+		for _, extra := range client.extraReplies {
+			if err == nil {
+				err = s.writeReply(client, writer, extra)
+			}
+		}
+		client.extraReplies = nil
+
+		// Flush once the pipeline is drained; a client that killed itself
+		// is closed after its reply
+		if err == nil && (client.killed.Load() || reader.Buffered() == 0) {
+			err = buffered.Flush()
+		}
+		client.writeMu.Unlock()
+		if err != nil || client.killed.Load() {
+			return
+		}
+
+		// The first SUBSCRIBE starts the message writer
+		if subscriber == nil && client.subscriber != nil {
+			go s.pushMessages(client, writer, buffered, done)
+		}
+
+		// Subscribers fall under the pubsub output limit
+		if subscribed := client.subscribed(); subscribed != (class == "pubsub") {
+			class = "normal"
+			limit := s.outputLimits.Normal
+			if subscribed {
+				class, limit = "pubsub", s.outputLimits.PubSub
+			}
+			out.SetLimit(limit)
+		}
+	}
+}
+
+// closeOutput writes out the output still queued for a closing connection,
+// waiting at most the drain timeout for a slow client, and records the
+// eviction of a client over its output limit
+func (s *Server) closeOutput(client *Client, out *proto.OutputBuffer, class string) {
+	client.conn.SetWriteDeadline(time.Now().Add(s.drainTimeout))
+	if errors.Is(out.Close(), proto.ErrOutputLimit) {
+		slog.Warn("Disconnected a client over its output buffer limit", "client", client.Addr, "class", class)
+		s.metrics.IncrementOutputEvictions(class)
+	}
+}
 
-		// Write response
-		if err := writer.WriteValue(response); err != nil {
+// closeForShutdown sends the shutdown notice, if enabled, to a connection
+// closed by a drain
+func (s *Server) closeForShutdown(client *Client, writer *proto.RESPWriter, buffered *bufio.Writer) {
+	if !s.shutdownNotice {
+		return
+	}
+	client.writeMu.Lock()
+	defer client.writeMu.Unlock()
+	if s.writeReply(client, writer, shutdownReply) == nil {
+		buffered.Flush()
+	}
+}
+
+// writeReply writes response in the protocol negotiated by HELLO
+func (s *Server) writeReply(client *Client, writer *proto.RESPWriter, response proto.RESPValue) error {
+	writer.SetProtocol(s.dispatcher.replyProtocol(client))
+	err := writer.WriteValue(response)
+	if err == proto.ErrReplyTooLarge {
+		s.metrics.IncrementRepliesTooLarge()
+		err = writer.WriteError(fmt.Sprintf("ERR reply exceeds the client memory limit of %d bytes", s.memoryLimit))
+	}
+	return err
+}
+
+// pushMessages writes the messages published to the client's channels until
+// the connection is done, flushing once no more are queued
+func (s *Server) pushMessages(client *Client, writer *proto.RESPWriter, buffered *bufio.Writer, done <-chan struct{}) {
+	messages := client.subscriber.Messages()
+	for {
+		select {
+		case <-done:
 			return
+		case msg := <-messages:
+			client.writeMu.Lock()
+			err := s.writeReply(client, writer, messageReply(msg))
+			for err == nil && len(messages) > 0 {
+				err = s.writeReply(client, writer, messageReply(<-messages))
+			}
+			if err == nil {
+				err = buffered.Flush()
+			}
+			client.writeMu.Unlock()
+			if err != nil {
+				client.kill(nil)
+				return
+			}
 		}
 	}
 }
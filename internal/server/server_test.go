@@ -0,0 +1,2593 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"pulsedb/internal/apikeys"
+	"pulsedb/internal/info"
+	"pulsedb/internal/latency"
+	"pulsedb/internal/proto"
+	"pulsedb/internal/pubsub"
+	"pulsedb/internal/slowlog"
+	"pulsedb/internal/store"
+	"pulsedb/internal/streams"
+	"pulsedb/internal/wasm"
+)
+
+func TestHandleConnectionPipelining(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	srv := NewServer(db, nil)
+	client, serverConn := net.Pipe()
+	defer client.Close()
+
+	go srv.HandleConnection(serverConn)
+
+	// Send several commands in a single write
+	pipeline := "*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\n1\r\n" +
+		"*2\r\n$3\r\nGET\r\n$1\r\na\r\n" +
+		"*1\r\n$4\r\nPING\r\n"
+	go client.Write([]byte(pipeline))
+
+	reader := proto.NewRESPReader(client)
+	expected := []proto.RESPValue{
+		{Type: proto.SimpleString, String: "OK"},
+		{Type: proto.BulkString, String: "1"},
+		{Type: proto.SimpleString, String: "PONG"},
+	}
+
+	for i, want := range expected {
+		got, err := reader.Read()
+		if err != nil {
+			t.Fatalf("Failed to read response %d: %v", i, err)
+		}
+		if got.Type != want.Type || got.String != want.String {
+			t.Errorf("Response %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+}
+
+func TestSetOptions(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	if reply := d.Dispatch(client, command("SET", "k", "v1", "XX")); !reply.Null {
+		t.Errorf("Expected XX on a missing key to reply null, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("SET", "k", "v1", "NX", "EX", "100")); reply.String != "OK" {
+		t.Errorf("Unexpected SET NX reply %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("SET", "k", "v2", "KEEPTTL", "GET")); reply.String != "v1" {
+		t.Errorf("Expected GET to return v1, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("TTL", "k")); reply.Int <= 0 {
+		t.Errorf("Expected KEEPTTL to keep the TTL, got %+v", reply)
+	}
+	for _, args := range [][]string{{"NX", "XX"}, {"EX", "10", "KEEPTTL"}, {"PX"}} {
+		cmd := command(append([]string{"SET", "k", "v"}, args...)...)
+		if reply := d.Dispatch(client, cmd); reply.Type != proto.Error {
+			t.Errorf("Expected SET %v to be rejected, got %+v", args, reply)
+		}
+	}
+}
+
+func TestGetAndMutate(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	if reply := d.Dispatch(client, command("GETSET", "k", "v1")); !reply.Null {
+		t.Errorf("Expected GETSET on a missing key to reply null, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("GETSET", "k", "v2")); reply.String != "v1" {
+		t.Errorf("Expected v1, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("GETEX", "k", "EX", "100")); reply.String != "v2" {
+		t.Errorf("Expected v2, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("TTL", "k")); reply.Int <= 0 {
+		t.Errorf("Expected GETEX to set a TTL, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("GETEX", "k", "PERSIST", "1")); reply.Type != proto.Error {
+		t.Errorf("Expected a syntax error, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("GETDEL", "k")); reply.String != "v2" {
+		t.Errorf("Expected v2, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("EXISTS", "k")); reply.Int != 0 {
+		t.Errorf("Expected GETDEL to delete the key, got %+v", reply)
+	}
+}
+
+func TestStringCommands(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	if reply := d.Dispatch(client, command("APPEND", "rec", "abc")); reply.Int != 3 {
+		t.Errorf("Expected length 3, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("SETRANGE", "rec", "1", "XY")); reply.Int != 3 {
+		t.Errorf("Expected length 3, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("GETRANGE", "rec", "0", "-1")); reply.String != "aXY" {
+		t.Errorf("Expected aXY, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("STRLEN", "missing")); reply.Int != 0 {
+		t.Errorf("Expected 0 for a missing key, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("SETRANGE", "rec", "-1", "x")); reply.Type != proto.Error {
+		t.Errorf("Expected a negative offset to be rejected, got %+v", reply)
+	}
+}
+
+func TestDispatcherAllowCommands(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	d.AllowCommands([]string{"get", "PING"})
+	client := NewClient()
+
+	reply := d.Dispatch(client, command("PING"))
+	if reply.Type != proto.SimpleString || reply.String != "PONG" {
+		t.Errorf("Expected PING to be allowed, got %+v", reply)
+	}
+
+	reply = d.Dispatch(client, command("SET", "k", "v"))
+	if reply.Type != proto.Error || !strings.HasPrefix(reply.String, "NOPERM") {
+		t.Errorf("Expected SET to be rejected, got %+v", reply)
+	}
+
+	d.AllowCommands(nil)
+	if reply := d.Dispatch(client, command("SET", "k", "v")); reply.String != "OK" {
+		t.Errorf("Expected SET to be allowed after clearing the whitelist, got %+v", reply)
+	}
+}
+
+func TestHandleConnectionHello(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	srv := NewServer(db, nil)
+	client, serverConn := net.Pipe()
+	defer client.Close()
+
+	go srv.HandleConnection(serverConn)
+
+	db.Set("k", "v", 0)
+	requests := "*2\r\n$5\r\nHELLO\r\n$1\r\n3\r\n" +
+		"*2\r\n$4\r\nHIST\r\n$1\r\nk\r\n" +
+		"*2\r\n$3\r\nGET\r\n$7\r\nmissing\r\n" +
+		"*2\r\n$5\r\nHELLO\r\n$1\r\n4\r\n"
+	go client.Write([]byte(requests))
+
+	reader := proto.NewRESPReader(client)
+
+	hello, err := reader.Read()
+	if err != nil || hello.Type != proto.Map {
+		t.Fatalf("Expected HELLO to reply with a map, got %+v (%v)", hello, err)
+	}
+	if hello.Array[5].Int != 3 {
+		t.Errorf("Expected proto 3, got %+v", hello.Array[5])
+	}
+
+	hist, err := reader.Read()
+	if err != nil || hist.Type != proto.Array || len(hist.Array) != 1 || hist.Array[0].Array[1].String != "v" {
+		t.Errorf("Expected HIST to reply with one entry, got %+v (%v)", hist, err)
+	}
+
+	missing, err := reader.Read()
+	if err != nil || missing.Type != proto.Null {
+		t.Errorf("Expected RESP3 null, got %+v (%v)", missing, err)
+	}
+
+	unsupported, err := reader.Read()
+	if err != nil || unsupported.Type != proto.Error || !strings.HasPrefix(unsupported.String, "NOPROTO") {
+		t.Errorf("Expected NOPROTO error, got %+v (%v)", unsupported, err)
+	}
+}
+
+func TestHandleConnectionProtocolError(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	srv := NewServer(db, nil)
+	limits := proto.DefaultLimits
+	limits.MaxBulkLength = 8
+	srv.SetLimits(limits)
+
+	client, serverConn := net.Pipe()
+	defer client.Close()
+
+	go srv.HandleConnection(serverConn)
+	go client.Write([]byte("*2\r\n$3\r\nGET\r\n$1000000\r\n"))
+
+	reply, err := proto.NewRESPReader(client).Read()
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	if reply.Type != proto.Error || !strings.HasPrefix(reply.String, "ERR Protocol error") {
+		t.Errorf("Expected protocol error, got %+v", reply)
+	}
+}
+
+func TestHandleConnectionMemoryLimit(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	srv := NewServer(db, nil)
+	srv.SetClientMemoryLimit(64)
+	db.Set("large", strings.Repeat("a", 100), 0)
+
+	client, serverConn := net.Pipe()
+	defer client.Close()
+
+	go srv.HandleConnection(serverConn)
+	reader := proto.NewRESPReader(client)
+
+	// Replies over the limit are refused without closing the connection
+	go client.Write([]byte("*2\r\n$3\r\nGET\r\n$5\r\nlarge\r\n*1\r\n$4\r\nPING\r\n"))
+	reply, err := reader.Read()
+	if err != nil || reply.Type != proto.Error || !strings.Contains(reply.String, "client memory limit") {
+		t.Errorf("Expected the reply to be refused, got %+v (%v)", reply, err)
+	}
+	if reply, err := reader.Read(); err != nil || reply.String != "PONG" {
+		t.Errorf("Expected PONG, got %+v (%v)", reply, err)
+	}
+
+	// Requests over the limit are a protocol error
+	go client.Write([]byte("*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$100\r\n" + strings.Repeat("a", 100) + "\r\n"))
+	reply, err = reader.Read()
+	if err != nil || !strings.HasPrefix(reply.String, "ERR Protocol error") {
+		t.Errorf("Expected a protocol error, got %+v (%v)", reply, err)
+	}
+}
+
+func TestClientCommands(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	srv := NewServer(db, nil)
+	srv.SetMaxClients(2)
+
+	first, firstServer := net.Pipe()
+	defer first.Close()
+	second, secondServer := net.Pipe()
+	defer second.Close()
+	third, thirdServer := net.Pipe()
+	defer third.Close()
+
+	go srv.HandleConnection(firstServer)
+	go srv.HandleConnection(secondServer)
+
+	firstReader := proto.NewRESPReader(first)
+	secondReader := proto.NewRESPReader(second)
+	roundTrip := func(conn net.Conn, reader *proto.RESPReader, args ...string) proto.RESPValue {
+		encoded, _ := proto.Encode(command(args...))
+		go conn.Write(encoded)
+		reply, err := reader.Read()
+		if err != nil {
+			t.Fatalf("Failed to read reply to %v: %v", args, err)
+		}
+		return reply
+	}
+
+	roundTrip(first, firstReader, "CLIENT", "SETNAME", "worker")
+	secondID := roundTrip(second, secondReader, "CLIENT", "ID").Int
+
+	list := roundTrip(first, firstReader, "CLIENT", "LIST").String
+	if strings.Count(list, "\n") != 2 || !strings.Contains(list, "name=worker") {
+		t.Errorf("Unexpected CLIENT LIST output %q", list)
+	}
+
+	// A third connection is over the limit
+	go srv.HandleConnection(thirdServer)
+	if reply, _ := proto.NewRESPReader(third).Read(); !strings.Contains(reply.String, "max number of clients") {
+		t.Errorf("Expected max clients error, got %+v", reply)
+	}
+
+	killed := roundTrip(first, firstReader, "CLIENT", "KILL", "ID", strconv.FormatInt(secondID, 10))
+	if killed.Int != 1 {
+		t.Errorf("Expected one client killed, got %+v", killed)
+	}
+	if _, err := secondReader.Read(); err == nil {
+		t.Error("Expected killed connection to be closed")
+	}
+}
+
+func TestClientSocketOptions(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	srv := NewServer(db, nil)
+	srv.SetSocketOptions(SocketOptions{NoDelay: false, SendBuffer: 64 * 1024, QuickAck: quickAckSupported})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.Serve(ctx, listener)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	reader := proto.NewRESPReader(conn)
+
+	requests := [][]string{{"CLIENT", "NODELAY", "ON"}}
+	if quickAckSupported {
+		requests = append(requests, []string{"CLIENT", "QUICKACK", "OFF"})
+	}
+	for _, args := range requests {
+		encoded, _ := proto.Encode(command(args...))
+		conn.Write(encoded)
+		if reply, err := reader.Read(); err != nil || reply.String != "OK" {
+			t.Errorf("Expected OK for %v, got %+v (%v)", args, reply, err)
+		}
+	}
+
+	// Non-TCP connections have no socket options to tune
+	d := NewCommandDispatcher(db, nil)
+	if reply := d.Dispatch(NewClient(), command("CLIENT", "NODELAY", "ON")); reply.Type != proto.Error {
+		t.Errorf("Expected error without a TCP connection, got %+v", reply)
+	}
+}
+
+func TestServeDrain(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	srv := NewServer(db, nil)
+	srv.SetShutdownNotice(true)
+	srv.SetDrainTimeout(5 * time.Second)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan struct{})
+	go func() {
+		srv.Serve(ctx, listener)
+		close(served)
+	}()
+
+	idle, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer idle.Close()
+	idleReader := proto.NewRESPReader(idle)
+	ping, _ := proto.Encode(command("PING"))
+	idle.Write(ping)
+	if reply, err := idleReader.Read(); err != nil || reply.String != "PONG" {
+		t.Fatalf("Unexpected reply %+v (%v)", reply, err)
+	}
+
+	// Commands already sent are answered before the connection closes
+	busy, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer busy.Close()
+	busyReader := proto.NewRESPReader(busy)
+	var pipeline []byte
+	for i := 0; i < 100; i++ {
+		encoded, _ := proto.Encode(command("SET", "k"+strconv.Itoa(i), "v"))
+		pipeline = append(pipeline, encoded...)
+	}
+	busy.Write(pipeline)
+	if reply, err := busyReader.Read(); err != nil || reply.String != "OK" {
+		t.Fatalf("Unexpected reply %+v (%v)", reply, err)
+	}
+
+	start := time.Now()
+	cancel()
+	select {
+	case <-served:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected Serve to return once its connections drained")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected idle connections to close at once, took %v", elapsed)
+	}
+
+	for i := 1; i < 100; i++ {
+		if reply, err := busyReader.Read(); err != nil || reply.String != "OK" {
+			t.Fatalf("Expected reply %d of the pipeline, got %+v (%v)", i, reply, err)
+		}
+	}
+	for _, reader := range []*proto.RESPReader{idleReader, busyReader} {
+		if reply, err := reader.Read(); err != nil || reply.Type != proto.Error || !strings.HasPrefix(reply.String, "SHUTDOWN") {
+			t.Errorf("Expected a SHUTDOWN notice, got %+v (%v)", reply, err)
+		}
+		if _, err := reader.Read(); err == nil {
+			t.Error("Expected the connection to be closed after the notice")
+		}
+	}
+
+	if _, err := net.Dial("tcp", listener.Addr().String()); err == nil {
+		t.Error("Expected new connections to be refused")
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	var buf bytes.Buffer
+	srv := NewServer(db, nil)
+	srv.SetAccessLog(slog.New(slog.NewTextHandler(&buf, nil)))
+	d := srv.dispatcher
+	client := NewClient()
+	client.Addr = "127.0.0.1:5000"
+
+	d.Dispatch(client, command("SET", "k", "v"))
+	d.Dispatch(client, command("SADD", "k", "m"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected a record per command, got %q", buf.String())
+	}
+	for _, want := range []string{"msg=command", "client=127.0.0.1:5000", "command=SET", "latency=", "result=ok"} {
+		if !strings.Contains(lines[0], want) {
+			t.Errorf("Expected %q in %q", want, lines[0])
+		}
+	}
+	if !strings.Contains(lines[1], "result=error") || !strings.Contains(lines[1], "error=\"WRONGTYPE") {
+		t.Errorf("Expected the failed command to be logged with its error, got %q", lines[1])
+	}
+
+	buf.Reset()
+	srv.SetAccessLog(nil)
+	d.Dispatch(client, command("GET", "k"))
+	if buf.Len() != 0 {
+		t.Errorf("Expected no records once the access log is disabled, got %q", buf.String())
+	}
+}
+
+func TestSlowLogCommand(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	d.slowlog = slowlog.New(0, 8) // Log every command
+	client := NewClient()
+
+	d.Dispatch(client, command("SET", "k", "v"))
+
+	reply := d.Dispatch(client, command("SLOWLOG", "GET"))
+	if len(reply.Array) != 1 {
+		t.Fatalf("Expected one slow log entry, got %+v", reply)
+	}
+	args := reply.Array[0].Array[3].Array
+	if len(args) != 3 || args[0].String != "SET" || args[1].String != "k" {
+		t.Errorf("Unexpected logged arguments %+v", args)
+	}
+
+	d.Dispatch(client, command("SLOWLOG", "RESET"))
+	// Only the RESET itself has been logged since
+	if reply := d.Dispatch(client, command("SLOWLOG", "LEN")); reply.Int != 1 {
+		t.Errorf("Expected one entry after reset, got %d", reply.Int)
+	}
+}
+
+func TestLatencyCommand(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	d.latency = latency.New(time.Nanosecond) // Record every command
+	client := NewClient()
+
+	d.Dispatch(client, command("SET", "k", "v"))
+	d.Dispatch(client, command("SET", "k", "w"))
+
+	reply := d.Dispatch(client, command("LATENCY", "LATEST"))
+	if len(reply.Array) != 1 || reply.Array[0].Array[0].String != "set" {
+		t.Fatalf("Expected one latency event, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("LATENCY", "HISTORY", "SET")); len(reply.Array) != 1 || len(reply.Array[0].Array) != 2 {
+		t.Errorf("Expected the spikes of one second to be merged, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("LATENCY", "HISTORY", "missing")); len(reply.Array) != 0 {
+		t.Errorf("Expected no history for an unknown event, got %+v", reply)
+	}
+
+	// Now holds set and latency
+	if reply := d.Dispatch(client, command("LATENCY", "RESET")); reply.Int != 2 {
+		t.Errorf("Expected 2 events reset, got %+v", reply)
+	}
+}
+
+func TestStreamRange(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	for _, id := range []string{"1-1", "1-*", "2-0"} {
+		if reply := d.Dispatch(client, command("XADD", "s", id, "f", "v")); reply.Type == proto.Error {
+			t.Fatalf("Unexpected error: %s", reply.String)
+		}
+	}
+	if reply := d.Dispatch(client, command("XADD", "s", "2-0", "f", "v")); !strings.Contains(reply.String, "smaller than the target stream top item") {
+		t.Errorf("Expected a non-increasing ID to be rejected, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("XADD", "s", "*", "f", "v")); reply.Type != proto.BulkString {
+		t.Errorf("Expected an automatic ID, got %+v", reply)
+	}
+
+	reply := d.Dispatch(client, command("XRANGE", "s", "1", "2-0"))
+	if len(reply.Array) != 3 || reply.Array[1].Array[0].String != "1-2" {
+		t.Errorf("Expected entries 1-1, 1-2 and 2-0, got %+v", reply)
+	}
+	reply = d.Dispatch(client, command("XREVRANGE", "s", "+", "-", "COUNT", "2"))
+	if len(reply.Array) != 2 || reply.Array[1].Array[0].String != "2-0" {
+		t.Errorf("Expected the last 2 entries newest first, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("XRANGE", "missing", "-", "+")); reply.Type != proto.Array || len(reply.Array) != 0 {
+		t.Errorf("Expected no entries for a missing stream, got %+v", reply)
+	}
+
+	if reply := d.Dispatch(client, command("XTRIM", "s", "MINID", "2")); reply.Int != 2 {
+		t.Errorf("Expected the 2 entries below 2-0 trimmed, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("XADD", "s", "MAXLEN", "=", "1", "*", "f", "v")); reply.Type != proto.BulkString {
+		t.Fatalf("Expected XADD with MAXLEN to succeed, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("XRANGE", "s", "-", "+")); len(reply.Array) != 1 {
+		t.Errorf("Expected XADD to cap the stream at 1 entry, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("XTRIM", "s", "MAXLEN", "-1")); reply.Type != proto.Error {
+		t.Errorf("Expected a negative MAXLEN to be rejected, got %+v", reply)
+	}
+}
+
+func TestStreamConsumerGroups(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	if reply := d.Dispatch(client, command("XGROUP", "CREATE", "jobs", "workers", "0")); reply.Type != proto.Error {
+		t.Error("Expected XGROUP CREATE on a missing stream to fail without MKSTREAM")
+	}
+	if reply := d.Dispatch(client, command("XGROUP", "CREATE", "jobs", "workers", "0", "MKSTREAM")); reply.Type == proto.Error {
+		t.Fatalf("Unexpected error: %s", reply.String)
+	}
+	if reply := d.Dispatch(client, command("XGROUP", "CREATE", "jobs", "workers", "$")); !strings.HasPrefix(reply.String, "BUSYGROUP") {
+		t.Errorf("Expected BUSYGROUP, got %+v", reply)
+	}
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id, _ := d.streams.AddEntry("jobs", map[string]string{"n": strconv.Itoa(i)}, "")
+		ids = append(ids, id)
+	}
+
+	reply := d.Dispatch(client, command("XREADGROUP", "GROUP", "workers", "alice", "COUNT", "2", "STREAMS", "jobs", ">"))
+	if len(reply.Array) != 1 || len(reply.Array[0].Array[1].Array) != 2 {
+		t.Fatalf("Expected 2 entries for alice, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("XREADGROUP", "GROUP", "workers", "bob", "STREAMS", "jobs", ">")); len(reply.Array) != 1 || reply.Array[0].Array[1].Array[0].Array[0].String != ids[2] {
+		t.Fatalf("Expected the last entry for bob, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("XREADGROUP", "GROUP", "workers", "bob", "STREAMS", "jobs", ">")); !reply.Null {
+		t.Errorf("Expected null once every entry was delivered, got %+v", reply)
+	}
+
+	reply = d.Dispatch(client, command("XPENDING", "jobs", "workers"))
+	if reply.Array[0].Int != 3 || reply.Array[1].String != ids[0] || reply.Array[2].String != ids[2] || len(reply.Array[3].Array) != 2 {
+		t.Errorf("Unexpected pending summary %+v", reply)
+	}
+
+	if reply := d.Dispatch(client, command("XACK", "jobs", "workers", ids[0], ids[0])); reply.Int != 1 {
+		t.Errorf("Expected 1 entry acknowledged, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("XACK", "jobs", "missing", ids[1])); !strings.HasPrefix(reply.String, "NOGROUP") {
+		t.Errorf("Expected NOGROUP, got %+v", reply)
+	}
+
+	// Alice re-reads what she has not acknowledged
+	if reply := d.Dispatch(client, command("XREADGROUP", "GROUP", "workers", "alice", "STREAMS", "jobs", "0")); len(reply.Array[0].Array[1].Array) != 1 {
+		t.Errorf("Expected 1 pending entry for alice, got %+v", reply)
+	}
+
+	// Entries are not idle long enough to be claimed
+	if reply := d.Dispatch(client, command("XCLAIM", "jobs", "workers", "bob", "60000", ids[1])); len(reply.Array) != 0 {
+		t.Errorf("Expected nothing claimed, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("XCLAIM", "jobs", "workers", "bob", "0", ids[1])); len(reply.Array) != 1 || reply.Array[0].Array[0].String != ids[1] {
+		t.Errorf("Expected the entry of alice claimed, got %+v", reply)
+	}
+
+	reply = d.Dispatch(client, command("XPENDING", "jobs", "workers", "-", "+", "10", "bob"))
+	if len(reply.Array) != 2 || reply.Array[0].Array[0].String != ids[1] || reply.Array[0].Array[3].Int != 2 {
+		t.Errorf("Expected 2 entries pending for bob, the claimed one delivered twice, got %+v", reply)
+	}
+
+	reply = d.Dispatch(client, command("XAUTOCLAIM", "jobs", "workers", "carol", "0", "0", "COUNT", "1", "JUSTID"))
+	if reply.Array[0].String != ids[2] || len(reply.Array[1].Array) != 1 || reply.Array[1].Array[0].String != ids[1] {
+		t.Errorf("Expected one entry claimed and the scan to continue, got %+v", reply)
+	}
+	reply = d.Dispatch(client, command("XAUTOCLAIM", "jobs", "workers", "carol", "0", reply.Array[0].String))
+	if reply.Array[0].String != "0-0" || len(reply.Array[1].Array) != 1 {
+		t.Errorf("Expected the scan to complete, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("XPENDING", "jobs", "workers", "-", "+", "10", "carol")); len(reply.Array) != 2 || reply.Array[0].Array[3].Int != 2 {
+		t.Errorf("Expected both entries pending for carol, JUSTID leaving delivery counts, got %+v", reply)
+	}
+}
+
+func TestStreamBlockingRead(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	first, _ := d.streams.AddEntry("events", map[string]string{"n": "1"}, "")
+	if reply := d.Dispatch(client, command("XREAD", "STREAMS", "events", "missing", "0", "0")); len(reply.Array) != 1 || reply.Array[0].Array[1].Array[0].Array[0].String != first {
+		t.Fatalf("Expected the entry of the existing stream, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("XREAD", "BLOCK", "20", "STREAMS", "events", "$")); !reply.Null {
+		t.Errorf("Expected null after the timeout, got %+v", reply)
+	}
+
+	// An append wakes a reader blocked forever on a stream
+	replies := make(chan proto.RESPValue)
+	go func() {
+		replies <- d.Dispatch(client, command("XREAD", "BLOCK", "0", "STREAMS", "events", "$"))
+	}()
+	time.Sleep(20 * time.Millisecond)
+	second, _ := d.streams.AddEntry("events", map[string]string{"n": "2"}, "")
+	select {
+	case reply := <-replies:
+		if len(reply.Array) != 1 || reply.Array[0].Array[1].Array[0].Array[0].String != second {
+			t.Errorf("Expected the appended entry, got %+v", reply)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected XREAD BLOCK to return once an entry was appended")
+	}
+	if client.blocked != 0 {
+		t.Errorf("Expected the blocked time to be reset, got %v", client.blocked)
+	}
+
+	d.Dispatch(client, command("XGROUP", "CREATE", "events", "workers", "$"))
+	go func() {
+		replies <- d.Dispatch(client, command("XREADGROUP", "GROUP", "workers", "alice", "BLOCK", "0", "STREAMS", "events", ">"))
+	}()
+	time.Sleep(20 * time.Millisecond)
+	third, _ := d.streams.AddEntry("events", map[string]string{"n": "3"}, "")
+	if reply := <-replies; len(reply.Array) != 1 || reply.Array[0].Array[1].Array[0].Array[0].String != third {
+		t.Errorf("Expected the appended entry for the group, got %+v", reply)
+	}
+
+	// Unblocking, as done by a kill or a drain, returns null
+	go func() {
+		replies <- d.Dispatch(client, command("XREAD", "BLOCK", "0", "STREAMS", "events", "$"))
+	}()
+	time.Sleep(20 * time.Millisecond)
+	client.unblock()
+	select {
+	case reply := <-replies:
+		if !reply.Null {
+			t.Errorf("Expected null once unblocked, got %+v", reply)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected XREAD BLOCK to return once unblocked")
+	}
+}
+
+func TestConfigDefaultTTL(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	reply := d.Dispatch(client, command("CONFIG", "SET", "default-ttl", "session:*=30m"))
+	if reply.Type == proto.Error {
+		t.Fatalf("Unexpected error: %s", reply.String)
+	}
+	if reply := d.Dispatch(client, command("CONFIG", "SET", "default-ttl", "session:*")); reply.Type != proto.Error {
+		t.Error("Expected invalid default TTL to be rejected")
+	}
+
+	reply = d.Dispatch(client, command("CONFIG", "GET", "default-*"))
+	if len(reply.Array) != 2 || reply.Array[1].String != "session:*=30m0s" {
+		t.Errorf("Unexpected CONFIG GET reply %+v", reply)
+	}
+
+	d.Dispatch(client, command("SET", "session:1", "v"))
+	if reply := d.Dispatch(client, command("TTL", "session:1")); reply.Int <= 0 {
+		t.Errorf("Expected default TTL to be applied, got %d", reply.Int)
+	}
+
+	reply = d.Dispatch(client, command("INFO"))
+	if !strings.Contains(reply.String, "default_ttl_applied:1\r\n") {
+		t.Errorf("Expected INFO to report applied default TTLs, got %q", reply.String)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	if reply := d.Dispatch(client, command("CONFIG", "SET", "throttle", "export=10:0")); reply.Type == proto.Error {
+		t.Fatalf("Unexpected error: %s", reply.String)
+	}
+
+	// The first write exceeds the burst and puts the namespace in debt
+	if reply := d.Dispatch(client, command("SET", "export:1", "0123456789")); reply.Type == proto.Error {
+		t.Fatalf("Unexpected error: %s", reply.String)
+	}
+	reply := d.Dispatch(client, command("SET", "export:2", "v"))
+	if reply.Type != proto.Error || !strings.HasPrefix(reply.String, "THROTTLED") {
+		t.Errorf("Expected THROTTLED error, got %+v", reply)
+	}
+
+	// Other namespaces and unkeyed commands are unaffected
+	if reply := d.Dispatch(client, command("SET", "live:1", "v")); reply.Type == proto.Error {
+		t.Errorf("Unexpected error: %s", reply.String)
+	}
+	if reply := d.Dispatch(client, command("PING")); reply.Type == proto.Error {
+		t.Errorf("Unexpected error: %s", reply.String)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client, sameHost, otherHost := NewClient(), NewClient(), NewClient()
+	client.Addr, sameHost.Addr, otherHost.Addr = "10.0.0.1:5000", "10.0.0.1:5001", "10.0.0.2:5000"
+
+	if reply := d.Dispatch(client, command("CONFIG", "SET", "rate-limit", "write=2")); reply.Type == proto.Error {
+		t.Fatalf("Unexpected error: %s", reply.String)
+	}
+	if reply := d.Dispatch(client, command("CONFIG", "GET", "rate-limit")); reply.Array[1].String != "write=2" {
+		t.Errorf("Unexpected CONFIG GET rate-limit reply %+v", reply)
+	}
+
+	// Connections from one address share their limit
+	d.Dispatch(client, command("SET", "a", "1"))
+	d.Dispatch(sameHost, command("SET", "b", "1"))
+	reply := d.Dispatch(client, command("SET", "c", "1"))
+	if reply.Type != proto.Error || !strings.HasPrefix(reply.String, "RATELIMIT") {
+		t.Errorf("Expected RATELIMIT error, got %+v", reply)
+	}
+
+	// Other addresses and command classes are unaffected
+	if reply := d.Dispatch(otherHost, command("SET", "c", "1")); reply.Type == proto.Error {
+		t.Errorf("Unexpected error: %s", reply.String)
+	}
+	if reply := d.Dispatch(client, command("GET", "a")); reply.String != "1" {
+		t.Errorf("Expected reads to be unlimited, got %+v", reply)
+	}
+
+	if reply := d.Dispatch(client, command("CONFIG", "SET", "rate-limit", "delete=1")); reply.Type != proto.Error {
+		t.Errorf("Expected an unknown class to be rejected, got %+v", reply)
+	}
+}
+
+func TestCommandFlags(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	for cmd := range d.commands {
+		if commandFlags[cmd] == 0 {
+			t.Errorf("Command %s has no flags", cmd)
+		}
+	}
+	for cmd := range d.clientCommands {
+		if commandFlags[cmd] == 0 {
+			t.Errorf("Command %s has no flags", cmd)
+		}
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+	d.Dispatch(client, command("SET", "k", "v"))
+
+	if reply := d.Dispatch(client, command("CONFIG", "SET", "read-only", "yes")); reply.Type == proto.Error {
+		t.Fatalf("Unexpected error: %s", reply.String)
+	}
+	for _, cmd := range []proto.RESPValue{command("SET", "k", "w"), command("DEL", "k"), command("FLUSHALL")} {
+		if reply := d.Dispatch(client, cmd); reply.Type != proto.Error || !strings.HasPrefix(reply.String, "READONLY") {
+			t.Errorf("Expected READONLY error, got %+v", reply)
+		}
+	}
+	if reply := d.Dispatch(client, command("GET", "k")); reply.String != "v" {
+		t.Errorf("Expected reads to be served, got %+v", reply)
+	}
+
+	// The mode belongs to the store, so every listener sees it
+	if reply := d.Dispatch(client, command("CONFIG", "GET", "read-only")); reply.Array[1].String != "yes" {
+		t.Errorf("Unexpected CONFIG GET read-only reply %+v", reply)
+	}
+	other := NewCommandDispatcher(db, nil)
+	if reply := other.Dispatch(client, command("SET", "k", "w")); !strings.HasPrefix(reply.String, "READONLY") {
+		t.Errorf("Expected READONLY error on another listener, got %+v", reply)
+	}
+
+	d.Dispatch(client, command("CONFIG", "SET", "read-only", "no"))
+	if reply := d.Dispatch(client, command("SET", "k", "w")); reply.Type == proto.Error {
+		t.Errorf("Unexpected error: %s", reply.String)
+	}
+}
+
+func TestRetentionCommand(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	if reply := d.Dispatch(client, command("RETENTION", "GET")); reply.String != "count:10" {
+		t.Errorf("Expected default retention count:10, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("RETENTION", "DEFAULT", "AGE", "24h")); reply.Type == proto.Error {
+		t.Fatalf("Unexpected error: %s", reply.String)
+	}
+	if reply := d.Dispatch(client, command("CONFIG", "GET", "retention")); reply.Array[1].String != "age:24h0m0s" {
+		t.Errorf("Unexpected CONFIG GET retention reply %+v", reply)
+	}
+
+	if reply := d.Dispatch(client, command("RETENTION", "SET", "k", "ALL")); reply.Type != proto.Error {
+		t.Error("Expected retention on a missing key to fail")
+	}
+	d.Dispatch(client, command("SET", "k", "v"))
+	d.Dispatch(client, command("RETENTION", "SET", "k", "COUNT", "2"))
+	for i := 0; i < 5; i++ {
+		d.Dispatch(client, command("SET", "k", strconv.Itoa(i)))
+	}
+	if reply := d.Dispatch(client, command("HIST", "k")); len(reply.Array) != 2 {
+		t.Errorf("Expected 2 entries, got %d", len(reply.Array))
+	}
+	if reply := d.Dispatch(client, command("RETENTION", "GET", "k")); reply.String != "count:2" {
+		t.Errorf("Expected key retention count:2, got %+v", reply)
+	}
+
+	if reply := d.Dispatch(client, command("RETENTION", "RESET", "k")); reply.Int != 1 {
+		t.Errorf("Expected reset to report 1, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("RETENTION", "DEFAULT", "COUNT", "0")); reply.Type != proto.Error {
+		t.Error("Expected a zero count to be rejected")
+	}
+}
+
+func TestStatsAmplification(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	d.Dispatch(client, command("RETENTION", "DEFAULT", "COUNT", "1"))
+	d.Dispatch(client, command("SET", "app:k", "1"))
+	d.Dispatch(client, command("SET", "app:k", "2"))
+
+	reply := d.Dispatch(client, command("STATS", "AMPLIFICATION", "WINDOW", "90", "COUNT", "5"))
+	if len(reply.Array) != 6 || reply.Array[1].Int != 120 {
+		t.Fatalf("Unexpected STATS AMPLIFICATION reply %+v", reply)
+	}
+	if namespaces := reply.Array[3].Array; len(namespaces) != 1 || namespaces[0].Array[3].Int != 2 {
+		t.Errorf("Expected 2 versions created in app, got %+v", namespaces)
+	}
+	if keys := reply.Array[5].Array; len(keys) != 1 || keys[0].Array[5].Int != 1 {
+		t.Errorf("Expected app:k with 1 pruned version, got %+v", keys)
+	}
+	if reply := d.Dispatch(client, command("STATS", "AMPLIFICATION", "WINDOW")); reply.Type != proto.Error {
+		t.Errorf("Expected a syntax error, got %+v", reply)
+	}
+}
+
+func TestSetWrongTypeReads(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	d.Dispatch(client, command("SADD", "s", "a"))
+	d.Dispatch(client, command("SADD", "s", "b"))
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+
+	for _, args := range [][]string{{"GET", "s"}, {"GETAT", "s", now}, {"HIST", "s"}, {"HIST", "s", "WITHTTL"}, {"HISTRANGE", "s", "-", "+"}} {
+		if reply := d.Dispatch(client, command(args...)); reply.Type != proto.Error || !strings.HasPrefix(reply.String, "WRONGTYPE") {
+			t.Errorf("Expected WRONGTYPE from %v, got %+v", args, reply)
+		}
+	}
+}
+
+func TestZSetWrongTypeReads(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	d.Dispatch(client, command("ZADD", "z", "1", "a"))
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+
+	for _, args := range [][]string{{"GET", "z"}, {"GETAT", "z", now}, {"HIST", "z"}} {
+		if reply := d.Dispatch(client, command(args...)); reply.Type != proto.Error || !strings.HasPrefix(reply.String, "WRONGTYPE") {
+			t.Errorf("Expected WRONGTYPE from %v, got %+v", args, reply)
+		}
+	}
+}
+
+func TestHistEntries(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	d.Dispatch(client, command("RETENTION", "DEFAULT", "COUNT", "3"))
+	for i := 1; i <= 5; i++ {
+		d.Dispatch(client, command("SET", "k", strconv.Itoa(i)))
+	}
+	d.Dispatch(client, command("EXPIRE", "k", "60"))
+
+	// Trimmed versions leave the sequence numbers of the others unchanged
+	reply := d.Dispatch(client, command("HIST", "k", "LIMIT", "2", "WITHTTL"))
+	if reply.Type != proto.Array || len(reply.Array) != 2 {
+		t.Fatalf("Expected 2 entries, got %+v", reply)
+	}
+	entry := reply.Array[0].Array
+	if len(entry) != 4 || entry[1].String != "5" || entry[2].Int != 5 || entry[3].Int <= 0 || entry[3].Int > 60000 {
+		t.Errorf("Unexpected newest entry %+v", entry)
+	}
+	if entry := reply.Array[1].Array; entry[1].String != "4" || entry[2].Int != 4 || entry[3].Int != -1 {
+		t.Errorf("Unexpected second entry %+v", entry)
+	}
+
+	if reply := d.Dispatch(client, command("HIST", "k", "WITHTTL")); len(reply.Array) != 3 || reply.Array[2].Array[2].Int != 3 {
+		t.Errorf("Expected the 3 retained entries, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("HIST", "k", "LIMIT", "1")); len(reply.Array) != 1 || len(reply.Array[0].Array) != 3 {
+		t.Errorf("Expected one entry without TTL, got %+v", reply)
+	}
+	for _, args := range [][]string{{"k", "LIMIT"}, {"k", "2", "WITHTTL"}, {"k", "LIMIT", "-1"}, {"k", "BOGUS"}} {
+		if reply := d.Dispatch(client, command(append([]string{"HIST"}, args...)...)); reply.Type != proto.Error {
+			t.Errorf("Expected HIST %v to fail, got %+v", args, reply)
+		}
+	}
+}
+
+func TestHistSameMillisecond(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+	d.Dispatch(client, command("HELLO", "3"))
+
+	// 100 writes in under 100ms put several versions in one millisecond
+	const versions = 100
+	d.Dispatch(client, command("SET", "k", "0"))
+	d.Dispatch(client, command("RETENTION", "SET", "k", "ALL"))
+	for i := 1; i < versions; i++ {
+		d.Dispatch(client, command("SET", "k", strconv.Itoa(i)))
+	}
+
+	histScan := proto.RESPValue{Type: proto.Array}
+	for cursor := "0"; ; {
+		page := d.Dispatch(client, command("HISTSCAN", "k", cursor, "COUNT", "30"))
+		histScan.Array = append(histScan.Array, page.Array[1].Array...)
+		if cursor = page.Array[0].String; cursor == "0" {
+			break
+		}
+	}
+
+	for _, reply := range []proto.RESPValue{
+		d.Dispatch(client, command("HIST", "k")),
+		d.Dispatch(client, command("HISTRANGE", "k", "-", "+")),
+		histScan,
+	} {
+		if len(reply.Array) != versions {
+			t.Fatalf("Expected %d entries, got %d", versions, len(reply.Array))
+		}
+		shared := false
+		for i, entry := range reply.Array {
+			if entry.Array[1].String != strconv.Itoa(versions-1-i) || entry.Array[2].Int != int64(versions-i) {
+				t.Fatalf("Expected version %d newest first, got %+v", versions-i, entry)
+			}
+			if i == 0 {
+				continue
+			}
+			hlc, _ := attribute(entry, "hlc")
+			newer, _ := attribute(reply.Array[i-1], "hlc")
+			if hlc.Int >= newer.Int {
+				t.Errorf("Expected HLCs to order the versions, got %d after %d", hlc.Int, newer.Int)
+			}
+			shared = shared || entry.Array[0].Int == reply.Array[i-1].Array[0].Int
+		}
+		if !shared {
+			t.Error("Expected versions sharing a millisecond")
+		}
+	}
+}
+
+func TestGetVersion(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	// Versions written within one millisecond keep distinct numbers
+	d.Dispatch(client, command("SET", "k", "a"))
+	d.Dispatch(client, command("SET", "k", "b"))
+	d.Dispatch(client, command("DEL", "k"))
+	d.Dispatch(client, command("SET", "k", "c"))
+
+	for seq, want := range map[string]string{"1": "a", "2": "b", "4": "c"} {
+		if reply := d.Dispatch(client, command("GETVERSION", "k", seq)); reply.String != want {
+			t.Errorf("Expected version %s to be %q, got %+v", seq, want, reply)
+		}
+	}
+	// The delete and versions never written have no value
+	for _, seq := range []string{"3", "5"} {
+		if reply := d.Dispatch(client, command("GETVERSION", "k", seq)); !reply.Null {
+			t.Errorf("Expected version %s to be null, got %+v", seq, reply)
+		}
+	}
+	if reply := d.Dispatch(client, command("GETVERSION", "missing", "1")); !reply.Null {
+		t.Errorf("Expected null for a missing key, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("GETVERSION", "k", "0")); reply.Type != proto.Error {
+		t.Errorf("Expected sequence numbers to start at 1, got %+v", reply)
+	}
+
+	// Versions of other types are not strings, as with GET
+	d.Dispatch(client, command("SADD", "s", "a"))
+	d.Dispatch(client, command("ZADD", "z", "1", "a"))
+	for _, key := range []string{"s", "z"} {
+		if reply := d.Dispatch(client, command("GETVERSION", key, "1")); reply.Type != proto.Error || !strings.HasPrefix(reply.String, "WRONGTYPE") {
+			t.Errorf("Expected GETVERSION %s to fail with WRONGTYPE, got %+v", key, reply)
+		}
+	}
+	d.Dispatch(client, command("JSON.SET", "js", "$", `{"a":1}`))
+	if reply := d.Dispatch(client, command("GETVERSION", "js", "1")); reply.String != `{"a":1}` {
+		t.Errorf("Expected the JSON document, got %+v", reply)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	start := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	d.Dispatch(client, command("SET", "user:1", "a"))
+	d.Dispatch(client, command("SET", "order:1", "b"))
+	d.Dispatch(client, command("DEL", "user:1"))
+
+	reply := d.Dispatch(client, command("CHANGES", start, "MATCH", "user:*"))
+	if len(reply.Array) != 2 {
+		t.Fatalf("Unexpected CHANGES reply %+v", reply)
+	}
+	changes := reply.Array[1].Array
+	if len(changes) != 2 || changes[0].Array[1].String != "SET" || changes[0].Array[3].String != "a" ||
+		changes[1].Array[1].String != "DELETE" || !changes[1].Array[3].Null {
+		t.Fatalf("Expected the set and delete of user:1, got %+v", changes)
+	}
+	if reply.Array[0].String != changes[1].Array[0].String {
+		t.Errorf("Expected to resume after the last change, got %q", reply.Array[0].String)
+	}
+
+	// Pages resume from the returned ID
+	page := d.Dispatch(client, command("CHANGES", start, "COUNT", "1"))
+	next := d.Dispatch(client, command("CHANGES", page.Array[0].String, "COUNT", "1"))
+	if changes := next.Array[1].Array; len(changes) != 1 || changes[0].Array[2].String != "order:1" {
+		t.Errorf("Expected order:1 on the second page, got %+v", next)
+	}
+
+	// Changes carry the type of the value written, and the value of strings
+	// and JSON documents
+	typed := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	d.Dispatch(client, command("SET", "typed:empty", ""))
+	d.Dispatch(client, command("JSON.SET", "typed:doc", "$", `{"a":1}`))
+	d.Dispatch(client, command("SADD", "typed:set", "a"))
+	d.Dispatch(client, command("ZADD", "typed:zset", "1", "a"))
+	want := map[string][2]string{
+		"typed:empty": {"", "string"},
+		"typed:doc":   {`{"a":1}`, "json"},
+		"typed:set":   {"(nil)", "set"},
+		"typed:zset":  {"(nil)", "zset"},
+	}
+	reply = d.Dispatch(client, command("CHANGES", typed, "MATCH", "typed:*"))
+	if len(reply.Array[1].Array) != len(want) {
+		t.Fatalf("Expected %d typed changes, got %+v", len(want), reply)
+	}
+	for _, change := range reply.Array[1].Array {
+		value := change.Array[3].String
+		if change.Array[3].Null {
+			value = "(nil)"
+		}
+		if got := [2]string{value, change.Array[4].String}; got != want[change.Array[2].String] {
+			t.Errorf("Expected %s to change to %v, got %v", change.Array[2].String, want[change.Array[2].String], got)
+		}
+	}
+	if changes := d.Dispatch(client, command("CHANGES", start, "MATCH", "user:*")).Array[1].Array; !changes[1].Array[4].Null {
+		t.Errorf("Expected no value type for a delete, got %+v", changes[1])
+	}
+
+	// A blocked read returns the change made while it waits
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		db.Set("user:2", "c", 0)
+	}()
+	reply = d.Dispatch(client, command("CHANGES", "$", "MATCH", "user:*", "BLOCK", "2000"))
+	if changes := reply.Array[1].Array; len(changes) != 1 || changes[0].Array[2].String != "user:2" {
+		t.Errorf("Expected the live change of user:2, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("CHANGES", "$", "BLOCK", "10")); len(reply.Array[1].Array) != 0 {
+		t.Errorf("Expected no change before the timeout, got %+v", reply)
+	}
+
+	for _, args := range [][]string{{"CHANGES"}, {"CHANGES", "x"}, {"CHANGES", start, "COUNT"}, {"CHANGES", start, "LIMIT", "1"}} {
+		if reply := d.Dispatch(client, command(args...)); reply.Type != proto.Error {
+			t.Errorf("Expected %v to fail, got %+v", args, reply)
+		}
+	}
+}
+
+func TestHistRange(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	for i := 0; i < 3; i++ {
+		d.Dispatch(client, command("SET", "k", strconv.Itoa(i)))
+	}
+
+	if reply := d.Dispatch(client, command("HISTRANGE", "k", "-", "+")); len(reply.Array) != 3 {
+		t.Errorf("Expected 3 entries, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("HISTRANGE", "k", "-", "+", "1")); len(reply.Array) != 1 || reply.Array[0].Array[1].String != "2" {
+		t.Errorf("Expected the newest version only, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("HISTRANGE", "k", "0", "1")); reply.Type != proto.Array || len(reply.Array) != 0 {
+		t.Errorf("Expected no entries, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("HISTRANGE", "k", "now", "+")); reply.Type != proto.Error {
+		t.Error("Expected an invalid start to be rejected")
+	}
+}
+
+func TestHistScan(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	for i := 0; i < 5; i++ {
+		d.Dispatch(client, command("SET", "k", strconv.Itoa(i)))
+	}
+
+	var values []string
+	cursor := "0"
+	for page := 0; ; page++ {
+		reply := d.Dispatch(client, command("HISTSCAN", "k", cursor, "COUNT", "2"))
+		if reply.Type != proto.Array || len(reply.Array) != 2 {
+			t.Fatalf("Unexpected reply %+v", reply)
+		}
+		for _, entry := range reply.Array[1].Array {
+			values = append(values, entry.Array[1].String)
+		}
+		// A write between pages lands before the first page, not in the next one
+		d.Dispatch(client, command("SET", "k", "new"))
+		if cursor = reply.Array[0].String; cursor == "0" {
+			break
+		}
+		if page > 5 {
+			t.Fatal("HISTSCAN did not terminate")
+		}
+	}
+	if strings.Join(values, ",") != "4,3,2,1,0" {
+		t.Errorf("Expected every version once, newest first, got %v", values)
+	}
+
+	if reply := d.Dispatch(client, command("HISTSCAN", "k", "x")); reply.Type != proto.Error {
+		t.Errorf("Expected an invalid cursor to fail, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("HISTSCAN", "k", "0", "COUNT", "0")); reply.Type != proto.Error {
+		t.Errorf("Expected an invalid count to fail, got %+v", reply)
+	}
+}
+
+func TestMaxResponseSize(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	srv := NewServer(db, nil)
+	srv.SetMaxResponseSize(400)
+	d := srv.dispatcher
+
+	value := strings.Repeat("x", 50)
+	for i := 0; i < 8; i++ {
+		d.Dispatch(NewClient(), command("SET", "k", value+strconv.Itoa(i)))
+	}
+	for i := 0; i < 20; i++ {
+		d.Dispatch(NewClient(), command("SET", "key:"+strconv.Itoa(i), value))
+	}
+
+	resp3 := NewClient()
+	d.Dispatch(resp3, command("HELLO", "3"))
+	reply := d.Dispatch(resp3, command("HIST", "k"))
+	if reply.Type != proto.Array || len(reply.Array) == 0 || len(reply.Array) >= 8 {
+		t.Fatalf("Expected a truncated history, got %d entries", len(reply.Array))
+	}
+	if truncated, ok := attribute(reply, "truncated"); !ok || !truncated.Bool {
+		t.Errorf("Expected a truncated attribute, got %+v", reply.Attributes)
+	}
+	encoded, _ := proto.AppendValueProtocol(nil, reply, proto.RESP3)
+	if len(encoded) > 400+100 {
+		t.Errorf("Expected the reply to fit the limit, got %d bytes", len(encoded))
+	}
+
+	// The cursor resumes the history with HISTSCAN where the reply stopped
+	cursor, ok := attribute(reply, "cursor")
+	if !ok {
+		t.Fatalf("Expected a cursor attribute, got %+v", reply.Attributes)
+	}
+	seen := len(reply.Array)
+	for next := cursor.String; next != "0"; {
+		page := d.Dispatch(resp3, command("HISTSCAN", "k", next, "COUNT", "100"))
+		if page.Type != proto.Array {
+			t.Fatalf("Unexpected reply %+v", page)
+		}
+		if encoded, _ := proto.AppendValueProtocol(nil, page, proto.RESP3); len(encoded) > 400+100 {
+			t.Errorf("Expected HISTSCAN pages to fit the limit, got %d bytes", len(encoded))
+		}
+		seen += len(page.Array[1].Array)
+		next = page.Array[0].String
+	}
+	if seen != 8 {
+		t.Errorf("Expected the truncated reply and HISTSCAN to cover 8 versions, got %d", seen)
+	}
+
+	// RESP2 cannot carry the flag, so the partial reply is refused
+	if reply := d.Dispatch(NewClient(), command("HIST", "k")); reply.Type != proto.Error || !strings.Contains(reply.String, "max response size") {
+		t.Errorf("Expected a RESP2 error, got %+v", reply)
+	}
+	if reply := d.Dispatch(NewClient(), command("HIST", "k", "2")); reply.Type != proto.Array || len(reply.Array) != 2 {
+		t.Errorf("Expected a reply within the limit to be untouched, got %+v", reply)
+	}
+
+	// SCAN returns shorter pages, so every key is still visited once
+	keys := make(map[string]int)
+	for next := "0"; ; {
+		page := d.Dispatch(NewClient(), command("SCAN", next, "MATCH", "key:*", "COUNT", "1000"))
+		for _, key := range page.Array[1].Array {
+			keys[key.String]++
+		}
+		if next = page.Array[0].String; next == "0" {
+			break
+		}
+	}
+	if len(keys) != 20 {
+		t.Errorf("Expected SCAN to visit 20 keys, got %d", len(keys))
+	}
+	for key, n := range keys {
+		if n != 1 {
+			t.Errorf("Expected %s once, got %d", key, n)
+		}
+	}
+}
+
+func TestHistDiff(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	d.Dispatch(client, command("SET", "doc", `{"status":"open"}`))
+	reply := d.Dispatch(client, command("HISTDIFF", "doc", "-", "+"))
+	if reply.Type != proto.Map || !reply.Array[1].Null || reply.Array[3].String != `{"status":"open"}` {
+		t.Fatalf("Unexpected HISTDIFF reply %+v", reply)
+	}
+	if !reply.Array[5].Null {
+		t.Errorf("Expected no changes without a before value, got %+v", reply.Array[5])
+	}
+
+	at := db.History("doc", 1)[0].Timestamp
+	time.Sleep(2 * time.Millisecond)
+	d.Dispatch(client, command("SET", "doc", `{"status":"closed"}`))
+	reply = d.Dispatch(client, command("HISTDIFF", "doc", strconv.FormatInt(at, 10), "+"))
+	changes := reply.Array[5].Array
+	if len(changes) != 1 || changes[0].Array[1].String != "$.status" || changes[0].Array[7].String != `"closed"` {
+		t.Errorf("Unexpected changes %+v", changes)
+	}
+
+	if reply := d.Dispatch(client, command("HISTDIFF", "doc", "yesterday", "+")); reply.Type != proto.Error {
+		t.Error("Expected an invalid timestamp to be rejected")
+	}
+}
+
+func TestDebugTTL(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	d.Dispatch(client, command("SET", "session:1", "v", "EX", "10"))
+	d.Dispatch(client, command("SET", "session:2", "v", "EX", "3600"))
+	d.Dispatch(client, command("SET", "cache:1", "v", "EX", "100"))
+	d.Dispatch(client, command("SET", "cache:1", "v")) // Leaves a stale entry
+
+	reply := d.Dispatch(client, command("DEBUG", "TTL"))
+	fields := make(map[string]proto.RESPValue)
+	for i := 0; i+1 < len(reply.Array); i += 2 {
+		fields[reply.Array[i].String] = reply.Array[i+1]
+	}
+	if fields["total"].Int != 3 || fields["stale"].Int != 1 || fields["cursor"].Int != 0 {
+		t.Errorf("Unexpected DEBUG TTL summary %+v", reply)
+	}
+	buckets := fields["buckets"].Array
+	if buckets[4].String != "<=1m" || buckets[5].Int != 1 || buckets[6].String != "<=1h" || buckets[7].Int != 2 {
+		t.Errorf("Unexpected buckets %+v", buckets)
+	}
+	if keys := fields["keys"].Array; len(keys) != 6 || keys[0].String != "session:1" || keys[1].Int > 10000 {
+		t.Errorf("Expected keys soonest first, got %+v", keys)
+	}
+
+	// Pattern and pagination
+	reply = d.Dispatch(client, command("DEBUG", "TTL", "session:*", "COUNT", "1"))
+	if reply.Array[1].Int != 1 || len(reply.Array[9].Array) != 2 || reply.Array[9].Array[0].String != "session:1" {
+		t.Errorf("Unexpected first page %+v", reply)
+	}
+	reply = d.Dispatch(client, command("DEBUG", "TTL", "session:*", "CURSOR", "1", "COUNT", "1"))
+	if reply.Array[1].Int != 0 || reply.Array[9].Array[0].String != "session:2" {
+		t.Errorf("Unexpected second page %+v", reply)
+	}
+
+	if reply := d.Dispatch(client, command("DEBUG", "TTL", "*", "LIMIT", "1")); reply.Type != proto.Error {
+		t.Error("Expected an unknown option to be rejected")
+	}
+}
+
+func TestDebugCommands(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	if reply := d.Dispatch(client, command("DEBUG", "QUICKLOAD", "100", "load", "20")); reply.Int != 100 {
+		t.Fatalf("Expected 100 keys created, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("GET", "load:7")); reply.String != "value:7xxxxxxxxxxxxx" {
+		t.Errorf("Expected a padded value, got %+v", reply)
+	}
+	// Existing keys are kept
+	d.Dispatch(client, command("SET", "load:100", "mine"))
+	if reply := d.Dispatch(client, command("DEBUG", "QUICKLOAD", "101", "load", "20")); reply.Int != 0 {
+		t.Errorf("Expected no key created, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("GET", "load:100")); reply.String != "mine" {
+		t.Errorf("Expected an existing key to be kept, got %+v", reply)
+	}
+
+	if reply := d.Dispatch(client, command("DEBUG", "OBJECT", "load:1")); !strings.Contains(reply.String, "encoding:embstr versions:1") {
+		t.Errorf("Unexpected DEBUG OBJECT reply %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("DEBUG", "OBJECT", "missing")); reply.Type != proto.Error {
+		t.Errorf("Expected an error for a missing key, got %+v", reply)
+	}
+
+	reply := d.Dispatch(client, command("DEBUG", "SHARD", "load:1"))
+	if len(reply.Array) != 14 || reply.Array[0].String != "shard" || reply.Array[3].Int < 1 {
+		t.Errorf("Unexpected DEBUG SHARD reply %+v", reply)
+	}
+
+	start := time.Now()
+	if reply := d.Dispatch(client, command("DEBUG", "SLEEP", "0.05")); reply.String != "OK" {
+		t.Errorf("Unexpected DEBUG SLEEP reply %+v", reply)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected DEBUG SLEEP to block 50ms, returned after %v", elapsed)
+	}
+
+	if reply := d.Dispatch(client, command("DEBUG", "SET-ACTIVE-EXPIRE", "off")); reply.String != "OK" || db.ActiveExpire() {
+		t.Errorf("Expected active expiry off, got %+v", reply)
+	}
+	d.Dispatch(client, command("DEBUG", "SET-ACTIVE-EXPIRE", "1"))
+	if !db.ActiveExpire() {
+		t.Error("Expected active expiry on")
+	}
+	if reply := d.Dispatch(client, command("DEBUG", "SET-ACTIVE-EXPIRE", "maybe")); reply.Type != proto.Error {
+		t.Errorf("Expected an invalid argument error, got %+v", reply)
+	}
+
+	if reply := d.Dispatch(client, command("DEBUG", "HELP")); len(reply.Array) == 0 {
+		t.Errorf("Expected help lines, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("DEBUG", "SLEEP")); reply.Type != proto.Error {
+		t.Errorf("Expected an arity error, got %+v", reply)
+	}
+	// Durations past the longest time.Duration would overflow it
+	for _, seconds := range []string{"NaN", "-1", "inf", "1e300", "9223372037"} {
+		if reply := d.Dispatch(client, command("DEBUG", "SLEEP", seconds)); reply.String != "ERR value is not a valid float" {
+			t.Errorf("Expected DEBUG SLEEP %s to be refused, got %+v", seconds, reply)
+		}
+	}
+}
+
+func TestJSONCommands(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	if reply := d.Dispatch(client, command("JSON.SET", "doc", "$", `{"hits":1,"tags":[]}`)); reply.String != "OK" {
+		t.Fatalf("Unexpected JSON.SET reply %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("JSON.SET", "doc", "$.hits", "5", "NX")); !reply.Null {
+		t.Errorf("Expected NX on an existing path to reply null, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("JSON.NUMINCRBY", "doc", "$.hits", "2")); reply.String != "3" {
+		t.Errorf("Expected 3, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("JSON.GET", "doc")); reply.String != `{"hits":3,"tags":[]}` {
+		t.Errorf("Unexpected document %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("JSON.DEL", "doc", "$.tags")); reply.Int != 1 {
+		t.Errorf("Expected 1 deleted, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("TYPE", "doc")); reply.String != "json" {
+		t.Errorf("Expected json type, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("JSON.GET", "doc", "$.missing")); reply.Type != proto.Error {
+		t.Errorf("Expected an error for a missing path, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("JSON.SET", "doc", "$", "{")); reply.Type != proto.Error {
+		t.Errorf("Expected invalid JSON to be rejected, got %+v", reply)
+	}
+}
+
+func TestSketchCommands(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	if reply := d.Dispatch(client, command("SKETCH.ADD", "lat", "5", "10", "15", "20")); reply.Int != 4 {
+		t.Fatalf("Unexpected SKETCH.ADD reply %+v", reply)
+	}
+	reply := d.Dispatch(client, command("SKETCH.QUANTILE", "lat", "0", "1"))
+	if len(reply.Array) != 2 || reply.Array[0].Float != 5 || reply.Array[1].Float != 20 {
+		t.Errorf("Unexpected SKETCH.QUANTILE reply %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("SKETCH.QUANTILE", "missing", "0.5")); !reply.Null {
+		t.Errorf("Expected null for a missing sketch, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("SKETCH.QUANTILE", "lat", "1.5")); reply.Type != proto.Error {
+		t.Errorf("Expected an out of range quantile to be rejected, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("SKETCH.MERGE", "total", "lat", "lat")); reply.String != "OK" {
+		t.Errorf("Unexpected SKETCH.MERGE reply %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("SKETCH.INFO", "total")); len(reply.Array) != 12 || reply.Array[3].Int != 8 {
+		t.Errorf("Unexpected SKETCH.INFO reply %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("TYPE", "total")); reply.String != "sketch" {
+		t.Errorf("Expected sketch type, got %+v", reply)
+	}
+}
+
+func TestStructuredReplies(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	d.Dispatch(client, command("SET", "k", "v", "EX", "100"))
+
+	// HIST entries carry their remaining TTL and HLC as attributes
+	reply := d.Dispatch(client, command("HIST", "k"))
+	if len(reply.Array) != 1 {
+		t.Fatalf("Expected one entry, got %+v", reply)
+	}
+	entry := reply.Array[0]
+	attrs := entry.Attributes
+	if len(attrs) != 4 || attrs[0].String != "ttl" || attrs[1].Int <= 0 || attrs[1].Int > 100000 {
+		t.Errorf("Unexpected HIST attributes %+v", attrs)
+	}
+	if attrs[2].String != "hlc" || store.HLC(attrs[3].Int).Wall() != entry.Array[0].Int {
+		t.Errorf("Expected the HLC of the version, got %+v", attrs)
+	}
+
+	// INFO is text for RESP2 and a map of maps for RESP3
+	if reply := d.Dispatch(client, command("INFO", "keyspace")); reply.Type != proto.BulkString {
+		t.Errorf("Expected INFO text for RESP2, got %+v", reply)
+	}
+	d.Dispatch(client, command("HELLO", "3"))
+	reply = d.Dispatch(client, command("INFO", "keyspace"))
+	if reply.Type != proto.Map || len(reply.Array) != 2 || reply.Array[0].String != "keyspace" {
+		t.Fatalf("Expected INFO map for RESP3, got %+v", reply)
+	}
+	keyspace := reply.Array[1].Array
+	if keyspace[0].String != "keys" || keyspace[1].Type != proto.Integer || keyspace[1].Int != 1 {
+		t.Errorf("Unexpected keyspace section %+v", keyspace[:2])
+	}
+
+	// Compatibility mode keeps RESP3 connections on RESP2 replies
+	d.Dispatch(client, command("CONFIG", "SET", "resp2-compat", "yes"))
+	if reply := d.Dispatch(client, command("INFO", "keyspace")); reply.Type != proto.BulkString {
+		t.Errorf("Expected INFO text in compatibility mode, got %+v", reply)
+	}
+	if protocol := d.replyProtocol(client); protocol != proto.RESP2 {
+		t.Errorf("Expected RESP2 replies in compatibility mode, got %d", protocol)
+	}
+}
+
+func TestArchiveCommand(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	if reply := d.Dispatch(client, command("ARCHIVE", "SET", "tmp:*", "FILE", "/tmp/x")); reply.Type != proto.Error {
+		t.Error("Expected file sinks to be refused over RESP")
+	}
+	if reply := d.Dispatch(client, command("ARCHIVE", "SET", "tmp:*", "STREAM", "expired")); reply.Type == proto.Error {
+		t.Fatalf("Unexpected error: %s", reply.String)
+	}
+
+	reply := d.Dispatch(client, command("ARCHIVE", "LIST"))
+	if len(reply.Array) != 1 || reply.Array[0].Array[3].String != "stream:expired" || reply.Array[0].Array[5].Int != 0 {
+		t.Errorf("Unexpected ARCHIVE LIST reply %+v", reply)
+	}
+
+	// Nothing has expired yet, so the stream does not exist
+	if reply := d.Dispatch(client, command("ARCHIVE", "READ", "expired")); reply.Type != proto.Array || len(reply.Array) != 0 {
+		t.Errorf("Expected no archived entries, got %+v", reply)
+	}
+
+	if reply := d.Dispatch(client, command("ARCHIVE", "DEL", "tmp:*")); reply.Int != 1 {
+		t.Errorf("Expected archive rule to be removed, got %+v", reply)
+	}
+}
+
+func TestJobCommand(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	if reply := d.Dispatch(client, command("JOB", "LIST")); reply.Type != proto.Error {
+		t.Error("Expected JOB to be refused without a scheduler")
+	}
+
+	ctx := context.Background()
+	runtime := wasm.NewWASMRuntime(ctx)
+	defer runtime.Close(ctx)
+	d.scheduler = wasm.NewScheduler(runtime)
+	defer d.scheduler.Close()
+
+	if reply := d.Dispatch(client, command("JOB", "CREATE", "cleanup", "*/5 * * * *", "missing")); reply.Type != proto.Error {
+		t.Errorf("Expected a missing function to be refused, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("JOB", "CREATE", "cleanup", "*/5 * * *")); reply.Type != proto.Error {
+		t.Errorf("Expected wrong arity to be refused, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("JOB", "LIST")); reply.Type != proto.Array || len(reply.Array) != 0 {
+		t.Errorf("Expected no jobs, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("JOB", "DELETE", "cleanup")); reply.Int != 0 {
+		t.Errorf("Expected no job to delete, got %+v", reply)
+	}
+}
+
+// scriptModule builds a script whose eval runs command, a JSON array of
+// strings, with the call host function and returns its reply
+func scriptModule(command string) []byte {
+	section := func(id byte, content ...byte) []byte {
+		return append([]byte{id, byte(len(content))}, content...)
+	}
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00} // magic, version
+	module = append(module, section(0x01, 0x03,
+		0x60, 0x04, 0x7f, 0x7f, 0x7f, 0x7f, 0x01, 0x7f, // call: (i32, i32, i32, i32) -> i32
+		0x60, 0x01, 0x7f, 0x01, 0x7f, // alloc: (i32) -> i32
+		0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7e, // eval: (i32, i32) -> i64
+	)...)
+	module = append(module, section(0x02, 0x01,
+		0x07, 'p', 'u', 'l', 's', 'e', 'd', 'b', 0x04, 'c', 'a', 'l', 'l', 0x00, 0x00,
+	)...)
+	module = append(module, section(0x03, 0x02, 0x01, 0x02)...)
+	module = append(module, section(0x05, 0x01, 0x00, 0x01)...) // memory of one page
+	module = append(module, section(0x07, 0x03,
+		0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x00,
+		0x05, 'a', 'l', 'l', 'o', 'c', 0x00, 0x01,
+		0x04, 'e', 'v', 'a', 'l', 0x00, 0x02,
+	)...)
+	// alloc returns 1024; eval returns 256<<32 | call(0, len(command), 256, 256)
+	module = append(module, section(0x0a, 0x02,
+		0x05, 0x00, 0x41, 0x80, 0x08, 0x0b,
+		0x16, 0x00, 0x42, 0x80, 0x02, 0x42, 0x20, 0x86,
+		0x41, 0x00, 0x41, byte(len(command)), 0x41, 0x80, 0x02, 0x41, 0x80, 0x02, 0x10, 0x00,
+		0xad, 0x84, 0x0b,
+	)...)
+	data := append([]byte{0x01, 0x00, 0x41, 0x00, 0x0b, byte(len(command))}, command...)
+	return append(module, section(0x0b, data...)...)
+}
+
+func TestScripting(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	set, get := string(scriptModule(`["SET","counter","1"]`)), string(scriptModule(`["GET","counter"]`))
+	if reply := d.Dispatch(client, command("EVAL", set, "0")); reply.Type != proto.Error {
+		t.Error("Expected EVAL to be refused without a runtime")
+	}
+
+	ctx := context.Background()
+	runtime := wasm.NewWASMRuntime(ctx)
+	defer runtime.Close(ctx)
+	d.scripts = runtime
+
+	if reply := d.Dispatch(client, command("EVAL", set, "0")); reply.Type != proto.SimpleString || reply.String != "OK" {
+		t.Fatalf("Expected the status of SET, got %+v", reply)
+	}
+	if value, _, _ := db.Get("counter"); value != "1" {
+		t.Errorf("Expected the script to set counter, got %q", value)
+	}
+
+	sha := d.Dispatch(client, command("SCRIPT", "LOAD", get)).String
+	if sha != wasm.ScriptSHA([]byte(get)) {
+		t.Fatalf("Expected the SHA1 of the script, got %q", sha)
+	}
+	if reply := d.Dispatch(client, command("EVALSHA", sha, "1", "counter")); reply.Type != proto.BulkString || reply.String != "1" {
+		t.Errorf("Expected the value of counter, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("EVALSHA", sha, "2", "counter")); reply.Type != proto.Error {
+		t.Errorf("Expected more keys than arguments to be refused, got %+v", reply)
+	}
+
+	forbidden := string(scriptModule(`["SCRIPT","FLUSH"]`))
+	if reply := d.Dispatch(client, command("EVAL", forbidden, "0")); reply.Type != proto.Error || !strings.Contains(reply.String, "not allowed") {
+		t.Errorf("Expected SCRIPT to be refused from scripts, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("EVAL", "not wasm", "0")); reply.Type != proto.Error {
+		t.Errorf("Expected an invalid script to be refused, got %+v", reply)
+	}
+
+	reply := d.Dispatch(client, command("SCRIPT", "EXISTS", sha, strings.Repeat("0", 40)))
+	if len(reply.Array) != 2 || reply.Array[0].Int != 1 || reply.Array[1].Int != 0 {
+		t.Errorf("Unexpected SCRIPT EXISTS reply %+v", reply)
+	}
+	d.Dispatch(client, command("SCRIPT", "FLUSH"))
+	if reply := d.Dispatch(client, command("EVALSHA", sha, "0")); !strings.HasPrefix(reply.String, "NOSCRIPT") {
+		t.Errorf("Expected flushed scripts to be gone, got %+v", reply)
+	}
+}
+
+func command(args ...string) proto.RESPValue {
+	array := make([]proto.RESPValue, len(args))
+	for i, arg := range args {
+		array[i] = proto.RESPValue{Type: proto.BulkString, String: arg}
+	}
+	return proto.RESPValue{Type: proto.Array, Array: array}
+}
+
+func TestDumpRestore(t *testing.T) {
+	src := store.NewStore()
+	defer src.Close()
+	src.Set("k", "v1", 0)
+	src.Set("k", "v2", 60_000)
+
+	d := NewCommandDispatcher(src, nil)
+	client := NewClient()
+	if reply := d.Dispatch(client, command("DUMP", "missing")); !reply.Null {
+		t.Errorf("Expected a null DUMP of a missing key, got %+v", reply)
+	}
+	payload := d.Dispatch(client, command("DUMP", "k"))
+	if payload.Type != proto.BulkString || payload.Null {
+		t.Fatalf("Unexpected DUMP reply: %+v", payload)
+	}
+
+	dst := store.NewStore()
+	defer dst.Close()
+	dst.Set("taken", "local", 0)
+	d = NewCommandDispatcher(dst, nil)
+
+	if reply := d.Dispatch(client, command("RESTORE", "k", payload.String)); reply.String != "OK" {
+		t.Fatalf("Unexpected RESTORE reply: %+v", reply)
+	}
+	if history := dst.History("k", 0); len(history) != 2 || history[0].Data != "v2" {
+		t.Errorf("Expected the dumped history, got %+v", history)
+	}
+	if ttl := dst.TTL("k"); ttl <= 0 || ttl > 60_000 {
+		t.Errorf("Expected the TTL to be kept, got %d", ttl)
+	}
+
+	if reply := d.Dispatch(client, command("RESTORE", "taken", payload.String)); !strings.HasPrefix(reply.String, "BUSYKEY") {
+		t.Errorf("Expected BUSYKEY, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("RESTORE", "taken", payload.String, "REPLACE")); reply.String != "OK" {
+		t.Errorf("Unexpected RESTORE REPLACE reply: %+v", reply)
+	}
+	if value, _, _ := dst.Get("taken"); value != "v2" {
+		t.Errorf("Expected the key to be replaced, got %q", value)
+	}
+
+	if reply := d.Dispatch(client, command("RESTORE", "bad", "garbage")); reply.Type != proto.Error {
+		t.Errorf("Expected a bad payload to be rejected, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("RESTORE", "bad", payload.String, "NOW")); reply.Type != proto.Error {
+		t.Errorf("Expected a syntax error, got %+v", reply)
+	}
+}
+
+func TestExportImportFiles(t *testing.T) {
+	src := store.NewStore()
+	defer src.Close()
+	src.Set("a", "1", 0)
+	src.Set("a", "2", 0)
+	src.SAdd("s", "x", "y")
+
+	srv := NewServer(src, nil)
+	client := NewClient()
+	if reply := srv.dispatcher.Dispatch(client, command("EXPORT", "backup.jsonl")); reply.Type != proto.Error {
+		t.Errorf("Expected EXPORT to be disabled without an export directory, got %+v", reply)
+	}
+
+	dir := t.TempDir()
+	srv.SetExportDir(dir)
+	for _, name := range []string{"../escape.jsonl", "sub/backup.jsonl", ".."} {
+		if reply := srv.dispatcher.Dispatch(client, command("EXPORT", name)); reply.Type != proto.Error {
+			t.Errorf("Expected %q to be rejected, got %+v", name, reply)
+		}
+	}
+
+	for _, name := range []string{"backup.jsonl", "backup.csv"} {
+		reply := srv.dispatcher.Dispatch(client, command("EXPORT", name, "HISTORY"))
+		if reply.Type != proto.Integer || reply.Int != 2 {
+			t.Fatalf("Unexpected EXPORT reply: %+v", reply)
+		}
+
+		dst := store.NewStore()
+		dst.Set("s", "local", 0)
+		d := NewCommandDispatcher(dst, nil)
+		d.exportDir = dir
+		reply = d.Dispatch(client, command("IMPORT", name))
+		if reply.Type != proto.Map || reply.Array[1].Int != 1 || reply.Array[3].Int != 1 {
+			t.Errorf("Unexpected IMPORT reply for %s: %+v", name, reply)
+		}
+		if history := dst.History("a", 0); len(history) != 2 {
+			t.Errorf("Expected the history of %s to be imported, got %+v", name, history)
+		}
+		if value, _, _ := dst.Get("s"); value != "local" {
+			t.Errorf("Expected the existing key to be kept, got %q", value)
+		}
+		dst.Close()
+	}
+
+	if reply := srv.dispatcher.Dispatch(client, command("IMPORT", "backup.csv", "FORMAT", "jsonl")); reply.Type != proto.Error {
+		t.Errorf("Expected a CSV file read as JSON Lines to fail, got %+v", reply)
+	}
+	if reply := srv.dispatcher.Dispatch(client, command("IMPORT", "missing.jsonl")); reply.Type != proto.Error {
+		t.Errorf("Expected a missing file to fail, got %+v", reply)
+	}
+	if reply := srv.dispatcher.Dispatch(client, command("EXPORT", "x.jsonl", "FORMAT", "xml")); reply.Type != proto.Error {
+		t.Errorf("Expected an unknown format to be rejected, got %+v", reply)
+	}
+}
+
+func TestNamespaceExportImport(t *testing.T) {
+	src := store.NewStore()
+	defer src.Close()
+
+	src.Set("app:a", "1", 0)
+	src.Set("app:a", "2", 0)
+	src.SAdd("app:s", "x", "y")
+	src.Set("other:b", "3", 0)
+	sm := streams.NewStreamManager()
+	for i := 0; i < 3; i++ {
+		sm.AddEntry("app:events", map[string]string{"n": strconv.Itoa(i)}, "")
+	}
+	sm.AddEntry("other:events", map[string]string{"n": "0"}, "")
+
+	srv := NewServer(src, nil)
+	srv.SetStreams(sm)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go srv.HandleConnection(conn)
+		}
+	}()
+
+	dst := store.NewStore()
+	defer dst.Close()
+	dst.Set("app:a", "local", 0)
+
+	d := NewCommandDispatcher(dst, nil)
+	client := NewClient()
+
+	// COUNT 1 forces a chunk per key and stream entry
+	reply := d.Dispatch(client, command("NSIMPORT", listener.Addr().String(), "app", "COUNT", "1"))
+	if reply.Type != proto.Map {
+		t.Fatalf("Unexpected NSIMPORT reply: %+v", reply)
+	}
+	counts := make(map[string]int64)
+	for i := 0; i+1 < len(reply.Array); i += 2 {
+		counts[reply.Array[i].String] = reply.Array[i+1].Int
+	}
+	if counts["keys"] != 1 || counts["skipped"] != 1 || counts["stream_entries"] != 3 {
+		t.Errorf("Unexpected import counts %v", counts)
+	}
+
+	if value, _, _ := dst.Get("app:a"); value != "local" {
+		t.Errorf("Expected the existing key to be kept, got %q", value)
+	}
+	if members, _ := dst.SMembers("app:s"); len(members) != 2 {
+		t.Errorf("Expected 2 members, got %v", members)
+	}
+	if _, ok, _ := dst.Get("other:b"); ok {
+		t.Error("Expected keys of other namespaces to stay behind")
+	}
+	if entries, err := d.streams.EntriesAfter("app:events", "", 10); err != nil || len(entries) != 3 {
+		t.Errorf("Expected 3 stream entries, got %v, %v", entries, err)
+	}
+	if _, err := d.streams.EntriesAfter("other:events", "", 10); err == nil {
+		t.Error("Expected streams of other namespaces to stay behind")
+	}
+
+	// REPLACE overwrites existing keys with their full history
+	d.Dispatch(client, command("NSIMPORT", listener.Addr().String(), "app", "REPLACE"))
+	if history := dst.History("app:a", 0); len(history) != 2 || history[0].Data != "2" {
+		t.Errorf("Expected the imported history, got %+v", history)
+	}
+
+	if reply := d.Dispatch(client, command("NSEXPORT", "app", "CURSOR", "bogus")); reply.Type != proto.Error {
+		t.Errorf("Expected an invalid cursor error, got %+v", reply)
+	}
+}
+
+// fakeRedis answers each command with the canned reply for its space-joined
+// arguments, recording the commands it received
+func fakeRedis(t *testing.T, replies map[string]proto.RESPValue) (string, *[]string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	var mu sync.Mutex
+	var received []string
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader, writer := proto.NewRESPReader(conn), proto.NewRESPWriter(conn)
+				for {
+					request, err := reader.Read()
+					if err != nil {
+						return
+					}
+					args := make([]string, len(request.Array))
+					for i, arg := range request.Array {
+						args[i] = arg.String
+					}
+					line := strings.Join(args, " ")
+					mu.Lock()
+					received = append(received, line)
+					mu.Unlock()
+
+					reply, found := replies[line]
+					if !found {
+						reply = proto.RESPValue{Type: proto.Error, String: "ERR unexpected " + line}
+					}
+					writer.WriteValue(reply)
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String(), &received
+}
+
+func bulks(items ...string) proto.RESPValue {
+	array := proto.RESPValue{Type: proto.Array, Array: []proto.RESPValue{}}
+	for _, item := range items {
+		array.Array = append(array.Array, proto.RESPValue{Type: proto.BulkString, String: item})
+	}
+	return array
+}
+
+func TestMigrateFromRedis(t *testing.T) {
+	status := func(s string) proto.RESPValue { return proto.RESPValue{Type: proto.SimpleString, String: s} }
+	integer := func(n int64) proto.RESPValue { return proto.RESPValue{Type: proto.Integer, Int: n} }
+
+	replies := map[string]proto.RESPValue{
+		"AUTH admin secret": status("OK"),
+		"SELECT 2":          status("OK"),
+		"SCAN 0 MATCH * COUNT 2": {Type: proto.Array, Array: []proto.RESPValue{
+			{Type: proto.BulkString, String: "7"}, bulks("str", "tags", "board"),
+		}},
+		"SCAN 7 MATCH * COUNT 2": {Type: proto.Array, Array: []proto.RESPValue{
+			{Type: proto.BulkString, String: "0"}, bulks("user", "queue", "events", "gone", "hll", "local"),
+		}},
+		"TYPE str": status("string"), "PTTL str": integer(60000), "GET str": bulks("hello").Array[0],
+		"TYPE tags": status("set"), "PTTL tags": integer(-1), "SMEMBERS tags": bulks("a", "b"),
+		"TYPE board": status("zset"), "PTTL board": integer(-1), "ZRANGE board 0 -1 WITHSCORES": bulks("alice", "1.5", "bob", "3"),
+		"TYPE user": status("hash"), "PTTL user": integer(-1), "HGETALL user": bulks("name", "alice", "age", "30"),
+		"TYPE queue": status("list"), "PTTL queue": integer(-1), "LRANGE queue 0 -1": bulks("x", "y"),
+		"TYPE events": status("stream"),
+		"XRANGE events - + COUNT 1000": {Type: proto.Array, Array: []proto.RESPValue{
+			{Type: proto.Array, Array: []proto.RESPValue{bulks("1700000000000-0").Array[0], bulks("type", "login")}},
+			{Type: proto.Array, Array: []proto.RESPValue{bulks("1700000000001-0").Array[0], bulks("type", "logout")}},
+		}},
+		"TYPE gone": status("string"), "PTTL gone": integer(-2),
+		"TYPE hll":   status("ReJSON-RL"),
+		"TYPE local": status("string"), "PTTL local": integer(-1), "GET local": bulks("remote").Array[0],
+	}
+	addr, received := fakeRedis(t, replies)
+
+	db := store.NewStore()
+	defer db.Close()
+	db.Set("local", "mine", 0)
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	reply := d.Dispatch(client, command("MIGRATE", "FROM", "redis://admin:secret@"+addr+"/2", "COUNT", "2"))
+	if reply.Type != proto.Map {
+		t.Fatalf("Unexpected MIGRATE reply: %+v", reply)
+	}
+	counts := make(map[string]int64)
+	for i := 0; i+1 < len(reply.Array); i += 2 {
+		counts[reply.Array[i].String] = reply.Array[i+1].Int
+	}
+	if counts["keys"] != 5 || counts["skipped"] != 1 || counts["unsupported"] != 1 || counts["stream_entries"] != 2 {
+		t.Errorf("Unexpected migration counts %v", counts)
+	}
+	if (*received)[0] != "AUTH admin secret" || (*received)[1] != "SELECT 2" {
+		t.Errorf("Expected AUTH and SELECT first, got %v", (*received)[:2])
+	}
+
+	if value, _, _ := db.Get("str"); value != "hello" {
+		t.Errorf("Expected the string, got %q", value)
+	}
+	if ttl := db.TTL("str"); ttl <= 0 || ttl > 60000 {
+		t.Errorf("Expected the TTL to be kept, got %d", ttl)
+	}
+	if members, _ := db.SMembers("tags"); len(members) != 2 {
+		t.Errorf("Expected 2 members, got %v", members)
+	}
+	if score, ok, _ := db.ZScore("board", "bob"); !ok || score != 3 {
+		t.Errorf("Expected bob to score 3, got %v, %v", score, ok)
+	}
+	if value := d.Dispatch(client, command("JSON.GET", "user", "$.name")); !strings.Contains(value.String, "alice") {
+		t.Errorf("Expected the hash as a JSON object, got %+v", value)
+	}
+	if value := d.Dispatch(client, command("JSON.GET", "queue")); value.String != `["x","y"]` {
+		t.Errorf("Expected the list as a JSON array, got %+v", value)
+	}
+	if entries, err := d.streams.EntriesAfter("events", "", 10); err != nil || len(entries) != 2 || entries[0].ID != "1700000000000-0" {
+		t.Errorf("Expected the stream entries with their IDs, got %v, %v", entries, err)
+	}
+	if value, _, _ := db.Get("local"); value != "mine" {
+		t.Errorf("Expected the existing key to be kept, got %q", value)
+	}
+
+	reply = d.Dispatch(client, command("MIGRATE", "FROM", "redis://"+addr, "MATCH", "x*", "COUNT", "2"))
+	if !strings.HasPrefix(reply.String, "ERR migration stopped at cursor 0: ") {
+		t.Errorf("Expected the error to name the cursor, got %+v", reply)
+	}
+	reply = d.Dispatch(client, command("MIGRATE", "FROM", "redis://:hunter2@127.0.0.1:1"))
+	if reply.Type != proto.Error || strings.Contains(reply.String, "hunter2") {
+		t.Errorf("Expected a connection error without the password, got %+v", reply)
+	}
+	for _, args := range [][]string{
+		{"MIGRATE", "TO", "redis://" + addr},
+		{"MIGRATE", "FROM", "http://" + addr},
+		{"MIGRATE", "FROM", "redis://" + addr, "COUNT", "0"},
+		{"MIGRATE", "FROM", "redis://" + addr, "MATCH"},
+	} {
+		if reply := d.Dispatch(client, command(args...)); reply.Type != proto.Error {
+			t.Errorf("Expected %q to fail, got %+v", args, reply)
+		}
+	}
+}
+
+func TestObjectCommand(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	if reply := d.Dispatch(client, command("OBJECT", "FREQ", "missing")); !reply.Null {
+		t.Errorf("Expected null for a missing key, got %+v", reply)
+	}
+
+	d.Dispatch(client, command("SET", "k", "v"))
+	for i := 0; i < 50; i++ {
+		d.Dispatch(client, command("GET", "k"))
+	}
+
+	freq := d.Dispatch(client, command("OBJECT", "FREQ", "k"))
+	if freq.Type != proto.Integer || freq.Int <= 5 {
+		t.Errorf("Expected the frequency to grow with reads, got %+v", freq)
+	}
+	// OBJECT itself is not an access
+	if again := d.Dispatch(client, command("OBJECT", "FREQ", "k")); again.Int != freq.Int {
+		t.Errorf("Expected OBJECT not to touch the key, got %d then %d", freq.Int, again.Int)
+	}
+	if idle := d.Dispatch(client, command("OBJECT", "IDLETIME", "k")); idle.Type != proto.Integer || idle.Int != 0 {
+		t.Errorf("Expected an idle time of 0, got %+v", idle)
+	}
+	if reply := d.Dispatch(client, command("OBJECT", "REFCOUNT", "k")); reply.Type != proto.Error {
+		t.Errorf("Expected an unknown subcommand error, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("OBJECT", "HELP")); reply.Type != proto.Array || len(reply.Array) == 0 {
+		t.Errorf("Expected help lines, got %+v", reply)
+	}
+
+	encodings := map[string]string{"12345": "int", "short": "embstr", strings.Repeat("x", 45): "raw"}
+	for value, want := range encodings {
+		d.Dispatch(client, command("SET", "e", value))
+		if reply := d.Dispatch(client, command("OBJECT", "ENCODING", "e")); reply.String != want {
+			t.Errorf("Expected encoding %s for %q, got %+v", want, value, reply)
+		}
+	}
+	d.Dispatch(client, command("SADD", "s", "a"))
+	if reply := d.Dispatch(client, command("OBJECT", "ENCODING", "s")); reply.String != "hashtable" {
+		t.Errorf("Expected hashtable encoding, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("OBJECT", "VERSIONS", "e")); reply.Type != proto.Integer || reply.Int != 3 {
+		t.Errorf("Expected 3 versions, got %+v", reply)
+	}
+}
+
+func TestMemoryUsage(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	if reply := d.Dispatch(client, command("MEMORY", "USAGE", "missing")); !reply.Null {
+		t.Errorf("Expected a null reply for a missing key, got %+v", reply)
+	}
+
+	d.Dispatch(client, command("SET", "k", strings.Repeat("x", 100)))
+	one := d.Dispatch(client, command("MEMORY", "USAGE", "k"))
+	if one.Type != proto.Integer || one.Int < 100 {
+		t.Fatalf("Expected at least 100 bytes, got %+v", one)
+	}
+
+	// Every version counts
+	d.Dispatch(client, command("SET", "k", strings.Repeat("y", 100)))
+	two := d.Dispatch(client, command("MEMORY", "USAGE", "k", "SAMPLES", "5"))
+	if two.Int < one.Int+100 {
+		t.Errorf("Expected a second version to add at least 100 bytes to %d, got %+v", one.Int, two)
+	}
+
+	if reply := d.Dispatch(client, command("MEMORY", "USAGE", "k", "SAMPLES")); reply.Type != proto.Error {
+		t.Errorf("Expected a syntax error, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("MEMORY", "DOCTOR")); reply.Type != proto.Error {
+		t.Errorf("Expected an unknown subcommand error, got %+v", reply)
+	}
+}
+
+func TestConfigEvents(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	srv := NewServer(db, nil)
+	client, serverConn := net.Pipe()
+	defer client.Close()
+	go srv.HandleConnection(serverConn)
+
+	reader := proto.NewRESPReader(client)
+	send := func(args ...string) proto.RESPValue {
+		t.Helper()
+		writer := proto.NewRESPWriter(client)
+		go writer.WriteValue(command(args...))
+		reply, err := reader.Read()
+		if err != nil {
+			t.Fatalf("Failed to read reply: %v", err)
+		}
+		return reply
+	}
+
+	reply := send("SUBSCRIBE", pubsub.ConfigChannel, "news")
+	if len(reply.Array) != 3 || reply.Array[0].String != "subscribe" || reply.Array[2].Int != 1 {
+		t.Fatalf("Unexpected SUBSCRIBE reply: %+v", reply)
+	}
+	if reply, _ := reader.Read(); reply.Array[1].String != "news" || reply.Array[2].Int != 2 {
+		t.Fatalf("Unexpected second SUBSCRIBE reply: %+v", reply)
+	}
+
+	// RESP2 subscribers may only manage subscriptions
+	if reply := send("GET", "k"); reply.Type != proto.Error {
+		t.Errorf("Expected GET to be refused while subscribed, got %+v", reply)
+	}
+
+	// Changes made on another connection are pushed as JSON events
+	other := NewClient()
+	if reply := srv.dispatcher.Dispatch(other, command("CONFIG", "SET", "retention", "count:3")); reply.String != "OK" {
+		t.Fatalf("Unexpected CONFIG SET reply: %+v", reply)
+	}
+	expectEvent := func(want configEvent) {
+		t.Helper()
+		msg, err := reader.Read()
+		if err != nil || len(msg.Array) != 3 || msg.Array[0].String != "message" || msg.Array[1].String != pubsub.ConfigChannel {
+			t.Fatalf("Unexpected message %+v, %v", msg, err)
+		}
+		var event configEvent
+		if err := json.Unmarshal([]byte(msg.Array[2].String), &event); err != nil {
+			t.Fatalf("Invalid event %q: %v", msg.Array[2].String, err)
+		}
+		if event.Event != want.Event || event.Parameter != want.Parameter || event.Key != want.Key || event.Value != want.Value || event.Time == 0 {
+			t.Errorf("Expected event %+v, got %+v", want, event)
+		}
+	}
+	expectEvent(configEvent{Event: "config-set", Parameter: "retention", Value: "count:3"})
+
+	srv.dispatcher.Dispatch(other, command("SET", "k", "v"))
+	srv.dispatcher.Dispatch(other, command("RETENTION", "SET", "k", "ALL"))
+	expectEvent(configEvent{Event: "retention-set", Key: "k", Value: "all"})
+
+	// Clients publish to their own channels only
+	if reply := srv.dispatcher.Dispatch(other, command("PUBLISH", pubsub.ConfigChannel, "x")); reply.Type != proto.Error {
+		t.Errorf("Expected publishing to a reserved channel to fail, got %+v", reply)
+	}
+	if reply := srv.dispatcher.Dispatch(other, command("PUBLISH", "news", "hi")); reply.Int != 1 {
+		t.Errorf("Expected one receiver, got %+v", reply)
+	}
+	if msg, _ := reader.Read(); msg.Array[1].String != "news" || msg.Array[2].String != "hi" {
+		t.Errorf("Unexpected message %+v", msg)
+	}
+
+	reply = send("UNSUBSCRIBE")
+	if reply.Array[0].String != "unsubscribe" || reply.Array[2].Int != 1 {
+		t.Errorf("Unexpected UNSUBSCRIBE reply: %+v", reply)
+	}
+	if reply, _ := reader.Read(); reply.Array[2].Int != 0 {
+		t.Errorf("Expected no subscriptions left, got %+v", reply)
+	}
+	if reply := send("GET", "k"); reply.String != "v" {
+		t.Errorf("Expected commands to work again, got %+v", reply)
+	}
+}
+
+func TestSlowSubscriberEvicted(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	srv := NewServer(db, nil)
+	srv.SetOutputLimits(proto.OutputLimits{PubSub: proto.OutputLimit{Hard: 4096}})
+	client, serverConn := net.Pipe()
+	defer client.Close()
+	handled := make(chan struct{})
+	go func() {
+		srv.HandleConnection(serverConn)
+		close(handled)
+	}()
+
+	go proto.NewRESPWriter(client).WriteValue(command("SUBSCRIBE", "news"))
+	if reply, err := proto.NewRESPReader(client).Read(); err != nil || reply.Array[0].String != "subscribe" {
+		t.Fatalf("Unexpected SUBSCRIBE reply %+v, %v", reply, err)
+	}
+
+	// The subscriber stops reading while messages keep coming
+	publisher := NewClient()
+	payload := strings.Repeat("x", 512)
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case <-handled:
+			return
+		case <-deadline:
+			t.Fatal("Expected the slow subscriber to be disconnected")
+		default:
+			srv.dispatcher.Dispatch(publisher, command("PUBLISH", "news", payload))
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func TestExpireSliding(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	d.Dispatch(client, command("SET", "k", "v"))
+	if reply := d.Dispatch(client, command("EXPIRE", "k", "60", "SLIDING")); reply.Int != 1 {
+		t.Fatalf("Expected EXPIRE SLIDING to set the TTL, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("EXPIRE", "k", "60", "LATER")); reply.Type != proto.Error {
+		t.Errorf("Expected a syntax error, got %+v", reply)
+	}
+
+	stats := d.Dispatch(client, command("STATS", "KEY", "k"))
+	fields := map[string]int64{}
+	for i := 0; i+1 < len(stats.Array); i += 2 {
+		fields[stats.Array[i].String] = stats.Array[i+1].Int
+	}
+	if fields["sliding"] != 60_000 {
+		t.Errorf("Expected a sliding TTL of 60s, got %d", fields["sliding"])
+	}
+
+	if reply := d.Dispatch(client, command("CONFIG", "SET", "sliding-ttl", "session:*, cart:*")); reply.Type == proto.Error {
+		t.Fatalf("CONFIG SET sliding-ttl: %s", reply.String)
+	}
+	reply := d.Dispatch(client, command("CONFIG", "GET", "sliding-ttl"))
+	if len(reply.Array) != 2 || reply.Array[1].String != "cart:*,session:*" {
+		t.Errorf("Unexpected sliding-ttl %+v", reply)
+	}
+}
+
+func TestDeleteHistoryAndPurge(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	d.Dispatch(client, command("SET", "k", "v"))
+	d.Dispatch(client, command("DEL", "k"))
+
+	// HIST lists the delete as a version without a value
+	hist := d.Dispatch(client, command("HIST", "k"))
+	if len(hist.Array) != 2 || !hist.Array[0].Array[1].Null || hist.Array[1].Array[1].String != "v" {
+		t.Fatalf("Expected the delete on top of v, got %+v", hist)
+	}
+
+	if reply := d.Dispatch(client, command("PURGE", "k", "missing")); reply.Int != 1 {
+		t.Errorf("Expected 1 purged key, got %+v", reply)
+	}
+	if hist := d.Dispatch(client, command("HIST", "k")); len(hist.Array) != 0 {
+		t.Errorf("Expected PURGE to erase the history, got %+v", hist)
+	}
+	if reply := d.Dispatch(client, command("PURGE")); reply.Type != proto.Error {
+		t.Errorf("Expected an arity error, got %+v", reply)
+	}
+}
+
+func TestTransferCommand(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	d.Dispatch(client, command("SET", "quota:a", "10"))
+	reply := d.Dispatch(client, command("TRANSFER", "quota:a", "quota:b", "4"))
+	if len(reply.Array) != 2 || reply.Array[0].Int != 6 || reply.Array[1].Int != 4 {
+		t.Fatalf("Expected balances 6 and 4, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("TRANSFER", "quota:a", "quota:b", "7")); reply.Type != proto.Error {
+		t.Errorf("Expected an overdraft to fail, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("TRANSFER", "quota:a", "quota:b", "x")); reply.Type != proto.Error {
+		t.Errorf("Expected a non-integer amount to fail, got %+v", reply)
+	}
+}
+
+func TestSnapshotCommand(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+	other := NewClient()
+
+	d.Dispatch(client, command("SET", "a", "1"))
+	d.Dispatch(client, command("SET", "b", "1"))
+	d.Dispatch(client, command("JSON.SET", "js", "$", `{"a":1}`))
+
+	begin := d.Dispatch(client, command("SNAPSHOT", "BEGIN"))
+	if begin.Type != proto.Integer || begin.Int == 0 {
+		t.Fatalf("Expected a token from SNAPSHOT BEGIN, got %+v", begin)
+	}
+	token := strconv.FormatInt(begin.Int, 10)
+
+	d.Dispatch(other, command("SET", "a", "2"))
+	d.Dispatch(other, command("DEL", "b"))
+
+	if reply := d.Dispatch(client, command("GET", "a")); reply.String != "1" {
+		t.Errorf("Expected the snapshot value of a, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("GET", "b")); reply.Null || reply.String != "1" {
+		t.Errorf("Expected the snapshot value of b, got %+v", reply)
+	}
+	if reply := d.Dispatch(other, command("GET", "a")); reply.String != "2" {
+		t.Errorf("Expected other connections to read the latest value, got %+v", reply)
+	}
+	if reply := d.Dispatch(other, command("GET", "a", "AT", token)); reply.String != "1" {
+		t.Errorf("Expected GET AT to read at the token, got %+v", reply)
+	}
+	// Snapshot reads return JSON documents like GET
+	if reply := d.Dispatch(client, command("GET", "js")); reply.String != `{"a":1}` {
+		t.Errorf("Expected the JSON document in snapshot mode, got %+v", reply)
+	}
+	if reply := d.Dispatch(other, command("GET", "js", "AT", token)); reply.String != `{"a":1}` {
+		t.Errorf("Expected GET AT to read the JSON document, got %+v", reply)
+	}
+	if reply := d.Dispatch(other, command("GET", "a", "AT", "nope")); reply.Type != proto.Error {
+		t.Errorf("Expected an invalid token to fail, got %+v", reply)
+	}
+
+	if reply := d.Dispatch(client, command("SNAPSHOT", "END")); reply.String != "OK" {
+		t.Fatalf("Expected OK from SNAPSHOT END, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("GET", "a")); reply.String != "2" {
+		t.Errorf("Expected the latest value after SNAPSHOT END, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("SNAPSHOT", "END")); reply.Type != proto.Error {
+		t.Errorf("Expected SNAPSHOT END outside snapshot mode to fail, got %+v", reply)
+	}
+}
+
+func TestCASCommand(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	d.Dispatch(client, command("SET", "lock", "a"))
+	if reply := d.Dispatch(client, command("CAS", "lock", "b", "c")); reply.Int != 0 {
+		t.Errorf("Expected 0 for a mismatch, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("CAS", "lock", "a", "b")); reply.Int != 1 {
+		t.Errorf("Expected 1 for a match, got %+v", reply)
+	}
+
+	meta := d.Dispatch(client, command("GETMETA", "lock"))
+	hlc := strconv.FormatInt(meta.Array[5].Int, 10)
+	if reply := d.Dispatch(client, command("CAS", "lock", hlc, "c", "VERSION")); reply.Int != 1 {
+		t.Errorf("Expected 1 for the current version, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("CAS", "lock", hlc, "d", "VERSION")); reply.Int != 0 {
+		t.Errorf("Expected 0 for a stale version, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("CAS", "lock", "x", "d", "VERSION")); reply.Type != proto.Error {
+		t.Errorf("Expected an invalid version to fail, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("GET", "lock")); reply.String != "c" {
+		t.Errorf("Expected c, got %+v", reply)
+	}
+}
+
+func TestCapabilitiesCommand(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	d.stats.SetCapabilities([]info.Capability{
+		{Name: "resp", Enabled: true, Version: "3", Limits: map[string]int64{"max_clients": 10}},
+		{Name: "wasm"},
+	})
+	client := NewClient()
+
+	reply := d.Dispatch(client, command("CAPABILITIES"))
+	if reply.Type != proto.Map || len(reply.Array) != 4 || reply.Array[1].String != Version {
+		t.Fatalf("Unexpected reply %+v", reply)
+	}
+	subsystems := reply.Array[3].Array
+	if len(subsystems) != 4 || subsystems[0].String != "resp" || subsystems[2].String != "wasm" {
+		t.Fatalf("Unexpected subsystems %+v", subsystems)
+	}
+	resp := subsystems[1].Array
+	if !resp[1].Bool || resp[3].String != "3" || resp[5].Array[0].String != "max_clients" || resp[5].Array[1].Int != 10 {
+		t.Errorf("Unexpected resp subsystem %+v", resp)
+	}
+	if wasm := subsystems[3].Array; wasm[1].Bool {
+		t.Errorf("Expected wasm to be disabled, got %+v", wasm)
+	}
+
+	if reply := d.Dispatch(client, command("CAPABILITIES", "extra")); reply.Type != proto.Error {
+		t.Errorf("Expected an argument to fail, got %+v", reply)
+	}
+}
+
+func TestLockCommands(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	reply := d.Dispatch(client, command("LOCK", "lock:job", "60000"))
+	if reply.Type != proto.Integer || reply.Int <= 0 {
+		t.Fatalf("Expected a fencing token, got %+v", reply)
+	}
+	token := strconv.FormatInt(reply.Int, 10)
+
+	if reply := d.Dispatch(client, command("LOCK", "lock:job", "60000")); !reply.Null {
+		t.Errorf("Expected null for a held lock, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("LOCK", "lock:other", "-1")); reply.Type != proto.Error {
+		t.Errorf("Expected a negative TTL to fail, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("UNLOCK", "lock:job", "1")); reply.Int != 0 {
+		t.Errorf("Expected 0 for a wrong token, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("UNLOCK", "lock:job", token)); reply.Int != 1 {
+		t.Errorf("Expected 1 for the token, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("EXISTS", "lock:job")); reply.Int != 0 {
+		t.Errorf("Expected the lock to be released, got %+v", reply)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+
+	d := NewCommandDispatcher(db, nil)
+	client := NewClient()
+
+	if reply := d.Dispatch(client, command("AUTH", "token")); reply.Type != proto.Error {
+		t.Errorf("Expected AUTH without API keys to fail, got %+v", reply)
+	}
+
+	registry := apikeys.NewRegistry()
+	d.apiKeys = registry
+	tenant, tenantToken, _ := registry.Create("tenant", "tenant")
+	_, adminToken, _ := registry.Create("admin", "")
+
+	if reply := d.Dispatch(client, command("GET", "tenant:a")); !strings.HasPrefix(reply.String, "NOAUTH") {
+		t.Errorf("Expected NOAUTH before AUTH, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("AUTH", "wrong")); !strings.HasPrefix(reply.String, "WRONGPASS") {
+		t.Errorf("Expected WRONGPASS, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("AUTH", "default", tenantToken)); reply.String != "OK" {
+		t.Fatalf("Expected AUTH to succeed, got %+v", reply)
+	}
+
+	if reply := d.Dispatch(client, command("SET", "tenant:a", "1")); reply.String != "OK" {
+		t.Errorf("Expected SET in the namespace to succeed, got %+v", reply)
+	}
+	for _, args := range [][]string{
+		{"GET", "other:a"},
+		{"DEL", "tenant:a", "other:a"},
+		{"TRANSFER", "tenant:a", "other:a", "1"},
+		{"KEYS", "*"},
+	} {
+		if reply := d.Dispatch(client, command(args...)); !strings.HasPrefix(reply.String, "NOPERM") {
+			t.Errorf("Expected NOPERM for %v, got %+v", args, reply)
+		}
+	}
+
+	usage := registry.Usage(db.NamespaceBytes)
+	for _, report := range usage {
+		if report.Key.ID == tenant.ID && (report.Usage.Ops != 2 || report.Usage.StorageBytes == 0) {
+			t.Errorf("Expected AUTH and SET to be metered with storage, got %+v", report.Usage)
+		}
+	}
+
+	admin := NewClient()
+	d.Dispatch(admin, command("HELLO", "3", "AUTH", "default", adminToken))
+	if reply := d.Dispatch(admin, command("GET", "tenant:a")); reply.String != "1" {
+		t.Errorf("Expected a key without a namespace to read any key, got %+v", reply)
+	}
+
+	registry.Revoke(tenant.ID)
+	if reply := d.Dispatch(client, command("GET", "tenant:a")); !strings.HasPrefix(reply.String, "NOAUTH") {
+		t.Errorf("Expected a revoked key to stop working, got %+v", reply)
+	}
+}
+
+func TestSelectDatabases(t *testing.T) {
+	db := store.NewStore()
+	defer db.Close()
+	d := NewCommandDispatcher(db, nil)
+	client, other := NewClient(), NewClient()
+
+	d.Dispatch(client, command("SET", "k", "zero"))
+	if reply := d.Dispatch(client, command("SELECT", "16")); reply.Type != proto.Error {
+		t.Errorf("Expected an out of range index to be rejected, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("SELECT", "2")); reply.String != "OK" {
+		t.Fatalf("Unexpected SELECT reply: %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("GET", "k")); !reply.Null {
+		t.Errorf("Expected database 2 to be empty, got %+v", reply)
+	}
+	d.Dispatch(client, command("SET", "k", "two"))
+	if reply := d.Dispatch(other, command("GET", "k")); reply.String != "zero" {
+		t.Errorf("Expected other connections to stay on database 0, got %+v", reply)
+	}
+
+	if reply := d.Dispatch(client, command("COPY", "k", "k")); reply.Type != proto.Error {
+		t.Errorf("Expected copying a key onto itself to fail, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("COPY", "k", "k", "DB", "0")); reply.Int != 0 {
+		t.Errorf("Expected COPY to keep the existing key, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("COPY", "k", "k", "DB", "0", "REPLACE")); reply.Int != 1 {
+		t.Errorf("Expected COPY REPLACE to copy, got %+v", reply)
+	}
+	if reply := d.Dispatch(other, command("GET", "k")); reply.String != "two" {
+		t.Errorf("Expected the copy in database 0, got %+v", reply)
+	}
+	if reply := d.Dispatch(client, command("COPY", "missing", "x")); reply.Int != 0 {
+		t.Errorf("Expected COPY of a missing key to reply 0, got %+v", reply)
+	}
+
+	d.Dispatch(client, command("FLUSHDB"))
+	if reply := d.Dispatch(client, command("EXISTS", "k")); reply.Int != 0 {
+		t.Errorf("Expected FLUSHDB to empty database 2, got %+v", reply)
+	}
+	if reply := d.Dispatch(other, command("EXISTS", "k")); reply.Int != 1 {
+		t.Errorf("Expected FLUSHDB to leave database 0 alone, got %+v", reply)
+	}
+	d.Dispatch(client, command("FLUSHALL"))
+	if keys := db.KeyCount(); keys != 0 {
+		t.Errorf("Expected FLUSHALL to empty every database, %d keys left", keys)
+	}
+}
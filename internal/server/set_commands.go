@@ -0,0 +1,139 @@
+package server
+
+import (
+	"pulsedb/internal/proto"
+	"pulsedb/internal/store"
+)
+
+// Set command handlers
+
+func (d *CommandDispatcher) handleSAdd(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'sadd' command",
+		}
+	}
+
+	added, err := db.SAdd(args[0], args[1:]...)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+
+	return proto.RESPValue{Type: proto.Integer, Int: int64(added)}
+}
+
+func (d *CommandDispatcher) handleSRem(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'srem' command",
+		}
+	}
+
+	removed, err := db.SRem(args[0], args[1:]...)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+
+	return proto.RESPValue{Type: proto.Integer, Int: int64(removed)}
+}
+
+func (d *CommandDispatcher) handleSMembers(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 1 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'smembers' command",
+		}
+	}
+
+	members, err := db.SMembers(args[0])
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+
+	return bulkStringArray(members)
+}
+
+func (d *CommandDispatcher) handleSIsMember(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'sismember' command",
+		}
+	}
+
+	found, err := db.SIsMember(args[0], args[1])
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+
+	if found {
+		return proto.RESPValue{Type: proto.Integer, Int: 1}
+	}
+	return proto.RESPValue{Type: proto.Integer, Int: 0}
+}
+
+func (d *CommandDispatcher) handleSCard(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 1 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'scard' command",
+		}
+	}
+
+	count, err := db.SCard(args[0])
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+
+	return proto.RESPValue{Type: proto.Integer, Int: int64(count)}
+}
+
+func (d *CommandDispatcher) handleSInter(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 1 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'sinter' command",
+		}
+	}
+
+	members, err := db.SInter(args...)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+
+	return bulkStringArray(members)
+}
+
+func (d *CommandDispatcher) handleSUnion(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 1 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'sunion' command",
+		}
+	}
+
+	members, err := db.SUnion(args...)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+
+	return bulkStringArray(members)
+}
+
+func (d *CommandDispatcher) handleSDiff(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 1 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'sdiff' command",
+		}
+	}
+
+	members, err := db.SDiff(args...)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+
+	return bulkStringArray(members)
+}
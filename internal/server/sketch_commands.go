@@ -0,0 +1,146 @@
+package server
+
+import (
+	"math"
+	"strconv"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/store"
+)
+
+// Quantile sketch commands. Applications record samples such as request
+// latencies with SKETCH.ADD and read percentiles back with SKETCH.QUANTILE.
+
+func (d *CommandDispatcher) handleSketchCreate(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'sketch.create' command",
+		}
+	}
+
+	accuracy, err := parseFiniteFloat(args[1])
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: "ERR value is not a valid float"}
+	}
+	if err := db.SketchCreate(args[0], accuracy); err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
+}
+
+func (d *CommandDispatcher) handleSketchAdd(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'sketch.add' command",
+		}
+	}
+
+	values := make([]float64, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		v, err := parseFiniteFloat(arg)
+		if err != nil {
+			return proto.RESPValue{Type: proto.Error, String: "ERR value is not a valid float"}
+		}
+		values = append(values, v)
+	}
+
+	count, err := db.SketchAdd(args[0], values...)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	return proto.RESPValue{Type: proto.Integer, Int: int64(count)}
+}
+
+func (d *CommandDispatcher) handleSketchMerge(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'sketch.merge' command",
+		}
+	}
+
+	if err := db.SketchMerge(args[0], args[1:]...); err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
+}
+
+// handleSketchQuantile replies with one estimate per requested quantile, or
+// null if the sketch is missing or empty
+func (d *CommandDispatcher) handleSketchQuantile(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'sketch.quantile' command",
+		}
+	}
+
+	quantiles := make([]float64, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		q, err := parseFiniteFloat(arg)
+		if err != nil {
+			return proto.RESPValue{Type: proto.Error, String: "ERR value is not a valid float"}
+		}
+		quantiles = append(quantiles, q)
+	}
+
+	values, found, err := db.SketchQuantiles(args[0], quantiles...)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	if !found {
+		return proto.RESPValue{Type: proto.Array, Null: true}
+	}
+
+	reply := make([]proto.RESPValue, len(values))
+	for i, v := range values {
+		reply[i] = proto.RESPValue{Type: proto.Double, Float: v}
+	}
+	return proto.RESPValue{Type: proto.Array, Array: reply}
+}
+
+func (d *CommandDispatcher) handleSketchInfo(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 1 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'sketch.info' command",
+		}
+	}
+
+	summary, found, err := db.SketchInfo(args[0])
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	if !found {
+		return proto.RESPValue{Type: proto.BulkString, Null: true}
+	}
+
+	return proto.RESPValue{
+		Type: proto.Map,
+		Array: []proto.RESPValue{
+			{Type: proto.BulkString, String: "accuracy"},
+			{Type: proto.Double, Float: summary.Accuracy},
+			{Type: proto.BulkString, String: "count"},
+			{Type: proto.Integer, Int: int64(summary.Count)},
+			{Type: proto.BulkString, String: "sum"},
+			{Type: proto.Double, Float: summary.Sum},
+			{Type: proto.BulkString, String: "min"},
+			{Type: proto.Double, Float: summary.Min},
+			{Type: proto.BulkString, String: "max"},
+			{Type: proto.Double, Float: summary.Max},
+			{Type: proto.BulkString, String: "bins"},
+			{Type: proto.Integer, Int: int64(summary.Bins)},
+		},
+	}
+}
+
+// parseFiniteFloat parses a float argument, rejecting NaN and infinities
+func parseFiniteFloat(s string) (float64, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err == nil && (math.IsNaN(v) || math.IsInf(v, 0)) {
+		err = strconv.ErrSyntax
+	}
+	return v, err
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/store"
+)
+
+// handleSlowLog inspects the slow command log:
+//
+//	SLOWLOG GET [count]
+//	SLOWLOG LEN
+//	SLOWLOG RESET
+func (d *CommandDispatcher) handleSlowLog(db *store.Store, args []string) proto.RESPValue {
+	if len(args) == 0 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'slowlog' command",
+		}
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		count := 10
+		if len(args) > 1 {
+			var err error
+			if count, err = strconv.Atoi(args[1]); err != nil || count < -1 {
+				return proto.RESPValue{
+					Type:   proto.Error,
+					String: "ERR count should be greater than or equal to -1",
+				}
+			}
+		}
+
+		// Same entry layout as Redis: id, unix time, duration in
+		// microseconds, arguments, client address and client name
+		entries := d.slowlog.Get(count)
+		result := make([]proto.RESPValue, len(entries))
+		for i, entry := range entries {
+			result[i] = proto.RESPValue{
+				Type: proto.Array,
+				Array: []proto.RESPValue{
+					{Type: proto.Integer, Int: entry.ID},
+					{Type: proto.Integer, Int: entry.Time.Unix()},
+					{Type: proto.Integer, Int: entry.Duration},
+					bulkStringArray(entry.Args),
+					{Type: proto.BulkString, String: entry.ClientAddr},
+					{Type: proto.BulkString, String: entry.ClientName},
+				},
+			}
+		}
+		return proto.RESPValue{Type: proto.Array, Array: result}
+
+	case "LEN":
+		return proto.RESPValue{Type: proto.Integer, Int: int64(d.slowlog.Len())}
+
+	case "RESET":
+		d.slowlog.Reset()
+		return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
+
+	default:
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("ERR unknown subcommand '%s'", args[0]),
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/store"
+)
+
+// Snapshot reads. A snapshot token is an HLC: GET at a token sees every
+// write that completed before SNAPSHOT BEGIN and none after, on every key.
+// Tokens are only meaningful on the server that issued them.
+
+// handleSnapshot starts and ends the snapshot mode of a connection:
+//
+//	SNAPSHOT BEGIN  - returns a token; GETs read at it until SNAPSHOT END
+//	SNAPSHOT END    - makes GETs read the latest values again
+//
+// The token can also be passed to GET key AT token from any connection.
+func (d *CommandDispatcher) handleSnapshot(c *Client, args []string) proto.RESPValue {
+	if len(args) != 1 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'snapshot' command",
+		}
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "BEGIN":
+		c.snapshot = d.store.Snapshot()
+		return proto.RESPValue{Type: proto.Integer, Int: int64(c.snapshot)}
+	case "END":
+		if c.snapshot == 0 {
+			return proto.RESPValue{Type: proto.Error, String: "ERR SNAPSHOT END without SNAPSHOT BEGIN"}
+		}
+		c.snapshot = 0
+		return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
+	default:
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("ERR unknown SNAPSHOT subcommand '%s'", args[0]),
+		}
+	}
+}
+
+// parseSnapshotToken parses a token returned by SNAPSHOT BEGIN
+func parseSnapshotToken(arg string) (store.HLC, error) {
+	token, err := strconv.ParseUint(arg, 10, 64)
+	if err != nil || token == 0 {
+		return 0, fmt.Errorf("ERR invalid snapshot token")
+	}
+	return store.HLC(token), nil
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"net"
+)
+
+// SocketOptions tunes accepted TCP connections. Zero buffer sizes keep the
+// operating system defaults.
+type SocketOptions struct {
+	NoDelay       bool // Disable Nagle's algorithm (TCP_NODELAY)
+	SendBuffer    int  // SO_SNDBUF in bytes
+	ReceiveBuffer int  // SO_RCVBUF in bytes
+	QuickAck      bool // Acknowledge immediately (TCP_QUICKACK, Linux only)
+}
+
+// DefaultSocketOptions matches the Go runtime defaults
+var DefaultSocketOptions = SocketOptions{NoDelay: true}
+
+// apply sets the options on conn. Connections that are not TCP are left as is.
+func (o SocketOptions) apply(conn net.Conn) error {
+	tcp, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+
+	if err := tcp.SetNoDelay(o.NoDelay); err != nil {
+		return err
+	}
+	if o.SendBuffer > 0 {
+		if err := tcp.SetWriteBuffer(o.SendBuffer); err != nil {
+			return err
+		}
+	}
+	if o.ReceiveBuffer > 0 {
+		if err := tcp.SetReadBuffer(o.ReceiveBuffer); err != nil {
+			return err
+		}
+	}
+	if o.QuickAck {
+		return setQuickAck(tcp, true)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+//go:build linux
+
+package server
+
+import (
+	"net"
+	"syscall"
+)
+
+// quickAckSupported reports whether TCP_QUICKACK is available on this platform
+const quickAckSupported = true
+
+// setQuickAck sets TCP_QUICKACK on conn. The kernel clears the flag again
+// after it leaves quick-ack mode, so it is re-armed after every read.
+func setQuickAck(conn *net.TCPConn, enabled bool) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	value := 0
+	if enabled {
+		value = 1
+	}
+
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_QUICKACK, value)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
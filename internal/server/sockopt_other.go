@@ -0,0 +1,16 @@
+//go:build !linux
+
+package server
+
+import (
+	"errors"
+	"net"
+)
+
+// quickAckSupported reports whether TCP_QUICKACK is available on this platform
+const quickAckSupported = false
+
+// setQuickAck is unsupported outside Linux
+func setQuickAck(conn *net.TCPConn, enabled bool) error {
+	return errors.New("TCP_QUICKACK is only supported on Linux")
+}
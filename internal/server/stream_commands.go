@@ -0,0 +1,816 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/store"
+	"pulsedb/internal/streams"
+)
+
+// Streams. XREAD reads the entries of streams, and with BLOCK parks the
+// connection until new entries are appended. A consumer group delivers
+// each entry of a stream to one of its consumers and keeps it in its pending entries list until the
+// consumer acknowledges it with XACK. XPENDING inspects the list, and
+// XCLAIM/XAUTOCLAIM hand the entries of a consumer that stopped processing
+// them to another.
+
+// autoClaimCount is the default COUNT of XAUTOCLAIM
+const autoClaimCount = 100
+
+// streamError converts an error of the stream manager to a RESP error
+func streamError(err error, stream, group string) proto.RESPValue {
+	switch {
+	case errors.Is(err, streams.ErrNoGroup):
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("NOGROUP No such key '%s' or consumer group '%s'", stream, group),
+		}
+	case errors.Is(err, streams.ErrNoStream):
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR the stream does not exist, use MKSTREAM to create it with the group",
+		}
+	case errors.Is(err, streams.ErrGroupExists):
+		return proto.RESPValue{Type: proto.Error, String: "BUSYGROUP Consumer Group name already exists"}
+	case errors.Is(err, streams.ErrInvalidID):
+		return proto.RESPValue{Type: proto.Error, String: "ERR Invalid stream ID specified as stream command argument"}
+	case errors.Is(err, streams.ErrIDZero):
+		return proto.RESPValue{Type: proto.Error, String: "ERR The ID specified in XADD must be greater than 0-0"}
+	case errors.Is(err, streams.ErrIDTooSmall):
+		return proto.RESPValue{Type: proto.Error, String: "ERR The ID specified in XADD is equal or smaller than the target stream top item"}
+	case errors.Is(err, streams.ErrIDExhausted):
+		return proto.RESPValue{Type: proto.Error, String: "ERR The stream has exhausted the last possible ID, unable to add more items"}
+	}
+	return proto.RESPValue{Type: proto.Error, String: "ERR " + err.Error()}
+}
+
+// parseStreamID parses a stream ID argument. A bare millisecond time stands
+// for its first entry, or its last one if end is set, and "-" and "+" for
+// no bound, returned as an empty ID.
+func parseStreamID(arg string, end bool) (string, bool) {
+	if arg == "-" || arg == "+" {
+		return "", true
+	}
+	if streams.ValidID(arg) {
+		return arg, true
+	}
+	if _, err := strconv.ParseUint(arg, 10, 63); err != nil {
+		return "", false
+	}
+	if end {
+		return fmt.Sprintf("%s-%d", arg, int64(math.MaxInt64)), true
+	}
+	return arg + "-0", true
+}
+
+// parseMinIdle parses a min-idle-time argument in milliseconds
+func parseMinIdle(arg string) (time.Duration, bool) {
+	ms, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || ms < 0 {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+// streamEntryValue renders an entry as its ID followed by its fields, like
+// XRANGE; entries no longer in the stream have null fields
+func streamEntryValue(entry streams.StreamEntry) proto.RESPValue {
+	if entry.Fields == nil {
+		return proto.RESPValue{
+			Type: proto.Array,
+			Array: []proto.RESPValue{
+				{Type: proto.BulkString, String: entry.ID},
+				{Type: proto.Array, Null: true},
+			},
+		}
+	}
+
+	names := make([]string, 0, len(entry.Fields))
+	for name := range entry.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := make([]proto.RESPValue, 0, len(names)*2)
+	for _, name := range names {
+		fields = append(fields,
+			proto.RESPValue{Type: proto.BulkString, String: name},
+			proto.RESPValue{Type: proto.BulkString, String: entry.Fields[name]},
+		)
+	}
+	return proto.RESPValue{
+		Type: proto.Array,
+		Array: []proto.RESPValue{
+			{Type: proto.BulkString, String: entry.ID},
+			{Type: proto.Map, Array: fields},
+		},
+	}
+}
+
+// entriesValue renders stream entries, or only their IDs if justID is set
+func entriesValue(entries []streams.StreamEntry, justID bool) proto.RESPValue {
+	result := make([]proto.RESPValue, len(entries))
+	for i, entry := range entries {
+		if justID {
+			result[i] = proto.RESPValue{Type: proto.BulkString, String: entry.ID}
+		} else {
+			result[i] = streamEntryValue(entry)
+		}
+	}
+	return proto.RESPValue{Type: proto.Array, Array: result}
+}
+
+// parseTrim parses a trim strategy at the start of args:
+//
+//	MAXLEN|MINID [=|~] threshold
+//
+// It returns the policy and the number of arguments used, 0 if args do not
+// start with a strategy.
+func parseTrim(args []string) (*streams.TrimPolicy, int, proto.RESPValue, bool) {
+	if len(args) == 0 {
+		return nil, 0, proto.RESPValue{}, true
+	}
+	strategy := strings.ToUpper(args[0])
+	if strategy != "MAXLEN" && strategy != "MINID" {
+		return nil, 0, proto.RESPValue{}, true
+	}
+
+	policy := &streams.TrimPolicy{}
+	used := 1
+	if len(args) > used && (args[used] == "=" || args[used] == "~") {
+		policy.Approx = args[used] == "~"
+		used++
+	}
+	if len(args) <= used {
+		return nil, 0, proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}, false
+	}
+
+	threshold := args[used]
+	if strategy == "MINID" {
+		id, ok := parseStreamID(threshold, false)
+		if !ok || id == "" {
+			return nil, 0, proto.RESPValue{Type: proto.Error, String: "ERR Invalid stream ID specified as stream command argument"}, false
+		}
+		policy.MinID = id
+	} else {
+		n, err := strconv.Atoi(threshold)
+		if err != nil || n < 0 {
+			return nil, 0, proto.RESPValue{Type: proto.Error, String: "ERR The MAXLEN argument must be >= 0."}, false
+		}
+		policy.MaxLen = n
+	}
+	return policy, used + 1, proto.RESPValue{}, true
+}
+
+// handleXAdd appends an entry to a stream, creating the stream if needed:
+//
+//	XADD stream [MAXLEN|MINID [=|~] threshold] id|* field value [field value ...]
+//
+// "*" generates the ID from the clock, and "<ms>-*" the sequence within a
+// millisecond; an explicit ID must be greater than the last entry's. A trim
+// strategy caps the stream like XTRIM once the entry is added. It replies
+// the ID of the entry, or null if the stream's pipeline dropped it.
+func (d *CommandDispatcher) handleXAdd(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 4 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'xadd' command",
+		}
+	}
+
+	trim, used, response, ok := parseTrim(args[1:])
+	if !ok {
+		return response
+	}
+	rest := args[1+used:]
+	if len(rest) < 3 || len(rest)%2 == 0 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'xadd' command",
+		}
+	}
+
+	fields := make(map[string]string, (len(rest)-1)/2)
+	for i := 1; i < len(rest); i += 2 {
+		fields[rest[i]] = rest[i+1]
+	}
+	id, err := d.streams.AddEntryWithID(args[0], rest[0], fields, trim)
+	if errors.Is(err, streams.ErrDropped) {
+		return proto.RESPValue{Type: proto.BulkString, Null: true}
+	}
+	if err != nil {
+		return streamError(err, args[0], "")
+	}
+	return proto.RESPValue{Type: proto.BulkString, String: id}
+}
+
+// handleXTrim removes the oldest entries of a stream:
+//
+//	XTRIM stream MAXLEN|MINID [=|~] threshold
+//
+// MAXLEN keeps the last threshold entries and MINID the entries from the
+// threshold ID on. With "~" entries are only removed in chunks, so the
+// stream may stay a little longer. It replies the number of entries
+// removed.
+func (d *CommandDispatcher) handleXTrim(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 3 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'xtrim' command",
+		}
+	}
+
+	trim, used, response, ok := parseTrim(args[1:])
+	if !ok {
+		return response
+	}
+	if trim == nil || 1+used != len(args) {
+		return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+	}
+
+	removed, err := d.streams.Trim(args[0], *trim)
+	if err != nil {
+		// A missing stream has nothing to trim
+		return proto.RESPValue{Type: proto.Integer, Int: 0}
+	}
+	return proto.RESPValue{Type: proto.Integer, Int: int64(removed)}
+}
+
+// handleXRange reads the entries of a stream between two IDs, oldest first:
+//
+//	XRANGE stream start end [COUNT count]
+func (d *CommandDispatcher) handleXRange(db *store.Store, args []string) proto.RESPValue {
+	return d.xrange("xrange", args, false)
+}
+
+// handleXRevRange reads the entries of a stream between two IDs, newest
+// first:
+//
+//	XREVRANGE stream end start [COUNT count]
+func (d *CommandDispatcher) handleXRevRange(db *store.Store, args []string) proto.RESPValue {
+	return d.xrange("xrevrange", args, true)
+}
+
+// xrange runs XRANGE, or XREVRANGE if reverse is set. "-" and "+" stand
+// for the first and last entries, and a bare millisecond time for all its
+// entries.
+func (d *CommandDispatcher) xrange(cmd string, args []string, reverse bool) proto.RESPValue {
+	if len(args) != 3 && len(args) != 5 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("ERR wrong number of arguments for '%s' command", cmd),
+		}
+	}
+
+	low, high := args[1], args[2]
+	if reverse {
+		low, high = high, low
+	}
+	start, startOK := parseStreamID(low, false)
+	end, endOK := parseStreamID(high, true)
+	if !startOK || !endOK {
+		return streamError(streams.ErrInvalidID, args[0], "")
+	}
+
+	count := 0
+	if len(args) == 5 {
+		if strings.ToUpper(args[3]) != "COUNT" {
+			return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+		}
+		n, err := strconv.Atoi(args[4])
+		if err != nil || n < 0 {
+			return proto.RESPValue{Type: proto.Error, String: "ERR value is not an integer or out of range"}
+		}
+		if n == 0 {
+			return proto.RESPValue{Type: proto.Array, Array: []proto.RESPValue{}}
+		}
+		count = n
+	}
+
+	entries, err := d.streams.Range(args[0], start, end, count, reverse)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Array, Array: []proto.RESPValue{}}
+	}
+	return entriesValue(entries, false)
+}
+
+// handleXGroup manages consumer groups:
+//
+//	XGROUP CREATE stream group id|$ [MKSTREAM]
+//
+// The group delivers the entries after id, "$" meaning only new entries.
+func (d *CommandDispatcher) handleXGroup(db *store.Store, args []string) proto.RESPValue {
+	if len(args) == 0 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'xgroup' command",
+		}
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "CREATE":
+		if len(args) != 4 && len(args) != 5 {
+			break
+		}
+		mkStream := false
+		if len(args) == 5 {
+			if strings.ToUpper(args[4]) != "MKSTREAM" {
+				return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+			}
+			mkStream = true
+		}
+		startID := args[3]
+		if startID != "$" {
+			id, ok := parseStreamID(startID, false)
+			if !ok || id == "" {
+				return streamError(streams.ErrInvalidID, args[1], args[2])
+			}
+			startID = id
+		}
+		if err := d.streams.CreateConsumerGroup(args[1], args[2], startID, mkStream); err != nil {
+			return streamError(err, args[1], args[2])
+		}
+		return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
+
+	default:
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("ERR unknown subcommand '%s'", args[0]),
+		}
+	}
+
+	return proto.RESPValue{
+		Type:   proto.Error,
+		String: fmt.Sprintf("ERR wrong number of arguments for 'xgroup %s' command", strings.ToLower(args[0])),
+	}
+}
+
+// streamRead holds the arguments of XREAD and XREADGROUP after the group
+type streamRead struct {
+	count    int
+	block    time.Duration // 0 waits forever
+	blocking bool
+	keys     []string
+	ids      []string
+}
+
+// parseStreamRead parses the arguments of XREAD and XREADGROUP:
+//
+//	[COUNT count] [BLOCK milliseconds] STREAMS stream [stream ...] id [id ...]
+func parseStreamRead(cmd string, args []string) (streamRead, proto.RESPValue, bool) {
+	read := streamRead{count: math.MaxInt}
+	i := 0
+	for ; i < len(args); i++ {
+		option := strings.ToUpper(args[i])
+		if option == "STREAMS" {
+			break
+		}
+		if i+1 >= len(args) {
+			return streamRead{}, proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}, false
+		}
+		n, err := strconv.Atoi(args[i+1])
+		switch {
+		case option != "COUNT" && option != "BLOCK":
+			return streamRead{}, proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}, false
+		case err != nil || n < 0:
+			return streamRead{}, proto.RESPValue{Type: proto.Error, String: "ERR value is not an integer or out of range"}, false
+		case option == "BLOCK":
+			read.block, read.blocking = time.Duration(n)*time.Millisecond, true
+		case n > 0:
+			read.count = n
+		}
+		i++
+	}
+
+	rest := args[min(i+1, len(args)):]
+	if len(rest) == 0 || len(rest)%2 != 0 {
+		return streamRead{}, proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("ERR Unbalanced '%s' list of streams: for each stream key an ID or '$' must be specified.", cmd),
+		}, false
+	}
+	read.keys, read.ids = rest[:len(rest)/2], rest[len(rest)/2:]
+	return read, proto.RESPValue{}, true
+}
+
+// readStreams replies what read finds. If it finds nothing and the command
+// blocks, read runs again each time an entry is appended to one of the
+// streams, until it finds entries, the timeout expires or the client is
+// unblocked; then the reply is null.
+func (d *CommandDispatcher) readStreams(c *Client, r streamRead, read func() proto.RESPValue) proto.RESPValue {
+	var timeout <-chan time.Time
+	if r.blocking && r.block > 0 {
+		timer := time.NewTimer(r.block)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		// Take the channels before reading, so no append slips in between
+		appended := make([]<-chan struct{}, len(r.keys))
+		for i, key := range r.keys {
+			appended[i] = d.streams.Appended(key)
+		}
+
+		response := read()
+		if !response.Null || !r.blocking {
+			return response
+		}
+
+		waited := time.Now()
+		woken := waitAppended(appended, timeout, c.unblocked)
+		c.blocked += time.Since(waited)
+		if !woken {
+			return response
+		}
+	}
+}
+
+// waitAppended waits for one of the appended channels to be closed, and
+// reports false if timeout or cancel fire first
+func waitAppended(appended []<-chan struct{}, timeout <-chan time.Time, cancel <-chan struct{}) bool {
+	woken := make(chan struct{}, len(appended))
+	stop := make(chan struct{})
+	defer close(stop)
+	for _, ch := range appended {
+		go func() {
+			select {
+			case <-ch:
+				woken <- struct{}{}
+			case <-stop:
+			}
+		}()
+	}
+
+	select {
+	case <-woken:
+		return true
+	case <-timeout:
+		return false
+	case <-cancel:
+		return false
+	}
+}
+
+// streamsValue renders the entries read from each stream, leaving out the
+// streams without entries unless keepEmpty is set; it is null if no stream
+// is left
+func streamsValue(keys []string, entries [][]streams.StreamEntry, keepEmpty []bool) proto.RESPValue {
+	var result []proto.RESPValue
+	for i, key := range keys {
+		if len(entries[i]) == 0 && !keepEmpty[i] {
+			continue
+		}
+		result = append(result, proto.RESPValue{
+			Type: proto.Array,
+			Array: []proto.RESPValue{
+				{Type: proto.BulkString, String: key},
+				entriesValue(entries[i], false),
+			},
+		})
+	}
+	if len(result) == 0 {
+		return proto.RESPValue{Type: proto.Array, Null: true}
+	}
+	return proto.RESPValue{Type: proto.Array, Array: result}
+}
+
+// handleXRead reads the entries of streams after the given IDs:
+//
+//	XREAD [COUNT count] [BLOCK milliseconds] STREAMS stream [stream ...] id [id ...]
+//
+// The id "$" stands for the last entry of the stream when the command is
+// run. It replies null if no stream has entries; with BLOCK it first waits
+// up to the given milliseconds, 0 meaning forever, for an entry to be
+// appended to one of them.
+func (d *CommandDispatcher) handleXRead(c *Client, args []string) proto.RESPValue {
+	read, response, ok := parseStreamRead("xread", args)
+	if !ok {
+		return response
+	}
+
+	afterIDs := make([]string, len(read.ids))
+	for i, id := range read.ids {
+		if id == "$" {
+			afterIDs[i] = "0-0"
+			if last, err := d.streams.LastEntries(read.keys[i], 1); err == nil && len(last) == 1 {
+				afterIDs[i] = last[0].ID
+			}
+			continue
+		}
+		afterID, ok := parseStreamID(id, false)
+		if !ok || afterID == "" {
+			return streamError(streams.ErrInvalidID, read.keys[i], "")
+		}
+		afterIDs[i] = afterID
+	}
+
+	return d.readStreams(c, read, func() proto.RESPValue {
+		entries := make([][]streams.StreamEntry, len(read.keys))
+		for i, key := range read.keys {
+			// Streams that do not exist yet have no entries
+			entries[i], _ = d.streams.EntriesAfter(key, afterIDs[i], read.count)
+		}
+		return streamsValue(read.keys, entries, make([]bool, len(read.keys)))
+	})
+}
+
+// handleXReadGroup reads entries as a consumer of a group:
+//
+//	XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] STREAMS stream [stream ...] id [id ...]
+//
+// The id ">" delivers entries never delivered to the group, adding them to
+// the pending entries list; any other id re-reads the entries pending for
+// the consumer after it. It replies null if no stream has entries. BLOCK
+// waits for new entries like XREAD when every id is ">".
+func (d *CommandDispatcher) handleXReadGroup(c *Client, args []string) proto.RESPValue {
+	if len(args) < 6 || strings.ToUpper(args[0]) != "GROUP" {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'xreadgroup' command",
+		}
+	}
+	group, consumer := args[1], args[2]
+
+	read, response, ok := parseStreamRead("xreadgroup", args[3:])
+	if !ok {
+		return response
+	}
+
+	pending := make([]bool, len(read.ids))
+	afterIDs := make([]string, len(read.ids))
+	for i, id := range read.ids {
+		if id == ">" {
+			continue
+		}
+		afterID, ok := parseStreamID(id, false)
+		if !ok || afterID == "" {
+			return streamError(streams.ErrInvalidID, read.keys[i], group)
+		}
+		pending[i], afterIDs[i] = true, afterID
+		read.blocking = false
+	}
+
+	return d.readStreams(c, read, func() proto.RESPValue {
+		entries := make([][]streams.StreamEntry, len(read.keys))
+		for i, key := range read.keys {
+			var err error
+			if pending[i] {
+				entries[i], err = d.streams.ReadPending(key, group, consumer, afterIDs[i], read.count)
+			} else {
+				entries[i], err = d.streams.ReadGroup(key, group, consumer, read.count)
+			}
+			if err != nil {
+				return streamError(err, key, group)
+			}
+		}
+		return streamsValue(read.keys, entries, pending)
+	})
+}
+
+// handleXAck acknowledges entries of a group:
+//
+//	XACK stream group id [id ...]
+//
+// It replies the number of entries that were pending.
+func (d *CommandDispatcher) handleXAck(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 3 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'xack' command",
+		}
+	}
+	for _, id := range args[2:] {
+		if !streams.ValidID(id) {
+			return streamError(streams.ErrInvalidID, args[0], args[1])
+		}
+	}
+
+	acked, err := d.streams.Ack(args[0], args[1], args[2:])
+	if err != nil {
+		return streamError(err, args[0], args[1])
+	}
+	return proto.RESPValue{Type: proto.Integer, Int: int64(acked)}
+}
+
+// handleXPending inspects the pending entries list of a group:
+//
+//	XPENDING stream group [[IDLE min-idle-time] start end count [consumer]]
+//
+// Without a range it replies the number of pending entries, the smallest
+// and largest pending IDs and the pending entries of each consumer. With
+// one it replies the ID, consumer, idle milliseconds and delivery count of
+// each pending entry in the range.
+func (d *CommandDispatcher) handleXPending(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'xpending' command",
+		}
+	}
+	stream, group := args[0], args[1]
+
+	if len(args) == 2 {
+		summary, err := d.streams.Pending(stream, group)
+		if err != nil {
+			return streamError(err, stream, group)
+		}
+		if summary.Count == 0 {
+			return proto.RESPValue{
+				Type: proto.Array,
+				Array: []proto.RESPValue{
+					{Type: proto.Integer, Int: 0},
+					{Type: proto.BulkString, Null: true},
+					{Type: proto.BulkString, Null: true},
+					{Type: proto.Array, Null: true},
+				},
+			}
+		}
+
+		names := make([]string, 0, len(summary.Consumers))
+		for name := range summary.Consumers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		consumers := make([]proto.RESPValue, len(names))
+		for i, name := range names {
+			consumers[i] = proto.RESPValue{
+				Type: proto.Array,
+				Array: []proto.RESPValue{
+					{Type: proto.BulkString, String: name},
+					{Type: proto.BulkString, String: strconv.Itoa(summary.Consumers[name])},
+				},
+			}
+		}
+		return proto.RESPValue{
+			Type: proto.Array,
+			Array: []proto.RESPValue{
+				{Type: proto.Integer, Int: int64(summary.Count)},
+				{Type: proto.BulkString, String: summary.Lowest},
+				{Type: proto.BulkString, String: summary.Highest},
+				{Type: proto.Array, Array: consumers},
+			},
+		}
+	}
+
+	var filter streams.PendingFilter
+	rest := args[2:]
+	if strings.ToUpper(rest[0]) == "IDLE" && len(rest) > 1 {
+		idle, ok := parseMinIdle(rest[1])
+		if !ok {
+			return proto.RESPValue{Type: proto.Error, String: "ERR value is not an integer or out of range"}
+		}
+		filter.MinIdle = idle
+		rest = rest[2:]
+	}
+	if len(rest) != 3 && len(rest) != 4 {
+		return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+	}
+	var startOK, endOK bool
+	filter.Start, startOK = parseStreamID(rest[0], false)
+	filter.End, endOK = parseStreamID(rest[1], true)
+	if !startOK || !endOK {
+		return streamError(streams.ErrInvalidID, stream, group)
+	}
+	count, err := strconv.Atoi(rest[2])
+	if err != nil || count < 0 {
+		return proto.RESPValue{Type: proto.Error, String: "ERR value is not an integer or out of range"}
+	}
+	if count == 0 {
+		return proto.RESPValue{Type: proto.Array, Array: []proto.RESPValue{}}
+	}
+	filter.Count = count
+	if len(rest) == 4 {
+		filter.Consumer = rest[3]
+	}
+
+	pending, err := d.streams.PendingRange(stream, group, filter)
+	if err != nil {
+		return streamError(err, stream, group)
+	}
+	now := time.Now()
+	result := make([]proto.RESPValue, len(pending))
+	for i, p := range pending {
+		result[i] = proto.RESPValue{
+			Type: proto.Array,
+			Array: []proto.RESPValue{
+				{Type: proto.BulkString, String: p.ID},
+				{Type: proto.BulkString, String: p.Consumer},
+				{Type: proto.Integer, Int: p.Idle(now).Milliseconds()},
+				{Type: proto.Integer, Int: int64(p.DeliveryCount)},
+			},
+		}
+	}
+	return proto.RESPValue{Type: proto.Array, Array: result}
+}
+
+// handleXClaim hands pending entries idle for long enough to a consumer:
+//
+//	XCLAIM stream group consumer min-idle-time id [id ...] [JUSTID]
+//
+// It replies the claimed entries, or only their IDs with JUSTID, which
+// also leaves their delivery counts unchanged.
+func (d *CommandDispatcher) handleXClaim(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 5 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'xclaim' command",
+		}
+	}
+	stream, group, consumer := args[0], args[1], args[2]
+
+	minIdle, ok := parseMinIdle(args[3])
+	if !ok {
+		return proto.RESPValue{Type: proto.Error, String: "ERR Invalid min-idle-time argument for XCLAIM"}
+	}
+	ids := args[4:]
+	justID := strings.ToUpper(ids[len(ids)-1]) == "JUSTID"
+	if justID {
+		ids = ids[:len(ids)-1]
+	}
+	if len(ids) == 0 {
+		return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+	}
+	for _, id := range ids {
+		if !streams.ValidID(id) {
+			return streamError(streams.ErrInvalidID, stream, group)
+		}
+	}
+
+	claimed, err := d.streams.Claim(stream, group, consumer, minIdle, ids, justID)
+	if err != nil {
+		return streamError(err, stream, group)
+	}
+	return entriesValue(claimed, justID)
+}
+
+// handleXAutoClaim scans the pending entries list and claims the entries
+// idle for long enough:
+//
+//	XAUTOCLAIM stream group consumer min-idle-time start [COUNT count] [JUSTID]
+//
+// It replies the ID to pass as start to continue the scan, "0-0" once it
+// is complete, the claimed entries and the IDs of the entries dropped from
+// the list because they are no longer in the stream.
+func (d *CommandDispatcher) handleXAutoClaim(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 5 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'xautoclaim' command",
+		}
+	}
+	stream, group, consumer := args[0], args[1], args[2]
+
+	minIdle, ok := parseMinIdle(args[3])
+	if !ok {
+		return proto.RESPValue{Type: proto.Error, String: "ERR Invalid min-idle-time argument for XAUTOCLAIM"}
+	}
+	start, ok := parseStreamID(args[4], false)
+	if !ok {
+		return streamError(streams.ErrInvalidID, stream, group)
+	}
+	if start == "" {
+		start = "0-0"
+	}
+
+	count, justID := autoClaimCount, false
+	for i := 5; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); {
+		case option == "JUSTID":
+			justID = true
+		case option == "COUNT" && i+1 < len(args):
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 1 {
+				return proto.RESPValue{Type: proto.Error, String: "ERR COUNT must be > 0"}
+			}
+			count = n
+			i++
+		default:
+			return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+		}
+	}
+
+	next, claimed, deleted, err := d.streams.AutoClaim(stream, group, consumer, minIdle, start, count, justID)
+	if err != nil {
+		return streamError(err, stream, group)
+	}
+	deletedIDs := make([]proto.RESPValue, len(deleted))
+	for i, id := range deleted {
+		deletedIDs[i] = proto.RESPValue{Type: proto.BulkString, String: id}
+	}
+	return proto.RESPValue{
+		Type: proto.Array,
+		Array: []proto.RESPValue{
+			{Type: proto.BulkString, String: next},
+			entriesValue(claimed, justID),
+			{Type: proto.Array, Array: deletedIDs},
+		},
+	}
+}
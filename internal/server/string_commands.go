@@ -0,0 +1,210 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/store"
+)
+
+// String range commands. Writes produce a new version like SET.
+
+func (d *CommandDispatcher) handleAppend(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'append' command",
+		}
+	}
+
+	length, err := db.Append(args[0], args[1])
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	return proto.RESPValue{Type: proto.Integer, Int: int64(length)}
+}
+
+func (d *CommandDispatcher) handleSetRange(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 3 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'setrange' command",
+		}
+	}
+
+	offset, err := strconv.Atoi(args[1])
+	if err != nil {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR value is not an integer or out of range",
+		}
+	}
+
+	length, err := db.SetRange(args[0], offset, args[2])
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	return proto.RESPValue{Type: proto.Integer, Int: int64(length)}
+}
+
+func (d *CommandDispatcher) handleGetRange(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 3 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'getrange' command",
+		}
+	}
+
+	start, err1 := strconv.Atoi(args[1])
+	end, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR value is not an integer or out of range",
+		}
+	}
+
+	value, err := db.GetRange(args[0], start, end)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	return proto.RESPValue{Type: proto.BulkString, String: value}
+}
+
+func (d *CommandDispatcher) handleStrLen(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 1 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'strlen' command",
+		}
+	}
+
+	length, err := db.StrLen(args[0])
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	return proto.RESPValue{Type: proto.Integer, Int: int64(length)}
+}
+
+// handleTransfer moves amount between two integer counters atomically and
+// returns both new balances:
+//
+//	TRANSFER src dst amount
+func (d *CommandDispatcher) handleTransfer(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 3 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'transfer' command",
+		}
+	}
+
+	amount, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR value is not an integer or out of range",
+		}
+	}
+
+	src, dst, err := db.Transfer(args[0], args[1], amount)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	return proto.RESPValue{
+		Type: proto.Array,
+		Array: []proto.RESPValue{
+			{Type: proto.Integer, Int: src},
+			{Type: proto.Integer, Int: dst},
+		},
+	}
+}
+
+// handleCAS sets a key only if it still holds the expected value, or with
+// VERSION the expected version HLC from GETMETA (0 for a missing key), and
+// replies 1 if it did and 0 otherwise:
+//
+//	CAS key expected new [VERSION]
+func (d *CommandDispatcher) handleCAS(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 3 && len(args) != 4 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'cas' command",
+		}
+	}
+
+	var swapped bool
+	var err error
+	if len(args) == 4 {
+		if strings.ToUpper(args[3]) != "VERSION" {
+			return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+		}
+		version, perr := strconv.ParseUint(args[1], 10, 64)
+		if perr != nil {
+			return proto.RESPValue{Type: proto.Error, String: "ERR version is not an integer or out of range"}
+		}
+		swapped, err = db.CompareAndSwapVersion(args[0], store.HLC(version), args[2])
+	} else {
+		swapped, err = db.CompareAndSwap(args[0], args[1], args[2])
+	}
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	if swapped {
+		return proto.RESPValue{Type: proto.Integer, Int: 1}
+	}
+	return proto.RESPValue{Type: proto.Integer, Int: 0}
+}
+
+// handleLock takes a lock for ttl milliseconds and replies with its fencing
+// token, or null if the lock is held:
+//
+//	LOCK key ttl
+func (d *CommandDispatcher) handleLock(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'lock' command",
+		}
+	}
+
+	ttl, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR value is not an integer or out of range",
+		}
+	}
+
+	token, acquired, err := db.Lock(args[0], ttl)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	if !acquired {
+		return proto.RESPValue{Type: proto.BulkString, Null: true}
+	}
+	return proto.RESPValue{Type: proto.Integer, Int: int64(token)}
+}
+
+// handleUnlock releases a lock if it is still held with token, replying 1
+// if it was released and 0 otherwise:
+//
+//	UNLOCK key token
+func (d *CommandDispatcher) handleUnlock(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'unlock' command",
+		}
+	}
+
+	token, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: "ERR invalid fencing token"}
+	}
+
+	if db.Unlock(args[0], store.HLC(token)) {
+		return proto.RESPValue{Type: proto.Integer, Int: 1}
+	}
+	return proto.RESPValue{Type: proto.Integer, Int: 0}
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"fmt"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/throttle"
+)
+
+// keyIndex gives the argument holding the key of each keyed command. The
+// namespace of that key decides which bandwidth quota the command is
+// charged to; commands missing from the table are never throttled.
+var keyIndex = map[string]int{
+	"SET":             0,
+	"GET":             0,
+	"GETSET":          0,
+	"GETDEL":          0,
+	"GETEX":           0,
+	"GETMETA":         0,
+	"APPEND":          0,
+	"SETRANGE":        0,
+	"TRANSFER":        0,
+	"CAS":             0,
+	"LOCK":            0,
+	"UNLOCK":          0,
+	"GETRANGE":        0,
+	"STRLEN":          0,
+	"DEL":             0,
+	"PURGE":           0,
+	"EXPIRE":          0,
+	"TTL":             0,
+	"GETAT":           0,
+	"GETVERSION":      0,
+	"HIST":            0,
+	"HISTRANGE":       0,
+	"HISTSCAN":        0,
+	"HISTDIFF":        0,
+	"STATS":           1,
+	"OBJECT":          1,
+	"MEMORY":          1,
+	"EXISTS":          0,
+	"TYPE":            0,
+	"RENAME":          0,
+	"RENAMENX":        0,
+	"PERSIST":         0,
+	"DUMP":            0,
+	"RESTORE":         0,
+	"COPY":            0,
+	"JSON.SET":        0,
+	"JSON.GET":        0,
+	"JSON.DEL":        0,
+	"JSON.NUMINCRBY":  0,
+	"SKETCH.CREATE":   0,
+	"SKETCH.ADD":      0,
+	"SKETCH.MERGE":    0,
+	"SKETCH.QUANTILE": 0,
+	"SKETCH.INFO":     0,
+	"SADD":            0,
+	"SREM":            0,
+	"SMEMBERS":        0,
+	"SISMEMBER":       0,
+	"SCARD":           0,
+	"SINTER":          0,
+	"SUNION":          0,
+	"SDIFF":           0,
+	"ZADD":            0,
+	"ZREM":            0,
+	"ZSCORE":          0,
+	"ZRANK":           0,
+	"ZCARD":           0,
+	"ZRANGE":          0,
+	"ZRANGEBYSCORE":   0,
+}
+
+// throttledNamespace returns the namespace cmd is charged to, or "" if the
+// command is not subject to a quota
+func (d *CommandDispatcher) throttledNamespace(cmd string, args []string) string {
+	i, keyed := keyIndex[cmd]
+	if !keyed || i >= len(args) {
+		return ""
+	}
+	ns := throttle.Namespace(args[i])
+	if !d.throttle.Limited(ns) {
+		return ""
+	}
+	return ns
+}
+
+// admit charges the request to the inbound quota of ns, returning a
+// THROTTLED error if the namespace is over either quota
+func (d *CommandDispatcher) admit(ns, cmd string, args []string) (proto.RESPValue, bool) {
+	size := int64(len(cmd))
+	for _, arg := range args {
+		size += int64(len(arg))
+	}
+
+	direction, ok := d.throttle.Admit(ns, size)
+	if !ok {
+		d.metrics.IncrementThrottled(ns, direction.String())
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("THROTTLED namespace '%s' is over its %s bandwidth quota, retry later", ns, direction),
+		}, false
+	}
+	d.metrics.AddNamespaceBytes(ns, throttle.In.String(), size)
+	return proto.RESPValue{}, true
+}
+
+// chargeReply charges the encoded size of response to the outbound quota of ns
+func (d *CommandDispatcher) chargeReply(ns string, client *Client, response proto.RESPValue) {
+	encoded, err := proto.AppendValueProtocol(nil, response, d.replyProtocol(client))
+	if err != nil {
+		return
+	}
+	size := int64(len(encoded))
+	d.throttle.Charge(ns, size)
+	d.metrics.AddNamespaceBytes(ns, throttle.Out.String(), size)
+}
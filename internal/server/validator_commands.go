@@ -0,0 +1,84 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/schema"
+	"pulsedb/internal/store"
+)
+
+// handleValidator manages write-time validators:
+//
+//	VALIDATOR SET pattern JSONSCHEMA <schema>
+//	VALIDATOR DEL pattern
+//	VALIDATOR LIST
+func (d *CommandDispatcher) handleValidator(db *store.Store, args []string) proto.RESPValue {
+	if len(args) == 0 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'validator' command",
+		}
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "SET":
+		if len(args) != 4 {
+			return proto.RESPValue{
+				Type:   proto.Error,
+				String: "ERR wrong number of arguments for 'validator set' command",
+			}
+		}
+		if strings.ToUpper(args[2]) != "JSONSCHEMA" {
+			return proto.RESPValue{
+				Type:   proto.Error,
+				String: fmt.Sprintf("ERR unsupported validator kind '%s'", args[2]),
+			}
+		}
+
+		compiled, err := schema.Compile(args[3])
+		if err != nil {
+			return proto.RESPValue{
+				Type:   proto.Error,
+				String: fmt.Sprintf("ERR %s", err.Error()),
+			}
+		}
+
+		db.SetValidator(args[1], compiled)
+		return proto.RESPValue{Type: proto.SimpleString, String: "OK"}
+
+	case "DEL":
+		if len(args) != 2 {
+			return proto.RESPValue{
+				Type:   proto.Error,
+				String: "ERR wrong number of arguments for 'validator del' command",
+			}
+		}
+		if db.RemoveValidator(args[1]) {
+			return proto.RESPValue{Type: proto.Integer, Int: 1}
+		}
+		return proto.RESPValue{Type: proto.Integer, Int: 0}
+
+	case "LIST":
+		patterns := db.ValidatorPatterns()
+		result := make([]proto.RESPValue, 0, len(patterns)*2)
+		for _, pattern := range patterns {
+			v, exists := db.Validator(pattern)
+			if !exists {
+				continue
+			}
+			result = append(result,
+				proto.RESPValue{Type: proto.BulkString, String: pattern},
+				proto.RESPValue{Type: proto.BulkString, String: fmt.Sprint(v)},
+			)
+		}
+		return proto.RESPValue{Type: proto.Array, Array: result}
+
+	default:
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: fmt.Sprintf("ERR unknown subcommand '%s'", args[0]),
+		}
+	}
+}
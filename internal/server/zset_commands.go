@@ -0,0 +1,243 @@
+package server
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"pulsedb/internal/proto"
+	"pulsedb/internal/store"
+)
+
+// Sorted set command handlers
+
+func (d *CommandDispatcher) handleZAdd(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 3 || len(args)%2 != 1 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'zadd' command",
+		}
+	}
+
+	members := make([]store.ZMember, 0, (len(args)-1)/2)
+	for i := 1; i < len(args); i += 2 {
+		score, err := strconv.ParseFloat(args[i], 64)
+		if err != nil || math.IsNaN(score) {
+			return proto.RESPValue{
+				Type:   proto.Error,
+				String: "ERR value is not a valid float",
+			}
+		}
+		members = append(members, store.ZMember{Member: args[i+1], Score: score})
+	}
+
+	added, err := db.ZAdd(args[0], members...)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+
+	return proto.RESPValue{Type: proto.Integer, Int: int64(added)}
+}
+
+func (d *CommandDispatcher) handleZRem(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'zrem' command",
+		}
+	}
+
+	removed, err := db.ZRem(args[0], args[1:]...)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+
+	return proto.RESPValue{Type: proto.Integer, Int: int64(removed)}
+}
+
+func (d *CommandDispatcher) handleZScore(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'zscore' command",
+		}
+	}
+
+	score, found, err := db.ZScore(args[0], args[1])
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	if !found {
+		return proto.RESPValue{Type: proto.BulkString, Null: true}
+	}
+
+	return proto.RESPValue{Type: proto.Double, Float: score}
+}
+
+func (d *CommandDispatcher) handleZRank(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 2 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'zrank' command",
+		}
+	}
+
+	rank, found, err := db.ZRank(args[0], args[1])
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+	if !found {
+		return proto.RESPValue{Type: proto.BulkString, Null: true}
+	}
+
+	return proto.RESPValue{Type: proto.Integer, Int: int64(rank)}
+}
+
+func (d *CommandDispatcher) handleZCard(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 1 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'zcard' command",
+		}
+	}
+
+	count, err := db.ZCard(args[0])
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+
+	return proto.RESPValue{Type: proto.Integer, Int: int64(count)}
+}
+
+func (d *CommandDispatcher) handleZRange(db *store.Store, args []string) proto.RESPValue {
+	if len(args) != 3 && len(args) != 4 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'zrange' command",
+		}
+	}
+
+	start, err1 := strconv.Atoi(args[1])
+	stop, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR value is not an integer or out of range",
+		}
+	}
+
+	withScores := false
+	if len(args) == 4 {
+		if strings.ToUpper(args[3]) != "WITHSCORES" {
+			return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+		}
+		withScores = true
+	}
+
+	members, err := db.ZRange(args[0], start, stop)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+
+	return zmemberArray(members, withScores)
+}
+
+func (d *CommandDispatcher) handleZRangeByScore(db *store.Store, args []string) proto.RESPValue {
+	if len(args) < 3 {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR wrong number of arguments for 'zrangebyscore' command",
+		}
+	}
+
+	min, err1 := parseScoreBound(args[1])
+	max, err2 := parseScoreBound(args[2])
+	if err1 != nil || err2 != nil {
+		return proto.RESPValue{
+			Type:   proto.Error,
+			String: "ERR min or max is not a float",
+		}
+	}
+
+	withScores := false
+	offset, count := 0, -1
+
+	// Parse optional WITHSCORES and LIMIT offset count
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "WITHSCORES":
+			withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+			}
+			var err error
+			if offset, err = strconv.Atoi(args[i+1]); err != nil {
+				return proto.RESPValue{
+					Type:   proto.Error,
+					String: "ERR value is not an integer or out of range",
+				}
+			}
+			if count, err = strconv.Atoi(args[i+2]); err != nil {
+				return proto.RESPValue{
+					Type:   proto.Error,
+					String: "ERR value is not an integer or out of range",
+				}
+			}
+			i += 2
+		default:
+			return proto.RESPValue{Type: proto.Error, String: "ERR syntax error"}
+		}
+	}
+
+	if offset < 0 {
+		return proto.RESPValue{Type: proto.Array, Array: []proto.RESPValue{}}
+	}
+
+	members, err := db.ZRangeByScore(args[0], min, max, offset, count)
+	if err != nil {
+		return proto.RESPValue{Type: proto.Error, String: err.Error()}
+	}
+
+	return zmemberArray(members, withScores)
+}
+
+// parseScoreBound parses a score range bound such as "1.5", "(1.5", "-inf" or "+inf"
+func parseScoreBound(s string) (store.ScoreBound, error) {
+	var bound store.ScoreBound
+	if strings.HasPrefix(s, "(") {
+		bound.Exclusive = true
+		s = s[1:]
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(value) {
+		return bound, strconv.ErrSyntax
+	}
+
+	bound.Value = value
+	return bound, nil
+}
+
+// formatScore formats a score the way it is returned to clients
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
+
+// zmemberArray builds a RESP array of members, interleaved with scores if requested
+func zmemberArray(members []store.ZMember, withScores bool) proto.RESPValue {
+	size := len(members)
+	if withScores {
+		size *= 2
+	}
+
+	result := make([]proto.RESPValue, 0, size)
+	for _, m := range members {
+		result = append(result, proto.RESPValue{Type: proto.BulkString, String: m.Member})
+		if withScores {
+			result = append(result, proto.RESPValue{Type: proto.BulkString, String: formatScore(m.Score)})
+		}
+	}
+
+	return proto.RESPValue{Type: proto.Array, Array: result}
+}
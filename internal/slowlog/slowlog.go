@@ -0,0 +1,132 @@
+package slowlog
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultThreshold = 10 * time.Millisecond
+	DefaultMaxLen    = 128
+
+	// Arguments are truncated like Redis does, to bound memory per entry
+	maxArgs      = 32
+	maxArgLength = 128
+)
+
+// Entry is a command that took longer than the threshold
+type Entry struct {
+	ID         int64     `json:"id"`
+	Time       time.Time `json:"time"`
+	Duration   int64     `json:"duration_us"` // Microseconds
+	Args       []string  `json:"args"`
+	ClientAddr string    `json:"client_addr"`
+	ClientName string    `json:"client_name"`
+}
+
+// Log is a fixed-size ring buffer of slow commands, safe for concurrent use
+type Log struct {
+	threshold time.Duration // Negative disables logging; immutable
+
+	mu      sync.Mutex
+	entries []Entry // Ring buffer
+	next    int     // Position of the next write
+	count   int
+	nextID  int64
+}
+
+// New creates a slow log keeping the maxLen most recent commands slower
+// than threshold. A negative threshold disables logging.
+func New(threshold time.Duration, maxLen int) *Log {
+	if maxLen < 1 {
+		maxLen = 1
+	}
+	return &Log{
+		threshold: threshold,
+		entries:   make([]Entry, maxLen),
+	}
+}
+
+// Record logs the command cmd with args if it ran for longer than the
+// threshold. Fast commands return without locking or allocating.
+func (l *Log) Record(cmd string, args []string, duration time.Duration, clientAddr, clientName string) {
+	if l == nil || l.threshold < 0 || duration < l.threshold {
+		return
+	}
+
+	entryArgs := truncate(append([]string{cmd}, args...))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries[l.next] = Entry{
+		ID:         l.nextID,
+		Time:       time.Now(),
+		Duration:   duration.Microseconds(),
+		Args:       entryArgs,
+		ClientAddr: clientAddr,
+		ClientName: clientName,
+	}
+	l.nextID++
+	l.next = (l.next + 1) % len(l.entries)
+	if l.count < len(l.entries) {
+		l.count++
+	}
+}
+
+// Get returns up to n entries, newest first. A negative n returns all.
+func (l *Log) Get(n int) []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if n < 0 || n > l.count {
+		n = l.count
+	}
+
+	result := make([]Entry, n)
+	for i := 0; i < n; i++ {
+		pos := (l.next - 1 - i + len(l.entries)) % len(l.entries)
+		result[i] = l.entries[pos]
+	}
+	return result
+}
+
+// Len returns the number of entries in the log
+func (l *Log) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.count
+}
+
+// Reset clears the log
+func (l *Log) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i := range l.entries {
+		l.entries[i] = Entry{}
+	}
+	l.next = 0
+	l.count = 0
+}
+
+// truncate copies args, shortening long arguments and argument lists
+func truncate(args []string) []string {
+	n := len(args)
+	if n > maxArgs {
+		n = maxArgs - 1
+	}
+
+	result := make([]string, 0, n+1)
+	for _, arg := range args[:n] {
+		if len(arg) > maxArgLength {
+			arg = fmt.Sprintf("%s... (%d more bytes)", arg[:maxArgLength], len(arg)-maxArgLength)
+		}
+		result = append(result, arg)
+	}
+	if n < len(args) {
+		result = append(result, fmt.Sprintf("... (%d more arguments)", len(args)-n))
+	}
+	return result
+}
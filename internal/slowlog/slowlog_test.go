@@ -0,0 +1,43 @@
+package slowlog
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLog(t *testing.T) {
+	log := New(time.Millisecond, 2)
+
+	log.Record("GET", []string{"fast"}, time.Microsecond, "", "")
+	log.Record("GET", []string{"a"}, 2*time.Millisecond, "127.0.0.1:1", "worker")
+	log.Record("GET", []string{"b"}, 3*time.Millisecond, "", "")
+	log.Record("GET", []string{"c"}, 4*time.Millisecond, "", "")
+
+	if log.Len() != 2 {
+		t.Fatalf("Expected the ring buffer to hold 2 entries, got %d", log.Len())
+	}
+
+	entries := log.Get(-1)
+	if entries[0].Args[1] != "c" || entries[1].Args[1] != "b" {
+		t.Errorf("Expected newest entries first, got %+v", entries)
+	}
+	if entries[0].ID != 2 || entries[0].Duration != 4000 {
+		t.Errorf("Unexpected entry %+v", entries[0])
+	}
+
+	long := make([]string, 40)
+	for i := range long {
+		long[i] = strings.Repeat("x", 200)
+	}
+	log.Record(long[0], long[1:], time.Second, "", "")
+	args := log.Get(1)[0].Args
+	if len(args) != 32 || !strings.HasSuffix(args[0], "(72 more bytes)") || args[31] != "... (9 more arguments)" {
+		t.Errorf("Expected truncated arguments, got %d args ending with %q", len(args), args[len(args)-1])
+	}
+
+	log.Reset()
+	if log.Len() != 0 || len(log.Get(10)) != 0 {
+		t.Error("Expected empty log after reset")
+	}
+}
@@ -0,0 +1,166 @@
+package store
+
+import (
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// Access frequency is tracked with a logarithmic counter like Redis LFU: it
+// saturates at 255, grows more slowly the higher it is, and loses one point
+// for every minute the key goes untouched. New keys start at lfuInitValue
+// so they are not the first to look cold.
+const (
+	lfuInitValue   = 5
+	lfuLogFactor   = 10
+	lfuDecayPeriod = 60_000 // Milliseconds per point of decay
+)
+
+// KeyStats holds operational statistics for a single key
+type KeyStats struct {
+	Type       ValueType
+	Reads      int64
+	Writes     int64
+	LastAccess int64 // Unix milliseconds of the last read or write
+	Freq       int   // Logarithmic access frequency, 0-255
+	Versions   int
+	Bytes      int64  // Approximate bytes held by the key and all its versions
+	Encoding   string // How the latest version is stored, see Value.encoding
+	TTL        int64  // Remaining milliseconds, -1 if the key has no expiration
+	Sliding    int64  // Milliseconds each read extends the TTL by, 0 if fixed
+}
+
+// recordRead counts a read of the key without taking any lock
+func (h *KeyHistory) recordRead(now int64) {
+	h.reads.Add(1)
+	h.lastAccess.Store(now)
+	h.touchFrequency(now)
+}
+
+// recordWrite counts a write of the key without taking any lock
+func (h *KeyHistory) recordWrite(now int64) {
+	h.writes.Add(1)
+	h.lastAccess.Store(now)
+	h.touchFrequency(now)
+}
+
+// touchFrequency decays the access frequency and increments it with a
+// probability falling as it grows. The counter is packed with the minute it
+// was last decayed and updated with a single compare-and-swap; an update
+// lost to a concurrent access only makes the estimate slightly low.
+func (h *KeyHistory) touchFrequency(now int64) {
+	old := h.lfu.Load()
+	counter := decayFrequency(old, now)
+	if counter < 255 {
+		base := max(counter-lfuInitValue, 0)
+		if rand.Float64() < 1/float64(base*lfuLogFactor+1) {
+			counter++
+		}
+	}
+	h.lfu.CompareAndSwap(old, uint64(now/lfuDecayPeriod)<<8|counter)
+}
+
+// frequency returns the access frequency of the key as of now
+func (h *KeyHistory) frequency(now int64) int {
+	return int(decayFrequency(h.lfu.Load(), now))
+}
+
+// decayFrequency unpacks a frequency counter and applies the decay due by
+// now. A zero value is a key that has never been accessed.
+func decayFrequency(packed uint64, now int64) uint64 {
+	if packed == 0 {
+		return lfuInitValue
+	}
+	counter, minute := packed&0xff, packed>>8
+	if current := uint64(now / lfuDecayPeriod); current > minute {
+		if elapsed := current - minute; elapsed < counter {
+			return counter - elapsed
+		}
+		return 0
+	}
+	return counter
+}
+
+// size returns the approximate number of bytes held by a version
+func (v *Value) size() int64 {
+	size := int64(len(v.Data)) + 24 // Data plus timestamp, TTL and type
+	for member := range v.Set {
+		size += int64(len(member))
+	}
+	if v.ZSet != nil {
+		for member := range v.ZSet.scores {
+			size += int64(len(member)) + 8
+		}
+	}
+	if v.Sketch != nil {
+		// Each bin is an index and a count
+		size += int64(len(v.Sketch.positive)+len(v.Sketch.negative)) * 16
+	}
+	return size
+}
+
+// encoding names how a version is stored, in the terms of Redis OBJECT
+// ENCODING where they apply: strings are "int" when they hold a 64-bit
+// integer, "embstr" up to 44 bytes and "raw" beyond
+func (v *Value) encoding() string {
+	switch v.Type {
+	case TypeSet:
+		return "hashtable"
+	case TypeZSet:
+		return "skiplist"
+	case TypeJSON:
+		return "json"
+	case TypeSketch:
+		return "ddsketch"
+	}
+	if _, err := strconv.ParseInt(v.Data, 10, 64); err == nil {
+		return "int"
+	}
+	if len(v.Data) <= 44 {
+		return "embstr"
+	}
+	return "raw"
+}
+
+// KeyStats returns operational statistics for a live key
+func (s *Store) KeyStats(key string) (KeyStats, bool) {
+	now := time.Now().UnixMilli()
+	shard := s.getShard(key)
+
+	shard.mu.RLock()
+	history, exists := shard.data[key]
+	shard.mu.RUnlock()
+
+	if !exists {
+		return KeyStats{}, false
+	}
+
+	history.mu.RLock()
+	defer history.mu.RUnlock()
+
+	latest := history.latest(now)
+	if latest == nil {
+		return KeyStats{}, false
+	}
+
+	stats := KeyStats{
+		Type:       latest.Type,
+		Reads:      history.reads.Load(),
+		Writes:     history.writes.Load(),
+		LastAccess: history.lastAccess.Load(),
+		Freq:       history.frequency(now),
+		Versions:   len(history.Versions),
+		Bytes:      int64(len(key)),
+		Encoding:   latest.encoding(),
+		TTL:        -1,
+		Sliding:    history.sliding.Load(),
+	}
+	for i := range history.Versions {
+		stats.Bytes += history.Versions[i].size()
+	}
+	if expiration := history.expiration(latest); expiration > 0 {
+		stats.TTL = expiration - now
+	}
+
+	return stats, true
+}
@@ -0,0 +1,226 @@
+package store
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"pulsedb/internal/throttle"
+)
+
+const (
+	AmplificationBucket       = time.Minute // Granularity of the write amplification report
+	amplificationBuckets      = 60          // Buckets kept, bounding the report window to an hour
+	amplificationMaxNamespace = 1024        // Namespaces tracked before the rest are grouped
+	amplificationOther        = "(other)"   // Group of the namespaces beyond the limit
+)
+
+// MaxAmplificationWindow is the longest window the report can cover
+const MaxAmplificationWindow = amplificationBuckets * AmplificationBucket
+
+// NamespaceAmplification compares the versions written to a namespace (the
+// key prefix before the first ':') with the keys and versions it holds
+type NamespaceAmplification struct {
+	Namespace string `json:"namespace"`
+	Created   int64  `json:"created"`  // Versions written in the window
+	Pruned    int64  `json:"pruned"`   // Versions dropped by retention in the window
+	Keys      int    `json:"keys"`     // Live keys now
+	Retained  int    `json:"retained"` // Versions held by the live keys now
+}
+
+// Amplification returns the versions written per live key
+func (n NamespaceAmplification) Amplification() float64 {
+	if n.Keys == 0 {
+		return float64(n.Created)
+	}
+	return float64(n.Created) / float64(n.Keys)
+}
+
+// KeyAmplification describes how much of a key's history retention dropped
+// since the key was created
+type KeyAmplification struct {
+	Key       string `json:"key"`
+	Created   int64  `json:"created"`
+	Pruned    int64  `json:"pruned"`
+	Retained  int    `json:"retained"`
+	Retention string `json:"retention"`
+}
+
+// AmplificationReport is the write amplification of the store over a window
+type AmplificationReport struct {
+	Window     time.Duration
+	Namespaces []NamespaceAmplification // Most written first
+	Keys       []KeyAmplification       // Most pruned first
+}
+
+// amplificationBucketCounts holds the versions written and pruned in one
+// bucket of time
+type amplificationBucketCounts struct {
+	start   int64 // Unix milliseconds
+	created int64
+	pruned  int64
+}
+
+type amplificationRing struct {
+	mu      sync.Mutex
+	buckets [amplificationBuckets]amplificationBucketCounts
+}
+
+// amplificationTracker counts versions written and pruned per namespace in
+// a ring of one-minute buckets
+type amplificationTracker struct {
+	mu         sync.RWMutex
+	namespaces map[string]*amplificationRing
+}
+
+// record counts created and pruned versions of key at now
+func (t *amplificationTracker) record(key string, now int64, created, pruned int) {
+	if created == 0 && pruned == 0 {
+		return
+	}
+
+	ring := t.ring(throttle.Namespace(key))
+	start := now - now%AmplificationBucket.Milliseconds()
+	slot := &ring.buckets[(start/AmplificationBucket.Milliseconds())%amplificationBuckets]
+
+	ring.mu.Lock()
+	defer ring.mu.Unlock()
+	if slot.start != start {
+		*slot = amplificationBucketCounts{start: start}
+	}
+	slot.created += int64(created)
+	slot.pruned += int64(pruned)
+}
+
+// ring returns the ring of namespace, creating it if needed
+func (t *amplificationTracker) ring(namespace string) *amplificationRing {
+	t.mu.RLock()
+	ring, ok := t.namespaces[namespace]
+	t.mu.RUnlock()
+	if ok {
+		return ring
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if ring, ok := t.namespaces[namespace]; ok {
+		return ring
+	}
+	if t.namespaces == nil {
+		t.namespaces = make(map[string]*amplificationRing)
+	}
+	if len(t.namespaces) >= amplificationMaxNamespace {
+		namespace = amplificationOther
+		if ring, ok := t.namespaces[namespace]; ok {
+			return ring
+		}
+	}
+	ring = &amplificationRing{}
+	t.namespaces[namespace] = ring
+	return ring
+}
+
+// totals sums the buckets starting at or after since, per namespace
+func (t *amplificationTracker) totals(since int64) map[string]*NamespaceAmplification {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	totals := make(map[string]*NamespaceAmplification, len(t.namespaces))
+	for namespace, ring := range t.namespaces {
+		total := &NamespaceAmplification{Namespace: namespace}
+		ring.mu.Lock()
+		for _, bucket := range ring.buckets {
+			if bucket.start >= since {
+				total.Created += bucket.created
+				total.Pruned += bucket.pruned
+			}
+		}
+		ring.mu.Unlock()
+		totals[namespace] = total
+	}
+	return totals
+}
+
+// pruneHistory applies the retention policy of history at now and counts
+// the versions it drops. The caller must hold the history write lock.
+func (s *Store) pruneHistory(key string, history *KeyHistory, now int64) int {
+	before := len(history.Versions)
+	history.Versions = s.retentionOf(history).prune(history.Versions, now)
+	pruned := before - len(history.Versions)
+	if pruned > 0 {
+		history.publishCurrent()
+		history.pruned.Add(int64(pruned))
+		s.amplification.record(key, now, 0, pruned)
+	}
+	return pruned
+}
+
+// Amplification reports how many versions each namespace wrote and retention
+// pruned over the window, which is rounded up to whole buckets and capped at
+// MaxAmplificationWindow, against the keys and versions it holds now. It also
+// lists up to count keys whose retention dropped the most versions.
+func (s *Store) Amplification(window time.Duration, count int) AmplificationReport {
+	window = min(max(window, AmplificationBucket), MaxAmplificationWindow)
+	now := time.Now().UnixMilli()
+	bucket := AmplificationBucket.Milliseconds()
+	buckets := (window.Milliseconds() + bucket - 1) / bucket
+	since := now - now%bucket - (buckets-1)*bucket
+
+	totals := s.amplification.totals(since)
+	keys := []KeyAmplification{}
+
+	for _, shard := range s.shards {
+		shard.mu.RLock()
+		for key, history := range shard.data {
+			history.mu.RLock()
+			if history.latest(now) != nil {
+				namespace := throttle.Namespace(key)
+				total, ok := totals[namespace]
+				if !ok {
+					total = &NamespaceAmplification{Namespace: namespace}
+					totals[namespace] = total
+				}
+				total.Keys++
+				total.Retained += len(history.Versions)
+
+				if pruned := history.pruned.Load(); pruned > 0 {
+					keys = append(keys, KeyAmplification{
+						Key:       key,
+						Created:   history.created.Load(),
+						Pruned:    pruned,
+						Retained:  len(history.Versions),
+						Retention: s.retentionOf(history).String(),
+					})
+				}
+			}
+			history.mu.RUnlock()
+		}
+		shard.mu.RUnlock()
+	}
+
+	report := AmplificationReport{
+		Window:     time.Duration(buckets) * AmplificationBucket,
+		Namespaces: make([]NamespaceAmplification, 0, len(totals)),
+	}
+	for _, total := range totals {
+		if total.Created > 0 || total.Keys > 0 {
+			report.Namespaces = append(report.Namespaces, *total)
+		}
+	}
+	sort.Slice(report.Namespaces, func(i, j int) bool {
+		a, b := report.Namespaces[i], report.Namespaces[j]
+		if a.Created != b.Created {
+			return a.Created > b.Created
+		}
+		return a.Namespace < b.Namespace
+	})
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Pruned != keys[j].Pruned {
+			return keys[i].Pruned > keys[j].Pruned
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	report.Keys = keys[:min(max(count, 0), len(keys))]
+	return report
+}
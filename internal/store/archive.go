@@ -0,0 +1,152 @@
+package store
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Reasons recorded with archived keys
+const (
+	ArchiveExpired = "expired" // The key's TTL elapsed
+	ArchiveEvicted = "evicted" // The key's time bucket was dropped
+)
+
+// ArchivedKey is the final version of a key removed by the store itself
+type ArchivedKey struct {
+	Key        string
+	Value      Value
+	Reason     string
+	ArchivedAt int64 // Unix milliseconds
+}
+
+// ArchiveSink receives the final value of removed keys. Archive is called
+// outside every store lock, one key at a time per shard.
+type ArchiveSink interface {
+	Archive(entry ArchivedKey) error
+	String() string
+}
+
+// ArchiveRule is an archive registration and its counters
+type ArchiveRule struct {
+	Pattern  string
+	Sink     ArchiveSink
+	Archived int64
+	Failed   int64
+}
+
+type archiveRule struct {
+	sink     ArchiveSink
+	archived atomic.Int64
+	failed   atomic.Int64
+}
+
+// archives holds the archive rules by key pattern
+type archives struct {
+	mu    sync.RWMutex
+	rules map[string]*archiveRule
+}
+
+// SetArchive archives keys matching pattern into sink when they expire or
+// are evicted, replacing any sink previously registered for the pattern.
+// Keys removed with DEL are not archived.
+func (s *Store) SetArchive(pattern string, sink ArchiveSink) {
+	// The databases share the rule, so its counters cover all of them
+	rule := &archiveRule{sink: sink}
+	s.databases.configure(func(db *Store) {
+		db.archives.mu.Lock()
+		defer db.archives.mu.Unlock()
+		db.archives.rules[pattern] = rule
+	})
+}
+
+// RemoveArchive unregisters the archive sink for pattern
+func (s *Store) RemoveArchive(pattern string) (removed bool) {
+	s.databases.configure(func(db *Store) {
+		db.archives.mu.Lock()
+		defer db.archives.mu.Unlock()
+
+		if _, exists := db.archives.rules[pattern]; exists {
+			delete(db.archives.rules, pattern)
+			removed = true
+		}
+	})
+	return removed
+}
+
+// Archives returns the archive rules sorted by pattern
+func (s *Store) Archives() []ArchiveRule {
+	s.archives.mu.RLock()
+	defer s.archives.mu.RUnlock()
+
+	rules := make([]ArchiveRule, 0, len(s.archives.rules))
+	for pattern, rule := range s.archives.rules {
+		rules = append(rules, ArchiveRule{
+			Pattern:  pattern,
+			Sink:     rule.sink,
+			Archived: rule.archived.Load(),
+			Failed:   rule.failed.Load(),
+		})
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].Pattern < rules[j].Pattern
+	})
+	return rules
+}
+
+// archiving reports whether any archive rule is registered, so removals can
+// skip capturing the final value when nothing would receive it
+func (s *Store) archiving() bool {
+	s.archives.mu.RLock()
+	defer s.archives.mu.RUnlock()
+	return len(s.archives.rules) > 0
+}
+
+// archive hands the final value of key to the sink of the longest matching
+// pattern, if any. It must be called without holding store locks.
+func (s *Store) archive(key string, val Value, reason string, now int64) {
+	s.archives.mu.RLock()
+	var best string
+	var rule *archiveRule
+	for pattern, candidate := range s.archives.rules {
+		if !MatchPattern(pattern, key) {
+			continue
+		}
+		if rule == nil || len(pattern) > len(best) || (len(pattern) == len(best) && pattern < best) {
+			best, rule = pattern, candidate
+		}
+	}
+	s.archives.mu.RUnlock()
+
+	if rule == nil {
+		return
+	}
+
+	err := rule.sink.Archive(ArchivedKey{Key: key, Value: val, Reason: reason, ArchivedAt: now})
+	if err != nil {
+		rule.failed.Add(1)
+		return
+	}
+	rule.archived.Add(1)
+}
+
+// finalVersion returns the latest version of key, expired or not
+func (s *Store) finalVersion(key string) (Value, bool) {
+	shard := s.getShard(key)
+
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	history, exists := shard.data[key]
+	if !exists {
+		return Value{}, false
+	}
+
+	history.mu.RLock()
+	defer history.mu.RUnlock()
+
+	if len(history.Versions) == 0 {
+		return Value{}, false
+	}
+	return history.Versions[len(history.Versions)-1], true
+}
@@ -0,0 +1,281 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxBucketRange caps the number of buckets a single BucketRange may visit
+const MaxBucketRange = 10000
+
+// ErrNoSuchNamespace is returned for operations on an unregistered bucket namespace
+var ErrNoSuchNamespace = errors.New("ERR no such bucket namespace")
+
+// bucketLayouts maps the supported granularities to their key label format
+var bucketLayouts = map[time.Duration]string{
+	time.Minute:    "2006-01-02T15:04",
+	time.Hour:      "2006-01-02T15",
+	24 * time.Hour: "2006-01-02",
+}
+
+// BucketNamespace partitions keys named prefix:<label>:<key> into time
+// buckets. Keys are expired a whole bucket at a time once the bucket is older
+// than the retention, so they need no individual TTL entries.
+type BucketNamespace struct {
+	Prefix      string
+	Granularity time.Duration
+	Retention   time.Duration // How long a bucket is kept after it closes
+}
+
+// label returns the bucket label for the bucket containing ts (Unix ms)
+func (ns *BucketNamespace) label(ts int64) string {
+	return time.UnixMilli(ts).UTC().Format(bucketLayouts[ns.Granularity])
+}
+
+// start returns the start (Unix ms) of the bucket containing ts
+func (ns *BucketNamespace) start(ts int64) int64 {
+	return time.UnixMilli(ts).UTC().Truncate(ns.Granularity).UnixMilli()
+}
+
+// expiration returns when the bucket starting at start expires (Unix ms)
+func (ns *BucketNamespace) expiration(start int64) int64 {
+	return start + (ns.Granularity + ns.Retention).Milliseconds()
+}
+
+// parse returns the bucket start of a key in the namespace
+func (ns *BucketNamespace) parse(key string) (int64, bool) {
+	if !strings.HasPrefix(key, ns.Prefix+":") {
+		return 0, false
+	}
+	label, _, _ := strings.Cut(key[len(ns.Prefix)+1:], ":")
+
+	t, err := time.Parse(bucketLayouts[ns.Granularity], label)
+	if err != nil {
+		return 0, false
+	}
+	return t.UnixMilli(), true
+}
+
+// bucketTracker is a registered namespace and the keys held by each bucket
+type bucketTracker struct {
+	BucketNamespace
+	keys map[int64]map[string]struct{} // bucket start -> keys
+}
+
+// BucketEntry is the value of a key in one bucket
+type BucketEntry struct {
+	Bucket string // Bucket label
+	Start  int64  // Unix milliseconds when the bucket starts
+	Value  string
+}
+
+// CreateBucketNamespace registers a time-bucketed namespace. Existing keys
+// under the prefix are not adopted; only keys written afterwards are tracked.
+func (s *Store) CreateBucketNamespace(prefix string, granularity, retention time.Duration) error {
+	if prefix == "" {
+		return fmt.Errorf("ERR bucket prefix must not be empty")
+	}
+	if _, ok := bucketLayouts[granularity]; !ok {
+		return fmt.Errorf("ERR unsupported bucket granularity")
+	}
+	if retention < 0 {
+		return fmt.Errorf("ERR bucket retention must not be negative")
+	}
+
+	s.bucketsMu.Lock()
+	defer s.bucketsMu.Unlock()
+
+	if existing, exists := s.buckets[prefix]; exists {
+		// Redefining keeps the tracked keys when the granularity is unchanged
+		if existing.Granularity == granularity {
+			existing.Retention = retention
+			return nil
+		}
+	}
+
+	s.buckets[prefix] = &bucketTracker{
+		BucketNamespace: BucketNamespace{
+			Prefix:      prefix,
+			Granularity: granularity,
+			Retention:   retention,
+		},
+		keys: make(map[int64]map[string]struct{}),
+	}
+	return nil
+}
+
+// DropBucketNamespace stops managing a namespace. Its keys are kept.
+func (s *Store) DropBucketNamespace(prefix string) bool {
+	s.bucketsMu.Lock()
+	defer s.bucketsMu.Unlock()
+
+	if _, exists := s.buckets[prefix]; !exists {
+		return false
+	}
+	delete(s.buckets, prefix)
+	return true
+}
+
+// BucketNamespaces returns the registered namespaces sorted by prefix
+func (s *Store) BucketNamespaces() []BucketNamespace {
+	s.bucketsMu.RLock()
+	defer s.bucketsMu.RUnlock()
+
+	namespaces := make([]BucketNamespace, 0, len(s.buckets))
+	for _, tracker := range s.buckets {
+		namespaces = append(namespaces, tracker.BucketNamespace)
+	}
+	sort.Slice(namespaces, func(i, j int) bool {
+		return namespaces[i].Prefix < namespaces[j].Prefix
+	})
+	return namespaces
+}
+
+// namespace returns a copy of the namespace registered for prefix
+func (s *Store) namespace(prefix string) (BucketNamespace, error) {
+	s.bucketsMu.RLock()
+	defer s.bucketsMu.RUnlock()
+
+	tracker, exists := s.buckets[prefix]
+	if !exists {
+		return BucketNamespace{}, ErrNoSuchNamespace
+	}
+	return tracker.BucketNamespace, nil
+}
+
+// BucketKey returns the full name of key in the bucket of prefix containing
+// the timestamp ts (Unix ms)
+func (s *Store) BucketKey(prefix, key string, ts int64) (string, error) {
+	ns, err := s.namespace(prefix)
+	if err != nil {
+		return "", err
+	}
+	return prefix + ":" + ns.label(ts) + ":" + key, nil
+}
+
+// BucketSet writes value to key in the current bucket of prefix, creating
+// the bucket if needed, and returns the full key written
+func (s *Store) BucketSet(prefix, key, value string) (string, error) {
+	fullKey, err := s.BucketKey(prefix, key, time.Now().UnixMilli())
+	if err != nil {
+		return "", err
+	}
+	if err := s.Set(fullKey, value, 0); err != nil {
+		return "", err
+	}
+	return fullKey, nil
+}
+
+// BucketRange returns the values of key in every bucket of prefix between
+// the timestamps from and to (Unix ms, inclusive), oldest first. Buckets
+// where key is missing are skipped.
+func (s *Store) BucketRange(prefix, key string, from, to int64) ([]BucketEntry, error) {
+	ns, err := s.namespace(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	step := ns.Granularity.Milliseconds()
+	first := ns.start(from)
+	if to >= first && (to-first)/step >= MaxBucketRange {
+		return nil, fmt.Errorf("ERR bucket range spans more than %d buckets", MaxBucketRange)
+	}
+
+	entries := []BucketEntry{}
+	for start := first; start <= to; start += step {
+		label := ns.label(start)
+		if value, exists, _ := s.Get(prefix + ":" + label + ":" + key); exists {
+			entries = append(entries, BucketEntry{Bucket: label, Start: start, Value: value})
+		}
+	}
+	return entries, nil
+}
+
+// trackBucket records key in its bucket if it belongs to a namespace
+func (s *Store) trackBucket(key string) {
+	s.bucketsMu.RLock()
+	if len(s.buckets) == 0 {
+		s.bucketsMu.RUnlock()
+		return
+	}
+	var tracker *bucketTracker
+	var start int64
+	for _, candidate := range s.buckets {
+		if bucketStart, ok := candidate.parse(key); ok {
+			tracker, start = candidate, bucketStart
+			break
+		}
+	}
+	s.bucketsMu.RUnlock()
+
+	if tracker == nil {
+		return
+	}
+
+	s.bucketsMu.Lock()
+	defer s.bucketsMu.Unlock()
+
+	keys, exists := tracker.keys[start]
+	if !exists {
+		keys = make(map[string]struct{})
+		tracker.keys[start] = keys
+	}
+	keys[key] = struct{}{}
+}
+
+// bucketExpiration returns when the bucket holding key expires, or 0 if the
+// key is not in a tracked bucket
+func (s *Store) bucketExpiration(key string) int64 {
+	s.bucketsMu.RLock()
+	defer s.bucketsMu.RUnlock()
+
+	for _, tracker := range s.buckets {
+		if start, ok := tracker.parse(key); ok {
+			if _, tracked := tracker.keys[start][key]; tracked {
+				return tracker.expiration(start)
+			}
+		}
+	}
+	return 0
+}
+
+// expireBuckets deletes every key of the buckets that have expired by now
+func (s *Store) expireBuckets(now int64) {
+	var expired []string
+
+	s.bucketsMu.Lock()
+	for _, tracker := range s.buckets {
+		for start, keys := range tracker.keys {
+			if now < tracker.expiration(start) {
+				continue
+			}
+			for key := range keys {
+				expired = append(expired, key)
+			}
+			delete(tracker.keys, start)
+		}
+	}
+	s.bucketsMu.Unlock()
+
+	archiving := s.archiving()
+	for _, key := range expired {
+		key := key
+		var final Value
+		var removed bool
+		s.run(key, func() {
+			if archiving {
+				final, _ = s.finalVersion(key)
+			}
+			removed = s.purge(key)
+		})
+		if removed {
+			s.publish(Event{Type: EventExpire, Key: key, Timestamp: now})
+		}
+		if removed && archiving {
+			s.archive(key, final, ArchiveEvicted, now)
+		}
+	}
+}
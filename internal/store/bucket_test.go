@@ -0,0 +1,73 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStoreBucketRange(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	if err := store.CreateBucketNamespace("metrics", 24*time.Hour, time.Hour); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	day := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC).UnixMilli()
+	for i, value := range []string{"10", "20", "30"} {
+		key, err := store.BucketKey("metrics", "cpu", day+int64(i)*24*time.Hour.Milliseconds())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		store.Set(key, value, 0)
+	}
+
+	if value, _, _ := store.Get("metrics:2024-06-02:cpu"); value != "20" {
+		t.Errorf("Expected bucket key metrics:2024-06-02:cpu to hold 20, got %q", value)
+	}
+
+	entries, err := store.BucketRange("metrics", "cpu", day, day+24*time.Hour.Milliseconds())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Bucket != "2024-06-01" || entries[1].Value != "20" {
+		t.Errorf("Unexpected range %+v", entries)
+	}
+
+	if _, err := store.BucketRange("missing", "cpu", day, day); err != ErrNoSuchNamespace {
+		t.Errorf("Expected ErrNoSuchNamespace, got %v", err)
+	}
+	if err := store.CreateBucketNamespace("bad", 7*time.Minute, 0); err == nil {
+		t.Error("Expected unsupported granularity to be rejected")
+	}
+}
+
+func TestStoreBucketExpiry(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.CreateBucketNamespace("events", time.Hour, time.Hour)
+
+	now := time.Now().UnixMilli()
+	old, _ := store.BucketKey("events", "login", now-3*time.Hour.Milliseconds())
+	current, _ := store.BucketKey("events", "login", now)
+	store.Set(old, "a", 0)
+	store.Set(current, "b", 0)
+	store.Set("events:not-a-bucket", "c", 0)
+
+	if ttl := store.TTL(current); ttl <= 0 {
+		t.Errorf("Expected bucket key to inherit the bucket TTL, got %d", ttl)
+	}
+
+	store.expireBuckets(now)
+
+	if _, found, _ := store.Get(old); found {
+		t.Error("Expected expired bucket to be deleted")
+	}
+	if _, found, _ := store.Get(current); !found {
+		t.Error("Expected current bucket to be kept")
+	}
+	if _, found, _ := store.Get("events:not-a-bucket"); !found {
+		t.Error("Expected keys outside buckets to be kept")
+	}
+}
@@ -0,0 +1,117 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"pulsedb/internal/throttle"
+)
+
+// Bulk operations walk the keyspace one shard at a time for long-running
+// admin jobs. They report progress in shards through the progress function
+// and stop between shards once ctx is done, returning ctx.Err() with the
+// work completed so far.
+
+// Compact prunes every history by its retention policy, like the background
+// compaction, and returns the number of versions removed
+func (s *Store) Compact(ctx context.Context, progress func(done, total int)) (int, error) {
+	now := time.Now().UnixMilli()
+	removed := 0
+	for i, shard := range s.shards {
+		if err := ctx.Err(); err != nil {
+			return removed, err
+		}
+		removed += s.compactShard(shard, now)
+		progress(i+1, ShardCount)
+	}
+	return removed, nil
+}
+
+// ExpireMatching sets a TTL of ttlMs on every live key matching pattern and
+// returns the number of keys updated
+func (s *Store) ExpireMatching(ctx context.Context, pattern string, ttlMs int64, progress func(done, total int)) (int, error) {
+	updated := 0
+	for i, shard := range s.shards {
+		if err := ctx.Err(); err != nil {
+			return updated, err
+		}
+		for _, key := range s.shardKeys(shard, pattern) {
+			// Isolated key by key, so a long run never holds scripts back
+			release := s.Shared()
+			if s.Expire(key, ttlMs) {
+				updated++
+			}
+			release()
+		}
+		progress(i+1, ShardCount)
+	}
+	return updated, nil
+}
+
+// ExportNamespace returns the dumps of every live key in namespace, sorted
+// by key
+func (s *Store) ExportNamespace(ctx context.Context, namespace string, progress func(done, total int)) ([]KeyDump, error) {
+	dumps := []KeyDump{}
+	for i, shard := range s.shards {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for _, key := range s.shardKeys(shard, "") {
+			if throttle.Namespace(key) != namespace {
+				continue
+			}
+			if dump, ok := s.ExportKey(key); ok {
+				dumps = append(dumps, dump)
+			}
+		}
+		progress(i+1, ShardCount)
+	}
+	sort.Slice(dumps, func(i, j int) bool { return dumps[i].Key < dumps[j].Key })
+	return dumps, nil
+}
+
+// shardKeys returns the live keys of a shard matching pattern, all of them
+// if pattern is empty
+func (s *Store) shardKeys(shard *Shard, pattern string) []string {
+	now := time.Now().UnixMilli()
+
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	var keys []string
+	for bucket := uint64(0); bucket < scanBuckets; bucket++ {
+		for _, key := range shard.liveKeys(bucket, now) {
+			if pattern == "" || MatchPattern(pattern, key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// NamespaceBytes returns the approximate bytes held by the live keys of
+// namespace, their retained history included, as reported per key by
+// KeyStats
+func (s *Store) NamespaceBytes(namespace string) int64 {
+	now := time.Now().UnixMilli()
+	var total int64
+	for _, shard := range s.shards {
+		shard.mu.RLock()
+		for key, history := range shard.data {
+			if throttle.Namespace(key) != namespace {
+				continue
+			}
+			history.mu.RLock()
+			if history.latest(now) != nil {
+				total += int64(len(key))
+				for i := range history.Versions {
+					total += history.Versions[i].size()
+				}
+			}
+			history.mu.RUnlock()
+		}
+		shard.mu.RUnlock()
+	}
+	return total
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStoreBulkOperations(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.Set("session:1", "a", 0)
+	store.Set("session:2", "b", 0)
+	store.Set("user:1", "c", 0)
+
+	calls, last := 0, 0
+	progress := func(done, total int) {
+		calls++
+		last = done
+		if total != ShardCount {
+			t.Errorf("Expected %d shards in total, got %d", ShardCount, total)
+		}
+	}
+
+	updated, err := store.ExpireMatching(context.Background(), "session:*", 60_000, progress)
+	if err != nil || updated != 2 {
+		t.Fatalf("Expected 2 keys updated, got %d (%v)", updated, err)
+	}
+	if calls != ShardCount || last != ShardCount {
+		t.Errorf("Expected progress for every shard, got %d calls ending at %d", calls, last)
+	}
+	if ttl := store.TTL("session:1"); ttl <= 0 {
+		t.Errorf("Expected a TTL on session:1, got %d", ttl)
+	}
+	if ttl := store.TTL("user:1"); ttl != -1 {
+		t.Errorf("Expected no TTL on user:1, got %d", ttl)
+	}
+
+	dumps, err := store.ExportNamespace(context.Background(), "session", progress)
+	if err != nil || len(dumps) != 2 || dumps[0].Key != "session:1" || dumps[1].Key != "session:2" {
+		t.Fatalf("Expected the dumps of the session namespace, got %+v (%v)", dumps, err)
+	}
+
+	if _, err := store.Compact(context.Background(), progress); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := store.ExpireMatching(ctx, "*", 1000, progress); err != context.Canceled {
+		t.Errorf("Expected a canceled expiry, got %v", err)
+	}
+	if ttl := store.TTL("user:1"); ttl != -1 {
+		t.Errorf("Expected a canceled expiry to leave user:1, got TTL %d", ttl)
+	}
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidChangeID is returned by ParseChangeID
+var ErrInvalidChangeID = errors.New("ERR invalid change ID, want a Unix millisecond timestamp or the ID of the last change read")
+
+// ID orders the event in the changefeed, see Changes: the HLC of the
+// version written, or for an expiration, which has none, the first HLC of
+// its millisecond
+func (e Event) ID() HLC {
+	if e.HLC != 0 {
+		return e.HLC
+	}
+	return HLC(e.Timestamp) << hlcLogicalBits
+}
+
+// Changes returns the events of every key matching pattern whose ID is
+// after the given one, ordered by ID: a changefeed replayed from the
+// retained history, which a reader resumes by passing the ID of the last
+// event it got. At most count events are returned, 0 meaning all, though a
+// page never ends between events sharing an ID, so none is skipped. Live
+// events are followed by subscribing before calling Changes, see Subscribe.
+//
+// Writes in flight take their HLC before their version is visible, so a
+// key read early in the scan could later get a version ordering before
+// one read on another key. Only events up to an HLC taken before the scan
+// are returned: writes hold their shard lock from taking their HLC until
+// their version is appended, so the scan sees every one of them.
+func (s *Store) Changes(ctx context.Context, pattern string, after HLC, count int) ([]Event, error) {
+	upTo := s.clock.Now()
+	events, err := s.Events(ctx, pattern, after.Wall(), upTo.Wall())
+	if err != nil {
+		return nil, err
+	}
+
+	changes := events[:0]
+	for _, event := range events {
+		if event.ID() > after && event.ID() <= upTo {
+			changes = append(changes, event)
+		}
+	}
+	SortChanges(changes)
+
+	if count > 0 && count < len(changes) {
+		end := count
+		for end < len(changes) && changes[end].ID() == changes[count-1].ID() {
+			end++
+		}
+		changes = changes[:end]
+	}
+	return changes, nil
+}
+
+// SortChanges sorts events by ID, then key
+func SortChanges(events []Event) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].ID() != events[j].ID() {
+			return events[i].ID() < events[j].ID()
+		}
+		return events[i].Key < events[j].Key
+	})
+}
+
+// ParseChangeID parses where a changefeed starts, returning the ID to pass
+// to Changes: either the ID of the last event read, as wall-logical like
+// HLC.String, or a Unix millisecond timestamp, whose own events are
+// included
+func ParseChangeID(id string) (HLC, error) {
+	wall, logical, exclusive := strings.Cut(id, "-")
+	ms, err := strconv.ParseInt(wall, 10, 64)
+	if err != nil || ms < 0 || ms > math.MaxInt64>>hlcLogicalBits {
+		return 0, ErrInvalidChangeID
+	}
+	if !exclusive {
+		return max(HLC(ms)<<hlcLogicalBits, 1) - 1, nil
+	}
+	n, err := strconv.ParseUint(logical, 10, 16)
+	if err != nil {
+		return 0, ErrInvalidChangeID
+	}
+	return HLC(ms)<<hlcLogicalBits | HLC(n), nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package store
+
+import "time"
+
+// processCPUTime is unsupported outside Linux, so the expiry sweep only
+// follows command latency there
+func processCPUTime() (time.Duration, bool) {
+	return 0, false
+}
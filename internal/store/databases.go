@@ -0,0 +1,161 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// Logical databases. The store NewStore returns is database 0, and DB
+// opens the others on first use. Each database has its own shards, TTL
+// wheel, validators, search indexes and statistics. They share the clock,
+// so HLCs and snapshot tokens order across databases, and the
+// configuration: default TTLs, sliding TTLs, retention, the expiry policy
+// and archive rules set through any database apply to all of them.
+
+// Databases is the number of logical databases of a store
+const Databases = 16
+
+// ErrDBIndex is returned by DB for an index out of range
+var ErrDBIndex = errors.New("ERR DB index is out of range")
+
+// databaseSet holds the databases of a store
+type databaseSet struct {
+	clock *hlcClock
+	dbs   [Databases]atomic.Pointer[Store] // Nil until opened
+
+	readOnly      atomic.Bool // Set by SetReadOnly
+	passiveExpiry atomic.Bool // Set by SetActiveExpire(false)
+	isolation     isolation   // Makes scripts atomic, see Shared
+
+	mu  sync.Mutex      // Serializes opening databases and configuration changes
+	ctx context.Context // Context of the background processes, nil until started
+}
+
+// DatabaseStats is the size of one logical database
+type DatabaseStats struct {
+	Index   int
+	Keys    int // Keys held, tombstones of expired keys included
+	Expires int // Keys with a TTL
+}
+
+// DB returns logical database index, opening it if needed
+func (s *Store) DB(index int) (*Store, error) {
+	if index < 0 || index >= Databases {
+		return nil, ErrDBIndex
+	}
+	set := s.databases
+	if db := set.dbs[index].Load(); db != nil {
+		return db, nil
+	}
+
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	if db := set.dbs[index].Load(); db != nil {
+		return db, nil
+	}
+
+	// A new database takes the configuration of database 0
+	root := set.dbs[0].Load()
+	db := newDatabase(set, index)
+	for _, d := range root.DefaultTTLs() {
+		db.defaultTTLs[d.Pattern] = d.TTL
+	}
+	db.setSlidingPatterns(root.SlidingPatterns())
+	db.setRetention(root.Retention())
+	db.setExpiryPolicy(root.ExpiryPolicy())
+	root.archives.mu.RLock()
+	for pattern, rule := range root.archives.rules {
+		db.archives.rules[pattern] = rule
+	}
+	root.archives.mu.RUnlock()
+
+	if set.ctx != nil {
+		db.startBackground(set.ctx)
+	}
+	set.publish(db)
+	return db, nil
+}
+
+// Index returns the number of the logical database
+func (s *Store) Index() int {
+	return s.index
+}
+
+// FlushAll erases every key of every database and returns how many it
+// erased
+func (s *Store) FlushAll() int {
+	erased := 0
+	for _, db := range s.databases.list() {
+		erased += db.Flush()
+	}
+	return erased
+}
+
+// Flush erases every key of the database with its history, like PURGE on
+// the whole keyspace, and returns how many it erased. No key events are
+// published.
+func (s *Store) Flush() int {
+	erased := 0
+	for _, shard := range s.shards {
+		shard.executor.run(func() {
+			shard.mu.Lock()
+			defer shard.mu.Unlock()
+			for key := range shard.data {
+				s.ttlWheel.Remove(key)
+				s.indexDelete(key)
+			}
+			erased += len(shard.data)
+			shard.clear()
+		})
+	}
+	return erased
+}
+
+// DatabaseStats returns the size of every database holding keys, in order
+func (s *Store) DatabaseStats() []DatabaseStats {
+	var stats []DatabaseStats
+	for _, db := range s.databases.list() {
+		if keys := db.KeyCount(); keys > 0 {
+			stats = append(stats, DatabaseStats{Index: db.index, Keys: keys, Expires: db.ScheduledExpirations()})
+		}
+	}
+	return stats
+}
+
+// publish makes db visible to DB and list
+func (set *databaseSet) publish(db *Store) {
+	set.dbs[db.index].Store(db)
+}
+
+// list returns the open databases in order
+func (set *databaseSet) list() []*Store {
+	dbs := make([]*Store, 0, Databases)
+	for i := range set.dbs {
+		if db := set.dbs[i].Load(); db != nil {
+			dbs = append(dbs, db)
+		}
+	}
+	return dbs
+}
+
+// configure applies a configuration change to every open database
+func (set *databaseSet) configure(fn func(db *Store)) {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	for _, db := range set.list() {
+		fn(db)
+	}
+}
+
+// start starts the background processes of the open databases, and of
+// those opened later
+func (set *databaseSet) start(ctx context.Context) {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	set.ctx = ctx
+	for _, db := range set.list() {
+		db.startBackground(ctx)
+	}
+}
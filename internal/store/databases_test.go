@@ -0,0 +1,71 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStoreDatabases(t *testing.T) {
+	s := NewStore()
+	defer s.Close()
+
+	if _, err := s.DB(Databases); err != ErrDBIndex {
+		t.Errorf("Expected ErrDBIndex, got %v", err)
+	}
+	db, err := s.DB(3)
+	if err != nil || db.Index() != 3 {
+		t.Fatalf("Unexpected DB(3): %v, %v", db, err)
+	}
+	if again, _ := s.DB(3); again != db {
+		t.Error("Expected DB to return the open database")
+	}
+	if root, _ := db.DB(0); root != s {
+		t.Error("Expected database 0 to be the store itself")
+	}
+
+	s.Set("k", "zero", 0)
+	db.Set("k", "three", 60_000)
+	if value, _, _ := s.Get("k"); value != "zero" {
+		t.Errorf("Expected databases to be isolated, got %q", value)
+	}
+
+	// Configuration set on any database applies to all of them
+	db.SetDefaultTTL("session:*", 30*time.Second)
+	other, _ := s.DB(5)
+	for _, d := range []*Store{s, db, other} {
+		if ttls := d.DefaultTTLs(); len(ttls) != 1 || ttls[0].Pattern != "session:*" {
+			t.Errorf("db%d: expected the shared default TTL, got %+v", d.Index(), ttls)
+		}
+	}
+
+	if copied, err := s.Copy("k", other, "dst", false); !copied || err != nil {
+		t.Fatalf("Unexpected Copy: %v, %v", copied, err)
+	}
+	if copied, _ := db.Copy("k", other, "dst", false); copied {
+		t.Error("Expected Copy to keep an existing destination")
+	}
+	if copied, _ := db.Copy("k", other, "dst", true); !copied {
+		t.Error("Expected Copy to replace the destination")
+	}
+	if value, _, _ := other.Get("dst"); value != "three" {
+		t.Errorf("Expected the copy, got %q", value)
+	}
+	if ttl := other.TTL("dst"); ttl <= 0 {
+		t.Errorf("Expected the TTL to be copied, got %d", ttl)
+	}
+
+	stats := s.DatabaseStats()
+	if len(stats) != 3 || stats[1] != (DatabaseStats{Index: 3, Keys: 1, Expires: 1}) {
+		t.Errorf("Unexpected database stats %+v", stats)
+	}
+
+	if erased := db.Flush(); erased != 1 || db.KeyCount() != 0 {
+		t.Errorf("Expected Flush to erase 1 key, erased %d", erased)
+	}
+	if _, exists, _ := s.Get("k"); !exists {
+		t.Error("Expected Flush to leave other databases alone")
+	}
+	if erased := s.FlushAll(); erased != 2 || len(s.DatabaseStats()) != 0 {
+		t.Errorf("Expected FlushAll to erase 2 keys, erased %d", erased)
+	}
+}
@@ -0,0 +1,273 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+)
+
+const (
+	DefaultSketchAccuracy = 0.01 // Relative accuracy of sketches created by SKETCH.ADD
+	sketchMaxBins         = 2048 // Bins kept per sign before the smallest are collapsed
+	sketchMinIndexable    = 1e-9 // Magnitudes below this are counted as zero
+)
+
+// ErrSketchAccuracy is returned when merging sketches of different accuracies
+var ErrSketchAccuracy = errors.New("ERR sketches have different relative accuracies")
+
+// Sketch is a DDSketch: a mergeable quantile summary whose quantiles are
+// within a fixed relative error of the true value. Samples are counted in
+// logarithmically sized bins, so memory grows with the range of the values
+// rather than their number. Once a sign has more than sketchMaxBins bins the
+// ones nearest zero are collapsed, keeping the guarantee for the high
+// quantiles that matter for latencies.
+type Sketch struct {
+	accuracy float64
+	gamma    float64
+	logGamma float64
+	positive map[int]uint64
+	negative map[int]uint64 // Keyed by the bin of the magnitude
+	zeros    uint64
+	count    uint64
+	sum      float64
+	min      float64
+	max      float64
+}
+
+// SketchSummary describes the samples recorded in a sketch
+type SketchSummary struct {
+	Accuracy float64 `json:"accuracy"`
+	Count    uint64  `json:"count"`
+	Sum      float64 `json:"sum"`
+	Min      float64 `json:"min"`
+	Max      float64 `json:"max"`
+	Bins     int     `json:"bins"`
+}
+
+// NewSketch creates an empty sketch with the given relative accuracy, which
+// must be between 0 and 1 exclusive
+func NewSketch(accuracy float64) (*Sketch, error) {
+	if !(accuracy > 0 && accuracy < 1) {
+		return nil, errors.New("ERR accuracy must be between 0 and 1")
+	}
+	gamma := (1 + accuracy) / (1 - accuracy)
+	return &Sketch{
+		accuracy: accuracy,
+		gamma:    gamma,
+		logGamma: math.Log(gamma),
+		positive: make(map[int]uint64),
+		negative: make(map[int]uint64),
+		min:      math.Inf(1),
+		max:      math.Inf(-1),
+	}, nil
+}
+
+// Add records a sample. NaN and infinite values are ignored.
+func (s *Sketch) Add(v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+
+	switch {
+	case v >= sketchMinIndexable:
+		s.positive[s.index(v)]++
+		s.collapse(s.positive)
+	case v <= -sketchMinIndexable:
+		s.negative[s.index(-v)]++
+		s.collapse(s.negative)
+	default:
+		s.zeros++
+	}
+	s.count++
+	s.sum += v
+	s.min = math.Min(s.min, v)
+	s.max = math.Max(s.max, v)
+}
+
+// Merge adds the samples of other, which must have the same accuracy
+func (s *Sketch) Merge(other *Sketch) error {
+	if other.accuracy != s.accuracy {
+		return ErrSketchAccuracy
+	}
+	for i, n := range other.positive {
+		s.positive[i] += n
+	}
+	for i, n := range other.negative {
+		s.negative[i] += n
+	}
+	s.collapse(s.positive)
+	s.collapse(s.negative)
+	s.zeros += other.zeros
+	s.count += other.count
+	s.sum += other.sum
+	s.min = math.Min(s.min, other.min)
+	s.max = math.Max(s.max, other.max)
+	return nil
+}
+
+// Quantile returns the estimated value at quantile q in [0, 1]; the
+// extremes are exact. It reports false if the sketch is empty.
+func (s *Sketch) Quantile(q float64) (float64, bool) {
+	switch {
+	case s.count == 0 || q < 0 || q > 1:
+		return 0, false
+	case q == 0:
+		return s.min, true
+	case q == 1:
+		return s.max, true
+	}
+
+	rank := uint64(q * float64(s.count-1))
+	seen := uint64(0)
+
+	// Negative values from the most negative, i.e. the largest magnitude
+	negative := sortedBins(s.negative)
+	for i := len(negative) - 1; i >= 0; i-- {
+		seen += s.negative[negative[i]]
+		if seen > rank {
+			return s.clamp(-s.value(negative[i])), true
+		}
+	}
+
+	seen += s.zeros
+	if seen > rank {
+		return 0, true
+	}
+
+	for _, i := range sortedBins(s.positive) {
+		seen += s.positive[i]
+		if seen > rank {
+			return s.clamp(s.value(i)), true
+		}
+	}
+	return s.max, true
+}
+
+// Count returns the number of samples recorded
+func (s *Sketch) Count() uint64 {
+	return s.count
+}
+
+// Summary returns the accuracy, count, sum and extremes of the sketch
+func (s *Sketch) Summary() SketchSummary {
+	summary := SketchSummary{
+		Accuracy: s.accuracy,
+		Count:    s.count,
+		Sum:      s.sum,
+		Bins:     len(s.positive) + len(s.negative),
+	}
+	if s.count > 0 {
+		summary.Min, summary.Max = s.min, s.max
+	}
+	return summary
+}
+
+// Clone returns an independent copy of the sketch
+func (s *Sketch) Clone() *Sketch {
+	c := *s
+	c.positive = make(map[int]uint64, len(s.positive))
+	for i, n := range s.positive {
+		c.positive[i] = n
+	}
+	c.negative = make(map[int]uint64, len(s.negative))
+	for i, n := range s.negative {
+		c.negative[i] = n
+	}
+	return &c
+}
+
+// sketchJSON is the encoding of a sketch; the extremes are left out while
+// the sketch is empty since JSON has no infinities
+type sketchJSON struct {
+	Accuracy float64        `json:"accuracy"`
+	Positive map[int]uint64 `json:"positive,omitempty"`
+	Negative map[int]uint64 `json:"negative,omitempty"`
+	Zeros    uint64         `json:"zeros,omitempty"`
+	Count    uint64         `json:"count"`
+	Sum      float64        `json:"sum"`
+	Min      *float64       `json:"min,omitempty"`
+	Max      *float64       `json:"max,omitempty"`
+}
+
+// MarshalJSON encodes the bins and summary of the sketch
+func (s *Sketch) MarshalJSON() ([]byte, error) {
+	encoded := sketchJSON{
+		Accuracy: s.accuracy,
+		Positive: s.positive,
+		Negative: s.negative,
+		Zeros:    s.zeros,
+		Count:    s.count,
+		Sum:      s.sum,
+	}
+	if s.count > 0 {
+		encoded.Min, encoded.Max = &s.min, &s.max
+	}
+	return json.Marshal(encoded)
+}
+
+// UnmarshalJSON restores a sketch encoded by MarshalJSON
+func (s *Sketch) UnmarshalJSON(data []byte) error {
+	var encoded sketchJSON
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	restored, err := NewSketch(encoded.Accuracy)
+	if err != nil {
+		return err
+	}
+	for i, n := range encoded.Positive {
+		restored.positive[i] = n
+	}
+	for i, n := range encoded.Negative {
+		restored.negative[i] = n
+	}
+	restored.zeros, restored.count, restored.sum = encoded.Zeros, encoded.Count, encoded.Sum
+	if encoded.Min != nil && encoded.Max != nil {
+		restored.min, restored.max = *encoded.Min, *encoded.Max
+	}
+	*s = *restored
+	return nil
+}
+
+// index returns the bin of a positive magnitude: the bin i covers
+// (gamma^(i-1), gamma^i]
+func (s *Sketch) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / s.logGamma))
+}
+
+// value returns the representative of bin i, which is within the relative
+// accuracy of every value in the bin
+func (s *Sketch) value(i int) float64 {
+	return 2 * math.Pow(s.gamma, float64(i)) / (s.gamma + 1)
+}
+
+// clamp keeps an estimate within the observed extremes
+func (s *Sketch) clamp(v float64) float64 {
+	return math.Max(s.min, math.Min(s.max, v))
+}
+
+// collapse folds the bins nearest zero into one until bins has at most
+// sketchMaxBins entries
+func (s *Sketch) collapse(bins map[int]uint64) {
+	if len(bins) <= sketchMaxBins {
+		return
+	}
+	keys := sortedBins(bins)
+	excess := len(keys) - sketchMaxBins
+	into := keys[excess]
+	for _, i := range keys[:excess] {
+		bins[into] += bins[i]
+		delete(bins, i)
+	}
+}
+
+// sortedBins returns the bin indexes in ascending order
+func sortedBins(bins map[int]uint64) []int {
+	keys := make([]int, 0, len(bins))
+	for i := range bins {
+		keys = append(keys, i)
+	}
+	sort.Ints(keys)
+	return keys
+}
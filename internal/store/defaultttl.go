@@ -0,0 +1,138 @@
+package store
+
+import (
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultTTL is the TTL given to keys matching Pattern when they are SET
+// without an explicit expiration
+type DefaultTTL struct {
+	Pattern string
+	TTL     time.Duration
+}
+
+// SetDefaultTTL registers a default TTL for keys matching pattern, replacing
+// any default previously registered for the same pattern
+func (s *Store) SetDefaultTTL(pattern string, ttl time.Duration) error {
+	if pattern == "" {
+		return fmt.Errorf("ERR default TTL pattern must not be empty")
+	}
+	if ttl < time.Millisecond {
+		return fmt.Errorf("ERR default TTL must be at least 1ms")
+	}
+
+	s.databases.configure(func(db *Store) {
+		db.defaultTTLsMu.Lock()
+		defer db.defaultTTLsMu.Unlock()
+		db.defaultTTLs[pattern] = ttl
+	})
+	return nil
+}
+
+// RemoveDefaultTTL unregisters the default TTL for pattern
+func (s *Store) RemoveDefaultTTL(pattern string) (removed bool) {
+	s.databases.configure(func(db *Store) {
+		db.defaultTTLsMu.Lock()
+		defer db.defaultTTLsMu.Unlock()
+
+		if _, exists := db.defaultTTLs[pattern]; exists {
+			delete(db.defaultTTLs, pattern)
+			removed = true
+		}
+	})
+	return removed
+}
+
+// ReplaceDefaultTTLs atomically replaces every default TTL with defaults
+func (s *Store) ReplaceDefaultTTLs(defaults []DefaultTTL) error {
+	replaced := make(map[string]time.Duration, len(defaults))
+	for _, d := range defaults {
+		if d.Pattern == "" || d.TTL < time.Millisecond {
+			return fmt.Errorf("ERR invalid default TTL for pattern '%s'", d.Pattern)
+		}
+		replaced[d.Pattern] = d.TTL
+	}
+
+	s.databases.configure(func(db *Store) {
+		db.defaultTTLsMu.Lock()
+		defer db.defaultTTLsMu.Unlock()
+		db.defaultTTLs = maps.Clone(replaced)
+	})
+	return nil
+}
+
+// DefaultTTLs returns the registered default TTLs sorted by pattern
+func (s *Store) DefaultTTLs() []DefaultTTL {
+	s.defaultTTLsMu.RLock()
+	defer s.defaultTTLsMu.RUnlock()
+
+	defaults := make([]DefaultTTL, 0, len(s.defaultTTLs))
+	for pattern, ttl := range s.defaultTTLs {
+		defaults = append(defaults, DefaultTTL{Pattern: pattern, TTL: ttl})
+	}
+	sort.Slice(defaults, func(i, j int) bool {
+		return defaults[i].Pattern < defaults[j].Pattern
+	})
+	return defaults
+}
+
+// DefaultTTLsApplied returns how many writes have received a default TTL
+func (s *Store) DefaultTTLsApplied() int64 {
+	return s.defaultTTLsApplied.Load()
+}
+
+// defaultTTL returns the default TTL for key in milliseconds, or 0 if no
+// pattern matches. When several patterns match, the longest one wins so that
+// "session:admin:*" overrides "session:*".
+func (s *Store) defaultTTL(key string) int64 {
+	s.defaultTTLsMu.RLock()
+	defer s.defaultTTLsMu.RUnlock()
+
+	var best string
+	var ttl time.Duration
+	for pattern, candidate := range s.defaultTTLs {
+		if !MatchPattern(pattern, key) {
+			continue
+		}
+		if ttl == 0 || len(pattern) > len(best) || (len(pattern) == len(best) && pattern < best) {
+			best, ttl = pattern, candidate
+		}
+	}
+	return ttl.Milliseconds()
+}
+
+// ParseDefaultTTLs parses a comma-separated list of pattern=duration pairs,
+// e.g. "session:*=30m,cache:*=5m". An empty spec yields no defaults.
+func ParseDefaultTTLs(spec string) ([]DefaultTTL, error) {
+	var defaults []DefaultTTL
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		pattern, value, ok := strings.Cut(item, "=")
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("invalid default TTL '%s', expected pattern=duration", item)
+		}
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl < time.Millisecond {
+			return nil, fmt.Errorf("invalid default TTL duration '%s' for pattern '%s'", value, pattern)
+		}
+		defaults = append(defaults, DefaultTTL{Pattern: pattern, TTL: ttl})
+	}
+	return defaults, nil
+}
+
+// FormatDefaultTTLs renders defaults in the form accepted by ParseDefaultTTLs
+func FormatDefaultTTLs(defaults []DefaultTTL) string {
+	items := make([]string, len(defaults))
+	for i, d := range defaults {
+		items[i] = d.Pattern + "=" + d.TTL.String()
+	}
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Operations of a field-level change
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// Change is a difference between two JSON documents at one path. Old and New
+// are JSON encoded; Old is empty for added fields and New for removed ones.
+type Change struct {
+	Path string // e.g. $.user.name or $.tags[2]
+	Op   string
+	Old  string
+	New  string
+}
+
+// Diff compares the values of a key at two points in time
+type Diff struct {
+	Before      string
+	BeforeFound bool
+	After       string
+	AfterFound  bool
+
+	// JSON reports whether both values are JSON documents, in which case
+	// Changes holds their structural diff
+	JSON    bool
+	Changes []Change
+}
+
+// Diff returns the values of key at the Unix millisecond timestamps t1 and
+// t2 and, when both are JSON documents, the fields that changed between them.
+// It fails with ErrWrongType if either value is not a string or document.
+func (s *Store) Diff(key string, t1, t2 int64) (Diff, error) {
+	var d Diff
+	var err error
+	if d.Before, d.BeforeFound, err = s.GetAt(key, t1); err != nil {
+		return Diff{}, err
+	}
+	if d.After, d.AfterFound, err = s.GetAt(key, t2); err != nil {
+		return Diff{}, err
+	}
+	if !d.BeforeFound || !d.AfterFound {
+		return d, nil
+	}
+
+	var before, after interface{}
+	if json.Unmarshal([]byte(d.Before), &before) != nil || json.Unmarshal([]byte(d.After), &after) != nil {
+		return d, nil
+	}
+
+	d.JSON = true
+	d.Changes = diffJSON("$", before, after, []Change{})
+	return d, nil
+}
+
+// diffJSON appends the changes turning before into after, found at path
+func diffJSON(path string, before, after interface{}, changes []Change) []Change {
+	switch b := before.(type) {
+	case map[string]interface{}:
+		a, ok := after.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		// Walk fields in sorted order so the diff is deterministic
+		names := make([]string, 0, len(b)+len(a))
+		for name := range b {
+			names = append(names, name)
+		}
+		for name := range a {
+			if _, exists := b[name]; !exists {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			oldValue, inBefore := b[name]
+			newValue, inAfter := a[name]
+			field := path + "." + name
+			switch {
+			case !inAfter:
+				changes = append(changes, Change{Path: field, Op: ChangeRemoved, Old: encodeJSON(oldValue)})
+			case !inBefore:
+				changes = append(changes, Change{Path: field, Op: ChangeAdded, New: encodeJSON(newValue)})
+			default:
+				changes = diffJSON(field, oldValue, newValue, changes)
+			}
+		}
+		return changes
+	case []interface{}:
+		a, ok := after.([]interface{})
+		if !ok {
+			break
+		}
+
+		// Elements are compared by position
+		for i := 0; i < max(len(b), len(a)); i++ {
+			item := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(a):
+				changes = append(changes, Change{Path: item, Op: ChangeRemoved, Old: encodeJSON(b[i])})
+			case i >= len(b):
+				changes = append(changes, Change{Path: item, Op: ChangeAdded, New: encodeJSON(a[i])})
+			default:
+				changes = diffJSON(item, b[i], a[i], changes)
+			}
+		}
+		return changes
+	}
+
+	// Scalars, or values whose type changed
+	if oldJSON, newJSON := encodeJSON(before), encodeJSON(after); oldJSON != newJSON {
+		changes = append(changes, Change{Path: path, Op: ChangeChanged, Old: oldJSON, New: newJSON})
+	}
+	return changes
+}
+
+func encodeJSON(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStoreDiff(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.Set("doc", `{"name":"ada","tags":["a","b"],"age":36}`, 0)
+	t1 := store.History("doc", 1)[0].Timestamp
+	time.Sleep(5 * time.Millisecond)
+	store.Set("doc", `{"name":"ada","tags":["a"],"age":37,"role":"admin"}`, 0)
+	t2 := store.History("doc", 1)[0].Timestamp
+
+	diff, _ := store.Diff("doc", t1, t2)
+	if !diff.BeforeFound || !diff.AfterFound || !diff.JSON {
+		t.Fatalf("Expected both values as JSON, got %+v", diff)
+	}
+	expected := []Change{
+		{Path: "$.age", Op: ChangeChanged, Old: "36", New: "37"},
+		{Path: "$.role", Op: ChangeAdded, New: `"admin"`},
+		{Path: "$.tags[1]", Op: ChangeRemoved, Old: `"b"`},
+	}
+	if !reflect.DeepEqual(diff.Changes, expected) {
+		t.Errorf("Expected changes %+v, got %+v", expected, diff.Changes)
+	}
+
+	// Identical documents have no changes
+	if diff, _ := store.Diff("doc", t2, t2); !diff.JSON || len(diff.Changes) != 0 {
+		t.Errorf("Expected no changes, got %+v", diff.Changes)
+	}
+
+	// Plain strings are returned without a structural diff
+	store.Set("text", "hello", 0)
+	if diff, _ := store.Diff("text", t1-1000, time.Now().UnixMilli()); diff.BeforeFound || !diff.AfterFound || diff.JSON {
+		t.Errorf("Unexpected diff of a plain string %+v", diff)
+	}
+}
@@ -0,0 +1,260 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"sort"
+	"time"
+
+	"pulsedb/internal/jsonpath"
+)
+
+// KeyDump is the full state of a key, for moving it between stores: every
+// retained version in write order and the key's own retention policy
+type KeyDump struct {
+	Key       string        `json:"key"`
+	Retention string        `json:"retention,omitempty"` // Empty follows the store policy
+	Versions  []VersionDump `json:"versions"`
+}
+
+// VersionDump is one version of a KeyDump. Data holds the value of strings
+// and the encoded document of JSON values.
+type VersionDump struct {
+	Type      string    `json:"type"`
+	Data      string    `json:"data,omitempty"`
+	Members   []string  `json:"members,omitempty"`  // Set members
+	ZMembers  []ZMember `json:"zmembers,omitempty"` // Sorted set members
+	Sketch    *Sketch   `json:"sketch,omitempty"`
+	Timestamp int64     `json:"timestamp"`
+	HLC       HLC       `json:"hlc"`
+	TTL       int64     `json:"ttl,omitempty"`
+	Deleted   bool      `json:"deleted,omitempty"` // A recorded delete
+}
+
+// dumpFormat is the version of the DUMP payload format, bumped whenever
+// KeyDump changes incompatibly
+const dumpFormat = 1
+
+var dumpTable = crc64.MakeTable(crc64.ECMA)
+
+// ErrBadPayload is returned by DecodeDump for payloads that are corrupt or
+// of an unknown format
+var ErrBadPayload = errors.New("ERR DUMP payload version or checksum are wrong")
+
+// EncodeDump serializes a dump as the payload of DUMP: a format version
+// byte, the dump as JSON, and a little-endian CRC-64 of both. The key name
+// is left out, so the payload can be restored under any name.
+func EncodeDump(dump KeyDump) []byte {
+	dump.Key = ""
+	encoded, _ := json.Marshal(dump)
+	payload := make([]byte, 0, 1+len(encoded)+8)
+	payload = append(payload, dumpFormat)
+	payload = append(payload, encoded...)
+	return binary.LittleEndian.AppendUint64(payload, crc64.Checksum(payload, dumpTable))
+}
+
+// DecodeDump parses a DUMP payload as the dump of key
+func DecodeDump(key string, payload []byte) (KeyDump, error) {
+	if len(payload) < 1+8 || payload[0] != dumpFormat {
+		return KeyDump{}, ErrBadPayload
+	}
+	body, sum := payload[:len(payload)-8], payload[len(payload)-8:]
+	if crc64.Checksum(body, dumpTable) != binary.LittleEndian.Uint64(sum) {
+		return KeyDump{}, ErrBadPayload
+	}
+
+	var dump KeyDump
+	if err := json.Unmarshal(body[1:], &dump); err != nil || len(dump.Versions) == 0 {
+		return KeyDump{}, ErrBadPayload
+	}
+	dump.Key = key
+	return dump, nil
+}
+
+// ExportKey returns the dump of a live key
+func (s *Store) ExportKey(key string) (KeyDump, bool) {
+	now := time.Now().UnixMilli()
+	shard := s.getShard(key)
+
+	shard.mu.RLock()
+	history, exists := shard.data[key]
+	shard.mu.RUnlock()
+
+	if !exists {
+		return KeyDump{}, false
+	}
+
+	history.mu.RLock()
+	defer history.mu.RUnlock()
+
+	if history.latest(now) == nil {
+		return KeyDump{}, false
+	}
+
+	dump := KeyDump{Key: key, Versions: make([]VersionDump, len(history.Versions))}
+	if history.retention != nil {
+		dump.Retention = history.retention.String()
+	}
+	for i := range history.Versions {
+		dump.Versions[i] = dumpVersion(&history.Versions[i])
+	}
+	return dump, true
+}
+
+func dumpVersion(v *Value) VersionDump {
+	version := VersionDump{
+		Type:      v.Type.String(),
+		Data:      v.Data,
+		Timestamp: v.Timestamp,
+		HLC:       v.HLC,
+		TTL:       v.TTL,
+		Deleted:   v.Deleted,
+	}
+	switch v.Type {
+	case TypeSet:
+		version.Members = make([]string, 0, len(v.Set))
+		for member := range v.Set {
+			version.Members = append(version.Members, member)
+		}
+		sort.Strings(version.Members)
+	case TypeZSet:
+		version.ZMembers = v.ZSet.Members()
+	case TypeSketch:
+		version.Sketch = v.Sketch.Clone()
+	}
+	return version
+}
+
+// ImportKey recreates a key from its dump, keeping the version timestamps
+// and HLCs; the store clock moves past them so later writes still order
+// after the imported versions. Versions with no HLC get one from the clock.
+// An existing key is only replaced if replace is set. The current value
+// goes through the validators and search indexes like a SET. It reports
+// false if the key was kept or the dump has already expired.
+func (s *Store) ImportKey(dump KeyDump, replace bool) (imported bool, err error) {
+	history := &KeyHistory{Versions: make([]Value, 0, len(dump.Versions))}
+	if dump.Retention != "" {
+		policy, err := ParseRetention(dump.Retention)
+		if err != nil {
+			return false, fmt.Errorf("ERR invalid retention for '%s': %v", dump.Key, err)
+		}
+		history.retention = &policy
+	}
+	for _, version := range dump.Versions {
+		value, err := restoreVersion(version)
+		if err != nil {
+			return false, fmt.Errorf("ERR invalid version of '%s': %v", dump.Key, err)
+		}
+		history.Versions = append(history.Versions, value)
+	}
+
+	now := time.Now().UnixMilli()
+	latest := history.latest(now)
+	if latest == nil {
+		return false, nil
+	}
+	if latest.Type == TypeString || latest.Type == TypeJSON {
+		if err := s.validate(dump.Key, latest.Data); err != nil {
+			return false, err
+		}
+	}
+
+	s.run(dump.Key, func() { imported = s.importKey(dump.Key, history, replace, now) })
+	return imported, nil
+}
+
+func (s *Store) importKey(key string, history *KeyHistory, replace bool, now int64) bool {
+	shard := s.getShard(key)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if current, exists := shard.data[key]; exists {
+		current.mu.RLock()
+		live := current.latest(now) != nil
+		current.mu.RUnlock()
+		if live && !replace {
+			return false
+		}
+		s.indexDelete(key)
+	}
+
+	latest := history.latest(now)
+	for i := range history.Versions {
+		if history.Versions[i].HLC == 0 {
+			history.Versions[i].HLC = s.clock.Now()
+		}
+		s.clock.Observe(history.Versions[i].HLC)
+		history.Versions[i].Seq = int64(i + 1)
+	}
+	history.recordWrite(now)
+	history.created.Store(int64(len(history.Versions)))
+	history.first = history.Versions[0].HLC
+	history.publishCurrent()
+	shard.put(key, history)
+	s.trackBucket(key)
+
+	s.ttlWheel.Remove(key)
+	if latest.TTL > 0 {
+		s.ttlWheel.Add(key, latest.TTL)
+	}
+	if latest.Type == TypeString || latest.Type == TypeJSON {
+		s.indexWrite(key, latest.Data)
+	}
+	s.publishWrite(key, latest)
+	return true
+}
+
+func restoreVersion(version VersionDump) (Value, error) {
+	value := Value{
+		Data:      version.Data,
+		Timestamp: version.Timestamp,
+		HLC:       version.HLC,
+		TTL:       version.TTL,
+		Deleted:   version.Deleted,
+	}
+
+	switch version.Type {
+	case TypeString.String():
+		value.Type = TypeString
+	case TypeSet.String():
+		value.Type = TypeSet
+		value.Set = make(map[string]struct{}, len(version.Members))
+		for _, member := range version.Members {
+			value.Set[member] = struct{}{}
+		}
+	case TypeZSet.String():
+		value.Type = TypeZSet
+		value.ZSet = NewSortedSet()
+		addZMembers(value.ZSet, version.ZMembers)
+	case TypeJSON.String():
+		doc, err := jsonpath.Decode(version.Data)
+		if err != nil {
+			return Value{}, err
+		}
+		value.Type, value.JSON = TypeJSON, doc
+	case TypeSketch.String():
+		if version.Sketch == nil {
+			return Value{}, fmt.Errorf("sketch version without a sketch")
+		}
+		value.Type, value.Sketch = TypeSketch, version.Sketch
+	default:
+		return Value{}, fmt.Errorf("unknown type '%s'", version.Type)
+	}
+	return value, nil
+}
+
+// Copy copies key src with its whole history to dst in database to, which
+// may be s. An existing dst is only replaced if replace is set. It reports
+// false if src does not exist or dst was kept.
+func (s *Store) Copy(src string, to *Store, dst string, replace bool) (bool, error) {
+	dump, exists := s.ExportKey(src)
+	if !exists {
+		return false, nil
+	}
+	dump.Key = dst
+	return to.ImportKey(dump, replace)
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestStoreExportImportKey(t *testing.T) {
+	src := NewStore()
+	defer src.Close()
+
+	src.Set("str", "v1", 0)
+	src.Set("str", "v2", 60_000)
+	src.SAdd("set", "a", "b")
+	src.ZAdd("zset", ZMember{Member: "m", Score: 2.5})
+	src.JSONSet("doc", "$", `{"n":1}`, JSONAlways)
+	src.SketchAdd("lat", 1, 2, 3)
+	policy, _ := ParseRetention("count:5")
+	src.SetKeyRetention("str", policy)
+
+	if _, ok := src.ExportKey("missing"); ok {
+		t.Fatal("Expected no dump for a missing key")
+	}
+
+	dst := NewStore()
+	defer dst.Close()
+
+	for _, key := range []string{"str", "set", "zset", "doc", "lat"} {
+		dump, ok := src.ExportKey(key)
+		if !ok {
+			t.Fatalf("Expected a dump of %s", key)
+		}
+		// Dumps travel as JSON
+		encoded, err := json.Marshal(dump)
+		if err != nil {
+			t.Fatalf("Marshal %s: %v", key, err)
+		}
+		var decoded KeyDump
+		if err := json.Unmarshal(encoded, &decoded); err != nil {
+			t.Fatalf("Unmarshal %s: %v", key, err)
+		}
+		if ok, err := dst.ImportKey(decoded, false); !ok || err != nil {
+			t.Fatalf("ImportKey(%s) = %v, %v", key, ok, err)
+		}
+	}
+
+	if value, _, _ := dst.Get("str"); value != "v2" {
+		t.Errorf("Expected v2, got %q", value)
+	}
+	if history := dst.History("str", 0); len(history) != 2 {
+		t.Errorf("Expected 2 versions, got %d", len(history))
+	}
+	if ttl := dst.TTL("str"); ttl <= 0 || ttl > 60_000 {
+		t.Errorf("Expected the TTL to be kept, got %d", ttl)
+	}
+	if policy, own, _ := dst.KeyRetention("str"); !own || policy.String() != "count:5" {
+		t.Errorf("Expected the key retention to be kept, got %v %v", policy, own)
+	}
+	if members, _ := dst.SMembers("set"); len(members) != 2 {
+		t.Errorf("Expected 2 members, got %v", members)
+	}
+	if score, ok, _ := dst.ZScore("zset", "m"); !ok || score != 2.5 {
+		t.Errorf("Expected score 2.5, got %v", score)
+	}
+	if doc, _, _ := dst.JSONGet("doc", "$.n"); doc != "1" {
+		t.Errorf("Unexpected document %s", doc)
+	}
+	if info, _, err := dst.SketchInfo("lat"); err != nil || info.Count != 3 {
+		t.Errorf("Expected 3 sketch values, got %+v, %v", info, err)
+	}
+
+	// Imported HLCs keep later writes ordered after them
+	dst.Set("str", "v3", 0)
+	history := dst.History("str", 0)
+	if history[0].HLC <= history[1].HLC {
+		t.Errorf("Expected the new version to order after the imported ones")
+	}
+
+	// Existing keys are kept unless replace is set
+	dump, _ := src.ExportKey("str")
+	if ok, _ := dst.ImportKey(dump, false); ok {
+		t.Error("Expected the existing key to be kept")
+	}
+	if ok, _ := dst.ImportKey(dump, true); !ok {
+		t.Error("Expected the key to be replaced")
+	}
+	if value, _, _ := dst.Get("str"); value != "v2" {
+		t.Errorf("Expected v2 after replace, got %q", value)
+	}
+
+	// Expired dumps are not imported
+	dump.Key = "gone"
+	for i := range dump.Versions {
+		dump.Versions[i].TTL = time.Now().UnixMilli() - 1
+	}
+	if ok, err := dst.ImportKey(dump, false); ok || err != nil {
+		t.Errorf("Expected an expired dump to be skipped, got %v, %v", ok, err)
+	}
+}
+
+func TestEncodeDecodeDump(t *testing.T) {
+	s := NewStore()
+	defer s.Close()
+
+	s.Set("k", "v1", 0)
+	s.Set("k", "v2", 60_000)
+	dump, _ := s.ExportKey("k")
+	payload := EncodeDump(dump)
+
+	decoded, err := DecodeDump("copy", payload)
+	if err != nil {
+		t.Fatalf("DecodeDump: %v", err)
+	}
+	if decoded.Key != "copy" || len(decoded.Versions) != 2 || decoded.Versions[1].TTL != dump.Versions[1].TTL {
+		t.Errorf("Unexpected decoded dump %+v", decoded)
+	}
+
+	corrupt := append([]byte(nil), payload...)
+	corrupt[len(corrupt)/2] ^= 1
+	for _, bad := range [][]byte{nil, payload[:5], corrupt, append([]byte{2}, payload[1:]...)} {
+		if _, err := DecodeDump("k", bad); err != ErrBadPayload {
+			t.Errorf("Expected %q to be rejected, got %v", bad, err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// EventType is the kind of an Event
+type EventType string
+
+const (
+	EventSet    EventType = "SET"
+	EventDelete EventType = "DELETE"
+	EventExpire EventType = "EXPIRE"
+)
+
+// Event is a past write, delete or expiration of a key, rebuilt from its
+// retained history
+type Event struct {
+	Type      EventType
+	Key       string
+	ValueType ValueType // Of the value a SET wrote
+	Value     string    // Written string or encoded JSON document, empty for other types
+	Timestamp int64     // Unix milliseconds
+	HLC       HLC       // Of the version written, 0 for an expiration
+}
+
+// HasValue reports whether the event carries the value it wrote: a SET of
+// a string or a JSON document
+func (e Event) HasValue() bool {
+	return e.Type == EventSet && (e.ValueType == TypeString || e.ValueType == TypeJSON)
+}
+
+// writeEvent is the SET event of writing version to key
+func writeEvent(key string, version *Value) Event {
+	event := Event{Type: EventSet, Key: key, ValueType: version.Type, Timestamp: version.Timestamp, HLC: version.HLC}
+	if version.readable() {
+		event.Value = version.Data
+	}
+	return event
+}
+
+// Events returns the events of every key matching pattern between startMs
+// and endMs, both inclusive, ordered by time. It replays what retention
+// still keeps: pruned versions and purged keys are gone. Like the bulk
+// operations it stops between shards once ctx is done.
+func (s *Store) Events(ctx context.Context, pattern string, startMs, endMs int64) ([]Event, error) {
+	now := time.Now().UnixMilli()
+	var events []Event
+	for _, shard := range s.shards {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		shard.mu.RLock()
+		for key, history := range shard.data {
+			if pattern != "" && !MatchPattern(pattern, key) {
+				continue
+			}
+			history.mu.RLock()
+			events = appendEvents(events, key, history, now, startMs, endMs)
+			history.mu.RUnlock()
+		}
+		shard.mu.RUnlock()
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Timestamp != events[j].Timestamp {
+			return events[i].Timestamp < events[j].Timestamp
+		}
+		if events[i].HLC != events[j].HLC {
+			return events[i].HLC < events[j].HLC
+		}
+		return events[i].Key < events[j].Key
+	})
+	return events, nil
+}
+
+// appendEvents appends the events of one history in the time range. A
+// version expired if its expiration passed before the next version was
+// written. The caller must hold the history lock.
+func appendEvents(events []Event, key string, history *KeyHistory, now, startMs, endMs int64) []Event {
+	inRange := func(ts int64) bool { return ts >= startMs && ts <= endMs }
+
+	for i := range history.Versions {
+		version := &history.Versions[i]
+		if version.Deleted {
+			if inRange(version.Timestamp) {
+				events = append(events, Event{Type: EventDelete, Key: key, Timestamp: version.Timestamp, HLC: version.HLC})
+			}
+			continue
+		}
+
+		if inRange(version.Timestamp) {
+			events = append(events, writeEvent(key, version))
+		}
+
+		end := now
+		if i+1 < len(history.Versions) {
+			end = history.Versions[i+1].Timestamp
+		}
+		if expiration := history.expiration(version); expiration > 0 && expiration <= end && inRange(expiration) {
+			events = append(events, Event{Type: EventExpire, Key: key, Timestamp: expiration})
+		}
+	}
+	return events
+}
@@ -0,0 +1,148 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStoreEvents(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	start := time.Now().UnixMilli()
+	store.Set("user:1", "a", 0)
+	store.Set("user:2", "b", 20)
+	store.Set("order:1", "c", 0)
+	store.Set("user:1", "d", 0)
+	store.Delete("user:1")
+	time.Sleep(30 * time.Millisecond)
+
+	events, err := store.Events(context.Background(), "user:*", start, time.Now().UnixMilli())
+	if err != nil {
+		t.Fatalf("Events failed: %v", err)
+	}
+
+	var got []string
+	for _, event := range events {
+		got = append(got, string(event.Type)+" "+event.Key+" "+event.Value)
+	}
+	want := []string{"SET user:1 a", "SET user:2 b", "SET user:1 d", "DELETE user:1 ", "EXPIRE user:2 "}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Event %d: expected %q, got %q", i, want[i], got[i])
+		}
+	}
+
+	if events, _ := store.Events(context.Background(), "", start, start-1); len(events) != 0 {
+		t.Errorf("Expected no events in an empty range, got %v", events)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := store.Events(ctx, "", 0, time.Now().UnixMilli()); err == nil {
+		t.Error("Expected a canceled context to stop Events")
+	}
+}
+
+func TestStoreSubscribe(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	sub := store.Subscribe("user:*", 16)
+	store.Set("user:1", "a", 0)
+	store.Set("order:1", "b", 0)
+	store.SAdd("user:set", "x")
+	store.SAdd("user:set", "y")
+	store.Rename("user:1", "user:2")
+	store.Delete("user:2")
+	store.Set("user:3", "c", 1)
+	time.Sleep(5 * time.Millisecond)
+	store.expireKeys()
+	sub.Close()
+
+	var got []Event
+	for event := range sub.Events() {
+		got = append(got, event)
+	}
+	expected := []struct {
+		typ   EventType
+		key   string
+		value string
+	}{
+		{EventSet, "user:1", "a"},
+		{EventSet, "user:set", ""},
+		{EventSet, "user:set", ""},
+		{EventDelete, "user:1", ""},
+		{EventSet, "user:2", "a"},
+		{EventDelete, "user:2", ""},
+		{EventSet, "user:3", "c"},
+		{EventExpire, "user:3", ""},
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d events, got %+v", len(expected), got)
+	}
+	for i, e := range expected {
+		if got[i].Type != e.typ || got[i].Key != e.key || got[i].Value != e.value {
+			t.Errorf("Event %d: expected %s %s %q, got %+v", i, e.typ, e.key, e.value, got[i])
+		}
+	}
+	if got[1].ValueType != TypeSet || got[1].HasValue() || got[0].ValueType != TypeString || !got[0].HasValue() {
+		t.Errorf("Expected the value types of the string and set writes, got %+v and %+v", got[0], got[1])
+	}
+
+	// A full buffer drops events instead of blocking writes
+	slow := store.Subscribe("", 1)
+	defer slow.Close()
+	store.Set("k", "1", 0)
+	store.Set("k", "2", 0)
+	if slow.Dropped() != 1 {
+		t.Errorf("Expected 1 dropped event, got %d", slow.Dropped())
+	}
+}
+
+func TestStoreChanges(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	start := time.Now().UnixMilli()
+	store.Set("user:1", "a", 0)
+	store.Set("order:1", "b", 0)
+	store.Set("user:1", "c", 0)
+	store.Delete("user:1")
+
+	changes, err := store.Changes(context.Background(), "user:*", HLC(start)<<hlcLogicalBits-1, 0)
+	if err != nil {
+		t.Fatalf("Changes failed: %v", err)
+	}
+	if len(changes) != 3 || changes[0].Value != "a" || changes[2].Type != EventDelete {
+		t.Fatalf("Expected the 3 changes of user:1, got %+v", changes)
+	}
+
+	// Resuming after a change returns the ones that followed it
+	page, _ := store.Changes(context.Background(), "", changes[0].ID(), 1)
+	if len(page) != 1 || page[0].Key != "order:1" {
+		t.Errorf("Expected order:1 after the first change, got %+v", page)
+	}
+	if page, _ := store.Changes(context.Background(), "", changes[2].ID(), 0); len(page) != 0 {
+		t.Errorf("Expected no change after the last one, got %+v", page)
+	}
+}
+
+func TestParseChangeID(t *testing.T) {
+	if id, err := ParseChangeID("1693353600000-3"); err != nil || id.Wall() != 1693353600000 || id.Logical() != 3 {
+		t.Errorf("Unexpected ID %v, %v", id, err)
+	}
+	// A timestamp includes the changes of its millisecond
+	if id, err := ParseChangeID("1693353600000"); err != nil || id != HLC(1693353600000)<<hlcLogicalBits-1 {
+		t.Errorf("Unexpected ID %v, %v", id, err)
+	}
+	for _, id := range []string{"", "x", "-1", "1-x", "1-70000"} {
+		if _, err := ParseChangeID(id); err == nil {
+			t.Errorf("Expected %q to be rejected", id)
+		}
+	}
+}
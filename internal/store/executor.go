@@ -0,0 +1,90 @@
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+// ShardQueueSize is the number of pending mutations buffered per shard
+const ShardQueueSize = 256
+
+// shardTask is a mutation waiting to run on a shard's owner goroutine
+type shardTask struct {
+	fn   func()
+	done chan struct{}
+}
+
+// executor is the owner goroutine of a shard. Single-key mutations are queued
+// to it and applied one at a time, so writers to a shard never contend with
+// each other and every shard sees its writes in a single, deterministic order.
+// Readers still take the shard's read lock, which the owner holds only while
+// applying a mutation. Operations spanning several shards (RENAME) lock the
+// shards directly instead of going through the queues.
+type executor struct {
+	queue   chan shardTask
+	mu      sync.RWMutex // Guards stopped against concurrent submits
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+func newExecutor() *executor {
+	e := &executor{queue: make(chan shardTask, ShardQueueSize)}
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		for task := range e.queue {
+			task.fn()
+			close(task.done)
+		}
+	}()
+
+	return e
+}
+
+// run executes fn on the owner goroutine and waits for it to complete.
+// Once the executor is stopped, fn runs on the calling goroutine instead.
+func (e *executor) run(fn func()) {
+	e.mu.RLock()
+	if e.stopped {
+		e.mu.RUnlock()
+		fn()
+		return
+	}
+
+	task := shardTask{fn: fn, done: make(chan struct{})}
+	e.queue <- task
+	e.mu.RUnlock()
+
+	<-task.done
+}
+
+// stop drains the queue and stops the owner goroutine
+func (e *executor) stop() {
+	e.mu.Lock()
+	if !e.stopped {
+		e.stopped = true
+		close(e.queue)
+	}
+	e.mu.Unlock()
+
+	e.wg.Wait()
+}
+
+// run executes a mutation of key on the owner goroutine of its shard
+func (s *Store) run(key string, fn func()) {
+	s.getShard(key).executor.run(fn)
+}
+
+// ProbeExecutors runs a no-op through the owner goroutine of every shard
+// and returns the slowest round trip. A slow probe means writes are queueing
+// behind busy shards or the owners are not being scheduled.
+func (s *Store) ProbeExecutors() time.Duration {
+	var slowest time.Duration
+	for _, shard := range s.shards {
+		start := time.Now()
+		shard.executor.run(func() {})
+		slowest = max(slowest, time.Since(start))
+	}
+	return slowest
+}
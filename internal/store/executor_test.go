@@ -0,0 +1,46 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestStoreConcurrentWrites(t *testing.T) {
+	store := NewStore()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				store.SAdd("set", fmt.Sprintf("%d-%d", i, j))
+				store.Set(fmt.Sprintf("key-%d", j), "v", 0)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n, _ := store.SCard("set"); n != 800 {
+		t.Errorf("Expected 800 members, got %d", n)
+	}
+
+	// Writes after Close are applied inline rather than blocking
+	store.Close()
+	store.Set("after-close", "v", 0)
+	if value, _, _ := store.Get("after-close"); value != "v" {
+		t.Errorf("Expected write after Close to be applied, got %q", value)
+	}
+}
+
+func TestStoreProbeExecutors(t *testing.T) {
+	store := NewStore()
+	if probe := store.ProbeExecutors(); probe <= 0 {
+		t.Errorf("Expected a positive round trip, got %v", probe)
+	}
+
+	// Probing a closed store must not block
+	store.Close()
+	store.ProbeExecutors()
+}
@@ -0,0 +1,195 @@
+package store
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ExpiryPolicy bounds how many expired keys the background sweep removes
+// per tick. Under load (average command latency above LatencyThreshold or
+// process CPU above CPUThreshold) the batch is halved down to MinBatch and
+// expired keys are left to lazy expiration: reads already treat them as
+// missing. Once the load passes the batch doubles back up to MaxBatch, and a
+// tick without commands removes every key that has come due.
+type ExpiryPolicy struct {
+	MaxBatch         int
+	MinBatch         int
+	LatencyThreshold time.Duration // Zero ignores command latency
+	CPUThreshold     float64       // Fraction of GOMAXPROCS, zero ignores CPU
+}
+
+// DefaultExpiryPolicy is the expiry policy of a new store
+var DefaultExpiryPolicy = ExpiryPolicy{
+	MaxBatch:         100_000,
+	MinBatch:         100,
+	LatencyThreshold: 5 * time.Millisecond,
+	CPUThreshold:     0.8,
+}
+
+// ExpiryStats describes the state of the background expiry sweep
+type ExpiryStats struct {
+	Expired  int64   // Keys removed by the sweep since startup
+	Batch    int     // Keys the next tick may remove
+	Backlog  int     // Expired keys left for later ticks after the last one
+	Deferred int64   // Ticks that shrank the batch because of load
+	Lazy     int64   // Keys removed because a read found them expired
+	Latency  int64   // Average command latency over the last tick, microseconds
+	CPU      float64 // Process CPU over the last tick, fraction of GOMAXPROCS
+}
+
+// expiryController adapts the expiry batch size to the load. Command
+// latencies are accumulated atomically and read once per tick.
+type expiryController struct {
+	mu      sync.Mutex
+	policy  ExpiryPolicy
+	batch   int
+	lastCPU time.Duration
+	lastAt  time.Time
+	stats   ExpiryStats
+
+	latencySum   atomic.Int64 // Nanoseconds since the last tick
+	latencyCount atomic.Int64
+}
+
+// ObserveLatency records the latency of a command, which the expiry sweep
+// uses to detect load. Load is shared, so every open database records it.
+func (s *Store) ObserveLatency(d time.Duration) {
+	for i := range s.databases.dbs {
+		if db := s.databases.dbs[i].Load(); db != nil {
+			db.expiry.latencySum.Add(int64(d))
+			db.expiry.latencyCount.Add(1)
+		}
+	}
+}
+
+// SetExpiryPolicy replaces the expiry policy. Batch sizes below 1 are
+// raised to 1 and MinBatch is capped at MaxBatch.
+func (s *Store) SetExpiryPolicy(policy ExpiryPolicy) {
+	s.databases.configure(func(db *Store) { db.setExpiryPolicy(policy) })
+}
+
+func (s *Store) setExpiryPolicy(policy ExpiryPolicy) {
+	policy.MaxBatch = max(policy.MaxBatch, 1)
+	policy.MinBatch = min(max(policy.MinBatch, 1), policy.MaxBatch)
+
+	s.expiry.mu.Lock()
+	defer s.expiry.mu.Unlock()
+	s.expiry.policy = policy
+	s.expiry.batch = policy.MaxBatch
+}
+
+// ExpiryPolicy returns the current expiry policy
+func (s *Store) ExpiryPolicy() ExpiryPolicy {
+	s.expiry.mu.Lock()
+	defer s.expiry.mu.Unlock()
+	return s.expiry.policy
+}
+
+// SetActiveExpire turns the background expiry sweep of every database on
+// or off. While it is off, expired keys are only removed once a read finds
+// them, which lets tests observe lazy expiration.
+func (s *Store) SetActiveExpire(enabled bool) {
+	s.databases.passiveExpiry.Store(!enabled)
+}
+
+// ActiveExpire reports whether the background expiry sweep runs
+func (s *Store) ActiveExpire() bool {
+	return !s.databases.passiveExpiry.Load()
+}
+
+// ExpiryStats returns the state of the background expiry sweep
+func (s *Store) ExpiryStats() ExpiryStats {
+	s.expiry.mu.Lock()
+	defer s.expiry.mu.Unlock()
+	stats := s.expiry.stats
+	stats.Batch = s.expiry.batch
+	return stats
+}
+
+// expiryBatch measures the load since the previous tick, adjusts the batch
+// size and returns how many keys this tick may expire, -1 for all of them
+func (s *Store) expiryBatch(now time.Time) int {
+	e := &s.expiry
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	sum, count := e.latencySum.Swap(0), e.latencyCount.Swap(0)
+	e.stats.Latency = 0
+	if count > 0 {
+		e.stats.Latency = sum / count / int64(time.Microsecond)
+	}
+
+	e.stats.CPU = 0
+	if cpu, ok := processCPUTime(); ok {
+		if !e.lastAt.IsZero() {
+			if wall := now.Sub(e.lastAt); wall > 0 {
+				e.stats.CPU = float64(cpu-e.lastCPU) / float64(wall) / float64(runtime.GOMAXPROCS(0))
+			}
+		}
+		e.lastCPU = cpu
+	}
+	e.lastAt = now
+
+	loaded := e.policy.LatencyThreshold > 0 && count > 0 && time.Duration(sum/count) > e.policy.LatencyThreshold
+	if e.policy.CPUThreshold > 0 && e.stats.CPU > e.policy.CPUThreshold {
+		loaded = true
+	}
+
+	switch {
+	case loaded:
+		e.batch = max(e.batch/2, e.policy.MinBatch)
+		e.stats.Deferred++
+	case count == 0:
+		e.batch = e.policy.MaxBatch
+		return -1
+	default:
+		e.batch = min(e.batch*2, e.policy.MaxBatch)
+	}
+	return e.batch
+}
+
+// recordExpiry updates the sweep statistics after a tick
+func (s *Store) recordExpiry(expired, backlog int) {
+	s.expiry.mu.Lock()
+	defer s.expiry.mu.Unlock()
+	s.expiry.stats.Expired += int64(expired)
+	s.expiry.stats.Backlog = backlog
+}
+
+// lazyExpireQueue bounds the keys reads can queue for removal between two
+// runs of the background loop
+const lazyExpireQueue = 1024
+
+// expireLazily queues key for expiration after a read found its latest
+// version expired, as a safety net for keys the sweep has not reached. It
+// never blocks: reads already treat the key as missing, so a full queue
+// only leaves the key to the sweep. Keys already turned into tombstones
+// are not queued again. The caller must hold the history lock.
+func (s *Store) expireLazily(key string, history *KeyHistory) {
+	if history.tombstone.Load() {
+		return
+	}
+	select {
+	case s.lazyExpired <- key:
+	default:
+	}
+}
+
+// expireLazyKey expires a key queued by expireLazily if it is still expired
+func (s *Store) expireLazyKey(key string) {
+	now := time.Now().UnixMilli()
+	var final Value
+	var removed bool
+	s.run(key, func() { final, removed = s.expireKey(key, now) })
+	if !removed {
+		return
+	}
+	s.ttlWheel.Remove(key)
+	s.archive(key, final, ArchiveExpired, now)
+
+	s.expiry.mu.Lock()
+	s.expiry.stats.Lazy++
+	s.expiry.mu.Unlock()
+}
@@ -0,0 +1,288 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Keyspace export. Export writes every live key in one of two formats, for
+// backups, analytics and seeding test environments, and Import reads them
+// back:
+//
+//   - JSON Lines: one KeyDump per line, with the key's retention policy
+//   - CSV: a header, then one row per version with the columns of
+//     csvHeader; the versions of a key are on consecutive rows in write
+//     order. Sets, sorted sets and sketches hold their members as JSON.
+//
+// Without history only the current version of each key is written. Like
+// the bulk operations, both stop once ctx is done.
+
+// ExportFormat is the file format of an export
+type ExportFormat string
+
+const (
+	FormatJSONL ExportFormat = "jsonl"
+	FormatCSV   ExportFormat = "csv"
+)
+
+// ParseExportFormat parses an export format name
+func ParseExportFormat(name string) (ExportFormat, error) {
+	switch format := ExportFormat(strings.ToLower(name)); format {
+	case FormatJSONL, FormatCSV:
+		return format, nil
+	default:
+		return "", fmt.Errorf("ERR unknown export format '%s', want jsonl or csv", name)
+	}
+}
+
+// ExportOptions selects what Export writes
+type ExportOptions struct {
+	Format  ExportFormat
+	Pattern string // Keys to export, all if empty
+	History bool   // Every retained version rather than only the current one
+}
+
+// ImportResult counts the keys read by Import
+type ImportResult struct {
+	Imported int
+	Skipped  int // Existing keys kept, or keys whose dump has expired
+}
+
+var csvHeader = []string{"key", "type", "value", "timestamp", "hlc", "ttl", "deleted"}
+
+// Export writes the live keys matching the options to w, one shard at a
+// time and sorted by key within a shard, and returns how many it wrote.
+// Progress is reported in shards.
+func (s *Store) Export(ctx context.Context, w io.Writer, opts ExportOptions, progress func(done, total int)) (int, error) {
+	buffered := bufio.NewWriter(w)
+	var out *csv.Writer
+	if opts.Format == FormatCSV {
+		out = csv.NewWriter(buffered)
+		if err := out.Write(csvHeader); err != nil {
+			return 0, err
+		}
+	}
+
+	exported := 0
+	for i, shard := range s.shards {
+		if err := ctx.Err(); err != nil {
+			return exported, err
+		}
+		keys := s.shardKeys(shard, opts.Pattern)
+		sort.Strings(keys)
+		for _, key := range keys {
+			dump, ok := s.ExportKey(key)
+			if !ok {
+				continue
+			}
+			if !opts.History {
+				dump.Versions = dump.Versions[len(dump.Versions)-1:]
+			}
+
+			var err error
+			if out != nil {
+				err = writeCSVDump(out, dump)
+			} else {
+				err = writeJSONLDump(buffered, dump)
+			}
+			if err != nil {
+				return exported, err
+			}
+			exported++
+		}
+		progress(i+1, ShardCount)
+	}
+
+	if out != nil {
+		out.Flush()
+		if err := out.Error(); err != nil {
+			return exported, err
+		}
+	}
+	return exported, buffered.Flush()
+}
+
+func writeJSONLDump(w *bufio.Writer, dump KeyDump) error {
+	encoded, err := json.Marshal(dump)
+	if err != nil {
+		return err
+	}
+	w.Write(encoded)
+	return w.WriteByte('\n')
+}
+
+func writeCSVDump(w *csv.Writer, dump KeyDump) error {
+	for _, version := range dump.Versions {
+		value := version.Data
+		var members interface{}
+		switch {
+		case version.Members != nil:
+			members = version.Members
+		case version.ZMembers != nil:
+			members = version.ZMembers
+		case version.Sketch != nil:
+			members = version.Sketch
+		}
+		if members != nil {
+			encoded, err := json.Marshal(members)
+			if err != nil {
+				return err
+			}
+			value = string(encoded)
+		}
+
+		err := w.Write([]string{
+			dump.Key,
+			version.Type,
+			value,
+			strconv.FormatInt(version.Timestamp, 10),
+			strconv.FormatUint(uint64(version.HLC), 10),
+			strconv.FormatInt(version.TTL, 10),
+			strconv.FormatBool(version.Deleted),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Import recreates the keys of an export read from r with ImportKey,
+// keeping existing keys unless replace is set. It stops at the first
+// malformed record, with the keys before it imported. Progress is reported
+// in keys, with an unknown total.
+func (s *Store) Import(ctx context.Context, r io.Reader, format ExportFormat, replace bool, progress func(done, total int)) (ImportResult, error) {
+	var result ImportResult
+	apply := func(dump KeyDump) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		imported, err := s.ImportKey(dump, replace)
+		if err != nil {
+			return err
+		}
+		if imported {
+			result.Imported++
+		} else {
+			result.Skipped++
+		}
+		progress(result.Imported+result.Skipped, 0)
+		return nil
+	}
+
+	var err error
+	if format == FormatCSV {
+		err = readCSVDumps(r, apply)
+	} else {
+		err = readJSONLDumps(r, apply)
+	}
+	return result, err
+}
+
+func readJSONLDumps(r io.Reader, apply func(KeyDump) error) error {
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		record, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if len(strings.TrimSpace(string(record))) > 0 {
+			var dump KeyDump
+			if err := json.Unmarshal(record, &dump); err != nil || dump.Key == "" || len(dump.Versions) == 0 {
+				return fmt.Errorf("ERR invalid key dump on line %d", line)
+			}
+			if err := apply(dump); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// readCSVDumps gathers the consecutive rows of each key into a dump
+func readCSVDumps(r io.Reader, apply func(KeyDump) error) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(csvHeader)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil || strings.Join(header, ",") != strings.Join(csvHeader, ",") {
+		return fmt.Errorf("ERR the CSV header must be %s", strings.Join(csvHeader, ","))
+	}
+
+	var dump KeyDump
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("ERR invalid CSV: %v", err)
+		}
+		if row[0] != dump.Key && len(dump.Versions) > 0 {
+			if err := apply(dump); err != nil {
+				return err
+			}
+			dump = KeyDump{}
+		}
+		version, err := parseCSVVersion(row)
+		if err != nil {
+			line, _ := reader.FieldPos(0)
+			return fmt.Errorf("ERR invalid row on line %d: %v", line, err)
+		}
+		dump.Key = row[0]
+		dump.Versions = append(dump.Versions, version)
+	}
+	if len(dump.Versions) == 0 {
+		return nil
+	}
+	return apply(dump)
+}
+
+func parseCSVVersion(row []string) (VersionDump, error) {
+	version := VersionDump{Type: row[1]}
+	var err error
+	if version.Timestamp, err = strconv.ParseInt(row[3], 10, 64); err != nil {
+		return version, fmt.Errorf("invalid timestamp")
+	}
+	hlc, err := strconv.ParseUint(row[4], 10, 64)
+	if err != nil {
+		return version, fmt.Errorf("invalid hlc")
+	}
+	version.HLC = HLC(hlc)
+	if version.TTL, err = strconv.ParseInt(row[5], 10, 64); err != nil {
+		return version, fmt.Errorf("invalid ttl")
+	}
+	if version.Deleted, err = strconv.ParseBool(row[6]); err != nil {
+		return version, fmt.Errorf("invalid deleted flag")
+	}
+	if version.Deleted {
+		return version, nil
+	}
+
+	switch version.Type {
+	case TypeSet.String():
+		err = json.Unmarshal([]byte(row[2]), &version.Members)
+	case TypeZSet.String():
+		err = json.Unmarshal([]byte(row[2]), &version.ZMembers)
+	case TypeSketch.String():
+		version.Sketch = &Sketch{}
+		err = json.Unmarshal([]byte(row[2]), version.Sketch)
+	default:
+		version.Data = row[2]
+	}
+	if err != nil {
+		return version, fmt.Errorf("invalid %s members", version.Type)
+	}
+	return version, nil
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestStoreExportImport(t *testing.T) {
+	src := NewStore()
+	defer src.Close()
+
+	src.Set("str", "v1", 0)
+	src.Set("str", "v2, \"quoted\"\nline", 60_000)
+	src.SAdd("set", "a", "b")
+	src.ZAdd("zset", ZMember{Member: "m", Score: 2.5})
+	src.JSONSet("doc", "$", `{"n":1}`, JSONAlways)
+	src.SketchAdd("lat", 1, 2, 3)
+	src.Set("other", "x", 0)
+
+	noProgress := func(done, total int) {}
+	for _, format := range []ExportFormat{FormatJSONL, FormatCSV} {
+		for _, history := range []bool{false, true} {
+			var buf bytes.Buffer
+			opts := ExportOptions{Format: format, History: history}
+			exported, err := src.Export(context.Background(), &buf, opts, noProgress)
+			if err != nil || exported != 6 {
+				t.Fatalf("%s export: %d keys, %v", format, exported, err)
+			}
+
+			dst := NewStore()
+			result, err := dst.Import(context.Background(), &buf, format, false, noProgress)
+			if err != nil || result.Imported != 6 {
+				t.Fatalf("%s import: %+v, %v", format, result, err)
+			}
+
+			if value, _, _ := dst.Get("str"); value != "v2, \"quoted\"\nline" {
+				t.Errorf("%s: expected the string to survive, got %q", format, value)
+			}
+			versions := 1
+			if history {
+				versions = 2
+			}
+			if got := len(dst.History("str", 0)); got != versions {
+				t.Errorf("%s with history %v: expected %d versions, got %d", format, history, versions, got)
+			}
+			if ttl := dst.TTL("str"); ttl <= 0 {
+				t.Errorf("%s: expected the TTL to be kept, got %d", format, ttl)
+			}
+			if members, _ := dst.SMembers("set"); len(members) != 2 {
+				t.Errorf("%s: expected 2 members, got %v", format, members)
+			}
+			if score, ok, _ := dst.ZScore("zset", "m"); !ok || score != 2.5 {
+				t.Errorf("%s: expected score 2.5, got %v", format, score)
+			}
+			if doc, _, _ := dst.JSONGet("doc", "$.n"); doc != "1" {
+				t.Errorf("%s: expected the document, got %q", format, doc)
+			}
+			if info, _, err := dst.SketchInfo("lat"); err != nil || info.Count != 3 {
+				t.Errorf("%s: expected the sketch, got %+v, %v", format, info, err)
+			}
+			dst.Close()
+		}
+	}
+
+	var buf bytes.Buffer
+	if exported, _ := src.Export(context.Background(), &buf, ExportOptions{Format: FormatJSONL, Pattern: "s*"}, noProgress); exported != 2 {
+		t.Errorf("Expected MATCH s* to export 2 keys, got %d", exported)
+	}
+	result, err := src.Import(context.Background(), &buf, FormatJSONL, false, noProgress)
+	if err != nil || result.Skipped != 2 {
+		t.Errorf("Expected existing keys to be skipped, got %+v, %v", result, err)
+	}
+}
+
+func TestStoreImportMalformed(t *testing.T) {
+	s := NewStore()
+	defer s.Close()
+
+	noProgress := func(done, total int) {}
+	for format, input := range map[ExportFormat]string{
+		FormatJSONL: `{"key":"a","versions":[{"type":"string","data":"1","timestamp":1,"hlc":1}]}` + "\nnot json\n",
+		FormatCSV:   strings.Join(csvHeader, ",") + "\na,string,1,1,1,0,false\nb,string,1,soon,1,0,false\n",
+	} {
+		result, err := s.Import(context.Background(), strings.NewReader(input), format, true, noProgress)
+		if err == nil || !strings.Contains(err.Error(), "line 2") && !strings.Contains(err.Error(), "line 3") {
+			t.Errorf("%s: expected the malformed line to be reported, got %v", format, err)
+		}
+		if result.Imported != 1 {
+			t.Errorf("%s: expected the keys before the error to be imported, got %+v", format, result)
+		}
+	}
+
+	if _, err := s.Import(context.Background(), strings.NewReader("k,v\n"), FormatCSV, false, noProgress); err == nil {
+		t.Error("Expected a wrong CSV header to be rejected")
+	}
+	if _, err := ParseExportFormat("xml"); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultSubscriptionBuffer is how many events a subscription holds for a
+// slow reader before it starts dropping them
+const DefaultSubscriptionBuffer = 1024
+
+// Subscription receives the live events of the keys matching a pattern,
+// see Subscribe
+type Subscription struct {
+	pattern string
+	events  chan Event
+	dropped atomic.Uint64
+	feed    *feed
+}
+
+// Events returns the channel events are delivered on. It is closed by Close.
+func (sub *Subscription) Events() <-chan Event {
+	return sub.events
+}
+
+// Dropped returns how many events were dropped because the buffer was full
+func (sub *Subscription) Dropped() uint64 {
+	return sub.dropped.Load()
+}
+
+// Close stops the subscription and closes its channel
+func (sub *Subscription) Close() {
+	sub.feed.mu.Lock()
+	defer sub.feed.mu.Unlock()
+
+	if _, exists := sub.feed.subs[sub]; !exists {
+		return
+	}
+	delete(sub.feed.subs, sub)
+	sub.feed.active.Add(-1)
+	close(sub.events)
+}
+
+// feed fans the live key events out to the subscriptions
+type feed struct {
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	active atomic.Int32 // len(subs), read without the lock on every write
+}
+
+// Subscribe delivers the events of every key matching pattern from now on:
+// writes, deletes and expirations, in the order each key saw them. Writes
+// never wait for a subscriber: once buffer events are pending, further ones
+// are dropped and counted in Dropped. The subscription must be closed.
+func (s *Store) Subscribe(pattern string, buffer int) *Subscription {
+	if buffer <= 0 {
+		buffer = DefaultSubscriptionBuffer
+	}
+	sub := &Subscription{
+		pattern: pattern,
+		events:  make(chan Event, buffer),
+		feed:    &s.feed,
+	}
+
+	s.feed.mu.Lock()
+	defer s.feed.mu.Unlock()
+	if s.feed.subs == nil {
+		s.feed.subs = make(map[*Subscription]struct{})
+	}
+	s.feed.subs[sub] = struct{}{}
+	s.feed.active.Add(1)
+	return sub
+}
+
+// publish hands event to the subscriptions whose pattern matches its key.
+// It never blocks, so it may be called with store locks held.
+func (s *Store) publish(event Event) {
+	if s.feed.active.Load() == 0 {
+		return
+	}
+
+	s.feed.mu.RLock()
+	defer s.feed.mu.RUnlock()
+	for sub := range s.feed.subs {
+		if sub.pattern != "" && !MatchPattern(sub.pattern, event.Key) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// publishWrite publishes the write of val to key
+func (s *Store) publishWrite(key string, val *Value) {
+	if s.feed.active.Load() == 0 {
+		return
+	}
+
+	if val.Deleted {
+		s.publish(Event{Type: EventDelete, Key: key, Timestamp: val.Timestamp, HLC: val.HLC})
+		return
+	}
+	s.publish(writeEvent(key, val))
+}
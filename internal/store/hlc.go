@@ -0,0 +1,61 @@
+package store
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// hlcLogicalBits is the number of low bits of an HLC holding the counter
+const hlcLogicalBits = 16
+
+// HLC is a hybrid logical clock timestamp: wall time in Unix milliseconds in
+// the high bits and a counter in the low 16 bits. HLCs compare as integers,
+// so versions stay ordered when several are written in the same millisecond
+// or the wall clock steps backwards.
+type HLC uint64
+
+// Wall returns the wall time part in Unix milliseconds
+func (h HLC) Wall() int64 {
+	return int64(h >> hlcLogicalBits)
+}
+
+// Logical returns the counter ordering events within the same wall time
+func (h HLC) Logical() uint16 {
+	return uint16(h)
+}
+
+// String renders the timestamp as wall-logical, e.g. 1693353600000-2
+func (h HLC) String() string {
+	return strconv.FormatInt(h.Wall(), 10) + "-" + strconv.FormatUint(uint64(h.Logical()), 10)
+}
+
+// hlcClock hands out strictly increasing HLCs. While the wall clock is
+// behind the last timestamp, the counter advances instead, carrying into
+// the wall time if it overflows.
+type hlcClock struct {
+	last atomic.Uint64
+}
+
+// Now returns an HLC greater than any returned before
+func (c *hlcClock) Now() HLC {
+	wall := uint64(time.Now().UnixMilli()) << hlcLogicalBits
+	for {
+		last := c.last.Load()
+		next := max(wall, last+1)
+		if c.last.CompareAndSwap(last, next) {
+			return HLC(next)
+		}
+	}
+}
+
+// Observe moves the clock past h, a timestamp from another clock, so the
+// next HLC handed out orders after it
+func (c *hlcClock) Observe(h HLC) {
+	for {
+		last := c.last.Load()
+		if last >= uint64(h) || c.last.CompareAndSwap(last, uint64(h)) {
+			return
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package store
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Isolation. A script reads and writes several keys as one step: it holds
+// the isolation lock exclusively while it runs, and every other command
+// holds it shared, whichever listener or API it arrives by, so it runs
+// wholly before or after the script and no write lands between two of the
+// script's commands. The lock is shared by every logical database. Until
+// EnableIsolation is called Shared and Exclusive return at once, so a
+// store without scripts pays nothing for it.
+
+// isolation is the lock of a store's databases, see Shared
+type isolation struct {
+	enabled atomic.Bool
+	mu      sync.RWMutex
+}
+
+// EnableIsolation makes Shared and Exclusive take the isolation lock. It is
+// called once, before the store serves commands.
+func (s *Store) EnableIsolation() {
+	s.databases.isolation.enabled.Store(true)
+}
+
+// Shared holds the isolation lock shared while a command runs and returns
+// the function releasing it. The lock is not reentrant: a command run by
+// the holder of Exclusive must not take it.
+func (s *Store) Shared() (release func()) {
+	iso := &s.databases.isolation
+	if !iso.enabled.Load() {
+		return func() {}
+	}
+	iso.mu.RLock()
+	return iso.mu.RUnlock
+}
+
+// Exclusive holds the isolation lock exclusively, once the commands holding
+// it shared are done, and returns the function releasing it
+func (s *Store) Exclusive() (release func()) {
+	iso := &s.databases.isolation
+	if !iso.enabled.Load() {
+		return func() {}
+	}
+	iso.mu.Lock()
+	return iso.mu.Unlock
+}
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStoreIsolation(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	// Without isolation both locks are free
+	release := store.Exclusive()
+	store.Shared()()
+	release()
+
+	store.EnableIsolation()
+	db, _ := store.DB(1)
+
+	// A write through any database waits for the exclusive holder
+	release = store.Exclusive()
+	written := make(chan struct{})
+	go func() {
+		defer db.Shared()()
+		db.Set("k", "v", 0)
+		close(written)
+	}()
+
+	select {
+	case <-written:
+		t.Fatal("Expected the write to wait for the exclusive holder")
+	case <-time.After(20 * time.Millisecond):
+	}
+	release()
+	select {
+	case <-written:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the write once the exclusive holder released the lock")
+	}
+
+	// Shared holders run side by side
+	first := store.Shared()
+	second := db.Shared()
+	first()
+	second()
+}
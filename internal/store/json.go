@@ -0,0 +1,266 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"pulsedb/internal/jsonpath"
+)
+
+// Errors returned by the JSON commands
+var (
+	ErrJSONNewAtRoot  = errors.New("ERR new objects must be created at the root")
+	ErrJSONNotNumber  = errors.New("ERR value at path is not a number")
+	ErrJSONNoSuchPath = errors.New("ERR path does not exist")
+)
+
+// JSONCondition restricts when JSONSet writes
+type JSONCondition int
+
+const (
+	JSONAlways     JSONCondition = iota
+	JSONIfMissing                // NX: only if the path does not exist
+	JSONIfExisting               // XX: only if the path exists
+)
+
+// JSONSet sets the value at path in the JSON document stored at key,
+// creating the document when path is the root. Every update is a new
+// version holding a new document, so GETAT and HIST see earlier documents.
+// It reports false if the condition prevented the write.
+func (s *Store) JSONSet(key, path, value string, cond JSONCondition) (written bool, err error) {
+	p, err := parsePath(path)
+	if err != nil {
+		return false, err
+	}
+	v, err := jsonpath.Decode(value)
+	if err != nil {
+		return false, fmt.Errorf("ERR invalid JSON: %v", err)
+	}
+
+	err = s.updateJSON(key, func(doc interface{}, exists bool) (interface{}, bool, error) {
+		if !exists {
+			if len(p) > 0 {
+				return nil, false, ErrJSONNewAtRoot
+			}
+			written = cond != JSONIfExisting
+			return v, written, nil
+		}
+
+		_, found := p.Get(doc)
+		if (cond == JSONIfMissing && found) || (cond == JSONIfExisting && !found) {
+			return nil, false, nil
+		}
+		updated, err := p.Set(doc, v)
+		if err != nil {
+			return nil, false, fmt.Errorf("ERR %v", err)
+		}
+		written = true
+		return updated, true, nil
+	})
+	return written, err
+}
+
+// JSONGet returns the value at path in the JSON document stored at key,
+// encoded as JSON
+func (s *Store) JSONGet(key, path string) (string, bool, error) {
+	p, err := parsePath(path)
+	if err != nil {
+		return "", false, err
+	}
+
+	doc, exists, err := s.jsonDocument(key)
+	if err != nil || !exists {
+		return "", false, err
+	}
+	v, found := p.Get(doc)
+	if !found {
+		return "", false, ErrJSONNoSuchPath
+	}
+	return jsonpath.Encode(v), true, nil
+}
+
+// JSONDel deletes the value at path, or the whole key when path is the
+// root, and returns the number of values deleted
+func (s *Store) JSONDel(key, path string) (deleted int, err error) {
+	p, err := parsePath(path)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(p) == 0 {
+		s.run(key, func() {
+			var exists bool
+			if _, exists, err = s.jsonDocument(key); exists && s.delete(key) {
+				deleted = 1
+			}
+		})
+		return deleted, err
+	}
+
+	err = s.updateJSON(key, func(doc interface{}, exists bool) (interface{}, bool, error) {
+		if !exists {
+			return nil, false, nil
+		}
+		updated, removed := p.Delete(doc)
+		if removed {
+			deleted = 1
+		}
+		return updated, removed, nil
+	})
+	return deleted, err
+}
+
+// JSONNumIncrBy adds increment to the number at path and returns the result,
+// keeping integers exact when both operands are integers
+func (s *Store) JSONNumIncrBy(key, path, increment string) (result string, err error) {
+	p, err := parsePath(path)
+	if err != nil {
+		return "", err
+	}
+	by := json.Number(increment)
+	if _, err := by.Float64(); err != nil {
+		return "", errors.New("ERR increment is not a number")
+	}
+
+	err = s.updateJSON(key, func(doc interface{}, exists bool) (interface{}, bool, error) {
+		if !exists {
+			return nil, false, errors.New("ERR no such key")
+		}
+		current, found := p.Get(doc)
+		if !found {
+			return nil, false, ErrJSONNoSuchPath
+		}
+		n, ok := current.(json.Number)
+		if !ok {
+			return nil, false, ErrJSONNotNumber
+		}
+
+		sum, err := addNumbers(n, by)
+		if err != nil {
+			return nil, false, err
+		}
+		result = sum.String()
+		updated, err := p.Set(doc, sum)
+		return updated, err == nil, err
+	})
+	return result, err
+}
+
+// addNumbers adds two JSON numbers, in integer arithmetic if both are integers
+func addNumbers(a, b json.Number) (json.Number, error) {
+	x, errX := strconv.ParseInt(a.String(), 10, 64)
+	y, errY := strconv.ParseInt(b.String(), 10, 64)
+	if errX == nil && errY == nil {
+		if sum := x + y; (sum > x) == (y > 0) {
+			return json.Number(strconv.FormatInt(sum, 10)), nil
+		}
+		return "", errors.New("ERR increment would overflow")
+	}
+
+	f, _ := a.Float64()
+	g, _ := b.Float64()
+	return json.Number(strconv.FormatFloat(f+g, 'g', -1, 64)), nil
+}
+
+// jsonDocument returns the current JSON document stored at key
+func (s *Store) jsonDocument(key string) (interface{}, bool, error) {
+	now := time.Now().UnixMilli()
+	shard := s.getShard(key)
+
+	shard.mu.RLock()
+	history, exists := shard.data[key]
+	shard.mu.RUnlock()
+
+	if !exists {
+		return nil, false, nil
+	}
+
+	history.recordRead(now)
+
+	history.mu.RLock()
+	defer history.mu.RUnlock()
+
+	latest := history.latest(now)
+	if latest == nil {
+		s.expireLazily(key, history)
+		return nil, false, nil
+	}
+	if latest.Type != TypeJSON {
+		return nil, false, ErrWrongType
+	}
+	history.slide(now)
+	return latest.JSON, true, nil
+}
+
+// updateJSON applies fn to the current document of key and, if fn reports
+// a change, stores the document it returns as a new version, keeping the
+// key's TTL. The new document goes through the validators and search
+// indexes like a SET of its encoding.
+func (s *Store) updateJSON(key string, fn func(doc interface{}, exists bool) (interface{}, bool, error)) (err error) {
+	s.run(key, func() { err = s.updateJSONLocked(key, fn) })
+	return
+}
+
+func (s *Store) updateJSONLocked(key string, fn func(doc interface{}, exists bool) (interface{}, bool, error)) error {
+	now := time.Now().UnixMilli()
+	shard := s.getShard(key)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	var current *Value
+	if history, exists := shard.data[key]; exists {
+		history.mu.RLock()
+		current = history.latest(now)
+		history.mu.RUnlock()
+	}
+	if current != nil && current.Type != TypeJSON {
+		return ErrWrongType
+	}
+
+	var doc interface{}
+	var expiration int64
+	if current != nil {
+		doc, expiration = current.JSON, current.TTL
+	}
+
+	updated, changed, err := fn(doc, current != nil)
+	if err != nil || !changed {
+		return err
+	}
+
+	encoded := jsonpath.Encode(updated)
+	if err := s.validate(key, encoded); err != nil {
+		return err
+	}
+
+	if current == nil {
+		if ttl := s.defaultTTL(key); ttl > 0 {
+			s.defaultTTLsApplied.Add(1)
+			expiration = now + ttl
+			s.ttlWheel.Add(key, expiration)
+		}
+	}
+
+	s.appendVersion(shard, key, Value{
+		Data:      encoded,
+		Type:      TypeJSON,
+		JSON:      updated,
+		Timestamp: now,
+		TTL:       expiration,
+	})
+	s.indexWrite(key, encoded)
+	return nil
+}
+
+func parsePath(path string) (jsonpath.Path, error) {
+	p, err := jsonpath.Parse(strings.TrimSpace(path))
+	if err != nil {
+		return nil, fmt.Errorf("ERR invalid path: %v", err)
+	}
+	return p, nil
+}
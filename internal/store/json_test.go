@@ -0,0 +1,84 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStoreJSON(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	if _, err := store.JSONSet("doc", "$.a", "1", JSONAlways); err != ErrJSONNewAtRoot {
+		t.Errorf("Expected ErrJSONNewAtRoot, got %v", err)
+	}
+	if _, err := store.JSONSet("doc", "$", `{"a":1,"b":{"c":[1,2]}}`, JSONAlways); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	first := store.History("doc", 1)[0].Timestamp
+	time.Sleep(2 * time.Millisecond)
+
+	if _, err := store.JSONSet("doc", "$.b.c[1]", `"two"`, JSONAlways); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if value, _, _ := store.JSONGet("doc", "$.b"); value != `{"c":[1,"two"]}` {
+		t.Errorf("Unexpected $.b %s", value)
+	}
+
+	// Every update is a version; earlier documents are unchanged
+	if value, _, _ := store.GetAt("doc", first); value != `{"a":1,"b":{"c":[1,2]}}` {
+		t.Errorf("Expected the first document at its timestamp, got %s", value)
+	}
+	if typ, _ := store.Type("doc"); typ != TypeJSON {
+		t.Errorf("Expected json type, got %s", typ)
+	}
+
+	// NX and XX
+	if written, _ := store.JSONSet("doc", "$.a", "2", JSONIfMissing); written {
+		t.Error("Expected NX on an existing path not to write")
+	}
+	if written, _ := store.JSONSet("doc", "$.z", "2", JSONIfExisting); written {
+		t.Error("Expected XX on a missing path not to write")
+	}
+
+	if result, err := store.JSONNumIncrBy("doc", "$.a", "41"); err != nil || result != "42" {
+		t.Errorf("Expected 42, got %s (%v)", result, err)
+	}
+	if result, _ := store.JSONNumIncrBy("doc", "$.a", "0.5"); result != "42.5" {
+		t.Errorf("Expected 42.5, got %s", result)
+	}
+	if _, err := store.JSONNumIncrBy("doc", "$.b", "1"); err != ErrJSONNotNumber {
+		t.Errorf("Expected ErrJSONNotNumber, got %v", err)
+	}
+
+	if deleted, _ := store.JSONDel("doc", "$.b.c[0]"); deleted != 1 {
+		t.Errorf("Expected 1 deleted, got %d", deleted)
+	}
+	if value, _, _ := store.JSONGet("doc", "$"); value != `{"a":42.5,"b":{"c":["two"]}}` {
+		t.Errorf("Unexpected document %s", value)
+	}
+	if deleted, _ := store.JSONDel("doc", "$"); deleted != 1 {
+		t.Errorf("Expected the key to be deleted, got %d", deleted)
+	}
+	if _, exists, _ := store.Get("doc"); exists {
+		t.Error("Expected the key to be gone")
+	}
+
+	// Strings are not JSON documents, and JSON writes are validated
+	store.Set("str", "x", 0)
+	if _, _, err := store.JSONGet("str", "$"); err != ErrWrongType {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+	store.SetValidator("checked:*", rejectAll{})
+	var validationErr *ValidationError
+	if _, err := store.JSONSet("checked:1", "$", "{}", JSONAlways); !errors.As(err, &validationErr) {
+		t.Errorf("Expected a validation error, got %v", err)
+	}
+}
+
+type rejectAll struct{}
+
+func (rejectAll) Validate(key, value string) error {
+	return errors.New("rejected")
+}
@@ -0,0 +1,199 @@
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNoSuchKey is returned when a command requires an existing key
+var ErrNoSuchKey = errors.New("ERR no such key")
+
+// Exists returns how many of the given keys currently exist. Keys given
+// more than once are counted each time, as in Redis.
+func (s *Store) Exists(keys ...string) int {
+	now := time.Now().UnixMilli()
+	count := 0
+
+	for _, key := range keys {
+		shard := s.getShard(key)
+
+		shard.mu.RLock()
+		history, exists := shard.data[key]
+		shard.mu.RUnlock()
+
+		if !exists {
+			continue
+		}
+
+		history.mu.RLock()
+		if history.latest(now) != nil {
+			count++
+		}
+		history.mu.RUnlock()
+	}
+
+	return count
+}
+
+// Type returns the value type of a live key
+func (s *Store) Type(key string) (ValueType, bool) {
+	now := time.Now().UnixMilli()
+	shard := s.getShard(key)
+
+	shard.mu.RLock()
+	history, exists := shard.data[key]
+	shard.mu.RUnlock()
+
+	if !exists {
+		return TypeString, false
+	}
+
+	history.mu.RLock()
+	defer history.mu.RUnlock()
+
+	latest := history.latest(now)
+	if latest == nil {
+		s.expireLazily(key, history)
+		return TypeString, false
+	}
+
+	return latest.Type, true
+}
+
+// Rename moves src and its full version history to dst, replacing any
+// existing dst. Both shards are locked together so the move is atomic.
+func (s *Store) Rename(src, dst string) error {
+	_, err := s.rename(src, dst, true)
+	return err
+}
+
+// RenameNX renames src to dst only if dst does not exist.
+// It returns false if dst already exists.
+func (s *Store) RenameNX(src, dst string) (bool, error) {
+	return s.rename(src, dst, false)
+}
+
+func (s *Store) rename(src, dst string, replace bool) (bool, error) {
+	now := time.Now().UnixMilli()
+	srcShard, dstShard := s.getShard(src), s.getShard(dst)
+
+	unlock := s.lockShards(src, dst)
+	defer unlock()
+
+	history, exists := srcShard.data[src]
+	if !exists {
+		return false, ErrNoSuchKey
+	}
+
+	history.mu.RLock()
+	latest := history.latest(now)
+	var expiration int64
+	var indexed *string // String value to index under dst
+	var moved Event     // The SET event of dst
+	if latest != nil {
+		expiration = latest.TTL
+		moved = writeEvent(dst, latest)
+		moved.Timestamp, moved.HLC = now, 0
+		if latest.Type == TypeString {
+			data := latest.Data
+			indexed = &data
+		}
+	}
+	history.mu.RUnlock()
+
+	if latest == nil {
+		return false, ErrNoSuchKey
+	}
+
+	if src == dst {
+		return replace, nil
+	}
+
+	if existing, exists := dstShard.data[dst]; exists && !replace {
+		existing.mu.RLock()
+		live := existing.latest(now) != nil
+		existing.mu.RUnlock()
+		if live {
+			return false, nil
+		}
+	}
+
+	srcShard.remove(src)
+	dstShard.put(dst, history)
+	history.recordWrite(now)
+	s.trackBucket(dst)
+
+	s.indexDelete(src)
+	s.indexDelete(dst)
+	if indexed != nil {
+		s.indexWrite(dst, *indexed)
+	}
+
+	s.ttlWheel.Remove(src)
+	s.ttlWheel.Remove(dst)
+	if expiration > 0 {
+		s.ttlWheel.Add(dst, expiration)
+	}
+
+	s.publish(Event{Type: EventDelete, Key: src, Timestamp: now})
+	s.publish(moved)
+	return true, nil
+}
+
+// Persist removes the expiration from a key, returning true if a TTL was cleared
+func (s *Store) Persist(key string) (cleared bool) {
+	s.run(key, func() { cleared = s.persist(key) })
+	return
+}
+
+func (s *Store) persist(key string) bool {
+	now := time.Now().UnixMilli()
+	shard := s.getShard(key)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	history, exists := shard.data[key]
+	if !exists {
+		return false
+	}
+
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	latest := history.latest(now)
+	if latest == nil || latest.TTL == 0 {
+		return false
+	}
+
+	latest.TTL = 0
+	history.publishCurrent()
+	history.setSliding(0)
+	history.recordWrite(now)
+	s.ttlWheel.Remove(key)
+	return true
+}
+
+// lockShards write-locks the shards owning the given keys in shard index
+// order, so concurrent multi-key operations cannot deadlock. It returns a
+// function that releases the locks.
+func (s *Store) lockShards(keys ...string) func() {
+	var locked [ShardCount]bool
+	for _, key := range keys {
+		locked[s.hash(key)] = true
+	}
+
+	for i := 0; i < ShardCount; i++ {
+		if locked[i] {
+			s.shards[i].mu.Lock()
+		}
+	}
+
+	return func() {
+		for i := ShardCount - 1; i >= 0; i-- {
+			if locked[i] {
+				s.shards[i].mu.Unlock()
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"testing"
+)
+
+func TestStoreExistsAndType(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.Set("str", "v", 0)
+	store.SAdd("set", "a")
+	store.ZAdd("zset", ZMember{Member: "a", Score: 1})
+
+	if n := store.Exists("str", "set", "missing", "str"); n != 3 {
+		t.Errorf("Expected EXISTS count 3, got %d", n)
+	}
+
+	for key, expected := range map[string]string{"str": "string", "set": "set", "zset": "zset"} {
+		valueType, exists := store.Type(key)
+		if !exists || valueType.String() != expected {
+			t.Errorf("Expected type %s for %s, got %s (exists: %t)", expected, key, valueType, exists)
+		}
+	}
+
+	if _, exists := store.Type("missing"); exists {
+		t.Error("Expected missing key to have no type")
+	}
+}
+
+func TestStoreRename(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.Set("src", "v1", 0)
+	store.Set("src", "v2", 60000)
+
+	if err := store.Rename("src", "dst"); err != nil {
+		t.Fatalf("Unexpected rename error: %v", err)
+	}
+
+	if _, found, _ := store.Get("src"); found {
+		t.Error("Expected src to be gone after rename")
+	}
+	if value, _, _ := store.Get("dst"); value != "v2" {
+		t.Errorf("Expected dst to hold v2, got %s", value)
+	}
+	if history := store.History("dst", 0); len(history) != 2 {
+		t.Errorf("Expected history to move with the key, got %d versions", len(history))
+	}
+	if ttl := store.TTL("dst"); ttl <= 0 {
+		t.Errorf("Expected TTL to move with the key, got %d", ttl)
+	}
+
+	if err := store.Rename("missing", "dst"); err != ErrNoSuchKey {
+		t.Errorf("Expected ErrNoSuchKey, got %v", err)
+	}
+
+	store.Set("other", "x", 0)
+	renamed, err := store.RenameNX("other", "dst")
+	if err != nil || renamed {
+		t.Errorf("Expected RENAMENX onto existing key to fail, got %t (err: %v)", renamed, err)
+	}
+}
+
+func TestStorePersist(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.Set("key", "v", 60000)
+	if !store.Persist("key") {
+		t.Error("Expected PERSIST to clear the TTL")
+	}
+	if ttl := store.TTL("key"); ttl != -1 {
+		t.Errorf("Expected TTL -1 after PERSIST, got %d", ttl)
+	}
+	if store.Persist("key") {
+		t.Error("Expected PERSIST on a key without TTL to return false")
+	}
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Locks are string keys holding their fencing token, written with a TTL so
+// a crashed holder cannot keep one forever. The token is the HLC of the
+// version that took the lock: the store clock never goes backwards, so each
+// acquisition gets a larger token than every earlier one and a resource
+// guarded by the lock can reject writes from a holder whose lock expired.
+
+// ErrInvalidLockTTL is returned when a lock is requested without a positive TTL
+var ErrInvalidLockTTL = errors.New("ERR invalid expire time in 'lock' command")
+
+// Lock takes the lock at key for ttlMs if no live key exists there, and
+// returns its fencing token. acquired is false if the lock is held.
+func (s *Store) Lock(key string, ttlMs int64) (token HLC, acquired bool, err error) {
+	if ttlMs <= 0 {
+		return 0, false, ErrInvalidLockTTL
+	}
+	s.run(key, func() { token, acquired, err = s.lock(key, ttlMs) })
+	return
+}
+
+func (s *Store) lock(key string, ttlMs int64) (HLC, bool, error) {
+	now := time.Now().UnixMilli()
+	shard := s.getShard(key)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if history, exists := shard.data[key]; exists {
+		history.mu.RLock()
+		held := history.latest(now) != nil
+		history.mu.RUnlock()
+		if held {
+			return 0, false, nil
+		}
+	}
+
+	token := s.clock.Now()
+	value := strconv.FormatUint(uint64(token), 10)
+	if err := s.validate(key, value); err != nil {
+		return 0, false, err
+	}
+
+	expiration := now + ttlMs
+	s.ttlWheel.Add(key, expiration)
+	s.appendVersion(shard, key, Value{Data: value, Timestamp: now, TTL: expiration, HLC: token})
+	s.indexWrite(key, value)
+	return token, true, nil
+}
+
+// Unlock releases the lock at key if it is still held with token, and
+// reports whether it did. A lock that expired, or was taken again since,
+// is left alone.
+func (s *Store) Unlock(key string, token HLC) (released bool) {
+	s.run(key, func() { released = s.unlock(key, token) })
+	return
+}
+
+func (s *Store) unlock(key string, token HLC) bool {
+	now := time.Now().UnixMilli()
+	shard := s.getShard(key)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	history, exists := shard.data[key]
+	if !exists {
+		return false
+	}
+
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	if latest := history.latest(now); latest == nil || latest.HLC != token {
+		return false
+	}
+	s.markDeleted(key, history, now)
+	return true
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStoreLock(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	if _, _, err := store.Lock("lock", 0); err != ErrInvalidLockTTL {
+		t.Errorf("Expected ErrInvalidLockTTL, got %v", err)
+	}
+
+	token, acquired, err := store.Lock("lock", 60000)
+	if err != nil || !acquired || token == 0 {
+		t.Fatalf("Expected the lock to be acquired, got %d, %v, %v", token, acquired, err)
+	}
+	if _, acquired, _ := store.Lock("lock", 60000); acquired {
+		t.Error("Expected a held lock not to be acquired again")
+	}
+	if ttl := store.TTL("lock"); ttl <= 0 {
+		t.Errorf("Expected the lock to have a TTL, got %d", ttl)
+	}
+
+	if store.Unlock("lock", token+1) {
+		t.Error("Expected UNLOCK with a wrong token to fail")
+	}
+	if !store.Unlock("lock", token) {
+		t.Fatal("Expected UNLOCK with the token to succeed")
+	}
+	if store.Unlock("lock", token) {
+		t.Error("Expected a second UNLOCK to fail")
+	}
+
+	next, acquired, _ := store.Lock("lock", 60000)
+	if !acquired || next <= token {
+		t.Errorf("Expected a larger fencing token after release, got %d after %d", next, token)
+	}
+}
+
+func TestStoreLockExpires(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	token, _, _ := store.Lock("lock", 10)
+	time.Sleep(20 * time.Millisecond)
+
+	next, acquired, _ := store.Lock("lock", 60000)
+	if !acquired || next <= token {
+		t.Fatalf("Expected an expired lock to be taken with a larger token, got %d, %v", next, acquired)
+	}
+	if store.Unlock("lock", token) {
+		t.Error("Expected the holder of an expired lock not to release the new one")
+	}
+	if value, _, _ := store.Get("lock"); value == "" {
+		t.Error("Expected the new lock to still be held")
+	}
+}
@@ -0,0 +1,15 @@
+package store
+
+// Read-only mode. The store keeps serving writes made through its methods;
+// the mode is a switch the command layers consult to refuse write commands
+// from clients, shared by every logical database.
+
+// SetReadOnly switches read-only mode on or off
+func (s *Store) SetReadOnly(enabled bool) {
+	s.databases.readOnly.Store(enabled)
+}
+
+// ReadOnly reports whether the store is in read-only mode
+func (s *Store) ReadOnly() bool {
+	return s.databases.readOnly.Load()
+}
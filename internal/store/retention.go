@@ -0,0 +1,213 @@
+package store
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CompactionInterval is how often the background compactor prunes versions
+// that have aged out of an age-based retention policy
+const CompactionInterval = time.Minute
+
+// RetentionKind selects how a retention policy prunes history
+type RetentionKind int
+
+const (
+	RetainCount RetentionKind = iota // Keep the latest Count versions
+	RetainAge                        // Keep versions newer than Age
+	RetainAll                        // Never prune
+)
+
+// RetentionPolicy decides which versions of a key are kept. The latest
+// version is always kept, whatever the policy.
+type RetentionPolicy struct {
+	Kind  RetentionKind
+	Count int
+	Age   time.Duration
+}
+
+// DefaultRetention keeps the latest MaxVersions versions of every key
+var DefaultRetention = RetentionPolicy{Kind: RetainCount, Count: MaxVersions}
+
+// String renders the policy in the form accepted by ParseRetention
+func (p RetentionPolicy) String() string {
+	switch p.Kind {
+	case RetainAge:
+		return "age:" + p.Age.String()
+	case RetainAll:
+		return "all"
+	default:
+		return "count:" + strconv.Itoa(p.Count)
+	}
+}
+
+// ParseRetention parses a policy written as "count:<n>", "age:<duration>"
+// or "all", e.g. "age:24h"
+func ParseRetention(spec string) (RetentionPolicy, error) {
+	kind, value, _ := strings.Cut(strings.TrimSpace(spec), ":")
+
+	switch strings.ToLower(kind) {
+	case "count":
+		count, err := strconv.Atoi(value)
+		if err != nil || count < 1 {
+			return RetentionPolicy{}, fmt.Errorf("retention count must be a positive integer")
+		}
+		return RetentionPolicy{Kind: RetainCount, Count: count}, nil
+	case "age":
+		age, err := time.ParseDuration(value)
+		if err != nil || age <= 0 {
+			return RetentionPolicy{}, fmt.Errorf("retention age must be a positive duration")
+		}
+		return RetentionPolicy{Kind: RetainAge, Age: age}, nil
+	case "all":
+		if value != "" {
+			return RetentionPolicy{}, fmt.Errorf("retention 'all' takes no value")
+		}
+		return RetentionPolicy{Kind: RetainAll}, nil
+	default:
+		return RetentionPolicy{}, fmt.Errorf("retention must be count:<n>, age:<duration> or all")
+	}
+}
+
+// prune returns versions without those the policy drops at now (Unix ms)
+func (p RetentionPolicy) prune(versions []Value, now int64) []Value {
+	switch p.Kind {
+	case RetainCount:
+		if len(versions) > p.Count {
+			return versions[len(versions)-p.Count:]
+		}
+	case RetainAge:
+		cutoff := now - p.Age.Milliseconds()
+		i := 0
+		for i < len(versions)-1 && versions[i].Timestamp < cutoff {
+			i++
+		}
+		return versions[i:]
+	}
+	return versions
+}
+
+// SetRetention sets the policy used for keys without their own policy.
+// Existing histories are pruned on their next write or compaction.
+func (s *Store) SetRetention(policy RetentionPolicy) {
+	s.databases.configure(func(db *Store) { db.setRetention(policy) })
+}
+
+func (s *Store) setRetention(policy RetentionPolicy) {
+	s.retentionMu.Lock()
+	defer s.retentionMu.Unlock()
+	s.retention = policy
+}
+
+// Retention returns the policy used for keys without their own policy
+func (s *Store) Retention() RetentionPolicy {
+	s.retentionMu.RLock()
+	defer s.retentionMu.RUnlock()
+	return s.retention
+}
+
+// SetKeyRetention gives key its own retention policy, which moves with the
+// key on RENAME and is dropped when the key is deleted. The history is
+// pruned right away.
+func (s *Store) SetKeyRetention(key string, policy RetentionPolicy) bool {
+	var found bool
+	s.run(key, func() { found = s.setKeyRetention(key, &policy) })
+	return found
+}
+
+// ResetKeyRetention makes key follow the store policy again
+func (s *Store) ResetKeyRetention(key string) bool {
+	var found bool
+	s.run(key, func() { found = s.setKeyRetention(key, nil) })
+	return found
+}
+
+func (s *Store) setKeyRetention(key string, policy *RetentionPolicy) bool {
+	shard := s.getShard(key)
+
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	history, exists := shard.data[key]
+	if !exists {
+		return false
+	}
+
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	if history.tombstone.Load() {
+		return false
+	}
+	history.retention = policy
+	s.pruneHistory(key, history, time.Now().UnixMilli())
+	return true
+}
+
+// KeyRetention returns the policy applied to key and whether it is the
+// key's own policy rather than the store policy
+func (s *Store) KeyRetention(key string) (policy RetentionPolicy, own bool, exists bool) {
+	shard := s.getShard(key)
+
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	history, exists := shard.data[key]
+	if !exists {
+		return RetentionPolicy{}, false, false
+	}
+
+	history.mu.RLock()
+	defer history.mu.RUnlock()
+
+	if history.tombstone.Load() {
+		return RetentionPolicy{}, false, false
+	}
+	return s.retentionOf(history), history.retention != nil, true
+}
+
+// retentionOf returns the policy applied to history.
+// The caller must hold the history lock.
+func (s *Store) retentionOf(history *KeyHistory) RetentionPolicy {
+	if history.retention != nil {
+		return *history.retention
+	}
+	return s.Retention()
+}
+
+// compactHistory prunes every history by its policy at now and returns the
+// number of versions removed. Only age-based policies can drop versions
+// between writes, but every history is checked so that a lowered count
+// applies without waiting for the next write.
+func (s *Store) compactHistory(now int64) int {
+	removed := 0
+	for _, shard := range s.shards {
+		removed += s.compactShard(shard, now)
+	}
+	return removed
+}
+
+// compactShard prunes the histories of one shard, drops the tombstones
+// retention no longer keeps and returns the number of versions removed
+func (s *Store) compactShard(shard *Shard, now int64) int {
+	removed := 0
+	var dead []string
+
+	shard.mu.RLock()
+	for key, history := range shard.data {
+		history.mu.Lock()
+		removed += s.pruneHistory(key, history, now)
+		if s.tombstoneExpired(history, now) {
+			dead = append(dead, key)
+		}
+		history.mu.Unlock()
+	}
+	shard.mu.RUnlock()
+
+	if len(dead) > 0 {
+		removed += s.dropTombstones(shard, dead, now)
+	}
+	return removed
+}
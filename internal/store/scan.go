@@ -0,0 +1,95 @@
+package store
+
+import (
+	"sort"
+	"time"
+)
+
+// scanBuckets is the number of cursor positions per shard. Keys are assigned
+// to a bucket by hash, so a key's cursor position never changes and a full
+// scan returns every key that exists for its whole duration.
+const scanBuckets = 1024
+
+// scanBucket returns the cursor bucket of a key within its shard
+func scanBucket(key string) uint64 {
+	return (keyHash(key) / ShardCount) % scanBuckets
+}
+
+// Scan incrementally iterates the keyspace starting at cursor. It examines
+// roughly count keys, returns those matching pattern (all keys if pattern is
+// empty) and the cursor for the next call, which is 0 once the scan is complete.
+// Only the buckets returned are read, so a full scan walks each key once.
+func (s *Store) Scan(cursor uint64, pattern string, count int) ([]string, uint64) {
+	if count <= 0 {
+		count = 10
+	}
+
+	now := time.Now().UnixMilli()
+	shardIdx := cursor / scanBuckets
+	startBucket := cursor % scanBuckets
+
+	result := []string{}
+	examined := 0
+
+	for shardIdx < ShardCount {
+		shard := s.shards[shardIdx]
+		shard.mu.RLock()
+		// Whole buckets are returned so the cursor never splits one
+		for bucket := startBucket; bucket < scanBuckets; bucket++ {
+			if examined >= count {
+				shard.mu.RUnlock()
+				return result, shardIdx*scanBuckets + bucket
+			}
+			keys := shard.liveKeys(bucket, now)
+			for _, key := range keys {
+				if pattern == "" || MatchPattern(pattern, key) {
+					result = append(result, key)
+				}
+			}
+			examined += len(keys)
+		}
+		shard.mu.RUnlock()
+
+		shardIdx++
+		startBucket = 0
+		if examined >= count && shardIdx < ShardCount {
+			return result, shardIdx * scanBuckets
+		}
+	}
+
+	return result, 0
+}
+
+// liveKeys returns the live keys of a scan bucket. The caller must hold the
+// shard lock.
+func (sh *Shard) liveKeys(bucket uint64, now int64) []string {
+	var keys []string
+	for key, history := range sh.scan[bucket] {
+		history.mu.RLock()
+		live := history.latest(now) != nil
+		history.mu.RUnlock()
+
+		if live {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Keys returns every live key matching pattern in sorted order.
+// It walks the whole keyspace and is intended for small datasets.
+func (s *Store) Keys(pattern string) []string {
+	var keys []string
+	cursor := uint64(0)
+	for {
+		var batch []string
+		batch, cursor = s.Scan(cursor, pattern, 1000)
+		keys = append(keys, batch...)
+		if cursor == 0 {
+			break
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,117 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		match   bool
+	}{
+		{"*", "anything", true},
+		{"user:*", "user:42", true},
+		{"user:*", "session:42", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h\\*llo", "h*llo", true},
+		{"h\\*llo", "hello", false},
+		{"*:*:end", "a:b:end", true},
+		{"", "", true},
+	}
+
+	for _, test := range tests {
+		if got := MatchPattern(test.pattern, test.key); got != test.match {
+			t.Errorf("MatchPattern(%q, %q) = %t, expected %t", test.pattern, test.key, got, test.match)
+		}
+	}
+}
+
+func TestStoreScan(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	for i := 0; i < 500; i++ {
+		store.Set(fmt.Sprintf("key:%d", i), "v", 0)
+	}
+	store.Set("other", "v", 0)
+
+	seen := make(map[string]int)
+	cursor := uint64(0)
+	calls := 0
+	for {
+		var keys []string
+		keys, cursor = store.Scan(cursor, "key:*", 20)
+		for _, key := range keys {
+			seen[key]++
+		}
+		calls++
+		if cursor == 0 {
+			break
+		}
+	}
+
+	if len(seen) != 500 {
+		t.Errorf("Expected 500 keys from scan, got %d", len(seen))
+	}
+	for key, n := range seen {
+		if n != 1 {
+			t.Errorf("Expected %s to be returned once, got %d", key, n)
+		}
+	}
+	if calls < 2 {
+		t.Errorf("Expected scan to take multiple calls, took %d", calls)
+	}
+
+	keys := store.Keys("key:1?")
+	if len(keys) != 10 {
+		t.Errorf("Expected 10 keys matching key:1?, got %d", len(keys))
+	}
+}
+
+func TestStoreScanIndex(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	for i := 0; i < 100; i++ {
+		store.Set(fmt.Sprintf("key:%d", i), "v", 0)
+	}
+	store.Purge("key:0")
+	store.Rename("key:1", "moved")
+
+	// Every key of a shard sits in exactly one scan bucket
+	for i, shard := range store.shards {
+		indexed := 0
+		for bucket, keys := range shard.scan {
+			for key := range keys {
+				if scanBucket(key) != uint64(bucket) {
+					t.Errorf("Expected %s in bucket %d, found in %d", key, scanBucket(key), bucket)
+				}
+				if _, exists := shard.data[key]; !exists {
+					t.Errorf("Expected removed key %s to leave the scan index", key)
+				}
+			}
+			indexed += len(keys)
+		}
+		if indexed != len(shard.data) {
+			t.Errorf("Expected shard %d to index %d keys, indexed %d", i, len(shard.data), indexed)
+		}
+	}
+
+	keys := store.Keys("*")
+	if len(keys) != 99 {
+		t.Errorf("Expected 99 keys after purge and rename, got %d", len(keys))
+	}
+
+	store.Flush()
+	if keys, cursor := store.Scan(0, "*", 1000); len(keys) != 0 || cursor != 0 {
+		t.Errorf("Expected an empty scan after flush, got %d keys and cursor %d", len(keys), cursor)
+	}
+}
@@ -0,0 +1,145 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"pulsedb/internal/search"
+)
+
+var (
+	// ErrIndexExists is returned when creating an index whose name is taken
+	ErrIndexExists = errors.New("ERR Index already exists")
+	// ErrNoSuchIndex is returned for operations on an unknown index
+	ErrNoSuchIndex = errors.New("ERR no such index")
+)
+
+// SearchIndex is a full-text index over the string values of the keys
+// matching Pattern. It is maintained on every write.
+type SearchIndex struct {
+	Name    string
+	Pattern string
+	Paths   []string // JSON paths to index; empty indexes the whole value
+
+	index *search.Index
+}
+
+// Docs returns the number of indexed keys
+func (ix *SearchIndex) Docs() int {
+	return ix.index.Len()
+}
+
+// CreateIndex creates a full-text index over the keys matching pattern and
+// indexes the existing keys
+func (s *Store) CreateIndex(name, pattern string, paths []string) error {
+	ix := &SearchIndex{
+		Name:    name,
+		Pattern: pattern,
+		Paths:   paths,
+		index:   search.NewIndex(paths),
+	}
+
+	s.indexesMu.Lock()
+	if _, exists := s.indexes[name]; exists {
+		s.indexesMu.Unlock()
+		return ErrIndexExists
+	}
+	s.indexes[name] = ix
+	s.indexesMu.Unlock()
+
+	// Backfill; writes racing with this are indexed by the write path too
+	now := time.Now().UnixMilli()
+	for _, shard := range s.shards {
+		shard.mu.RLock()
+		for key, history := range shard.data {
+			if !MatchPattern(pattern, key) {
+				continue
+			}
+			history.mu.RLock()
+			if latest := history.latest(now); latest != nil && latest.Type == TypeString {
+				ix.index.Add(key, latest.Data)
+			}
+			history.mu.RUnlock()
+		}
+		shard.mu.RUnlock()
+	}
+
+	return nil
+}
+
+// DropIndex removes an index. The indexed keys are kept.
+func (s *Store) DropIndex(name string) bool {
+	s.indexesMu.Lock()
+	defer s.indexesMu.Unlock()
+
+	if _, exists := s.indexes[name]; !exists {
+		return false
+	}
+	delete(s.indexes, name)
+	return true
+}
+
+// Indexes returns the full-text indexes sorted by name
+func (s *Store) Indexes() []*SearchIndex {
+	s.indexesMu.RLock()
+	defer s.indexesMu.RUnlock()
+
+	indexes := make([]*SearchIndex, 0, len(s.indexes))
+	for _, ix := range s.indexes {
+		indexes = append(indexes, ix)
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		return indexes[i].Name < indexes[j].Name
+	})
+	return indexes
+}
+
+// Search returns the sorted keys of the live documents in the index name
+// matching query
+func (s *Store) Search(name, query string) ([]string, error) {
+	s.indexesMu.RLock()
+	ix, exists := s.indexes[name]
+	s.indexesMu.RUnlock()
+
+	if !exists {
+		return nil, ErrNoSuchIndex
+	}
+
+	keys, err := ix.index.Search(query)
+	if err != nil {
+		return nil, fmt.Errorf("ERR syntax error in query: %v", err)
+	}
+
+	// Expired keys stay indexed until the expiry cycle deletes them
+	live := keys[:0]
+	for _, key := range keys {
+		if s.Exists(key) > 0 {
+			live = append(live, key)
+		}
+	}
+	return live, nil
+}
+
+// indexWrite updates the indexes covering key after a string write
+func (s *Store) indexWrite(key, value string) {
+	s.indexesMu.RLock()
+	defer s.indexesMu.RUnlock()
+
+	for _, ix := range s.indexes {
+		if MatchPattern(ix.Pattern, key) {
+			ix.index.Add(key, value)
+		}
+	}
+}
+
+// indexDelete removes key from every index
+func (s *Store) indexDelete(key string) {
+	s.indexesMu.RLock()
+	defer s.indexesMu.RUnlock()
+
+	for _, ix := range s.indexes {
+		ix.index.Remove(key)
+	}
+}
@@ -0,0 +1,295 @@
+package store
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// ErrWrongType is returned when a command is applied to a key holding a different value type
+var ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// SAdd adds members to the set stored at key, creating it if needed.
+// It returns the number of members that were not already present.
+func (s *Store) SAdd(key string, members ...string) (added int, err error) {
+	s.run(key, func() { added, err = s.sAdd(key, members) })
+	return
+}
+
+func (s *Store) sAdd(key string, members []string) (int, error) {
+	now := time.Now().UnixMilli()
+	shard := s.getShard(key)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if history, exists := shard.data[key]; exists {
+		history.mu.Lock()
+		latest := history.latest(now)
+		if latest != nil {
+			defer history.mu.Unlock()
+			if latest.Type != TypeSet {
+				return 0, ErrWrongType
+			}
+			// Sets are mutated in place rather than versioned per member
+			history.recordWrite(now)
+			added := 0
+			for _, member := range members {
+				if _, ok := latest.Set[member]; !ok {
+					latest.Set[member] = struct{}{}
+					added++
+				}
+			}
+			if added > 0 {
+				s.publish(Event{Type: EventSet, Key: key, ValueType: TypeSet, Timestamp: now})
+			}
+			return added, nil
+		}
+		history.mu.Unlock()
+	}
+
+	set := make(map[string]struct{}, len(members))
+	for _, member := range members {
+		set[member] = struct{}{}
+	}
+
+	s.appendVersion(shard, key, Value{
+		Type:      TypeSet,
+		Set:       set,
+		Timestamp: now,
+	})
+	return len(set), nil
+}
+
+// SRem removes members from the set stored at key. The key is deleted once
+// the set becomes empty. It returns the number of members removed.
+func (s *Store) SRem(key string, members ...string) (removed int, err error) {
+	s.run(key, func() { removed, err = s.sRem(key, members) })
+	return
+}
+
+func (s *Store) sRem(key string, members []string) (int, error) {
+	now := time.Now().UnixMilli()
+	shard := s.getShard(key)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	history, exists := shard.data[key]
+	if !exists {
+		return 0, nil
+	}
+
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	latest := history.latest(now)
+	if latest == nil {
+		return 0, nil
+	}
+	if latest.Type != TypeSet {
+		return 0, ErrWrongType
+	}
+	history.recordWrite(now)
+
+	removed := 0
+	for _, member := range members {
+		if _, ok := latest.Set[member]; ok {
+			delete(latest.Set, member)
+			removed++
+		}
+	}
+
+	if len(latest.Set) == 0 {
+		s.markDeleted(key, history, now)
+	} else if removed > 0 {
+		s.publish(Event{Type: EventSet, Key: key, ValueType: TypeSet, Timestamp: now})
+	}
+
+	return removed, nil
+}
+
+// SMembers returns all members of the set stored at key in sorted order
+func (s *Store) SMembers(key string) ([]string, error) {
+	sets, err := s.loadSets([]string{key})
+	if err != nil {
+		return nil, err
+	}
+	return sortedMembers(sets[0]), nil
+}
+
+// SIsMember reports whether member belongs to the set stored at key
+func (s *Store) SIsMember(key, member string) (bool, error) {
+	var found bool
+	err := s.viewSet(key, func(set map[string]struct{}) {
+		_, found = set[member]
+	})
+	return found, err
+}
+
+// SCard returns the number of members in the set stored at key
+func (s *Store) SCard(key string) (int, error) {
+	var count int
+	err := s.viewSet(key, func(set map[string]struct{}) {
+		count = len(set)
+	})
+	return count, err
+}
+
+// SInter returns the members present in every set stored at keys
+func (s *Store) SInter(keys ...string) ([]string, error) {
+	sets, err := s.loadSets(keys)
+	if err != nil {
+		return nil, err
+	}
+	if len(sets) == 0 {
+		return []string{}, nil
+	}
+
+	result := make(map[string]struct{})
+	for member := range sets[0] {
+		inAll := true
+		for _, other := range sets[1:] {
+			if _, ok := other[member]; !ok {
+				inAll = false
+				break
+			}
+		}
+		if inAll {
+			result[member] = struct{}{}
+		}
+	}
+
+	return sortedMembers(result), nil
+}
+
+// SUnion returns the members present in any of the sets stored at keys
+func (s *Store) SUnion(keys ...string) ([]string, error) {
+	sets, err := s.loadSets(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]struct{})
+	for _, set := range sets {
+		for member := range set {
+			result[member] = struct{}{}
+		}
+	}
+
+	return sortedMembers(result), nil
+}
+
+// SDiff returns the members of the first set that are not in any of the following sets
+func (s *Store) SDiff(keys ...string) ([]string, error) {
+	sets, err := s.loadSets(keys)
+	if err != nil {
+		return nil, err
+	}
+	if len(sets) == 0 {
+		return []string{}, nil
+	}
+
+	result := make(map[string]struct{})
+	for member := range sets[0] {
+		result[member] = struct{}{}
+	}
+	for _, other := range sets[1:] {
+		for member := range other {
+			delete(result, member)
+		}
+	}
+
+	return sortedMembers(result), nil
+}
+
+// viewSet calls fn with the live set stored at key while holding its read lock.
+// A missing key is treated as an empty set.
+func (s *Store) viewSet(key string, fn func(set map[string]struct{})) error {
+	now := time.Now().UnixMilli()
+	shard := s.getShard(key)
+
+	shard.mu.RLock()
+	history, exists := shard.data[key]
+	shard.mu.RUnlock()
+
+	if !exists {
+		fn(nil)
+		return nil
+	}
+
+	history.recordRead(now)
+	history.mu.RLock()
+	defer history.mu.RUnlock()
+
+	latest := history.latest(now)
+	if latest == nil {
+		s.expireLazily(key, history)
+		fn(nil)
+		return nil
+	}
+	if latest.Type != TypeSet {
+		return ErrWrongType
+	}
+	history.slide(now)
+
+	fn(latest.Set)
+	return nil
+}
+
+// loadSets returns copies of the sets stored at keys, in the same order as keys.
+// Keys are grouped by shard so each shard is locked once per call; missing keys
+// yield empty sets.
+func (s *Store) loadSets(keys []string) ([]map[string]struct{}, error) {
+	now := time.Now().UnixMilli()
+
+	byShard := make(map[int][]int)
+	for i, key := range keys {
+		idx := s.hash(key)
+		byShard[idx] = append(byShard[idx], i)
+	}
+
+	sets := make([]map[string]struct{}, len(keys))
+	for idx, positions := range byShard {
+		shard := s.shards[idx]
+
+		shard.mu.RLock()
+		for _, pos := range positions {
+			history, exists := shard.data[keys[pos]]
+			if !exists {
+				continue
+			}
+
+			history.recordRead(now)
+			history.mu.RLock()
+			latest := history.latest(now)
+			if latest != nil && latest.Type != TypeSet {
+				history.mu.RUnlock()
+				shard.mu.RUnlock()
+				return nil, ErrWrongType
+			}
+			if latest != nil {
+				history.slide(now)
+				set := make(map[string]struct{}, len(latest.Set))
+				for member := range latest.Set {
+					set[member] = struct{}{}
+				}
+				sets[pos] = set
+			}
+			history.mu.RUnlock()
+		}
+		shard.mu.RUnlock()
+	}
+
+	return sets, nil
+}
+
+// sortedMembers returns the members of a set in sorted order
+func sortedMembers(set map[string]struct{}) []string {
+	members := make([]string, 0, len(set))
+	for member := range set {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStoreSetOperations(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	added, err := store.SAdd("s1", "a", "b", "c", "a")
+	if err != nil || added != 3 {
+		t.Fatalf("Expected 3 members added, got %d (err: %v)", added, err)
+	}
+
+	added, _ = store.SAdd("s1", "c", "d")
+	if added != 1 {
+		t.Errorf("Expected 1 new member, got %d", added)
+	}
+
+	count, _ := store.SCard("s1")
+	if count != 4 {
+		t.Errorf("Expected cardinality 4, got %d", count)
+	}
+
+	found, _ := store.SIsMember("s1", "d")
+	if !found {
+		t.Error("Expected d to be a member of s1")
+	}
+
+	removed, _ := store.SRem("s1", "d", "missing")
+	if removed != 1 {
+		t.Errorf("Expected 1 member removed, got %d", removed)
+	}
+
+	members, _ := store.SMembers("s1")
+	if !reflect.DeepEqual(members, []string{"a", "b", "c"}) {
+		t.Errorf("Unexpected members: %v", members)
+	}
+
+	// Removing the last members deletes the key
+	store.SRem("s1", "a", "b", "c")
+	if store.Exists("s1") != 0 {
+		t.Error("Expected empty set to be deleted")
+	}
+	if versions := store.History("s1", 0); len(versions) != 2 || !versions[0].Deleted {
+		t.Errorf("Expected the delete to be recorded in the history, got %+v", versions)
+	}
+}
+
+func TestStoreSetAlgebra(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.SAdd("s1", "a", "b", "c")
+	store.SAdd("s2", "b", "c", "d")
+	store.SAdd("s3", "c", "e")
+
+	inter, _ := store.SInter("s1", "s2", "s3")
+	if !reflect.DeepEqual(inter, []string{"c"}) {
+		t.Errorf("Unexpected intersection: %v", inter)
+	}
+
+	union, _ := store.SUnion("s1", "s2", "missing")
+	if !reflect.DeepEqual(union, []string{"a", "b", "c", "d"}) {
+		t.Errorf("Unexpected union: %v", union)
+	}
+
+	diff, _ := store.SDiff("s1", "s2")
+	if !reflect.DeepEqual(diff, []string{"a"}) {
+		t.Errorf("Unexpected difference: %v", diff)
+	}
+
+	inter, _ = store.SInter("s1", "missing")
+	if len(inter) != 0 {
+		t.Errorf("Expected empty intersection with missing key, got %v", inter)
+	}
+}
+
+func TestStoreSetWrongType(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.Set("str", "value", 0)
+
+	if _, err := store.SAdd("str", "a"); err != ErrWrongType {
+		t.Errorf("Expected ErrWrongType from SAdd, got %v", err)
+	}
+
+	store.SAdd("set", "a")
+	if _, err := store.SUnion("set", "str"); err != ErrWrongType {
+		t.Errorf("Expected ErrWrongType from SUnion, got %v", err)
+	}
+
+	// Sets are not read as strings, now or in the past
+	if _, _, err := store.Get("set"); err != ErrWrongType {
+		t.Errorf("Expected ErrWrongType from Get, got %v", err)
+	}
+	if _, _, err := store.GetAt("set", time.Now().UnixMilli()); err != ErrWrongType {
+		t.Errorf("Expected ErrWrongType from GetAt, got %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+// SketchCreate creates an empty sketch at key with the given relative
+// accuracy. It fails if the key already exists.
+func (s *Store) SketchCreate(key string, accuracy float64) (err error) {
+	sketch, err := NewSketch(accuracy)
+	if err != nil {
+		return err
+	}
+	s.run(key, func() {
+		err = s.updateSketch(key, func(current *Sketch) (*Sketch, error) {
+			if current != nil {
+				return nil, errors.New("ERR key already exists")
+			}
+			return sketch, nil
+		})
+	})
+	return err
+}
+
+// SketchAdd records samples in the sketch stored at key, creating it with
+// DefaultSketchAccuracy if needed. It returns the number of samples recorded
+// in the sketch so far.
+func (s *Store) SketchAdd(key string, values ...float64) (count uint64, err error) {
+	s.run(key, func() {
+		err = s.updateSketch(key, func(current *Sketch) (*Sketch, error) {
+			if current == nil {
+				current, _ = NewSketch(DefaultSketchAccuracy)
+			}
+			for _, v := range values {
+				current.Add(v)
+			}
+			count = current.Count()
+			return current, nil
+		})
+	})
+	return count, err
+}
+
+// SketchMerge merges the sketches stored at sources into the sketch at dest,
+// creating it with the accuracy of the sources if needed. Missing sources
+// are skipped; all sketches must have the same accuracy.
+func (s *Store) SketchMerge(dest string, sources ...string) error {
+	var merged *Sketch
+	for _, source := range sources {
+		err := s.viewSketch(source, func(sketch *Sketch) error {
+			if sketch == nil {
+				return nil
+			}
+			if merged == nil {
+				merged = sketch.Clone()
+				return nil
+			}
+			return merged.Merge(sketch)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	var err error
+	s.run(dest, func() {
+		err = s.updateSketch(dest, func(current *Sketch) (*Sketch, error) {
+			switch {
+			case merged == nil && current == nil:
+				return NewSketch(DefaultSketchAccuracy)
+			case merged == nil:
+				return current, nil
+			case current == nil:
+				return merged, nil
+			}
+			return current, current.Merge(merged)
+		})
+	})
+	return err
+}
+
+// SketchQuantiles returns the estimated values at each quantile of the
+// sketch stored at key. It reports false if the key does not exist or the
+// sketch is empty.
+func (s *Store) SketchQuantiles(key string, quantiles ...float64) ([]float64, bool, error) {
+	for _, q := range quantiles {
+		if !(q >= 0 && q <= 1) {
+			return nil, false, errors.New("ERR quantile must be between 0 and 1")
+		}
+	}
+
+	var values []float64
+	err := s.viewSketch(key, func(sketch *Sketch) error {
+		if sketch == nil || sketch.Count() == 0 {
+			return nil
+		}
+		values = make([]float64, len(quantiles))
+		for i, q := range quantiles {
+			values[i], _ = sketch.Quantile(q)
+		}
+		return nil
+	})
+	return values, values != nil, err
+}
+
+// SketchInfo returns the summary of the sketch stored at key
+func (s *Store) SketchInfo(key string) (summary SketchSummary, found bool, err error) {
+	err = s.viewSketch(key, func(sketch *Sketch) error {
+		if sketch != nil {
+			summary, found = sketch.Summary(), true
+		}
+		return nil
+	})
+	return summary, found, err
+}
+
+// updateSketch calls fn with the live sketch stored at key, or nil, and
+// stores the sketch it returns. Sketches are mutated in place rather than
+// versioned per sample; a new version is only written for a new key.
+func (s *Store) updateSketch(key string, fn func(current *Sketch) (*Sketch, error)) error {
+	now := time.Now().UnixMilli()
+	shard := s.getShard(key)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if history, exists := shard.data[key]; exists {
+		history.mu.Lock()
+		latest := history.latest(now)
+		if latest != nil {
+			defer history.mu.Unlock()
+			if latest.Type != TypeSketch {
+				return ErrWrongType
+			}
+			history.recordWrite(now)
+			if _, err := fn(latest.Sketch); err != nil {
+				return err
+			}
+			s.publish(Event{Type: EventSet, Key: key, ValueType: TypeSketch, Timestamp: now})
+			return nil
+		}
+		history.mu.Unlock()
+	}
+
+	sketch, err := fn(nil)
+	if err != nil {
+		return err
+	}
+	s.appendVersion(shard, key, Value{
+		Type:      TypeSketch,
+		Sketch:    sketch,
+		Timestamp: now,
+	})
+	return nil
+}
+
+// viewSketch calls fn with the live sketch stored at key while holding its
+// read lock. A missing key is passed as nil.
+func (s *Store) viewSketch(key string, fn func(sketch *Sketch) error) error {
+	now := time.Now().UnixMilli()
+	shard := s.getShard(key)
+
+	shard.mu.RLock()
+	history, exists := shard.data[key]
+	shard.mu.RUnlock()
+
+	if !exists {
+		return fn(nil)
+	}
+
+	history.recordRead(now)
+	history.mu.RLock()
+	defer history.mu.RUnlock()
+
+	latest := history.latest(now)
+	if latest == nil {
+		s.expireLazily(key, history)
+		return fn(nil)
+	}
+	if latest.Type != TypeSketch {
+		return ErrWrongType
+	}
+	history.slide(now)
+	return fn(latest.Sketch)
+}
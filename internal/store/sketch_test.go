@@ -0,0 +1,78 @@
+package store
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSketchQuantiles(t *testing.T) {
+	sketch, err := NewSketch(0.01)
+	if err != nil {
+		t.Fatalf("NewSketch failed: %v", err)
+	}
+	for i := 1; i <= 1000; i++ {
+		sketch.Add(float64(i))
+	}
+
+	for _, tc := range []struct {
+		q    float64
+		want float64
+	}{{0, 1}, {0.5, 500}, {0.99, 990}, {1, 1000}} {
+		got, ok := sketch.Quantile(tc.q)
+		if !ok || math.Abs(got-tc.want) > tc.want*0.01+1 {
+			t.Errorf("Quantile(%v) = %v, want about %v", tc.q, got, tc.want)
+		}
+	}
+
+	other, _ := NewSketch(0.01)
+	other.Add(-5)
+	other.Add(0)
+	if err := sketch.Merge(other); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if got, _ := sketch.Quantile(0); got != -5 {
+		t.Errorf("Expected the minimum -5 after merging, got %v", got)
+	}
+	if summary := sketch.Summary(); summary.Count != 1002 || summary.Max != 1000 {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+
+	coarse, _ := NewSketch(0.05)
+	if err := sketch.Merge(coarse); err != ErrSketchAccuracy {
+		t.Errorf("Expected ErrSketchAccuracy, got %v", err)
+	}
+}
+
+func TestStoreSketch(t *testing.T) {
+	s := NewStore()
+	defer s.Close()
+
+	if count, err := s.SketchAdd("lat:a", 10, 20, 30); err != nil || count != 3 {
+		t.Fatalf("SketchAdd = %d, %v", count, err)
+	}
+	s.SketchAdd("lat:b", 40)
+
+	if err := s.SketchMerge("lat:all", "lat:a", "lat:b", "lat:missing"); err != nil {
+		t.Fatalf("SketchMerge failed: %v", err)
+	}
+	values, found, err := s.SketchQuantiles("lat:all", 0, 1)
+	if err != nil || !found || values[0] != 10 || values[1] != 40 {
+		t.Errorf("SketchQuantiles = %v, %v, %v", values, found, err)
+	}
+
+	if err := s.SketchCreate("lat:a", 0.01); err == nil {
+		t.Error("Expected SketchCreate on an existing key to fail")
+	}
+	s.SketchCreate("lat:fine", 0.001)
+	if err := s.SketchMerge("lat:fine", "lat:a"); err != ErrSketchAccuracy {
+		t.Errorf("Expected ErrSketchAccuracy, got %v", err)
+	}
+	if _, found, _ := s.SketchQuantiles("lat:fine", 0.5); found {
+		t.Error("Expected an empty sketch to have no quantiles")
+	}
+
+	s.Set("str", "v", 0)
+	if _, err := s.SketchAdd("str", 1); err != ErrWrongType {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+}
@@ -0,0 +1,313 @@
+package store
+
+import (
+	"math/rand"
+)
+
+const (
+	skiplistMaxLevel = 32
+	skiplistP        = 0.25
+)
+
+// ZMember is a member of a sorted set together with its score
+type ZMember struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+// ScoreBound is one end of a score range, optionally exclusive
+type ScoreBound struct {
+	Value     float64
+	Exclusive bool
+}
+
+type skiplistLevel struct {
+	forward *skiplistNode
+	span    int // Number of nodes skipped by the forward pointer, used for ranks
+}
+
+type skiplistNode struct {
+	member   string
+	score    float64
+	backward *skiplistNode
+	levels   []skiplistLevel
+}
+
+// skiplist keeps members ordered by (score, member) with O(log n) rank lookups
+type skiplist struct {
+	head   *skiplistNode
+	tail   *skiplistNode
+	length int
+	level  int
+}
+
+func newSkiplist() *skiplist {
+	return &skiplist{
+		head:  &skiplistNode{levels: make([]skiplistLevel, skiplistMaxLevel)},
+		level: 1,
+	}
+}
+
+func randomLevel() int {
+	level := 1
+	for level < skiplistMaxLevel && rand.Float64() < skiplistP {
+		level++
+	}
+	return level
+}
+
+// less reports whether (score, member) sorts before node
+func (n *skiplistNode) less(score float64, member string) bool {
+	return n.score < score || (n.score == score && n.member < member)
+}
+
+func (sl *skiplist) insert(score float64, member string) {
+	var update [skiplistMaxLevel]*skiplistNode
+	var rank [skiplistMaxLevel]int
+
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		if i < sl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.levels[i].forward != nil && x.levels[i].forward.less(score, member) {
+			rank[i] += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		update[i] = x
+	}
+
+	level := randomLevel()
+	if level > sl.level {
+		for i := sl.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = sl.head
+			update[i].levels[i].span = sl.length
+		}
+		sl.level = level
+	}
+
+	x = &skiplistNode{member: member, score: score, levels: make([]skiplistLevel, level)}
+	for i := 0; i < level; i++ {
+		x.levels[i].forward = update[i].levels[i].forward
+		update[i].levels[i].forward = x
+		x.levels[i].span = update[i].levels[i].span - (rank[0] - rank[i])
+		update[i].levels[i].span = rank[0] - rank[i] + 1
+	}
+	for i := level; i < sl.level; i++ {
+		update[i].levels[i].span++
+	}
+
+	if update[0] != sl.head {
+		x.backward = update[0]
+	}
+	if x.levels[0].forward != nil {
+		x.levels[0].forward.backward = x
+	} else {
+		sl.tail = x
+	}
+	sl.length++
+}
+
+func (sl *skiplist) delete(score float64, member string) bool {
+	var update [skiplistMaxLevel]*skiplistNode
+
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && x.levels[i].forward.less(score, member) {
+			x = x.levels[i].forward
+		}
+		update[i] = x
+	}
+
+	x = x.levels[0].forward
+	if x == nil || x.score != score || x.member != member {
+		return false
+	}
+
+	for i := 0; i < sl.level; i++ {
+		if update[i].levels[i].forward == x {
+			update[i].levels[i].span += x.levels[i].span - 1
+			update[i].levels[i].forward = x.levels[i].forward
+		} else {
+			update[i].levels[i].span--
+		}
+	}
+	if x.levels[0].forward != nil {
+		x.levels[0].forward.backward = x.backward
+	} else {
+		sl.tail = x.backward
+	}
+	for sl.level > 1 && sl.head.levels[sl.level-1].forward == nil {
+		sl.level--
+	}
+	sl.length--
+	return true
+}
+
+// rank returns the 0-based position of (score, member), or -1 if absent
+func (sl *skiplist) rank(score float64, member string) int {
+	rank := 0
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && !(x.levels[i].forward.score > score ||
+			(x.levels[i].forward.score == score && x.levels[i].forward.member > member)) {
+			rank += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		if x != sl.head && x.member == member {
+			return rank - 1
+		}
+	}
+	return -1
+}
+
+// byRank returns the node at the given 0-based rank, or nil if out of range
+func (sl *skiplist) byRank(rank int) *skiplistNode {
+	traversed := 0
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && traversed+x.levels[i].span <= rank+1 {
+			traversed += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		if traversed == rank+1 {
+			return x
+		}
+	}
+	return nil
+}
+
+// firstInRange returns the first node whose score is above min
+func (sl *skiplist) firstInRange(min ScoreBound) *skiplistNode {
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && !aboveMin(x.levels[i].forward.score, min) {
+			x = x.levels[i].forward
+		}
+	}
+	return x.levels[0].forward
+}
+
+func aboveMin(score float64, min ScoreBound) bool {
+	if min.Exclusive {
+		return score > min.Value
+	}
+	return score >= min.Value
+}
+
+func belowMax(score float64, max ScoreBound) bool {
+	if max.Exclusive {
+		return score < max.Value
+	}
+	return score <= max.Value
+}
+
+// SortedSet is a set of unique members ordered by score
+type SortedSet struct {
+	scores map[string]float64
+	list   *skiplist
+}
+
+// NewSortedSet creates an empty sorted set
+func NewSortedSet() *SortedSet {
+	return &SortedSet{
+		scores: make(map[string]float64),
+		list:   newSkiplist(),
+	}
+}
+
+// Len returns the number of members
+func (z *SortedSet) Len() int {
+	return len(z.scores)
+}
+
+// Add inserts or updates a member, returning true if the member is new
+func (z *SortedSet) Add(member string, score float64) bool {
+	if old, exists := z.scores[member]; exists {
+		if old != score {
+			z.list.delete(old, member)
+			z.list.insert(score, member)
+			z.scores[member] = score
+		}
+		return false
+	}
+	z.list.insert(score, member)
+	z.scores[member] = score
+	return true
+}
+
+// Remove deletes a member, returning true if it was present
+func (z *SortedSet) Remove(member string) bool {
+	score, exists := z.scores[member]
+	if !exists {
+		return false
+	}
+	z.list.delete(score, member)
+	delete(z.scores, member)
+	return true
+}
+
+// Score returns the score of a member
+func (z *SortedSet) Score(member string) (float64, bool) {
+	score, exists := z.scores[member]
+	return score, exists
+}
+
+// Rank returns the 0-based rank of a member ordered by ascending score
+func (z *SortedSet) Rank(member string) (int, bool) {
+	score, exists := z.scores[member]
+	if !exists {
+		return 0, false
+	}
+	return z.list.rank(score, member), true
+}
+
+// Range returns members between the start and stop ranks (inclusive).
+// Negative indexes count from the end, as in Redis.
+func (z *SortedSet) Range(start, stop int) []ZMember {
+	length := z.Len()
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	if start > stop || start >= length {
+		return []ZMember{}
+	}
+
+	result := make([]ZMember, 0, stop-start+1)
+	for x := z.list.byRank(start); x != nil && len(result) < stop-start+1; x = x.levels[0].forward {
+		result = append(result, ZMember{Member: x.member, Score: x.score})
+	}
+	return result
+}
+
+// RangeByScore returns members with scores between min and max, skipping
+// offset matches and returning at most count members (count < 0 means all)
+func (z *SortedSet) RangeByScore(min, max ScoreBound, offset, count int) []ZMember {
+	result := []ZMember{}
+	for x := z.list.firstInRange(min); x != nil && belowMax(x.score, max); x = x.levels[0].forward {
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if count >= 0 && len(result) >= count {
+			break
+		}
+		result = append(result, ZMember{Member: x.member, Score: x.score})
+	}
+	return result
+}
+
+// Members returns all members in ascending score order
+func (z *SortedSet) Members() []ZMember {
+	return z.Range(0, -1)
+}
@@ -0,0 +1,105 @@
+package store
+
+import (
+	"sort"
+	"strings"
+)
+
+// A key in sliding TTL mode has its expiration pushed back by its original
+// TTL whenever it is read, like a session that lives as long as it is used.
+// Reads only record the time atomically: the version's TTL and the TTL
+// wheel still hold the older deadline, and when the sweep reaches it the
+// key is rescheduled to the deadline its reads earned. A hot key therefore
+// costs one wheel update per TTL period rather than one per read.
+
+// SetSlidingPatterns puts keys matching any of patterns in sliding TTL mode
+// whenever they are given a TTL. Keys already holding a TTL change mode on
+// their next write or EXPIRE.
+func (s *Store) SetSlidingPatterns(patterns []string) {
+	s.databases.configure(func(db *Store) { db.setSlidingPatterns(patterns) })
+}
+
+func (s *Store) setSlidingPatterns(patterns []string) {
+	s.slidingMu.Lock()
+	defer s.slidingMu.Unlock()
+	s.slidingPatterns = append([]string(nil), patterns...)
+	sort.Strings(s.slidingPatterns)
+}
+
+// SlidingPatterns returns the patterns of keys in sliding TTL mode, sorted
+func (s *Store) SlidingPatterns() []string {
+	s.slidingMu.RLock()
+	defer s.slidingMu.RUnlock()
+	return append([]string(nil), s.slidingPatterns...)
+}
+
+// ExpireSliding sets a TTL on key like Expire and puts it in sliding TTL
+// mode, whatever the sliding patterns
+func (s *Store) ExpireSliding(key string, ttlMs int64) (updated bool) {
+	s.run(key, func() { updated = s.expire(key, ttlMs, true) })
+	return
+}
+
+// slidingTTL returns the sliding TTL key gets with a TTL of ttlMs: ttlMs
+// itself if the key matches a sliding pattern, 0 otherwise
+func (s *Store) slidingTTL(key string, ttlMs int64) int64 {
+	if ttlMs <= 0 {
+		return 0
+	}
+
+	s.slidingMu.RLock()
+	defer s.slidingMu.RUnlock()
+
+	for _, pattern := range s.slidingPatterns {
+		if MatchPattern(pattern, key) {
+			return ttlMs
+		}
+	}
+	return 0
+}
+
+// setSliding sets the sliding TTL of a history after its expiration changed.
+// The caller must hold the history write lock.
+func (h *KeyHistory) setSliding(slidingMs int64) {
+	h.sliding.Store(slidingMs)
+	h.touched.Store(0)
+}
+
+// slide records a read of a live key, extending its expiration if it is in
+// sliding TTL mode
+func (h *KeyHistory) slide(now int64) {
+	if h.sliding.Load() > 0 {
+		h.touched.Store(now)
+	}
+}
+
+// expiration returns when a version expires, 0 if never, taking the reads
+// of a sliding key into account for its latest version.
+// The caller must hold the history lock.
+func (h *KeyHistory) expiration(v *Value) int64 {
+	if v.TTL == 0 || v != &h.Versions[len(h.Versions)-1] {
+		return v.TTL
+	}
+	return h.slidExpiration(v.TTL)
+}
+
+// slidExpiration returns when the latest version, expiring at ttl, expires
+// once the reads of a sliding key are taken into account. It needs no lock.
+func (h *KeyHistory) slidExpiration(ttl int64) int64 {
+	if sliding, touched := h.sliding.Load(), h.touched.Load(); ttl > 0 && sliding > 0 && touched > 0 {
+		return max(ttl, touched+sliding)
+	}
+	return ttl
+}
+
+// ParseSlidingPatterns parses a comma-separated list of key patterns. An
+// empty spec yields no patterns.
+func ParseSlidingPatterns(spec string) []string {
+	var patterns []string
+	for _, pattern := range strings.Split(spec, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
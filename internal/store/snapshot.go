@@ -0,0 +1,58 @@
+package store
+
+import "errors"
+
+// ErrSnapshotTooOld is returned when retention has pruned the version a
+// snapshot read needs
+var ErrSnapshotTooOld = errors.New("ERR snapshot too old, the version it reads has been pruned")
+
+// Snapshot returns a read timestamp for GetSnapshot. Every write that
+// completed before the call orders before it and every later write after
+// it, so reads at the timestamp see one point-in-time view across keys.
+func (s *Store) Snapshot() HLC {
+	return s.clock.Now()
+}
+
+// GetSnapshot returns the value a string or JSON key had at the snapshot
+// timestamp. The versions the snapshot needs must still be retained: if
+// retention has pruned them, ErrSnapshotTooOld is returned rather than a
+// wrong answer.
+// Reads at a snapshot are not accesses and never extend a sliding TTL.
+func (s *Store) GetSnapshot(key string, snapshot HLC) (string, bool, error) {
+	shard := s.getShard(key)
+
+	shard.mu.RLock()
+	history, exists := shard.data[key]
+	shard.mu.RUnlock()
+
+	if !exists {
+		return "", false, nil
+	}
+
+	history.mu.RLock()
+	defer history.mu.RUnlock()
+
+	for i := len(history.Versions) - 1; i >= 0; i-- {
+		version := &history.Versions[i]
+		if version.HLC > snapshot {
+			continue
+		}
+		if version.Deleted {
+			return "", false, nil
+		}
+		if expiration := history.expiration(version); expiration > 0 && snapshot.Wall() >= expiration {
+			return "", false, nil
+		}
+		if !version.readable() {
+			return "", false, ErrWrongType
+		}
+		return version.Data, true, nil
+	}
+
+	// Every retained version is newer: the key was either created after the
+	// snapshot or has lost the version it had then
+	if history.first != 0 && history.first <= snapshot {
+		return "", false, ErrSnapshotTooOld
+	}
+	return "", false, nil
+}
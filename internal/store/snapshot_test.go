@@ -0,0 +1,84 @@
+package store
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStoreGetSnapshot(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.Set("a", "1", 0)
+	store.Set("b", "1", 0)
+	store.Set("quota:src", "10", 0)
+	snapshot := store.Snapshot()
+
+	store.Set("a", "2", 0)
+	store.Delete("b")
+	store.Set("c", "new", 0)
+	if _, _, err := store.Transfer("quota:src", "quota:dst", 4); err != nil {
+		t.Fatalf("Transfer failed: %v", err)
+	}
+
+	tests := []struct {
+		key    string
+		value  string
+		exists bool
+	}{
+		{"a", "1", true},
+		{"b", "1", true},
+		{"c", "", false},
+		{"quota:src", "10", true},
+		{"quota:dst", "", false},
+		{"never", "", false},
+	}
+	for _, tt := range tests {
+		value, exists, err := store.GetSnapshot(tt.key, snapshot)
+		if err != nil || value != tt.value || exists != tt.exists {
+			t.Errorf("GetSnapshot(%q) = %q, %v, %v; want %q, %v", tt.key, value, exists, err, tt.value, tt.exists)
+		}
+	}
+
+	// Both sides of the transfer are visible at a later snapshot
+	later := store.Snapshot()
+	src, _, _ := store.GetSnapshot("quota:src", later)
+	dst, _, _ := store.GetSnapshot("quota:dst", later)
+	if src != "6" || dst != "4" {
+		t.Errorf("Expected balances 6 and 4 at the later snapshot, got %q and %q", src, dst)
+	}
+	if _, exists, _ := store.GetSnapshot("b", later); exists {
+		t.Error("Expected the deleted key to be missing at the later snapshot")
+	}
+
+	// JSON documents read like GET returns them
+	store.JSONSet("doc", "$", `{"a":1}`, JSONAlways)
+	if value, exists, err := store.GetSnapshot("doc", store.Snapshot()); err != nil || !exists || value != `{"a":1}` {
+		t.Errorf("Expected the JSON document, got %q, %v, %v", value, exists, err)
+	}
+
+	store.SAdd("set", "member")
+	if _, _, err := store.GetSnapshot("set", store.Snapshot()); err != ErrWrongType {
+		t.Errorf("Expected ErrWrongType for a set, got %v", err)
+	}
+}
+
+func TestStoreGetSnapshotTooOld(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.Set("key", "old", 0)
+	policy, _ := ParseRetention("count:1")
+	store.SetKeyRetention("key", policy)
+	snapshot := store.Snapshot()
+
+	store.Set("key", "new", 0)
+	store.Compact(context.Background(), func(done, total int) {})
+
+	if _, _, err := store.GetSnapshot("key", snapshot); err != ErrSnapshotTooOld {
+		t.Errorf("Expected ErrSnapshotTooOld once the version is pruned, got %v", err)
+	}
+	if value, _, err := store.GetSnapshot("key", store.Snapshot()); err != nil || value != "new" {
+		t.Errorf("Expected the retained version at a new snapshot, got %q, %v", value, err)
+	}
+}
@@ -2,36 +2,161 @@ package store
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/binary"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/cespare/xxhash/v2"
 )
 
 const (
 	ShardCount       = 64
-	MaxVersions      = 10 // Maximum versions to keep per key
+	MaxVersions      = 10 // Versions kept per key by the default retention policy
 	TTLCheckInterval = 1 * time.Second
 )
 
+// ValueType identifies the kind of data held by a version
+type ValueType int
+
+const (
+	TypeString ValueType = iota
+	TypeSet
+	TypeZSet
+	TypeJSON
+	TypeSketch
+)
+
+// String returns the Redis-style name of the value type
+func (t ValueType) String() string {
+	switch t {
+	case TypeSet:
+		return "set"
+	case TypeZSet:
+		return "zset"
+	case TypeJSON:
+		return "json"
+	case TypeSketch:
+		return "sketch"
+	default:
+		return "string"
+	}
+}
+
 // Value represents a versioned value in the store
 type Value struct {
-	Data      string
-	Timestamp int64 // Unix milliseconds
-	TTL       int64 // Unix milliseconds when key expires, 0 means no expiration
+	Data      string // The value, or the encoded document when Type is TypeJSON
+	Type      ValueType
+	Set       map[string]struct{} // Members when Type is TypeSet
+	ZSet      *SortedSet          // Members when Type is TypeZSet
+	JSON      interface{}         // Parsed document when Type is TypeJSON, never modified in place
+	Sketch    *Sketch             // Samples when Type is TypeSketch
+	Timestamp int64               // Unix milliseconds, the wall time of HLC
+	HLC       HLC                 // Orders versions, even within a millisecond
+	TTL       int64               // Unix milliseconds when key expires, 0 means no expiration
+	Deleted   bool                // Records a delete: the key is missing from this version on
+	Seq       int64               // Numbers the versions of a key from 1 in write order
+}
+
+// expired reports whether the version has expired at the given time
+func (v *Value) expired(now int64) bool {
+	return v.TTL > 0 && now >= v.TTL
+}
+
+// readable reports whether Data holds the value, as it does for strings and
+// JSON documents, rather than a type read by its own commands
+func (v *Value) readable() bool {
+	return v.Type == TypeString || v.Type == TypeJSON
+}
+
+// CheckReadable returns ErrWrongType if a version holds a value that is not
+// a string or JSON document, which the history readers cannot list
+func CheckReadable(versions []Value) error {
+	for i := range versions {
+		if !versions[i].Deleted && !versions[i].readable() {
+			return ErrWrongType
+		}
+	}
+	return nil
 }
 
 // KeyHistory holds multiple versions of a key
 type KeyHistory struct {
-	Versions []Value
-	mu       sync.RWMutex
+	Versions  []Value
+	retention *RetentionPolicy // Own policy of the key, nil follows the store
+	tombstone atomic.Bool      // The key was deleted or expired, see markDeleted and expireKey
+	first     HLC              // Of the first version ever written, see GetSnapshot
+	mu        sync.RWMutex
+
+	// Copy of the latest version, read by Get without the lock; see
+	// publishCurrent
+	current atomic.Pointer[Value]
+
+	// Access counters, updated atomically so reads never take a write lock
+	reads      atomic.Int64
+	writes     atomic.Int64
+	lastAccess atomic.Int64
+	lfu        atomic.Uint64 // Decay minute << 8 | logarithmic frequency
+
+	// Sliding TTL mode, see sliding.go
+	sliding atomic.Int64 // Milliseconds each read extends the TTL by, 0 if fixed
+	touched atomic.Int64 // Unix milliseconds of the last read extending it
+
+	// Version counters for the write amplification report
+	created atomic.Int64
+	pruned  atomic.Int64
 }
 
 // Shard represents a single shard of the store
 type Shard struct {
-	data map[string]*KeyHistory
-	mu   sync.RWMutex
+	data     map[string]*KeyHistory
+	mu       sync.RWMutex
+	executor *executor // Owner goroutine applying single-key mutations
+
+	// Mirror of data for lookups without the lock, see lookup. Only
+	// changed through put, remove and clear, under the write lock.
+	index sync.Map
+
+	// The keys of data by scan bucket, so Scan reads only the buckets it
+	// returns. Kept by put, remove and clear like index; nil until a key
+	// lands in the bucket.
+	scan [scanBuckets]map[string]*KeyHistory
+}
+
+// lookup returns the history of key without locking the shard
+func (sh *Shard) lookup(key string) (*KeyHistory, bool) {
+	history, exists := sh.index.Load(key)
+	if !exists {
+		return nil, false
+	}
+	return history.(*KeyHistory), true
+}
+
+// put adds the history of key. The caller must hold the shard write lock.
+func (sh *Shard) put(key string, history *KeyHistory) {
+	sh.data[key] = history
+	sh.index.Store(key, history)
+
+	bucket := scanBucket(key)
+	if sh.scan[bucket] == nil {
+		sh.scan[bucket] = make(map[string]*KeyHistory)
+	}
+	sh.scan[bucket][key] = history
+}
+
+// remove drops the history of key. The caller must hold the shard write
+// lock.
+func (sh *Shard) remove(key string) {
+	delete(sh.data, key)
+	sh.index.Delete(key)
+	delete(sh.scan[scanBucket(key)], key)
+}
+
+// clear drops every history. The caller must hold the shard write lock.
+func (sh *Shard) clear() {
+	sh.data = make(map[string]*KeyHistory)
+	sh.index.Clear()
+	sh.scan = [scanBuckets]map[string]*KeyHistory{}
 }
 
 // Store represents the main in-memory store with MVCC support
@@ -41,32 +166,95 @@ type Store struct {
 	ctx      context.Context
 	cancel   context.CancelFunc
 	wg       sync.WaitGroup
+
+	validators   map[string]Validator // key pattern -> validator
+	validatorsMu sync.RWMutex
+
+	buckets   map[string]*bucketTracker // namespace prefix -> tracked buckets
+	bucketsMu sync.RWMutex
+
+	indexes   map[string]*SearchIndex // full-text indexes by name
+	indexesMu sync.RWMutex
+
+	defaultTTLs        map[string]time.Duration // key pattern -> TTL for SETs without one
+	defaultTTLsMu      sync.RWMutex
+	defaultTTLsApplied atomic.Int64
+
+	slidingPatterns []string // Keys given a sliding TTL
+	slidingMu       sync.RWMutex
+
+	retention   RetentionPolicy // Policy for keys without their own
+	retentionMu sync.RWMutex
+
+	archives archives // Sinks receiving the final value of removed keys
+
+	clock *hlcClock // Timestamps new versions, shared by the databases
+
+	index     int          // Number of this logical database
+	databases *databaseSet // Every database of the store, see DB
+
+	amplification amplificationTracker // Versions written and pruned per namespace
+
+	workingSet atomic.Pointer[WorkingSetEstimate] // Latest periodic estimate
+
+	expiry      expiryController // Sizes the expiry sweep to the load
+	lazyExpired chan string      // Keys reads found expired, see expireLazily
+
+	feed feed // Live key events, see Subscribe
 }
 
-// NewStore creates a new store instance
+// NewStore creates a new store instance, database 0 of its logical
+// databases
 func NewStore() *Store {
+	set := &databaseSet{clock: &hlcClock{}}
+	store := newDatabase(set, 0)
+	set.publish(store)
+	return store
+}
+
+// newDatabase creates logical database index of set
+func newDatabase(set *databaseSet, index int) *Store {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	store := &Store{
-		ttlWheel: NewTTLWheel(),
-		ctx:      ctx,
-		cancel:   cancel,
+		clock:       set.clock,
+		index:       index,
+		databases:   set,
+		ttlWheel:    NewTTLWheel(),
+		lazyExpired: make(chan string, lazyExpireQueue),
+		ctx:         ctx,
+		cancel:      cancel,
+		validators:  make(map[string]Validator),
+		buckets:     make(map[string]*bucketTracker),
+		indexes:     make(map[string]*SearchIndex),
+
+		defaultTTLs: make(map[string]time.Duration),
+		retention:   DefaultRetention,
+		archives:    archives{rules: make(map[string]*archiveRule)},
 	}
+	store.setExpiryPolicy(DefaultExpiryPolicy)
 
 	// Initialize shards
 	for i := 0; i < ShardCount; i++ {
 		store.shards[i] = &Shard{
-			data: make(map[string]*KeyHistory),
+			data:     make(map[string]*KeyHistory),
+			executor: newExecutor(),
 		}
 	}
 
 	return store
 }
 
+// keyHash returns the 64-bit hash used to place a key. It is xxHash64,
+// which is fast and the same in every process, so keys land in the same
+// shard and SCAN bucket across restarts.
+func keyHash(key string) uint64 {
+	return xxhash.Sum64String(key)
+}
+
 // hash returns the shard index for a given key
 func (s *Store) hash(key string) int {
-	h := sha256.Sum256([]byte(key))
-	return int(binary.BigEndian.Uint64(h[:8]) % ShardCount)
+	return int(keyHash(key) % ShardCount)
 }
 
 // getShard returns the shard for a given key
@@ -74,63 +262,241 @@ func (s *Store) getShard(key string) *Shard {
 	return s.shards[s.hash(key)]
 }
 
-// Set sets a key-value pair with optional TTL
-func (s *Store) Set(key, value string, ttlMs int64) {
+// SetCondition restricts when SetWithOptions writes
+type SetCondition int
+
+const (
+	SetAlways    SetCondition = iota
+	SetIfMissing              // NX: only if the key does not exist
+	SetIfExists               // XX: only if the key exists
+	SetIfEqual                // CAS: only if the value is Expected
+	SetIfVersion              // CAS VERSION: only if the latest version has HLC Version
+)
+
+// SetOptions are the options of a SET
+type SetOptions struct {
+	TTL     int64        // Milliseconds, 0 means the default TTL of the key's pattern
+	Cond    SetCondition // When to write
+	KeepTTL bool         // Keep the TTL of an existing key instead
+	Get     bool         // Return the previous value, which must be a string
+
+	Expected string // Value a SetIfEqual write expects
+	Version  HLC    // Version a SetIfVersion write expects, 0 for a missing key
+}
+
+// SetResult reports the outcome of SetWithOptions
+type SetResult struct {
+	Written bool
+	Old     string // Previous value when Get was requested
+	Existed bool   // Whether the key existed
+}
+
+// Set sets a key-value pair with optional TTL. The write is rejected if a
+// validator registered for a matching pattern refuses the value. Without a
+// TTL, the key gets the default TTL registered for its pattern, if any.
+func (s *Store) Set(key, value string, ttlMs int64) error {
+	_, err := s.SetWithOptions(key, value, SetOptions{TTL: ttlMs})
+	return err
+}
+
+// SetWithOptions sets a key-value pair like Set, checking the condition and
+// reading the previous value and TTL under the same shard lock as the write.
+// With KeepTTL, a new key still gets the default TTL of its pattern.
+func (s *Store) SetWithOptions(key, value string, opts SetOptions) (result SetResult, err error) {
+	if err := s.validate(key, value); err != nil {
+		return SetResult{}, err
+	}
+
+	s.run(key, func() { result, err = s.set(key, value, opts) })
+	return result, err
+}
+
+func (s *Store) set(key, value string, opts SetOptions) (SetResult, error) {
 	now := time.Now().UnixMilli()
 	shard := s.getShard(key)
 
 	shard.mu.Lock()
 	defer shard.mu.Unlock()
 
+	var current *Value
+	if history, exists := shard.data[key]; exists {
+		history.mu.RLock()
+		current = history.latest(now)
+		history.mu.RUnlock()
+	}
+
+	result := SetResult{Existed: current != nil}
+	if current != nil && opts.Get {
+		if current.Type != TypeString {
+			return SetResult{}, ErrWrongType
+		}
+		result.Old = current.Data
+	}
+	if (opts.Cond == SetIfMissing && current != nil) || (opts.Cond == SetIfExists && current == nil) {
+		return result, nil
+	}
+	if opts.Cond == SetIfEqual {
+		if current != nil && current.Type != TypeString {
+			return SetResult{}, ErrWrongType
+		}
+		if current == nil || current.Data != opts.Expected {
+			return result, nil
+		}
+	}
+	if opts.Cond == SetIfVersion {
+		if (current == nil && opts.Version != 0) || (current != nil && current.HLC != opts.Version) {
+			return result, nil
+		}
+	}
+
 	var expiration int64
-	if ttlMs > 0 {
-		expiration = now + ttlMs
+	switch {
+	case opts.KeepTTL && current != nil:
+		expiration = current.TTL
+	case opts.TTL > 0:
+		expiration = now + opts.TTL
+	default:
+		if ttl := s.defaultTTL(key); ttl > 0 {
+			s.defaultTTLsApplied.Add(1)
+			expiration = now + ttl
+		}
+	}
+	if expiration > 0 {
 		s.ttlWheel.Add(key, expiration)
 	}
 
-	val := Value{
+	s.appendVersion(shard, key, Value{
 		Data:      value,
 		Timestamp: now,
 		TTL:       expiration,
-	}
+	})
+	s.indexWrite(key, value)
+	result.Written = true
+	return result, nil
+}
 
+// appendVersion adds a new version for key, pruning history by its
+// retention policy. The version is timestamped by the store clock, so
+// versions stay ordered even if the wall clock steps backwards.
+// The caller must hold the shard write lock.
+func (s *Store) appendVersion(shard *Shard, key string, val Value) {
 	history, exists := shard.data[key]
 	if !exists {
 		history = &KeyHistory{
 			Versions: make([]Value, 0, MaxVersions),
 		}
-		shard.data[key] = history
+		shard.put(key, history)
+		s.trackBucket(key)
 	}
 
 	history.mu.Lock()
 	defer history.mu.Unlock()
+	s.appendLocked(key, history, val)
+}
+
+// appendLocked adds a new version to an existing history like appendVersion.
+// A version given an HLC keeps it, so that a multi-key write can order all
+// its versions at one instant. The caller must hold the shard and history
+// write locks.
+func (s *Store) appendLocked(key string, history *KeyHistory, val Value) {
+	// A kept TTL keeps its mode, a new one follows the sliding patterns
+	if n := len(history.Versions); n == 0 || val.TTL != history.Versions[n-1].TTL {
+		history.setSliding(s.slidingTTL(key, val.TTL-val.Timestamp))
+	}
+
+	if val.HLC == 0 {
+		val.HLC = s.clock.Now()
+	}
+	val.Timestamp = val.HLC.Wall()
+	history.recordWrite(val.Timestamp)
+	history.tombstone.Store(false)
+	if history.first == 0 {
+		history.first = val.HLC
+	}
 
 	// Add new version
+	val.Seq = history.created.Add(1)
 	history.Versions = append(history.Versions, val)
+	s.amplification.record(key, val.Timestamp, 1, 0)
+	s.publishWrite(key, &val)
+
+	s.pruneHistory(key, history, val.Timestamp)
+	history.publishCurrent()
+}
 
-	// Keep only the latest MaxVersions
-	if len(history.Versions) > MaxVersions {
-		history.Versions = history.Versions[len(history.Versions)-MaxVersions:]
+// publishCurrent makes the latest version of a history visible to lock-free
+// readers. It is copied, so it can still be changed in place, like EXPIRE
+// does, as long as it is published again. The caller must hold the history
+// write lock.
+func (h *KeyHistory) publishCurrent() {
+	if len(h.Versions) == 0 {
+		h.current.Store(nil)
+		return
 	}
+	latest := h.Versions[len(h.Versions)-1]
+	h.current.Store(&latest)
 }
 
-// Get retrieves the current value of a key
-func (s *Store) Get(key string) (string, bool) {
-	return s.GetAt(key, time.Now().UnixMilli())
+// latest returns the current live version of a history, or nil if the key
+// has no versions or its latest version has expired or records a delete.
+// The caller must hold the history lock.
+func (h *KeyHistory) latest(now int64) *Value {
+	if len(h.Versions) == 0 {
+		return nil
+	}
+	version := &h.Versions[len(h.Versions)-1]
+	if version.Deleted {
+		return nil
+	}
+	if expiration := h.expiration(version); expiration > 0 && now >= expiration {
+		return nil
+	}
+	return version
 }
 
-// GetAt retrieves the value of a key at a specific timestamp (MVCC)
-func (s *Store) GetAt(key string, timestamp int64) (string, bool) {
-	shard := s.getShard(key)
+// Get retrieves the current value of a key, extending its TTL if it is in
+// sliding TTL mode. It takes no lock: the shard is searched through its
+// lock-free index and the latest version is read from the copy the last
+// write published. JSON documents are returned encoded; other types fail
+// with ErrWrongType.
+func (s *Store) Get(key string) (string, bool, error) {
+	history, exists := s.getShard(key).lookup(key)
+	if !exists {
+		return "", false, nil
+	}
 
-	shard.mu.RLock()
-	history, exists := shard.data[key]
-	shard.mu.RUnlock()
+	now := time.Now().UnixMilli()
+	history.recordRead(now)
+
+	latest := history.current.Load()
+	if latest == nil || latest.Deleted {
+		return "", false, nil
+	}
+	if expiration := history.slidExpiration(latest.TTL); expiration > 0 && now >= expiration {
+		s.expireLazily(key, history)
+		return "", false, nil
+	}
+	if !latest.readable() {
+		return "", false, ErrWrongType
+	}
+	history.slide(now)
+	return latest.Data, true, nil
+}
 
+// GetAt retrieves the value of a key at a specific timestamp (MVCC). Each
+// version is visible from its write until its own TTL, so the older versions
+// of an expired key stay readable at the timestamps they were current.
+// Like Get, it fails with ErrWrongType on a version that is not a string or
+// JSON document.
+func (s *Store) GetAt(key string, timestamp int64) (string, bool, error) {
+	history, exists := s.getShard(key).lookup(key)
 	if !exists {
-		return "", false
+		return "", false, nil
 	}
 
+	now := time.Now().UnixMilli()
+	history.recordRead(now)
+
 	history.mu.RLock()
 	defer history.mu.RUnlock()
 
@@ -139,9 +505,16 @@ func (s *Store) GetAt(key string, timestamp int64) (string, bool) {
 	for i := len(history.Versions) - 1; i >= 0; i-- {
 		version := &history.Versions[i]
 		if version.Timestamp <= timestamp {
+			if version.Deleted {
+				return "", false, nil
+			}
 			// Check if the key was expired at the requested timestamp
-			if version.TTL > 0 && timestamp >= version.TTL {
-				return "", false
+			expiration := history.expiration(version)
+			if expiration > 0 && timestamp >= expiration {
+				if i == len(history.Versions)-1 && now >= expiration {
+					s.expireLazily(key, history)
+				}
+				return "", false, nil
 			}
 			latestValue = version
 			break
@@ -149,31 +522,204 @@ func (s *Store) GetAt(key string, timestamp int64) (string, bool) {
 	}
 
 	if latestValue == nil {
-		return "", false
+		return "", false, nil
+	}
+	if !latestValue.readable() {
+		return "", false, ErrWrongType
+	}
+
+	return latestValue.Data, true, nil
+}
+
+// GetVersion returns the value of the version of a key numbered seq, as
+// listed by History, even if it has since been overwritten or has expired.
+// It reports false if the version was trimmed, never written, or records a
+// delete, and returns ErrWrongType if the version holds neither a string
+// nor a JSON document.
+func (s *Store) GetVersion(key string, seq int64) (string, bool, error) {
+	history, exists := s.getShard(key).lookup(key)
+	if !exists {
+		return "", false, nil
 	}
 
-	return latestValue.Data, true
+	history.recordRead(time.Now().UnixMilli())
+
+	history.mu.RLock()
+	defer history.mu.RUnlock()
+
+	// Versions are in write order, so their sequence numbers ascend
+	i := sort.Search(len(history.Versions), func(i int) bool {
+		return history.Versions[i].Seq >= seq
+	})
+	if i == len(history.Versions) || history.Versions[i].Seq != seq || history.Versions[i].Deleted {
+		return "", false, nil
+	}
+	if !history.Versions[i].readable() {
+		return "", false, ErrWrongType
+	}
+	return history.Versions[i].Data, true, nil
+}
+
+// Delete removes a key. The delete is recorded as a new version, so the
+// history stays readable through GetAt and History until retention drops
+// it; Purge erases it at once.
+func (s *Store) Delete(key string) (deleted bool) {
+	s.run(key, func() { deleted = s.delete(key) })
+	return
+}
+
+func (s *Store) delete(key string) bool {
+	now := time.Now().UnixMilli()
+	shard := s.getShard(key)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	history, exists := shard.data[key]
+	if !exists {
+		return false
+	}
+
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	if history.latest(now) == nil {
+		return false
+	}
+	s.markDeleted(key, history, now)
+	return true
 }
 
-// Delete removes a key
-func (s *Store) Delete(key string) bool {
+// markDeleted records the delete of a live key as a new version, turning
+// its history into a tombstone. The caller must hold the shard and history
+// write locks.
+func (s *Store) markDeleted(key string, history *KeyHistory, now int64) {
+	s.appendLocked(key, history, Value{Timestamp: now, Deleted: true})
+	history.tombstone.Store(true)
+	s.ttlWheel.Remove(key)
+	s.indexDelete(key)
+}
+
+// Purge erases a key and its whole history, including the tombstone of a
+// deleted or expired key. It reports whether there was anything to erase.
+func (s *Store) Purge(key string) (purged bool) {
+	s.run(key, func() {
+		live := s.Exists(key) > 0
+		if purged = s.purge(key); purged && live {
+			s.publish(Event{Type: EventDelete, Key: key, Timestamp: time.Now().UnixMilli()})
+		}
+	})
+	return
+}
+
+func (s *Store) purge(key string) bool {
 	shard := s.getShard(key)
 
 	shard.mu.Lock()
 	defer shard.mu.Unlock()
 
-	_, exists := shard.data[key]
-	if exists {
-		delete(shard.data, key)
+	if _, exists := shard.data[key]; !exists {
+		return false
+	}
+	shard.remove(key)
+	s.ttlWheel.Remove(key)
+	s.indexDelete(key)
+	return true
+}
+
+// GetDel returns the value of a string key and deletes the key in the same
+// critical section
+func (s *Store) GetDel(key string) (value string, found bool, err error) {
+	s.run(key, func() { value, found, err = s.getDel(key) })
+	return
+}
+
+func (s *Store) getDel(key string) (string, bool, error) {
+	now := time.Now().UnixMilli()
+	shard := s.getShard(key)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	history, exists := shard.data[key]
+	if !exists {
+		return "", false, nil
+	}
+
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	latest := history.latest(now)
+	if latest == nil {
+		return "", false, nil
+	}
+	if latest.Type != TypeString {
+		return "", false, ErrWrongType
+	}
+
+	value := latest.Data
+	s.markDeleted(key, history, now)
+	return value, true, nil
+}
+
+// GetEx returns the value of a string key and updates its TTL in the same
+// critical section: expiresAt (Unix ms) sets a new expiration and persist
+// removes it, otherwise the TTL is left alone
+func (s *Store) GetEx(key string, expiresAt int64, persist bool) (value string, found bool, err error) {
+	s.run(key, func() { value, found, err = s.getEx(key, expiresAt, persist) })
+	return
+}
+
+func (s *Store) getEx(key string, expiresAt int64, persist bool) (string, bool, error) {
+	now := time.Now().UnixMilli()
+	shard := s.getShard(key)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	history, exists := shard.data[key]
+	if !exists {
+		return "", false, nil
+	}
+
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	latest := history.latest(now)
+	if latest == nil {
+		return "", false, nil
+	}
+	if latest.Type != TypeString {
+		return "", false, ErrWrongType
+	}
+
+	switch {
+	case expiresAt > 0:
+		latest.TTL = expiresAt
+		history.publishCurrent()
+		history.setSliding(s.slidingTTL(key, expiresAt-now))
+		history.recordWrite(now)
+		s.ttlWheel.Add(key, expiresAt)
+	case persist && latest.TTL > 0:
+		latest.TTL = 0
+		history.publishCurrent()
+		history.setSliding(0)
+		history.recordWrite(now)
 		s.ttlWheel.Remove(key)
-		return true
+	default:
+		history.slide(now)
 	}
+	return latest.Data, true, nil
+}
 
-	return false
+// Expire sets TTL for a key. The key is in sliding TTL mode if it matches a
+// sliding pattern, see ExpireSliding.
+func (s *Store) Expire(key string, ttlMs int64) (updated bool) {
+	s.run(key, func() { updated = s.expire(key, ttlMs, false) })
+	return
 }
 
-// Expire sets TTL for a key
-func (s *Store) Expire(key string, ttlMs int64) bool {
+func (s *Store) expire(key string, ttlMs int64, sliding bool) bool {
 	shard := s.getShard(key)
 
 	shard.mu.Lock()
@@ -187,14 +733,22 @@ func (s *Store) Expire(key string, ttlMs int64) bool {
 	history.mu.Lock()
 	defer history.mu.Unlock()
 
-	if len(history.Versions) == 0 {
+	now := time.Now().UnixMilli()
+	latest := history.latest(now)
+	if latest == nil {
 		return false
 	}
 
 	// Update TTL of the latest version
-	expiration := time.Now().UnixMilli() + ttlMs
-	latestVersion := &history.Versions[len(history.Versions)-1]
-	latestVersion.TTL = expiration
+	expiration := now + ttlMs
+	latest.TTL = expiration
+	history.publishCurrent()
+	if sliding {
+		history.setSliding(ttlMs)
+	} else {
+		history.setSliding(s.slidingTTL(key, ttlMs))
+	}
+	history.recordWrite(now)
 
 	s.ttlWheel.Add(key, expiration)
 	return true
@@ -219,20 +773,24 @@ func (s *Store) TTL(key string) int64 {
 		return -2
 	}
 
-	latestVersion := &history.Versions[len(history.Versions)-1]
-	if latestVersion.TTL == 0 {
-		return -1 // No expiration
+	expiration := history.expiration(&history.Versions[len(history.Versions)-1])
+	if expiration == 0 {
+		// Keys in a time bucket expire with their bucket
+		if expiration = s.bucketExpiration(key); expiration == 0 {
+			return -1 // No expiration
+		}
 	}
 
 	now := time.Now().UnixMilli()
-	if now >= latestVersion.TTL {
+	if now >= expiration {
 		return -2 // Already expired
 	}
 
-	return latestVersion.TTL - now
+	return expiration - now
 }
 
-// History returns the version history for a key
+// History returns the version history for a key, newest first. Versions
+// keep their Seq, so trimmed versions show as gaps below the oldest one.
 func (s *Store) History(key string, limit int) []Value {
 	shard := s.getShard(key)
 
@@ -244,71 +802,323 @@ func (s *Store) History(key string, limit int) []Value {
 		return []Value{}
 	}
 
+	history.recordRead(time.Now().UnixMilli())
+
 	history.mu.RLock()
 	defer history.mu.RUnlock()
 
+	// Versions are stored in write order; return them newest first so that
+	// versions written in the same millisecond keep their relative order
 	versions := make([]Value, len(history.Versions))
-	copy(versions, history.Versions)
+	for i, version := range history.Versions {
+		versions[len(versions)-1-i] = version
+	}
 
-	// Sort by timestamp (newest first)
-	sort.Slice(versions, func(i, j int) bool {
-		return versions[i].Timestamp > versions[j].Timestamp
+	if limit > 0 && limit < len(versions) {
+		versions = versions[:limit]
+	}
+
+	return versions
+}
+
+// HistoryRange returns the versions of a key written between startMs and
+// endMs (Unix milliseconds, both inclusive), newest first. A limit of 0
+// returns every version in the range.
+func (s *Store) HistoryRange(key string, startMs, endMs int64, limit int) []Value {
+	versions := s.History(key, 0)
+
+	// Versions are newest first, so the range is a contiguous run
+	hi := sort.Search(len(versions), func(i int) bool {
+		return versions[i].Timestamp <= endMs
+	})
+	lo := sort.Search(len(versions), func(i int) bool {
+		return versions[i].Timestamp < startMs
 	})
+	if hi >= lo {
+		return []Value{}
+	}
 
+	versions = versions[hi:lo]
 	if limit > 0 && limit < len(versions) {
 		versions = versions[:limit]
 	}
-
 	return versions
 }
 
-// StartBackgroundProcesses starts background goroutines for TTL management
+// HistoryScan returns a page of up to count versions of a key written
+// between startMs and endMs, newest first, starting after cursor, and the
+// cursor of the next page, 0 once there are none. A cursor is the HLC of
+// the last version returned, which no write or retention trim can move, so
+// paging never skips or repeats a version: versions written meanwhile are
+// newer than every page and versions trimmed meanwhile are just not
+// returned. Cursor 0 starts at the newest version.
+func (s *Store) HistoryScan(key string, startMs, endMs int64, cursor HLC, count int) ([]Value, HLC) {
+	versions := s.HistoryRange(key, startMs, endMs, 0)
+	if cursor != 0 {
+		// Newest first, so the versions older than cursor are a suffix
+		i := sort.Search(len(versions), func(i int) bool {
+			return versions[i].HLC < cursor
+		})
+		versions = versions[i:]
+	}
+
+	if count <= 0 || count >= len(versions) {
+		return versions, 0
+	}
+	versions = versions[:count]
+	return versions, versions[count-1].HLC
+}
+
+// ValueMeta is the current value of a key together with its MVCC metadata
+type ValueMeta struct {
+	Value     string
+	Timestamp int64 // Unix milliseconds when the current version was written
+	HLC       HLC   // Hybrid logical clock timestamp of the current version
+	TTL       int64 // Remaining milliseconds, -1 if the key has no expiration
+	Versions  int
+}
+
+// GetMeta returns the current value of a string or JSON key and its
+// metadata in a single critical section
+func (s *Store) GetMeta(key string) (ValueMeta, bool, error) {
+	now := time.Now().UnixMilli()
+	shard := s.getShard(key)
+
+	shard.mu.RLock()
+	history, exists := shard.data[key]
+	shard.mu.RUnlock()
+
+	if !exists {
+		return ValueMeta{}, false, nil
+	}
+
+	history.recordRead(now)
+
+	history.mu.RLock()
+	defer history.mu.RUnlock()
+
+	latest := history.latest(now)
+	if latest == nil {
+		return ValueMeta{}, false, nil
+	}
+	if !latest.readable() {
+		return ValueMeta{}, false, ErrWrongType
+	}
+	history.slide(now)
+
+	meta := ValueMeta{
+		Value:     latest.Data,
+		Timestamp: latest.Timestamp,
+		HLC:       latest.HLC,
+		TTL:       -1,
+		Versions:  len(history.Versions),
+	}
+	if expiration := history.expiration(latest); expiration > 0 {
+		meta.TTL = expiration - now
+	}
+
+	return meta, true, nil
+}
+
+// StartBackgroundProcesses starts background goroutines for TTL management,
+// history compaction and working set estimation in every database,
+// including those opened later
 func (s *Store) StartBackgroundProcesses(ctx context.Context) {
+	s.databases.start(ctx)
+}
+
+func (s *Store) startBackground(ctx context.Context) {
 	s.wg.Add(1)
 	go func() {
 		defer s.wg.Done()
 		ticker := time.NewTicker(TTLCheckInterval)
 		defer ticker.Stop()
+		compaction := time.NewTicker(CompactionInterval)
+		defer compaction.Stop()
+		workingSet := time.NewTicker(WorkingSetInterval)
+		defer workingSet.Stop()
 
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				s.expireKeys()
+				if s.ActiveExpire() {
+					s.expireKeys()
+				}
+				s.expireBuckets(time.Now().UnixMilli())
+			case <-compaction.C:
+				s.compactHistory(time.Now().UnixMilli())
+			case <-workingSet.C:
+				s.estimateWorkingSet(time.Now().UnixMilli())
+			case key := <-s.lazyExpired:
+				s.expireLazyKey(key)
 			}
 		}
 	}()
 }
 
-// expireKeys removes expired keys
+// expireKeys expires keys that have come due, as many as the expiry policy
+// allows under the current load
 func (s *Store) expireKeys() {
-	now := time.Now().UnixMilli()
-	expiredKeys := s.ttlWheel.GetExpired(now)
+	start := time.Now()
+	now := start.UnixMilli()
+	expiredKeys, backlog := s.ttlWheel.GetExpired(now, s.expiryBatch(start))
 
+	expired := 0
 	for _, key := range expiredKeys {
-		shard := s.getShard(key)
+		key := key
+		var final Value
+		var removed bool
+		s.run(key, func() { final, removed = s.expireKey(key, now) })
+		if removed {
+			expired++
+			s.archive(key, final, ArchiveExpired, now)
+		}
+	}
+	s.recordExpiry(expired, backlog)
+}
 
-		shard.mu.Lock()
-		history, exists := shard.data[key]
-		if exists {
-			history.mu.RLock()
-			if len(history.Versions) > 0 {
-				latestVersion := &history.Versions[len(history.Versions)-1]
-				if latestVersion.TTL > 0 && now >= latestVersion.TTL {
-					delete(shard.data, key)
-				}
-			}
-			history.mu.RUnlock()
+// expireKey turns key into a tombstone if its latest version has expired by
+// now, returning that version. The key no longer exists and leaves the
+// search indexes, but its history stays readable through GetAt and History
+// until compaction drops it, see dropTombstones.
+func (s *Store) expireKey(key string, now int64) (Value, bool) {
+	shard := s.getShard(key)
+
+	shard.mu.RLock()
+	history, exists := shard.data[key]
+	shard.mu.RUnlock()
+
+	if !exists {
+		return Value{}, false
+	}
+
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	if history.tombstone.Load() || len(history.Versions) == 0 {
+		return Value{}, false
+	}
+	latest := &history.Versions[len(history.Versions)-1]
+
+	// Move the deadline of a sliding key to the one its reads earned
+	if expiration := history.expiration(latest); expiration != latest.TTL {
+		latest.TTL = expiration
+		history.publishCurrent()
+		if !latest.expired(now) {
+			s.ttlWheel.Add(key, expiration)
+			return Value{}, false
 		}
-		shard.mu.Unlock()
 	}
+	if !latest.expired(now) {
+		return Value{}, false
+	}
+	history.tombstone.Store(true)
+	s.indexDelete(key)
+	s.publish(Event{Type: EventExpire, Key: key, Timestamp: latest.TTL})
+	return *latest, true
 }
 
-// Close gracefully shuts down the store
+// Close gracefully shuts down the store and all its databases. Writes
+// issued after Close are applied on the calling goroutine.
 func (s *Store) Close() {
+	for _, db := range s.databases.list() {
+		db.close()
+	}
+}
+
+func (s *Store) close() {
 	s.cancel()
 	s.wg.Wait()
+
+	for _, shard := range s.shards {
+		shard.executor.stop()
+	}
+}
+
+// KeyCount returns the number of keys without inspecting their versions, so
+// tombstones of expired keys count until compaction drops them
+func (s *Store) KeyCount() int {
+	count := 0
+	for _, shard := range s.shards {
+		shard.mu.RLock()
+		count += len(shard.data)
+		shard.mu.RUnlock()
+	}
+	return count
+}
+
+// VersionCount returns the number of versions held by every key
+func (s *Store) VersionCount() int {
+	count := 0
+	for _, shard := range s.shards {
+		shard.mu.RLock()
+		for _, history := range shard.data {
+			history.mu.RLock()
+			count += len(history.Versions)
+			history.mu.RUnlock()
+		}
+		shard.mu.RUnlock()
+	}
+	return count
+}
+
+// ScheduledExpirations returns the number of keys in the TTL wheel
+func (s *Store) ScheduledExpirations() int {
+	return s.ttlWheel.Len()
+}
+
+// ShardKeyCounts returns the number of keys held by each shard
+func (s *Store) ShardKeyCounts() []int {
+	counts := make([]int, ShardCount)
+	for i, shard := range s.shards {
+		shard.mu.RLock()
+		counts[i] = len(shard.data)
+		shard.mu.RUnlock()
+	}
+	return counts
+}
+
+// ShardInfo describes the shard holding a key, for DEBUG SHARD
+type ShardInfo struct {
+	Index     int
+	Keys      int
+	Versions  int
+	Queued    int           // Mutations waiting for the owner goroutine
+	ReadWait  time.Duration // Time taken to acquire the read lock
+	WriteWait time.Duration // Time taken to acquire the write lock
+	RoundTrip time.Duration // Time taken to run a no-op on the owner goroutine
+}
+
+// ShardInfo returns the state of the shard key maps to, whether or not the
+// key exists. The lock waits are measured by taking each lock once, so they
+// show the contention at the time of the call.
+func (s *Store) ShardInfo(key string) ShardInfo {
+	index := s.hash(key)
+	shard := s.shards[index]
+	info := ShardInfo{Index: index, Queued: len(shard.executor.queue)}
+
+	start := time.Now()
+	shard.mu.RLock()
+	info.ReadWait = time.Since(start)
+	info.Keys = len(shard.data)
+	for _, history := range shard.data {
+		history.mu.RLock()
+		info.Versions += len(history.Versions)
+		history.mu.RUnlock()
+	}
+	shard.mu.RUnlock()
+
+	start = time.Now()
+	shard.mu.Lock()
+	info.WriteWait = time.Since(start)
+	shard.mu.Unlock()
+
+	start = time.Now()
+	shard.executor.run(func() {})
+	info.RoundTrip = time.Since(start)
+	return info
 }
 
 // Stats returns store statistics
@@ -1,6 +1,14 @@
 package store
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -11,7 +19,7 @@ func TestStoreBasicOperations(t *testing.T) {
 
 	// Test Set and Get
 	store.Set("key1", "value1", 0)
-	value, found := store.Get("key1")
+	value, found, _ := store.Get("key1")
 	if !found {
 		t.Error("Expected to find key1")
 	}
@@ -20,7 +28,7 @@ func TestStoreBasicOperations(t *testing.T) {
 	}
 
 	// Test Get non-existent key
-	_, found = store.Get("nonexistent")
+	_, found, _ = store.Get("nonexistent")
 	if found {
 		t.Error("Expected not to find nonexistent key")
 	}
@@ -31,7 +39,7 @@ func TestStoreBasicOperations(t *testing.T) {
 		t.Error("Expected key1 to be deleted")
 	}
 
-	_, found = store.Get("key1")
+	_, found, _ = store.Get("key1")
 	if found {
 		t.Error("Expected key1 to be deleted")
 	}
@@ -51,7 +59,7 @@ func TestStoreTTL(t *testing.T) {
 	store.Set("ttl_key", "value", 100) // 100ms TTL
 
 	// Should exist immediately
-	_, found := store.Get("ttl_key")
+	_, found, _ := store.Get("ttl_key")
 	if !found {
 		t.Error("Expected to find ttl_key immediately after setting")
 	}
@@ -66,7 +74,7 @@ func TestStoreTTL(t *testing.T) {
 	time.Sleep(150 * time.Millisecond)
 
 	// Should be expired
-	_, found = store.Get("ttl_key")
+	_, found, _ = store.Get("ttl_key")
 	if found {
 		t.Error("Expected ttl_key to be expired")
 	}
@@ -78,6 +86,68 @@ func TestStoreTTL(t *testing.T) {
 	}
 }
 
+func TestStoreSetWithOptions(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	result, err := store.SetWithOptions("k", "v1", SetOptions{Cond: SetIfExists})
+	if err != nil || result.Written {
+		t.Errorf("Expected XX on a missing key not to write, got %+v, %v", result, err)
+	}
+
+	store.SetWithOptions("k", "v1", SetOptions{TTL: 60000, Cond: SetIfMissing})
+	result, _ = store.SetWithOptions("k", "v2", SetOptions{Cond: SetIfMissing, Get: true})
+	if result.Written || result.Old != "v1" {
+		t.Errorf("Expected NX to keep v1, got %+v", result)
+	}
+
+	result, _ = store.SetWithOptions("k", "v3", SetOptions{KeepTTL: true, Get: true})
+	if !result.Written || result.Old != "v1" {
+		t.Errorf("Expected v3 to replace v1, got %+v", result)
+	}
+	if ttl := store.TTL("k"); ttl <= 0 {
+		t.Errorf("Expected KEEPTTL to keep the TTL, got %d", ttl)
+	}
+
+	store.SAdd("set", "a")
+	if _, err := store.SetWithOptions("set", "v", SetOptions{Get: true}); err != ErrWrongType {
+		t.Errorf("Expected ErrWrongType for GET on a set, got %v", err)
+	}
+}
+
+func TestStoreGetDelGetEx(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.Set("k", "v", 0)
+	expiresAt := time.Now().UnixMilli() + 60000
+	if value, found, err := store.GetEx("k", expiresAt, false); err != nil || !found || value != "v" {
+		t.Fatalf("GetEx = %q, %v, %v", value, found, err)
+	}
+	if ttl := store.TTL("k"); ttl <= 0 {
+		t.Errorf("Expected GetEx to set a TTL, got %d", ttl)
+	}
+	store.GetEx("k", 0, true)
+	if ttl := store.TTL("k"); ttl != -1 {
+		t.Errorf("Expected GetEx PERSIST to clear the TTL, got %d", ttl)
+	}
+
+	if value, found, _ := store.GetDel("k"); !found || value != "v" {
+		t.Errorf("GetDel = %q, %v", value, found)
+	}
+	if _, found, _ := store.Get("k"); found {
+		t.Error("Expected GetDel to delete the key")
+	}
+	if _, found, _ := store.GetDel("k"); found {
+		t.Error("Expected GetDel on a missing key to find nothing")
+	}
+
+	store.SAdd("set", "a")
+	if _, _, err := store.GetDel("set"); err != ErrWrongType {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+}
+
 func TestStoreExpire(t *testing.T) {
 	store := NewStore()
 	defer store.Close()
@@ -128,13 +198,13 @@ func TestStoreMVCC(t *testing.T) {
 	store.Set("mvcc_key", "v3", 0)
 
 	// Get current value
-	value, found := store.Get("mvcc_key")
+	value, found, _ := store.Get("mvcc_key")
 	if !found || value != "v3" {
 		t.Errorf("Expected current value v3, got %s (found: %t)", value, found)
 	}
 
 	// Get value at time before any writes
-	value, found = store.GetAt("mvcc_key", now-1000)
+	value, found, _ = store.GetAt("mvcc_key", now-1000)
 	if found {
 		t.Error("Expected no value before first write")
 	}
@@ -163,6 +233,72 @@ func TestStoreMVCC(t *testing.T) {
 	}
 }
 
+func TestStoreHistoryRange(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	var stamps []int64
+	for _, v := range []string{"v1", "v2", "v3", "v4"} {
+		store.Set("range_key", v, 0)
+		stamps = append(stamps, store.History("range_key", 1)[0].Timestamp)
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	versions := store.HistoryRange("range_key", stamps[1], stamps[2], 0)
+	if len(versions) != 2 || versions[0].Data != "v3" || versions[1].Data != "v2" {
+		t.Errorf("Expected [v3 v2], got %+v", versions)
+	}
+
+	if versions := store.HistoryRange("range_key", stamps[0], stamps[3], 3); len(versions) != 3 || versions[0].Data != "v4" {
+		t.Errorf("Expected the 3 newest versions, got %+v", versions)
+	}
+	if versions := store.HistoryRange("range_key", stamps[3]+1, stamps[3]+1000, 0); len(versions) != 0 {
+		t.Errorf("Expected no versions after the last write, got %+v", versions)
+	}
+	if versions := store.HistoryRange("missing", 0, stamps[3], 0); len(versions) != 0 {
+		t.Errorf("Expected no versions for a missing key, got %+v", versions)
+	}
+}
+
+func TestStoreHistoryScan(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	policy, _ := ParseRetention("count:4")
+	store.Set("k", "0", 0)
+	store.SetKeyRetention("k", policy)
+	for i := 1; i < 4; i++ {
+		store.Set("k", strconv.Itoa(i), 0)
+	}
+
+	page, cursor := store.HistoryScan("k", math.MinInt64, math.MaxInt64, 0, 2)
+	if len(page) != 2 || page[0].Data != "3" || page[1].Data != "2" || cursor != page[1].HLC {
+		t.Fatalf("Unexpected first page %+v, cursor %d", page, cursor)
+	}
+
+	// Two writes trim the two oldest versions; the cursor still resumes
+	// right after the last version returned
+	store.Set("k", "4", 0)
+	store.Set("k", "5", 0)
+	page, cursor = store.HistoryScan("k", math.MinInt64, math.MaxInt64, cursor, 2)
+	if len(page) != 0 || cursor != 0 {
+		t.Errorf("Expected the trimmed versions to end the scan, got %+v, cursor %d", page, cursor)
+	}
+
+	page, cursor = store.HistoryScan("k", math.MinInt64, math.MaxInt64, 0, 3)
+	if len(page) != 3 || page[0].Data != "5" || cursor == 0 {
+		t.Fatalf("Unexpected page %+v, cursor %d", page, cursor)
+	}
+	page, cursor = store.HistoryScan("k", math.MinInt64, math.MaxInt64, cursor, 3)
+	if len(page) != 1 || page[0].Data != "2" || cursor != 0 {
+		t.Errorf("Expected the last version and a 0 cursor, got %+v, cursor %d", page, cursor)
+	}
+
+	if page, cursor := store.HistoryScan("missing", math.MinInt64, math.MaxInt64, 0, 2); len(page) != 0 || cursor != 0 {
+		t.Errorf("Expected an empty scan of a missing key, got %+v, %d", page, cursor)
+	}
+}
+
 func TestStoreStats(t *testing.T) {
 	store := NewStore()
 	defer store.Close()
@@ -188,6 +324,17 @@ func TestStoreStats(t *testing.T) {
 	if !ok || shardCount != ShardCount {
 		t.Errorf("Expected shard count %d, got %v", ShardCount, stats["shard_count"])
 	}
+
+	if versions := store.VersionCount(); versions != 3 {
+		t.Errorf("Expected 3 versions, got %d", versions)
+	}
+	if scheduled := store.ScheduledExpirations(); scheduled != 0 {
+		t.Errorf("Expected no scheduled expirations, got %d", scheduled)
+	}
+	store.Set("key3", "value3", 60000)
+	if scheduled := store.ScheduledExpirations(); scheduled != 1 {
+		t.Errorf("Expected 1 scheduled expiration, got %d", scheduled)
+	}
 }
 
 func TestStoreSharding(t *testing.T) {
@@ -213,4 +360,779 @@ func TestStoreSharding(t *testing.T) {
 	if store.hash(key1) != shard1 {
 		t.Error("Hash function should be deterministic")
 	}
+
+	// Placement must not change across processes or releases: these are the
+	// reference xxHash64 values
+	for key, want := range map[string]uint64{
+		"":           0xef46db3751d8e999,
+		"user:1":     0xd9c7c4609e6080f3,
+		"test_key_1": 0x94c98660c8afa3a2,
+	} {
+		if got := keyHash(key); got != want {
+			t.Errorf("keyHash(%q) = %#x, want %#x", key, got, want)
+		}
+	}
+}
+
+func BenchmarkKeyHash(b *testing.B) {
+	key := "session:3f2a9c1e-user:12345"
+
+	b.Run("xxhash", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			keyHash(key)
+		}
+	})
+	// The hash used before, for comparison
+	b.Run("sha256", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			h := sha256.Sum256([]byte(key))
+			_ = binary.BigEndian.Uint64(h[:8])
+		}
+	})
+}
+
+func TestStoreKeyStats(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	if _, exists := store.KeyStats("missing"); exists {
+		t.Error("Expected no stats for missing key")
+	}
+
+	store.Set("stats_key", "v1", 0)
+	store.Set("stats_key", "v2", 60000)
+	store.Get("stats_key")
+	store.Get("stats_key")
+	store.History("stats_key", 0)
+
+	stats, exists := store.KeyStats("stats_key")
+	if !exists {
+		t.Fatal("Expected stats for stats_key")
+	}
+
+	if stats.Writes != 2 {
+		t.Errorf("Expected 2 writes, got %d", stats.Writes)
+	}
+	if stats.Reads != 3 {
+		t.Errorf("Expected 3 reads, got %d", stats.Reads)
+	}
+	if stats.Versions != 2 {
+		t.Errorf("Expected 2 versions, got %d", stats.Versions)
+	}
+	if stats.TTL <= 0 || stats.TTL > 60000 {
+		t.Errorf("Expected TTL within (0, 60000], got %d", stats.TTL)
+	}
+	if stats.Encoding != "embstr" {
+		t.Errorf("Expected embstr encoding, got %s", stats.Encoding)
+	}
+	if stats.Bytes <= 0 || stats.LastAccess == 0 {
+		t.Errorf("Expected bytes and last access to be set, got %+v", stats)
+	}
+}
+
+func TestKeyFrequency(t *testing.T) {
+	var history KeyHistory
+	now := time.Now().UnixMilli()
+
+	if freq := history.frequency(now); freq != lfuInitValue {
+		t.Errorf("Expected an untouched key at %d, got %d", lfuInitValue, freq)
+	}
+
+	// The counter grows with accesses, more slowly as it climbs
+	for i := 0; i < 1000; i++ {
+		history.touchFrequency(now)
+	}
+	freq := history.frequency(now)
+	if freq <= lfuInitValue || freq >= 255 {
+		t.Errorf("Expected a logarithmic frequency after 1000 accesses, got %d", freq)
+	}
+
+	// One point decays per idle minute
+	if decayed := history.frequency(now + 3*lfuDecayPeriod); decayed != freq-3 {
+		t.Errorf("Expected %d after 3 idle minutes, got %d", freq-3, decayed)
+	}
+	if decayed := history.frequency(now + 1000*lfuDecayPeriod); decayed != 0 {
+		t.Errorf("Expected a long idle key to decay to 0, got %d", decayed)
+	}
+}
+
+func TestStoreValidators(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.SetValidator("num:*", validatorFunc(func(key, value string) error {
+		if value == "" || strings.Trim(value, "0123456789") != "" {
+			return fmt.Errorf("not a number")
+		}
+		return nil
+	}))
+
+	if err := store.Set("num:1", "42", 0); err != nil {
+		t.Errorf("Expected valid write to succeed, got %v", err)
+	}
+
+	err := store.Set("num:1", "abc", 0)
+	var verr *ValidationError
+	if !errors.As(err, &verr) || verr.Pattern != "num:*" {
+		t.Errorf("Expected ValidationError for num:*, got %v", err)
+	}
+	if value, _, _ := store.Get("num:1"); value != "42" {
+		t.Errorf("Expected rejected write to leave 42, got %s", value)
+	}
+
+	// Keys outside the pattern are not validated
+	if err := store.Set("other", "abc", 0); err != nil {
+		t.Errorf("Expected unvalidated write to succeed, got %v", err)
+	}
+
+	if !store.RemoveValidator("num:*") {
+		t.Error("Expected validator to be removed")
+	}
+	if err := store.Set("num:1", "abc", 0); err != nil {
+		t.Errorf("Expected write to succeed after removing validator, got %v", err)
+	}
+}
+
+type validatorFunc func(key, value string) error
+
+func (f validatorFunc) Validate(key, value string) error {
+	return f(key, value)
+}
+
+func TestStoreGetMeta(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	if _, exists, _ := store.GetMeta("missing"); exists {
+		t.Error("Expected no metadata for missing key")
+	}
+
+	before := time.Now().UnixMilli()
+	store.Set("meta_key", "v1", 0)
+	store.Set("meta_key", "v2", 5000)
+
+	meta, exists, err := store.GetMeta("meta_key")
+	if err != nil || !exists {
+		t.Fatalf("Expected metadata for meta_key (err: %v)", err)
+	}
+	if meta.Value != "v2" || meta.Versions != 2 {
+		t.Errorf("Unexpected metadata: %+v", meta)
+	}
+	if meta.Timestamp < before || meta.TTL <= 0 || meta.TTL > 5000 {
+		t.Errorf("Unexpected timestamp or TTL: %+v", meta)
+	}
+
+	store.JSONSet("doc", "$", `{"a":1}`, JSONAlways)
+	if meta, exists, err := store.GetMeta("doc"); err != nil || !exists || meta.Value != `{"a":1}` {
+		t.Errorf("Expected the JSON document, got %+v, %v, %v", meta, exists, err)
+	}
+
+	store.SAdd("set_key", "a")
+	if _, _, err := store.GetMeta("set_key"); err != ErrWrongType {
+		t.Errorf("Expected ErrWrongType for set key, got %v", err)
+	}
+}
+
+func TestStoreSearch(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.Set("product:1", `{"name": "blue kettle"}`, 0)
+	store.Set("other:1", `{"name": "blue kettle"}`, 0)
+
+	if err := store.CreateIndex("products", "product:*", []string{"$.name"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := store.CreateIndex("products", "*", nil); err != ErrIndexExists {
+		t.Errorf("Expected ErrIndexExists, got %v", err)
+	}
+
+	// Existing keys are backfilled and new writes are indexed
+	store.Set("product:2", `{"name": "blue teapot"}`, 0)
+	keys, err := store.Search("products", "blue")
+	if err != nil || strings.Join(keys, ",") != "product:1,product:2" {
+		t.Errorf("Unexpected search result %v (err: %v)", keys, err)
+	}
+
+	store.Set("product:2", `{"name": "green teapot"}`, 0)
+	store.Delete("product:1")
+	store.Rename("product:2", "product:3")
+	if keys, _ := store.Search("products", "blue | green"); strings.Join(keys, ",") != "product:3" {
+		t.Errorf("Expected index to follow writes, deletes and renames, got %v", keys)
+	}
+
+	if _, err := store.Search("missing", "blue"); err != ErrNoSuchIndex {
+		t.Errorf("Expected ErrNoSuchIndex, got %v", err)
+	}
+}
+
+func TestStoreDefaultTTL(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	if err := store.SetDefaultTTL("session:*", time.Minute); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	store.SetDefaultTTL("session:admin:*", time.Hour)
+
+	store.Set("session:1", "a", 0)
+	store.Set("session:admin:1", "b", 0)
+	store.Set("session:2", "c", 5000) // Explicit TTL wins
+	store.Set("other", "d", 0)
+
+	if ttl := store.TTL("session:1"); ttl <= 0 || ttl > 60000 {
+		t.Errorf("Expected default TTL of about 60s, got %dms", ttl)
+	}
+	if ttl := store.TTL("session:admin:1"); ttl <= 60000 {
+		t.Errorf("Expected the longest matching pattern to win, got %dms", ttl)
+	}
+	if ttl := store.TTL("session:2"); ttl > 5000 {
+		t.Errorf("Expected explicit TTL to be kept, got %dms", ttl)
+	}
+	if ttl := store.TTL("other"); ttl != -1 {
+		t.Errorf("Expected no TTL for unmatched key, got %d", ttl)
+	}
+	if applied := store.DefaultTTLsApplied(); applied != 2 {
+		t.Errorf("Expected 2 default TTLs applied, got %d", applied)
+	}
+
+	if !store.RemoveDefaultTTL("session:*") || store.RemoveDefaultTTL("session:*") {
+		t.Error("Expected default TTL to be removed exactly once")
+	}
+}
+
+func TestStoreRetention(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	for i := 0; i < MaxVersions+5; i++ {
+		store.Set("counted", fmt.Sprint(i), 0)
+	}
+	if versions := store.History("counted", 0); len(versions) != MaxVersions {
+		t.Errorf("Expected %d versions by default, got %d", MaxVersions, len(versions))
+	}
+
+	// Keep-all on one key leaves the others on the store policy
+	store.Set("kept", "0", 0)
+	if !store.SetKeyRetention("kept", RetentionPolicy{Kind: RetainAll}) {
+		t.Fatal("Expected key retention to be set")
+	}
+	for i := 1; i < MaxVersions+5; i++ {
+		store.Set("kept", fmt.Sprint(i), 0)
+	}
+	if versions := store.History("kept", 0); len(versions) != MaxVersions+5 {
+		t.Errorf("Expected every version to be kept, got %d", len(versions))
+	}
+	if policy, own, _ := store.KeyRetention("kept"); !own || policy.Kind != RetainAll {
+		t.Errorf("Unexpected key retention %v (own: %v)", policy, own)
+	}
+
+	// Age-based pruning keeps the latest version even once it is old
+	store.SetRetention(RetentionPolicy{Kind: RetainAge, Age: time.Hour})
+	store.Set("aged", "a", 0)
+	store.Set("aged", "b", 0)
+	removed := store.compactHistory(time.Now().Add(2 * time.Hour).UnixMilli())
+	if versions := store.History("aged", 0); len(versions) != 1 || versions[0].Data != "b" {
+		t.Errorf("Expected only the latest version to survive, got %+v", versions)
+	}
+	if versions := store.History("kept", 0); len(versions) != MaxVersions+5 {
+		t.Errorf("Expected key policy to override the store policy, got %d versions", len(versions))
+	}
+	if removed < 1 {
+		t.Errorf("Expected compaction to remove versions, removed %d", removed)
+	}
+
+	if store.SetKeyRetention("missing", RetentionPolicy{Kind: RetainAll}) {
+		t.Error("Expected retention on a missing key to fail")
+	}
+}
+
+func TestParseRetention(t *testing.T) {
+	for spec, want := range map[string]RetentionPolicy{
+		"count:5": {Kind: RetainCount, Count: 5},
+		"AGE:24h": {Kind: RetainAge, Age: 24 * time.Hour},
+		"all":     {Kind: RetainAll},
+	} {
+		policy, err := ParseRetention(spec)
+		if err != nil || policy != want {
+			t.Errorf("ParseRetention(%q) = %v, %v; want %v", spec, policy, err, want)
+		}
+	}
+
+	for _, spec := range []string{"count:0", "age:-1h", "all:1", "forever"} {
+		if _, err := ParseRetention(spec); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+}
+
+type recordingSink struct {
+	entries []ArchivedKey
+}
+
+func (r *recordingSink) Archive(entry ArchivedKey) error {
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+func (r *recordingSink) String() string { return "recording" }
+
+func TestStoreArchive(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	sink := &recordingSink{}
+	store.SetArchive("session:*", sink)
+
+	store.Set("session:1", "first", 0)
+	store.Set("session:1", "final", 10)
+	store.Set("session:2", "deleted", 10)
+	store.Set("other", "v", 10)
+	store.Delete("session:2") // Explicit deletes are not archived
+
+	time.Sleep(20 * time.Millisecond)
+	store.expireKeys()
+
+	if len(sink.entries) != 1 {
+		t.Fatalf("Expected one archived key, got %+v", sink.entries)
+	}
+	entry := sink.entries[0]
+	if entry.Key != "session:1" || entry.Value.Data != "final" || entry.Reason != ArchiveExpired {
+		t.Errorf("Unexpected archived key %+v", entry)
+	}
+	if _, exists, _ := store.Get("session:1"); exists {
+		t.Error("Expected archived key to be removed")
+	}
+
+	rules := store.Archives()
+	if len(rules) != 1 || rules[0].Archived != 1 || rules[0].Failed != 0 {
+		t.Errorf("Unexpected archive rules %+v", rules)
+	}
+}
+
+func TestStoreHLC(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	// Versions written within a millisecond are still strictly ordered
+	for i := 0; i < 100; i++ {
+		store.Set("hlc_key", fmt.Sprint(i), 0)
+	}
+	versions := store.History("hlc_key", 0)
+	for i := 1; i < len(versions); i++ {
+		if versions[i].HLC >= versions[i-1].HLC || versions[i].Timestamp > versions[i-1].Timestamp {
+			t.Fatalf("Versions out of order: %v after %v", versions[i-1].HLC, versions[i].HLC)
+		}
+	}
+
+	// The clock keeps counting while the wall clock is behind it
+	store.clock.last.Store(uint64(time.Now().Add(time.Hour).UnixMilli()) << hlcLogicalBits)
+	ahead := HLC(store.clock.last.Load())
+	store.Set("hlc_key", "late", 0)
+	meta, _, _ := store.GetMeta("hlc_key")
+	if meta.HLC != ahead+1 || meta.Timestamp != ahead.Wall() || meta.HLC.Logical() != 1 {
+		t.Errorf("Expected HLC %v, got %v", ahead+1, meta.HLC)
+	}
+	if value, _, _ := store.GetAt("hlc_key", ahead.Wall()); value != "late" {
+		t.Errorf("Expected the latest version at its HLC wall time, got %q", value)
+	}
+}
+
+func TestStoreAmplification(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.SetRetention(RetentionPolicy{Kind: RetainCount, Count: 2})
+	for i := 0; i < 5; i++ {
+		store.Set("metrics:cpu", fmt.Sprintf("%d", i), 0)
+	}
+	store.Set("metrics:mem", "1", 0)
+	store.Set("plain", "1", 0)
+
+	report := store.Amplification(time.Hour, 10)
+	if len(report.Namespaces) != 2 {
+		t.Fatalf("Expected 2 namespaces, got %+v", report.Namespaces)
+	}
+	metrics := report.Namespaces[0]
+	if metrics.Namespace != "metrics" || metrics.Created != 6 || metrics.Pruned != 3 ||
+		metrics.Keys != 2 || metrics.Retained != 3 || metrics.Amplification() != 3 {
+		t.Errorf("Unexpected metrics namespace %+v", metrics)
+	}
+
+	if len(report.Keys) != 1 || report.Keys[0].Key != "metrics:cpu" || report.Keys[0].Pruned != 3 ||
+		report.Keys[0].Retention != "count:2" {
+		t.Errorf("Unexpected keys %+v", report.Keys)
+	}
+}
+
+func TestStoreWorkingSet(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.Set("hot", "1", 0)
+	store.Set("cold", "22", 0)
+
+	// Two minutes later, only the key read since is in the 1m window
+	later := time.Now().UnixMilli() + 2*time.Minute.Milliseconds()
+	store.shards[store.hash("hot")].data["hot"].recordRead(later)
+
+	estimate := store.estimateWorkingSet(later)
+	if estimate.Keys != 2 || len(estimate.Windows) != len(WorkingSetWindows) {
+		t.Fatalf("Unexpected estimate %+v", estimate)
+	}
+	if w := estimate.Windows[0]; w.Label() != "1m" || w.Keys != 1 {
+		t.Errorf("Expected 1 key in the 1m window, got %+v", w)
+	}
+	if w := estimate.Windows[1]; w.Label() != "5m" || w.Keys != 2 || w.Bytes != estimate.Bytes {
+		t.Errorf("Expected every key in the 5m window, got %+v", w)
+	}
+	if keys, _ := estimate.Cold(); keys != 0 {
+		t.Errorf("Expected no cold keys, got %d", keys)
+	}
+	if store.WorkingSet().At != later {
+		t.Error("Expected WorkingSet to return the latest estimate")
+	}
+}
+
+func TestStoreAdaptiveExpiry(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.SetExpiryPolicy(ExpiryPolicy{MaxBatch: 8, MinBatch: 2, LatencyThreshold: time.Millisecond})
+	for i := 0; i < 20; i++ {
+		store.Set(fmt.Sprintf("k%d", i), "v", 1)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	// Slow commands halve the batch down to MinBatch
+	expect := func(expired int64, batch, backlog int) {
+		t.Helper()
+		stats := store.ExpiryStats()
+		if stats.Expired != expired || stats.Batch != batch || stats.Backlog != backlog {
+			t.Errorf("Expected expired=%d batch=%d backlog=%d, got %+v", expired, batch, backlog, stats)
+		}
+	}
+	store.ObserveLatency(10 * time.Millisecond)
+	store.expireKeys()
+	expect(4, 4, 16)
+	store.ObserveLatency(10 * time.Millisecond)
+	store.expireKeys()
+	store.ObserveLatency(10 * time.Millisecond)
+	store.expireKeys()
+	expect(8, 2, 12)
+	if deferred := store.ExpiryStats().Deferred; deferred != 3 {
+		t.Errorf("Expected 3 deferred ticks, got %d", deferred)
+	}
+
+	// Expired keys are hidden from reads meanwhile
+	if n := countTombstones(store); n != 8 {
+		t.Errorf("Expected 8 tombstones with 12 keys left to the sweep, got %d", n)
+	}
+	for i := 0; i < 20; i++ {
+		if _, exists, _ := store.Get(fmt.Sprintf("k%d", i)); exists {
+			t.Fatalf("Expected k%d to read as expired", i)
+		}
+	}
+
+	// Fast commands grow it back, an idle tick drains the backlog
+	store.ObserveLatency(100 * time.Microsecond)
+	store.expireKeys()
+	expect(12, 4, 8)
+	store.expireKeys()
+	expect(20, 8, 0)
+	if n := countTombstones(store); n != 20 {
+		t.Errorf("Expected every expired key to be a tombstone, got %d", n)
+	}
+}
+
+func TestStoreLazyExpiry(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.Set("k", "v", 1)
+	store.ttlWheel.Remove("k") // A key the sweep would never reach
+	time.Sleep(5 * time.Millisecond)
+
+	if _, exists, _ := store.Get("k"); exists {
+		t.Fatal("Expected the expired key to read as missing")
+	}
+	select {
+	case key := <-store.lazyExpired:
+		store.expireLazyKey(key)
+	default:
+		t.Fatal("Expected the read to queue the key for expiration")
+	}
+
+	if n := countTombstones(store); n != 1 {
+		t.Errorf("Expected the key to be a tombstone, got %d", n)
+	}
+	if lazy := store.ExpiryStats().Lazy; lazy != 1 {
+		t.Errorf("Expected 1 lazily expired key, got %d", lazy)
+	}
+}
+
+func TestStoreExpiredHistory(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.Set("k", "v1", 0)
+	time.Sleep(2 * time.Millisecond)
+	beforeExpiry := time.Now().UnixMilli()
+	time.Sleep(2 * time.Millisecond)
+	store.Set("k", "v2", 1)
+	time.Sleep(5 * time.Millisecond)
+	store.expireKeys()
+
+	// The key is gone but its history is still readable
+	if _, exists, _ := store.Get("k"); exists {
+		t.Fatal("Expected the expired key to read as missing")
+	}
+	if store.Exists("k") != 0 || store.TTL("k") != -2 {
+		t.Error("Expected the expired key not to exist")
+	}
+	if value, found, _ := store.GetAt("k", beforeExpiry); !found || value != "v1" {
+		t.Errorf("Expected v1 before the expiry, got %q (%v)", value, found)
+	}
+	if versions := store.History("k", 0); len(versions) != 2 || versions[0].Data != "v2" {
+		t.Errorf("Expected both versions in the history, got %+v", versions)
+	}
+
+	// Commands on existing keys treat the tombstone as missing
+	if store.Delete("k") || store.Expire("k", 60_000) {
+		t.Error("Expected DEL and EXPIRE to ignore the expired key")
+	}
+	if store.SetKeyRetention("k", RetentionPolicy{Kind: RetainAll}) {
+		t.Error("Expected retention on the expired key to fail")
+	}
+
+	// A new write continues the history
+	store.Set("k", "v3", 0)
+	if value, _, _ := store.Get("k"); value != "v3" {
+		t.Errorf("Expected v3, got %q", value)
+	}
+	if versions := store.History("k", 0); len(versions) != 3 {
+		t.Errorf("Expected the write to extend the history, got %d versions", len(versions))
+	}
+
+	// Compaction drops a tombstone once retention no longer keeps it
+	store.Set("gone", "v", 1)
+	time.Sleep(5 * time.Millisecond)
+	store.expireKeys()
+	store.compactHistory(time.Now().UnixMilli())
+	if versions := store.History("gone", 0); len(versions) != 1 {
+		t.Errorf("Expected the tombstone to be kept for now, got %d versions", len(versions))
+	}
+	store.compactHistory(time.Now().Add(TombstoneRetention).UnixMilli())
+	if versions := store.History("gone", 0); len(versions) != 0 {
+		t.Errorf("Expected the tombstone to be dropped, got %d versions", len(versions))
+	}
+	if _, exists, _ := store.Get("k"); !exists {
+		t.Error("Expected compaction to keep the live key")
+	}
+}
+
+// countTombstones returns the number of expired keys whose history is kept
+func countTombstones(store *Store) int {
+	count := 0
+	for _, shard := range store.shards {
+		shard.mu.RLock()
+		for _, history := range shard.data {
+			history.mu.RLock()
+			if history.tombstone.Load() {
+				count++
+			}
+			history.mu.RUnlock()
+		}
+		shard.mu.RUnlock()
+	}
+	return count
+}
+
+func TestStoreSlidingTTL(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.SetSlidingPatterns([]string{"session:*"})
+	store.Set("session:1", "v", 100)
+	store.Set("cache:1", "v", 100)
+	store.Set("cache:2", "v", 0)
+	store.ExpireSliding("cache:2", 100)
+
+	if stats, _ := store.KeyStats("session:1"); stats.Sliding != 100 {
+		t.Errorf("Expected a sliding TTL of 100ms, got %d", stats.Sliding)
+	}
+	if stats, _ := store.KeyStats("cache:1"); stats.Sliding != 0 {
+		t.Errorf("Expected a fixed TTL, got a sliding TTL of %d", stats.Sliding)
+	}
+
+	// Reads push the expiration back by the original TTL
+	time.Sleep(60 * time.Millisecond)
+	store.Get("session:1")
+	store.Get("cache:1")
+	store.Get("cache:2")
+	time.Sleep(60 * time.Millisecond)
+
+	for key, live := range map[string]bool{"session:1": true, "cache:1": false, "cache:2": true} {
+		if _, exists, _ := store.Get(key); exists != live {
+			t.Errorf("Expected %s live=%v after its original TTL", key, live)
+		}
+	}
+	if ttl := store.TTL("session:1"); ttl <= 0 || ttl > 100 {
+		t.Errorf("Expected the TTL to count from the last read, got %d", ttl)
+	}
+
+	// The sweep moves the deadline instead of expiring the key
+	if _, removed := store.expireKey("session:1", time.Now().UnixMilli()); removed {
+		t.Error("Expected the sweep to keep a key its reads extended")
+	}
+
+	// Without reads the key expires one TTL after the last one
+	time.Sleep(120 * time.Millisecond)
+	if _, exists, _ := store.Get("session:1"); exists {
+		t.Error("Expected the sliding key to expire without reads")
+	}
+
+	// A new TTL without the pattern or SLIDING makes the expiration fixed
+	store.Set("cache:3", "v", 0)
+	store.ExpireSliding("cache:3", 100)
+	store.Expire("cache:3", 100)
+	if stats, _ := store.KeyStats("cache:3"); stats.Sliding != 0 {
+		t.Errorf("Expected EXPIRE to make the TTL fixed, got %d", stats.Sliding)
+	}
+}
+
+func TestStoreDeleteHistory(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.Set("k", "v1", 0)
+	time.Sleep(2 * time.Millisecond)
+	beforeDelete := time.Now().UnixMilli()
+	time.Sleep(2 * time.Millisecond)
+
+	if !store.Delete("k") {
+		t.Fatal("Expected DEL to delete the key")
+	}
+	if store.Delete("k") {
+		t.Error("Expected a second DEL to find nothing")
+	}
+	if store.Exists("k") != 0 {
+		t.Error("Expected the deleted key not to exist")
+	}
+
+	// The old value is still readable before the delete, which is recorded
+	if value, found, _ := store.GetAt("k", beforeDelete); !found || value != "v1" {
+		t.Errorf("Expected v1 before the delete, got %q (%v)", value, found)
+	}
+	if _, found, _ := store.GetAt("k", time.Now().UnixMilli()); found {
+		t.Error("Expected nothing after the delete")
+	}
+	versions := store.History("k", 0)
+	if len(versions) != 2 || !versions[0].Deleted || versions[1].Data != "v1" {
+		t.Fatalf("Expected the delete on top of v1, got %+v", versions)
+	}
+	if versions[0].Seq != 2 || versions[1].Seq != 1 {
+		t.Errorf("Expected sequence numbers 2 and 1, got %d and %d", versions[0].Seq, versions[1].Seq)
+	}
+
+	// GETDEL records the delete too
+	store.Set("g", "v", 0)
+	if value, found, _ := store.GetDel("g"); !found || value != "v" {
+		t.Errorf("Expected GETDEL to return v, got %q (%v)", value, found)
+	}
+	if versions := store.History("g", 0); len(versions) != 2 || !versions[0].Deleted {
+		t.Errorf("Expected GETDEL to record the delete, got %+v", versions)
+	}
+
+	// PURGE erases the tombstone and a live key alike
+	if !store.Purge("k") || !store.Purge("g") {
+		t.Error("Expected PURGE to erase the tombstones")
+	}
+	if versions := store.History("k", 0); len(versions) != 0 {
+		t.Errorf("Expected PURGE to erase the history, got %+v", versions)
+	}
+	store.Set("live", "v", 0)
+	if !store.Purge("live") || store.Exists("live") != 0 || store.Purge("live") {
+		t.Error("Expected PURGE to erase a live key once")
+	}
+
+	// The recorded delete moves with the key
+	store.Set("moved", "v", 0)
+	store.Delete("moved")
+	store.Set("moved", "w", 0)
+	dump, _ := store.ExportKey("moved")
+	if len(dump.Versions) != 3 || !dump.Versions[1].Deleted {
+		t.Errorf("Expected the dump to carry the delete, got %+v", dump.Versions)
+	}
+}
+
+func TestStoreGetPublishedVersion(t *testing.T) {
+	s := NewStore()
+	defer s.Close()
+
+	// Every change of the latest version must reach lock-free readers
+	s.Set("k", "v1", 0)
+	s.Set("k", "v2", 0)
+	if value, _, _ := s.Get("k"); value != "v2" {
+		t.Errorf("Expected v2, got %q", value)
+	}
+	s.Expire("k", 1)
+	time.Sleep(5 * time.Millisecond)
+	if _, exists, _ := s.Get("k"); exists {
+		t.Error("Expected the expired key to be missing")
+	}
+
+	s.Set("k", "v3", 0)
+	s.Rename("k", "moved")
+	if _, exists, _ := s.Get("k"); exists {
+		t.Error("Expected the renamed key to be missing")
+	}
+	if value, _, _ := s.Get("moved"); value != "v3" {
+		t.Errorf("Expected the renamed key to be readable, got %q", value)
+	}
+	s.Delete("moved")
+	if _, exists, _ := s.Get("moved"); exists {
+		t.Error("Expected the deleted key to be missing")
+	}
+	s.Set("gone", "v", 0)
+	s.Purge("gone")
+	s.Flush()
+	if _, exists, _ := s.Get("gone"); exists {
+		t.Error("Expected the purged key to be missing")
+	}
+
+	// Readers racing writers see one of the written values
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				if value, exists, _ := s.Get("hot"); exists && !strings.HasPrefix(value, "v") {
+					t.Errorf("Unexpected value %q", value)
+					return
+				}
+			}
+		}()
+	}
+	for j := 0; j < 1000; j++ {
+		s.Set("hot", fmt.Sprintf("v%d", j), 0)
+	}
+	wg.Wait()
+}
+
+func BenchmarkStoreGetParallel(b *testing.B) {
+	s := NewStore()
+	defer s.Close()
+	for i := 0; i < 1024; i++ {
+		s.Set(fmt.Sprintf("key-%d", i), "value", 0)
+	}
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			s.Get(fmt.Sprintf("key-%d", i&1023))
+			i++
+		}
+	})
 }
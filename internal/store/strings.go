@@ -0,0 +1,190 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// MaxStringLength bounds the values APPEND and SETRANGE can build
+const MaxStringLength = 512 << 20
+
+// ErrStringTooLong is returned when a write would exceed MaxStringLength
+var ErrStringTooLong = errors.New("ERR string exceeds maximum allowed size (512MB)")
+
+// CompareAndSwap sets key to value only if its current value is expected,
+// and reports whether it did. A missing key never matches. The key keeps its
+// TTL, like SET KEEPTTL.
+func (s *Store) CompareAndSwap(key, expected, value string) (bool, error) {
+	result, err := s.SetWithOptions(key, value, SetOptions{Cond: SetIfEqual, Expected: expected, KeepTTL: true})
+	return result.Written, err
+}
+
+// CompareAndSwapVersion sets key to value only if its latest version has
+// the HLC version, as returned by GETMETA, and reports whether it did. A
+// version of 0 expects the key to be missing.
+func (s *Store) CompareAndSwapVersion(key string, version HLC, value string) (bool, error) {
+	result, err := s.SetWithOptions(key, value, SetOptions{Cond: SetIfVersion, Version: version, KeepTTL: true})
+	return result.Written, err
+}
+
+// Append appends suffix to the string stored at key, creating it if needed,
+// and returns the new length. The result is a new version.
+func (s *Store) Append(key, suffix string) (length int, err error) {
+	err = s.updateString(key, func(current string, exists bool) (string, bool, error) {
+		if len(current)+len(suffix) > MaxStringLength {
+			return "", false, ErrStringTooLong
+		}
+		length = len(current) + len(suffix)
+		return current + suffix, !exists || suffix != "", nil
+	})
+	return length, err
+}
+
+// SetRange overwrites the string stored at key starting at offset, padding
+// with zero bytes if the string is shorter, and returns the new length. The
+// result is a new version; an empty value leaves the key untouched.
+func (s *Store) SetRange(key string, offset int, value string) (length int, err error) {
+	if offset < 0 {
+		return 0, errors.New("ERR offset is out of range")
+	}
+	if offset+len(value) > MaxStringLength {
+		return 0, ErrStringTooLong
+	}
+
+	err = s.updateString(key, func(current string, exists bool) (string, bool, error) {
+		if value == "" {
+			length = len(current)
+			return current, false, nil
+		}
+
+		var b strings.Builder
+		b.Grow(max(len(current), offset+len(value)))
+		b.WriteString(current[:min(offset, len(current))])
+		for i := len(current); i < offset; i++ {
+			b.WriteByte(0)
+		}
+		b.WriteString(value)
+		if end := offset + len(value); end < len(current) {
+			b.WriteString(current[end:])
+		}
+		length = b.Len()
+		return b.String(), true, nil
+	})
+	return length, err
+}
+
+// GetRange returns the substring of the string stored at key between start
+// and end inclusive. Negative offsets count from the end of the string.
+func (s *Store) GetRange(key string, start, end int) (string, error) {
+	value, _, err := s.stringValue(key)
+	if err != nil {
+		return "", err
+	}
+
+	n := len(value)
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if end < 0 {
+		end = n + end
+	}
+	end = min(end, n-1)
+	if start > end || n == 0 {
+		return "", nil
+	}
+	return value[start : end+1], nil
+}
+
+// StrLen returns the length of the string stored at key, 0 if it is missing
+func (s *Store) StrLen(key string) (int, error) {
+	value, _, err := s.stringValue(key)
+	return len(value), err
+}
+
+// stringValue returns the current value of a string key
+func (s *Store) stringValue(key string) (string, bool, error) {
+	now := time.Now().UnixMilli()
+	shard := s.getShard(key)
+
+	shard.mu.RLock()
+	history, exists := shard.data[key]
+	shard.mu.RUnlock()
+
+	if !exists {
+		return "", false, nil
+	}
+
+	history.recordRead(now)
+
+	history.mu.RLock()
+	defer history.mu.RUnlock()
+
+	latest := history.latest(now)
+	if latest == nil {
+		s.expireLazily(key, history)
+		return "", false, nil
+	}
+	if latest.Type != TypeString {
+		return "", false, ErrWrongType
+	}
+	history.slide(now)
+	return latest.Data, true, nil
+}
+
+// updateString applies fn to the current value of a string key and, if fn
+// reports a change, stores the value it returns as a new version, keeping
+// the key's TTL. The new value goes through the validators and search
+// indexes like a SET.
+func (s *Store) updateString(key string, fn func(current string, exists bool) (string, bool, error)) (err error) {
+	s.run(key, func() { err = s.updateStringLocked(key, fn) })
+	return
+}
+
+func (s *Store) updateStringLocked(key string, fn func(current string, exists bool) (string, bool, error)) error {
+	now := time.Now().UnixMilli()
+	shard := s.getShard(key)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	var current *Value
+	if history, exists := shard.data[key]; exists {
+		history.mu.RLock()
+		current = history.latest(now)
+		history.mu.RUnlock()
+	}
+	if current != nil && current.Type != TypeString {
+		return ErrWrongType
+	}
+
+	var value string
+	var expiration int64
+	if current != nil {
+		value, expiration = current.Data, current.TTL
+	}
+
+	updated, changed, err := fn(value, current != nil)
+	if err != nil || !changed {
+		return err
+	}
+	if err := s.validate(key, updated); err != nil {
+		return err
+	}
+
+	if current == nil {
+		if ttl := s.defaultTTL(key); ttl > 0 {
+			s.defaultTTLsApplied.Add(1)
+			expiration = now + ttl
+			s.ttlWheel.Add(key, expiration)
+		}
+	}
+
+	s.appendVersion(shard, key, Value{
+		Data:      updated,
+		Timestamp: now,
+		TTL:       expiration,
+	})
+	s.indexWrite(key, updated)
+	return nil
+}
@@ -0,0 +1,187 @@
+package store
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestStoreStringRanges(t *testing.T) {
+	s := NewStore()
+	defer s.Close()
+
+	if n, err := s.Append("log", "hello"); err != nil || n != 5 {
+		t.Fatalf("Append = %d, %v", n, err)
+	}
+	s.Append("log", " world")
+	if n, _ := s.SetRange("log", 6, "there"); n != 11 {
+		t.Errorf("Expected length 11, got %d", n)
+	}
+	if value, _, _ := s.Get("log"); value != "hello there" {
+		t.Errorf("Unexpected value %q", value)
+	}
+	if n, _ := s.SetRange("pad", 3, "x"); n != 4 {
+		t.Errorf("Expected padding to length 4, got %d", n)
+	}
+	if value, _, _ := s.Get("pad"); value != "\x00\x00\x00x" {
+		t.Errorf("Unexpected padded value %q", value)
+	}
+
+	for _, tc := range []struct {
+		start, end int
+		want       string
+	}{{0, 4, "hello"}, {-5, -1, "there"}, {6, 100, "there"}, {5, 2, ""}} {
+		if got, _ := s.GetRange("log", tc.start, tc.end); got != tc.want {
+			t.Errorf("GetRange(%d, %d) = %q, want %q", tc.start, tc.end, got, tc.want)
+		}
+	}
+	if n, _ := s.StrLen("log"); n != 11 {
+		t.Errorf("Expected length 11, got %d", n)
+	}
+
+	// Every write is a new version
+	if history := s.History("log", 0); len(history) != 3 {
+		t.Errorf("Expected 3 versions, got %d", len(history))
+	}
+
+	s.SAdd("set", "a")
+	if _, err := s.Append("set", "x"); err != ErrWrongType {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+}
+
+func TestStoreTransfer(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.Set("alice", "100", 60_000)
+	src, dst, err := store.Transfer("alice", "bob", 30)
+	if err != nil || src != 70 || dst != 30 {
+		t.Fatalf("Expected balances 70 and 30, got %d and %d (%v)", src, dst, err)
+	}
+	if value, _, _ := store.Get("bob"); value != "30" {
+		t.Errorf("Expected bob to be created with 30, got %q", value)
+	}
+	if ttl := store.TTL("alice"); ttl <= 0 {
+		t.Errorf("Expected the transfer to keep the TTL of alice, got %d", ttl)
+	}
+
+	// A failed transfer writes nothing
+	if _, _, err := store.Transfer("alice", "bob", 71); err != ErrInsufficientBalance {
+		t.Errorf("Expected an insufficient balance, got %v", err)
+	}
+	if _, _, err := store.Transfer("missing", "bob", 1); err != ErrInsufficientBalance {
+		t.Errorf("Expected a missing source to have no balance, got %v", err)
+	}
+	store.Set("name", "x", 0)
+	if _, _, err := store.Transfer("alice", "name", 1); err != ErrNotInteger {
+		t.Errorf("Expected a non-integer destination to fail, got %v", err)
+	}
+	store.SAdd("set", "a")
+	if _, _, err := store.Transfer("set", "bob", 1); err != ErrWrongType {
+		t.Errorf("Expected a set source to fail, got %v", err)
+	}
+	for _, amount := range []int64{0, -5} {
+		if _, _, err := store.Transfer("alice", "bob", amount); err == nil {
+			t.Errorf("Expected amount %d to be rejected", amount)
+		}
+	}
+	if _, _, err := store.Transfer("alice", "alice", 1); err == nil {
+		t.Error("Expected a transfer to the same key to be rejected")
+	}
+	if value, _, _ := store.Get("alice"); value != "70" {
+		t.Errorf("Expected failed transfers to leave alice at 70, got %q", value)
+	}
+	store.Set("full", strconv.FormatInt(math.MaxInt64, 10), 0)
+	if _, _, err := store.Transfer("alice", "full", 1); err == nil {
+		t.Error("Expected an overflowing transfer to fail")
+	}
+
+	// Concurrent transfers in both directions keep the total
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func() { defer wg.Done(); store.Transfer("alice", "bob", 1) }()
+		go func() { defer wg.Done(); store.Transfer("bob", "alice", 1) }()
+	}
+	wg.Wait()
+	a, _, _ := store.Get("alice")
+	b, _, _ := store.Get("bob")
+	x, _ := strconv.Atoi(a)
+	y, _ := strconv.Atoi(b)
+	if x+y != 100 {
+		t.Errorf("Expected the total to stay 100, got %d + %d", x, y)
+	}
+}
+
+func TestStoreCompareAndSwap(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	if swapped, err := store.CompareAndSwap("lock", "", "owner-1"); err != nil || swapped {
+		t.Errorf("Expected CAS on a missing key to fail, got %v, %v", swapped, err)
+	}
+
+	store.Set("lock", "owner-1", 60000)
+	if swapped, _ := store.CompareAndSwap("lock", "owner-2", "owner-3"); swapped {
+		t.Error("Expected CAS with the wrong value to fail")
+	}
+	if swapped, err := store.CompareAndSwap("lock", "owner-1", "owner-2"); err != nil || !swapped {
+		t.Fatalf("Expected CAS with the current value to succeed, got %v, %v", swapped, err)
+	}
+	if value, _, _ := store.Get("lock"); value != "owner-2" {
+		t.Errorf("Expected owner-2, got %q", value)
+	}
+	if ttl := store.TTL("lock"); ttl <= 0 {
+		t.Errorf("Expected CAS to keep the TTL, got %d", ttl)
+	}
+
+	meta, _, _ := store.GetMeta("lock")
+	if swapped, _ := store.CompareAndSwapVersion("lock", meta.HLC-1, "stale"); swapped {
+		t.Error("Expected CAS with an old version to fail")
+	}
+	if swapped, err := store.CompareAndSwapVersion("lock", meta.HLC, "owner-3"); err != nil || !swapped {
+		t.Fatalf("Expected CAS with the current version to succeed, got %v, %v", swapped, err)
+	}
+	if swapped, _ := store.CompareAndSwapVersion("lock", meta.HLC, "owner-4"); swapped {
+		t.Error("Expected a second CAS with the same version to fail")
+	}
+	if swapped, err := store.CompareAndSwapVersion("fresh", 0, "v"); err != nil || !swapped {
+		t.Errorf("Expected CAS with version 0 to create a missing key, got %v, %v", swapped, err)
+	}
+
+	store.SAdd("set", "member")
+	if _, err := store.CompareAndSwap("set", "member", "v"); err != ErrWrongType {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+}
+
+func TestStoreCompareAndSwapConcurrent(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.Set("counter", "0", 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 50; n++ {
+				for {
+					current, _, _ := store.Get("counter")
+					value, _ := strconv.Atoi(current)
+					if swapped, _ := store.CompareAndSwap("counter", current, strconv.Itoa(value+1)); swapped {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if value, _, _ := store.Get("counter"); value != "400" {
+		t.Errorf("Expected 400 increments, got %s", value)
+	}
+}
@@ -0,0 +1,59 @@
+package store
+
+import "time"
+
+// TombstoneRetention is how long the history of a deleted or expired key is
+// kept under a count-based retention policy, which has no notion of age.
+// Under an age-based policy the history is kept until the delete or
+// expiration is older than the policy's age; under "all" it is kept until
+// the key is written again or purged.
+const TombstoneRetention = time.Hour
+
+// tombstoneExpired reports whether retention no longer keeps the history of
+// a deleted or expired key at now. The caller must hold the history lock.
+func (s *Store) tombstoneExpired(history *KeyHistory, now int64) bool {
+	if !history.tombstone.Load() || len(history.Versions) == 0 {
+		return false
+	}
+	last := &history.Versions[len(history.Versions)-1]
+	goneAt := last.TTL
+	if last.Deleted {
+		goneAt = last.Timestamp
+	}
+
+	policy := s.retentionOf(history)
+	switch policy.Kind {
+	case RetainAge:
+		return now-goneAt >= policy.Age.Milliseconds()
+	case RetainAll:
+		return false
+	default:
+		return now-goneAt >= TombstoneRetention.Milliseconds()
+	}
+}
+
+// dropTombstones removes the histories of keys that are still tombstones
+// retention no longer keeps, and returns the number of versions removed
+func (s *Store) dropTombstones(shard *Shard, keys []string, now int64) int {
+	removed := 0
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	for _, key := range keys {
+		history, exists := shard.data[key]
+		if !exists {
+			continue
+		}
+		// The key may have been written again since the first pass
+		history.mu.Lock()
+		if s.tombstoneExpired(history, now) {
+			shard.remove(key)
+			removed += len(history.Versions)
+			history.pruned.Add(int64(len(history.Versions)))
+			s.amplification.record(key, now, 0, len(history.Versions))
+		}
+		history.mu.Unlock()
+	}
+	return removed
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrNotInteger is returned when a counter does not hold an integer
+	ErrNotInteger = errors.New("ERR value is not an integer or out of range")
+
+	// ErrInsufficientBalance is returned when a transfer would take a
+	// counter below zero
+	ErrInsufficientBalance = errors.New("ERR insufficient balance")
+)
+
+// Transfer atomically moves amount from the integer counter at src to the
+// one at dst and returns both new balances. A missing counter is 0, so a
+// transfer creates dst but never src; it fails without writing anything if
+// src holds less than amount. Both writes are new versions keeping the
+// keys' TTLs, and a new dst gets the default TTL of its pattern.
+func (s *Store) Transfer(src, dst string, amount int64) (srcBalance, dstBalance int64, err error) {
+	if amount <= 0 {
+		return 0, 0, errors.New("ERR amount must be a positive integer")
+	}
+	if src == dst {
+		return 0, 0, errors.New("ERR source and destination must be different keys")
+	}
+
+	now := time.Now().UnixMilli()
+	unlock := s.lockShards(src, dst)
+	defer unlock()
+
+	srcBalance, srcTTL, _, err := s.counterLocked(src, now)
+	if err != nil {
+		return 0, 0, err
+	}
+	dstBalance, dstTTL, dstExists, err := s.counterLocked(dst, now)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if srcBalance < amount {
+		return 0, 0, ErrInsufficientBalance
+	}
+	if dstBalance > math.MaxInt64-amount {
+		return 0, 0, errors.New("ERR increment or decrement would overflow")
+	}
+	srcBalance -= amount
+	dstBalance += amount
+
+	srcValue, dstValue := strconv.FormatInt(srcBalance, 10), strconv.FormatInt(dstBalance, 10)
+	if err := s.validate(src, srcValue); err != nil {
+		return 0, 0, err
+	}
+	if err := s.validate(dst, dstValue); err != nil {
+		return 0, 0, err
+	}
+
+	if !dstExists {
+		if ttl := s.defaultTTL(dst); ttl > 0 {
+			s.defaultTTLsApplied.Add(1)
+			dstTTL = now + ttl
+			s.ttlWheel.Add(dst, dstTTL)
+		}
+	}
+
+	// One HLC for both versions, so no snapshot sees half a transfer
+	at := s.clock.Now()
+	s.appendVersion(s.getShard(src), src, Value{Data: srcValue, Timestamp: now, TTL: srcTTL, HLC: at})
+	s.appendVersion(s.getShard(dst), dst, Value{Data: dstValue, Timestamp: now, TTL: dstTTL, HLC: at})
+	s.indexWrite(src, srcValue)
+	s.indexWrite(dst, dstValue)
+	return srcBalance, dstBalance, nil
+}
+
+// counterLocked returns the integer stored at key, 0 if the key is missing,
+// with its expiration. The caller must hold the shard lock.
+func (s *Store) counterLocked(key string, now int64) (balance, ttl int64, exists bool, err error) {
+	history, found := s.getShard(key).data[key]
+	if !found {
+		return 0, 0, false, nil
+	}
+
+	history.mu.RLock()
+	defer history.mu.RUnlock()
+
+	latest := history.latest(now)
+	if latest == nil {
+		return 0, 0, false, nil
+	}
+	if latest.Type != TypeString {
+		return 0, 0, false, ErrWrongType
+	}
+	balance, err = strconv.ParseInt(latest.Data, 10, 64)
+	if err != nil {
+		return 0, 0, false, ErrNotInteger
+	}
+	return balance, latest.TTL, true, nil
+}
@@ -1,48 +1,247 @@
 package store
 
 import (
+	"sort"
 	"sync"
+	"time"
 )
 
-// TTLWheel implements a timing wheel for efficient TTL management
+const (
+	wheelTick   = 100 // Milliseconds per slot of the first level
+	wheelBits   = 6
+	wheelSlots  = 1 << wheelBits // Slots per level
+	wheelLevels = 4              // The last level spans about 19 days
+
+	wheelDue      = -1          // Level of keys that have come due
+	wheelOverflow = wheelLevels // Level of keys beyond the last one
+)
+
+// wheelEntry locates a key in the wheel
+type wheelEntry struct {
+	expiration int64
+	level      int
+	slot       int
+}
+
+// TTLWheel is a hierarchical timing wheel of key expirations. Each level
+// has wheelSlots slots, each spanning wheelSlots times the slots of the
+// level below; keys further out than the last level wait in an overflow
+// slot. As time advances, the slots of an upper level are cascaded into
+// the lower ones, and keys whose expiration has passed move to the due
+// set, so adding or removing a key is O(1) and advancing costs the elapsed
+// ticks plus the keys it moves.
 type TTLWheel struct {
-	entries map[string]int64 // key -> expiration timestamp
-	mu      sync.RWMutex
+	mu       sync.Mutex
+	entries  map[string]*wheelEntry
+	levels   [wheelLevels][wheelSlots]map[string]struct{}
+	overflow map[string]struct{}
+	due      map[string]struct{}
+	tick     int64 // Last tick advanced to
 }
 
 // NewTTLWheel creates a new TTL wheel
 func NewTTLWheel() *TTLWheel {
 	return &TTLWheel{
-		entries: make(map[string]int64),
+		entries:  make(map[string]*wheelEntry),
+		overflow: make(map[string]struct{}),
+		due:      make(map[string]struct{}),
+		tick:     time.Now().UnixMilli() / wheelTick,
 	}
 }
 
-// Add adds a key with expiration timestamp
+// Add adds a key with expiration timestamp, replacing any previous one
 func (tw *TTLWheel) Add(key string, expiration int64) {
 	tw.mu.Lock()
 	defer tw.mu.Unlock()
-	tw.entries[key] = expiration
+
+	tw.remove(key)
+	entry := &wheelEntry{expiration: expiration}
+	tw.entries[key] = entry
+	tw.place(key, entry)
 }
 
 // Remove removes a key from the TTL wheel
 func (tw *TTLWheel) Remove(key string) {
 	tw.mu.Lock()
 	defer tw.mu.Unlock()
+	tw.remove(key)
+}
+
+func (tw *TTLWheel) remove(key string) {
+	entry, exists := tw.entries[key]
+	if !exists {
+		return
+	}
+	delete(tw.slot(entry.level, entry.slot), key)
 	delete(tw.entries, key)
 }
 
-// GetExpired returns keys that have expired before the given timestamp
-func (tw *TTLWheel) GetExpired(now int64) []string {
+// place puts a key into the slot covering its expiration. Keys expiring
+// before the current tick are due right away; keys expiring within it go
+// into its slot, which is scanned again on every advance.
+func (tw *TTLWheel) place(key string, entry *wheelEntry) {
+	expTick := entry.expiration / wheelTick
+	delta := expTick - tw.tick
+
+	entry.level, entry.slot = wheelOverflow, 0
+	switch {
+	case delta < 0:
+		entry.level = wheelDue
+	default:
+		for level := 0; level < wheelLevels; level++ {
+			if delta < int64(1)<<(wheelBits*(level+1)) {
+				entry.level = level
+				entry.slot = int(expTick>>(wheelBits*level)) & (wheelSlots - 1)
+				break
+			}
+		}
+	}
+
+	slot := tw.slot(entry.level, entry.slot)
+	if slot == nil {
+		slot = make(map[string]struct{})
+		tw.levels[entry.level][entry.slot] = slot
+	}
+	slot[key] = struct{}{}
+}
+
+// slot returns the keys of a slot, nil for an empty slot of a level
+func (tw *TTLWheel) slot(level, slot int) map[string]struct{} {
+	switch level {
+	case wheelDue:
+		return tw.due
+	case wheelOverflow:
+		return tw.overflow
+	default:
+		return tw.levels[level][slot]
+	}
+}
+
+// advance moves the wheel to now, cascading upper levels at their slot
+// boundaries and moving the keys that have expired by now to the due set
+func (tw *TTLWheel) advance(now int64) {
+	nowTick := now / wheelTick
+	for tick := tw.tick; tick <= nowTick; tick++ {
+		if tick > tw.tick {
+			tw.cascade(tick)
+		}
+
+		slot := tw.levels[0][int(tick)&(wheelSlots-1)]
+		for key := range slot {
+			entry := tw.entries[key]
+			if entry.expiration > now {
+				continue
+			}
+			delete(slot, key)
+			entry.level, entry.slot = wheelDue, 0
+			tw.due[key] = struct{}{}
+		}
+	}
+	tw.tick = max(tw.tick, nowTick)
+}
+
+// cascade re-places the keys of the upper slots beginning at tick, top down
+func (tw *TTLWheel) cascade(tick int64) {
+	if tick&(int64(1)<<(wheelBits*wheelLevels)-1) == 0 && len(tw.overflow) > 0 {
+		overflow := tw.overflow
+		tw.overflow = make(map[string]struct{})
+		tw.replace(overflow, tick)
+	}
+	for level := wheelLevels - 1; level > 0; level-- {
+		if tick&(int64(1)<<(wheelBits*level)-1) != 0 {
+			continue
+		}
+		index := int(tick>>(wheelBits*level)) & (wheelSlots - 1)
+		if slot := tw.levels[level][index]; len(slot) > 0 {
+			tw.levels[level][index] = nil
+			tw.replace(slot, tick)
+		}
+	}
+}
+
+// replace re-places the keys of a detached slot relative to tick
+func (tw *TTLWheel) replace(slot map[string]struct{}, tick int64) {
+	current := tw.tick
+	tw.tick = tick
+	for key := range slot {
+		tw.place(key, tw.entries[key])
+	}
+	tw.tick = current
+}
+
+// GetExpired returns up to limit keys that have expired before the given
+// timestamp (all of them if limit is negative) and removes them from the
+// wheel, along with the number of expired keys left behind
+func (tw *TTLWheel) GetExpired(now int64, limit int) (expired []string, remaining int) {
 	tw.mu.Lock()
 	defer tw.mu.Unlock()
 
-	var expired []string
-	for key, expiration := range tw.entries {
-		if now >= expiration {
-			expired = append(expired, key)
-			delete(tw.entries, key)
+	tw.advance(now)
+	for key := range tw.due {
+		if limit >= 0 && len(expired) >= limit {
+			break
 		}
+		expired = append(expired, key)
+		delete(tw.due, key)
+		delete(tw.entries, key)
 	}
 
-	return expired
+	return expired, len(tw.due)
+}
+
+// Len returns the number of keys scheduled in the wheel, including the
+// due ones not yet expired
+func (tw *TTLWheel) Len() int {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return len(tw.entries)
+}
+
+// Expiration is a key scheduled in the TTL wheel
+type Expiration struct {
+	Key       string
+	ExpiresAt int64 // Unix milliseconds
+
+	// Stale entries no longer match the key's TTL because the key was
+	// written again without one; they expire nothing when they come due
+	Stale bool
+}
+
+// Entries returns the keys matching pattern and their expiration, soonest first
+func (tw *TTLWheel) Entries(pattern string) []Expiration {
+	tw.mu.Lock()
+	entries := make([]Expiration, 0, len(tw.entries))
+	for key, entry := range tw.entries {
+		if pattern == "" || MatchPattern(pattern, key) {
+			entries = append(entries, Expiration{Key: key, ExpiresAt: entry.expiration})
+		}
+	}
+	tw.mu.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].ExpiresAt != entries[j].ExpiresAt {
+			return entries[i].ExpiresAt < entries[j].ExpiresAt
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	return entries
+}
+
+// Expirations returns the keys matching pattern scheduled to expire,
+// soonest first, flagging entries that no longer match their key's TTL
+func (s *Store) Expirations(pattern string) []Expiration {
+	entries := s.ttlWheel.Entries(pattern)
+	for i := range entries {
+		entries[i].Stale = s.expiresAt(entries[i].Key) != entries[i].ExpiresAt
+	}
+	return entries
+}
+
+// expiresAt returns when the latest version of key expires, 0 if it does not
+func (s *Store) expiresAt(key string) int64 {
+	latest, exists := s.finalVersion(key)
+	if !exists {
+		return 0
+	}
+	return latest.TTL
 }
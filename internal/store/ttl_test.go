@@ -0,0 +1,79 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func TestTTLWheel(t *testing.T) {
+	tw := NewTTLWheel()
+	start := tw.tick * wheelTick
+
+	// One key per level, one in overflow and one already due
+	offsets := map[string]int64{
+		"past":     -5 * wheelTick,
+		"level0":   3 * wheelTick,
+		"level1":   500 * wheelTick,
+		"level2":   100_000 * wheelTick,
+		"level3":   10_000_000 * wheelTick,
+		"overflow": 20_000_000 * wheelTick,
+	}
+	for key, offset := range offsets {
+		tw.Add(key, start+offset)
+	}
+	if level := tw.entries["level2"].level; level != 2 {
+		t.Errorf("Expected level2 on level 2, got %d", level)
+	}
+	if level := tw.entries["overflow"].level; level != wheelOverflow {
+		t.Errorf("Expected overflow beyond the last level, got %d", level)
+	}
+
+	expect := func(now int64, want ...string) {
+		t.Helper()
+		got, _ := tw.GetExpired(now, -1)
+		sort.Strings(got)
+		sort.Strings(want)
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("At +%d ticks expected %v, got %v", (now-start)/wheelTick, want, got)
+		}
+	}
+
+	expect(start, "past")
+	expect(start + 3*wheelTick - 1)
+	expect(start+3*wheelTick, "level0")
+	expect(start + 499*wheelTick)
+	expect(start+500*wheelTick, "level1")
+
+	// Removed and re-added keys move
+	tw.Remove("level2")
+	tw.Add("level3", start+600*wheelTick)
+	expect(start+600*wheelTick, "level3")
+	expect(start + 100_000*wheelTick)
+
+	expect(start+20_000_000*wheelTick, "overflow")
+	if len(tw.entries) != 0 {
+		t.Errorf("Expected an empty wheel, got %d entries", len(tw.entries))
+	}
+}
+
+func TestTTLWheelLimit(t *testing.T) {
+	tw := NewTTLWheel()
+	now := tw.tick * wheelTick
+	for i := 0; i < 10; i++ {
+		tw.Add(fmt.Sprintf("k%d", i), now+int64(i))
+	}
+	tw.Add("later", now+wheelTick)
+
+	expired, remaining := tw.GetExpired(now+wheelTick-1, 4)
+	if len(expired) != 4 || remaining != 6 {
+		t.Errorf("Expected 4 keys and 6 left, got %v and %d", expired, remaining)
+	}
+	expired, remaining = tw.GetExpired(now+wheelTick-1, -1)
+	if len(expired) != 6 || remaining != 0 {
+		t.Errorf("Expected the 6 keys left, got %v and %d", expired, remaining)
+	}
+	if entries := tw.Entries(""); len(entries) != 1 || entries[0].Key != "later" {
+		t.Errorf("Expected only the later key scheduled, got %+v", entries)
+	}
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Validator checks a value before it is written to a key
+type Validator interface {
+	Validate(key, value string) error
+}
+
+// ValidationError is returned when a write is rejected by a validator
+type ValidationError struct {
+	Pattern string
+	Err     error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("ERR validation failed for pattern '%s': %v", e.Pattern, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// SetValidator registers a validator for keys matching pattern, replacing
+// any validator previously registered for the same pattern
+func (s *Store) SetValidator(pattern string, v Validator) {
+	s.validatorsMu.Lock()
+	defer s.validatorsMu.Unlock()
+	s.validators[pattern] = v
+}
+
+// RemoveValidator unregisters the validator for pattern
+func (s *Store) RemoveValidator(pattern string) bool {
+	s.validatorsMu.Lock()
+	defer s.validatorsMu.Unlock()
+
+	if _, exists := s.validators[pattern]; !exists {
+		return false
+	}
+	delete(s.validators, pattern)
+	return true
+}
+
+// ValidatorPatterns returns the patterns that have a validator, sorted
+func (s *Store) ValidatorPatterns() []string {
+	s.validatorsMu.RLock()
+	defer s.validatorsMu.RUnlock()
+
+	patterns := make([]string, 0, len(s.validators))
+	for pattern := range s.validators {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	return patterns
+}
+
+// Validator returns the validator registered for pattern
+func (s *Store) Validator(pattern string) (Validator, bool) {
+	s.validatorsMu.RLock()
+	defer s.validatorsMu.RUnlock()
+
+	v, exists := s.validators[pattern]
+	return v, exists
+}
+
+// validate runs every validator whose pattern matches key
+func (s *Store) validate(key, value string) error {
+	s.validatorsMu.RLock()
+	defer s.validatorsMu.RUnlock()
+
+	for pattern, v := range s.validators {
+		if !MatchPattern(pattern, key) {
+			continue
+		}
+		if err := v.Validate(key, value); err != nil {
+			return &ValidationError{Pattern: pattern, Err: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"strings"
+	"time"
+)
+
+// WorkingSetInterval is how often the background process estimates the
+// working set
+const WorkingSetInterval = time.Minute
+
+// WorkingSetWindows are the windows the working set is estimated over
+var WorkingSetWindows = []time.Duration{time.Minute, 5 * time.Minute, time.Hour}
+
+// WorkingSet is the part of the keyspace read or written within a window
+type WorkingSet struct {
+	Window time.Duration
+	Keys   int
+	Bytes  int64
+}
+
+// Label renders the window compactly, e.g. 5m or 1h
+func (w WorkingSet) Label() string {
+	label := strings.TrimSuffix(w.Window.String(), "0s")
+	if strings.HasSuffix(label, "h0m") {
+		label = strings.TrimSuffix(label, "0m")
+	}
+	return label
+}
+
+// WorkingSetEstimate splits the keyspace into the keys accessed within each
+// of WorkingSetWindows and the rest, by the last access of every key
+type WorkingSetEstimate struct {
+	At      int64 // Unix milliseconds when the estimate was taken
+	Keys    int   // Live keys
+	Bytes   int64 // Approximate bytes held by live keys, all versions included
+	Windows []WorkingSet
+}
+
+// Cold returns the keys and bytes not accessed within the longest window
+func (e WorkingSetEstimate) Cold() (keys int, bytes int64) {
+	if len(e.Windows) == 0 {
+		return e.Keys, e.Bytes
+	}
+	hot := e.Windows[len(e.Windows)-1]
+	return e.Keys - hot.Keys, e.Bytes - hot.Bytes
+}
+
+// WorkingSet returns the latest estimate of the background process, taking
+// one now if there is none yet
+func (s *Store) WorkingSet() WorkingSetEstimate {
+	if estimate := s.workingSet.Load(); estimate != nil {
+		return *estimate
+	}
+	return s.estimateWorkingSet(time.Now().UnixMilli())
+}
+
+// estimateWorkingSet walks the keyspace, sizing every live key like STATS
+// KEY, and stores the result for WorkingSet
+func (s *Store) estimateWorkingSet(now int64) WorkingSetEstimate {
+	estimate := WorkingSetEstimate{
+		At:      now,
+		Windows: make([]WorkingSet, len(WorkingSetWindows)),
+	}
+	for i, window := range WorkingSetWindows {
+		estimate.Windows[i].Window = window
+	}
+
+	for _, shard := range s.shards {
+		shard.mu.RLock()
+		for key, history := range shard.data {
+			history.mu.RLock()
+			if history.latest(now) != nil {
+				bytes := int64(len(key))
+				for i := range history.Versions {
+					bytes += history.Versions[i].size()
+				}
+				estimate.Keys++
+				estimate.Bytes += bytes
+
+				idle := now - history.lastAccess.Load()
+				for i, window := range WorkingSetWindows {
+					if idle <= window.Milliseconds() {
+						estimate.Windows[i].Keys++
+						estimate.Windows[i].Bytes += bytes
+					}
+				}
+			}
+			history.mu.RUnlock()
+		}
+		shard.mu.RUnlock()
+	}
+
+	s.workingSet.Store(&estimate)
+	return estimate
+}
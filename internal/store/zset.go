@@ -0,0 +1,196 @@
+package store
+
+import (
+	"time"
+)
+
+// ZAdd adds members to the sorted set stored at key, updating the scores of
+// existing members. It returns the number of members newly added.
+func (s *Store) ZAdd(key string, members ...ZMember) (added int, err error) {
+	s.run(key, func() { added, err = s.zAdd(key, members) })
+	return
+}
+
+func (s *Store) zAdd(key string, members []ZMember) (int, error) {
+	now := time.Now().UnixMilli()
+	shard := s.getShard(key)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if history, exists := shard.data[key]; exists {
+		history.mu.Lock()
+		latest := history.latest(now)
+		if latest != nil {
+			defer history.mu.Unlock()
+			if latest.Type != TypeZSet {
+				return 0, ErrWrongType
+			}
+			// Sorted sets are mutated in place rather than versioned per member
+			history.recordWrite(now)
+			s.publish(Event{Type: EventSet, Key: key, ValueType: TypeZSet, Timestamp: now})
+			return addZMembers(latest.ZSet, members), nil
+		}
+		history.mu.Unlock()
+	}
+
+	zset := NewSortedSet()
+	added := addZMembers(zset, members)
+
+	s.appendVersion(shard, key, Value{
+		Type:      TypeZSet,
+		ZSet:      zset,
+		Timestamp: now,
+	})
+	return added, nil
+}
+
+// addZMembers adds members to zset and returns how many were new
+func addZMembers(zset *SortedSet, members []ZMember) int {
+	added := 0
+	for _, m := range members {
+		if zset.Add(m.Member, m.Score) {
+			added++
+		}
+	}
+	return added
+}
+
+// ZRem removes members from the sorted set stored at key. The key is deleted
+// once the sorted set becomes empty. It returns the number of members removed.
+func (s *Store) ZRem(key string, members ...string) (removed int, err error) {
+	s.run(key, func() { removed, err = s.zRem(key, members) })
+	return
+}
+
+func (s *Store) zRem(key string, members []string) (int, error) {
+	now := time.Now().UnixMilli()
+	shard := s.getShard(key)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	history, exists := shard.data[key]
+	if !exists {
+		return 0, nil
+	}
+
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	latest := history.latest(now)
+	if latest == nil {
+		return 0, nil
+	}
+	if latest.Type != TypeZSet {
+		return 0, ErrWrongType
+	}
+	history.recordWrite(now)
+
+	removed := 0
+	for _, member := range members {
+		if latest.ZSet.Remove(member) {
+			removed++
+		}
+	}
+
+	if latest.ZSet.Len() == 0 {
+		s.markDeleted(key, history, now)
+	} else if removed > 0 {
+		s.publish(Event{Type: EventSet, Key: key, ValueType: TypeZSet, Timestamp: now})
+	}
+
+	return removed, nil
+}
+
+// ZScore returns the score of member in the sorted set stored at key
+func (s *Store) ZScore(key, member string) (float64, bool, error) {
+	var score float64
+	var found bool
+	err := s.viewZSet(key, func(zset *SortedSet) {
+		if zset != nil {
+			score, found = zset.Score(member)
+		}
+	})
+	return score, found, err
+}
+
+// ZRank returns the 0-based rank of member ordered by ascending score
+func (s *Store) ZRank(key, member string) (int, bool, error) {
+	var rank int
+	var found bool
+	err := s.viewZSet(key, func(zset *SortedSet) {
+		if zset != nil {
+			rank, found = zset.Rank(member)
+		}
+	})
+	return rank, found, err
+}
+
+// ZCard returns the number of members in the sorted set stored at key
+func (s *Store) ZCard(key string) (int, error) {
+	var count int
+	err := s.viewZSet(key, func(zset *SortedSet) {
+		if zset != nil {
+			count = zset.Len()
+		}
+	})
+	return count, err
+}
+
+// ZRange returns the members between the start and stop ranks (inclusive)
+func (s *Store) ZRange(key string, start, stop int) ([]ZMember, error) {
+	result := []ZMember{}
+	err := s.viewZSet(key, func(zset *SortedSet) {
+		if zset != nil {
+			result = zset.Range(start, stop)
+		}
+	})
+	return result, err
+}
+
+// ZRangeByScore returns the members with scores between min and max, applying
+// an optional offset and count (count < 0 returns all matches)
+func (s *Store) ZRangeByScore(key string, min, max ScoreBound, offset, count int) ([]ZMember, error) {
+	result := []ZMember{}
+	err := s.viewZSet(key, func(zset *SortedSet) {
+		if zset != nil {
+			result = zset.RangeByScore(min, max, offset, count)
+		}
+	})
+	return result, err
+}
+
+// viewZSet calls fn with the live sorted set stored at key while holding its
+// read lock. A missing key is passed as nil.
+func (s *Store) viewZSet(key string, fn func(zset *SortedSet)) error {
+	now := time.Now().UnixMilli()
+	shard := s.getShard(key)
+
+	shard.mu.RLock()
+	history, exists := shard.data[key]
+	shard.mu.RUnlock()
+
+	if !exists {
+		fn(nil)
+		return nil
+	}
+
+	history.recordRead(now)
+	history.mu.RLock()
+	defer history.mu.RUnlock()
+
+	latest := history.latest(now)
+	if latest == nil {
+		s.expireLazily(key, history)
+		fn(nil)
+		return nil
+	}
+	if latest.Type != TypeZSet {
+		return ErrWrongType
+	}
+	history.slide(now)
+
+	fn(latest.ZSet)
+	return nil
+}
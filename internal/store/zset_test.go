@@ -0,0 +1,116 @@
+package store
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSortedSetOrdering(t *testing.T) {
+	zset := NewSortedSet()
+
+	// Insert in reverse order with ties broken by member name
+	for i := 99; i >= 0; i-- {
+		zset.Add(fmt.Sprintf("m%02d", i), float64(i/2))
+	}
+
+	if zset.Len() != 100 {
+		t.Fatalf("Expected 100 members, got %d", zset.Len())
+	}
+
+	all := zset.Members()
+	for i, m := range all {
+		if m.Member != fmt.Sprintf("m%02d", i) {
+			t.Fatalf("Expected member m%02d at rank %d, got %s", i, i, m.Member)
+		}
+		rank, ok := zset.Rank(m.Member)
+		if !ok || rank != i {
+			t.Fatalf("Expected rank %d for %s, got %d", i, m.Member, rank)
+		}
+	}
+
+	// Updating a score moves the member
+	zset.Add("m00", 1000)
+	if rank, _ := zset.Rank("m00"); rank != 99 {
+		t.Errorf("Expected m00 to move to rank 99, got %d", rank)
+	}
+
+	if !zset.Remove("m50") || zset.Remove("m50") {
+		t.Error("Expected m50 to be removed exactly once")
+	}
+	if rank, _ := zset.Rank("m51"); rank != 49 {
+		t.Errorf("Expected m51 at rank 49 after removal, got %d", rank)
+	}
+}
+
+func TestStoreZSetRanges(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	added, err := store.ZAdd("board",
+		ZMember{Member: "alice", Score: 30},
+		ZMember{Member: "bob", Score: 10},
+		ZMember{Member: "carol", Score: 20},
+	)
+	if err != nil || added != 3 {
+		t.Fatalf("Expected 3 members added, got %d (err: %v)", added, err)
+	}
+
+	members, _ := store.ZRange("board", 0, -1)
+	if len(members) != 3 || members[0].Member != "bob" || members[2].Member != "alice" {
+		t.Errorf("Unexpected ZRange result: %v", members)
+	}
+
+	members, _ = store.ZRange("board", -2, -1)
+	if len(members) != 2 || members[0].Member != "carol" {
+		t.Errorf("Unexpected ZRange with negative indexes: %v", members)
+	}
+
+	members, _ = store.ZRangeByScore("board",
+		ScoreBound{Value: 10, Exclusive: true}, ScoreBound{Value: math.Inf(1)}, 0, -1)
+	if len(members) != 2 || members[0].Member != "carol" {
+		t.Errorf("Unexpected ZRangeByScore result: %v", members)
+	}
+
+	members, _ = store.ZRangeByScore("board",
+		ScoreBound{Value: math.Inf(-1)}, ScoreBound{Value: math.Inf(1)}, 1, 1)
+	if len(members) != 1 || members[0].Member != "carol" {
+		t.Errorf("Unexpected ZRangeByScore with LIMIT: %v", members)
+	}
+
+	score, found, _ := store.ZScore("board", "alice")
+	if !found || score != 30 {
+		t.Errorf("Expected alice score 30, got %v (found: %t)", score, found)
+	}
+
+	rank, found, _ := store.ZRank("board", "carol")
+	if !found || rank != 1 {
+		t.Errorf("Expected carol rank 1, got %d (found: %t)", rank, found)
+	}
+
+	removed, _ := store.ZRem("board", "bob", "nobody")
+	if removed != 1 {
+		t.Errorf("Expected 1 member removed, got %d", removed)
+	}
+
+	store.Set("str", "value", 0)
+	if _, err := store.ZAdd("str", ZMember{Member: "a", Score: 1}); err != ErrWrongType {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+}
+
+func TestStoreZSetWrongType(t *testing.T) {
+	store := NewStore()
+	defer store.Close()
+
+	store.ZAdd("z", ZMember{Member: "a", Score: 1})
+
+	// Sorted sets are not read as strings, now or in the past
+	if _, _, err := store.Get("z"); err != ErrWrongType {
+		t.Errorf("Expected ErrWrongType from Get, got %v", err)
+	}
+	if _, _, err := store.GetAt("z", time.Now().UnixMilli()); err != ErrWrongType {
+		t.Errorf("Expected ErrWrongType from GetAt, got %v", err)
+	}
+}
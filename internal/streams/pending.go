@@ -0,0 +1,284 @@
+package streams
+
+import (
+	"sort"
+	"time"
+)
+
+// PendingEntry is an entry delivered to a consumer of a group and not
+// acknowledged yet. Entries a consumer never acknowledges, e.g. because it
+// died, stay pending until another consumer claims them.
+type PendingEntry struct {
+	ID            string
+	Consumer      string
+	DeliveredAt   int64 // Unix milliseconds of the last delivery
+	DeliveryCount int
+}
+
+// Idle returns how long ago the entry was last delivered
+func (p PendingEntry) Idle(now time.Time) time.Duration {
+	return time.Duration(now.UnixMilli()-p.DeliveredAt) * time.Millisecond
+}
+
+// PendingSummary summarizes the pending entries list of a group
+type PendingSummary struct {
+	Count     int
+	Lowest    string         // Smallest pending ID, empty if none are pending
+	Highest   string         // Largest pending ID, empty if none are pending
+	Consumers map[string]int // Pending entries per consumer with any
+}
+
+// PendingFilter selects pending entries; the zero value selects all of them
+type PendingFilter struct {
+	Start    string // Smallest ID, empty for no bound
+	End      string // Largest ID, empty for no bound
+	Count    int    // Maximum entries, 0 for no limit
+	Consumer string // Only entries of this consumer
+	MinIdle  time.Duration
+}
+
+// lockGroup finds a consumer group and locks it, with its stream read
+// locked so entries can be looked up. Call unlock when done.
+func (sm *StreamManager) lockGroup(streamName, groupName string) (stream *Stream, group *ConsumerGroup, unlock func(), err error) {
+	sm.mu.RLock()
+	stream, exists := sm.streams[streamName]
+	if !exists {
+		sm.mu.RUnlock()
+		return nil, nil, nil, ErrNoGroup
+	}
+	stream.mu.RLock()
+	sm.mu.RUnlock()
+
+	group, exists = stream.Groups[groupName]
+	if !exists {
+		stream.mu.RUnlock()
+		return nil, nil, nil, ErrNoGroup
+	}
+	group.mu.Lock()
+	return stream, group, func() {
+		group.mu.Unlock()
+		stream.mu.RUnlock()
+	}, nil
+}
+
+// consumer returns a consumer of the group, creating it if needed, and
+// marks it as seen
+func (g *ConsumerGroup) consumer(name, groupName string, now int64) *Consumer {
+	c, exists := g.Consumers[name]
+	if !exists {
+		c = &Consumer{Name: name, Group: groupName}
+		g.Consumers[name] = c
+	}
+	c.LastSeen = now / 1000
+	return c
+}
+
+// deliver records the delivery of an entry to a consumer in the pending
+// entries list, moving it from its previous owner. count tells whether the
+// delivery count is bumped.
+func (g *ConsumerGroup) deliver(id, consumer string, now int64, count bool) {
+	p, exists := g.Pending[id]
+	if !exists {
+		p = &PendingEntry{ID: id, Consumer: consumer}
+		g.Pending[id] = p
+		g.Consumers[consumer].PendingCount++
+	} else if p.Consumer != consumer {
+		g.release(p)
+		p.Consumer = consumer
+		g.Consumers[consumer].PendingCount++
+	}
+	p.DeliveredAt = now
+	if count {
+		p.DeliveryCount++
+	}
+}
+
+// release takes a pending entry off the count of its consumer
+func (g *ConsumerGroup) release(p *PendingEntry) {
+	if c, exists := g.Consumers[p.Consumer]; exists {
+		c.PendingCount--
+	}
+}
+
+// sortedPending returns the pending entries in ID order
+func (g *ConsumerGroup) sortedPending() []*PendingEntry {
+	pending := make([]*PendingEntry, 0, len(g.Pending))
+	for _, p := range g.Pending {
+		pending = append(pending, p)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return compareIDs(pending[i].ID, pending[j].ID) < 0
+	})
+	return pending
+}
+
+// ReadPending returns up to count entries pending for a consumer with an
+// ID greater than afterID, so a restarted consumer can process again what
+// it had read but not acknowledged. Entries no longer in the stream are
+// returned with nil fields. Delivery counts are left unchanged.
+func (sm *StreamManager) ReadPending(streamName, groupName, consumerName, afterID string, count int) ([]StreamEntry, error) {
+	stream, group, unlock, err := sm.lockGroup(streamName, groupName)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	group.consumer(consumerName, groupName, time.Now().UnixMilli())
+
+	var result []StreamEntry
+	for _, p := range group.sortedPending() {
+		if len(result) >= count {
+			break
+		}
+		if p.Consumer != consumerName || compareIDs(p.ID, afterID) <= 0 {
+			continue
+		}
+		entry, exists := stream.entry(p.ID)
+		if !exists {
+			entry = StreamEntry{ID: p.ID}
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// Ack acknowledges entries, removing them from the pending entries list of
+// the group. It returns the number of entries that were pending.
+func (sm *StreamManager) Ack(streamName, groupName string, ids []string) (int, error) {
+	_, group, unlock, err := sm.lockGroup(streamName, groupName)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	acked := 0
+	for _, id := range ids {
+		if p, exists := group.Pending[id]; exists {
+			group.release(p)
+			delete(group.Pending, id)
+			acked++
+		}
+	}
+	return acked, nil
+}
+
+// Pending summarizes the pending entries list of a group
+func (sm *StreamManager) Pending(streamName, groupName string) (PendingSummary, error) {
+	_, group, unlock, err := sm.lockGroup(streamName, groupName)
+	if err != nil {
+		return PendingSummary{}, err
+	}
+	defer unlock()
+
+	summary := PendingSummary{Count: len(group.Pending), Consumers: make(map[string]int)}
+	for id, p := range group.Pending {
+		if summary.Lowest == "" || compareIDs(id, summary.Lowest) < 0 {
+			summary.Lowest = id
+		}
+		if summary.Highest == "" || compareIDs(id, summary.Highest) > 0 {
+			summary.Highest = id
+		}
+		summary.Consumers[p.Consumer]++
+	}
+	return summary, nil
+}
+
+// PendingRange lists the pending entries of a group selected by filter, in
+// ID order
+func (sm *StreamManager) PendingRange(streamName, groupName string, filter PendingFilter) ([]PendingEntry, error) {
+	_, group, unlock, err := sm.lockGroup(streamName, groupName)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	now := time.Now()
+	var result []PendingEntry
+	for _, p := range group.sortedPending() {
+		if filter.Count > 0 && len(result) >= filter.Count {
+			break
+		}
+		switch {
+		case filter.Start != "" && compareIDs(p.ID, filter.Start) < 0,
+			filter.End != "" && compareIDs(p.ID, filter.End) > 0,
+			filter.Consumer != "" && p.Consumer != filter.Consumer,
+			p.Idle(now) < filter.MinIdle:
+			continue
+		}
+		result = append(result, *p)
+	}
+	return result, nil
+}
+
+// Claim transfers pending entries idle for at least minIdle to a consumer,
+// e.g. to recover the entries of a consumer that died. IDs not pending or
+// not idle long enough are ignored, and entries no longer in the stream are
+// dropped from the pending entries list. Each claimed entry is delivered
+// again, bumping its delivery count unless justID is set.
+func (sm *StreamManager) Claim(streamName, groupName, consumerName string, minIdle time.Duration, ids []string, justID bool) ([]StreamEntry, error) {
+	stream, group, unlock, err := sm.lockGroup(streamName, groupName)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	now := time.Now()
+	group.consumer(consumerName, groupName, now.UnixMilli())
+
+	var claimed []StreamEntry
+	for _, id := range ids {
+		p, exists := group.Pending[id]
+		if !exists || p.Idle(now) < minIdle {
+			continue
+		}
+		entry, exists := stream.entry(id)
+		if !exists {
+			group.release(p)
+			delete(group.Pending, id)
+			continue
+		}
+		group.deliver(id, consumerName, now.UnixMilli(), !justID)
+		claimed = append(claimed, entry)
+	}
+	return claimed, nil
+}
+
+// AutoClaim scans the pending entries list from startID and claims up to
+// count entries idle for at least minIdle, like Claim. It returns the ID to
+// continue the scan from, "0-0" once the whole list was scanned, the
+// claimed entries and the IDs dropped because they are no longer in the
+// stream.
+func (sm *StreamManager) AutoClaim(streamName, groupName, consumerName string, minIdle time.Duration, startID string, count int, justID bool) (next string, claimed []StreamEntry, deleted []string, err error) {
+	stream, group, unlock, err := sm.lockGroup(streamName, groupName)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	defer unlock()
+
+	now := time.Now()
+	group.consumer(consumerName, groupName, now.UnixMilli())
+
+	next = "0-0"
+	for _, p := range group.sortedPending() {
+		if compareIDs(p.ID, startID) < 0 {
+			continue
+		}
+		if len(claimed) >= count {
+			next = p.ID
+			break
+		}
+		if p.Idle(now) < minIdle {
+			continue
+		}
+		entry, exists := stream.entry(p.ID)
+		if !exists {
+			group.release(p)
+			delete(group.Pending, p.ID)
+			deleted = append(deleted, p.ID)
+			continue
+		}
+		group.deliver(p.ID, consumerName, now.UnixMilli(), !justID)
+		claimed = append(claimed, entry)
+	}
+	return next, claimed, deleted, nil
+}
@@ -0,0 +1,162 @@
+package streams
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+)
+
+// ErrDropped is returned when the pipeline of a stream drops an entry
+// instead of storing it
+var ErrDropped = errors.New("entry dropped by the stream pipeline")
+
+// Transform filters, transforms or enriches the fields of an entry
+// appended to a stream. It returns the fields to store, or keep false to
+// drop the entry.
+type Transform func(fields map[string]string) (out map[string]string, keep bool, err error)
+
+// Pipeline passes every entry appended to a stream through a transform.
+// Without a target the transform runs before the entry is stored, and the
+// entry is stored as it returns it, or not at all. With a target the entry
+// is stored unchanged, and what the transform returns is appended to the
+// target stream, itself possibly feeding another pipeline.
+type Pipeline struct {
+	Function  string // Name of the transform, e.g. the WASM function running it
+	Target    string // Derived stream, empty to transform entries in place
+	transform Transform
+
+	processed atomic.Int64
+	dropped   atomic.Int64
+	failed    atomic.Int64
+}
+
+// PipelineInfo describes a pipeline and how many entries went through it:
+// processed and dropped by the transform, or failed in the transform or,
+// for derived streams, when appending to the target
+type PipelineInfo struct {
+	Stream    string
+	Function  string
+	Target    string
+	Processed int64
+	Dropped   int64
+	Failed    int64
+}
+
+// SetPipeline makes every entry appended to stream go through transform,
+// replacing any pipeline the stream had. Pipelines apply to AddEntry and
+// AddEntryWithID; imported entries are copies and stored as they are.
+// Pipelines feeding derived streams may not form a cycle.
+func (sm *StreamManager) SetPipeline(stream, function string, transform Transform, target string) error {
+	if target == stream {
+		return fmt.Errorf("stream %s cannot be its own pipeline target", stream)
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	for next := target; next != ""; {
+		if next == stream {
+			return fmt.Errorf("pipeline from %s to %s would form a cycle", stream, target)
+		}
+		p, exists := sm.pipelines[next]
+		if !exists {
+			break
+		}
+		next = p.Target
+	}
+
+	sm.pipelines[stream] = &Pipeline{Function: function, Target: target, transform: transform}
+	return nil
+}
+
+// RemovePipeline detaches the pipeline of a stream, reporting whether it
+// had one
+func (sm *StreamManager) RemovePipeline(stream string) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	_, exists := sm.pipelines[stream]
+	delete(sm.pipelines, stream)
+	return exists
+}
+
+// Pipelines lists the pipelines by stream name
+func (sm *StreamManager) Pipelines() []PipelineInfo {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	result := make([]PipelineInfo, 0, len(sm.pipelines))
+	for stream, p := range sm.pipelines {
+		result = append(result, PipelineInfo{
+			Stream:    stream,
+			Function:  p.Function,
+			Target:    p.Target,
+			Processed: p.processed.Load(),
+			Dropped:   p.dropped.Load(),
+			Failed:    p.failed.Load(),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Stream < result[j].Stream })
+	return result
+}
+
+// pipeline returns the pipeline of a stream, nil if it has none
+func (sm *StreamManager) pipeline(stream string) *Pipeline {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.pipelines[stream]
+}
+
+// run passes fields through the pipeline, counting the outcome
+func (p *Pipeline) run(fields map[string]string) (map[string]string, bool, error) {
+	out, keep, err := p.transform(fields)
+	switch {
+	case err != nil:
+		p.failed.Add(1)
+		return nil, false, fmt.Errorf("pipeline %s failed: %w", p.Function, err)
+	case !keep:
+		p.dropped.Add(1)
+	default:
+		p.processed.Add(1)
+	}
+	return out, keep, nil
+}
+
+// appendThroughPipeline adds an entry to a stream through its pipeline, if
+// it has one
+func (sm *StreamManager) appendThroughPipeline(streamName, requestedID string, fields map[string]string, uuid string, trim *TrimPolicy) (string, error) {
+	p := sm.pipeline(streamName)
+	if p == nil {
+		id, _, err := sm.addEntry(streamName, requestedID, fields, uuid, trim)
+		return id, err
+	}
+
+	if p.Target == "" {
+		out, keep, err := p.run(fields)
+		if err != nil {
+			return "", err
+		}
+		if !keep {
+			return "", ErrDropped
+		}
+		id, _, err := sm.addEntry(streamName, requestedID, out, uuid, trim)
+		return id, err
+	}
+
+	id, added, err := sm.addEntry(streamName, requestedID, fields, uuid, trim)
+	if err != nil || !added {
+		return id, err
+	}
+
+	// The source entry is stored, so a failing transform only loses the
+	// derived entry, and is only counted
+	out, keep, err := p.run(fields)
+	if err != nil || !keep {
+		return id, nil
+	}
+	if _, err := sm.appendThroughPipeline(p.Target, "*", out, "", nil); err != nil && !errors.Is(err, ErrDropped) {
+		p.failed.Add(1)
+	}
+	return id, nil
+}
@@ -0,0 +1,95 @@
+package streams
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPipelineInPlace(t *testing.T) {
+	sm := NewStreamManager()
+
+	// Drop debug entries, upper-case the level of the others
+	err := sm.SetPipeline("logs", "levels", func(fields map[string]string) (map[string]string, bool, error) {
+		if fields["level"] == "debug" {
+			return nil, false, nil
+		}
+		if fields["level"] == "" {
+			return nil, false, errors.New("no level")
+		}
+		return map[string]string{"level": strings.ToUpper(fields["level"]), "msg": fields["msg"]}, true, nil
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sm.AddEntry("logs", map[string]string{"level": "info", "msg": "hi"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sm.AddEntry("logs", map[string]string{"level": "debug"}, ""); !errors.Is(err, ErrDropped) {
+		t.Errorf("Expected the debug entry to be dropped, got %v", err)
+	}
+	if _, err := sm.AddEntryWithID("logs", "*", map[string]string{"msg": "?"}, nil); err == nil {
+		t.Error("Expected a failing transform to reject the entry")
+	}
+
+	entries, _ := sm.Range("logs", "", "", 0, false)
+	if len(entries) != 1 || entries[0].Fields["level"] != "INFO" {
+		t.Errorf("Expected only the transformed entry to be stored, got %+v", entries)
+	}
+	pipelines := sm.Pipelines()
+	if len(pipelines) != 1 || pipelines[0].Processed != 1 || pipelines[0].Dropped != 1 || pipelines[0].Failed != 1 {
+		t.Errorf("Unexpected pipeline counters %+v", pipelines)
+	}
+
+	if !sm.RemovePipeline("logs") || sm.RemovePipeline("logs") {
+		t.Error("Expected the pipeline to be removed once")
+	}
+	if _, err := sm.AddEntry("logs", map[string]string{"level": "debug"}, ""); err != nil {
+		t.Errorf("Expected entries to be stored as is without a pipeline, got %v", err)
+	}
+}
+
+func TestPipelineDerived(t *testing.T) {
+	sm := NewStreamManager()
+
+	enrich := func(fields map[string]string) (map[string]string, bool, error) {
+		out := map[string]string{"source": "orders"}
+		for name, value := range fields {
+			out[name] = value
+		}
+		return out, true, nil
+	}
+	if err := sm.SetPipeline("orders", "enrich", enrich, "orders:enriched"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.SetPipeline("orders:enriched", "copy", enrich, "orders:audit"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.SetPipeline("orders:audit", "loop", enrich, "orders"); err == nil {
+		t.Error("Expected a pipeline cycle to be refused")
+	}
+	if err := sm.SetPipeline("orders", "self", enrich, "orders"); err == nil {
+		t.Error("Expected a stream feeding itself to be refused")
+	}
+
+	id, err := sm.AddEntry("orders", map[string]string{"total": "10"}, "req-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An idempotent retry is not derived again
+	if again, _ := sm.AddEntry("orders", map[string]string{"total": "10"}, "req-1"); again != id {
+		t.Errorf("Expected the retry to return %s, got %s", id, again)
+	}
+
+	source, _ := sm.Range("orders", "", "", 0, false)
+	if len(source) != 1 || source[0].Fields["source"] != "" {
+		t.Errorf("Expected the source entry to be stored unchanged, got %+v", source)
+	}
+	for _, name := range []string{"orders:enriched", "orders:audit"} {
+		derived, _ := sm.Range(name, "", "", 0, false)
+		if len(derived) != 1 || derived[0].Fields["source"] != "orders" || derived[0].Fields["total"] != "10" {
+			t.Errorf("Expected one derived entry in %s, got %+v", name, derived)
+		}
+	}
+}
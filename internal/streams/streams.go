@@ -1,24 +1,41 @@
 package streams
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
+// Stream errors
+var (
+	ErrNoStream    = errors.New("stream does not exist")
+	ErrNoGroup     = errors.New("no such stream or consumer group")
+	ErrGroupExists = errors.New("consumer group name already exists")
+	ErrInvalidID   = errors.New("invalid stream ID")
+	ErrIDZero      = errors.New("the ID must be greater than 0-0")
+	ErrIDTooSmall  = errors.New("the ID is equal or smaller than the last entry of the stream")
+	ErrIDExhausted = errors.New("the stream has exhausted the last possible ID")
+)
+
 // StreamEntry represents an entry in a stream
 type StreamEntry struct {
-	ID        string
-	Timestamp int64
-	Fields    map[string]string
-	UUID      string // For idempotent operations
+	ID        string            `json:"id"`
+	Timestamp int64             `json:"timestamp"`
+	Fields    map[string]string `json:"fields"`
+	UUID      string            `json:"uuid,omitempty"` // For idempotent operations
 }
 
 // ConsumerGroup represents a consumer group
 type ConsumerGroup struct {
 	Name      string
 	Consumers map[string]*Consumer
-	LastID    string
+	LastID    string                   // Last entry delivered to the group
+	Pending   map[string]*PendingEntry // Delivered entries not yet acknowledged, by ID
 	mu        sync.RWMutex
 }
 
@@ -26,8 +43,8 @@ type ConsumerGroup struct {
 type Consumer struct {
 	Name         string
 	Group        string
-	PendingCount int
-	LastSeen     int64
+	PendingCount int   // Entries of the group's pending list owned by the consumer
+	LastSeen     int64 // Unix seconds of the consumer's last read or claim
 }
 
 // Stream represents a PulseDB stream with enhanced features
@@ -36,24 +53,68 @@ type Stream struct {
 	Entries []StreamEntry
 	Groups  map[string]*ConsumerGroup
 	UUIDs   map[string]bool // For idempotency checking
+	lastMs  int64           // Millisecond part of the last generated ID
+	lastSeq int64           // Sequence part of the last generated ID
 	mu      sync.RWMutex
 }
 
 // StreamManager manages all streams
 type StreamManager struct {
-	streams map[string]*Stream
-	mu      sync.RWMutex
+	streams   map[string]*Stream
+	appended  map[string]chan struct{} // Closed on the next append to a stream, see Appended
+	pipelines map[string]*Pipeline     // By source stream, see SetPipeline
+	mu        sync.RWMutex
 }
 
 // NewStreamManager creates a new stream manager
 func NewStreamManager() *StreamManager {
 	return &StreamManager{
-		streams: make(map[string]*Stream),
+		streams:   make(map[string]*Stream),
+		appended:  make(map[string]chan struct{}),
+		pipelines: make(map[string]*Pipeline),
+	}
+}
+
+// Appended returns a channel closed the next time an entry is appended to
+// the stream, which need not exist yet. Take it before reading the entries
+// already there, so no append can slip in between.
+func (sm *StreamManager) Appended(streamName string) <-chan struct{} {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	ch, exists := sm.appended[streamName]
+	if !exists {
+		ch = make(chan struct{})
+		sm.appended[streamName] = ch
+	}
+	return ch
+}
+
+// notifyAppended wakes the waiters of Appended. The caller must hold the
+// manager write lock.
+func (sm *StreamManager) notifyAppended(streamName string) {
+	if ch, exists := sm.appended[streamName]; exists {
+		close(ch)
+		delete(sm.appended, streamName)
 	}
 }
 
 // AddEntry adds an entry to a stream with optional idempotency
 func (sm *StreamManager) AddEntry(streamName string, fields map[string]string, uuid string) (string, error) {
+	return sm.appendThroughPipeline(streamName, "*", fields, uuid, nil)
+}
+
+// AddEntryWithID adds an entry to a stream with the ID requested as in
+// XADD: "*" for an automatic ID, "<ms>-*" for an automatic sequence within
+// a millisecond, or an explicit "<ms>-<seq>". The ID must be greater than
+// the last entry's. A non-nil trim caps the stream once the entry is added.
+func (sm *StreamManager) AddEntryWithID(streamName, id string, fields map[string]string, trim *TrimPolicy) (string, error) {
+	return sm.appendThroughPipeline(streamName, id, fields, "", trim)
+}
+
+// addEntry adds an entry with a requested ID, see AddEntryWithID. added is
+// false if the UUID was already used, and the ID is then the first entry's.
+func (sm *StreamManager) addEntry(streamName, requestedID string, fields map[string]string, uuid string, trim *TrimPolicy) (id string, added bool, err error) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
@@ -77,16 +138,24 @@ func (sm *StreamManager) AddEntry(streamName string, fields map[string]string, u
 			// Entry already exists, return existing ID
 			for _, entry := range stream.Entries {
 				if entry.UUID == uuid {
-					return entry.ID, nil
+					return entry.ID, false, nil
 				}
 			}
 		}
-		stream.UUIDs[uuid] = true
 	}
 
-	// Generate ID (simplified - real implementation would be more sophisticated)
-	timestamp := time.Now().UnixMilli()
-	id := fmt.Sprintf("%d-0", timestamp)
+	timestamp, seq, err := stream.nextID(requestedID, time.Now().UnixMilli())
+	if err != nil {
+		if !exists {
+			delete(sm.streams, streamName)
+		}
+		return "", false, err
+	}
+	if uuid != "" {
+		stream.UUIDs[uuid] = true
+	}
+	stream.lastMs, stream.lastSeq = timestamp, seq
+	id = fmt.Sprintf("%d-%d", timestamp, seq)
 
 	entry := StreamEntry{
 		ID:        id,
@@ -96,78 +165,131 @@ func (sm *StreamManager) AddEntry(streamName string, fields map[string]string, u
 	}
 
 	stream.Entries = append(stream.Entries, entry)
+	if trim != nil {
+		stream.trim(*trim)
+	}
+	sm.notifyAppended(streamName)
 
-	return id, nil
+	return id, true, nil
 }
 
-// CreateConsumerGroup creates a new consumer group
-func (sm *StreamManager) CreateConsumerGroup(streamName, groupName string) error {
+// nextID returns the ID of the next entry for the ID requested in
+// AddEntryWithID, now being the clock in Unix milliseconds. Automatic IDs
+// use the clock, or bump the sequence of the last entry if the clock is not
+// ahead of it, so IDs stay unique and increasing. Once the sequence is
+// exhausted they move on to the next millisecond, and past the last
+// possible ID no entry can be added.
+func (s *Stream) nextID(requested string, now int64) (ms, seq int64, err error) {
+	if requested == "*" {
+		switch {
+		case now > s.lastMs:
+			return now, 0, nil
+		case s.lastSeq < math.MaxInt64:
+			return s.lastMs, s.lastSeq + 1, nil
+		case s.lastMs < math.MaxInt64:
+			return s.lastMs + 1, 0, nil
+		}
+		return 0, 0, ErrIDExhausted
+	}
+
+	msPart, seqPart, _ := strings.Cut(requested, "-")
+	ms, err = strconv.ParseInt(msPart, 10, 64)
+	if err != nil || ms < 0 {
+		return 0, 0, ErrInvalidID
+	}
+	switch {
+	case seqPart == "*" && ms == s.lastMs:
+		// The sequence of the millisecond may be exhausted
+		if s.lastSeq == math.MaxInt64 {
+			return 0, 0, ErrIDTooSmall
+		}
+		seq = s.lastSeq + 1
+	case seqPart == "*":
+		seq = 0
+	case seqPart != "":
+		if seq, err = strconv.ParseInt(seqPart, 10, 64); err != nil || seq < 0 {
+			return 0, 0, ErrInvalidID
+		}
+	}
+
+	if ms == 0 && seq == 0 {
+		return 0, 0, ErrIDZero
+	}
+	if ms < s.lastMs || ms == s.lastMs && seq <= s.lastSeq {
+		return 0, 0, ErrIDTooSmall
+	}
+	return ms, seq, nil
+}
+
+// CreateConsumerGroup creates a new consumer group delivering the entries
+// after startID; "$" starts after the last entry. The stream is created if
+// it does not exist and mkStream is set.
+func (sm *StreamManager) CreateConsumerGroup(streamName, groupName, startID string, mkStream bool) error {
+	if startID != "$" && !ValidID(startID) {
+		return ErrInvalidID
+	}
+
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
 	stream, exists := sm.streams[streamName]
 	if !exists {
-		return fmt.Errorf("stream %s does not exist", streamName)
+		if !mkStream {
+			return ErrNoStream
+		}
+		stream = &Stream{
+			Name:    streamName,
+			Entries: make([]StreamEntry, 0),
+			Groups:  make(map[string]*ConsumerGroup),
+			UUIDs:   make(map[string]bool),
+		}
+		sm.streams[streamName] = stream
 	}
 
 	stream.mu.Lock()
 	defer stream.mu.Unlock()
 
 	if _, exists := stream.Groups[groupName]; exists {
-		return fmt.Errorf("consumer group %s already exists", groupName)
+		return ErrGroupExists
 	}
 
+	if startID == "$" {
+		startID = "0-0"
+		if n := len(stream.Entries); n > 0 {
+			startID = stream.Entries[n-1].ID
+		}
+	}
 	stream.Groups[groupName] = &ConsumerGroup{
 		Name:      groupName,
 		Consumers: make(map[string]*Consumer),
-		LastID:    "0-0",
+		LastID:    startID,
+		Pending:   make(map[string]*PendingEntry),
 	}
 
 	return nil
 }
 
-// ReadGroup reads entries from a stream as part of a consumer group
+// ReadGroup delivers up to count entries the group has not delivered yet
+// to a consumer, adding them to the group's pending entries list until
+// they are acknowledged
 func (sm *StreamManager) ReadGroup(streamName, groupName, consumerName string, count int) ([]StreamEntry, error) {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
-
-	stream, exists := sm.streams[streamName]
-	if !exists {
-		return nil, fmt.Errorf("stream %s does not exist", streamName)
+	stream, group, unlock, err := sm.lockGroup(streamName, groupName)
+	if err != nil {
+		return nil, err
 	}
+	defer unlock()
 
-	stream.mu.RLock()
-	defer stream.mu.RUnlock()
-
-	group, exists := stream.Groups[groupName]
-	if !exists {
-		return nil, fmt.Errorf("consumer group %s does not exist", groupName)
-	}
-
-	group.mu.Lock()
-	defer group.mu.Unlock()
-
-	// Create consumer if it doesn't exist
-	if _, exists := group.Consumers[consumerName]; !exists {
-		group.Consumers[consumerName] = &Consumer{
-			Name:     consumerName,
-			Group:    groupName,
-			LastSeen: time.Now().Unix(),
-		}
-	}
+	now := time.Now().UnixMilli()
+	group.consumer(consumerName, groupName, now)
 
 	// Find entries after the group's last ID
 	var result []StreamEntry
-	found := false
-
-	for _, entry := range stream.Entries {
-		if entry.ID == group.LastID {
-			found = true
-			continue
-		}
-		if found && len(result) < count {
-			result = append(result, entry)
+	for _, entry := range stream.Entries[stream.after(group.LastID):] {
+		if len(result) >= count {
+			break
 		}
+		result = append(result, entry)
+		group.deliver(entry.ID, consumerName, now, true)
 	}
 
 	// Update group's last ID if we found entries
@@ -206,6 +328,29 @@ func (sm *StreamManager) GetStreamInfo(streamName string) (map[string]interface{
 	return info, nil
 }
 
+// LastEntries returns up to count of the most recent entries of a stream,
+// oldest first
+func (sm *StreamManager) LastEntries(streamName string, count int) ([]StreamEntry, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	stream, exists := sm.streams[streamName]
+	if !exists {
+		return nil, fmt.Errorf("stream %s does not exist", streamName)
+	}
+
+	stream.mu.RLock()
+	defer stream.mu.RUnlock()
+
+	start := len(stream.Entries) - count
+	if start < 0 {
+		start = 0
+	}
+	entries := make([]StreamEntry, len(stream.Entries)-start)
+	copy(entries, stream.Entries[start:])
+	return entries, nil
+}
+
 // ListStreams returns a list of all stream names
 func (sm *StreamManager) ListStreams() []string {
 	sm.mu.RLock()
@@ -218,3 +363,167 @@ func (sm *StreamManager) ListStreams() []string {
 
 	return names
 }
+
+// EntriesAfter returns up to count entries with an ID greater than afterID,
+// oldest first. An empty afterID starts at the first entry.
+func (sm *StreamManager) EntriesAfter(streamName, afterID string, count int) ([]StreamEntry, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	stream, exists := sm.streams[streamName]
+	if !exists {
+		return nil, fmt.Errorf("stream %s does not exist", streamName)
+	}
+
+	stream.mu.RLock()
+	defer stream.mu.RUnlock()
+
+	i := 0
+	if afterID != "" {
+		i = stream.after(afterID)
+	}
+	n := max(0, min(count, len(stream.Entries)-i))
+	return append([]StreamEntry(nil), stream.Entries[i:i+n]...), nil
+}
+
+// Range returns up to count entries with IDs between start and end
+// inclusive, oldest first or newest first if reverse is set. An empty start
+// or end leaves the range open on that side, and a count of 0 returns every
+// entry in the range.
+func (sm *StreamManager) Range(streamName, start, end string, count int, reverse bool) ([]StreamEntry, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	stream, exists := sm.streams[streamName]
+	if !exists {
+		return nil, fmt.Errorf("stream %s does not exist", streamName)
+	}
+
+	stream.mu.RLock()
+	defer stream.mu.RUnlock()
+
+	// Entries are in ID order, so the range is found by binary search
+	from, to := 0, len(stream.Entries)
+	if start != "" {
+		from = sort.Search(len(stream.Entries), func(i int) bool {
+			return compareIDs(stream.Entries[i].ID, start) >= 0
+		})
+	}
+	if end != "" {
+		to = stream.after(end)
+	}
+	if from >= to {
+		return []StreamEntry{}, nil
+	}
+
+	n := to - from
+	if count > 0 {
+		n = min(n, count)
+	}
+	result := make([]StreamEntry, n)
+	for i := range result {
+		if reverse {
+			result[i] = stream.Entries[to-1-i]
+		} else {
+			result[i] = stream.Entries[from+i]
+		}
+	}
+	return result, nil
+}
+
+// ImportEntries appends entries copied from another stream, keeping their
+// IDs. Entries not newer than the last entry are skipped, so importing the
+// same entries again is harmless. It returns the number of entries added.
+func (sm *StreamManager) ImportEntries(streamName string, entries []StreamEntry) int {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	stream, exists := sm.streams[streamName]
+	if !exists {
+		stream = &Stream{
+			Name:    streamName,
+			Entries: make([]StreamEntry, 0, len(entries)),
+			Groups:  make(map[string]*ConsumerGroup),
+			UUIDs:   make(map[string]bool),
+		}
+		sm.streams[streamName] = stream
+	}
+
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	added := 0
+	for _, entry := range entries {
+		ms, seq, ok := parseID(entry.ID)
+		if !ok {
+			continue
+		}
+		if n := len(stream.Entries); n > 0 && compareIDs(entry.ID, stream.Entries[n-1].ID) <= 0 {
+			continue
+		}
+		stream.Entries = append(stream.Entries, entry)
+		if entry.UUID != "" {
+			stream.UUIDs[entry.UUID] = true
+		}
+		stream.lastMs, stream.lastSeq = ms, seq
+		added++
+	}
+	if added > 0 {
+		sm.notifyAppended(streamName)
+	}
+	return added
+}
+
+// after returns the index of the first entry with an ID greater than id
+func (s *Stream) after(id string) int {
+	return sort.Search(len(s.Entries), func(i int) bool {
+		return compareIDs(s.Entries[i].ID, id) > 0
+	})
+}
+
+// entry finds the entry with id
+func (s *Stream) entry(id string) (StreamEntry, bool) {
+	i := sort.Search(len(s.Entries), func(i int) bool {
+		return compareIDs(s.Entries[i].ID, id) >= 0
+	})
+	if i < len(s.Entries) && s.Entries[i].ID == id {
+		return s.Entries[i], true
+	}
+	return StreamEntry{}, false
+}
+
+// ValidID reports whether id is a well-formed <ms>-<seq> entry ID
+func ValidID(id string) bool {
+	_, _, ok := parseID(id)
+	return ok
+}
+
+// parseID splits a <ms>-<seq> entry ID
+func parseID(id string) (ms, seq int64, ok bool) {
+	msPart, seqPart, found := strings.Cut(id, "-")
+	if !found {
+		return 0, 0, false
+	}
+	ms, err1 := strconv.ParseInt(msPart, 10, 64)
+	seq, err2 := strconv.ParseInt(seqPart, 10, 64)
+	return ms, seq, err1 == nil && err2 == nil
+}
+
+// compareIDs orders two entry IDs, returning -1, 0 or 1
+func compareIDs(a, b string) int {
+	aMs, aSeq, _ := parseID(a)
+	bMs, bSeq, _ := parseID(b)
+	switch {
+	case aMs != bMs:
+		if aMs < bMs {
+			return -1
+		}
+		return 1
+	case aSeq != bSeq:
+		if aSeq < bSeq {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,167 @@
+package streams
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestAddEntryWithID(t *testing.T) {
+	sm := NewStreamManager()
+
+	if _, err := sm.AddEntryWithID("s", "0-0", nil, nil); !errors.Is(err, ErrIDZero) {
+		t.Errorf("Expected 0-0 to be rejected, got %v", err)
+	}
+	if len(sm.ListStreams()) != 0 {
+		t.Error("Expected a rejected entry not to create the stream")
+	}
+
+	tests := []struct {
+		requested string
+		want      string
+		err       error
+	}{
+		{"0-*", "0-1", nil},
+		{"5", "5-0", nil},
+		{"5-*", "5-1", nil},
+		{"5-1", "", ErrIDTooSmall},
+		{"4-9", "", ErrIDTooSmall},
+		{"7-*", "7-0", nil},
+		{"7-3", "7-3", nil},
+		{"x-1", "", ErrInvalidID},
+		{"7-y", "", ErrInvalidID},
+	}
+	for _, tt := range tests {
+		id, err := sm.AddEntryWithID("s", tt.requested, map[string]string{"f": "v"}, nil)
+		if !errors.Is(err, tt.err) || id != tt.want {
+			t.Errorf("AddEntryWithID(%q) = %q, %v; want %q, %v", tt.requested, id, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestAutomaticIDsIncrease(t *testing.T) {
+	sm := NewStreamManager()
+
+	// Far in the future, so the clock is behind the last entry
+	if _, err := sm.AddEntryWithID("s", "99999999999999-5", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"99999999999999-6", "99999999999999-7"} {
+		if id, _ := sm.AddEntry("s", nil, ""); id != want {
+			t.Errorf("Expected automatic ID %s, got %s", want, id)
+		}
+	}
+}
+
+func TestExhaustedIDs(t *testing.T) {
+	sm := NewStreamManager()
+
+	// An exhausted sequence moves automatic IDs to the next millisecond
+	if _, err := sm.AddEntryWithID("s", "99999999999999-9223372036854775807", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sm.AddEntryWithID("s", "99999999999999-*", nil, nil); !errors.Is(err, ErrIDTooSmall) {
+		t.Errorf("Expected the exhausted millisecond to be refused, got %v", err)
+	}
+	if id, err := sm.AddEntry("s", nil, ""); err != nil || id != "100000000000000-0" {
+		t.Errorf("Expected the next millisecond, got %q, %v", id, err)
+	}
+
+	// Past the last possible ID no entry can be added
+	if _, err := sm.AddEntryWithID("s", "9223372036854775807-9223372036854775807", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sm.AddEntry("s", nil, ""); !errors.Is(err, ErrIDExhausted) {
+		t.Errorf("Expected the IDs to be exhausted, got %v", err)
+	}
+	if _, err := sm.AddEntryWithID("s", "9223372036854775807-*", nil, nil); !errors.Is(err, ErrIDTooSmall) {
+		t.Errorf("Expected the exhausted millisecond to be refused, got %v", err)
+	}
+}
+
+func TestRange(t *testing.T) {
+	sm := NewStreamManager()
+	for _, id := range []string{"1-0", "1-1", "2-0", "3-0", "3-1"} {
+		if _, err := sm.AddEntryWithID("s", id, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids := func(entries []StreamEntry) []string {
+		result := make([]string, len(entries))
+		for i, entry := range entries {
+			result[i] = entry.ID
+		}
+		return result
+	}
+
+	tests := []struct {
+		start, end string
+		count      int
+		reverse    bool
+		want       []string
+	}{
+		{"", "", 0, false, []string{"1-0", "1-1", "2-0", "3-0", "3-1"}},
+		{"1-1", "3-0", 0, false, []string{"1-1", "2-0", "3-0"}},
+		{"1-1", "3-0", 2, false, []string{"1-1", "2-0"}},
+		{"", "", 2, true, []string{"3-1", "3-0"}},
+		{"2-0", "", 0, true, []string{"3-1", "3-0", "2-0"}},
+		{"2-1", "2-9", 0, false, []string{}},
+		{"3-0", "1-0", 0, false, []string{}},
+	}
+	for _, tt := range tests {
+		entries, err := sm.Range("s", tt.start, tt.end, tt.count, tt.reverse)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ids(entries); !slices.Equal(got, tt.want) {
+			t.Errorf("Range(%q, %q, %d, %v) = %v, want %v", tt.start, tt.end, tt.count, tt.reverse, got, tt.want)
+		}
+	}
+
+	if entries, _ := sm.EntriesAfter("s", "1-1", 2); len(entries) != 2 || entries[0].ID != "2-0" {
+		t.Errorf("Expected the 2 entries after 1-1, got %+v", entries)
+	}
+}
+
+func TestTrim(t *testing.T) {
+	sm := NewStreamManager()
+	for i := 0; i < 250; i++ {
+		sm.AddEntry("s", nil, fmt.Sprintf("uuid-%d", i))
+	}
+
+	// An approximate trim waits for a whole chunk of entries to remove
+	if removed, _ := sm.Trim("s", TrimPolicy{MaxLen: 200, Approx: true}); removed != 0 {
+		t.Errorf("Expected no entries removed below a chunk, got %d", removed)
+	}
+	if removed, _ := sm.Trim("s", TrimPolicy{MaxLen: 100, Approx: true}); removed != 150 {
+		t.Errorf("Expected 150 entries removed, got %d", removed)
+	}
+	if removed, _ := sm.Trim("s", TrimPolicy{MaxLen: 90}); removed != 10 {
+		t.Errorf("Expected 10 entries removed, got %d", removed)
+	}
+
+	entries, _ := sm.Range("s", "", "", 0, false)
+	if len(entries) != 90 || entries[0].UUID != "uuid-160" {
+		t.Fatalf("Expected the last 90 entries kept, got %d from %+v", len(entries), entries[0])
+	}
+	if removed, _ := sm.Trim("s", TrimPolicy{MinID: entries[10].ID}); removed != 10 {
+		t.Errorf("Expected the 10 entries below the minimum ID removed, got %d", removed)
+	}
+
+	// The UUIDs of trimmed entries are forgotten
+	if id, _ := sm.AddEntry("s", nil, "uuid-0"); id == entries[0].ID {
+		t.Error("Expected a trimmed UUID to add a new entry")
+	}
+	if id, _ := sm.AddEntry("s", nil, "uuid-249"); id != entries[89].ID {
+		t.Errorf("Expected a kept UUID to return its entry %s, got %s", entries[89].ID, id)
+	}
+
+	if _, err := sm.AddEntryWithID("s", "*", nil, &TrimPolicy{MaxLen: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := sm.Range("s", "", "", 0, false); len(entries) != 5 {
+		t.Errorf("Expected XADD to cap the stream at 5 entries, got %d", len(entries))
+	}
+}
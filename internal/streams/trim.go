@@ -0,0 +1,63 @@
+package streams
+
+import "sort"
+
+// trimChunk is the least number of entries an approximate trim removes at
+// once, so capping a stream on every append does not copy it every time
+const trimChunk = 100
+
+// TrimPolicy selects the oldest entries of a stream to remove: by length,
+// keeping the last MaxLen entries, or by ID, removing the entries below
+// MinID when it is set
+type TrimPolicy struct {
+	MaxLen int
+	MinID  string
+	Approx bool // Only trim once at least trimChunk entries can be removed
+}
+
+// Trim removes the oldest entries of a stream selected by policy, along
+// with their idempotency UUIDs. Pending entries of consumer groups are left
+// in place and dropped when claimed. It returns the number of entries
+// removed.
+func (sm *StreamManager) Trim(streamName string, policy TrimPolicy) (int, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	stream, exists := sm.streams[streamName]
+	if !exists {
+		return 0, ErrNoStream
+	}
+
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	return stream.trim(policy), nil
+}
+
+// trim removes the oldest entries selected by policy. The caller must hold
+// the stream write lock.
+func (s *Stream) trim(policy TrimPolicy) int {
+	n := 0
+	if policy.MinID != "" {
+		n = sort.Search(len(s.Entries), func(i int) bool {
+			return compareIDs(s.Entries[i].ID, policy.MinID) >= 0
+		})
+	} else {
+		n = max(0, len(s.Entries)-policy.MaxLen)
+	}
+	if n == 0 || policy.Approx && n < trimChunk {
+		return 0
+	}
+
+	for _, entry := range s.Entries[:n] {
+		if entry.UUID != "" {
+			delete(s.UUIDs, entry.UUID)
+		}
+	}
+
+	// Shift the kept entries down, so the removed ones can be collected
+	kept := copy(s.Entries, s.Entries[n:])
+	clear(s.Entries[kept:])
+	s.Entries = s.Entries[:kept]
+	return n
+}
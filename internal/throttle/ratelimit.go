@@ -0,0 +1,189 @@
+package throttle
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Class is the kind of command a command rate applies to
+type Class int
+
+const (
+	Read  Class = iota // Commands only reading keys or server state
+	Write              // Commands changing keys
+	Admin              // Commands managing the server
+	classes
+)
+
+// String returns the label used for the class in rate specs, errors and
+// metrics
+func (c Class) String() string {
+	switch c {
+	case Write:
+		return "write"
+	case Admin:
+		return "admin"
+	default:
+		return "read"
+	}
+}
+
+// Rates are the commands per second each client may run in each class. A
+// zero rate leaves that class unlimited.
+type Rates struct {
+	Read  int64
+	Write int64
+	Admin int64
+}
+
+// rate returns the rate of class
+func (r Rates) rate(class Class) int64 {
+	switch class {
+	case Write:
+		return r.Write
+	case Admin:
+		return r.Admin
+	default:
+		return r.Read
+	}
+}
+
+// idleSweep is how often the buckets of clients that stopped sending
+// commands are dropped
+const idleSweep = time.Minute
+
+// RateLimiter limits the commands per second of each client with a token
+// bucket per command class, holding up to one second worth of commands.
+// Clients are identified by the caller, e.g. by IP address or API key. It
+// is safe for concurrent use and shared by every listener of a process.
+type RateLimiter struct {
+	mu      sync.Mutex
+	rates   Rates
+	clients map[string]*[classes]*bucket
+	swept   time.Time
+}
+
+// NewRateLimiter creates a rate limiter without limits
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{clients: make(map[string]*[classes]*bucket), swept: time.Now()}
+}
+
+// SetRates replaces the rates; the buckets of every client start full
+func (l *RateLimiter) SetRates(rates Rates) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rates = rates
+	l.clients = make(map[string]*[classes]*bucket)
+}
+
+// Rates returns the configured rates
+func (l *RateLimiter) Rates() Rates {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rates
+}
+
+// Allow decides whether client may run a command of class, and takes a
+// token from its bucket if so
+func (l *RateLimiter) Allow(client string, class Class) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rate := l.rates.rate(class)
+	if rate == 0 {
+		return true
+	}
+
+	now := time.Now()
+	if now.Sub(l.swept) >= idleSweep {
+		l.sweep(now)
+	}
+
+	buckets, exists := l.clients[client]
+	if !exists {
+		buckets = new([classes]*bucket)
+		l.clients[client] = buckets
+	}
+	b := buckets[class]
+	if b == nil {
+		b = newBucket(rate, now)
+		buckets[class] = b
+	}
+
+	// Unlike bandwidth quotas a command costs one token, so no debt is
+	// allowed
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.take(1)
+	return true
+}
+
+// sweep drops the clients whose buckets have all refilled
+func (l *RateLimiter) sweep(now time.Time) {
+	for client, buckets := range l.clients {
+		idle := true
+		for _, b := range buckets {
+			if b != nil {
+				b.refill(now)
+				idle = idle && b.tokens >= b.rate
+			}
+		}
+		if idle {
+			delete(l.clients, client)
+		}
+	}
+	l.swept = now
+}
+
+// ParseRates parses a comma-separated list of class=rate pairs in commands
+// per second, e.g. "read=1000,write=200,admin=10". Classes left out are
+// unlimited.
+func ParseRates(spec string) (Rates, error) {
+	var rates Rates
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return Rates{}, fmt.Errorf("invalid rate '%s', expected class=rate", item)
+		}
+		rate, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || rate < 0 {
+			return Rates{}, fmt.Errorf("invalid rate for class '%s': '%s' is not a command count", name, value)
+		}
+		switch strings.ToLower(name) {
+		case "read":
+			rates.Read = rate
+		case "write":
+			rates.Write = rate
+		case "admin":
+			rates.Admin = rate
+		default:
+			return Rates{}, fmt.Errorf("unknown command class '%s', want read, write or admin", name)
+		}
+	}
+	return rates, nil
+}
+
+// FormatRates renders rates in the form accepted by ParseRates, leaving out
+// unlimited classes
+func FormatRates(rates Rates) string {
+	var items []string
+	for class := Read; class < classes; class++ {
+		if rate := rates.rate(class); rate > 0 {
+			items = append(items, fmt.Sprintf("%s=%d", class, rate))
+		}
+	}
+	return strings.Join(items, ",")
+}
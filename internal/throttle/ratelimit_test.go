@@ -0,0 +1,57 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := NewRateLimiter()
+	l.SetRates(Rates{Write: 10})
+
+	for i := 0; i < 10; i++ {
+		if !l.Allow("10.0.0.1", Write) {
+			t.Fatalf("Expected write %d to be allowed", i)
+		}
+	}
+	if l.Allow("10.0.0.1", Write) {
+		t.Error("Expected the 11th write to be refused")
+	}
+
+	// Other clients and classes have their own buckets
+	if !l.Allow("10.0.0.2", Write) {
+		t.Error("Expected another client to be allowed")
+	}
+	if !l.Allow("10.0.0.1", Read) {
+		t.Error("Expected reads to be unlimited")
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if !l.Allow("10.0.0.1", Write) {
+		t.Error("Expected a write to be allowed after refill")
+	}
+
+	var unset *RateLimiter
+	if !unset.Allow("10.0.0.1", Admin) {
+		t.Error("Expected a nil limiter to allow everything")
+	}
+}
+
+func TestParseRates(t *testing.T) {
+	rates, err := ParseRates("read=1000, write=200,admin=10")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if rates != (Rates{Read: 1000, Write: 200, Admin: 10}) {
+		t.Errorf("Unexpected rates %+v", rates)
+	}
+	if FormatRates(Rates{Write: 5}) != "write=5" {
+		t.Errorf("Unexpected formatted rates %q", FormatRates(Rates{Write: 5}))
+	}
+
+	for _, spec := range []string{"read", "read=x", "write=-1", "delete=1"} {
+		if _, err := ParseRates(spec); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package throttle
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Direction is the direction of traffic a quota applies to
+type Direction int
+
+const (
+	In  Direction = iota // Request bytes sent by clients
+	Out                  // Reply bytes sent to clients
+)
+
+// String returns the label used for the direction in errors and metrics
+func (d Direction) String() string {
+	if d == Out {
+		return "out"
+	}
+	return "in"
+}
+
+// Quota limits the bandwidth of one namespace in bytes per second. A zero
+// rate leaves that direction unlimited.
+type Quota struct {
+	Namespace string
+	In        int64
+	Out       int64
+}
+
+// Namespace returns the namespace of key: the part before the first ':'.
+// Keys without a ':' belong to no namespace.
+func Namespace(key string) string {
+	ns, _, found := strings.Cut(key, ":")
+	if !found {
+		return ""
+	}
+	return ns
+}
+
+// bucket is a token bucket holding up to one second worth of bytes
+type bucket struct {
+	rate   float64 // Bytes per second, 0 means unlimited
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate int64, now time.Time) *bucket {
+	return &bucket{rate: float64(rate), tokens: float64(rate), last: now}
+}
+
+// refill adds the tokens accumulated since the last refill
+func (b *bucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+}
+
+// available reports whether the bucket is out of debt
+func (b *bucket) available() bool {
+	return b == nil || b.tokens > 0
+}
+
+// take removes n tokens. The bucket may go into debt so that requests
+// larger than the burst are still served, delaying the following ones.
+func (b *bucket) take(n int64) {
+	if b != nil {
+		b.tokens -= float64(n)
+	}
+}
+
+// namespaceLimits holds the buckets of one namespace; nil buckets are unlimited
+type namespaceLimits struct {
+	quota Quota
+	in    *bucket
+	out   *bucket
+}
+
+// Limiter enforces per-namespace bandwidth quotas with token buckets. It is
+// safe for concurrent use and shared by every listener of a process.
+type Limiter struct {
+	mu     sync.Mutex
+	limits map[string]*namespaceLimits
+}
+
+// New creates a limiter without quotas
+func New() *Limiter {
+	return &Limiter{limits: make(map[string]*namespaceLimits)}
+}
+
+// SetQuotas replaces every quota; the buckets of all namespaces start full
+func (l *Limiter) SetQuotas(quotas []Quota) {
+	now := time.Now()
+	limits := make(map[string]*namespaceLimits, len(quotas))
+	for _, q := range quotas {
+		ns := &namespaceLimits{quota: q}
+		if q.In > 0 {
+			ns.in = newBucket(q.In, now)
+		}
+		if q.Out > 0 {
+			ns.out = newBucket(q.Out, now)
+		}
+		limits[q.Namespace] = ns
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits = limits
+}
+
+// Quotas returns the configured quotas sorted by namespace
+func (l *Limiter) Quotas() []Quota {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	quotas := make([]Quota, 0, len(l.limits))
+	for _, ns := range l.limits {
+		quotas = append(quotas, ns.quota)
+	}
+	sort.Slice(quotas, func(i, j int) bool {
+		return quotas[i].Namespace < quotas[j].Namespace
+	})
+	return quotas
+}
+
+// Limited reports whether namespace has a quota
+func (l *Limiter) Limited(namespace string) bool {
+	if l == nil || namespace == "" {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, exists := l.limits[namespace]
+	return exists
+}
+
+// Admit decides whether a request of n bytes to namespace may run, and
+// charges it to the inbound bucket if so. A request is refused while either
+// bucket is in debt; the exhausted direction is returned.
+func (l *Limiter) Admit(namespace string, n int64) (Direction, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ns, exists := l.limits[namespace]
+	if !exists {
+		return In, true
+	}
+
+	now := time.Now()
+	for _, b := range []*bucket{ns.in, ns.out} {
+		if b != nil {
+			b.refill(now)
+		}
+	}
+
+	if !ns.in.available() {
+		return In, false
+	}
+	if !ns.out.available() {
+		return Out, false
+	}
+	ns.in.take(n)
+	return In, true
+}
+
+// Charge removes n reply bytes from the outbound bucket of namespace
+func (l *Limiter) Charge(namespace string, n int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if ns, exists := l.limits[namespace]; exists {
+		ns.out.take(n)
+	}
+}
+
+// ParseQuotas parses a comma-separated list of namespace=in:out quotas in
+// bytes per second, e.g. "export=1M:512K". Sizes accept K, M and G suffixes
+// and 0 leaves a direction unlimited.
+func ParseQuotas(spec string) ([]Quota, error) {
+	var quotas []Quota
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		namespace, rates, ok := strings.Cut(item, "=")
+		in, out, hasOut := strings.Cut(rates, ":")
+		if !ok || !hasOut || namespace == "" || strings.Contains(namespace, ":") {
+			return nil, fmt.Errorf("invalid quota '%s', expected namespace=in:out", item)
+		}
+
+		q := Quota{Namespace: namespace}
+		var err error
+		if q.In, err = parseSize(in); err != nil {
+			return nil, fmt.Errorf("invalid inbound rate for namespace '%s': %v", namespace, err)
+		}
+		if q.Out, err = parseSize(out); err != nil {
+			return nil, fmt.Errorf("invalid outbound rate for namespace '%s': %v", namespace, err)
+		}
+		quotas = append(quotas, q)
+	}
+	return quotas, nil
+}
+
+// FormatQuotas renders quotas in the form accepted by ParseQuotas
+func FormatQuotas(quotas []Quota) string {
+	items := make([]string, len(quotas))
+	for i, q := range quotas {
+		items[i] = fmt.Sprintf("%s=%d:%d", q.Namespace, q.In, q.Out)
+	}
+	return strings.Join(items, ",")
+}
+
+// parseSize parses a byte count with an optional K, M or G suffix
+func parseSize(value string) (int64, error) {
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(value, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(value, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(value, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		value = value[:len(value)-1]
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("'%s' is not a byte count", value)
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,75 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNamespace(t *testing.T) {
+	if ns := Namespace("export:users:1"); ns != "export" {
+		t.Errorf("Expected namespace export, got %q", ns)
+	}
+	if ns := Namespace("plain"); ns != "" {
+		t.Errorf("Expected no namespace, got %q", ns)
+	}
+}
+
+func TestLimiterInbound(t *testing.T) {
+	l := New()
+	l.SetQuotas([]Quota{{Namespace: "export", In: 100}})
+
+	if !l.Limited("export") || l.Limited("other") {
+		t.Fatal("Expected only export to be limited")
+	}
+
+	// A request larger than the burst is admitted, leaving the bucket in debt
+	if _, ok := l.Admit("export", 150); !ok {
+		t.Fatal("Expected first request to be admitted")
+	}
+	if direction, ok := l.Admit("export", 1); ok || direction != In {
+		t.Errorf("Expected inbound throttling, got %v %v", direction, ok)
+	}
+
+	// Unlimited namespaces are always admitted
+	if _, ok := l.Admit("other", 1<<30); !ok {
+		t.Error("Expected unlimited namespace to be admitted")
+	}
+}
+
+func TestLimiterOutbound(t *testing.T) {
+	l := New()
+	l.SetQuotas([]Quota{{Namespace: "export", Out: 1000}})
+
+	if _, ok := l.Admit("export", 10); !ok {
+		t.Fatal("Expected first request to be admitted")
+	}
+	l.Charge("export", 1500)
+	if direction, ok := l.Admit("export", 10); ok || direction != Out {
+		t.Errorf("Expected outbound throttling, got %v %v", direction, ok)
+	}
+
+	// The debt is paid back at the configured rate
+	time.Sleep(600 * time.Millisecond)
+	if _, ok := l.Admit("export", 10); !ok {
+		t.Error("Expected request to be admitted after refill")
+	}
+}
+
+func TestParseQuotas(t *testing.T) {
+	quotas, err := ParseQuotas("export=1M:512K, bulk=0:2G")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(quotas) != 2 || quotas[0] != (Quota{"export", 1 << 20, 512 << 10}) || quotas[1] != (Quota{"bulk", 0, 2 << 30}) {
+		t.Errorf("Unexpected quotas %+v", quotas)
+	}
+	if FormatQuotas(quotas) != "export=1048576:524288,bulk=0:2147483648" {
+		t.Errorf("Unexpected formatted quotas %q", FormatQuotas(quotas))
+	}
+
+	for _, spec := range []string{"export", "export=1M", "export=x:1", "a:b=1:1", "export=-1:0"} {
+		if _, err := ParseQuotas(spec); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+}
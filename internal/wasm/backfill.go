@@ -0,0 +1,70 @@
+package wasm
+
+import (
+	"context"
+	"time"
+
+	"pulsedb/internal/store"
+)
+
+// EventSource returns the past events of keys matching pattern between
+// startMs and endMs, both inclusive, ordered by time
+type EventSource func(ctx context.Context, pattern string, startMs, endMs int64) ([]Event, error)
+
+// StoreEvents returns an EventSource replaying the MVCC history of s. Only
+// what retention still keeps can be replayed.
+func StoreEvents(s *store.Store) EventSource {
+	return func(ctx context.Context, pattern string, startMs, endMs int64) ([]Event, error) {
+		history, err := s.Events(ctx, pattern, startMs, endMs)
+		if err != nil {
+			return nil, err
+		}
+		events := make([]Event, len(history))
+		for i, event := range history {
+			events[i] = Event{
+				Type:      string(event.Type),
+				Key:       event.Key,
+				Value:     event.Value,
+				Timestamp: event.Timestamp,
+			}
+		}
+		return events, nil
+	}
+}
+
+// BindFunctionWithBackfill binds a function like BindFunction, after first
+// calling it with every past eventType event on keys matching pattern
+// between startMs and endMs, so that the data it derives does not start
+// empty. An endMs of 0 replays up to the call. It returns the number of
+// events replayed; if one fails, the function is not bound.
+//
+// Events written while the replay runs may be missed: bind before writes
+// to the pattern resume, or replay past them and make the function
+// idempotent.
+func (e *EventHandler) BindFunctionWithBackfill(ctx context.Context, eventType, pattern, funcName string, source EventSource, startMs, endMs int64) (int, error) {
+	if endMs == 0 {
+		endMs = time.Now().UnixMilli()
+	}
+
+	events, err := source(ctx, pattern, startMs, endMs)
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	for _, event := range events {
+		if event.Type != eventType {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return replayed, err
+		}
+		if err := e.call(ctx, funcName, event); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+
+	e.BindFunction(eventType, pattern, funcName)
+	return replayed, nil
+}
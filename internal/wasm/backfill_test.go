@@ -0,0 +1,85 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"pulsedb/internal/store"
+)
+
+// noopModule exports an empty handle_event function and one page of memory
+var noopModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, // magic, version
+	0x01, 0x04, 0x01, 0x60, 0x00, 0x00, // type: () -> ()
+	0x03, 0x02, 0x01, 0x00, // function 0 of type 0
+	0x05, 0x03, 0x01, 0x00, 0x01, // memory of one page
+	0x07, 0x10, 0x01, 0x0c, 'h', 'a', 'n', 'd', 'l', 'e', '_', 'e', 'v', 'e', 'n', 't', 0x00, 0x00,
+	0x0a, 0x04, 0x01, 0x02, 0x00, 0x0b, // empty body
+}
+
+func TestBindFunctionWithBackfill(t *testing.T) {
+	ctx := context.Background()
+	runtime := NewWASMRuntime(ctx)
+	defer runtime.Close(ctx)
+	if err := runtime.LoadFunction(ctx, "noop", noopModule); err != nil {
+		t.Fatalf("LoadFunction failed: %v", err)
+	}
+
+	db := store.NewStore()
+	defer db.Close()
+
+	db.Set("user:1", "a", 0)
+	db.Set("user:1", "b", 0)
+	db.Set("user:2", "c", 0)
+	db.Set("order:1", "d", 0)
+	db.Delete("user:2")
+
+	handler := NewEventHandler(runtime)
+	replayed, err := handler.BindFunctionWithBackfill(ctx, "SET", "user:*", "noop", StoreEvents(db), 0, 0)
+	if err != nil {
+		t.Fatalf("Backfill failed: %v", err)
+	}
+	if replayed != 3 {
+		t.Errorf("Expected 3 SET events replayed, got %d", replayed)
+	}
+	if len(handler.bindings["SET:user:*"]) != 1 {
+		t.Errorf("Expected the function to be bound after the replay, got %v", handler.bindings)
+	}
+
+	replayed, _ = handler.BindFunctionWithBackfill(ctx, "DELETE", "user:*", "noop", StoreEvents(db), 0, 0)
+	if replayed != 1 {
+		t.Errorf("Expected 1 DELETE event replayed, got %d", replayed)
+	}
+
+	future := time.Now().Add(time.Hour).UnixMilli()
+	replayed, _ = handler.BindFunctionWithBackfill(ctx, "SET", "user:*", "noop", StoreEvents(db), future, 0)
+	if replayed != 0 {
+		t.Errorf("Expected nothing replayed outside the time range, got %d", replayed)
+	}
+}
+
+func TestBindFunctionWithBackfillFailure(t *testing.T) {
+	ctx := context.Background()
+	runtime := NewWASMRuntime(ctx)
+	defer runtime.Close(ctx)
+
+	handler := NewEventHandler(runtime)
+	source := func(ctx context.Context, pattern string, startMs, endMs int64) ([]Event, error) {
+		return []Event{{Type: "SET", Key: "user:1"}}, nil
+	}
+	if _, err := handler.BindFunctionWithBackfill(ctx, "SET", "user:*", "missing", source, 0, 0); err == nil {
+		t.Error("Expected the backfill of a missing function to fail")
+	}
+	if len(handler.bindings) != 0 {
+		t.Errorf("Expected no binding after a failed backfill, got %v", handler.bindings)
+	}
+
+	failing := func(ctx context.Context, pattern string, startMs, endMs int64) ([]Event, error) {
+		return nil, errors.New("unavailable")
+	}
+	if _, err := handler.BindFunctionWithBackfill(ctx, "SET", "user:*", "missing", failing, 0, 0); err == nil {
+		t.Error("Expected a failing source to fail the backfill")
+	}
+}
@@ -0,0 +1,195 @@
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+
+	"pulsedb/internal/store"
+)
+
+// HostModule is the module functions import the host functions from. They
+// give functions access to the store of the runtime, see SetStore:
+//
+//	get(key_ptr i32, key_len i32, buf_ptr i32, buf_cap i32) -> i32
+//	set(key_ptr i32, key_len i32, val_ptr i32, val_len i32, ttl_ms i64) -> i32
+//	del(key_ptr i32, key_len i32) -> i32
+//	log(level i32, msg_ptr i32, msg_len i32)
+//
+// Strings are passed as a pointer and length in the memory of the function,
+// which must export it. get returns the length of the value, -1 if the key
+// does not exist or holds a type other than a string; the value is only written to buf if it fits in buf_cap
+// bytes, so a function can call again with a larger buffer. set, with a TTL
+// of 0 for none, returns 0 once written and -1 if the write is refused,
+// e.g. by a validator or because the server is read-only. del returns 1 if
+// the key was deleted, 0 if it did not exist and -1 if refused. log levels
+// are 0 debug, 1 info, 2 warn and 3 error.
+//
+// Scripts can also run commands with call, see RunScript.
+//
+// A call with a string out of the memory of the function, or made while no
+// store is attached, traps and fails the function call.
+const HostModule = "pulsedb"
+
+// SetStore attaches the store the host functions read and write. Call it
+// before functions run.
+func (w *WASMRuntime) SetStore(db *store.Store) {
+	w.store = db
+}
+
+// isolate holds the isolation lock of the store shared while a function
+// runs on its own, as a job or event handler, so its writes never land
+// between the commands of a script, see store.Shared. It returns the
+// function releasing the lock.
+func (w *WASMRuntime) isolate() func() {
+	if w.store == nil {
+		return func() {}
+	}
+	return w.store.Shared()
+}
+
+// instantiateHost instantiates the host module functions import
+func (w *WASMRuntime) instantiateHost(ctx context.Context, r wazero.Runtime) error {
+	_, err := r.NewHostModuleBuilder(HostModule).
+		NewFunctionBuilder().WithFunc(w.hostGet).Export("get").
+		NewFunctionBuilder().WithFunc(w.hostSet).Export("set").
+		NewFunctionBuilder().WithFunc(w.hostDel).Export("del").
+		NewFunctionBuilder().WithFunc(w.hostLog).Export("log").
+		NewFunctionBuilder().WithFunc(w.hostCall).Export("call").
+		Instantiate(ctx)
+	return err
+}
+
+// hostGet implements get, reading a key
+func (w *WASMRuntime) hostGet(ctx context.Context, m api.Module, keyPtr, keyLen, bufPtr, bufCap uint32) int32 {
+	key := readString(m, keyPtr, keyLen)
+	value, exists, err := w.attachedStore().Get(key)
+	if err != nil || !exists {
+		return -1
+	}
+	if uint32(len(value)) <= bufCap {
+		writeBytes(m, bufPtr, []byte(value))
+	}
+	return int32(len(value))
+}
+
+// hostSet implements set, writing a key
+func (w *WASMRuntime) hostSet(ctx context.Context, m api.Module, keyPtr, keyLen, valPtr, valLen uint32, ttlMs int64) int32 {
+	key, value := readString(m, keyPtr, keyLen), readString(m, valPtr, valLen)
+	db := w.attachedStore()
+	if db.ReadOnly() || ttlMs < 0 {
+		return -1
+	}
+	if err := db.Set(key, value, ttlMs); err != nil {
+		return -1
+	}
+	return 0
+}
+
+// hostDel implements del, deleting a key
+func (w *WASMRuntime) hostDel(ctx context.Context, m api.Module, keyPtr, keyLen uint32) int32 {
+	key := readString(m, keyPtr, keyLen)
+	db := w.attachedStore()
+	if db.ReadOnly() {
+		return -1
+	}
+	if db.Delete(key) {
+		return 1
+	}
+	return 0
+}
+
+// hostLog implements log, logging a message of the function
+func (w *WASMRuntime) hostLog(ctx context.Context, m api.Module, level int32, msgPtr, msgLen uint32) {
+	msg := readString(m, msgPtr, msgLen)
+	slevel := slog.LevelInfo
+	switch level {
+	case 0:
+		slevel = slog.LevelDebug
+	case 2:
+		slevel = slog.LevelWarn
+	case 3:
+		slevel = slog.LevelError
+	}
+	slog.Log(ctx, slevel, msg, "function", m.Name())
+}
+
+// attachedStore returns the store of the runtime, trapping the call if
+// none is attached
+func (w *WASMRuntime) attachedStore() *store.Store {
+	if w.store == nil {
+		panic(fmt.Errorf("no store is attached to the WASM runtime"))
+	}
+	return w.store
+}
+
+// memoryOf returns the memory of a module, nil if it has none. Memory
+// returns a typed nil for modules without memory, so the definitions are
+// checked instead.
+func memoryOf(m api.Module) api.Memory {
+	if len(m.ExportedMemoryDefinitions()) == 0 {
+		return nil
+	}
+	return m.Memory()
+}
+
+// readString reads a string from the memory of a module, trapping the call
+// if it is out of range
+func readString(m api.Module, ptr, length uint32) string {
+	memory := memoryOf(m)
+	if memory == nil {
+		panic(fmt.Errorf("function %s does not export its memory", m.Name()))
+	}
+	b, ok := memory.Read(ptr, length)
+	if !ok {
+		panic(fmt.Errorf("function %s passed a string out of its memory", m.Name()))
+	}
+	return string(b)
+}
+
+// writeBytes writes to the memory of a module, trapping the call if out of
+// range
+func writeBytes(m api.Module, ptr uint32, b []byte) {
+	memory := memoryOf(m)
+	if memory == nil || !memory.Write(ptr, b) {
+		panic(fmt.Errorf("function %s passed a buffer out of its memory", m.Name()))
+	}
+}
+
+// exchange writes input to the memory of a function, where its alloc export
+// makes room, calls method with where it was written, and returns what the
+// method returns as ptr<<32 | len, nil for 0. The caller must hold the
+// function lock.
+func (w *WASMRuntime) exchange(ctx context.Context, f *function, method string, input []byte) ([]byte, error) {
+	results, err := w.call(ctx, f, "alloc", uint64(len(input)))
+	if err != nil {
+		return nil, err
+	}
+	memory := memoryOf(f.module)
+	if memory == nil {
+		return nil, fmt.Errorf("function %s does not export its memory", f.name)
+	}
+	ptr := uint32(results[0])
+	if !memory.Write(ptr, input) {
+		return nil, fmt.Errorf("function %s allocated out of its memory", f.name)
+	}
+
+	results, err = w.call(ctx, f, method, uint64(ptr), uint64(len(input)))
+	if err != nil {
+		return nil, err
+	}
+	packed := results[0]
+	if packed == 0 {
+		return nil, nil
+	}
+	output, ok := memory.Read(uint32(packed>>32), uint32(packed))
+	if !ok {
+		return nil, fmt.Errorf("function %s returned data out of its memory", f.name)
+	}
+	// The view is only valid until the next call
+	return bytes.Clone(output), nil
+}
@@ -0,0 +1,112 @@
+package wasm
+
+import (
+	"context"
+	"testing"
+
+	"pulsedb/internal/store"
+)
+
+// hostModule imports the host functions and exports its memory, holding
+// "key" at 0 and "hello" at 8, and set, get, del and log functions calling
+// them on key:
+//
+//	set: set(0, 3, 8, 5, 0)
+//	get: get(0, 3, 16, 32)
+//	del: del(0, 3)
+//	log: log(1, 8, 5), returning 0
+var hostModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, // magic, version
+	0x01, 0x22, 0x05, // types
+	0x60, 0x04, 0x7f, 0x7f, 0x7f, 0x7f, 0x01, 0x7f, // get: (i32, i32, i32, i32) -> i32
+	0x60, 0x05, 0x7f, 0x7f, 0x7f, 0x7f, 0x7e, 0x01, 0x7f, // set: (i32, i32, i32, i32, i64) -> i32
+	0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7f, // del: (i32, i32) -> i32
+	0x60, 0x03, 0x7f, 0x7f, 0x7f, 0x00, // log: (i32, i32, i32) -> ()
+	0x60, 0x00, 0x01, 0x7f, // exports: () -> i32
+	0x02, 0x39, 0x04, // imports of functions 0 to 3
+	0x07, 'p', 'u', 'l', 's', 'e', 'd', 'b', 0x03, 'g', 'e', 't', 0x00, 0x00,
+	0x07, 'p', 'u', 'l', 's', 'e', 'd', 'b', 0x03, 's', 'e', 't', 0x00, 0x01,
+	0x07, 'p', 'u', 'l', 's', 'e', 'd', 'b', 0x03, 'd', 'e', 'l', 0x00, 0x02,
+	0x07, 'p', 'u', 'l', 's', 'e', 'd', 'b', 0x03, 'l', 'o', 'g', 0x00, 0x03,
+	0x03, 0x05, 0x04, 0x04, 0x04, 0x04, 0x04, // functions 4 to 7 of type 4
+	0x05, 0x03, 0x01, 0x00, 0x01, // memory of one page
+	0x07, 0x22, 0x05,
+	0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x00,
+	0x03, 's', 'e', 't', 0x00, 0x04,
+	0x03, 'g', 'e', 't', 0x00, 0x05,
+	0x03, 'd', 'e', 'l', 0x00, 0x06,
+	0x03, 'l', 'o', 'g', 0x00, 0x07,
+	0x0a, 0x33, 0x04, // code
+	0x0e, 0x00, 0x41, 0x00, 0x41, 0x03, 0x41, 0x08, 0x41, 0x05, 0x42, 0x00, 0x10, 0x01, 0x0b,
+	0x0c, 0x00, 0x41, 0x00, 0x41, 0x03, 0x41, 0x10, 0x41, 0x20, 0x10, 0x00, 0x0b,
+	0x08, 0x00, 0x41, 0x00, 0x41, 0x03, 0x10, 0x02, 0x0b,
+	0x0c, 0x00, 0x41, 0x01, 0x41, 0x08, 0x41, 0x05, 0x10, 0x03, 0x41, 0x00, 0x0b,
+	0x0b, 0x13, 0x02, // data
+	0x00, 0x41, 0x00, 0x0b, 0x03, 'k', 'e', 'y',
+	0x00, 0x41, 0x08, 0x0b, 0x05, 'h', 'e', 'l', 'l', 'o',
+}
+
+func TestHostFunctions(t *testing.T) {
+	ctx := context.Background()
+	runtime := NewWASMRuntime(ctx)
+	defer runtime.Close(ctx)
+	if err := runtime.LoadFunction(ctx, "host", hostModule); err != nil {
+		t.Fatalf("LoadFunction failed: %v", err)
+	}
+
+	call := func(method string) int32 {
+		t.Helper()
+		results, err := runtime.ExecuteFunction(ctx, "host", method)
+		if err != nil {
+			t.Fatalf("%s failed: %v", method, err)
+		}
+		return int32(results[0])
+	}
+
+	if _, err := runtime.ExecuteFunction(ctx, "host", "get"); err == nil {
+		t.Error("Expected host functions to fail without a store")
+	}
+
+	db := store.NewStore()
+	defer db.Close()
+	runtime.SetStore(db)
+
+	if n := call("get"); n != -1 {
+		t.Errorf("Expected a missing key, got %d", n)
+	}
+	if status := call("set"); status != 0 {
+		t.Fatalf("Expected set to succeed, got %d", status)
+	}
+	if value, _, _ := db.Get("key"); value != "hello" {
+		t.Errorf("Expected the function to set key, got %q", value)
+	}
+
+	db.Set("key", "world", 0)
+	if n := call("get"); n != 5 {
+		t.Fatalf("Expected a value of 5 bytes, got %d", n)
+	}
+	memory := memoryOf(runtime.functions["host"].module)
+	if value, _ := memory.Read(16, 5); string(value) != "world" {
+		t.Errorf("Expected the value written to the buffer, got %q", value)
+	}
+
+	if status := call("log"); status != 0 {
+		t.Errorf("Expected log to succeed, got %d", status)
+	}
+
+	db.SetReadOnly(true)
+	if status := call("set"); status != -1 {
+		t.Errorf("Expected set to be refused in read-only mode, got %d", status)
+	}
+	if status := call("del"); status != -1 {
+		t.Errorf("Expected del to be refused in read-only mode, got %d", status)
+	}
+	db.SetReadOnly(false)
+
+	if deleted := call("del"); deleted != 1 {
+		t.Errorf("Expected key to be deleted, got %d", deleted)
+	}
+	if deleted := call("del"); deleted != 0 {
+		t.Errorf("Expected no key left to delete, got %d", deleted)
+	}
+}
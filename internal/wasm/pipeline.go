@@ -0,0 +1,63 @@
+package wasm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"pulsedb/internal/streams"
+)
+
+// Stream transforms exchange entries with WASM functions through their
+// linear memory. A transform module exports its memory and:
+//
+//	alloc(size i32) -> i32
+//	transform(ptr i32, len i32) -> i64
+//
+// The host calls alloc for room to write the fields of an entry as a JSON
+// object, then transform with where it wrote them. transform returns where
+// it wrote the fields to keep, also as a JSON object of strings, packed as
+// ptr<<32 | len; 0 drops the entry.
+
+// BindStream attaches a loaded function to a stream as its pipeline, see
+// streams.StreamManager.SetPipeline. With a target, entries are stored
+// unchanged and the transformed ones appended to the target stream.
+func (w *WASMRuntime) BindStream(sm *streams.StreamManager, stream, funcName, target string) error {
+	if err := w.checkExports(funcName, "to transform stream entries", true, "alloc", "transform"); err != nil {
+		return err
+	}
+
+	return sm.SetPipeline(stream, funcName, w.StreamTransform(funcName), target)
+}
+
+// StreamTransform returns a stream pipeline transform running a function
+func (w *WASMRuntime) StreamTransform(funcName string) streams.Transform {
+	return func(fields map[string]string) (map[string]string, bool, error) {
+		input, err := json.Marshal(fields)
+		if err != nil {
+			return nil, false, err
+		}
+
+		f, err := w.function(funcName)
+		if err != nil {
+			return nil, false, err
+		}
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		output, err := w.exchange(context.Background(), f, "transform", input)
+		if err != nil {
+			return nil, false, err
+		}
+		if output == nil {
+			return nil, false, nil
+		}
+
+		var out map[string]string
+		if err := json.Unmarshal(output, &out); err != nil {
+			return nil, false, fmt.Errorf("function %s returned invalid fields: %w", funcName, err)
+		}
+		return out, true, nil
+	}
+}
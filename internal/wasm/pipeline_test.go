@@ -0,0 +1,99 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"pulsedb/internal/streams"
+)
+
+// transformModule builds a module exporting its memory, an alloc always
+// returning offset 1024, and a transform with the given body
+func transformModule(transformBody ...byte) []byte {
+	module := []byte{
+		0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, // magic, version
+		0x01, 0x0c, 0x02, 0x60, 0x01, 0x7f, 0x01, 0x7f, 0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7e, // types: (i32) -> i32, (i32, i32) -> i64
+		0x03, 0x03, 0x02, 0x00, 0x01, // alloc of type 0, transform of type 1
+		0x05, 0x03, 0x01, 0x00, 0x01, // memory of one page
+		0x07, 0x1e, 0x03,
+		0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x00,
+		0x05, 'a', 'l', 'l', 'o', 'c', 0x00, 0x00,
+		0x09, 't', 'r', 'a', 'n', 's', 'f', 'o', 'r', 'm', 0x00, 0x01,
+	}
+	alloc := []byte{0x05, 0x00, 0x41, 0x80, 0x08, 0x0b} // i32.const 1024
+	transform := append([]byte{byte(len(transformBody) + 1), 0x00}, transformBody...)
+	code := append([]byte{0x02}, append(alloc, transform...)...)
+	module = append(module, 0x0a, byte(len(code)))
+	return append(module, code...)
+}
+
+// identityModule returns the entry it is given: ptr<<32 | len
+var identityModule = transformModule(0x20, 0x00, 0xad, 0x42, 0x20, 0x86, 0x20, 0x01, 0xad, 0x84, 0x0b)
+
+// dropModule drops every entry by returning 0
+var dropModule = transformModule(0x42, 0x00, 0x0b)
+
+func TestBindStream(t *testing.T) {
+	ctx := context.Background()
+	runtime := NewWASMRuntime(ctx)
+	defer runtime.Close(ctx)
+	for name, module := range map[string][]byte{"identity": identityModule, "drop": dropModule, "noop": noopModule} {
+		if err := runtime.LoadFunction(ctx, name, module); err != nil {
+			t.Fatalf("LoadFunction %s failed: %v", name, err)
+		}
+	}
+
+	sm := streams.NewStreamManager()
+	if err := runtime.BindStream(sm, "events", "noop", ""); err == nil {
+		t.Error("Expected a function without alloc and transform to be refused")
+	}
+	if err := runtime.BindStream(sm, "events", "missing", ""); err == nil {
+		t.Error("Expected a missing function to be refused")
+	}
+
+	if err := runtime.BindStream(sm, "events", "identity", "events:copy"); err != nil {
+		t.Fatal(err)
+	}
+	if err := runtime.BindStream(sm, "events:copy", "drop", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sm.AddEntry("events", map[string]string{"user": "1", "action": "login"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := sm.Range("events", "", "", 0, false); len(entries) != 1 || entries[0].Fields["action"] != "login" {
+		t.Errorf("Expected the source entry stored, got %+v", entries)
+	}
+
+	// The copy passed through identity, then was dropped by the pipeline of
+	// the derived stream
+	if _, err := sm.Range("events:copy", "", "", 0, false); err == nil {
+		t.Error("Expected no derived entry to be stored")
+	}
+	if _, err := sm.AddEntry("events:copy", map[string]string{"user": "2"}, ""); !errors.Is(err, streams.ErrDropped) {
+		t.Errorf("Expected the drop function to drop entries, got %v", err)
+	}
+
+	info := sm.Pipelines()
+	if len(info) != 2 || info[0].Processed != 1 || info[1].Dropped != 2 {
+		t.Errorf("Unexpected pipeline counters %+v", info)
+	}
+}
+
+func TestStreamTransform(t *testing.T) {
+	ctx := context.Background()
+	runtime := NewWASMRuntime(ctx)
+	defer runtime.Close(ctx)
+	if err := runtime.LoadFunction(ctx, "identity", identityModule); err != nil {
+		t.Fatal(err)
+	}
+
+	out, keep, err := runtime.StreamTransform("identity")(map[string]string{"a": "1", "b": "two"})
+	if err != nil || !keep || out["a"] != "1" || out["b"] != "two" {
+		t.Errorf("Expected the fields back, got %v %v %v", out, keep, err)
+	}
+	if _, _, err := runtime.StreamTransform("missing")(map[string]string{}); err == nil {
+		t.Error("Expected a missing function to fail")
+	}
+}
@@ -2,60 +2,304 @@ package wasm
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/tetratelabs/wazero"
 	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/sys"
+
+	"pulsedb/internal/metrics"
+	"pulsedb/internal/store"
 )
 
 // WASMRuntime manages WASM function execution
 type WASMRuntime struct {
-	runtime wazero.Runtime
-	modules map[string]api.Module
+	runtime   wazero.Runtime
+	functions map[string]*function
+	limits    Limits
+	metrics   *metrics.Metrics // Optional, records every call
+	store     *store.Store     // Read and written by the host functions
+
+	loadMu sync.Mutex   // Serialises loads and unloads
+	mu     sync.RWMutex // Guards functions
+}
+
+// function is a loaded function. Its module runs one call at a time, so
+// calls lock the function: calls of different functions run concurrently,
+// and a function can call commands running other functions.
+type function struct {
+	name     string
+	compiled wazero.CompiledModule // To instantiate the function again
+	module   api.Module            // nil if it failed to instantiate again
+
+	mu sync.Mutex // Serialises calls
 }
 
-// NewWASMRuntime creates a new WASM runtime
+// Limits sandbox the functions of a runtime, so a buggy function can
+// neither hang nor exhaust the memory of the server. wazero has no fuel
+// metering, so the timeout also bounds CPU: a call is interrupted at its
+// next function call or loop iteration once it expires.
+type Limits struct {
+	Timeout        time.Duration // Wall-clock time of a call, 0 for no limit
+	MaxMemoryPages uint32        // Linear memory of a function in 64 KiB pages, 0 for the 4 GiB of WASM
+}
+
+// NewWASMRuntime creates a new WASM runtime without limits
 func NewWASMRuntime(ctx context.Context) *WASMRuntime {
-	r := wazero.NewRuntime(ctx)
+	return NewWASMRuntimeWithLimits(ctx, Limits{})
+}
+
+// NewWASMRuntimeWithLimits creates a new WASM runtime running functions
+// within limits, with the host module functions can import. A function
+// interrupted by the timeout loses its state: it is instantiated again for
+// the next call.
+func NewWASMRuntimeWithLimits(ctx context.Context, limits Limits) *WASMRuntime {
+	config := wazero.NewRuntimeConfig().WithCloseOnContextDone(true)
+	if limits.MaxMemoryPages > 0 {
+		config = config.WithMemoryLimitPages(limits.MaxMemoryPages)
+	}
+	r := wazero.NewRuntimeWithConfig(ctx, config)
 
-	return &WASMRuntime{
-		runtime: r,
-		modules: make(map[string]api.Module),
+	w := &WASMRuntime{
+		runtime:   r,
+		functions: make(map[string]*function),
+		limits:    limits,
 	}
+	if err := w.instantiateHost(ctx, r); err != nil {
+		// The host module is fixed, so only a bug makes it fail
+		panic(fmt.Sprintf("failed to instantiate WASM host module: %v", err))
+	}
+	return w
+}
+
+// SetMetrics makes the runtime record the invocations, errors, duration and
+// memory of every function call
+func (w *WASMRuntime) SetMetrics(m *metrics.Metrics) {
+	w.metrics = m
 }
 
-// LoadFunction loads a WASM function from bytecode
+// LoadFunction loads a WASM function from bytecode, replacing any function
+// of the same name once its running call completes
 func (w *WASMRuntime) LoadFunction(ctx context.Context, name string, wasmBytes []byte) error {
-	module, err := w.runtime.Instantiate(ctx, wasmBytes)
+	compiled, err := w.runtime.CompileModule(ctx, wasmBytes)
+	if err != nil {
+		return fmt.Errorf("failed to compile WASM module %s: %w", name, err)
+	}
+
+	w.loadMu.Lock()
+	defer w.loadMu.Unlock()
+
+	// Module names are unique within the runtime, so the previous function
+	// is closed first. A running call may be calling commands running other
+	// functions, so the map is not locked while waiting for it.
+	w.unload(ctx, name)
+
+	f := &function{name: name, compiled: compiled}
+	if err := w.instantiate(ctx, f); err != nil {
+		compiled.Close(ctx)
+		return err
+	}
+
+	w.mu.Lock()
+	w.functions[name] = f
+	w.mu.Unlock()
+	return nil
+}
+
+// UnloadFunction removes a function once its running call completes,
+// reporting whether it was loaded
+func (w *WASMRuntime) UnloadFunction(ctx context.Context, name string) bool {
+	w.loadMu.Lock()
+	defer w.loadMu.Unlock()
+	return w.unload(ctx, name)
+}
+
+// unload removes a function; the caller must hold the load lock
+func (w *WASMRuntime) unload(ctx context.Context, name string) bool {
+	w.mu.Lock()
+	f, exists := w.functions[name]
+	delete(w.functions, name)
+	w.mu.Unlock()
+
+	if exists {
+		f.close(ctx)
+	}
+	return exists
+}
+
+// close closes the module and compiled code of a function
+func (f *function) close(ctx context.Context) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.module != nil {
+		f.module.Close(ctx)
+		f.module = nil
+	}
+	f.compiled.Close(ctx)
+}
+
+// instantiate instantiates a function from its compiled code, within the
+// timeout for its start function. Module names name the function in the
+// logs of the host module. The caller must hold the function lock, or own
+// the function before it is shared.
+func (w *WASMRuntime) instantiate(ctx context.Context, f *function) error {
+	if w.limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.limits.Timeout)
+		defer cancel()
+	}
+	module, err := w.runtime.InstantiateModule(ctx, f.compiled, wazero.NewModuleConfig().WithName(f.name))
 	if err != nil {
-		return fmt.Errorf("failed to instantiate WASM module %s: %w", name, err)
+		return fmt.Errorf("failed to instantiate WASM module %s: %w", f.name, err)
+	}
+	f.module = module
+	return nil
+}
+
+// function returns a loaded function
+func (w *WASMRuntime) function(name string) (*function, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	f, exists := w.functions[name]
+	if !exists {
+		return nil, fmt.Errorf("function %s not found", name)
 	}
+	return f, nil
+}
 
-	w.modules[name] = module
+// checkExports checks that a loaded function exports methods, needed for
+// purpose, and its memory if memory is set
+func (w *WASMRuntime) checkExports(name, purpose string, memory bool, methods ...string) error {
+	f, err := w.function(name)
+	if err != nil {
+		return err
+	}
+	exported := f.compiled.ExportedFunctions()
+	for _, method := range methods {
+		if _, exists := exported[method]; !exists {
+			return fmt.Errorf("function %s does not export %s, needed %s", name, method, purpose)
+		}
+	}
+	if memory && len(f.compiled.ExportedMemories()) == 0 {
+		return fmt.Errorf("function %s does not export its memory, needed %s", name, purpose)
+	}
 	return nil
 }
 
+// LoadDir loads every .wasm file of a directory as a function named after
+// the file, without its extension, and returns the names loaded
+func (w *WASMRuntime) LoadDir(ctx context.Context, dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.wasm"))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(paths))
+	for _, path := range paths {
+		wasmBytes, err := os.ReadFile(path)
+		if err != nil {
+			return names, err
+		}
+		name := strings.TrimSuffix(filepath.Base(path), ".wasm")
+		if err := w.LoadFunction(ctx, name, wasmBytes); err != nil {
+			return names, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
 // ExecuteFunction executes a WASM function
 func (w *WASMRuntime) ExecuteFunction(ctx context.Context, funcName, methodName string, args ...uint64) ([]uint64, error) {
-	module, exists := w.modules[funcName]
-	if !exists {
-		return nil, fmt.Errorf("function %s not found", funcName)
+	f, err := w.function(funcName)
+	if err != nil {
+		return nil, err
 	}
 
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return w.call(ctx, f, methodName, args...)
+}
+
+// call runs a method of a function; the caller must hold the function lock
+func (w *WASMRuntime) call(ctx context.Context, f *function, methodName string, args ...uint64) ([]uint64, error) {
+	module := f.module
+	if module == nil {
+		return nil, fmt.Errorf("function %s failed to start again after an interrupted call", f.name)
+	}
 	fn := module.ExportedFunction(methodName)
 	if fn == nil {
-		return nil, fmt.Errorf("method %s not found in function %s", methodName, funcName)
+		return nil, fmt.Errorf("method %s not found in function %s", methodName, f.name)
+	}
+
+	callCtx := ctx
+	if w.limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, w.limits.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	results, err := fn.Call(callCtx, args...)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+		reason := failureReason(err)
+		w.metrics.IncrementWASMFailures(f.name, reason)
+		if reason == "timeout" {
+			err = fmt.Errorf("function %s timed out after %s: %w", f.name, w.limits.Timeout, err)
+		}
+	}
+	var memory uint32
+	if mem := memoryOf(module); mem != nil {
+		memory = mem.Size()
+	}
+	w.metrics.ObserveWASMCall(f.name, methodName, status, time.Since(start).Seconds(), memory)
+
+	// An interrupted call closes the module, so start the function afresh
+	// for the next call
+	if module.IsClosed() {
+		f.module = nil
+		if reloadErr := w.instantiate(context.Background(), f); reloadErr != nil {
+			return nil, errors.Join(err, reloadErr)
+		}
 	}
+	return results, err
+}
 
-	return fn.Call(ctx, args...)
+// failureReason classifies the error of a call for the failure metrics:
+// "timeout" when the timeout interrupted it, "canceled" when its context
+// was canceled, and "trap" for the rest, such as out-of-bounds accesses,
+// failed memory growth or host function errors
+func failureReason(err error) string {
+	var exitErr *sys.ExitError
+	if errors.As(err, &exitErr) {
+		switch exitErr.ExitCode() {
+		case sys.ExitCodeDeadlineExceeded:
+			return "timeout"
+		case sys.ExitCodeContextCanceled:
+			return "canceled"
+		}
+	}
+	return "trap"
 }
 
 // Close closes the WASM runtime
 func (w *WASMRuntime) Close(ctx context.Context) error {
-	for _, module := range w.modules {
-		if err := module.Close(ctx); err != nil {
-			return err
-		}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, f := range w.functions {
+		f.close(ctx)
 	}
 	return w.runtime.Close(ctx)
 }
@@ -96,14 +340,24 @@ func (e *EventHandler) TriggerEvent(ctx context.Context, event Event) error {
 
 	if functions, exists := e.bindings[key]; exists {
 		for _, funcName := range functions {
-			// Execute the function with event data
-			// This is simplified - real implementation would pass event data properly
-			_, err := e.runtime.ExecuteFunction(ctx, funcName, "handle_event")
-			if err != nil {
-				return fmt.Errorf("failed to execute function %s for event %s: %w", funcName, event.Type, err)
+			if err := e.call(ctx, funcName, event); err != nil {
+				return err
 			}
 		}
 	}
 
 	return nil
 }
+
+// call runs the event handler of a function for one event
+func (e *EventHandler) call(ctx context.Context, funcName string, event Event) error {
+	// Execute the function with event data
+	// This is simplified - real implementation would pass event data properly
+	release := e.runtime.isolate()
+	_, err := e.runtime.ExecuteFunction(ctx, funcName, "handle_event")
+	release()
+	if err != nil {
+		return fmt.Errorf("failed to execute function %s for event %s: %w", funcName, event.Type, err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package wasm
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// spinModule exports a run function looping forever
+var spinModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, // magic, version
+	0x01, 0x04, 0x01, 0x60, 0x00, 0x00, // type: () -> ()
+	0x03, 0x02, 0x01, 0x00, // function 0 of type 0
+	0x07, 0x07, 0x01, 0x03, 'r', 'u', 'n', 0x00, 0x00,
+	0x0a, 0x09, 0x01, 0x07, 0x00, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x0b, // loop br 0 end
+}
+
+// bigMemoryModule declares a memory of two pages
+var bigMemoryModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, // magic, version
+	0x05, 0x03, 0x01, 0x00, 0x02, // memory of two pages
+}
+
+func TestLimits(t *testing.T) {
+	ctx := context.Background()
+	runtime := NewWASMRuntimeWithLimits(ctx, Limits{Timeout: 50 * time.Millisecond, MaxMemoryPages: 1})
+	defer runtime.Close(ctx)
+
+	if err := runtime.LoadFunction(ctx, "big", bigMemoryModule); err == nil {
+		t.Error("Expected a function exceeding the memory limit to be refused")
+	}
+
+	for name, module := range map[string][]byte{"spin": spinModule, "answer": answerModule} {
+		if err := runtime.LoadFunction(ctx, name, module); err != nil {
+			t.Fatalf("LoadFunction %s failed: %v", name, err)
+		}
+	}
+
+	// The interrupted function is instantiated again, so it times out
+	// again rather than failing as closed
+	for range 2 {
+		start := time.Now()
+		_, err := runtime.ExecuteFunction(ctx, "spin", "run")
+		if err == nil || !strings.Contains(err.Error(), "timed out") {
+			t.Fatalf("Expected a timeout, got %v", err)
+		}
+		if failureReason(err) != "timeout" {
+			t.Errorf("Expected a timeout failure, got %s", failureReason(err))
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Expected the call to be interrupted, took %s", elapsed)
+		}
+	}
+
+	if results, err := runtime.ExecuteFunction(ctx, "answer", "run"); err != nil || results[0] != 42 {
+		t.Errorf("Expected other functions to keep running, got %v %v", results, err)
+	}
+}
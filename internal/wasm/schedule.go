@@ -0,0 +1,150 @@
+package wasm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule decides when a scheduled job runs
+type Schedule interface {
+	// Next returns the first run time after t, or the zero time if the
+	// job never runs again
+	Next(t time.Time) time.Time
+}
+
+// ParseSchedule parses a schedule: "@every <duration>" for a fixed
+// interval, e.g. "@every 30s", or a cron expression of five fields,
+// minute hour day-of-month month day-of-week, e.g. "*/5 * * * *". Fields
+// take "*", values, ranges "a-b", lists "a,b" and steps "*/n" or "a-b/n".
+// Days of the week run from 0 (Sunday) to 6; 7 is Sunday too. As in cron,
+// when both day fields are restricted a day matching either runs the job.
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || every < time.Second {
+			return nil, fmt.Errorf("invalid interval '%s', expected a duration of at least 1s", rest)
+		}
+		return intervalSchedule(every), nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule '%s', expected @every <duration> or 5 cron fields", spec)
+	}
+
+	var c cronSchedule
+	var err error
+	bounds := []struct {
+		set      *uint64
+		min, max int
+	}{
+		{&c.minute, 0, 59},
+		{&c.hour, 0, 23},
+		{&c.dom, 1, 31},
+		{&c.month, 1, 12},
+		{&c.dow, 0, 7},
+	}
+	for i, b := range bounds {
+		if *b.set, err = parseCronField(fields[i], b.min, b.max); err != nil {
+			return nil, fmt.Errorf("invalid cron field '%s': %w", fields[i], err)
+		}
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAny, c.dowAny = strings.HasPrefix(fields[2], "*"), strings.HasPrefix(fields[4], "*")
+	return c, nil
+}
+
+// parseCronField parses one cron field into a bit set of its values
+func parseCronField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step '%s'", stepPart)
+			}
+		}
+
+		lo, hi := min, max
+		if rangePart != "*" {
+			loPart, hiPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = strconv.Atoi(loPart); err != nil {
+				return 0, fmt.Errorf("invalid value '%s'", loPart)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(hiPart); err != nil {
+					return 0, fmt.Errorf("invalid value '%s'", hiPart)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("'%s' is out of range %d-%d", rangePart, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// intervalSchedule runs a job at a fixed interval
+type intervalSchedule time.Duration
+
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+// cronSchedule runs a job at the minutes matching every field, in the
+// local time zone
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+// cronHorizon bounds the search for the next run, for expressions never
+// matching, such as February 30th
+const cronHorizon = 5 * 366 * 24 * time.Hour
+
+func (c cronSchedule) Next(t time.Time) time.Time {
+	next := t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(cronHorizon)
+
+	// Skip whole months, days and hours that do not match before minutes
+	for next.Before(limit) {
+		switch {
+		case c.month&(1<<next.Month()) == 0:
+			next = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, next.Location())
+		case !c.dayMatches(next):
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, next.Location())
+		case c.hour&(1<<next.Hour()) == 0:
+			next = time.Date(next.Year(), next.Month(), next.Day(), next.Hour()+1, 0, 0, 0, next.Location())
+		case c.minute&(1<<next.Minute()) == 0:
+			next = next.Add(time.Minute)
+		default:
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches reports whether the day of t matches the day fields
+func (c cronSchedule) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<t.Weekday()) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,55 @@
+package wasm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@every 100ms",
+		"@every soon",
+	} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("Expected %q to be refused", spec)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	base := time.Date(2024, time.January, 31, 10, 7, 30, 0, time.UTC) // A Wednesday
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"@every 90s", base.Add(90 * time.Second)},
+		{"* * * * *", time.Date(2024, time.January, 31, 10, 8, 0, 0, time.UTC)},
+		{"*/5 * * * *", time.Date(2024, time.January, 31, 10, 10, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2024, time.January, 31, 13, 0, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2024, time.February, 1, 2, 30, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2024, time.February, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, time.February, 4, 0, 0, 0, 0, time.UTC)},
+		// Either day field matches when both are restricted
+		{"0 0 15 * 5", time.Date(2024, time.February, 2, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		schedule, err := ParseSchedule(tt.spec)
+		if err != nil {
+			t.Fatalf("ParseSchedule(%q) failed: %v", tt.spec, err)
+		}
+		if got := schedule.Next(base); !got.Equal(tt.want) {
+			t.Errorf("%q: expected next run %v, got %v", tt.spec, tt.want, got)
+		}
+	}
+}
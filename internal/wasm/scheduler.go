@@ -0,0 +1,179 @@
+package wasm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// JobMethod is the method of a function a scheduled job calls
+const JobMethod = "run"
+
+// scheduledJob calls the run method of a function on a schedule
+type scheduledJob struct {
+	Name     string
+	Spec     string // Schedule as given to ParseSchedule
+	Function string
+
+	schedule Schedule
+	timer    *time.Timer
+
+	// Run state, guarded by the scheduler lock
+	next         time.Time
+	runs         int64
+	failures     int64
+	lastRun      time.Time
+	lastDuration time.Duration
+	lastResult   []uint64
+	lastError    string
+}
+
+// JobInfo is the state of a scheduled job
+type JobInfo struct {
+	Name         string
+	Spec         string
+	Function     string
+	Next         time.Time // Zero if the job never runs again
+	Runs         int64
+	Failures     int64
+	LastRun      time.Time // Zero before the first run
+	LastDuration time.Duration
+	LastResult   []uint64 // Values returned by the last successful run
+	LastError    string   // Error of the last run, empty if it succeeded
+}
+
+// Scheduler runs scheduled jobs calling WASM functions. A job runs at
+// most once at a time: a run taking longer than the interval delays the
+// next one. It is safe for concurrent use.
+type Scheduler struct {
+	runtime *WASMRuntime
+	mu      sync.Mutex
+	jobs    map[string]*scheduledJob
+	closed  bool
+}
+
+// NewScheduler creates a scheduler calling the functions of runtime
+func NewScheduler(runtime *WASMRuntime) *Scheduler {
+	return &Scheduler{runtime: runtime, jobs: make(map[string]*scheduledJob)}
+}
+
+// Create schedules a job calling the run method of a loaded function
+func (s *Scheduler) Create(name, spec, funcName string) error {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return err
+	}
+
+	if err := s.runtime.checkExports(funcName, "by scheduled jobs", false, JobMethod); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("scheduler is closed")
+	}
+	if _, exists := s.jobs[name]; exists {
+		return fmt.Errorf("job %s already exists", name)
+	}
+
+	job := &scheduledJob{Name: name, Spec: spec, Function: funcName, schedule: schedule}
+	s.jobs[name] = job
+	s.schedule(job, time.Now())
+	return nil
+}
+
+// Delete removes a job, reporting whether it existed. A run in progress
+// completes.
+func (s *Scheduler) Delete(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, exists := s.jobs[name]
+	if !exists {
+		return false
+	}
+	if job.timer != nil {
+		job.timer.Stop()
+	}
+	delete(s.jobs, name)
+	return true
+}
+
+// List returns the state of every job by name
+func (s *Scheduler) List() []JobInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]JobInfo, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		result = append(result, JobInfo{
+			Name:         job.Name,
+			Spec:         job.Spec,
+			Function:     job.Function,
+			Next:         job.next,
+			Runs:         job.runs,
+			Failures:     job.failures,
+			LastRun:      job.lastRun,
+			LastDuration: job.lastDuration,
+			LastResult:   job.lastResult,
+			LastError:    job.lastError,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Close stops every job; runs in progress complete
+func (s *Scheduler) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for _, job := range s.jobs {
+		if job.timer != nil {
+			job.timer.Stop()
+		}
+	}
+}
+
+// schedule arms the timer of the job's next run after now. The caller
+// must hold the lock.
+func (s *Scheduler) schedule(job *scheduledJob, now time.Time) {
+	job.next = job.schedule.Next(now)
+	if job.next.IsZero() {
+		return
+	}
+	job.timer = time.AfterFunc(job.next.Sub(now), func() { s.run(job) })
+}
+
+// run calls the job's function, records the outcome and schedules the next
+// run
+func (s *Scheduler) run(job *scheduledJob) {
+	start := time.Now()
+	release := s.runtime.isolate()
+	results, err := s.runtime.ExecuteFunction(context.Background(), job.Function, JobMethod)
+	release()
+	elapsed := time.Since(start)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job.runs++
+	job.lastRun, job.lastDuration = start, elapsed
+	if err != nil {
+		job.failures++
+		job.lastError = err.Error()
+	} else {
+		job.lastResult, job.lastError = results, ""
+	}
+
+	// A job deleted while it ran is not scheduled again
+	if s.closed || s.jobs[job.Name] != job {
+		return
+	}
+	s.schedule(job, time.Now())
+}
@@ -0,0 +1,83 @@
+package wasm
+
+import (
+	"context"
+	"testing"
+)
+
+// answerModule exports a run function returning 42
+var answerModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, // magic, version
+	0x01, 0x05, 0x01, 0x60, 0x00, 0x01, 0x7e, // type: () -> i64
+	0x03, 0x02, 0x01, 0x00, // function 0 of type 0
+	0x07, 0x07, 0x01, 0x03, 'r', 'u', 'n', 0x00, 0x00,
+	0x0a, 0x06, 0x01, 0x04, 0x00, 0x42, 0x2a, 0x0b, // i64.const 42
+}
+
+// trapModule exports a run function that traps
+var trapModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, // magic, version
+	0x01, 0x04, 0x01, 0x60, 0x00, 0x00, // type: () -> ()
+	0x03, 0x02, 0x01, 0x00, // function 0 of type 0
+	0x07, 0x07, 0x01, 0x03, 'r', 'u', 'n', 0x00, 0x00,
+	0x0a, 0x05, 0x01, 0x03, 0x00, 0x00, 0x0b, // unreachable
+}
+
+func TestScheduler(t *testing.T) {
+	ctx := context.Background()
+	runtime := NewWASMRuntime(ctx)
+	defer runtime.Close(ctx)
+	for name, module := range map[string][]byte{"answer": answerModule, "trap": trapModule, "noop": noopModule} {
+		if err := runtime.LoadFunction(ctx, name, module); err != nil {
+			t.Fatalf("LoadFunction %s failed: %v", name, err)
+		}
+	}
+
+	s := NewScheduler(runtime)
+	defer s.Close()
+
+	if err := s.Create("job", "* * * * *", "noop"); err == nil {
+		t.Error("Expected a function without run to be refused")
+	}
+	if err := s.Create("job", "* * * * *", "missing"); err == nil {
+		t.Error("Expected a missing function to be refused")
+	}
+	if err := s.Create("job", "every minute", "answer"); err == nil {
+		t.Error("Expected an invalid schedule to be refused")
+	}
+
+	if err := s.Create("answer", "*/5 * * * *", "answer"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Create("trap", "@every 1h", "trap"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Create("answer", "* * * * *", "answer"); err == nil {
+		t.Error("Expected a duplicate job to be refused")
+	}
+
+	jobs := s.List()
+	if len(jobs) != 2 || jobs[0].Name != "answer" || jobs[0].Next.IsZero() || !jobs[0].LastRun.IsZero() {
+		t.Fatalf("Unexpected jobs %+v", jobs)
+	}
+
+	// Run the jobs now rather than waiting for their schedule
+	s.run(s.jobs["answer"])
+	s.run(s.jobs["trap"])
+	s.run(s.jobs["trap"])
+
+	jobs = s.List()
+	if answer := jobs[0]; answer.Runs != 1 || answer.Failures != 0 || len(answer.LastResult) != 1 || answer.LastResult[0] != 42 || answer.LastError != "" {
+		t.Errorf("Unexpected state of answer %+v", answer)
+	}
+	if trap := jobs[1]; trap.Runs != 2 || trap.Failures != 2 || trap.LastError == "" || trap.LastRun.IsZero() {
+		t.Errorf("Unexpected state of trap %+v", trap)
+	}
+
+	if !s.Delete("trap") || s.Delete("trap") {
+		t.Error("Expected trap to be deleted once")
+	}
+	if jobs := s.List(); len(jobs) != 1 {
+		t.Errorf("Expected one job left, got %+v", jobs)
+	}
+}
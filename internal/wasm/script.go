@@ -0,0 +1,141 @@
+package wasm
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tetratelabs/wazero/api"
+)
+
+// Scripts run multi-key read-modify-write logic on the server, like EVAL
+// scripts in Redis. A script is a module exporting its memory and:
+//
+//	alloc(size i32) -> i32
+//	eval(ptr i32, len i32) -> i64
+//
+// The host writes {"keys": [...], "argv": [...]} as JSON where alloc makes
+// room and calls eval, which runs commands with the call host function and
+// returns where it wrote its reply as JSON, packed as ptr<<32 | len; 0 is
+// a null reply. call takes the command as a JSON array of strings and
+// writes its reply as JSON, like get writes a value:
+//
+//	call(cmd_ptr i32, cmd_len i32, buf_ptr i32, buf_cap i32) -> i32
+
+// ErrNoScript is returned when running a script that is not loaded
+var ErrNoScript = errors.New("no matching script")
+
+// CommandCaller runs a command for a script and returns its reply encoded
+// as JSON
+type CommandCaller func(args []string) []byte
+
+// scriptPrefix prefixes the names of scripts among the functions
+const scriptPrefix = "script:"
+
+// callerKey is the context key of the CommandCaller of a running script
+type callerKey struct{}
+
+// ScriptSHA returns the hex SHA1 digest a script is cached under
+func ScriptSHA(body []byte) string {
+	sum := sha1.Sum(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadScript compiles a script and caches it under its SHA1 digest, which
+// it returns. Loading a cached script again does nothing.
+func (w *WASMRuntime) LoadScript(ctx context.Context, body []byte) (string, error) {
+	sha := ScriptSHA(body)
+	if w.ScriptExists(sha) {
+		return sha, nil
+	}
+
+	name := scriptPrefix + sha
+	if err := w.LoadFunction(ctx, name, body); err != nil {
+		return "", err
+	}
+	if err := w.checkExports(name, "by scripts", true, "alloc", "eval"); err != nil {
+		w.UnloadFunction(ctx, name)
+		return "", err
+	}
+	return sha, nil
+}
+
+// ScriptExists reports whether a script is cached
+func (w *WASMRuntime) ScriptExists(sha string) bool {
+	_, err := w.function(scriptPrefix + strings.ToLower(sha))
+	return err == nil
+}
+
+// FlushScripts removes every cached script, once its running call
+// completes, and returns how many were cached
+func (w *WASMRuntime) FlushScripts(ctx context.Context) int {
+	w.mu.RLock()
+	var names []string
+	for name := range w.functions {
+		if strings.HasPrefix(name, scriptPrefix) {
+			names = append(names, name)
+		}
+	}
+	w.mu.RUnlock()
+
+	flushed := 0
+	for _, name := range names {
+		if w.UnloadFunction(ctx, name) {
+			flushed++
+		}
+	}
+	return flushed
+}
+
+// RunScript runs a cached script with keys and argv, calling its commands
+// with caller, and returns its reply as JSON, nil for a null reply. A
+// script runs one call at a time.
+func (w *WASMRuntime) RunScript(ctx context.Context, sha string, keys, argv []string, caller CommandCaller) ([]byte, error) {
+	f, err := w.function(scriptPrefix + strings.ToLower(sha))
+	if err != nil {
+		return nil, ErrNoScript
+	}
+
+	input, err := json.Marshal(struct {
+		Keys []string `json:"keys"`
+		Argv []string `json:"argv"`
+	}{append([]string{}, keys...), append([]string{}, argv...)})
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	output, err := w.exchange(context.WithValue(ctx, callerKey{}, caller), f, "eval", input)
+	if err != nil {
+		return nil, err
+	}
+	if output != nil && !json.Valid(output) {
+		return nil, fmt.Errorf("script %s returned an invalid reply", sha)
+	}
+	return output, nil
+}
+
+// hostCall implements call, running a command of a script
+func (w *WASMRuntime) hostCall(ctx context.Context, m api.Module, cmdPtr, cmdLen, bufPtr, bufCap uint32) int32 {
+	caller, ok := ctx.Value(callerKey{}).(CommandCaller)
+	if !ok {
+		panic(fmt.Errorf("function %s called a command outside a script", m.Name()))
+	}
+
+	var args []string
+	if err := json.Unmarshal([]byte(readString(m, cmdPtr, cmdLen)), &args); err != nil || len(args) == 0 {
+		panic(fmt.Errorf("function %s called a command that is not a JSON array of strings", m.Name()))
+	}
+
+	reply := caller(args)
+	if uint32(len(reply)) <= bufCap {
+		writeBytes(m, bufPtr, reply)
+	}
+	return int32(len(reply))
+}
@@ -0,0 +1,39 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestLoadScript(t *testing.T) {
+	ctx := context.Background()
+	runtime := NewWASMRuntime(ctx)
+	defer runtime.Close(ctx)
+
+	if _, err := runtime.LoadScript(ctx, answerModule); err == nil {
+		t.Error("Expected a module without alloc and eval to be refused")
+	}
+	if runtime.ScriptExists(ScriptSHA(answerModule)) {
+		t.Error("Expected a refused script not to be cached")
+	}
+	if _, err := runtime.LoadScript(ctx, []byte("return 1")); err == nil {
+		t.Error("Expected a script that is not WASM to be refused")
+	}
+
+	_, err := runtime.RunScript(ctx, ScriptSHA(answerModule), nil, nil, func([]string) []byte { return nil })
+	if !errors.Is(err, ErrNoScript) {
+		t.Errorf("Expected ErrNoScript, got %v", err)
+	}
+
+	// Scripts are functions like any other, flushed apart from them
+	if err := runtime.LoadFunction(ctx, "answer", answerModule); err != nil {
+		t.Fatal(err)
+	}
+	if flushed := runtime.FlushScripts(ctx); flushed != 0 {
+		t.Errorf("Expected no script to flush, got %d", flushed)
+	}
+	if _, err := runtime.ExecuteFunction(ctx, "answer", "run"); err != nil {
+		t.Errorf("Expected functions to survive a flush, got %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package watchdog
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"runtime/metrics"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultInterval is how often the watchdog samples the process
+	DefaultInterval = 100 * time.Millisecond
+
+	// DefaultThreshold is the delay above which a sample counts as a stall
+	DefaultThreshold = 250 * time.Millisecond
+)
+
+// Runtime histograms read every sample; both are cumulative since start
+const (
+	gcPausesMetric       = "/gc/pauses:seconds"
+	schedLatenciesMetric = "/sched/latencies:seconds"
+)
+
+// Causes a stall is attributed to
+const (
+	CauseGC        = "gc"        // The garbage collector stopped the world
+	CauseScheduler = "scheduler" // Goroutines waited for a CPU
+	CauseDispatch  = "dispatch"  // The shard owners were slow with the CPU available
+)
+
+// Sample is one measurement of how responsive the process is
+type Sample struct {
+	Time time.Time
+
+	// Lag is how late the watchdog's own timer fired, the delay any
+	// goroutine waking up saw
+	Lag time.Duration
+
+	// Probe is the slowest no-op round trip through the command path
+	Probe time.Duration
+
+	// GCPause and SchedLatency are the longest stop-the-world GC pause and
+	// the longest wait of a runnable goroutine for a CPU since the previous
+	// sample, to histogram bucket precision
+	GCPause      time.Duration
+	SchedLatency time.Duration
+}
+
+// Stalled reports whether the process was unresponsive for threshold or more
+func (s Sample) Stalled(threshold time.Duration) bool {
+	return s.Lag >= threshold || s.Probe >= threshold
+}
+
+// Cause attributes a stall to whichever delay explains most of it: GC
+// pauses and scheduling latency delay every goroutine, so a slow probe
+// without either points at the command path itself
+func (s Sample) Cause() string {
+	stall := max(s.Lag, s.Probe)
+	switch {
+	case s.GCPause >= s.SchedLatency && s.GCPause >= stall/2:
+		return CauseGC
+	case s.SchedLatency >= stall/2 || s.Lag >= s.Probe:
+		return CauseScheduler
+	default:
+		return CauseDispatch
+	}
+}
+
+// Watchdog periodically measures how long the process takes to react, so
+// latency spikes can be told apart: GC pauses and CPU saturation delay
+// every goroutine, network problems delay none of them.
+type Watchdog struct {
+	interval  time.Duration
+	threshold time.Duration
+	probe     func() time.Duration
+	observe   []func(Sample)
+
+	samples []metrics.Sample
+	counts  [2][]uint64 // Bucket counts of the runtime histograms at the previous sample
+
+	mu   sync.Mutex
+	last Sample
+}
+
+// New creates a watchdog sampling every interval. probe runs a no-op
+// through the command path and returns how long it took; it may be nil.
+// Samples delayed by threshold or more are logged as stalls.
+func New(interval, threshold time.Duration, probe func() time.Duration) *Watchdog {
+	return &Watchdog{
+		interval:  interval,
+		threshold: threshold,
+		probe:     probe,
+		samples: []metrics.Sample{
+			{Name: gcPausesMetric},
+			{Name: schedLatenciesMetric},
+		},
+	}
+}
+
+// OnSample calls fn with every sample, from the watchdog goroutine
+func (w *Watchdog) OnSample(fn func(Sample)) {
+	w.observe = append(w.observe, fn)
+}
+
+// Last returns the most recent sample
+func (w *Watchdog) Last() Sample {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.last
+}
+
+// Run samples until ctx is cancelled
+func (w *Watchdog) Run(ctx context.Context) {
+	w.readRuntime() // Baseline, so the first sample only covers its interval
+
+	timer := time.NewTimer(w.interval)
+	defer timer.Stop()
+	due := time.Now().Add(w.interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			now := time.Now()
+			w.record(w.sample(now, max(now.Sub(due), 0)))
+
+			due = time.Now().Add(w.interval)
+			timer.Reset(w.interval)
+		}
+	}
+}
+
+// sample measures the process woken up lag after it expected to be
+func (w *Watchdog) sample(now time.Time, lag time.Duration) Sample {
+	sample := Sample{Time: now, Lag: lag}
+	if w.probe != nil {
+		sample.Probe = w.probe()
+	}
+	sample.GCPause, sample.SchedLatency = w.readRuntime()
+	return sample
+}
+
+// record keeps sample, hands it to the observers and logs it if it stalled
+func (w *Watchdog) record(sample Sample) {
+	w.mu.Lock()
+	w.last = sample
+	w.mu.Unlock()
+
+	for _, fn := range w.observe {
+		fn(sample)
+	}
+
+	if w.threshold > 0 && sample.Stalled(w.threshold) {
+		slog.Warn("Event loop stall",
+			"cause", sample.Cause(),
+			"lag", sample.Lag,
+			"probe", sample.Probe,
+			"gc_pause", sample.GCPause,
+			"sched_latency", sample.SchedLatency,
+		)
+	}
+}
+
+// readRuntime returns the longest GC pause and scheduling latency recorded
+// by the runtime since the previous call
+func (w *Watchdog) readRuntime() (gcPause, schedLatency time.Duration) {
+	metrics.Read(w.samples)
+
+	var longest [2]time.Duration
+	for i, sample := range w.samples {
+		if sample.Value.Kind() != metrics.KindFloat64Histogram {
+			continue
+		}
+		histogram := sample.Value.Float64Histogram()
+		longest[i] = newMax(histogram, w.counts[i])
+		w.counts[i] = append(w.counts[i][:0], histogram.Counts...)
+	}
+	return longest[0], longest[1]
+}
+
+// newMax returns the upper bound of the highest bucket of histogram that
+// gained observations since previous, 0 if none did
+func newMax(histogram *metrics.Float64Histogram, previous []uint64) time.Duration {
+	for i := len(histogram.Counts) - 1; i >= 0; i-- {
+		before := uint64(0)
+		if i < len(previous) {
+			before = previous[i]
+		}
+		if histogram.Counts[i] == before {
+			continue
+		}
+
+		// Buckets holds the boundaries, one more than Counts; the last
+		// bucket may be unbounded, in which case its lower bound is used
+		bound := histogram.Buckets[i+1]
+		if math.IsInf(bound, 1) {
+			bound = histogram.Buckets[i]
+		}
+		return time.Duration(bound * float64(time.Second))
+	}
+	return 0
+}
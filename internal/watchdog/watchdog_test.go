@@ -0,0 +1,91 @@
+package watchdog
+
+import (
+	"context"
+	"math"
+	"runtime/metrics"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCause(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		sample Sample
+		cause  string
+	}{
+		{Sample{Lag: 300 * ms, Probe: 300 * ms, GCPause: 200 * ms}, CauseGC},
+		{Sample{Lag: 300 * ms, Probe: 300 * ms, SchedLatency: 250 * ms, GCPause: ms}, CauseScheduler},
+		{Sample{Lag: 300 * ms, Probe: ms}, CauseScheduler},
+		{Sample{Lag: ms, Probe: 300 * ms, SchedLatency: ms}, CauseDispatch},
+	}
+	for _, test := range tests {
+		if cause := test.sample.Cause(); cause != test.cause {
+			t.Errorf("Expected %+v to be caused by %s, got %s", test.sample, test.cause, cause)
+		}
+	}
+
+	if (Sample{Lag: 10 * ms, Probe: 20 * ms}).Stalled(25 * ms) {
+		t.Error("Expected a sample under the threshold not to stall")
+	}
+	if !(Sample{Probe: 30 * ms}).Stalled(25 * ms) {
+		t.Error("Expected a slow probe to stall")
+	}
+}
+
+func TestNewMax(t *testing.T) {
+	histogram := &metrics.Float64Histogram{
+		Counts:  []uint64{5, 2, 1, 0},
+		Buckets: []float64{0, 0.001, 0.01, 0.1, math.Inf(1)},
+	}
+
+	if longest := newMax(histogram, nil); longest != 100*time.Millisecond {
+		t.Errorf("Expected the highest bucket with observations, got %v", longest)
+	}
+	if longest := newMax(histogram, []uint64{4, 2, 1, 0}); longest != time.Millisecond {
+		t.Errorf("Expected only new observations to count, got %v", longest)
+	}
+	if longest := newMax(histogram, []uint64{5, 2, 1, 0}); longest != 0 {
+		t.Errorf("Expected 0 without new observations, got %v", longest)
+	}
+
+	histogram.Counts[3] = 1
+	if longest := newMax(histogram, []uint64{5, 2, 1, 0}); longest != 100*time.Millisecond {
+		t.Errorf("Expected the lower bound of the unbounded bucket, got %v", longest)
+	}
+}
+
+func TestWatchdogRun(t *testing.T) {
+	probe := func() time.Duration {
+		time.Sleep(30 * time.Millisecond)
+		return 30 * time.Millisecond
+	}
+	w := New(5*time.Millisecond, 20*time.Millisecond, probe)
+
+	var mu sync.Mutex
+	var samples []Sample
+	w.OnSample(func(s Sample) {
+		mu.Lock()
+		samples = append(samples, s)
+		mu.Unlock()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	w.Run(ctx)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(samples) < 2 {
+		t.Fatalf("Expected several samples, got %d", len(samples))
+	}
+	for _, s := range samples {
+		if !s.Stalled(20*time.Millisecond) || s.Probe != 30*time.Millisecond {
+			t.Errorf("Expected every sample to stall on the probe, got %+v", s)
+		}
+	}
+	if last := w.Last(); last.Time != samples[len(samples)-1].Time {
+		t.Errorf("Expected Last to return the latest sample, got %+v", last)
+	}
+}